@@ -6,6 +6,7 @@ package api
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
 
 	"github.com/ironcore-dev/controller-utils/metautils"
 	irimeta "github.com/ironcore-dev/ironcore/iri/apis/meta/v1alpha1"
@@ -111,3 +112,36 @@ func IsManagedBy(o Object, manager string) bool {
 	actual, ok := o.GetLabels()[ManagerLabel]
 	return ok && actual == manager
 }
+
+// IsDeletionProtected reports whether the DeletionProtectionAnnotation protects the object against deletion.
+func IsDeletionProtected(o Metadata) bool {
+	return annotationTrue(o, DeletionProtectionAnnotation)
+}
+
+// IsForceDeleted reports whether the ForceDeleteAnnotation requests the forced deletion of the object.
+func IsForceDeleted(o Metadata) bool {
+	return annotationTrue(o, ForceDeleteAnnotation)
+}
+
+func annotationTrue(o Metadata, key string) bool {
+	annotations, err := GetAnnotationsAnnotation(o)
+	if err != nil {
+		return false
+	}
+	value, _ := strconv.ParseBool(annotations[key])
+	return value
+}
+
+// BootOrder returns the boot priority of a device given by the BootOrderAttribute of its attributes, if any.
+func BootOrder(attributes map[string]string) (uint, bool, error) {
+	value, ok := attributes[BootOrderAttribute]
+	if !ok {
+		return 0, false, nil
+	}
+
+	order, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || order == 0 {
+		return 0, false, fmt.Errorf("invalid boot order %q, expected a positive integer", value)
+	}
+	return uint(order), true, nil
+}
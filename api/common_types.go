@@ -7,11 +7,109 @@ const (
 	LabelsAnnotation = "libvirt-provider.ironcore.dev/labels"
 
 	AnnotationsAnnotation = "libvirt-provider.ironcore.dev/annotations"
+
+	// TraceParentAnnotation holds the W3C trace context of the request that created a machine, so the
+	// reconciliations creating its domain continue the trace of the request. It is removed once the domain is
+	// created.
+	TraceParentAnnotation = "libvirt-provider.ironcore.dev/traceparent"
+)
+
+const (
+	// FlattenRootDiskAnnotation is an annotation clients can set on machines to have the overlay of their
+	// root disk flattened into a standalone disk while they are powered off, e.g. before a snapshot or migration.
+	FlattenRootDiskAnnotation = "libvirt-provider.ironcore.dev/flatten-root-disk"
+	// RootDiskSizeAnnotation is an annotation clients can set on machines at creation to request the virtual
+	// size of their root disk as resource quantity, e.g. 20Gi. The root disk is never shrunk below its image.
+	RootDiskSizeAnnotation = "libvirt-provider.ironcore.dev/root-disk-size"
+	// WatchdogActionAnnotation is an annotation clients can set on machines at creation to get a watchdog device
+	// with the given action (one of WatchdogActions), overriding the default of the provider.
+	WatchdogActionAnnotation = "libvirt-provider.ironcore.dev/watchdog-action"
+	// RestartPolicyAnnotation is an annotation clients can set on machines at creation to choose when their guest
+	// is restarted after it stopped unexpectedly (one of RestartPolicies), overriding the default of the provider.
+	RestartPolicyAnnotation = "libvirt-provider.ironcore.dev/restart-policy"
+	// TPMAnnotation is an annotation clients can set on machines at creation to get an emulated TPM 2.0 ("true").
+	// The event log of the measured boot is exported to attestation services by the streaming server.
+	TPMAnnotation = "libvirt-provider.ironcore.dev/tpm"
+	// LaunchSecurityAnnotation is an annotation clients can set on machines at creation to encrypt their memory
+	// (one of LaunchSecurities). The launch measurement is exported to attestation services by the streaming server.
+	LaunchSecurityAnnotation = "libvirt-provider.ironcore.dev/launch-security"
+	// ClockAnnotation is an annotation clients can set on machines at creation to configure the clock and timers of
+	// their guest, e.g. profile=windows,tsc-frequency=2500000000. The profile (one of ClockProfiles) overrides the
+	// default of the provider, the offset, hpet, hyperv and tsc-frequency keys override single settings of it.
+	ClockAnnotation = "libvirt-provider.ironcore.dev/clock"
+	// MachineClassAnnotation is an annotation clients can update on machines to change their machine class.
+	// The vCPUs and memory of running machines are hot plugged as far as their domains allow.
+	MachineClassAnnotation = "libvirt-provider.ironcore.dev/machine-class"
+	// PCIDevicesAnnotation is an annotation clients can update on machines to pass host PCI devices through to them,
+	// e.g. nvidia.com/gpu=2,example.com/fpga=1. Devices are hot plugged into running machines.
+	PCIDevicesAnnotation = "libvirt-provider.ironcore.dev/pci-devices"
+	// MdevDevicesAnnotation is an annotation clients can update on machines to attach mediated devices, e.g. vGPUs,
+	// to them, e.g. nvidia.com/grid-t4-4q=1. Devices are hot plugged into running machines.
+	MdevDevicesAnnotation = "libvirt-provider.ironcore.dev/mdev-devices"
+	// USBDevicesAnnotation is an annotation clients can update on machines to pass host USB devices through to them,
+	// e.g. example.com/token=1. Devices are hot plugged into running machines and attached again once they are
+	// plugged into the host again.
+	USBDevicesAnnotation = "libvirt-provider.ironcore.dev/usb-devices"
+	// RebuildAnnotation is an annotation clients can update on machines to recreate their root disk from their
+	// image, keeping their ID, network interfaces and volumes. Every new value triggers one rebuild.
+	RebuildAnnotation = "libvirt-provider.ironcore.dev/rebuild"
+	// RebuildImageAnnotation is an annotation clients can set along with the RebuildAnnotation to rebuild the
+	// root disk from a new image.
+	RebuildImageAnnotation = "libvirt-provider.ironcore.dev/rebuild-image"
+	// StopTimeoutAnnotation is an annotation clients can set on machines before powering them off to override the
+	// time their guest gets to shut down gracefully, e.g. 30s, before its domain is destroyed.
+	StopTimeoutAnnotation = "libvirt-provider.ironcore.dev/stop-timeout"
+	// SuspendAnnotation is an annotation clients can update on machines to suspend them to disk ("true") and
+	// resume them later on. Suspended machines keep their disks but release their CPU.
+	SuspendAnnotation = "libvirt-provider.ironcore.dev/suspend"
+	// IdempotencyKeyAnnotation is an annotation clients can set on machines at creation to make retries of the
+	// creation return the machine created first instead of creating another one. If not set, the UID of the
+	// machinepoollet machine is used. Creations reusing the key of an existing machine with another machine fail.
+	IdempotencyKeyAnnotation = "libvirt-provider.ironcore.dev/idempotency-key"
+	// DryRunAnnotation is an annotation clients can set on machines at creation ("true") to only check whether the
+	// machine could be created, including the capacity of the host, without creating it.
+	DryRunAnnotation = "libvirt-provider.ironcore.dev/dry-run"
+	// PreferredNUMANodeAnnotation is an annotation clients can set on machines at creation to have them placed on
+	// the given NUMA node, e.g. "1", if it has enough free hugepages.
+	PreferredNUMANodeAnnotation = "libvirt-provider.ironcore.dev/preferred-numa-node"
+	// AvoidNUMANodesAnnotation is an annotation clients can set on machines at creation to keep them off the given
+	// comma-separated NUMA nodes, e.g. "0,2", unless no other node has enough free hugepages.
+	AvoidNUMANodesAnnotation = "libvirt-provider.ironcore.dev/avoid-numa-nodes"
+	// DeletionProtectionAnnotation is an annotation clients can set on machines ("true") to have their deletion
+	// rejected unless the ForceDeleteAnnotation is set as well.
+	DeletionProtectionAnnotation = "libvirt-provider.ironcore.dev/deletion-protection"
+	// ForceDeleteAnnotation is an annotation clients can update on machines ("true") to delete them despite the
+	// DeletionProtectionAnnotation and without graceful shutdown, e.g. to get rid of stuck machines. Setting it on
+	// machines being deleted already escalates their deletion.
+	ForceDeleteAnnotation = "libvirt-provider.ironcore.dev/force-delete"
+	// BootDeviceAnnotation is an annotation clients can set on machines to choose the devices their guest boots from
+	// first (one of BootDevices), e.g. "network" to provision them via PXE. Changes take effect on the next start of
+	// the domain, e.g. after powering the machine off and on.
+	BootDeviceAnnotation = "libvirt-provider.ironcore.dev/boot-device"
+	// IPXEScriptAnnotation is an annotation clients can set on machines booting from the network to have iPXE run
+	// the given script, e.g. "#!ipxe\ndhcp\nchain http://boot.example.com/installer.ipxe", instead of booting via
+	// PXE from DHCP. Changes take effect on the next start of the domain.
+	IPXEScriptAnnotation = "libvirt-provider.ironcore.dev/ipxe-script"
+)
+
+const (
+	// BootOrderAttribute is an attribute of volume connections and network interfaces with the boot priority of
+	// the device, a positive integer. Devices with lower values are tried first.
+	BootOrderAttribute = "boot-order"
 )
 
 const (
 	ManagerLabel = "libvirt-provider.ironcore.dev/manager"
 	ClassLabel   = "libvirt-provider.ironcore.dev/class"
+
+	// NUMANodeLabel is reported on machines bound to a NUMA node with the ID of the node.
+	NUMANodeLabel = "libvirt-provider.ironcore.dev/numa-node"
+)
+
+const (
+	// FinalizersAnnotation is reported on machines being deleted with their comma-separated remaining finalizers,
+	// e.g. "machine,volumes" while the volumes of the machine couldn't be deleted yet.
+	FinalizersAnnotation = "libvirt-provider.ironcore.dev/finalizers"
 )
 
 const (
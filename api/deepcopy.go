@@ -0,0 +1,158 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package api
+
+import (
+	"maps"
+	"net"
+	"slices"
+)
+
+func (m *Metadata) DeepCopyInto(out *Metadata) {
+	*out = *m
+	out.Annotations = maps.Clone(m.Annotations)
+	out.Labels = maps.Clone(m.Labels)
+	if m.DeletedAt != nil {
+		deletedAt := *m.DeletedAt
+		out.DeletedAt = &deletedAt
+	}
+	out.Finalizers = slices.Clone(m.Finalizers)
+}
+
+func (m *Machine) DeepCopy() *Machine {
+	if m == nil {
+		return nil
+	}
+	out := &Machine{}
+	m.DeepCopyInto(out)
+	return out
+}
+
+func (m *Machine) DeepCopyInto(out *Machine) {
+	*out = *m
+	m.Metadata.DeepCopyInto(&out.Metadata)
+	m.Spec.DeepCopyInto(&out.Spec)
+	m.Status.DeepCopyInto(&out.Status)
+}
+
+func (s *MachineSpec) DeepCopyInto(out *MachineSpec) {
+	*out = *s
+	if s.Image != nil {
+		image := *s.Image
+		out.Image = &image
+	}
+	out.Ignition = slices.Clone(s.Ignition)
+	if s.Volumes != nil {
+		out.Volumes = make([]*VolumeSpec, len(s.Volumes))
+		for i, volume := range s.Volumes {
+			out.Volumes[i] = volume.DeepCopy()
+		}
+	}
+	if s.NetworkInterfaces != nil {
+		out.NetworkInterfaces = make([]*NetworkInterfaceSpec, len(s.NetworkInterfaces))
+		for i, nic := range s.NetworkInterfaces {
+			out.NetworkInterfaces[i] = nic.DeepCopy()
+		}
+	}
+	out.PCIDevices = slices.Clone(s.PCIDevices)
+	out.MdevDevices = slices.Clone(s.MdevDevices)
+	out.USBDevices = slices.Clone(s.USBDevices)
+	if s.NUMANode != nil {
+		numaNode := *s.NUMANode
+		out.NUMANode = &numaNode
+	}
+	if s.Clock != nil {
+		clock := *s.Clock
+		out.Clock = &clock
+	}
+	if s.Rebuild != nil {
+		rebuild := *s.Rebuild
+		out.Rebuild = &rebuild
+	}
+	out.Topology = maps.Clone(s.Topology)
+	if s.QoS != nil {
+		qos := *s.QoS
+		out.QoS = &qos
+	}
+}
+
+func (s *MachineStatus) DeepCopyInto(out *MachineStatus) {
+	*out = *s
+	out.VolumeStatus = slices.Clone(s.VolumeStatus)
+	if s.NetworkInterfaceStatus != nil {
+		out.NetworkInterfaceStatus = make([]NetworkInterfaceStatus, len(s.NetworkInterfaceStatus))
+		for i := range s.NetworkInterfaceStatus {
+			s.NetworkInterfaceStatus[i].DeepCopyInto(&out.NetworkInterfaceStatus[i])
+		}
+	}
+	if s.GuestAgentStatus != nil {
+		guestAgentStatus := *s.GuestAgentStatus
+		out.GuestAgentStatus = &guestAgentStatus
+	}
+	out.Conditions = slices.Clone(s.Conditions)
+	out.PCIDevices = slices.Clone(s.PCIDevices)
+	out.MdevDevices = slices.Clone(s.MdevDevices)
+	out.USBDevices = slices.Clone(s.USBDevices)
+	if s.GuestInfo != nil {
+		guestInfo := *s.GuestInfo
+		guestInfo.IPs = slices.Clone(s.GuestInfo.IPs)
+		out.GuestInfo = &guestInfo
+	}
+}
+
+func (v *VolumeSpec) DeepCopy() *VolumeSpec {
+	if v == nil {
+		return nil
+	}
+	out := &VolumeSpec{}
+	*out = *v
+	if v.EmptyDisk != nil {
+		emptyDisk := *v.EmptyDisk
+		out.EmptyDisk = &emptyDisk
+	}
+	if v.Connection != nil {
+		out.Connection = &VolumeConnection{}
+		v.Connection.DeepCopyInto(out.Connection)
+	}
+	return out
+}
+
+func (c *VolumeConnection) DeepCopyInto(out *VolumeConnection) {
+	*out = *c
+	out.Attributes = maps.Clone(c.Attributes)
+	out.SecretData = cloneBytesMap(c.SecretData)
+	out.EncryptionData = cloneBytesMap(c.EncryptionData)
+}
+
+func (n *NetworkInterfaceSpec) DeepCopy() *NetworkInterfaceSpec {
+	if n == nil {
+		return nil
+	}
+	out := &NetworkInterfaceSpec{}
+	*out = *n
+	out.Ips = slices.Clone(n.Ips)
+	out.Attributes = maps.Clone(n.Attributes)
+	return out
+}
+
+func (n *NetworkInterfaceStatus) DeepCopyInto(out *NetworkInterfaceStatus) {
+	*out = *n
+	if n.IPs != nil {
+		out.IPs = make([]net.IP, len(n.IPs))
+		for i, ip := range n.IPs {
+			out.IPs[i] = slices.Clone(ip)
+		}
+	}
+}
+
+func cloneBytesMap(m map[string][]byte) map[string][]byte {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string][]byte, len(m))
+	for k, v := range m {
+		out[k] = slices.Clone(v)
+	}
+	return out
+}
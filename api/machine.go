@@ -4,6 +4,7 @@
 package api
 
 import (
+	"fmt"
 	"net"
 	"time"
 )
@@ -16,6 +17,8 @@ type Machine struct {
 }
 
 type MachineSpec struct {
+	// Power is the desired power state of the machine. The observed one, i.e. whether the
+	// domain of the machine exists, is reported in MachineStatus.Power.
 	Power PowerState `json:"power"`
 
 	CpuMillis   int64 `json:"cpuMillis"`
@@ -24,12 +27,83 @@ type MachineSpec struct {
 	Image    *string `json:"image"`
 	Ignition []byte  `json:"ignition"`
 
+	// RootDiskBytes is the requested virtual size of the root disk. If zero, the root disk has the size of the image.
+	RootDiskBytes int64 `json:"rootDiskBytes,omitempty"`
+
 	Volumes           []*VolumeSpec           `json:"volumes"`
 	NetworkInterfaces []*NetworkInterfaceSpec `json:"networkInterfaces"`
 
 	ShutdownAt time.Time `json:"shutdownAt,omitempty"`
+	// StopTimeout is the time the guest gets to shut down gracefully on power off. If zero, the default of the
+	// provider applies.
+	StopTimeout time.Duration `json:"stopTimeout,omitempty"`
 
 	GuestAgent GuestAgent `json:"guestAgent"`
+
+	// WatchdogAction is the action taken if the watchdog of the guest fires. If empty, the machine has no watchdog.
+	WatchdogAction WatchdogAction `json:"watchdogAction,omitempty"`
+
+	// RestartPolicy determines whether the guest is restarted after it stopped unexpectedly.
+	// If empty, RestartPolicyAlways applies.
+	RestartPolicy RestartPolicy `json:"restartPolicy,omitempty"`
+
+	// TPM requests an emulated TPM 2.0 for measured boot. Its state is kept across restarts of the guest.
+	TPM bool `json:"tpm,omitempty"`
+
+	// LaunchSecurity is the memory encryption of the guest. If empty, the memory of the guest is not encrypted.
+	LaunchSecurity LaunchSecurity `json:"launchSecurity,omitempty"`
+
+	// BootDevice determines which devices the guest boots from first. If empty, BootDeviceDisk applies.
+	BootDevice BootDevice `json:"bootDevice,omitempty"`
+	// IPXEScript is the script iPXE runs when the guest boots from the network. If empty, the guest boots via PXE.
+	IPXEScript string `json:"ipxeScript,omitempty"`
+
+	// PCIDevices are the host PCI devices passed through to the guest.
+	PCIDevices []PCIDeviceSpec `json:"pciDevices,omitempty"`
+	// MdevDevices are the mediated devices, e.g. vGPUs, passed through to the guest.
+	MdevDevices []MdevDeviceSpec `json:"mdevDevices,omitempty"`
+	// USBDevices are the host USB devices passed through to the guest.
+	USBDevices []USBDeviceSpec `json:"usbDevices,omitempty"`
+
+	// NUMANode is the host NUMA node the hugepage-backed memory and the vCPUs of the guest are allocated on.
+	// If nil, the guest is not bound to a node.
+	NUMANode *int `json:"numaNode,omitempty"`
+
+	// Clock configures the clock and timers of the guest. If nil, the settings of ClockProfileDefault apply.
+	Clock *ClockSpec `json:"clock,omitempty"`
+
+	// Suspend requests the guest to be suspended to disk. The guest is resumed once it is unset.
+	Suspend bool `json:"suspend,omitempty"`
+
+	// Rebuild requests the root disk to be recreated from the image. If nil, no rebuild has been requested.
+	Rebuild *RebuildSpec `json:"rebuild,omitempty"`
+
+	// Adopted reports that the machine was created from an orphaned domain rather than via IRI. As their volumes
+	// and network interfaces are unknown, the domains of adopted machines are observed but neither updated nor
+	// created again.
+	Adopted bool `json:"adopted,omitempty"`
+
+	// DomainUUID is the UUID of the libvirt domain of the machine. If empty, the machine ID is used.
+	DomainUUID string `json:"domainUUID,omitempty"`
+
+	// Topology holds the topology labels of the host, e.g. its rack and zone, at the creation of the machine.
+	Topology map[string]string `json:"topology,omitempty"`
+
+	// QoS is the cpu and memory tuning of the guest derived from the QoS tier of its machine class. If nil, the
+	// guest is not tuned.
+	QoS *QoSSpec `json:"qos,omitempty"`
+
+	// IOThreads is the number of QEMU iothreads of the guest requested by its machine class. If zero, the
+	// number is derived from the disks of the guest. Changes take effect when the domain is created again.
+	IOThreads uint `json:"ioThreads,omitempty"`
+}
+
+// GetDomainUUID returns the UUID of the libvirt domain of the machine.
+func (m *Machine) GetDomainUUID() string {
+	if m.Spec.DomainUUID != "" {
+		return m.Spec.DomainUUID
+	}
+	return m.ID
 }
 
 type GuestAgent string
@@ -39,12 +113,277 @@ const (
 	GuestAgentQemu GuestAgent = "Qemu"
 )
 
+type WatchdogAction string
+
+const (
+	WatchdogActionNone     WatchdogAction = "none"
+	WatchdogActionReset    WatchdogAction = "reset"
+	WatchdogActionPowerOff WatchdogAction = "poweroff"
+)
+
+func WatchdogActions() []WatchdogAction {
+	return []WatchdogAction{WatchdogActionNone, WatchdogActionReset, WatchdogActionPowerOff}
+}
+
+type LaunchSecurity string
+
+const (
+	// LaunchSecuritySEV encrypts the memory of the guest with AMD SEV.
+	LaunchSecuritySEV LaunchSecurity = "sev"
+)
+
+func LaunchSecurities() []LaunchSecurity {
+	return []LaunchSecurity{LaunchSecuritySEV}
+}
+
+// QoSTier determines how the guests of a machine class compete for the cpu and memory of the host.
+type QoSTier string
+
+const (
+	// QoSTierGuaranteed guests get the full weight of their cpu and are capped at it.
+	QoSTierGuaranteed QoSTier = "guaranteed"
+	// QoSTierBurstable guests get the weight of their overcommitted share of the host and may use idle cpus.
+	// Under memory contention, their memory is reclaimed down to their share of the host.
+	QoSTierBurstable QoSTier = "burstable"
+)
+
+func QoSTiers() []QoSTier {
+	return []QoSTier{QoSTierGuaranteed, QoSTierBurstable}
+}
+
+type QoSSpec struct {
+	Tier QoSTier `json:"tier"`
+	// CPUShares is the weight of the guest when vCPUs compete for host cpus.
+	CPUShares uint `json:"cpuShares"`
+	// CPUQuotaMillis caps the cpu time of all vCPUs together. If zero, the guest may use idle host cpus.
+	CPUQuotaMillis int64 `json:"cpuQuotaMillis,omitempty"`
+	// MemorySoftLimitBytes is the memory the guest is reclaimed down to under memory contention of the host.
+	// If zero, the memory of the guest is not reclaimed.
+	MemorySoftLimitBytes int64 `json:"memorySoftLimitBytes,omitempty"`
+}
+
+type ClockOffset string
+
+const (
+	ClockOffsetUTC       ClockOffset = "utc"
+	ClockOffsetLocalTime ClockOffset = "localtime"
+)
+
+func ClockOffsets() []ClockOffset {
+	return []ClockOffset{ClockOffsetUTC, ClockOffsetLocalTime}
+}
+
+// ClockProfile is a preset of the clock and timers of a guest.
+type ClockProfile string
+
+const (
+	// ClockProfileDefault suits Linux guests: a UTC real time clock and an HPET.
+	ClockProfileDefault ClockProfile = "default"
+	// ClockProfileWindows suits Windows guests: a local time real time clock and Hyper-V enlightenments
+	// instead of an HPET.
+	ClockProfileWindows ClockProfile = "windows"
+)
+
+func ClockProfiles() []ClockProfile {
+	return []ClockProfile{ClockProfileDefault, ClockProfileWindows}
+}
+
+// Clock returns the clock settings of the profile.
+func (p ClockProfile) Clock() ClockSpec {
+	if p == ClockProfileWindows {
+		return ClockSpec{Offset: ClockOffsetLocalTime, HyperV: true}
+	}
+	return ClockSpec{Offset: ClockOffsetUTC, HPET: true}
+}
+
+type ClockSpec struct {
+	// Offset is the time zone of the real time clock of the guest.
+	Offset ClockOffset `json:"offset"`
+	// HPET adds a high precision event timer to the guest.
+	HPET bool `json:"hpet"`
+	// HyperV enables the Hyper-V enlightenments and clock, which Windows guests need to perform well.
+	HyperV bool `json:"hyperV"`
+	// TSCFrequency is the frequency of the TSC of the guest in Hz. If zero, the TSC is paravirtualized.
+	TSCFrequency uint64 `json:"tscFrequency,omitempty"`
+}
+
+type RebuildSpec struct {
+	// ID identifies the rebuild request, the root disk is rebuilt once per ID.
+	ID string `json:"id"`
+}
+
+type PCIDeviceSpec struct {
+	// Resource is the name of the resource the device is allocated for, e.g. nvidia.com/gpu.
+	Resource string `json:"resource"`
+	// Address is the PCI address of the host device in the form domain:bus:slot.function.
+	Address string `json:"address"`
+}
+
+type MdevDeviceSpec struct {
+	// Resource is the name of the resource the device is allocated for, e.g. nvidia.com/grid-t4-4q.
+	Resource string `json:"resource"`
+	// Parent is the address of the host device the instance is created on, e.g. the PCI address of a GPU.
+	Parent string `json:"parent"`
+	// Type is the mediated device type of the instance, e.g. nvidia-222.
+	Type string `json:"type"`
+	// UUID identifies the instance.
+	UUID string `json:"uuid"`
+}
+
+type USBDeviceSpec struct {
+	// Resource is the name of the resource the device is allocated for, e.g. example.com/token.
+	Resource string `json:"resource"`
+	// ID identifies the device, vendor:product or bus-port.
+	ID string `json:"id"`
+	// Vendor and Product are the USB ids of devices identified by them.
+	Vendor  string `json:"vendor,omitempty"`
+	Product string `json:"product,omitempty"`
+	// Bus and Port are the bus and port chain of devices identified by where they are plugged in.
+	Bus  uint   `json:"bus,omitempty"`
+	Port string `json:"port,omitempty"`
+}
+
+type RestartPolicy string
+
+const (
+	// RestartPolicyAlways restarts the guest whenever it stops, also after a shutdown from within the guest.
+	RestartPolicyAlways RestartPolicy = "Always"
+	// RestartPolicyOnFailure restarts the guest only after it crashed or its QEMU process failed.
+	RestartPolicyOnFailure RestartPolicy = "OnFailure"
+	// RestartPolicyNever keeps the guest stopped until the machine is powered off and on again.
+	RestartPolicyNever RestartPolicy = "Never"
+)
+
+func RestartPolicies() []RestartPolicy {
+	return []RestartPolicy{RestartPolicyAlways, RestartPolicyOnFailure, RestartPolicyNever}
+}
+
+type BootDevice string
+
+const (
+	// BootDeviceDisk boots the guest from its disks first.
+	BootDeviceDisk BootDevice = "disk"
+	// BootDeviceNetwork boots the guest from its network interfaces first, e.g. via PXE, and falls back to its disks.
+	BootDeviceNetwork BootDevice = "network"
+)
+
+func BootDevices() []BootDevice {
+	return []BootDevice{BootDeviceDisk, BootDeviceNetwork}
+}
+
 type MachineStatus struct {
 	VolumeStatus           []VolumeStatus           `json:"volumeStatus"`
 	NetworkInterfaceStatus []NetworkInterfaceStatus `json:"networkInterfaceStatus"`
 	State                  MachineState             `json:"state"`
 	ImageRef               string                   `json:"imageRef"`
 	GuestAgentStatus       *GuestAgentStatus        `json:"guestAgentStatus,omitempty"`
+	Power                  PowerState               `json:"power"`
+	Conditions             []MachineCondition       `json:"conditions,omitempty"`
+	// GuestInfo is the information reported by the guest agent of the machine, if connected.
+	GuestInfo *GuestInfo `json:"guestInfo,omitempty"`
+	// Crashes counts the consecutive crashes of the guest of the machine. It is reset along with Restarts.
+	Crashes int32 `json:"crashes,omitempty"`
+	// Restarts counts the consecutive restarts of the guest after it stopped unexpectedly. It is reset once
+	// the guest keeps running or the machine is powered off.
+	Restarts int32 `json:"restarts,omitempty"`
+	// PCIDevices are the addresses of the host PCI devices attached to the guest. Devices removed from the
+	// spec stay in use until they are detached.
+	PCIDevices []string `json:"pciDevices,omitempty"`
+	// MdevDevices are the mediated device instances created for the guest. Instances are kept while the guest
+	// is stopped and removed once they are no longer in the spec.
+	MdevDevices []MdevDeviceSpec `json:"mdevDevices,omitempty"`
+	// USBDevices are the ids of the host USB devices attached to the guest. Devices removed from the spec stay in
+	// use until they are detached.
+	USBDevices []string `json:"usbDevices,omitempty"`
+	// RebuildID is the ID of the last rebuild of the root disk.
+	RebuildID string `json:"rebuildID,omitempty"`
+	// StopStep is the step the current power off of the machine has escalated to, if any.
+	StopStep StopStep `json:"stopStep,omitempty"`
+}
+
+// StopStep is a step of the escalating power off of a machine.
+type StopStep string
+
+const (
+	// StopStepACPI requests the guest to shut down by pressing the ACPI power button.
+	StopStepACPI StopStep = "ACPI"
+	// StopStepGuestAgent requests the guest to shut down via its guest agent.
+	StopStepGuestAgent StopStep = "GuestAgent"
+	// StopStepDestroy destroys the domain of the machine.
+	StopStepDestroy StopStep = "Destroy"
+)
+
+type MachineConditionType string
+
+const (
+	// MachineConditionGuestAgentConnected reports whether the guest agent of the machine responds.
+	MachineConditionGuestAgentConnected MachineConditionType = "GuestAgentConnected"
+	// MachineConditionStopped reports whether the guest of the machine stopped unexpectedly, e.g. crashed, and
+	// has not been restarted yet. Its reason is the cause of the stop or why the guest is not restarted. It is
+	// unknown while the domain of the machine vanished and the cause is not known yet.
+	MachineConditionStopped MachineConditionType = "Stopped"
+	// MachineConditionResizePending reports whether the vCPUs or memory of the machine could not be hot plugged
+	// and are only applied once the machine is powered off and on again.
+	MachineConditionResizePending MachineConditionType = "ResizePending"
+	// MachineConditionImagePulled reports whether the image of the machine is pulled.
+	MachineConditionImagePulled MachineConditionType = "ImagePulled"
+	// MachineConditionResourcesAllocated reports whether the vCPUs, memory and PCI devices of the machine could
+	// be assigned to its domain.
+	MachineConditionResourcesAllocated MachineConditionType = "ResourcesAllocated"
+	// MachineConditionVolumesAttached reports whether the volumes of the machine are attached to its domain.
+	MachineConditionVolumesAttached MachineConditionType = "VolumesAttached"
+	// MachineConditionDomainDefined reports whether the domain of the machine was created.
+	MachineConditionDomainDefined MachineConditionType = "DomainDefined"
+)
+
+type ConditionStatus string
+
+const (
+	ConditionTrue    ConditionStatus = "True"
+	ConditionFalse   ConditionStatus = "False"
+	ConditionUnknown ConditionStatus = "Unknown"
+)
+
+type MachineCondition struct {
+	Type               MachineConditionType `json:"type"`
+	Status             ConditionStatus      `json:"status"`
+	Reason             string               `json:"reason,omitempty"`
+	Message            string               `json:"message,omitempty"`
+	LastTransitionTime time.Time            `json:"lastTransitionTime"`
+}
+
+// SetCondition sets the condition of its type. The transition time is kept if the status doesn't change.
+func (s *MachineStatus) SetCondition(condition MachineCondition) {
+	for i := range s.Conditions {
+		existing := &s.Conditions[i]
+		if existing.Type != condition.Type {
+			continue
+		}
+
+		if existing.Status == condition.Status {
+			condition.LastTransitionTime = existing.LastTransitionTime
+		}
+		*existing = condition
+		return
+	}
+	s.Conditions = append(s.Conditions, condition)
+}
+
+// GetCondition returns the condition of the given type, if any.
+func (s *MachineStatus) GetCondition(conditionType MachineConditionType) *MachineCondition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == conditionType {
+			return &s.Conditions[i]
+		}
+	}
+	return nil
+}
+
+type GuestInfo struct {
+	Hostname      string   `json:"hostname,omitempty"`
+	OSName        string   `json:"osName,omitempty"`
+	KernelRelease string   `json:"kernelRelease,omitempty"`
+	IPs           []string `json:"ips,omitempty"`
 }
 
 type MachineState string
@@ -64,6 +403,24 @@ const (
 	PowerStatePowerOff PowerState = 1
 )
 
+func (p PowerState) String() string {
+	switch p {
+	case PowerStatePowerOn:
+		return "PowerOn"
+	case PowerStatePowerOff:
+		return "PowerOff"
+	default:
+		return fmt.Sprintf("PowerState(%d)", int32(p))
+	}
+}
+
+// Fields machines can be selected by in addition to the default store fields.
+const (
+	MachineFieldPower         = "spec.power"
+	MachineFieldObservedPower = "status.power"
+	MachineFieldState         = "status.state"
+)
+
 type VolumeSpec struct {
 	Name       string            `json:"name"`
 	Device     string            `json:"device"`
@@ -9,6 +9,7 @@ import (
 	"slices"
 
 	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/controllers"
 )
 
 type GuestAgentOption api.GuestAgent
@@ -46,3 +47,43 @@ func (g *GuestAgentOption) GetAPIGuestAgent() api.GuestAgent {
 func guestAgentOptionAvailable() []string {
 	return []string{string(api.GuestAgentNone), string(api.GuestAgentQemu)}
 }
+
+type DomainAutostartOption controllers.DomainAutostartPolicy
+
+func (d *DomainAutostartOption) String() string {
+	return string(d.GetDomainAutostartPolicy())
+}
+
+func (d *DomainAutostartOption) Set(value string) error {
+	if d == nil {
+		return fmt.Errorf("invalid pointer to object type %s", d.Type())
+	}
+
+	options := domainAutostartOptionAvailable()
+	index := slices.Index(options, value)
+	if index == -1 {
+		return fmt.Errorf("unsupported option %s", value)
+	}
+
+	*d = DomainAutostartOption(value)
+	return nil
+}
+
+func (d *DomainAutostartOption) Type() string {
+	return reflect.TypeOf(*d).String()
+}
+
+func (d *DomainAutostartOption) GetDomainAutostartPolicy() controllers.DomainAutostartPolicy {
+	if d == nil || *d == "" {
+		return controllers.DomainAutostartUnmanaged
+	}
+	return controllers.DomainAutostartPolicy(*d)
+}
+
+func domainAutostartOptionAvailable() []string {
+	var options []string
+	for _, policy := range controllers.DomainAutostartPolicies() {
+		options = append(options, string(policy))
+	}
+	return options
+}
@@ -0,0 +1,223 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package attestation collects the measurements of trusted boots, the SEV launch measurement and the event log of
+// the vTPM of machines, and keeps them per machine in the provider dir for external attestation services.
+package attestation
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/ironcore-dev/libvirt-provider/internal/host"
+	libvirtutils "github.com/ironcore-dev/libvirt-provider/internal/libvirt/utils"
+)
+
+const (
+	perm     = 0777
+	filePerm = 0666
+
+	// LaunchMeasurementFile holds the SEV launch measurement of a machine.
+	LaunchMeasurementFile = "launch-measurement.json"
+	// EventLogFile holds the binary event log of the vTPM of a machine.
+	EventLogFile = "tpm-event-log.bin"
+
+	// GuestEventLogPath is the path Linux guests expose the event log of their measured boot at.
+	GuestEventLogPath = "/sys/kernel/security/tpm0/binary_bios_measurements"
+	// MaxEventLogSize is the maximum size of event logs read from guests.
+	MaxEventLogSize = 4 * 1024 * 1024
+
+	// guestAgentTimeout is the time in seconds libvirt waits for responses of the guest agent.
+	guestAgentTimeout = 5
+	// guestFileReadSize is the number of bytes read from guest files per guest agent command.
+	guestFileReadSize = 48 * 1024
+)
+
+// ErrNotFound is returned if a measurement of a machine has not been collected.
+var ErrNotFound = errors.New("measurement not found")
+
+// LaunchMeasurement is the SEV launch measurement of a machine along with the firmware it was taken by.
+type LaunchMeasurement struct {
+	// Measurement is the base64 encoded measurement of the initial memory of the guest.
+	Measurement string `json:"measurement"`
+	APIMajor    uint32 `json:"apiMajor"`
+	APIMinor    uint32 `json:"apiMinor"`
+	BuildID     uint32 `json:"buildID"`
+	Policy      uint32 `json:"policy"`
+}
+
+// Store keeps the measurements of machines in their attestation directory. They are removed along with the
+// machine directory.
+type Store struct {
+	paths host.Paths
+}
+
+func NewStore(paths host.Paths) *Store {
+	return &Store{paths: paths}
+}
+
+func (s *Store) write(machineID, name string, data []byte) error {
+	dir := s.paths.MachineAttestationDir(machineID)
+	if err := os.MkdirAll(dir, perm); err != nil {
+		return fmt.Errorf("error creating attestation directory: %w", err)
+	}
+
+	// Write to a temporary file first, so readers never see a partially written measurement.
+	tmp := filepath.Join(dir, "."+name)
+	if err := os.WriteFile(tmp, data, filePerm); err != nil {
+		return fmt.Errorf("error writing %s: %w", name, err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, name)); err != nil {
+		return fmt.Errorf("error renaming %s: %w", name, err)
+	}
+	return nil
+}
+
+func (s *Store) read(machineID, name string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.paths.MachineAttestationDir(machineID), name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("error reading %s: %w", name, err)
+	}
+	return data, nil
+}
+
+func (s *Store) WriteLaunchMeasurement(machineID string, measurement *LaunchMeasurement) error {
+	data, err := json.Marshal(measurement)
+	if err != nil {
+		return fmt.Errorf("error encoding launch measurement: %w", err)
+	}
+	return s.write(machineID, LaunchMeasurementFile, data)
+}
+
+func (s *Store) LaunchMeasurement(machineID string) (*LaunchMeasurement, error) {
+	data, err := s.read(machineID, LaunchMeasurementFile)
+	if err != nil {
+		return nil, err
+	}
+
+	measurement := &LaunchMeasurement{}
+	if err := json.Unmarshal(data, measurement); err != nil {
+		return nil, fmt.Errorf("error decoding launch measurement: %w", err)
+	}
+	return measurement, nil
+}
+
+func (s *Store) WriteEventLog(machineID string, eventLog []byte) error {
+	return s.write(machineID, EventLogFile, eventLog)
+}
+
+func (s *Store) EventLog(machineID string) ([]byte, error) {
+	return s.read(machineID, EventLogFile)
+}
+
+// GetLaunchMeasurement returns the SEV launch measurement of the running domain.
+func GetLaunchMeasurement(client libvirtutils.Client, domain libvirt.Domain) (*LaunchMeasurement, error) {
+	params, err := client.DomainGetLaunchSecurityInfo(domain, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error getting launch security info: %w", err)
+	}
+
+	measurement := &LaunchMeasurement{}
+	for _, param := range params {
+		switch param.Field {
+		case "sev-measurement":
+			measurement.Measurement, _ = param.Value.I.(string)
+		case "sev-api-major":
+			measurement.APIMajor, _ = param.Value.I.(uint32)
+		case "sev-api-minor":
+			measurement.APIMinor, _ = param.Value.I.(uint32)
+		case "sev-build-id":
+			measurement.BuildID, _ = param.Value.I.(uint32)
+		case "sev-policy":
+			measurement.Policy, _ = param.Value.I.(uint32)
+		}
+	}
+	if measurement.Measurement == "" {
+		return nil, fmt.Errorf("domain has no launch measurement")
+	}
+	return measurement, nil
+}
+
+// guestAgentCommand executes the command with the arguments with the guest agent of the domain and decodes its
+// return value into res.
+func guestAgentCommand(client libvirtutils.Client, domain libvirt.Domain, command string, args any, res any) error {
+	data, err := json.Marshal(struct {
+		Execute   string `json:"execute"`
+		Arguments any    `json:"arguments,omitempty"`
+	}{command, args})
+	if err != nil {
+		return fmt.Errorf("error encoding %s: %w", command, err)
+	}
+
+	out, err := client.QEMUDomainAgentCommand(domain, string(data), guestAgentTimeout, 0)
+	if err != nil {
+		return err
+	}
+	if len(out) == 0 {
+		return fmt.Errorf("guest agent returned no response to %s", command)
+	}
+
+	response := &struct {
+		Return json.RawMessage `json:"return"`
+	}{}
+	if err := json.Unmarshal([]byte(out[0]), response); err != nil {
+		return fmt.Errorf("error decoding response to %s: %w", command, err)
+	}
+	if res == nil {
+		return nil
+	}
+	if err := json.Unmarshal(response.Return, res); err != nil {
+		return fmt.Errorf("error decoding return value of %s: %w", command, err)
+	}
+	return nil
+}
+
+// ReadGuestEventLog reads the event log of the measured boot from the guest of the domain via its guest agent.
+func ReadGuestEventLog(client libvirtutils.Client, domain libvirt.Domain) (eventLog []byte, retErr error) {
+	var handle int64
+	if err := guestAgentCommand(client, domain, "guest-file-open", map[string]any{
+		"path": GuestEventLogPath,
+		"mode": "r",
+	}, &handle); err != nil {
+		return nil, fmt.Errorf("error opening event log: %w", err)
+	}
+	defer func() {
+		if err := guestAgentCommand(client, domain, "guest-file-close", map[string]any{"handle": handle}, nil); err != nil && retErr == nil {
+			retErr = fmt.Errorf("error closing event log: %w", err)
+		}
+	}()
+
+	for {
+		read := &struct {
+			Count int    `json:"count"`
+			Buf   string `json:"buf-b64"`
+			EOF   bool   `json:"eof"`
+		}{}
+		if err := guestAgentCommand(client, domain, "guest-file-read", map[string]any{
+			"handle": handle,
+			"count":  guestFileReadSize,
+		}, read); err != nil {
+			return nil, fmt.Errorf("error reading event log: %w", err)
+		}
+
+		data, err := base64.StdEncoding.DecodeString(read.Buf)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding event log: %w", err)
+		}
+		eventLog = append(eventLog, data...)
+		if len(eventLog) > MaxEventLogSize {
+			return nil, fmt.Errorf("event log exceeds %d bytes", MaxEventLogSize)
+		}
+		if read.EOF || read.Count == 0 {
+			return eventLog, nil
+		}
+	}
+}
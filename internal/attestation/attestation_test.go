@@ -0,0 +1,214 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package attestation_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/google/uuid"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/attestation"
+	"github.com/ironcore-dev/libvirt-provider/internal/host"
+	"github.com/ironcore-dev/libvirt-provider/pkg/libvirt/fake"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"libvirt.org/go/libvirtxml"
+)
+
+const token = "secret"
+
+var _ = Describe("Attestation", func() {
+	var (
+		lv           *fake.Libvirt
+		paths        host.Host
+		machines     *host.Store[*api.Machine]
+		measurements *attestation.Store
+	)
+
+	BeforeEach(func() {
+		var err error
+		lv = fake.New()
+		paths, err = host.NewAt(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+		machines, err = host.NewStore[*api.Machine](host.Options[*api.Machine]{
+			Dir:     GinkgoT().TempDir(),
+			NewFunc: func() *api.Machine { return &api.Machine{} },
+		})
+		Expect(err).NotTo(HaveOccurred())
+		measurements = attestation.NewStore(paths)
+	})
+
+	createDomain := func(id string, sev bool) libvirt.Domain {
+		desc := &libvirtxml.Domain{Name: id, UUID: id, Type: "kvm"}
+		if sev {
+			policy := uint(3)
+			desc.LaunchSecurity = &libvirtxml.DomainLaunchSecurity{SEV: &libvirtxml.DomainLaunchSecuritySEV{Policy: &policy}}
+		}
+		data, err := desc.Marshal()
+		Expect(err).NotTo(HaveOccurred())
+		dom, err := lv.DomainCreateXML(data, libvirt.DomainNone)
+		Expect(err).NotTo(HaveOccurred())
+		return dom
+	}
+
+	setGuestEventLog := func(id string, eventLog []byte) {
+		Expect(lv.SetGuestAgentResponse(id, "guest-file-open", `{"return":1000}`)).To(Succeed())
+		Expect(lv.SetGuestAgentResponse(id, "guest-file-read", fmt.Sprintf(`{"return":{"count":%d,"buf-b64":%q,"eof":true}}`,
+			len(eventLog), base64.StdEncoding.EncodeToString(eventLog)))).To(Succeed())
+		Expect(lv.SetGuestAgentResponse(id, "guest-file-close", `{"return":{}}`)).To(Succeed())
+	}
+
+	Describe("Store", func() {
+		It("should round trip the measurements of machines", func() {
+			_, err := measurements.LaunchMeasurement("machine-a")
+			Expect(err).To(MatchError(attestation.ErrNotFound))
+			_, err = measurements.EventLog("machine-a")
+			Expect(err).To(MatchError(attestation.ErrNotFound))
+
+			measurement := &attestation.LaunchMeasurement{Measurement: "bWVhc3VyZW1lbnQ=", APIMinor: 24, BuildID: 15, Policy: 3}
+			Expect(measurements.WriteLaunchMeasurement("machine-a", measurement)).To(Succeed())
+			Expect(measurements.LaunchMeasurement("machine-a")).To(Equal(measurement))
+
+			Expect(measurements.WriteEventLog("machine-a", []byte{0x01, 0x02})).To(Succeed())
+			Expect(measurements.EventLog("machine-a")).To(Equal([]byte{0x01, 0x02}))
+			Expect(paths.MachineAttestationDir("machine-a")).To(BeADirectory())
+		})
+	})
+
+	Describe("GetLaunchMeasurement", func() {
+		It("should get the launch measurement of SEV domains", func() {
+			id := uuid.NewString()
+			dom := createDomain(id, true)
+
+			digest := sha256.Sum256(dom.UUID[:])
+			Expect(attestation.GetLaunchMeasurement(lv, dom)).To(Equal(&attestation.LaunchMeasurement{
+				Measurement: base64.StdEncoding.EncodeToString(digest[:]),
+				APIMinor:    24,
+				BuildID:     15,
+				Policy:      3,
+			}))
+		})
+
+		It("should fail for domains without SEV", func() {
+			dom := createDomain(uuid.NewString(), false)
+			_, err := attestation.GetLaunchMeasurement(lv, dom)
+			Expect(err).To(MatchError(ContainSubstring("no launch measurement")))
+		})
+	})
+
+	Describe("ReadGuestEventLog", func() {
+		It("should read the event log via the guest agent", func() {
+			id := uuid.NewString()
+			dom := createDomain(id, false)
+			setGuestEventLog(id, []byte("log"))
+
+			Expect(attestation.ReadGuestEventLog(lv, dom)).To(Equal([]byte("log")))
+		})
+
+		It("should fail if the guest agent is not connected", func() {
+			dom := createDomain(uuid.NewString(), false)
+			_, err := attestation.ReadGuestEventLog(lv, dom)
+			Expect(err).To(MatchError(ContainSubstring("error opening event log")))
+		})
+	})
+
+	Describe("Handler", func() {
+		var handler http.Handler
+
+		BeforeEach(func() {
+			var err error
+			handler, err = attestation.NewHandler(attestation.HandlerOptions{
+				Machines: machines,
+				Libvirt:  lv,
+				Store:    measurements,
+				Token:    token,
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		get := func(path, bearer string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			if bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+bearer)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			return recorder
+		}
+
+		createMachine := func(ctx SpecContext, spec api.MachineSpec) *api.Machine {
+			machine, err := machines.Create(ctx, &api.Machine{Metadata: api.Metadata{ID: uuid.NewString()}, Spec: spec})
+			Expect(err).NotTo(HaveOccurred())
+			return machine
+		}
+
+		It("should require a token", func() {
+			_, err := attestation.NewHandler(attestation.HandlerOptions{Machines: machines, Libvirt: lv, Store: measurements})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should reject requests without a valid token", func(ctx SpecContext) {
+			machine := createMachine(ctx, api.MachineSpec{TPM: true})
+
+			recorder := get("/"+machine.ID+"/event-log", "")
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+			Expect(recorder.Header().Get("WWW-Authenticate")).To(Equal("Bearer"))
+
+			Expect(get("/"+machine.ID+"/event-log", "wrong").Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("should respond not found for unknown machines", func() {
+			Expect(get("/unknown/launch-measurement", token).Code).To(Equal(http.StatusNotFound))
+		})
+
+		It("should respond not found for machines without trusted boot", func(ctx SpecContext) {
+			machine := createMachine(ctx, api.MachineSpec{})
+			Expect(get("/"+machine.ID+"/launch-measurement", token).Code).To(Equal(http.StatusNotFound))
+			Expect(get("/"+machine.ID+"/event-log", token).Code).To(Equal(http.StatusNotFound))
+		})
+
+		It("should serve and store the launch measurement of SEV machines", func(ctx SpecContext) {
+			machine := createMachine(ctx, api.MachineSpec{LaunchSecurity: api.LaunchSecuritySEV})
+
+			By("requesting the measurement of a machine without domain")
+			Expect(get("/"+machine.ID+"/launch-measurement", token).Code).To(Equal(http.StatusNotFound))
+
+			By("requesting the measurement of the running domain")
+			createDomain(machine.ID, true)
+			recorder := get("/"+machine.ID+"/launch-measurement", token)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Header().Get("Content-Type")).To(Equal("application/json"))
+
+			measurement := &attestation.LaunchMeasurement{}
+			Expect(json.Unmarshal(recorder.Body.Bytes(), measurement)).To(Succeed())
+			Expect(measurements.LaunchMeasurement(machine.ID)).To(Equal(measurement))
+		})
+
+		It("should serve the event log of TPM machines", func(ctx SpecContext) {
+			machine := createMachine(ctx, api.MachineSpec{TPM: true, GuestAgent: api.GuestAgentQemu})
+			createDomain(machine.ID, false)
+
+			By("requesting the event log before it was collected")
+			Expect(get("/"+machine.ID+"/event-log", token).Code).To(Equal(http.StatusNotFound))
+
+			By("requesting the event log from the guest")
+			setGuestEventLog(machine.ID, []byte("log"))
+			recorder := get("/"+machine.ID+"/event-log", token)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Body.Bytes()).To(Equal([]byte("log")))
+
+			By("requesting the stored event log once the guest agent is gone")
+			Expect(lv.SetDomainState(machine.ID, libvirt.DomainShutoff)).To(Succeed())
+			recorder = get("/"+machine.ID+"/event-log", token)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Body.Bytes()).To(Equal([]byte("log")))
+		})
+	})
+})
@@ -0,0 +1,172 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package attestation
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	libvirtutils "github.com/ironcore-dev/libvirt-provider/internal/libvirt/utils"
+	"github.com/ironcore-dev/libvirt-provider/internal/store"
+)
+
+type HandlerOptions struct {
+	Machines store.Store[*api.Machine]
+	Libvirt  libvirtutils.Client
+	Store    *Store
+	// Token is the bearer token attestation services have to present.
+	Token string
+}
+
+type handler struct {
+	machines store.Store[*api.Machine]
+	libvirt  libvirtutils.Client
+	store    *Store
+	token    []byte
+}
+
+// NewHandler returns the handler exporting the measurements of machines at /{machineID}/launch-measurement and
+// /{machineID}/event-log. Measurements which have not been collected yet are collected from running machines.
+func NewHandler(opts HandlerOptions) (http.Handler, error) {
+	if opts.Token == "" {
+		return nil, fmt.Errorf("must specify opts.Token")
+	}
+	if opts.Machines == nil || opts.Libvirt == nil || opts.Store == nil {
+		return nil, fmt.Errorf("must specify opts.Machines, opts.Libvirt and opts.Store")
+	}
+
+	h := &handler{
+		machines: opts.Machines,
+		libvirt:  opts.Libvirt,
+		store:    opts.Store,
+		token:    []byte(opts.Token),
+	}
+
+	r := chi.NewRouter()
+	r.Use(h.authenticate)
+	r.Get("/{machineID}/launch-measurement", h.serveLaunchMeasurement)
+	r.Get("/{machineID}/event-log", h.serveEventLog)
+	return r, nil
+}
+
+func (h *handler) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), h.token) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// getMachine gets the machine of the request. If it fails, the error is written to w.
+func (h *handler) getMachine(w http.ResponseWriter, req *http.Request) (*api.Machine, bool) {
+	machine, err := h.machines.Get(req.Context(), chi.URLParam(req, "machineID"))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			http.NotFound(w, req)
+			return nil, false
+		}
+		logr.FromContextOrDiscard(req.Context()).Error(err, "error getting machine")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return nil, false
+	}
+	return machine, true
+}
+
+func machineDomain(machine *api.Machine) libvirt.Domain {
+	return libvirt.Domain{
+		Name: machine.ID,
+		UUID: libvirtutils.UUIDStringToBytes(machine.GetDomainUUID()),
+	}
+}
+
+func (h *handler) serveLaunchMeasurement(w http.ResponseWriter, req *http.Request) {
+	log := logr.FromContextOrDiscard(req.Context())
+
+	machine, ok := h.getMachine(w, req)
+	if !ok {
+		return
+	}
+	if machine.Spec.LaunchSecurity != api.LaunchSecuritySEV {
+		http.Error(w, "machine has no SEV launch security", http.StatusNotFound)
+		return
+	}
+
+	measurement, err := h.store.LaunchMeasurement(machine.ID)
+	if errors.Is(err, ErrNotFound) {
+		// The measurement is stored when the domain is created, but that may have failed.
+		measurement, err = GetLaunchMeasurement(h.libvirt, machineDomain(machine))
+		if err != nil {
+			log.V(1).Info("Failed to get launch measurement", "Error", err)
+			http.Error(w, "launch measurement has not been collected yet", http.StatusNotFound)
+			return
+		}
+		if err := h.store.WriteLaunchMeasurement(machine.ID, measurement); err != nil {
+			log.Error(err, "error storing launch measurement")
+		}
+	}
+	if err != nil {
+		log.Error(err, "error reading launch measurement")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(measurement)
+}
+
+func (h *handler) serveEventLog(w http.ResponseWriter, req *http.Request) {
+	log := logr.FromContextOrDiscard(req.Context())
+
+	machine, ok := h.getMachine(w, req)
+	if !ok {
+		return
+	}
+	if !machine.Spec.TPM {
+		http.Error(w, "machine has no vTPM", http.StatusNotFound)
+		return
+	}
+
+	// The event log only resides in the guest, so it is refreshed from the guest agent whenever it responds and
+	// the last collected one is served otherwise.
+	if machine.Spec.GuestAgent != api.GuestAgentNone {
+		eventLog, err := ReadGuestEventLog(h.libvirt, machineDomain(machine))
+		if err == nil {
+			if err := h.store.WriteEventLog(machine.ID, eventLog); err != nil {
+				log.Error(err, "error storing event log")
+			}
+			writeEventLog(w, eventLog)
+			return
+		}
+		log.V(1).Info("Failed to read event log from guest", "Error", err)
+	}
+
+	eventLog, err := h.store.EventLog(machine.ID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, "event log has not been collected yet, it is read by the guest agent of the machine", http.StatusNotFound)
+			return
+		}
+		log.Error(err, "error reading event log")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	writeEventLog(w, eventLog)
+}
+
+func writeEventLog(w http.ResponseWriter, eventLog []byte) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, _ = w.Write(eventLog)
+}
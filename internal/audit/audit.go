@@ -0,0 +1,203 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxSize is the default size in bytes the audit log is rotated at.
+	DefaultMaxSize = 100 * 1024 * 1024
+
+	backupTimeFormat = "20060102T150405.000000000Z"
+)
+
+// rename renames files. Specs replace it to make rotations fail.
+var rename = os.Rename
+
+// Entry is a record of the audit log.
+type Entry struct {
+	Time time.Time `json:"time"`
+	// Method is the full gRPC method called.
+	Method string `json:"method"`
+	// Caller identifies the caller, see callerFrom.
+	Caller string `json:"caller"`
+	// RequestID is the ID the request is correlated by in logs, traces and metrics.
+	RequestID string `json:"requestID,omitempty"`
+	// MachineID is the ID of the machine the request mutated, if any.
+	MachineID string `json:"machineID,omitempty"`
+	// RequestDigest is the sha256 digest of the request, identifying it without recording secrets.
+	RequestDigest string `json:"requestDigest"`
+	// Code is the gRPC status code of the outcome.
+	Code string `json:"code"`
+	// Error is the error message of failed requests.
+	Error string `json:"error,omitempty"`
+}
+
+// Options configure the audit log file and its retention.
+type Options struct {
+	// Path is the path of the audit log. Rotated files are named after it, suffixed by their rotation time.
+	Path string
+	// MaxSize is the size in bytes the audit log is rotated at. Defaults to DefaultMaxSize.
+	MaxSize int64
+	// MaxBackups is the number of rotated files kept. If zero, all are kept.
+	MaxBackups int
+	// MaxAge is the time rotated files are kept. If zero, they are kept forever.
+	MaxAge time.Duration
+}
+
+// Log is an append-only audit log of JSON lines. It is rotated once it reached its maximum size, rotated
+// files beyond the retention are removed.
+type Log struct {
+	opts Options
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Open opens the audit log at opts.Path, appending to an existing one.
+func Open(opts Options) (*Log, error) {
+	if opts.Path == "" {
+		return nil, fmt.Errorf("must specify audit log path")
+	}
+	if opts.MaxSize == 0 {
+		opts.MaxSize = DefaultMaxSize
+	}
+	if opts.MaxSize < 0 || opts.MaxBackups < 0 || opts.MaxAge < 0 {
+		return nil, fmt.Errorf("audit log max size, max backups and max age must not be negative")
+	}
+	if err := os.MkdirAll(filepath.Dir(opts.Path), 0700); err != nil {
+		return nil, fmt.Errorf("error creating audit log directory: %w", err)
+	}
+
+	l := &Log{opts: opts}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	if err := l.removeExpiredBackups(); err != nil {
+		_ = l.file.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Record appends entry to the audit log. Failing to rotate the audit log is reported after the entry was
+// appended to the current file.
+func (l *Log) Record(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error marshalling audit log entry: %w", err)
+	}
+	data = append(data, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// The entry is written even if the rotation failed, which is retried on the next entry.
+	var rotateErr error
+	if l.size > 0 && l.size+int64(len(data)) > l.opts.MaxSize {
+		rotateErr = l.rotate()
+	}
+
+	n, err := l.file.Write(data)
+	l.size += int64(n)
+	if err != nil {
+		return errors.Join(rotateErr, fmt.Errorf("error writing audit log entry: %w", err))
+	}
+	return rotateErr
+}
+
+// Close closes the audit log.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.file.Close()
+}
+
+func (l *Log) open() error {
+	file, err := os.OpenFile(l.opts.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening audit log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("error getting size of audit log: %w", err)
+	}
+
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+// rotate renames the audit log to a backup and opens a new one. The open file is only swapped once the new one is
+// opened, so entries keep being appended to the open file if rotating fails.
+func (l *Log) rotate() error {
+	backup := l.opts.Path + "." + time.Now().UTC().Format(backupTimeFormat)
+	if err := rename(l.opts.Path, backup); err != nil {
+		return fmt.Errorf("error rotating audit log: %w", err)
+	}
+
+	file := l.file
+	if err := l.open(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("error closing rotated audit log: %w", err)
+	}
+	return l.removeExpiredBackups()
+}
+
+// removeExpiredBackups removes the rotated files beyond MaxBackups and older than MaxAge.
+func (l *Log) removeExpiredBackups() error {
+	dir, prefix := filepath.Dir(l.opts.Path), filepath.Base(l.opts.Path)+"."
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("error reading audit log directory: %w", err)
+	}
+
+	type backup struct {
+		name string
+		time time.Time
+	}
+	var backups []backup
+	for _, entry := range entries {
+		suffix, ok := strings.CutPrefix(entry.Name(), prefix)
+		if !ok {
+			continue
+		}
+		t, err := time.Parse(backupTimeFormat, suffix)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{name: entry.Name(), time: t})
+	}
+	// Newest first.
+	slices.SortFunc(backups, func(a, b backup) int { return b.time.Compare(a.time) })
+
+	var errs []error
+	for i, b := range backups {
+		if (l.opts.MaxBackups == 0 || i < l.opts.MaxBackups) && (l.opts.MaxAge == 0 || time.Since(b.time) <= l.opts.MaxAge) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, b.name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("error removing expired audit log backups: %w", errors.Join(errs...))
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package audit_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+
+	iri "github.com/ironcore-dev/ironcore/iri/apis/machine/v1alpha1"
+	irimeta "github.com/ironcore-dev/ironcore/iri/apis/meta/v1alpha1"
+	"github.com/ironcore-dev/libvirt-provider/internal/audit"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func readEntries(path string) []audit.Entry {
+	file, err := os.Open(path)
+	Expect(err).NotTo(HaveOccurred())
+	defer func() { _ = file.Close() }()
+
+	var entries []audit.Entry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry audit.Entry
+		Expect(json.Unmarshal(scanner.Bytes(), &entry)).To(Succeed())
+		entries = append(entries, entry)
+	}
+	Expect(scanner.Err()).NotTo(HaveOccurred())
+	return entries
+}
+
+var _ = Describe("Log", func() {
+	var path string
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "audit", "audit.log")
+	})
+
+	It("should record mutating requests with their outcome", func() {
+		log, err := audit.Open(audit.Options{Path: path})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(log.Close)
+
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.UnixAddr{Name: "@client", Net: "unix"}})
+
+		By("creating a machine")
+		_, err = log.UnaryServerInterceptor(ctx, &iri.CreateMachineRequest{}, &grpc.UnaryServerInfo{FullMethod: "/machine.v1alpha1.MachineRuntime/CreateMachine"},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return &iri.CreateMachineResponse{Machine: &iri.Machine{Metadata: &irimeta.ObjectMetadata{Id: "machine-a"}}}, nil
+			})
+		Expect(err).NotTo(HaveOccurred())
+
+		By("listing machines")
+		_, err = log.UnaryServerInterceptor(ctx, &iri.ListMachinesRequest{}, &grpc.UnaryServerInfo{FullMethod: "/machine.v1alpha1.MachineRuntime/ListMachines"},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return &iri.ListMachinesResponse{}, nil
+			})
+		Expect(err).NotTo(HaveOccurred())
+
+		By("deleting an unknown machine")
+		_, err = log.UnaryServerInterceptor(ctx, &iri.DeleteMachineRequest{MachineId: "machine-b"}, &grpc.UnaryServerInfo{FullMethod: "/machine.v1alpha1.MachineRuntime/DeleteMachine"},
+			func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, status.Error(codes.NotFound, "machine machine-b not found")
+			})
+		Expect(status.Code(err)).To(Equal(codes.NotFound))
+
+		Expect(readEntries(path)).To(ConsistOf(
+			SatisfyAll(
+				HaveField("Method", "/machine.v1alpha1.MachineRuntime/CreateMachine"),
+				HaveField("Caller", "unix:@client"),
+				HaveField("MachineID", "machine-a"),
+				HaveField("RequestDigest", HavePrefix("sha256:")),
+				HaveField("Code", codes.OK.String()),
+				HaveField("Error", BeEmpty()),
+			),
+			SatisfyAll(
+				HaveField("Method", "/machine.v1alpha1.MachineRuntime/DeleteMachine"),
+				HaveField("MachineID", "machine-b"),
+				HaveField("Code", codes.NotFound.String()),
+				HaveField("Error", "machine machine-b not found"),
+			),
+		))
+	})
+
+	It("should rotate the audit log and remove backups beyond the retention", func() {
+		log, err := audit.Open(audit.Options{Path: path, MaxSize: 1, MaxBackups: 2})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(log.Close)
+
+		for _, machineID := range []string{"machine-a", "machine-b", "machine-c", "machine-d"} {
+			Expect(log.Record(audit.Entry{Method: "DeleteMachine", MachineID: machineID})).To(Succeed())
+		}
+
+		Expect(readEntries(path)).To(ConsistOf(HaveField("MachineID", "machine-d")))
+		backups, err := filepath.Glob(path + ".*")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(backups).To(HaveLen(2))
+	})
+
+	It("should keep recording to the audit log if rotating it fails", func() {
+		log, err := audit.Open(audit.Options{Path: path, MaxSize: 1})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(log.Close)
+		Expect(log.Record(audit.Entry{Method: "DeleteMachine", MachineID: "machine-a"})).To(Succeed())
+
+		By("failing to rename the audit log")
+		restore := audit.SetRename(func(string, string) error { return os.ErrPermission })
+		Expect(log.Record(audit.Entry{Method: "DeleteMachine", MachineID: "machine-b"})).To(MatchError(os.ErrPermission))
+		Expect(log.Record(audit.Entry{Method: "DeleteMachine", MachineID: "machine-c"})).To(MatchError(os.ErrPermission))
+		Expect(readEntries(path)).To(HaveExactElements(
+			HaveField("MachineID", "machine-a"),
+			HaveField("MachineID", "machine-b"),
+			HaveField("MachineID", "machine-c"),
+		))
+
+		By("rotating the audit log again")
+		restore()
+		Expect(log.Record(audit.Entry{Method: "DeleteMachine", MachineID: "machine-d"})).To(Succeed())
+		Expect(readEntries(path)).To(ConsistOf(HaveField("MachineID", "machine-d")))
+		backups, err := filepath.Glob(path + ".*")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(backups).To(HaveLen(1))
+		Expect(readEntries(backups[0])).To(HaveExactElements(
+			HaveField("MachineID", "machine-a"),
+			HaveField("MachineID", "machine-b"),
+			HaveField("MachineID", "machine-c"),
+		))
+	})
+})
@@ -0,0 +1,10 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package audit
+
+// SetRename replaces renaming files and returns a func restoring it.
+func SetRename(f func(oldpath, newpath string) error) (restore func()) {
+	rename, f = f, rename
+	return func() { rename = f }
+}
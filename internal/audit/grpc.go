@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/internal/correlation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// readOnlyMethods are the methods not recorded besides the List ones.
+var readOnlyMethods = map[string]struct{}{
+	"Version": {},
+	"Status":  {},
+}
+
+// isMutating reports whether the gRPC method mutates state. Exec is considered mutating as it grants
+// access to the console of a machine.
+func isMutating(fullMethod string) bool {
+	method := path.Base(fullMethod)
+	if strings.HasPrefix(method, "List") {
+		return false
+	}
+	_, ok := readOnlyMethods[method]
+	return !ok
+}
+
+// UnaryServerInterceptor records every mutating request along with its outcome. Failing to record a
+// request doesn't fail it, as the mutation already happened, but is logged.
+func (l *Log) UnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if !isMutating(info.FullMethod) {
+		return handler(ctx, req)
+	}
+
+	start := time.Now()
+	resp, err := handler(ctx, req)
+
+	entry := Entry{
+		Time:          start.UTC(),
+		Method:        info.FullMethod,
+		Caller:        callerFrom(ctx),
+		RequestID:     correlation.IDFrom(ctx),
+		MachineID:     correlation.MachineIDFrom(req, resp),
+		RequestDigest: digest(req),
+		Code:          status.Code(err).String(),
+	}
+	if err != nil {
+		entry.Error = status.Convert(err).Message()
+	}
+	if recordErr := l.Record(entry); recordErr != nil {
+		logr.FromContextOrDiscard(ctx).Error(recordErr, "Failed to record request in audit log")
+	}
+	return resp, err
+}
+
+// callerFrom identifies the caller by the subject of its verified TLS client certificate or, if there is
+// none, by its address.
+func callerFrom(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "unknown"
+	}
+
+	if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+		for _, chain := range tlsInfo.State.VerifiedChains {
+			if len(chain) > 0 {
+				return chain[0].Subject.String()
+			}
+		}
+	}
+	if p.Addr == nil {
+		return "unknown"
+	}
+	if addr := p.Addr.String(); addr != "" {
+		return p.Addr.Network() + ":" + addr
+	}
+	return p.Addr.Network()
+}
+
+func digest(req interface{}) string {
+	// Struct fields are marshalled in order and map keys sorted, so equal requests have equal digests.
+	data, err := json.Marshal(req)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package authz
+
+import (
+	"context"
+	"path"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Mode selects a built-in Authorizer.
+type Mode string
+
+const (
+	// ModeAllowAll allows every request, see AllowAll.
+	ModeAllowAll Mode = "allow-all"
+	// ModeStaticToken allows requests carrying a token of a token file, see LoadStaticTokenFile.
+	ModeStaticToken Mode = "static-token"
+)
+
+func Modes() []Mode {
+	return []Mode{ModeAllowAll, ModeStaticToken}
+}
+
+// Attributes describe a request to authorize.
+type Attributes struct {
+	// Method is the name of the gRPC method called without service, e.g. CreateMachine.
+	Method string
+	// MachineID is the ID of the machine the request operates on. It is empty for requests not operating on
+	// a single existing machine, like CreateMachine or ListMachines.
+	MachineID string
+	// Peer is the peer the request was received from, identifying the caller by its address or credentials.
+	Peer *peer.Peer
+	// Metadata is the incoming metadata of the request, carrying e.g. tokens.
+	Metadata metadata.MD
+}
+
+// Authorizer decides whether a request is allowed.
+type Authorizer interface {
+	// Authorize returns nil if the request described by attrs is allowed. Denied requests should be reported
+	// by Unauthenticated or PermissionDenied status errors, other errors are turned into PermissionDenied ones.
+	Authorize(ctx context.Context, attrs Attributes) error
+}
+
+// AuthorizerFunc is a function implementing Authorizer.
+type AuthorizerFunc func(ctx context.Context, attrs Attributes) error
+
+func (f AuthorizerFunc) Authorize(ctx context.Context, attrs Attributes) error {
+	return f(ctx, attrs)
+}
+
+// AllowAll allows every request.
+var AllowAll Authorizer = AuthorizerFunc(func(context.Context, Attributes) error { return nil })
+
+// UnaryServerInterceptor authorizes every request by authorizer before handling it.
+func UnaryServerInterceptor(authorizer Authorizer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		attrs := Attributes{
+			Method: path.Base(info.FullMethod),
+		}
+		if r, ok := req.(interface{ GetMachineId() string }); ok {
+			attrs.MachineID = r.GetMachineId()
+		}
+		attrs.Peer, _ = peer.FromContext(ctx)
+		attrs.Metadata, _ = metadata.FromIncomingContext(ctx)
+
+		if err := authorizer.Authorize(ctx, attrs); err != nil {
+			if _, ok := status.FromError(err); ok {
+				return nil, err
+			}
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package authz_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	iri "github.com/ironcore-dev/ironcore/iri/apis/machine/v1alpha1"
+	"github.com/ironcore-dev/libvirt-provider/internal/authz"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func call(authorizer authz.Authorizer, token string, method string, req interface{}) error {
+	ctx := context.Background()
+	if token != "" {
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(authz.AuthorizationMetadataKey, "Bearer "+token))
+	}
+	_, err := authz.UnaryServerInterceptor(authorizer)(ctx, req, &grpc.UnaryServerInfo{FullMethod: "/machine.v1alpha1.MachineRuntime/" + method},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, nil
+		})
+	return err
+}
+
+var _ = Describe("UnaryServerInterceptor", func() {
+	It("should pass method and machine to the authorizer", func() {
+		var attrs authz.Attributes
+		authorizer := authz.AuthorizerFunc(func(_ context.Context, a authz.Attributes) error {
+			attrs = a
+			return nil
+		})
+
+		Expect(call(authorizer, "", "DeleteMachine", &iri.DeleteMachineRequest{MachineId: "machine-a"})).To(Succeed())
+		Expect(attrs.Method).To(Equal("DeleteMachine"))
+		Expect(attrs.MachineID).To(Equal("machine-a"))
+	})
+
+	It("should deny requests the authorizer returns an error for", func() {
+		authorizer := authz.AuthorizerFunc(func(_ context.Context, a authz.Attributes) error {
+			if a.MachineID == "machine-b" {
+				return os.ErrPermission
+			}
+			return nil
+		})
+
+		Expect(call(authorizer, "", "DeleteMachine", &iri.DeleteMachineRequest{MachineId: "machine-a"})).To(Succeed())
+		err := call(authorizer, "", "DeleteMachine", &iri.DeleteMachineRequest{MachineId: "machine-b"})
+		Expect(status.Code(err)).To(Equal(codes.PermissionDenied))
+	})
+
+	It("should allow all requests by AllowAll", func() {
+		Expect(call(authz.AllowAll, "", "CreateMachine", &iri.CreateMachineRequest{})).To(Succeed())
+	})
+})
+
+var _ = Describe("StaticToken", func() {
+	It("should only allow requests with a known token", func() {
+		authorizer := authz.NewStaticToken("foo")
+
+		Expect(call(authorizer, "foo", "CreateMachine", &iri.CreateMachineRequest{})).To(Succeed())
+		Expect(status.Code(call(authorizer, "bar", "CreateMachine", &iri.CreateMachineRequest{}))).To(Equal(codes.Unauthenticated))
+		Expect(status.Code(call(authorizer, "", "CreateMachine", &iri.CreateMachineRequest{}))).To(Equal(codes.Unauthenticated))
+	})
+
+	It("should restrict tokens to the methods of the token file", func() {
+		file := filepath.Join(GinkgoT().TempDir(), "tokens")
+		Expect(os.WriteFile(file, []byte("# read only\nreader ListMachines,Status\n\nadmin\n"), 0600)).To(Succeed())
+
+		authorizer, err := authz.LoadStaticTokenFile(file)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(call(authorizer, "reader", "ListMachines", &iri.ListMachinesRequest{})).To(Succeed())
+		Expect(status.Code(call(authorizer, "reader", "DeleteMachine", &iri.DeleteMachineRequest{}))).To(Equal(codes.PermissionDenied))
+		Expect(call(authorizer, "admin", "DeleteMachine", &iri.DeleteMachineRequest{})).To(Succeed())
+	})
+
+	It("should reject token files without tokens", func() {
+		file := filepath.Join(GinkgoT().TempDir(), "tokens")
+		Expect(os.WriteFile(file, []byte("# no tokens\n"), 0600)).To(Succeed())
+
+		_, err := authz.LoadStaticTokenFile(file)
+		Expect(err).To(HaveOccurred())
+	})
+})
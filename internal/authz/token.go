@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package authz
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	// AuthorizationMetadataKey is the metadata key tokens are passed by, as "Bearer <token>".
+	AuthorizationMetadataKey = "authorization"
+
+	bearerPrefix = "Bearer "
+)
+
+// StaticToken allows requests carrying one of a fixed set of bearer tokens, each of which may be restricted
+// to a set of methods.
+type StaticToken struct {
+	tokens []staticToken
+}
+
+type staticToken struct {
+	token []byte
+	// methods are the methods allowed by the token. If nil, all methods are allowed.
+	methods sets.Set[string]
+}
+
+// NewStaticToken creates a StaticToken allowing all methods for every token of tokens.
+func NewStaticToken(tokens ...string) *StaticToken {
+	a := &StaticToken{}
+	for _, token := range tokens {
+		a.tokens = append(a.tokens, staticToken{token: []byte(token)})
+	}
+	return a
+}
+
+// LoadStaticTokenFile creates a StaticToken from the tokens in file. Every line of the file holds a token,
+// optionally followed by a comma separated list of methods it allows, e.g. "s3cr3t ListMachines,Status".
+// Empty lines and lines starting with # are ignored.
+func LoadStaticTokenFile(file string) (*StaticToken, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("error opening token file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	a := &StaticToken{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("invalid token file line %d: expected token and optional methods", line)
+		}
+		token := staticToken{token: []byte(fields[0])}
+		if len(fields) == 2 {
+			token.methods = sets.New(strings.Split(fields[1], ",")...)
+		}
+		a.tokens = append(a.tokens, token)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading token file: %w", err)
+	}
+	if len(a.tokens) == 0 {
+		return nil, fmt.Errorf("token file %s contains no tokens", file)
+	}
+	return a, nil
+}
+
+func (a *StaticToken) Authorize(_ context.Context, attrs Attributes) error {
+	token, ok := bearerToken(attrs)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare(t.token, token) != 1 {
+			continue
+		}
+		if t.methods != nil && !t.methods.Has(attrs.Method) {
+			return status.Errorf(codes.PermissionDenied, "token is not allowed to call %s", attrs.Method)
+		}
+		return nil
+	}
+	return status.Error(codes.Unauthenticated, "invalid bearer token")
+}
+
+func bearerToken(attrs Attributes) ([]byte, bool) {
+	for _, value := range attrs.Metadata.Get(AuthorizationMetadataKey) {
+		if token, ok := strings.CutPrefix(value, bearerPrefix); ok && token != "" {
+			return []byte(token), true
+		}
+	}
+	return nil, false
+}
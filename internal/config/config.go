@@ -0,0 +1,182 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const (
+	// APIVersion is the version of the configuration file format.
+	APIVersion = "config.libvirt-provider.ironcore.dev/v1alpha1"
+	// Kind is the kind of the configuration file.
+	Kind = "ProviderConfiguration"
+)
+
+// Configuration is the content of a configuration file. Its options are keyed by flag name, e.g.
+//
+//	apiVersion: config.libvirt-provider.ironcore.dev/v1alpha1
+//	kind: ProviderConfiguration
+//	options:
+//	  root-dir: /var/lib/libvirt-provider
+//	  gc-resync-interval: 2m
+//	  pci-devices: [0000:3b:00.0, 0000:3b:00.1]
+//	  topology-labels: {rack: r1}
+//
+// Lists are set element by element, maps as comma separated key=value pairs.
+type Configuration struct {
+	APIVersion string                     `json:"apiVersion"`
+	Kind       string                     `json:"kind"`
+	Options    map[string]json.RawMessage `json:"options,omitempty"`
+}
+
+func Load(reader io.Reader) (*Configuration, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read configuration: %w", err)
+	}
+
+	var cfg Configuration
+	if err := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096).Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal configuration: %w", err)
+	}
+	if cfg.APIVersion != APIVersion || cfg.Kind != Kind {
+		return nil, fmt.Errorf("unsupported configuration %s %s, expected %s %s", cfg.APIVersion, cfg.Kind, APIVersion, Kind)
+	}
+	return &cfg, nil
+}
+
+func LoadFile(filename string) (*Configuration, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open configuration file (%s): %w", filename, err)
+	}
+	defer func() { _ = file.Close() }()
+
+	return Load(file)
+}
+
+// Values returns the values of the option for pflag.Value.Set, one per list element.
+func (c *Configuration) Values(name string) ([]string, bool, error) {
+	raw, ok := c.Options[name]
+	if !ok {
+		return nil, false, nil
+	}
+
+	var value any
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, false, fmt.Errorf("invalid value of option %s: %w", name, err)
+	}
+
+	switch value := value.(type) {
+	case nil:
+		return nil, false, nil
+	case []any:
+		values := make([]string, 0, len(value))
+		for _, elem := range value {
+			values = append(values, fmt.Sprint(elem))
+		}
+		return values, true, nil
+	case map[string]any:
+		pairs := make([]string, 0, len(value))
+		for _, key := range slices.Sorted(maps.Keys(value)) {
+			pairs = append(pairs, fmt.Sprintf("%s=%v", key, value[key]))
+		}
+		return []string{strings.Join(pairs, ",")}, true, nil
+	case float64:
+		// Take numbers as written, fmt formats large ones with exponent, e.g. 1e+06.
+		return []string{string(bytes.TrimSpace(raw))}, true, nil
+	default:
+		return []string{fmt.Sprint(value)}, true, nil
+	}
+}
+
+// ExplicitFlags returns the names of the flags set on the command line, which take precedence over the file.
+func ExplicitFlags(fs *pflag.FlagSet) sets.Set[string] {
+	explicit := sets.New[string]()
+	fs.Visit(func(flag *pflag.Flag) {
+		explicit.Insert(flag.Name)
+	})
+	return explicit
+}
+
+// Apply sets the flags to the options of the configuration, except the explicit ones. Options without flag
+// are rejected.
+func (c *Configuration) Apply(fs *pflag.FlagSet, explicit sets.Set[string]) error {
+	for _, name := range slices.Sorted(maps.Keys(c.Options)) {
+		if fs.Lookup(name) == nil {
+			return fmt.Errorf("unknown option %s", name)
+		}
+		if explicit.Has(name) {
+			continue
+		}
+
+		values, ok, err := c.Values(name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		for _, value := range values {
+			if err := fs.Set(name, value); err != nil {
+				return fmt.Errorf("invalid value of option %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Effective returns the current values of all flags in the form of a Configuration, e.g. to show the
+// effective configuration. Passwords of URLs are redacted.
+func Effective(fs *pflag.FlagSet) *Configuration {
+	cfg := &Configuration{
+		APIVersion: APIVersion,
+		Kind:       Kind,
+		Options:    make(map[string]json.RawMessage),
+	}
+	fs.VisitAll(func(flag *pflag.Flag) {
+		var value any
+		if slice, ok := flag.Value.(pflag.SliceValue); ok {
+			values := slice.GetSlice()
+			for i := range values {
+				values[i] = redact(values[i])
+			}
+			value = values
+		} else {
+			value = redact(flag.Value.String())
+		}
+
+		data, err := json.Marshal(value)
+		if err != nil {
+			return
+		}
+		cfg.Options[flag.Name] = data
+	})
+	return cfg
+}
+
+// redact removes the password from URL values.
+func redact(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	if _, ok := u.User.Password(); !ok {
+		return value
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,218 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-logr/logr"
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// reloadDebounce collapses the bursts of file events written by editors and configmap updates into one reload.
+const reloadDebounce = time.Second
+
+// Reloader reloads the reloadable settings from the configuration file on SIGHUP and on changes of the
+// watched files. Settings are flags, which are set to the value of the file or, if the file doesn't set
+// them anymore, back to their default, if they have one. Flags set on the command line are never reloaded.
+type Reloader struct {
+	log      logr.Logger
+	fs       *pflag.FlagSet
+	file     string
+	explicit sets.Set[string]
+
+	mu       sync.Mutex
+	settings map[string]func(value pflag.Value) error
+	hooks    []func() error
+	watched  []string
+}
+
+// NewReloader creates a Reloader of the flags of fs from file, which may be empty if there is no
+// configuration file. The explicit flags are the ones set on the command line.
+func NewReloader(log logr.Logger, fs *pflag.FlagSet, file string, explicit sets.Set[string]) *Reloader {
+	r := &Reloader{
+		log:      log,
+		fs:       fs,
+		file:     file,
+		explicit: explicit,
+		settings: make(map[string]func(value pflag.Value) error),
+	}
+	if file != "" {
+		r.watched = append(r.watched, file)
+	}
+	return r
+}
+
+// Setting makes the scalar flag reloadable. apply is called with the flag value once it changed.
+func (r *Reloader) Setting(name string, apply func(value pflag.Value) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.settings[name] = apply
+}
+
+// Hook adds a function called on every reload, e.g. to reload another file. Changes of file trigger a reload
+// unless it is empty.
+func (r *Reloader) Hook(file string, fn func() error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks = append(r.hooks, fn)
+	if file != "" {
+		r.watched = append(r.watched, file)
+	}
+}
+
+// Reload reloads the settings and runs the hooks. A setting with an invalid value is kept as it is.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg := &Configuration{}
+	if r.file != "" {
+		var err error
+		if cfg, err = LoadFile(r.file); err != nil {
+			return err
+		}
+	}
+
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(r.settings)) {
+		if r.explicit.Has(name) {
+			continue
+		}
+		if err := r.reloadSetting(cfg, name); err != nil {
+			errs = append(errs, fmt.Errorf("error reloading %s: %w", name, err))
+		}
+	}
+	for _, hook := range r.hooks {
+		if err := hook(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Reloader) reloadSetting(cfg *Configuration, name string) error {
+	flag := r.fs.Lookup(name)
+	if flag == nil {
+		return fmt.Errorf("unknown flag")
+	}
+
+	values, ok, err := cfg.Values(name)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if flag.DefValue == "" {
+			// Settings without default, e.g. zap-log-level, keep their value.
+			return nil
+		}
+		values = []string{flag.DefValue}
+	}
+
+	old := flag.Value.String()
+	for _, value := range values {
+		if err := flag.Value.Set(value); err != nil {
+			_ = flag.Value.Set(old)
+			return err
+		}
+	}
+	if flag.Value.String() == old {
+		return nil
+	}
+
+	r.log.Info("Reloading setting", "Setting", name, "Old", redact(old), "New", redact(flag.Value.String()))
+	if err := r.settings[name](flag.Value); err != nil {
+		_ = flag.Value.Set(old)
+		return err
+	}
+	return nil
+}
+
+// Start reloads on SIGHUP and on changes of the configuration file and the files of the hooks until ctx is done.
+func (r *Reloader) Start(ctx context.Context) error {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("error creating file watcher: %w", err)
+	}
+	defer func() { _ = watcher.Close() }()
+
+	r.mu.Lock()
+	watched := sets.New[string]()
+	for _, file := range r.watched {
+		watched.Insert(filepath.Clean(file))
+	}
+	r.mu.Unlock()
+	// Watch the directories, as files replaced by editors or configmap updates lose their watches.
+	dirs := sets.New[string]()
+	for file := range watched {
+		dirs.Insert(filepath.Dir(file))
+	}
+	for _, dir := range sets.List(dirs) {
+		if err := watcher.Add(dir); err != nil {
+			return fmt.Errorf("error watching %s: %w", dir, err)
+		}
+	}
+
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-sighup:
+			r.log.Info("Received SIGHUP, reloading configuration")
+			r.reload()
+		case evt := <-watcher.Events:
+			// Configmap volumes swap the ..data symlink instead of writing the files.
+			if watched.Has(filepath.Clean(evt.Name)) || filepath.Base(evt.Name) == "..data" {
+				debounce = time.After(reloadDebounce)
+			}
+		case err := <-watcher.Errors:
+			r.log.Error(err, "File watcher failed")
+		case <-debounce:
+			debounce = nil
+			r.log.Info("Configuration changed, reloading")
+			r.reload()
+		}
+	}
+}
+
+func (r *Reloader) reload() {
+	if err := r.Reload(); err != nil {
+		r.log.Error(err, "Failed to reload configuration")
+	}
+}
+
+// ServeHTTP responds with the effective configuration.
+func (r *Reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.mu.Lock()
+	cfg := Effective(r.fs)
+	r.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(cfg)
+}
@@ -17,6 +17,8 @@ var log = ctrl.Log.WithName("http")
 
 type HandlerOptions struct {
 	Log logr.Logger
+	// Attestation exports the measurements of machines at /attestation. If nil, they are not exported.
+	Attestation http.Handler
 }
 
 func setHandlerOptionsDefaults(opts *HandlerOptions) {
@@ -39,6 +41,12 @@ func NewHandler(srv *server.Server, opts HandlerOptions) http.Handler {
 			srv.ServeExec(w, req, token)
 		})
 	}
+	r.Get("/profiles/{token}", func(w http.ResponseWriter, req *http.Request) {
+		srv.ServeProfile(w, req, chi.URLParam(req, "token"))
+	})
+	if opts.Attestation != nil {
+		r.Mount("/attestation", opts.Attestation)
+	}
 
 	return r
 }
@@ -0,0 +1,163 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTTL is the default time a token can be used for.
+	DefaultTTL = 1 * time.Minute
+	// MinKeyLength is the minimum length of signing keys in bytes.
+	MinKeyLength = 32
+
+	idLength = 16
+)
+
+var (
+	// ErrInvalid is returned for malformed tokens and tokens with an invalid signature.
+	ErrInvalid = errors.New("invalid token")
+	// ErrExpired is returned for expired tokens.
+	ErrExpired = errors.New("token expired")
+	// ErrAudience is returned for tokens minted for another audience.
+	ErrAudience = errors.New("token audience mismatch")
+	// ErrConsumed is returned for tokens that were accepted already.
+	ErrConsumed = errors.New("token consumed")
+)
+
+// Claims are the claims of a token.
+type Claims struct {
+	// Audience is the url the token may be used for.
+	Audience string `json:"aud"`
+	// Subject is what the token grants access to, e.g. the ID of a machine.
+	Subject string `json:"sub"`
+	// ID identifies the token, so it is accepted once.
+	ID string `json:"jti"`
+	// ExpiresAt is the unix time the token expires at.
+	ExpiresAt int64 `json:"exp"`
+}
+
+// Signer mints the tokens of the urls of the streaming server and verifies them. Tokens are signed with
+// HMAC-SHA256, so they can't be forged without the key, and hold their audience and subject, so a token minted
+// for one url or machine is rejected for another one. Every token is accepted once before it expires.
+type Signer struct {
+	key []byte
+	ttl time.Duration
+
+	mu sync.Mutex
+	// consumed are the expirations of the tokens accepted already by their ID.
+	consumed map[string]time.Time
+}
+
+// NewSigner creates a Signer of tokens expiring after ttl. If key is empty, a random key is generated, so the
+// tokens are only accepted by this Signer.
+func NewSigner(key []byte, ttl time.Duration) (*Signer, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("token ttl must be positive")
+	}
+	if len(key) == 0 {
+		key = make([]byte, MinKeyLength)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("error generating key: %w", err)
+		}
+	}
+	if len(key) < MinKeyLength {
+		return nil, fmt.Errorf("key must have at least %d bytes, got %d", MinKeyLength, len(key))
+	}
+
+	return &Signer{
+		key:      key,
+		ttl:      ttl,
+		consumed: make(map[string]time.Time),
+	}, nil
+}
+
+// LoadKeyFile reads the signing key from file, ignoring surrounding whitespace.
+func LoadKeyFile(file string) ([]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading key file: %w", err)
+	}
+	return []byte(strings.TrimSpace(string(data))), nil
+}
+
+func (s *Signer) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Mint mints a token for the subject, to be used for the audience.
+func (s *Signer) Mint(audience, subject string) (string, error) {
+	id := make([]byte, idLength)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("error generating token id: %w", err)
+	}
+
+	data, err := json.Marshal(Claims{
+		Audience:  audience,
+		Subject:   subject,
+		ID:        base64.RawURLEncoding.EncodeToString(id),
+		ExpiresAt: time.Now().Add(s.ttl).Unix(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error marshalling claims: %w", err)
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + s.sign(payload), nil
+}
+
+// Consume verifies the token was minted by the Signer for the audience and returns its claims. It fails if
+// the token expired or was consumed already.
+func (s *Signer) Consume(token, audience string) (Claims, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(s.sign(payload))) {
+		return Claims{}, ErrInvalid
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return Claims{}, ErrInvalid
+	}
+	var claims Claims
+	if err := json.Unmarshal(data, &claims); err != nil || claims.ID == "" {
+		return Claims{}, ErrInvalid
+	}
+
+	if claims.Audience != audience {
+		return Claims{}, fmt.Errorf("%w: minted for %s", ErrAudience, claims.Audience)
+	}
+
+	now := time.Now()
+	expiresAt := time.Unix(claims.ExpiresAt, 0)
+	if !now.Before(expiresAt) {
+		return Claims{}, ErrExpired
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, expiration := range s.consumed {
+		if !now.Before(expiration) {
+			delete(s.consumed, id)
+		}
+	}
+	if _, ok := s.consumed[claims.ID]; ok {
+		return Claims{}, ErrConsumed
+	}
+	s.consumed[claims.ID] = expiresAt
+	return claims, nil
+}
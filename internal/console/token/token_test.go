@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package token_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ironcore-dev/libvirt-provider/internal/console/token"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const audience = "http://localhost:20251/exec"
+
+var _ = Describe("Signer", func() {
+	var signer *token.Signer
+
+	BeforeEach(func() {
+		var err error
+		signer, err = token.NewSigner(nil, token.DefaultTTL)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should accept a minted token once", func() {
+		t, err := signer.Mint(audience, "machine-1")
+		Expect(err).NotTo(HaveOccurred())
+
+		claims, err := signer.Consume(t, audience)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(claims.Subject).To(Equal("machine-1"))
+		Expect(claims.Audience).To(Equal(audience))
+
+		_, err = signer.Consume(t, audience)
+		Expect(err).To(MatchError(token.ErrConsumed))
+	})
+
+	It("should reject tokens of another audience", func() {
+		t, err := signer.Mint(audience, "machine-1")
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = signer.Consume(t, "http://other:20251/exec")
+		Expect(err).To(MatchError(token.ErrAudience))
+	})
+
+	It("should reject forged and malformed tokens", func() {
+		t, err := signer.Mint(audience, "machine-1")
+		Expect(err).NotTo(HaveOccurred())
+		payload, signature, _ := strings.Cut(t, ".")
+
+		By("changing the signature")
+		_, err = signer.Consume(payload+"."+strings.ToUpper(signature), audience)
+		Expect(err).To(MatchError(token.ErrInvalid))
+
+		By("signing with another key")
+		other, err := token.NewSigner(nil, token.DefaultTTL)
+		Expect(err).NotTo(HaveOccurred())
+		t, err = other.Mint(audience, "machine-1")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = signer.Consume(t, audience)
+		Expect(err).To(MatchError(token.ErrInvalid))
+
+		By("passing garbage")
+		_, err = signer.Consume("foo", audience)
+		Expect(err).To(MatchError(token.ErrInvalid))
+	})
+
+	It("should reject expired tokens", func() {
+		signer, err := token.NewSigner(nil, time.Second)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func() error {
+			t, err := signer.Mint(audience, "machine-1")
+			Expect(err).NotTo(HaveOccurred())
+			time.Sleep(time.Second)
+			_, err = signer.Consume(t, audience)
+			return err
+		}).Should(MatchError(token.ErrExpired))
+	})
+
+	It("should share tokens between signers with the same key", func() {
+		keyFile := filepath.Join(GinkgoT().TempDir(), "key")
+		Expect(os.WriteFile(keyFile, []byte(strings.Repeat("k", token.MinKeyLength)+"\n"), 0600)).To(Succeed())
+		key, err := token.LoadKeyFile(keyFile)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(key).To(HaveLen(token.MinKeyLength))
+
+		first, err := token.NewSigner(key, token.DefaultTTL)
+		Expect(err).NotTo(HaveOccurred())
+		second, err := token.NewSigner(key, token.DefaultTTL)
+		Expect(err).NotTo(HaveOccurred())
+
+		t, err := first.Mint(audience, "machine-1")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = second.Consume(t, audience)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should reject short keys", func() {
+		_, err := token.NewSigner([]byte("short"), token.DefaultTTL)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -5,33 +5,42 @@ package controllers
 
 import (
 	"context"
-	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"slices"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/digitalocean/go-libvirt"
 	"github.com/go-logr/logr"
 	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/correlation"
 	"github.com/ironcore-dev/libvirt-provider/internal/event"
 	machineEvent "github.com/ironcore-dev/libvirt-provider/internal/event/machineevent"
 	providerhost "github.com/ironcore-dev/libvirt-provider/internal/host"
+	"github.com/ironcore-dev/libvirt-provider/internal/hugepages"
+	"github.com/ironcore-dev/libvirt-provider/internal/inflight"
 	"github.com/ironcore-dev/libvirt-provider/internal/libvirt/guest"
-	libvirtmeta "github.com/ironcore-dev/libvirt-provider/internal/libvirt/meta"
+	providersecret "github.com/ironcore-dev/libvirt-provider/internal/libvirt/secret"
 	libvirtutils "github.com/ironcore-dev/libvirt-provider/internal/libvirt/utils"
+	"github.com/ironcore-dev/libvirt-provider/internal/mdev"
 	providerimage "github.com/ironcore-dev/libvirt-provider/internal/oci"
-	"github.com/ironcore-dev/libvirt-provider/internal/osutils"
+	"github.com/ironcore-dev/libvirt-provider/internal/plugins/domainhook"
 	providernetworkinterface "github.com/ironcore-dev/libvirt-provider/internal/plugins/networkinterface"
 	providervolume "github.com/ironcore-dev/libvirt-provider/internal/plugins/volume"
+	"github.com/ironcore-dev/libvirt-provider/internal/qcow2"
 	"github.com/ironcore-dev/libvirt-provider/internal/raw"
 	"github.com/ironcore-dev/libvirt-provider/internal/store"
+	utilssync "github.com/ironcore-dev/libvirt-provider/internal/sync"
+	"github.com/ironcore-dev/libvirt-provider/internal/usb"
 	"github.com/ironcore-dev/libvirt-provider/internal/utils"
+	"go.opentelemetry.io/otel/trace"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/util/workqueue"
 	"k8s.io/utils/ptr"
@@ -46,6 +55,21 @@ const (
 	networkInterfaceAliasPrefix     = "ua-networkinterface-"
 )
 
+// Finalizers of the resources of a machine. Each is removed once its resource is torn down, so a failed teardown
+// of one resource is retried on its own, neither blocking nor repeating the teardown of the others.
+const (
+	DomainFinalizer            = "domain"
+	PCIDevicesFinalizer        = "pci-devices"
+	MdevDevicesFinalizer       = "mdev-devices"
+	USBDevicesFinalizer        = "usb-devices"
+	VolumesFinalizer           = "volumes"
+	NetworkInterfacesFinalizer = "network-interfaces"
+)
+
+// resourceFinalizers are the finalizers of the resources of a machine. The domain is torn down first, as the
+// other resources are in use until it is gone.
+var resourceFinalizers = []string{DomainFinalizer, PCIDevicesFinalizer, MdevDevicesFinalizer, USBDevicesFinalizer, VolumesFinalizer, NetworkInterfacesFinalizer}
+
 var (
 	// TODO: improve domainStateToMachineState since some states are mapped to computev1alpha1.MachineStatePending
 	// where it doesn't make that much sense.
@@ -57,6 +81,7 @@ var (
 		libvirt.DomainShutdown: api.MachineStateTerminating,
 		// it isn't probably supported by transient domain
 		libvirt.DomainShutoff:     api.MachineStateTerminated,
+		libvirt.DomainCrashed:     api.MachineStateTerminated,
 		libvirt.DomainPmsuspended: api.MachineStatePending,
 	}
 )
@@ -71,15 +96,96 @@ type MachineReconcilerOptions struct {
 	NetworkInterfacePlugin         providernetworkinterface.Plugin
 	VolumeEvents                   event.Source[*api.Machine]
 	ResyncIntervalVolumeSize       time.Duration
+	GuestAgentProbeInterval        time.Duration
 	ResyncIntervalGarbageCollector time.Duration
 	EnableHugepages                bool
 	GCVMGracefulShutdownTimeout    time.Duration
 	VolumeCachePolicy              string
+	NoOnlineResizeCachePolicies    []string
+	DomainAutostart                DomainAutostartPolicy
+	// Hugepages are the NUMA nodes of the host machines are bound to, see api.MachineSpec.NUMANode. May be nil.
+	Hugepages *hugepages.Source
+	// MdevDevices creates and removes the mediated devices of machines, see api.MachineSpec.MdevDevices. May be nil.
+	MdevDevices *mdev.Source
+	// USBDevices resolves the addresses of the usb devices of machines, see api.MachineSpec.USBDevices. May be nil.
+	USBDevices *usb.Source
+	// Operations tracks root fs creations and volume applies for a graceful shutdown. May be nil.
+	Operations *inflight.Tracker
+	// CPUQuotaCapping caps the CPU time of domains to the nominal CpuMillis of their machines,
+	// also if the host is idle.
+	CPUQuotaCapping bool
+	// CPUQuotaPeriod is the enforcement period of the CPU quota. Defaults to DefaultCPUQuotaPeriod.
+	CPUQuotaPeriod time.Duration
+	// CheckQcow2Disks checks, and repairs leaked clusters of, the local qcow2 disks of every machine once
+	// before its domain is started. Requires QCow2. Meant to be enabled after an unclean shutdown.
+	CheckQcow2Disks bool
+	QCow2           qcow2.QCow2
+	// RootDiskMode determines how root disks are created from images. Defaults to RootDiskModeCopy.
+	// RootDiskModeOverlay requires QCow2.
+	RootDiskMode RootDiskMode
+	// MaxConcurrentRootFSConversions is the number of images converted to qcow2 bases at once in the background.
+	// Defaults to qcow2.DefaultMaxConcurrentConversions.
+	MaxConcurrentRootFSConversions int
+	// WarmImages are pulled, and in root disk mode overlay converted to qcow2 bases, ahead of the machines
+	// using them. Their bases are kept by the garbage collector.
+	WarmImages []string
+
+	// DiskBus configures the bus of disks. The bus defaults to DiskBusVirtio.
+	DiskBus DiskBusOptions
+	// IOThreads configures the iothreads of machines.
+	IOThreads IOThreadOptions
+	// NetworkInterfaces configures the virtio-net devices of network interfaces. If zero, network interfaces keep
+	// the defaults of libvirt.
+	NetworkInterfaces NetworkInterfaceOptions
+	// FeatureProfiles are the domain features of machine classes. May be nil.
+	FeatureProfiles *guest.FeatureProfiles
+	// DomainHooks mutate the domains of machines, in order, before they are created.
+	DomainHooks []domainhook.Hook
+	// OrphanedDomains configures the audit of domains without machine. The policy defaults to
+	// OrphanedDomainPolicyReport.
+	OrphanedDomains OrphanedDomainOptions
+	// Hotplug configures the headroom of domains for hot plugging vCPUs and memory.
+	Hotplug HotplugOptions
+	// MaxRestarts caps the consecutive restarts of guests that stopped unexpectedly. If zero, it is unlimited.
+	MaxRestarts int32
+	// PanicDevice adds a pvpanic device to domains, so guest kernel panics crash them instead of going unnoticed.
+	PanicDevice bool
+	// CrashRestartPolicy determines whether crashed machines are restarted. Defaults to CrashRestartPolicyAlways.
+	CrashRestartPolicy CrashRestartPolicy
+	// StopTimeout is the time guests get to shut down gracefully on power off, unless their machine requests
+	// another one. Defaults to DefaultStopTimeout.
+	StopTimeout time.Duration
+	// IPXEBinary is the EFI binary of iPXE machines run their api.MachineSpec.IPXEScript with. If empty, scripts
+	// are ignored.
+	IPXEBinary string
+	// Workers is the number of machines reconciled concurrently. Defaults to DefaultWorkers.
+	Workers int
+	// Backoff configures the retries of failed reconciliations.
+	Backoff BackoffOptions
+}
+
+// DefaultWorkers is the default number of machines reconciled concurrently.
+const DefaultWorkers = 15
+
+const (
+	// DefaultCPUQuotaPeriod is the default enforcement period of CPU quotas.
+	DefaultCPUQuotaPeriod = 100 * time.Millisecond
+
+	minCPUQuotaPeriod = time.Millisecond
+	maxCPUQuotaPeriod = time.Second
+	// minCPUQuota is the smallest quota in microseconds the kernel accepts.
+	minCPUQuota = 1000
+)
+
+// cpuQuota returns the quota in microseconds per period for the given cpu millis. Quotas below the minimum
+// of the kernel are raised to it, so small machines with a short period are still capped.
+func cpuQuota(cpuMillis int64, period time.Duration) int64 {
+	return max(minCPUQuota, cpuMillis*period.Microseconds()/1000)
 }
 
 func NewMachineReconciler(
 	log logr.Logger,
-	libvirt *libvirt.Libvirt,
+	libvirt libvirtutils.Client,
 	machines store.Store[*api.Machine],
 	machineEvents event.Source[*api.Machine],
 	eventRecorder machineEvent.EventRecorder,
@@ -97,14 +203,98 @@ func NewMachineReconciler(
 		return nil, fmt.Errorf("must specify machine events")
 	}
 
+	if opts.CheckQcow2Disks && opts.QCow2 == nil {
+		return nil, fmt.Errorf("must specify qcow2 to check qcow2 disks")
+	}
+
+	if opts.RootDiskMode == "" {
+		opts.RootDiskMode = RootDiskModeCopy
+	}
+	if !slices.Contains(RootDiskModes(), opts.RootDiskMode) {
+		return nil, fmt.Errorf("unsupported root disk mode %q", opts.RootDiskMode)
+	}
+	if opts.RootDiskMode == RootDiskModeOverlay && opts.QCow2 == nil {
+		return nil, fmt.Errorf("must specify qcow2 to create root disk overlays")
+	}
+	if opts.MaxConcurrentRootFSConversions < 0 {
+		return nil, fmt.Errorf("max concurrent root fs conversions must not be negative")
+	}
+
+	if opts.DiskBus.Bus == "" {
+		opts.DiskBus.Bus = DiskBusVirtio
+	}
+	if err := opts.DiskBus.validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.IOThreads.validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.NetworkInterfaces.validate(); err != nil {
+		return nil, err
+	}
+	if err := opts.Hotplug.validate(); err != nil {
+		return nil, err
+	}
+	if opts.OrphanedDomains.Policy == "" {
+		opts.OrphanedDomains.Policy = OrphanedDomainPolicyReport
+	}
+	if err := opts.OrphanedDomains.validate(); err != nil {
+		return nil, err
+	}
+	if opts.MaxRestarts < 0 {
+		return nil, fmt.Errorf("max restarts must not be negative")
+	}
+	if opts.CrashRestartPolicy == "" {
+		opts.CrashRestartPolicy = CrashRestartPolicyAlways
+	}
+	if !slices.Contains(CrashRestartPolicies(), opts.CrashRestartPolicy) {
+		return nil, fmt.Errorf("unsupported crash restart policy %q", opts.CrashRestartPolicy)
+	}
+	if opts.StopTimeout == 0 {
+		opts.StopTimeout = DefaultStopTimeout
+	}
+	if opts.StopTimeout < 0 {
+		return nil, fmt.Errorf("stop timeout must not be negative")
+	}
+	if opts.Workers == 0 {
+		opts.Workers = DefaultWorkers
+	}
+	if opts.Workers < 0 {
+		return nil, fmt.Errorf("workers must not be negative")
+	}
+	if opts.Backoff.BaseDelay == 0 {
+		opts.Backoff.BaseDelay = DefaultBackoffBaseDelay
+	}
+	if opts.Backoff.MaxDelay == 0 {
+		opts.Backoff.MaxDelay = DefaultBackoffMaxDelay
+	}
+	if err := opts.Backoff.validate(); err != nil {
+		return nil, err
+	}
+
+	if opts.CPUQuotaPeriod == 0 {
+		opts.CPUQuotaPeriod = DefaultCPUQuotaPeriod
+	}
+	if opts.CPUQuotaPeriod < minCPUQuotaPeriod || opts.CPUQuotaPeriod > maxCPUQuotaPeriod {
+		return nil, fmt.Errorf("cpu quota period has to be between %s and %s", minCPUQuotaPeriod, maxCPUQuotaPeriod)
+	}
+
+	priorities := newPriorityQueue()
 	return &MachineReconciler{
 		log:                            log,
-		queue:                          workqueue.NewTypedRateLimitingQueue[string](workqueue.DefaultTypedControllerRateLimiter[string]()),
+		queue:                          newMachineQueue(priorities, opts.Backoff),
+		priorities:                     priorities,
 		libvirt:                        libvirt,
+		secrets:                        providersecret.NewManager(libvirt),
 		machines:                       machines,
 		machineEvents:                  machineEvents,
 		EventRecorder:                  eventRecorder,
 		guestCapabilities:              opts.GuestCapabilities,
+		featureProfiles:                opts.FeatureProfiles,
+		domainHooks:                    opts.DomainHooks,
+		orphanedDomains:                opts.OrphanedDomains,
+		workers:                        opts.Workers,
+		machineLocks:                   utilssync.NewMutexMap[string](),
 		tcMallocLibPath:                opts.TCMallocLibPath,
 		host:                           opts.Host,
 		imageCache:                     opts.ImageCache,
@@ -112,25 +302,65 @@ func NewMachineReconciler(
 		volumePluginManager:            opts.VolumePluginManager,
 		networkInterfacePlugin:         opts.NetworkInterfacePlugin,
 		resyncIntervalVolumeSize:       opts.ResyncIntervalVolumeSize,
+		guestAgentProbeInterval:        opts.GuestAgentProbeInterval,
 		resyncIntervalGarbageCollector: opts.ResyncIntervalGarbageCollector,
+		gcIntervalChanged:              make(chan struct{}),
 		enableHugepages:                opts.EnableHugepages,
+		hugepages:                      opts.Hugepages,
+		mdevDevices:                    opts.MdevDevices,
+		usbDevices:                     opts.USBDevices,
 		gcVMGracefulShutdownTimeout:    opts.GCVMGracefulShutdownTimeout,
 		volumeCachePolicy:              opts.VolumeCachePolicy,
+		noOnlineResizeCachePolicies:    opts.NoOnlineResizeCachePolicies,
+		domainAutostart:                opts.DomainAutostart,
+		operations:                     opts.Operations,
+		cpuQuotaCapping:                opts.CPUQuotaCapping,
+		cpuQuotaPeriod:                 opts.CPUQuotaPeriod,
+		checkQcow2Disks:                opts.CheckQcow2Disks,
+		qcow2:                          opts.QCow2,
+		checkedQcow2Disks:              sets.New[string](),
+		rootDiskMode:                   opts.RootDiskMode,
+		rootFSConverter:                qcow2.NewConverter(opts.MaxConcurrentRootFSConversions),
+		warmImages:                     opts.WarmImages,
+		warmRootFSBases:                sets.New[string](),
+		diskBus:                        opts.DiskBus,
+		ioThreads:                      opts.IOThreads,
+		networkInterfaces:              opts.NetworkInterfaces,
+		hotplug:                        opts.Hotplug,
+		maxRestarts:                    opts.MaxRestarts,
+		panicDevice:                    opts.PanicDevice,
+		crashRestartPolicy:             opts.CrashRestartPolicy,
+		stopTimeout:                    opts.StopTimeout,
+		ipxeBinary:                     opts.IPXEBinary,
+		guestAgentProbes:               make(map[string]*guestAgentProbe),
+		probingGuestAgents:             sets.New[string](),
 	}, nil
 }
 
 type MachineReconciler struct {
-	log   logr.Logger
-	queue workqueue.TypedRateLimitingInterface[string]
-
-	libvirt           *libvirt.Libvirt
+	log        logr.Logger
+	queue      workqueue.TypedRateLimitingInterface[string]
+	priorities *priorityQueue
+	workers    int
+	// machineLocks serializes the workers and the garbage collector per machine.
+	machineLocks *utilssync.MutexMap[string]
+
+	libvirt           libvirtutils.Client
+	secrets           *providersecret.Manager
 	guestCapabilities guest.Capabilities
+	featureProfiles   *guest.FeatureProfiles
+	domainHooks       []domainhook.Hook
+	orphanedDomains   OrphanedDomainOptions
 	tcMallocLibPath   string
+	ipxeBinary        string
 	host              providerhost.Host
 	imageCache        providerimage.Cache
 	raw               raw.Raw
 
 	enableHugepages bool
+	hugepages       *hugepages.Source
+	mdevDevices     *mdev.Source
+	usbDevices      *usb.Source
 
 	volumePluginManager    *providervolume.PluginManager
 	networkInterfacePlugin providernetworkinterface.Plugin
@@ -140,19 +370,60 @@ type MachineReconciler struct {
 	machineEvent.EventRecorder
 
 	resyncIntervalVolumeSize time.Duration
+	guestAgentProbeInterval  time.Duration
+	// guestAgentProbes holds the last probe of the guest agents of running machines by machine ID. Agents are
+	// probed in the background, as unresponsive agents block each command until it times out.
+	guestAgentProbesMu sync.Mutex
+	guestAgentProbes   map[string]*guestAgentProbe
+	// probingGuestAgents holds the IDs of the machines whose guest agent is being probed.
+	probingGuestAgents sets.Set[string]
 
 	gcVMGracefulShutdownTimeout    time.Duration
 	resyncIntervalGarbageCollector time.Duration
-
-	volumeCachePolicy string
+	// gcIntervalChanged is closed once resyncIntervalGarbageCollector changed.
+	gcIntervalMu      sync.Mutex
+	gcIntervalChanged chan struct{}
+
+	volumeCachePolicy           string
+	noOnlineResizeCachePolicies []string
+	diskBus                     DiskBusOptions
+	ioThreads                   IOThreadOptions
+	networkInterfaces           NetworkInterfaceOptions
+	hotplug                     HotplugOptions
+
+	domainAutostart DomainAutostartPolicy
+
+	maxRestarts        int32
+	panicDevice        bool
+	crashRestartPolicy CrashRestartPolicy
+	stopTimeout        time.Duration
+
+	operations *inflight.Tracker
+
+	cpuQuotaCapping bool
+	cpuQuotaPeriod  time.Duration
+
+	checkQcow2Disks bool
+	qcow2           qcow2.QCow2
+	// checkedQcow2Disks holds the IDs of the machines whose disks have been checked.
+	checkedQcow2DisksMu sync.Mutex
+	checkedQcow2Disks   sets.Set[string]
+
+	rootDiskMode  RootDiskMode
+	rootFSBasesMu sync.Mutex
+	// rootFSConverter converts the root fs of images to qcow2 bases in the background, keyed by base file
+	// and on behalf of machine IDs.
+	rootFSConverter *qcow2.Converter
+
+	warmImages []string
+	// warmRootFSBases holds the names of the root fs bases of warm images.
+	warmRootFSBasesMu sync.Mutex
+	warmRootFSBases   sets.Set[string]
 }
 
 func (r *MachineReconciler) Start(ctx context.Context) error {
 	log := r.log
 
-	//todo make configurable
-	workerSize := 15
-
 	r.imageCache.AddListener(providerimage.ListenerFuncs{
 		HandlePullDoneFunc: func(evt providerimage.PullDoneEvent) {
 			machines, err := r.machines.List(ctx)
@@ -161,18 +432,82 @@ func (r *MachineReconciler) Start(ctx context.Context) error {
 				return
 			}
 
+			for _, machine := range machines {
+				if ptr.Deref(machine.Spec.Image, "") != evt.Ref {
+					continue
+				}
+
+				switch {
+				case errors.Is(evt.Err, providerimage.ErrImagePullUnauthorized):
+					r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, machineEvent.ReasonPullImageUnauthorized, "Not authorized to pull image %s, check the registry credentials: %v", evt.Ref, evt.Err)
+				case errors.Is(evt.Err, providerimage.ErrImageVerificationFailed):
+					r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, machineEvent.ReasonFailedVerifyImage, "Failed to verify the signature of image %s: %v", evt.Ref, evt.Err)
+				case evt.Err != nil:
+					r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, machineEvent.ReasonFailedPullImage, "Failed to pull image %s: %v", evt.Ref, evt.Err)
+				default:
+					r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, machineEvent.ReasonPulledImage, "Pulled image %s", evt.Ref)
+				}
+				log.V(1).Info("Image pull done: Requeue machines", "Image", evt.Ref, "Machine", machine.ID)
+				r.enqueue(machine.ID, queuePriorityUpdate)
+			}
+		},
+		HandlePullProgressFunc: func(evt providerimage.PullProgressEvent) {
+			machines, err := r.machines.List(ctx)
+			if err != nil {
+				log.Error(err, "failed to list machine")
+				return
+			}
+
 			for _, machine := range machines {
 				if ptr.Deref(machine.Spec.Image, "") == evt.Ref {
-					r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, "PulledImage", "Pulled image %s", *machine.Spec.Image)
-					log.V(1).Info("Image pulled: Requeue machines", "Image", evt.Ref, "Machine", machine.ID)
-					r.queue.Add(machine.ID)
+					r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, machineEvent.ReasonPullingImage, "Pulling image %s: %d%% of %d bytes", evt.Ref, evt.Percent, evt.TotalBytes)
+				}
+			}
+		},
+	})
+
+	r.rootFSConverter.AddListener(qcow2.ConverterListenerFuncs{
+		HandleConversionDoneFunc: func(evt qcow2.ConversionDoneEvent) {
+			for _, machineID := range evt.Waiters {
+				if machineID == warmImagesWaiter {
+					continue
+				}
+				machine, err := r.machines.Get(ctx, machineID)
+				if err != nil {
+					log.Error(err, "failed to get machine", "Machine", machineID)
+					continue
+				}
+
+				if evt.Err != nil {
+					r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, machineEvent.ReasonFailedConvertImage, "Failed to convert image to qcow2 base: %v", evt.Err)
+				} else {
+					r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, machineEvent.ReasonConvertedImage, "Converted image to qcow2 base")
+				}
+				log.V(1).Info("Root fs conversion done: Requeue machines", "Base", evt.Key, "Machine", machineID)
+				r.enqueue(machineID, queuePriorityUpdate)
+			}
+		},
+		HandleConversionProgressFunc: func(evt qcow2.ConversionProgressEvent) {
+			// Report every 10% only, qemu-img reports the progress in far smaller steps.
+			if evt.Percent%10 != 0 {
+				return
+			}
+			for _, machineID := range evt.Waiters {
+				if machineID == warmImagesWaiter {
+					continue
+				}
+				machine, err := r.machines.Get(ctx, machineID)
+				if err != nil {
+					log.Error(err, "failed to get machine", "Machine", machineID)
+					continue
 				}
+				r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, machineEvent.ReasonConvertingImage, "Converting image to qcow2 base: %d%%", evt.Percent)
 			}
 		},
 	})
 
 	imgEventReg, err := r.machineEvents.AddHandler(event.HandlerFunc[*api.Machine](func(evt event.Event[*api.Machine]) {
-		r.queue.Add(evt.Object.ID)
+		r.enqueue(evt.Object.ID, eventPriority(evt))
 	}))
 	if err != nil {
 		return err
@@ -196,18 +531,49 @@ func (r *MachineReconciler) Start(ctx context.Context) error {
 		r.startEnqueueMachineByLibvirtEvent(ctx, r.log.WithName("libvirt-event"))
 	}()
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.startEnqueueMachineByDomainEvents(ctx, r.log.WithName("libvirt-domain-event"))
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.startProbeGuestAgents(ctx, r.log.WithName("guest-agent"))
+	}()
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 		r.startGarbageCollector(ctx, r.log.WithName("garbage-collector"))
 	}()
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.startAuditOrphanedDomains(ctx, r.log.WithName("orphaned-domains"))
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.startWarmImages(ctx, r.log.WithName("warm-images"))
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.startResyncUSBDevices(ctx, r.log.WithName("usb-devices"))
+	}()
+
 	go func() {
 		<-ctx.Done()
 		r.queue.ShutDown()
 	}()
 
-	for i := 0; i < workerSize; i++ {
+	maxWorkers.Set(float64(r.workers))
+	for i := 0; i < r.workers; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
@@ -260,7 +626,7 @@ func (r *MachineReconciler) startCheckAndEnqueueVolumeResize(ctx context.Context
 				}
 
 				if lastVolumeSize := getLastVolumeSize(machine, GetUniqueVolumeName(plugin.Name(), volumeID)); volumeSize != lastVolumeSize {
-					r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, "SizeChangedVolume", "Volume size changed %s, lastVolumeSize: %d bytes, volumeSize: %d bytes", volume.Name, lastVolumeSize, volumeSize)
+					r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, machineEvent.ReasonSizeChangedVolume, "Volume size changed %s, lastVolumeSize: %d bytes, volumeSize: %d bytes", volume.Name, lastVolumeSize, volumeSize)
 					log.V(1).Info("Volume size changed", "volumeName", volume.Name, "volumeID", volumeID, "machineID", machine.ID, "lastSize", lastVolumeSize, "volumeSize", volumeSize)
 					shouldEnqueue = true
 					break
@@ -268,116 +634,263 @@ func (r *MachineReconciler) startCheckAndEnqueueVolumeResize(ctx context.Context
 			}
 
 			if shouldEnqueue {
-				r.queue.AddRateLimited(machine.ID)
+				r.enqueueRateLimited(machine.ID, queuePriorityUpdate)
 			}
 		}
 	}, r.resyncIntervalVolumeSize)
 }
 
+// startEnqueueMachineByLibvirtEvent subscribes to lifecycle events of domains. The subscription is renewed
+// after the connection to libvirt broke.
 func (r *MachineReconciler) startEnqueueMachineByLibvirtEvent(ctx context.Context, log logr.Logger) {
-	lifecycleEvents, err := r.libvirt.LifecycleEvents(ctx)
-	if err != nil {
-		log.Error(err, "failed to subscribe to libvirt lifecycle events")
-		return
-	}
+	resubscribe := false
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := r.waitForLibvirt(ctx, log); err != nil {
+			return
+		}
 
-	log.Info("Subscribing to libvirt lifecycle events")
+		lifecycleEvents, err := r.libvirt.LifecycleEvents(ctx)
+		if err != nil {
+			log.Error(err, "failed to subscribe to libvirt lifecycle events")
+			return
+		}
 
-	for {
-		select {
-		case evt, ok := <-lifecycleEvents:
-			if !ok {
-				log.Error(fmt.Errorf("libvirt lifecycle event channel closed"), "failed to process event")
-				return
-			}
+		log.Info("Subscribing to libvirt lifecycle events")
+		if resubscribe {
+			// Events may have been missed while disconnected.
+			r.enqueueAll(ctx, log, queuePriorityPower)
+		}
+		resubscribe = true
+
+		for {
+			select {
+			case evt, ok := <-lifecycleEvents:
+				if !ok {
+					log.Info("Libvirt lifecycle event channel closed, resubscribing")
+					return
+				}
 
-			machine, err := r.machines.Get(ctx, evt.Dom.Name)
-			if err != nil {
-				if errors.Is(err, store.ErrNotFound) {
-					log.V(2).Info("Skipped: not managed by libvirt-provider", "machineID", evt.Dom.Name)
+				machine := r.domainEventMachine(ctx, log, evt.Dom)
+				if machine == nil {
 					continue
 				}
-				log.Error(err, "failed to fetch machine from store")
-				continue
+
+				if libvirt.DomainEventType(evt.Event) == libvirt.DomainEventStopped {
+					r.persistStoppedDomain(ctx, log, machine, libvirt.DomainEventStoppedDetailType(evt.Detail))
+				}
+
+				// State changes are picked up immediately instead of waiting for the backoff of the machine, and
+				// ahead of other changes, as the domain may have to be started or stopped again.
+				log.V(1).Info("requeue machine", "machineID", machine.ID, "lifecycleEventID", evt.Event)
+				r.enqueue(machine.ID, queuePriorityPower)
+			case <-ctx.Done():
+				log.Info("Context done for libvirt event lifecycle.")
+				return
 			}
+		}
+	}, libvirtConnectionPollInterval)
+}
+
+// startGarbageCollector runs the garbage collector every resync interval. Changing the interval starts the
+// next run immediately.
+func (r *MachineReconciler) startGarbageCollector(ctx context.Context, log logr.Logger) {
+	for {
+		r.collectGarbage(ctx, log)
 
-			log.V(1).Info("requeue machine", "machineID", machine.ID, "lifecycleEventID", evt.Event)
-			r.queue.AddRateLimited(machine.ID)
+		r.gcIntervalMu.Lock()
+		interval, changed := r.resyncIntervalGarbageCollector, r.gcIntervalChanged
+		r.gcIntervalMu.Unlock()
+
+		select {
 		case <-ctx.Done():
-			log.Info("Context done for libvirt event lifecycle.")
 			return
+		case <-time.After(interval):
+		case <-changed:
 		}
 	}
 }
 
-func (r *MachineReconciler) startGarbageCollector(ctx context.Context, log logr.Logger) {
-	wait.UntilWithContext(ctx, func(ctx context.Context) {
-		log.V(1).Info("starting garbage-collector loop")
-		machines, err := r.machines.List(ctx)
-		if err != nil {
-			log.Error(err, "failed to list machines")
-			return
-		}
+// SetResyncIntervalGarbageCollector changes the resync interval of the garbage collector.
+func (r *MachineReconciler) SetResyncIntervalGarbageCollector(interval time.Duration) {
+	r.gcIntervalMu.Lock()
+	defer r.gcIntervalMu.Unlock()
 
-		for _, machine := range machines {
-			if !slices.Contains(machine.Finalizers, MachineFinalizer) || machine.DeletedAt == nil {
-				continue
-			}
+	r.resyncIntervalGarbageCollector = interval
+	close(r.gcIntervalChanged)
+	r.gcIntervalChanged = make(chan struct{})
+}
 
-			logger := log.WithValues("machineID", machine.ID)
-			if err := r.processMachineDeletion(ctx, logger, machine); err != nil {
-				logger.Error(err, "failed to garbage collect machine")
-			}
+func (r *MachineReconciler) collectGarbage(ctx context.Context, log logr.Logger) {
+	log.V(1).Info("starting garbage-collector loop")
+	machines, err := r.machines.List(ctx)
+	if err != nil {
+		log.Error(err, "failed to list machines")
+		return
+	}
+
+	for _, machine := range machines {
+		if !slices.Contains(machine.Finalizers, MachineFinalizer) || machine.DeletedAt == nil {
+			continue
 		}
 
-	}, r.resyncIntervalGarbageCollector)
+		logger := log.WithValues("machineID", machine.ID)
+		r.machineLocks.Lock(machine.ID)
+		if err := r.processMachineDeletion(ctx, logger, machine); err != nil {
+			logger.Error(err, "failed to garbage collect machine")
+		}
+		r.machineLocks.Unlock(machine.ID)
+	}
+
+	if err := r.removeLeftovers(ctx, log); err != nil {
+		log.Error(err, "failed to remove leftovers")
+	}
 }
 
 func (r *MachineReconciler) processMachineDeletion(ctx context.Context, log logr.Logger, machine *api.Machine) error {
-	isDeleting, err := r.deleteMachine(ctx, log, machine)
-	switch {
-	case isDeleting:
-		return nil
-	case err != nil:
-		return fmt.Errorf("failed to delete machine: %w", err)
-	}
-	log.V(1).Info("Deleted machine")
-	machine.Status.State = api.MachineStateTerminated
-	machine, err = r.machines.Update(ctx, machine)
+	// Cancel the conversion of the root fs base if the machine was the last one waiting for it.
+	r.rootFSConverter.Release(machine.ID)
+	r.forgetGuestAgentProbe(machine.ID)
+
+	machine, err := r.ensureResourceFinalizersOfDeletedMachine(ctx, machine)
 	if err != nil {
-		return fmt.Errorf("failed to update machine state: %w", err)
+		return err
 	}
 
-	if err := r.deleteVolumes(ctx, log, machine); err != nil {
-		return fmt.Errorf("failed to remove machine disks: %w", err)
+	if slices.Contains(machine.Finalizers, DomainFinalizer) {
+		isDeleting, err := r.deleteMachine(ctx, log, machine)
+		switch {
+		case isDeleting:
+			return nil
+		case err != nil:
+			return fmt.Errorf("failed to delete machine: %w", err)
+		}
+		log.V(1).Info("Deleted machine")
+		machine.Status.State = api.MachineStateTerminated
+		machine.Finalizers = utils.DeleteSliceElement(machine.Finalizers, DomainFinalizer)
+		machine, err = r.machines.Update(ctx, machine)
+		if err != nil {
+			return fmt.Errorf("failed to update machine state: %w", err)
+		}
 	}
-	log.V(1).Info("Removed machine disks")
 
-	if err := r.deleteNetworkInterfaces(ctx, log, machine); err != nil {
-		return fmt.Errorf("failed to remove machine network interfaces: %w", err)
+	var errs []error
+	for _, teardown := range []struct {
+		finalizer string
+		fn        func(machine *api.Machine) error
+	}{
+		{PCIDevicesFinalizer, func(machine *api.Machine) error {
+			// The devices went back to the host with the domain, hence only their allocation is left to release.
+			machine.Spec.PCIDevices = nil
+			machine.Status.PCIDevices = nil
+			return nil
+		}},
+		{MdevDevicesFinalizer, func(machine *api.Machine) error {
+			if err := r.removeMdevDevices(machine); err != nil {
+				return fmt.Errorf("failed to remove mdev devices: %w", err)
+			}
+			machine.Spec.MdevDevices = nil
+			return nil
+		}},
+		{USBDevicesFinalizer, func(machine *api.Machine) error {
+			// Like pci devices, usb devices went back to the host with the domain.
+			machine.Spec.USBDevices = nil
+			machine.Status.USBDevices = nil
+			return nil
+		}},
+		{VolumesFinalizer, func(machine *api.Machine) error {
+			if err := r.deleteVolumes(ctx, log, machine); err != nil {
+				return fmt.Errorf("failed to remove machine disks: %w", err)
+			}
+			log.V(1).Info("Removed machine disks")
+			return nil
+		}},
+		{NetworkInterfacesFinalizer, func(machine *api.Machine) error {
+			if err := r.deleteNetworkInterfaces(ctx, log, machine); err != nil {
+				return fmt.Errorf("failed to remove machine network interfaces: %w", err)
+			}
+			log.V(1).Info("Removed network interfaces")
+			return nil
+		}},
+	} {
+		if !slices.Contains(machine.Finalizers, teardown.finalizer) {
+			continue
+		}
+		if err := teardown.fn(machine); err != nil {
+			errs = append(errs, fmt.Errorf("[finalizer %s] %w", teardown.finalizer, err))
+			continue
+		}
+
+		machine.Finalizers = utils.DeleteSliceElement(machine.Finalizers, teardown.finalizer)
+		if !hasResourceFinalizer(machine) {
+			// The machine directory marks an incomplete teardown, see ensureResourceFinalizersOfDeletedMachine,
+			// hence it is gone before the last resource finalizer.
+			if err := r.removeMachineDir(log, machine); err != nil {
+				return err
+			}
+		}
+		if machine, err = r.machines.Update(ctx, machine); err != nil {
+			return fmt.Errorf("failed to remove finalizer %s: %w", teardown.finalizer, err)
+		}
+		log.V(1).Info("Removed finalizer", "Finalizer", teardown.finalizer)
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
 	}
-	log.V(1).Info("Removed network interfaces")
 
-	if err := os.RemoveAll(r.host.MachineDir(machine.ID)); err != nil {
-		return fmt.Errorf("failed to remove machine directory: %w", err)
+	if err := r.removeMachineDir(log, machine); err != nil {
+		return err
 	}
-	log.V(1).Info("Removed machine directory")
 
 	machine.Finalizers = utils.DeleteSliceElement(machine.Finalizers, MachineFinalizer)
 	if _, err := r.machines.Update(ctx, machine); store.IgnoreErrNotFound(err) != nil {
 		return fmt.Errorf("failed to update machine metadata: %w", err)
 	}
-	r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, "CompletedDeletion", "Deletion completed")
+	r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, machineEvent.ReasonCompletedDeletion, "Deletion completed")
 	log.V(1).Info("Removed Finalizer. Deletion completed")
 
 	return nil
 }
 
-func (r *MachineReconciler) deleteMachine(ctx context.Context, log logr.Logger, machine *api.Machine) (bool, error) {
-	domain := libvirt.Domain{
-		UUID: libvirtutils.UUIDStringToBytes(machine.ID),
+func (r *MachineReconciler) removeMachineDir(log logr.Logger, machine *api.Machine) error {
+	if err := os.RemoveAll(r.host.MachineDir(machine.ID)); err != nil {
+		return fmt.Errorf("failed to remove machine directory: %w", err)
+	}
+	log.V(1).Info("Removed machine directory")
+	return nil
+}
+
+func hasResourceFinalizer(machine *api.Machine) bool {
+	return slices.ContainsFunc(resourceFinalizers, func(finalizer string) bool {
+		return slices.Contains(machine.Finalizers, finalizer)
+	})
+}
+
+// ensureResourceFinalizersOfDeletedMachine adds the resource finalizers to deleted machines created before they
+// were introduced. The machine directory is removed before the last resource finalizer, so machines without
+// resource finalizers still having it are the ones whose teardown never started. Torn down machines are never
+// torn down again.
+func (r *MachineReconciler) ensureResourceFinalizersOfDeletedMachine(ctx context.Context, machine *api.Machine) (*api.Machine, error) {
+	if hasResourceFinalizer(machine) {
+		return machine, nil
+	}
+	if _, err := os.Stat(r.host.MachineDir(machine.ID)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return machine, nil
+		}
+		return nil, fmt.Errorf("error checking machine directory: %w", err)
 	}
 
+	machine.Finalizers = append(machine.Finalizers, resourceFinalizers...)
+	machine, err := r.machines.Update(ctx, machine)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set resource finalizers: %w", err)
+	}
+	return machine, nil
+}
+
+func (r *MachineReconciler) deleteMachine(ctx context.Context, log logr.Logger, machine *api.Machine) (bool, error) {
+	domain := machineDomain(machine)
+
 	if machine.Spec.ShutdownAt.IsZero() {
 		machine.Status.State = api.MachineStateTerminating
 		machine.Spec.ShutdownAt = time.Now()
@@ -387,6 +900,17 @@ func (r *MachineReconciler) deleteMachine(ctx context.Context, log logr.Logger,
 		log.V(1).Info("Updated ShutdownAt and State", "ShutdownAt", machine.Spec.ShutdownAt, "State", machine.Status.State)
 	}
 
+	// Persistent domains would survive the shutdown, hence drop their definition first.
+	if err := r.undefineDomain(log, domain); err != nil {
+		return false, err
+	}
+
+	if api.IsForceDeleted(machine.Metadata) {
+		log.V(1).Info("Force deleting machine, skipping graceful shutdown")
+		r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, machineEvent.ReasonForceDeleting, "Force deleting machine, skipping graceful shutdown")
+		return false, r.destroyDomainFlags(log, machine, domain, libvirt.DomainDestroyDefault)
+	}
+
 	if time.Now().Before(machine.Spec.ShutdownAt.Add(r.gcVMGracefulShutdownTimeout)) {
 		// Due to heavy load, the AcpiPowerBtn signal might be missed by the VM.
 		// Hence, triggering the machine shutdown until VMGracefulShutdownTimeout is over to ensure its reception.
@@ -397,16 +921,22 @@ func (r *MachineReconciler) deleteMachine(ctx context.Context, log logr.Logger,
 }
 
 func (r *MachineReconciler) destroyDomain(log logr.Logger, machine *api.Machine, domain libvirt.Domain) error {
+	return r.destroyDomainFlags(log, machine, domain, libvirt.DomainDestroyGraceful)
+}
+
+// destroyDomainFlags destroys the domain. Unlike with DomainDestroyGraceful, with DomainDestroyDefault libvirt
+// kills the qemu process if it doesn't terminate on SIGTERM.
+func (r *MachineReconciler) destroyDomainFlags(log logr.Logger, machine *api.Machine, domain libvirt.Domain, flags libvirt.DomainDestroyFlagsValues) error {
 	// DomainDestroyFlags is a blocking operation, and its synchronous nature may pose potential performance issues in the future.
 	// During test involving 26 empty disks, the function call took a maximum of 1 second to complete.
-	if err := r.libvirt.DomainDestroyFlags(domain, libvirt.DomainDestroyGraceful); err != nil {
+	if err := r.libvirt.DomainDestroyFlags(domain, flags); err != nil {
 		if libvirt.IsNotFound(err) {
 			return nil
 		}
 		return fmt.Errorf("failed to initiate forceful shutdown: %w", err)
 	}
 
-	r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, "DestroyedDomain", "Domain Destroyed")
+	r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, machineEvent.ReasonDestroyedDomain, "Domain Destroyed")
 
 	log.V(1).Info("Destroyed domain")
 	return nil
@@ -414,7 +944,7 @@ func (r *MachineReconciler) destroyDomain(log logr.Logger, machine *api.Machine,
 
 func (r *MachineReconciler) shutdownMachine(log logr.Logger, machine *api.Machine, domain libvirt.Domain) (bool, error) {
 	log.V(1).Info("Triggering shutdown", "ShutdownAt", machine.Spec.ShutdownAt)
-	r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, "TriggeringShutdown", "Shutdown Triggered")
+	r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, machineEvent.ReasonTriggeringShutdown, "Shutdown Triggered")
 
 	shutdownMode := libvirt.DomainShutdownAcpiPowerBtn
 	if machine.Spec.GuestAgent == api.GuestAgentQemu {
@@ -431,20 +961,37 @@ func (r *MachineReconciler) shutdownMachine(log logr.Logger, machine *api.Machin
 }
 
 func (r *MachineReconciler) processNextWorkItem(ctx context.Context, log logr.Logger) bool {
+	if err := r.waitForLibvirt(ctx, log); err != nil {
+		return false
+	}
+
 	id, shutdown := r.queue.Get()
 	if shutdown {
 		return false
 	}
 	defer r.queue.Done(id)
 
-	log = log.WithValues("machineID", id)
-	ctx = logr.NewContext(ctx, log)
+	ctx = logr.NewContext(ctx, log.WithValues("machineID", id))
+	ctx, span := correlation.Start(ctx, "ReconcileMachine", "ReconcileID", correlation.NewID())
+	defer span.End()
+	correlation.SetMachineID(ctx, id)
+	log = logr.FromContextOrDiscard(ctx)
 
+	r.machineLocks.Lock(id)
+	defer r.machineLocks.Unlock(id)
+	activeWorkers.Inc()
+	defer activeWorkers.Dec()
+
+	start := time.Now()
 	if err := r.reconcileMachine(ctx, id); err != nil {
+		correlation.Observe(ctx, reconcileDuration.WithLabelValues(reconcileResultError), time.Since(start).Seconds())
+		correlation.RecordError(span, err)
+
 		log.Error(err, "failed to reconcile machine")
-		r.queue.AddRateLimited(id)
+		r.enqueueRateLimited(id, queuePriorityRecovery)
 		return true
 	}
+	correlation.Observe(ctx, reconcileDuration.WithLabelValues(reconcileResultSuccess), time.Since(start).Seconds())
 
 	r.queue.Forget(id)
 	return true
@@ -467,14 +1014,26 @@ func (r *MachineReconciler) reconcileMachine(ctx context.Context, id string) err
 		return nil
 	}
 
-	if !slices.Contains(machine.Finalizers, MachineFinalizer) {
-		machine.Finalizers = append(machine.Finalizers, MachineFinalizer)
+	var missingFinalizers []string
+	for _, finalizer := range append([]string{MachineFinalizer}, resourceFinalizers...) {
+		if !slices.Contains(machine.Finalizers, finalizer) {
+			missingFinalizers = append(missingFinalizers, finalizer)
+		}
+	}
+	if len(missingFinalizers) > 0 {
+		machine.Finalizers = append(machine.Finalizers, missingFinalizers...)
 		if _, err := r.machines.Update(ctx, machine); err != nil {
 			return fmt.Errorf("failed to set finalizers: %w", err)
 		}
 		return nil
 	}
 
+	if traceParent, ok := machine.Annotations[api.TraceParentAnnotation]; ok {
+		var span trace.Span
+		ctx, span = correlation.ContinueTrace(ctx, traceParent, "CreateMachineDomain")
+		defer span.End()
+	}
+
 	log.V(1).Info("Making machine directories")
 	if err := providerhost.MakeMachineDirs(r.host, machine.ID); err != nil {
 		return fmt.Errorf("error making machine directories: %w", err)
@@ -482,15 +1041,26 @@ func (r *MachineReconciler) reconcileMachine(ctx context.Context, id string) err
 	log.V(1).Info("Successfully made machine directories")
 
 	log.V(1).Info("Reconciling domain")
+	conditions := slices.Clone(machine.Status.Conditions)
 	state, volumeStates, nicStates, err := r.reconcileDomain(ctx, log, machine)
 	if err != nil {
-		return providerimage.IgnoreImagePulling(err)
+		if err := r.updateConditions(ctx, machine, conditions); err != nil {
+			log.Error(err, "Failed to update conditions")
+		}
+		return qcow2.IgnoreErrConverting(providerimage.IgnoreImagePulling(err))
 	}
 	log.V(1).Info("Reconciled domain")
 
 	machine.Status.VolumeStatus = volumeStates
 	machine.Status.NetworkInterfaceStatus = nicStates
 	machine.Status.State = state
+	machine.Status.Power = observedPower(state)
+	if state != api.MachineStatePending {
+		// The domain is created, the following reconciliations don't belong to the creation anymore.
+		delete(machine.Annotations, api.TraceParentAnnotation)
+	}
+	r.reconcileGuestAgentStatus(log, machine, state)
+	r.reconcileRestarts(machine, state)
 
 	if _, err = r.machines.Update(ctx, machine); err != nil {
 		return fmt.Errorf("failed to update machine status: %w", err)
@@ -504,12 +1074,68 @@ func (r *MachineReconciler) reconcileDomain(
 	log logr.Logger,
 	machine *api.Machine,
 ) (api.MachineState, []api.VolumeStatus, []api.NetworkInterfaceStatus, error) {
+	if err := r.reconcileRebuild(ctx, log, machine); err != nil {
+		return "", nil, nil, fmt.Errorf("error rebuilding root disk: %w", err)
+	}
+
+	if machine.Spec.Power == api.PowerStatePowerOff {
+		r.resetStopped(machine)
+		log.V(1).Info("Powering off domain")
+		state, err := r.reconcilePowerOff(log, machine)
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("error powering off domain: %w", err)
+		}
+		if state == api.MachineStateTerminated {
+			// The pci and usb devices of the machine are free once its domain is gone.
+			machine.Status.PCIDevices = nil
+			machine.Status.USBDevices = nil
+			if err := r.flattenRootFSIfRequested(log, machine); err != nil {
+				return "", nil, nil, err
+			}
+		}
+		return state, machine.Status.VolumeStatus, machine.Status.NetworkInterfaceStatus, nil
+	}
+	// A machine powered on again has to be shut down gracefully on its next power off or deletion.
+	machine.Spec.ShutdownAt = time.Time{}
+	machine.Status.StopStep = ""
+
+	if machine.Spec.Suspend {
+		log.V(1).Info("Suspending domain")
+		state, err := r.reconcileSuspend(log, machine)
+		if err != nil {
+			return "", nil, nil, fmt.Errorf("error suspending domain: %w", err)
+		}
+		return state, machine.Status.VolumeStatus, machine.Status.NetworkInterfaceStatus, nil
+	}
+
 	log.V(1).Info("Looking up domain")
-	if _, err := r.libvirt.DomainLookupByUUID(libvirtutils.UUIDStringToBytes(machine.ID)); err != nil {
+	domain, err := r.libvirt.DomainLookupByUUID(machineDomain(machine).UUID)
+	if err == nil {
+		err = r.resumeDomain(log, machine, domain)
+	}
+	if err == nil {
+		err = r.removeStoppedPersistentDomain(log, machine, domain)
+	}
+	if err == nil {
+		crashed, err := r.reconcileCrashedDomain(log, machine, domain)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		if crashed {
+			return api.MachineStateTerminated, machine.Status.VolumeStatus, machine.Status.NetworkInterfaceStatus, nil
+		}
+	}
+	if err != nil {
 		if !libvirt.IsNotFound(err) {
 			return "", nil, nil, fmt.Errorf("error getting domain %s: %w", machine.ID, err)
 		}
 
+		if machine.Spec.Adopted || r.awaitStopReason(machine) || !r.restartDue(log, machine) {
+			machine.Status.PCIDevices = nil
+			machine.Status.USBDevices = nil
+			return api.MachineStateTerminated, machine.Status.VolumeStatus, machine.Status.NetworkInterfaceStatus, nil
+		}
+
 		log.V(1).Info("Creating new domain")
 		volumeStates, nicStates, err := r.createDomain(ctx, log, machine)
 		if err != nil {
@@ -517,16 +1143,28 @@ func (r *MachineReconciler) reconcileDomain(
 		}
 
 		log.V(1).Info("Created domain")
+		r.setRestarted(log, machine)
+		r.setResizePending(log, machine, "")
 		return api.MachineStatePending, volumeStates, nicStates, nil
 	}
 
-	log.V(1).Info("Updating existing domain")
-	volumeStates, nicStates, err := r.updateDomain(ctx, log, machine)
-	if err != nil {
+	if err := r.checkRunningQcow2DisksOnce(log, machine, domain); err != nil {
+		return "", nil, nil, err
+	}
+
+	volumeStates, nicStates := machine.Status.VolumeStatus, machine.Status.NetworkInterfaceStatus
+	if !machine.Spec.Adopted {
+		log.V(1).Info("Updating existing domain")
+		if volumeStates, nicStates, err = r.updateDomain(ctx, log, machine); err != nil {
+			return "", nil, nil, err
+		}
+	}
+
+	if err := r.reconcileDomainAutostart(log, domain); err != nil {
 		return "", nil, nil, err
 	}
 
-	state, err := r.getMachineState(machine.ID)
+	state, err := r.getMachineState(machine)
 	if err != nil {
 		return "", nil, nil, fmt.Errorf("error getting machine state: %w", err)
 	}
@@ -539,33 +1177,63 @@ func (r *MachineReconciler) updateDomain(
 	log logr.Logger,
 	machine *api.Machine,
 ) ([]api.VolumeStatus, []api.NetworkInterfaceStatus, error) {
-	domainDesc, err := r.getDomainDesc(machine.ID)
+	domainDesc, err := r.getDomainDesc(machine)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error getting domain description: %w", err)
 	}
 
-	attacher, err := NewLibvirtVolumeAttacher(domainDesc, NewRunningDomainExecutor(r.libvirt, machine.ID), r.volumeCachePolicy)
+	if err := checkDomainOwner(log, machine, domainDesc); err != nil {
+		r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, machineEvent.ReasonDomainOwnerMismatch, "Domain is not owned by the machine: %s", err)
+		return nil, nil, err
+	}
+
+	if err := r.reconcileDomainMetadata(log, machine, domainDesc); err != nil {
+		return nil, nil, fmt.Errorf("[metadata] %w", err)
+	}
+
+	attacher, err := NewLibvirtVolumeAttacher(domainDesc, NewRunningDomainExecutor(r.libvirt, machineDomain(machine)), r.volumeCachePolicy, r.diskBus)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error construction volume attacher: %w", err)
 	}
 
 	volumeStates, err := r.attachDetachVolumes(ctx, log, machine, attacher)
+	r.setPhaseCondition(log, machine, api.MachineConditionVolumesAttached, "VolumesAttached", "VolumeAttachFailed", err)
 	if err != nil {
-		r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, "AttchDetachVolume", "Volume attach/detach failed with error: %s", err)
+		r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, machineEvent.ReasonAttachDetachVolume, "Volume attach/detach failed with error: %s", err)
 		return nil, nil, fmt.Errorf("[volumes] %w", err)
 	}
 
 	nicStates, err := r.attachDetachNetworkInterfaces(ctx, log, machine, domainDesc)
 	if err != nil {
-		r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, "AttchDetachNIC", "NIC attach/detach failed with error: %s", err)
+		r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, machineEvent.ReasonAttachDetachNIC, "NIC attach/detach failed with error: %s", err)
 		return nil, nil, fmt.Errorf("[network interfaces] %w", err)
 	}
 
+	if err := r.reconcileDomainPCIDevices(log, machine, domainDesc, NewRunningDomainExecutor(r.libvirt, machineDomain(machine))); err != nil {
+		r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, machineEvent.ReasonAttachDetachPCIDevice, "PCI device attach/detach failed with error: %s", err)
+		return nil, nil, fmt.Errorf("[pci devices] %w", err)
+	}
+
+	if err := r.reconcileDomainMdevDevices(log, machine, domainDesc, NewRunningDomainExecutor(r.libvirt, machineDomain(machine))); err != nil {
+		r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, machineEvent.ReasonAttachDetachMdevDevice, "Mdev device attach/detach failed with error: %s", err)
+		return nil, nil, fmt.Errorf("[mdev devices] %w", err)
+	}
+
+	if err := r.reconcileDomainUSBDevices(log, machine, domainDesc, NewRunningDomainExecutor(r.libvirt, machineDomain(machine))); err != nil {
+		r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, machineEvent.ReasonAttachDetachUSBDevice, "USB device attach/detach failed with error: %s", err)
+		return nil, nil, fmt.Errorf("[usb devices] %w", err)
+	}
+
+	if err := r.reconcileDomainResources(log, machine, domainDesc); err != nil {
+		r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, machineEvent.ReasonHotplugFailed, "vCPU/memory hotplug failed with error: %s", err)
+		return nil, nil, fmt.Errorf("[resources] %w", err)
+	}
+
 	return volumeStates, nicStates, nil
 }
 
-func (r *MachineReconciler) getMachineState(machineID string) (api.MachineState, error) {
-	domainState, _, err := r.libvirt.DomainGetState(machineDomain(machineID), 0)
+func (r *MachineReconciler) getMachineState(machine *api.Machine) (api.MachineState, error) {
+	domainState, _, err := r.libvirt.DomainGetState(machineDomain(machine), 0)
 	if err != nil {
 		return "", fmt.Errorf("error getting domain state: %w", err)
 	}
@@ -586,6 +1254,14 @@ func (r *MachineReconciler) createDomain(
 		return nil, nil, err
 	}
 
+	if err := r.setDomainTrustedBoot(machine, domainXML); err != nil {
+		return nil, nil, err
+	}
+
+	if err := r.checkQcow2DisksOnce(log, machine, domainXML); err != nil {
+		return nil, nil, err
+	}
+
 	domainXMLData, err := domainXML.Marshal()
 	if err != nil {
 		return nil, nil, err
@@ -593,10 +1269,22 @@ func (r *MachineReconciler) createDomain(
 
 	log.V(1).Info("Creating domain")
 	log.V(2).Info("Domain", "XML", domainXMLData)
-	if _, err := r.libvirt.DomainCreateXML(domainXMLData, libvirt.DomainNone); err != nil {
+	err = correlation.Step(ctx, "DefineDomain", func(context.Context) error {
+		_, err := r.libvirt.DomainCreateXML(domainXMLData, libvirt.DomainNone)
+		return err
+	})
+	r.setPhaseCondition(log, machine, api.MachineConditionDomainDefined, "DomainDefined", "DomainDefineFailed", err)
+	if err != nil {
+		if libvirtutils.IsErrorCode(err, libvirt.ErrDomExist) {
+			return nil, nil, fmt.Errorf("domain %s of machine %s already exists: %w", machine.GetDomainUUID(), machine.ID, err)
+		}
 		return nil, nil, err
 	}
 
+	if machine.Spec.LaunchSecurity == api.LaunchSecuritySEV {
+		r.storeLaunchMeasurement(log, machine)
+	}
+
 	return volumeStates, nicStates, nil
 }
 
@@ -617,11 +1305,10 @@ func (r *MachineReconciler) domainFor(
 
 	domainDesc := &libvirtxml.Domain{
 		Name:       machine.GetID(),
-		UUID:       machine.GetID(),
+		UUID:       machine.GetDomainUUID(),
 		Type:       domainSettings.Type,
 		OnPoweroff: "destroy",
 		OnReboot:   "restart",
-		OnCrash:    "coredump-restart",
 		CPU: &libvirtxml.DomainCPU{
 			Mode: "host-passthrough",
 		},
@@ -672,6 +1359,11 @@ func (r *MachineReconciler) domainFor(
 					Target: &libvirtxml.DomainSerialTarget{
 						Type: "pci-serial",
 					},
+					// The output is replayed to console sessions, so they see what happened before they attached.
+					Log: &libvirtxml.DomainChardevLog{
+						File:   r.host.MachineConsoleLogFile(machine.ID),
+						Append: "on",
+					},
 				},
 			},
 			Consoles: []libvirtxml.DomainConsole{
@@ -700,17 +1392,36 @@ func (r *MachineReconciler) domainFor(
 		},
 	}
 
+	setDomainClock(machine, domainDesc)
+	r.setDomainFeatures(log, machine, domainDesc)
+
 	if err := r.setDomainMetadata(log, machine, domainDesc); err != nil {
 		return nil, nil, nil, err
 	}
 
-	if err := r.setDomainResources(machine, domainDesc); err != nil {
+	err = correlation.Step(ctx, "AllocateResources", func(context.Context) error {
+		if err := r.setDomainResources(machine, domainDesc); err != nil {
+			return err
+		}
+		if err := setDomainPCIDevices(machine, domainDesc); err != nil {
+			return err
+		}
+		if err := r.setDomainMdevDevices(machine, domainDesc); err != nil {
+			return err
+		}
+		return r.setDomainUSBDevices(log, machine, domainDesc)
+	})
+	r.setPhaseCondition(log, machine, api.MachineConditionResourcesAllocated, "ResourcesAllocated", "ResourceAllocationFailed", err)
+	if err != nil {
 		return nil, nil, nil, err
 	}
+	r.setDomainHotplug(machine, domainDesc)
+	r.setDomainIOThreads(machine, domainDesc)
 
 	if err := r.setDomainPCIControllers(domainDesc); err != nil {
 		return nil, nil, nil, err
 	}
+	r.setDomainSCSIController(machine, domainDesc)
 
 	if err := r.setTCMallocPath(domainDesc); err != nil {
 		return nil, nil, nil, err
@@ -720,6 +1431,11 @@ func (r *MachineReconciler) domainFor(
 		r.setGuestAgent(machine, domainDesc)
 	}
 
+	if machine.Spec.WatchdogAction != "" {
+		setDomainWatchdog(machine, domainDesc)
+	}
+	r.setDomainPanic(domainDesc)
+
 	if machineImgRef := machine.Spec.Image; machineImgRef != nil && ptr.Deref(machineImgRef, "") != "" {
 		if err := r.setDomainImage(ctx, log, machine, domainDesc, ptr.Deref(machineImgRef, "")); err != nil {
 			return nil, nil, nil, err
@@ -731,51 +1447,60 @@ func (r *MachineReconciler) domainFor(
 			return nil, nil, nil, err
 		}
 	} else {
-		r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, "NoIgnitionData", "Machine does not have ignition data")
+		r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, machineEvent.ReasonNoIgnitionData, "Machine does not have ignition data")
 	}
 
-	attacher, err := NewLibvirtVolumeAttacher(domainDesc, NewCreateDomainExecutor(r.libvirt), r.volumeCachePolicy)
+	attacher, err := NewLibvirtVolumeAttacher(domainDesc, NewCreateDomainExecutor(r.libvirt), r.volumeCachePolicy, r.diskBus)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
-	volumeStates, err := r.attachDetachVolumes(ctx, log, machine, attacher)
+	var volumeStates []api.VolumeStatus
+	err = correlation.Step(ctx, "AttachVolumes", func(ctx context.Context) error {
+		volumeStates, err = r.attachDetachVolumes(ctx, log, machine, attacher)
+		return err
+	})
+	r.setPhaseCondition(log, machine, api.MachineConditionVolumesAttached, "VolumesAttached", "VolumeAttachFailed", err)
 	if err != nil {
-		r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, "AttchDetachVolume", "Volume attach/detach failed with error: %s", err)
+		r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, machineEvent.ReasonAttachDetachVolume, "Volume attach/detach failed with error: %s", err)
 		return nil, nil, nil, err
 	}
 	if machine.Spec.Volumes != nil {
-		r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, "AttchedVolume", "Successfully attached volumes")
+		r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, machineEvent.ReasonAttachedVolume, "Successfully attached volumes")
 	}
 
 	nicStates, err := r.setDomainNetworkInterfaces(ctx, machine, domainDesc)
 	if err != nil {
-		r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, "AttchDetachNIC", "Setting domain network interface failed with error: %s", err)
+		r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, machineEvent.ReasonAttachDetachNIC, "Setting domain network interface failed with error: %s", err)
 		return nil, nil, nil, err
 	}
 	if machine.Spec.NetworkInterfaces != nil {
-		r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, "AttchedNIC", "Successfully attached network interfaces")
+		r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, machineEvent.ReasonAttachedNIC, "Successfully attached network interfaces")
+	}
+
+	if err := r.setDomainNetworkBoot(machine, domainDesc); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := setDomainBootOrder(machine, domainDesc); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if err := domainhook.Apply(ctx, r.domainHooks, machine, domainDesc); err != nil {
+		r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, machineEvent.ReasonDomainHookFailed, "Domain hook failed with error: %s", err)
+		return nil, nil, nil, err
 	}
 
 	return domainDesc, volumeStates, nicStates, nil
 }
 
 func (r *MachineReconciler) setDomainMetadata(log logr.Logger, machine *api.Machine, domain *libvirtxml.Domain) error {
-	labels, found := machine.Metadata.Annotations[api.LabelsAnnotation]
-	if !found {
-		log.V(1).Info("IRI machine labels are not annotated in the API machine")
-		return nil
-	}
-	var irimachineLabels map[string]string
-	err := json.Unmarshal([]byte(labels), &irimachineLabels)
+	domainMetadata, err := domainMetadataFor(machine)
 	if err != nil {
-		return fmt.Errorf("error unmarshalling iri machine labels: %w", err)
+		return err
 	}
-
-	encodedLabels := libvirtmeta.IRIMachineLabelsEncoder(irimachineLabels)
-
-	domainMetadata := &libvirtmeta.LibvirtProviderMetadata{
-		IRIMmachineLabels: encodedLabels,
+	if domainMetadata == nil {
+		log.V(1).Info("IRI machine labels are not annotated in the API machine")
+		return nil
 	}
 
 	domainMetadataXML, err := xml.Marshal(domainMetadata)
@@ -806,6 +1531,76 @@ func (r *MachineReconciler) setDomainResources(machine *api.Machine, domain *lib
 		Value: cpu,
 	}
 
+	if err := r.setDomainNUMANode(machine, domain); err != nil {
+		return err
+	}
+
+	if quotaMillis := r.cpuQuotaMillis(machine); quotaMillis > 0 {
+		// The global quota limits all vCPUs together, so fractional CpuMillis are honored as well.
+		period := r.cpuQuotaPeriod.Microseconds()
+		domain.CPUTune = &libvirtxml.DomainCPUTune{
+			GlobalPeriod: &libvirtxml.DomainCPUTunePeriod{Value: uint64(period)},
+			GlobalQuota:  &libvirtxml.DomainCPUTuneQuota{Value: cpuQuota(quotaMillis, r.cpuQuotaPeriod)},
+		}
+	}
+
+	if qos := machine.Spec.QoS; qos != nil {
+		if domain.CPUTune == nil {
+			domain.CPUTune = &libvirtxml.DomainCPUTune{}
+		}
+		domain.CPUTune.Shares = &libvirtxml.DomainCPUTuneShares{Value: qos.CPUShares}
+		if qos.MemorySoftLimitBytes > 0 {
+			domain.MemoryTune = &libvirtxml.DomainMemoryTune{
+				SoftLimit: &libvirtxml.DomainMemoryTuneLimit{Value: uint64(qos.MemorySoftLimitBytes), Unit: "B"},
+			}
+		}
+	}
+
+	return nil
+}
+
+// cpuQuotaMillis returns the cpu millis all vCPUs of the machine are capped at, or zero if they are not capped.
+// The QoS tier of the machine takes precedence over the cpu quota capping of the reconciler.
+func (r *MachineReconciler) cpuQuotaMillis(machine *api.Machine) int64 {
+	if qos := machine.Spec.QoS; qos != nil {
+		return qos.CPUQuotaMillis
+	}
+	if r.cpuQuotaCapping {
+		return machine.Spec.CpuMillis
+	}
+	return 0
+}
+
+// setDomainNUMANode binds the hugepage-backed memory of the machine to its NUMA node and pins its vCPUs to
+// the cpus of the node, so the guest doesn't access memory across nodes.
+func (r *MachineReconciler) setDomainNUMANode(machine *api.Machine, domain *libvirtxml.Domain) error {
+	if machine.Spec.NUMANode == nil {
+		return nil
+	}
+	if r.hugepages == nil {
+		return fmt.Errorf("machine is bound to numa node %d, but numa aware hugepages are disabled", *machine.Spec.NUMANode)
+	}
+	node, ok := r.hugepages.Node(*machine.Spec.NUMANode)
+	if !ok {
+		return fmt.Errorf("machine is bound to unknown numa node %d", *machine.Spec.NUMANode)
+	}
+
+	domain.MemoryBacking = &libvirtxml.DomainMemoryBacking{
+		MemoryHugePages: &libvirtxml.DomainMemoryHugepages{
+			Hugepages: []libvirtxml.DomainMemoryHugepage{{
+				Size: uint(node.PageSize / 1024),
+				Unit: "KiB",
+			}},
+		},
+	}
+	domain.NUMATune = &libvirtxml.DomainNUMATune{
+		Memory: &libvirtxml.DomainNUMATuneMemory{
+			Mode:    "strict",
+			Nodeset: strconv.Itoa(node.ID),
+		},
+	}
+	domain.VCPU.Placement = "static"
+	domain.VCPU.CPUSet = node.CPUs.String()
 	return nil
 }
 
@@ -870,6 +1665,19 @@ func (r *MachineReconciler) setGuestAgent(machine *api.Machine, domainDesc *libv
 	machine.Status.GuestAgentStatus = &api.GuestAgentStatus{Addr: "unix://" + socketPath}
 }
 
+// setDomainWatchdog adds an i6300esb watchdog taking the watchdog action of the machine if the guest stops
+// feeding it. Fired watchdogs are recorded as machine events.
+func setDomainWatchdog(machine *api.Machine, domainDesc *libvirtxml.Domain) {
+	if domainDesc.Devices == nil {
+		domainDesc.Devices = &libvirtxml.DomainDeviceList{}
+	}
+
+	domainDesc.Devices.Watchdogs = append(domainDesc.Devices.Watchdogs, libvirtxml.DomainWatchdog{
+		Model:  "i6300esb",
+		Action: string(machine.Spec.WatchdogAction),
+	})
+}
+
 func (r *MachineReconciler) setDomainImage(
 	ctx context.Context,
 	log logr.Logger,
@@ -877,54 +1685,69 @@ func (r *MachineReconciler) setDomainImage(
 	domain *libvirtxml.Domain,
 	machineImgRef string,
 ) error {
-	img, err := r.imageCache.Get(ctx, machineImgRef)
+	// Images are pulled in the background, the spans of reconciliations waiting for the pull fail with
+	// ErrImagePulling.
+	pullCtx, span := correlation.StartSpan(ctx, "PullImage")
+	img, err := r.imageCache.Get(pullCtx, machineImgRef)
+	if err != nil {
+		correlation.RecordError(span, err)
+	}
+	span.End()
 	if err != nil {
 		if !errors.Is(err, providerimage.ErrImagePulling) {
+			r.setPhaseCondition(log, machine, api.MachineConditionImagePulled, "ImagePulled", "ImagePullFailed", err)
 			return err
 		}
 
-		r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, "PullingImage", "Pulling image %s", machineImgRef)
+		r.setConditionWithEvent(log, machine, corev1.EventTypeNormal, api.MachineCondition{
+			Type:               api.MachineConditionImagePulled,
+			Status:             api.ConditionFalse,
+			Reason:             "PullingImage",
+			Message:            fmt.Sprintf("Pulling image %s", machineImgRef),
+			LastTransitionTime: time.Now(),
+		})
 		return err
 	}
+	r.setPhaseCondition(log, machine, api.MachineConditionImagePulled, "ImagePulled", "ImagePullFailed", nil)
 
 	rootFSFile := r.host.MachineRootFSFile(machine.ID)
-	ok, err := osutils.RegularFileExists(rootFSFile)
-	if err != nil {
+	if err := correlation.Step(ctx, "CreateRootFS", func(context.Context) error {
+		return r.createRootFS(log, machine, rootFSFile, img.RootFS)
+	}); err != nil {
 		return err
 	}
-	if !ok {
-		if err := r.raw.Create(rootFSFile, raw.WithSourceFile(img.RootFS.Path)); err != nil {
-			return fmt.Errorf("error creating root fs disk: %w", err)
-		}
-		if err := os.Chmod(rootFSFile, filePerm); err != nil {
-			return fmt.Errorf("error changing root fs disk mode: %w", err)
-		}
+	driverType, err := rootFSDriverType(rootFSFile)
+	if err != nil {
+		return err
 	}
 
 	domain.OS.Kernel = img.Kernel.Path
 	domain.OS.Initrd = img.InitRAMFs.Path
 	domain.OS.Cmdline = img.Config.CommandLine
-	domain.Devices.Disks = append(domain.Devices.Disks, libvirtxml.DomainDisk{
+	rootDisk := libvirtxml.DomainDisk{
 		Alias: &libvirtxml.DomainAlias{
 			Name: rootFSAlias,
 		},
 		Device: "disk",
 		Driver: &libvirtxml.DomainDiskDriver{
 			Name: "qemu",
-			Type: "raw",
+			Type: driverType,
 		},
 		Source: &libvirtxml.DomainDiskSource{
 			File: &libvirtxml.DomainDiskSourceFile{
 				File: rootFSFile,
 			},
 		},
-		Target: &libvirtxml.DomainDiskTarget{
-			Dev: "vdaaa", // TODO: Reserving vdaaa for ramdisk, so that it doesnt conflict with other volumes, investigate better solution.
-			Bus: "virtio",
-		},
-		Serial:   "machineboot",
-		ReadOnly: &libvirtxml.DomainDiskReadOnly{},
-	})
+		Serial: "machineboot",
+	}
+	// Root disks of a requested size are writable, so the guest can grow its root fs into the added space.
+	if machine.Spec.RootDiskBytes == 0 {
+		rootDisk.ReadOnly = &libvirtxml.DomainDiskReadOnly{}
+	}
+	// TODO: Reserving vdaaa for ramdisk, so that it doesnt conflict with other volumes, investigate better solution.
+	r.diskBus.setDiskBus(&rootDisk, r.diskBus.Bus, "vdaaa")
+	assignDiskIOThread(domain, &rootDisk)
+	domain.Devices.Disks = append(domain.Devices.Disks, rootDisk)
 	return nil
 }
 
@@ -950,8 +1773,8 @@ func (r *MachineReconciler) setDomainIgnition(machine *api.Machine, domain *libv
 	return nil
 }
 
-func (r *MachineReconciler) getDomainDesc(machineID string) (*libvirtxml.Domain, error) {
-	domainXMLData, err := r.libvirt.DomainGetXMLDesc(libvirt.Domain{UUID: libvirtutils.UUIDStringToBytes(machineID)}, 0)
+func (r *MachineReconciler) getDomainDesc(machine *api.Machine) (*libvirtxml.Domain, error) {
+	domainXMLData, err := r.libvirt.DomainGetXMLDesc(machineDomain(machine), 0)
 	if err != nil {
 		return nil, err
 	}
@@ -963,8 +1786,8 @@ func (r *MachineReconciler) getDomainDesc(machineID string) (*libvirtxml.Domain,
 	return domainXML, nil
 }
 
-func machineDomain(machineID string) libvirt.Domain {
+func machineDomain(machine *api.Machine) libvirt.Domain {
 	return libvirt.Domain{
-		UUID: libvirtutils.UUIDStringToBytes(machineID),
+		UUID: libvirtutils.UUIDStringToBytes(machine.GetDomainUUID()),
 	}
 }
@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/api"
+)
+
+// DomainAutostartPolicy controls whether domains managed by the provider are started by libvirtd on its startup.
+type DomainAutostartPolicy string
+
+const (
+	// DomainAutostartUnmanaged leaves domains transient and does not touch the autostart flag.
+	DomainAutostartUnmanaged DomainAutostartPolicy = "unmanaged"
+	// DomainAutostartEnabled defines domains persistently and enables autostart.
+	DomainAutostartEnabled DomainAutostartPolicy = "enabled"
+	// DomainAutostartDisabled ensures autostart is disabled on any persistent domain.
+	DomainAutostartDisabled DomainAutostartPolicy = "disabled"
+)
+
+func DomainAutostartPolicies() []DomainAutostartPolicy {
+	return []DomainAutostartPolicy{DomainAutostartUnmanaged, DomainAutostartEnabled, DomainAutostartDisabled}
+}
+
+func (r *MachineReconciler) reconcileDomainAutostart(log logr.Logger, domain libvirt.Domain) error {
+	if r.domainAutostart == "" || r.domainAutostart == DomainAutostartUnmanaged {
+		return nil
+	}
+
+	persistent, err := r.libvirt.DomainIsPersistent(domain)
+	if err != nil {
+		return fmt.Errorf("error checking whether domain is persistent: %w", err)
+	}
+
+	if persistent == 0 {
+		if r.domainAutostart == DomainAutostartDisabled {
+			// transient domains are never started by libvirtd
+			return nil
+		}
+
+		domainXMLData, err := r.libvirt.DomainGetXMLDesc(domain, libvirt.DomainXMLInactive)
+		if err != nil {
+			return fmt.Errorf("error getting inactive domain description: %w", err)
+		}
+
+		log.V(1).Info("Defining domain persistently")
+		if domain, err = r.libvirt.DomainDefineXMLFlags(domainXMLData, 0); err != nil {
+			return fmt.Errorf("error defining domain: %w", err)
+		}
+	}
+
+	autostart, err := r.libvirt.DomainGetAutostart(domain)
+	if err != nil {
+		return fmt.Errorf("error getting domain autostart: %w", err)
+	}
+
+	var desired int32
+	if r.domainAutostart == DomainAutostartEnabled {
+		desired = 1
+	}
+	if autostart == desired {
+		return nil
+	}
+
+	log.V(1).Info("Setting domain autostart", "Autostart", desired)
+	if err := r.libvirt.DomainSetAutostart(domain, desired); err != nil {
+		return fmt.Errorf("error setting domain autostart: %w", err)
+	}
+	return nil
+}
+
+// undefineDomain removes the persistent configuration of a domain, turning it into a transient one.
+// A domain that is shut off vanishes completely, along with its managed save image, if any.
+func (r *MachineReconciler) undefineDomain(log logr.Logger, domain libvirt.Domain) error {
+	persistent, err := r.libvirt.DomainIsPersistent(domain)
+	if err != nil {
+		if libvirt.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("error checking whether domain is persistent: %w", err)
+	}
+	if persistent == 0 {
+		return nil
+	}
+
+	log.V(1).Info("Undefining domain")
+	if err := r.libvirt.DomainUndefineFlags(domain, libvirt.DomainUndefineNvram|libvirt.DomainUndefineManagedSave); err != nil {
+		if libvirt.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("error undefining domain: %w", err)
+	}
+	return nil
+}
+
+// removeStoppedPersistentDomain undefines a persistent domain that has been shut off, so that it is recreated
+// the same way a vanished transient domain is. The reason the domain was shut off is recorded in the Stopped
+// condition of the machine. It reports libvirt.ErrNoDomain if the domain was removed.
+func (r *MachineReconciler) removeStoppedPersistentDomain(log logr.Logger, machine *api.Machine, domain libvirt.Domain) error {
+	state, reason, err := r.libvirt.DomainGetState(domain, 0)
+	if err != nil {
+		return err
+	}
+	if libvirt.DomainState(state) != libvirt.DomainShutoff {
+		return nil
+	}
+
+	if stopReason, ok := shutoffStopReason(libvirt.DomainShutoffReason(reason)); ok {
+		r.setStopped(log, machine, stopReason)
+	}
+
+	if err := r.undefineDomain(log, domain); err != nil {
+		return err
+	}
+	return libvirt.Error{Code: uint32(libvirt.ErrNoDomain), Message: "domain has been undefined"}
+}
@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/digitalocean/go-libvirt"
+	libvirtutils "github.com/ironcore-dev/libvirt-provider/internal/libvirt/utils"
+	"github.com/ironcore-dev/libvirt-provider/pkg/libvirt/fake"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Autostart", func() {
+	var env *testEnv
+
+	BeforeEach(func() {
+		env = setupTestEnv()
+	})
+
+	// autostart returns whether the domain of the machine is persistent and autostarted.
+	autostart := func(id string) func() ([]int32, error) {
+		return func() ([]int32, error) {
+			domain := libvirt.Domain{UUID: libvirtutils.UUIDStringToBytes(id)}
+			persistent, err := env.libvirt.DomainIsPersistent(domain)
+			if err != nil {
+				return nil, err
+			}
+			autostart, err := env.libvirt.DomainGetAutostart(domain)
+			if err != nil {
+				return nil, err
+			}
+			return []int32{persistent, autostart}, nil
+		}
+	}
+
+	// runMachine creates a machine and waits for its domain to run.
+	runMachine := func(ctx context.Context) string {
+		machine, err := env.machines.Create(ctx, newMachine())
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(machine.ID).Should(fake.HaveDomainState(env.libvirt, libvirt.DomainRunning))
+		return machine.ID
+	}
+
+	DescribeTable("reconciling the autostart of new domains",
+		func(ctx SpecContext, policy DomainAutostartPolicy, persistent, autostarted int32) {
+			start(env.newReconciler(MachineReconcilerOptions{DomainAutostart: policy}))
+
+			id := runMachine(ctx)
+			Eventually(autostart(id)).Should(Equal([]int32{persistent, autostarted}))
+			Consistently(autostart(id), "300ms").Should(Equal([]int32{persistent, autostarted}))
+		},
+		Entry("unmanaged", DomainAutostartUnmanaged, int32(0), int32(0)),
+		Entry("enabled", DomainAutostartEnabled, int32(1), int32(1)),
+		Entry("disabled", DomainAutostartDisabled, int32(0), int32(0)),
+	)
+
+	It("should flip the autostart of existing domains to the policy", func(ctx SpecContext) {
+		By("enabling the autostart of the domain")
+		enabledCtx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			Expect(env.newReconciler(MachineReconcilerOptions{DomainAutostart: DomainAutostartEnabled}).Start(enabledCtx)).To(Succeed())
+		}()
+
+		id := runMachine(ctx)
+		Eventually(autostart(id)).Should(Equal([]int32{1, 1}))
+		cancel()
+		<-done
+
+		By("disabling the autostart of the existing domain")
+		start(env.newReconciler(MachineReconcilerOptions{DomainAutostart: DomainAutostartDisabled}))
+		Eventually(autostart(id)).Should(Equal([]int32{1, 0}))
+		Expect(id).To(fake.HaveDomainState(env.libvirt, libvirt.DomainRunning))
+
+		By("reverting an autostart enabled outside of the provider")
+		domain := libvirt.Domain{UUID: libvirtutils.UUIDStringToBytes(id)}
+		Expect(env.libvirt.DomainSetAutostart(domain, 1)).To(Succeed())
+		Eventually(autostart(id)).Should(Equal([]int32{1, 0}))
+	})
+})
@@ -0,0 +1,231 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"libvirt.org/go/libvirtxml"
+)
+
+const (
+	// ipxeAlias is the alias of the disk machines run their iPXE script from.
+	ipxeAlias = "ua-ipxe"
+	// ipxeBootFile is the path firmware boots removable media from, relative to the iPXE directory.
+	ipxeBootFile = "EFI/BOOT/BOOTX64.EFI"
+	// ipxeScriptFile is the script iPXE runs when booted from a filesystem containing it.
+	ipxeScriptFile = "autoexec.ipxe"
+)
+
+// bootCandidate is a device the guest may boot from, identified by its alias.
+type bootCandidate struct {
+	alias string
+	order uint
+	// ordered reports whether the order was given by the BootOrderAttribute of the device.
+	ordered bool
+}
+
+// compareBootCandidates orders candidates with boot order by it, before the ones without.
+func compareBootCandidates(a, b bootCandidate) int {
+	switch {
+	case a.ordered && b.ordered:
+		return cmp.Compare(a.order, b.order)
+	case a.ordered:
+		return -1
+	case b.ordered:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// setDomainNetworkBoot prepares machines booting from the network: it enables the boot ROM of their network
+// interfaces and, if the machine has an iPXE script, attaches a read-only disk with iPXE and the script, which
+// setDomainBootOrder boots from first.
+func (r *MachineReconciler) setDomainNetworkBoot(machine *api.Machine, domainDesc *libvirtxml.Domain) error {
+	ipxeDir := r.host.MachineIPXEDir(machine.ID)
+	if machine.Spec.BootDevice != api.BootDeviceNetwork {
+		return os.RemoveAll(ipxeDir)
+	}
+
+	if devices := domainDesc.Devices; devices != nil {
+		for i := range devices.Interfaces {
+			devices.Interfaces[i].ROM = &libvirtxml.DomainROM{Enabled: "yes"}
+		}
+		for i := range devices.Hostdevs {
+			if alias := devices.Hostdevs[i].Alias; alias != nil && strings.HasPrefix(alias.Name, networkInterfaceAliasPrefix) {
+				devices.Hostdevs[i].ROM = &libvirtxml.DomainROM{Bar: "on"}
+			}
+		}
+	}
+
+	if err := os.RemoveAll(ipxeDir); err != nil {
+		return fmt.Errorf("error removing ipxe directory: %w", err)
+	}
+	if machine.Spec.IPXEScript == "" || r.ipxeBinary == "" {
+		return nil
+	}
+	if err := writeIPXEDir(ipxeDir, r.ipxeBinary, machine.Spec.IPXEScript); err != nil {
+		return fmt.Errorf("error writing ipxe directory: %w", err)
+	}
+
+	disk := libvirtxml.DomainDisk{
+		Alias: &libvirtxml.DomainAlias{
+			Name: ipxeAlias,
+		},
+		Device: "disk",
+		Driver: &libvirtxml.DomainDiskDriver{
+			Name: "qemu",
+			Type: "fat",
+		},
+		Source: &libvirtxml.DomainDiskSource{
+			Dir: &libvirtxml.DomainDiskSourceDir{
+				Dir: ipxeDir,
+			},
+		},
+		ReadOnly: &libvirtxml.DomainDiskReadOnly{},
+	}
+	// vdaab follows the root disk at vdaaa and doesn't conflict with volumes either.
+	r.diskBus.setDiskBus(&disk, r.diskBus.Bus, "vdaab")
+	if domainDesc.Devices == nil {
+		domainDesc.Devices = &libvirtxml.DomainDeviceList{}
+	}
+	domainDesc.Devices.Disks = append(domainDesc.Devices.Disks, disk)
+	return nil
+}
+
+// writeIPXEDir writes the iPXE binary as boot file of removable media and the script next to it into dir.
+func writeIPXEDir(dir, binary, script string) error {
+	bootFile := filepath.Join(dir, ipxeBootFile)
+	if err := os.MkdirAll(filepath.Dir(bootFile), 0777); err != nil {
+		return err
+	}
+
+	src, err := os.Open(binary)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = src.Close() }()
+
+	dst, err := os.OpenFile(bootFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, filePerm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, ipxeScriptFile), []byte(script), filePerm)
+}
+
+// setDomainBootOrder sets the devices the guest boots from. Unless the machine boots from the network or any of
+// its devices has a BootOrderAttribute, the guest boots from its first disk. Otherwise, as libvirt doesn't allow
+// combining both, the boot order is set per device:
+//   - disks are the volumes with a boot order, sorted by it, followed by the root disk, or all volumes if
+//     there are neither,
+//   - network interfaces are those with a boot order, sorted by it, followed by the others, if the machine
+//     boots from the network. The iPXE disk of machines with an iPXE script precedes them.
+//
+// The network interfaces are tried before the disks if the machine boots from the network, after them otherwise.
+func setDomainBootOrder(machine *api.Machine, domainDesc *libvirtxml.Domain) error {
+	bootNetwork := machine.Spec.BootDevice == api.BootDeviceNetwork
+
+	var disks, volumes, nics []bootCandidate
+	for _, volume := range machine.Spec.Volumes {
+		candidate := bootCandidate{alias: volumeDiskAlias(volume.Name)}
+		if volume.Connection != nil {
+			var err error
+			if candidate.order, candidate.ordered, err = api.BootOrder(volume.Connection.Attributes); err != nil {
+				return fmt.Errorf("[volume %s] %w", volume.Name, err)
+			}
+		}
+		if candidate.ordered {
+			disks = append(disks, candidate)
+		}
+		volumes = append(volumes, candidate)
+	}
+	for _, nic := range machine.Spec.NetworkInterfaces {
+		candidate := bootCandidate{alias: networkInterfaceAlias(nic.Name)}
+		var err error
+		if candidate.order, candidate.ordered, err = api.BootOrder(nic.Attributes); err != nil {
+			return fmt.Errorf("[network interface %s] %w", nic.Name, err)
+		}
+		if candidate.ordered || bootNetwork {
+			nics = append(nics, candidate)
+		}
+	}
+
+	if !bootNetwork && len(disks) == 0 && len(nics) == 0 {
+		return nil
+	}
+
+	// Devices with equal boot order keep the order of the spec.
+	slices.SortStableFunc(disks, compareBootCandidates)
+	slices.SortStableFunc(nics, compareBootCandidates)
+	if bootNetwork {
+		nics = slices.Insert(nics, 0, bootCandidate{alias: ipxeAlias})
+	}
+
+	devices := domainDesc.Devices
+	if devices == nil {
+		devices = &libvirtxml.DomainDeviceList{}
+		domainDesc.Devices = devices
+	}
+	boots := make(map[string]**libvirtxml.DomainDeviceBoot)
+	for i := range devices.Disks {
+		if alias := devices.Disks[i].Alias; alias != nil {
+			boots[alias.Name] = &devices.Disks[i].Boot
+		}
+	}
+	for i := range devices.Interfaces {
+		if alias := devices.Interfaces[i].Alias; alias != nil {
+			boots[alias.Name] = &devices.Interfaces[i].Boot
+		}
+	}
+	for i := range devices.Hostdevs {
+		if alias := devices.Hostdevs[i].Alias; alias != nil {
+			boots[alias.Name] = &devices.Hostdevs[i].Boot
+		}
+	}
+
+	if _, ok := boots[rootFSAlias]; ok {
+		disks = append(disks, bootCandidate{alias: rootFSAlias})
+	}
+	if len(disks) == 0 {
+		disks = volumes
+	}
+
+	var candidates []bootCandidate
+	if bootNetwork {
+		candidates = append(append(candidates, nics...), disks...)
+	} else {
+		candidates = append(append(candidates, disks...), nics...)
+	}
+
+	var order uint
+	for _, candidate := range candidates {
+		boot, ok := boots[candidate.alias]
+		if !ok {
+			continue
+		}
+		order++
+		*boot = &libvirtxml.DomainDeviceBoot{Order: order}
+	}
+
+	if domainDesc.OS != nil {
+		domainDesc.OS.BootDevices = nil
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"libvirt.org/go/libvirtxml"
+)
+
+// hypervSpinlockRetries is the number of spinlock attempts of Hyper-V guests before they notify the hypervisor.
+const hypervSpinlockRetries = 8191
+
+// setDomainClock sets the clock and timers of the machine. Machines without clock settings keep the ones of
+// api.ClockProfileDefault the domain is created with.
+func setDomainClock(machine *api.Machine, domainDesc *libvirtxml.Domain) {
+	clock := machine.Spec.Clock
+	if clock == nil {
+		return
+	}
+
+	timers := []libvirtxml.DomainTimer{
+		{Name: "rtc", TickPolicy: "catchup"},
+	}
+	if clock.HPET {
+		timers = append(timers, libvirtxml.DomainTimer{Name: "hpet", TickPolicy: "catchup"})
+	} else {
+		timers = append(timers, libvirtxml.DomainTimer{Name: "hpet", Present: "no"})
+	}
+	if clock.HyperV {
+		timers = append(timers, libvirtxml.DomainTimer{Name: "hypervclock", Present: "yes"})
+	}
+	switch {
+	case clock.TSCFrequency > 0:
+		timers = append(timers, libvirtxml.DomainTimer{Name: "tsc", Frequency: clock.TSCFrequency})
+	case !clock.HyperV:
+		timers = append(timers, libvirtxml.DomainTimer{Name: "tsc", Mode: "paravirt", TickPolicy: "catchup"})
+	}
+	domainDesc.Clock = &libvirtxml.DomainClock{
+		Offset: string(clock.Offset),
+		Timer:  timers,
+	}
+
+	if clock.HyperV {
+		on := &libvirtxml.DomainFeatureState{State: "on"}
+		domainDesc.Features.HyperV = &libvirtxml.DomainFeatureHyperV{
+			Relaxed: on,
+			VAPIC:   on,
+			Spinlocks: &libvirtxml.DomainFeatureHyperVSpinlocks{
+				DomainFeatureState: *on,
+				Retries:            hypervSpinlockRetries,
+			},
+			VPIndex:     on,
+			Runtime:     on,
+			Synic:       on,
+			STimer:      &libvirtxml.DomainFeatureHyperVSTimer{DomainFeatureState: *on},
+			Reset:       on,
+			Frequencies: on,
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/libvirt/guest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"libvirt.org/go/libvirtxml"
+)
+
+var _ = Describe("Clock", func() {
+	newDomain := func() *libvirtxml.Domain {
+		return &libvirtxml.Domain{
+			Clock:    &libvirtxml.DomainClock{Offset: "utc"},
+			Features: &libvirtxml.DomainFeatureList{ACPI: &libvirtxml.DomainFeature{}, APIC: &libvirtxml.DomainFeatureAPIC{}},
+		}
+	}
+
+	machineWithClock := func(clock *api.ClockSpec) *api.Machine {
+		machine := &api.Machine{Spec: api.MachineSpec{Clock: clock}}
+		api.SetClassLabel(machine, "windows")
+		return machine
+	}
+
+	windowsClock := func() *api.ClockSpec {
+		clock := api.ClockProfileWindows.Clock()
+		return &clock
+	}
+
+	DescribeTable("setDomainClock",
+		func(clock *api.ClockSpec, expectedClock *libvirtxml.DomainClock, expectHyperV bool) {
+			domainDesc := newDomain()
+			setDomainClock(machineWithClock(clock), domainDesc)
+			Expect(domainDesc.Clock).To(Equal(expectedClock))
+			if expectHyperV {
+				Expect(domainDesc.Features.HyperV).NotTo(BeNil())
+			} else {
+				Expect(domainDesc.Features.HyperV).To(BeNil())
+			}
+		},
+		Entry("without clock settings", nil, &libvirtxml.DomainClock{Offset: "utc"}, false),
+		Entry("default profile", func() *api.ClockSpec { clock := api.ClockProfileDefault.Clock(); return &clock }(),
+			&libvirtxml.DomainClock{Offset: "utc", Timer: []libvirtxml.DomainTimer{
+				{Name: "rtc", TickPolicy: "catchup"},
+				{Name: "hpet", TickPolicy: "catchup"},
+				{Name: "tsc", Mode: "paravirt", TickPolicy: "catchup"},
+			}}, false),
+		Entry("windows profile", windowsClock(),
+			&libvirtxml.DomainClock{Offset: "localtime", Timer: []libvirtxml.DomainTimer{
+				{Name: "rtc", TickPolicy: "catchup"},
+				{Name: "hpet", Present: "no"},
+				{Name: "hypervclock", Present: "yes"},
+			}}, true),
+		Entry("tsc frequency", &api.ClockSpec{Offset: api.ClockOffsetUTC, TSCFrequency: 2500000000},
+			&libvirtxml.DomainClock{Offset: "utc", Timer: []libvirtxml.DomainTimer{
+				{Name: "rtc", TickPolicy: "catchup"},
+				{Name: "hpet", Present: "no"},
+				{Name: "tsc", Frequency: 2500000000},
+			}}, false),
+	)
+
+	Describe("applying feature profiles to the clock", func() {
+		reconcilerWithProfile := func(features string) *MachineReconciler {
+			profiles, err := guest.NewFeatureProfiles([]guest.FeatureProfile{{
+				Name:           "profile",
+				MachineClasses: []string{"windows"},
+				Features:       features,
+			}}, &libvirtxml.DomainCaps{Features: &libvirtxml.DomainCapsFeatures{HyperV: &libvirtxml.DomainCapsFeatureHyperV{
+				Supported: "yes",
+				Enums:     []libvirtxml.DomainCapsEnum{{Name: "features", Values: []string{"relaxed"}}},
+			}}})
+			Expect(err).NotTo(HaveOccurred())
+			return &MachineReconciler{featureProfiles: profiles}
+		}
+
+		It("should keep the Hyper-V enlightenments of the clock for profiles without them", func() {
+			domainDesc := newDomain()
+			machine := machineWithClock(windowsClock())
+			setDomainClock(machine, domainDesc)
+			hyperV := domainDesc.Features.HyperV
+
+			reconcilerWithProfile("<features><pae/></features>").setDomainFeatures(logr.Discard(), machine, domainDesc)
+			Expect(domainDesc.Features.PAE).NotTo(BeNil())
+			Expect(domainDesc.Features.ACPI).NotTo(BeNil())
+			Expect(domainDesc.Features.HyperV).To(Equal(hyperV))
+		})
+
+		It("should replace the Hyper-V enlightenments of the clock by the ones of the profile", func() {
+			domainDesc := newDomain()
+			machine := machineWithClock(windowsClock())
+			setDomainClock(machine, domainDesc)
+
+			reconcilerWithProfile(`<features><hyperv mode="custom"><relaxed state="on"/></hyperv></features>`).setDomainFeatures(logr.Discard(), machine, domainDesc)
+			Expect(domainDesc.Features.HyperV).To(Equal(&libvirtxml.DomainFeatureHyperV{
+				Mode:    "custom",
+				Relaxed: &libvirtxml.DomainFeatureState{State: "on"},
+			}))
+		})
+	})
+})
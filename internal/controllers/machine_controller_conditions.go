@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// setPhaseCondition sets a condition reporting a phase of creating and updating the domain of a machine:
+// True with successReason if err is nil, False with failureReason and the message of err otherwise.
+// Transitions are recorded as events, which is how clients see which phase a pending machine is stuck in.
+func (r *MachineReconciler) setPhaseCondition(
+	log logr.Logger,
+	machine *api.Machine,
+	conditionType api.MachineConditionType,
+	successReason, failureReason string,
+	err error,
+) {
+	condition := api.MachineCondition{
+		Type:               conditionType,
+		Status:             api.ConditionTrue,
+		Reason:             successReason,
+		LastTransitionTime: time.Now(),
+	}
+	eventType := corev1.EventTypeNormal
+	if err != nil {
+		condition.Status = api.ConditionFalse
+		condition.Reason = failureReason
+		condition.Message = err.Error()
+		eventType = corev1.EventTypeWarning
+	}
+	r.setConditionWithEvent(log, machine, eventType, condition)
+}
+
+// setConditionWithEvent sets condition and records an event of eventType if its status or reason changed.
+func (r *MachineReconciler) setConditionWithEvent(log logr.Logger, machine *api.Machine, eventType string, condition api.MachineCondition) {
+	existing := machine.Status.GetCondition(condition.Type)
+	if existing == nil || existing.Status != condition.Status || existing.Reason != condition.Reason {
+		message := fmt.Sprintf("%s is %s", condition.Type, condition.Status)
+		if condition.Message != "" {
+			message += ": " + condition.Message
+		}
+		r.Eventf(log, machine.Metadata, eventType, condition.Reason, "%s", message)
+	}
+	machine.Status.SetCondition(condition)
+}
+
+// updateConditions persists the conditions of a machine whose reconciliation failed, so that the failed phase
+// is reported although the rest of the status isn't updated.
+func (r *MachineReconciler) updateConditions(ctx context.Context, machine *api.Machine, previous []api.MachineCondition) error {
+	if slices.Equal(previous, machine.Status.Conditions) {
+		return nil
+	}
+
+	latest, err := r.machines.Get(ctx, machine.ID)
+	if err != nil {
+		return fmt.Errorf("error getting machine: %w", err)
+	}
+	latest.Status.Conditions = machine.Status.Conditions
+	if _, err := r.machines.Update(ctx, latest); err != nil {
+		return fmt.Errorf("error updating machine conditions: %w", err)
+	}
+	return nil
+}
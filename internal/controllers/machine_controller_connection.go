@@ -0,0 +1,28 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// libvirtConnectionPollInterval is the interval to check whether the connection to libvirt is back.
+const libvirtConnectionPollInterval = 1 * time.Second
+
+// waitForLibvirt blocks while there is no connection to libvirt, so reconciliations are paused instead of
+// failing one by one. Reconnecting is up to the owner of the client, see libvirtutils.ConnectionManager.
+func (r *MachineReconciler) waitForLibvirt(ctx context.Context, log logr.Logger) error {
+	if r.libvirt.IsConnected() {
+		return nil
+	}
+
+	log.V(1).Info("Waiting for connection to libvirt")
+	return wait.PollUntilContextCancel(ctx, libvirtConnectionPollInterval, false, func(context.Context) (bool, error) {
+		return r.libvirt.IsConnected(), nil
+	})
+}
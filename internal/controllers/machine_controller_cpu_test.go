@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"time"
+
+	"github.com/ironcore-dev/libvirt-provider/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"libvirt.org/go/libvirtxml"
+)
+
+var _ = Describe("CPU quota", func() {
+	DescribeTable("deriving the quota from the cpu millis",
+		func(cpuMillis int64, period time.Duration, expected int64) {
+			Expect(cpuQuota(cpuMillis, period)).To(Equal(expected))
+		},
+		Entry("whole cpus", int64(2000), 100*time.Millisecond, int64(200000)),
+		Entry("fractional cpus", int64(1500), 100*time.Millisecond, int64(150000)),
+		Entry("the minimum quota", int64(1000), time.Millisecond, int64(1000)),
+		Entry("less than the minimum quota", int64(500), time.Millisecond, int64(1000)),
+		Entry("the longest period", int64(250), time.Second, int64(250000)),
+	)
+
+	It("should cap the domains of machines if enabled", func() {
+		r := &MachineReconciler{cpuQuotaCapping: true, cpuQuotaPeriod: 2 * time.Millisecond}
+		machine := &api.Machine{Spec: api.MachineSpec{CpuMillis: 250, MemoryBytes: 1 << 30}}
+
+		domain := &libvirtxml.Domain{}
+		Expect(r.setDomainResources(machine, domain)).To(Succeed())
+		Expect(domain.CPUTune).To(Equal(&libvirtxml.DomainCPUTune{
+			GlobalPeriod: &libvirtxml.DomainCPUTunePeriod{Value: 2000},
+			GlobalQuota:  &libvirtxml.DomainCPUTuneQuota{Value: 1000},
+		}))
+	})
+
+	It("should not cap the domains of machines by default", func() {
+		r := &MachineReconciler{cpuQuotaPeriod: DefaultCPUQuotaPeriod}
+		machine := &api.Machine{Spec: api.MachineSpec{CpuMillis: 2000, MemoryBytes: 1 << 30}}
+
+		domain := &libvirtxml.Domain{}
+		Expect(r.setDomainResources(machine, domain)).To(Succeed())
+		Expect(domain.CPUTune).To(BeNil())
+	})
+})
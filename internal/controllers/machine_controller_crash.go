@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"libvirt.org/go/libvirtxml"
+)
+
+// CrashRestartPolicy determines whether crashed machines are restarted.
+type CrashRestartPolicy string
+
+const (
+	// CrashRestartPolicyAlways restarts crashed machines according to their restart policy.
+	CrashRestartPolicyAlways CrashRestartPolicy = "Always"
+	// CrashRestartPolicyNever keeps crashed machines in their crashed state, e.g. for debugging.
+	CrashRestartPolicyNever CrashRestartPolicy = "Never"
+)
+
+func CrashRestartPolicies() []CrashRestartPolicy {
+	return []CrashRestartPolicy{CrashRestartPolicyAlways, CrashRestartPolicyNever}
+}
+
+// setDomainPanic adds a pvpanic device, so guest kernel panics crash the domain. Crashed domains are
+// preserved, so the reconciler observes the crash and restarts them according to the crash restart policy.
+// Domains only get the device if enabled, as the guest has to support it and libvirt no longer restarts
+// them on crash.
+func (r *MachineReconciler) setDomainPanic(domainDesc *libvirtxml.Domain) {
+	if !r.panicDevice {
+		return
+	}
+	domainDesc.OnCrash = "preserve"
+	domainDesc.Devices.Panics = append(domainDesc.Devices.Panics, libvirtxml.DomainPanic{
+		Model: "pvpanic",
+	})
+}
+
+// reconcileCrashedDomain records the crash of a crashed domain and destroys it once a restart is due, so it is
+// recreated. It returns whether the domain is crashed.
+func (r *MachineReconciler) reconcileCrashedDomain(log logr.Logger, machine *api.Machine, domain libvirt.Domain) (bool, error) {
+	domainState, _, err := r.libvirt.DomainGetState(domain, 0)
+	if err != nil {
+		return false, fmt.Errorf("error getting domain state: %w", err)
+	}
+	if libvirt.DomainState(domainState) != libvirt.DomainCrashed {
+		return false, nil
+	}
+
+	r.setStopped(log, machine, stopReasonCrashed)
+	if r.crashRestartPolicy == CrashRestartPolicyNever {
+		setStoppedMessage(machine, fmt.Sprintf("Kept crashed due to crash restart policy %s", CrashRestartPolicyNever))
+		return true, nil
+	}
+	if !r.restartDue(log, machine) {
+		return true, nil
+	}
+
+	log.V(1).Info("Destroying crashed domain to restart it", "Crashes", machine.Status.Crashes, "Restarts", machine.Status.Restarts)
+	if err := r.destroyDomain(log, machine, domain); err != nil {
+		return true, err
+	}
+	r.enqueue(machine.ID, queuePriorityRecovery)
+	return true, nil
+}
@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/pkg/libvirt/fake"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"libvirt.org/go/libvirtxml"
+)
+
+var _ = Describe("Crashes", func() {
+	DescribeTable("setDomainPanic",
+		func(panicDevice bool, expectedOnCrash string, expectedPanics []libvirtxml.DomainPanic) {
+			r := &MachineReconciler{panicDevice: panicDevice}
+			domainDesc := &libvirtxml.Domain{Devices: &libvirtxml.DomainDeviceList{}}
+			r.setDomainPanic(domainDesc)
+			Expect(domainDesc.OnCrash).To(Equal(expectedOnCrash))
+			Expect(domainDesc.Devices.Panics).To(Equal(expectedPanics))
+		},
+		Entry("disabled", false, "", nil),
+		Entry("enabled", true, "preserve", []libvirtxml.DomainPanic{{Model: "pvpanic"}}),
+	)
+
+	It("should keep a crashed machine crashed until it is powered off", func(ctx SpecContext) {
+		env := setupTestEnv()
+		start(env.newReconciler(MachineReconcilerOptions{
+			PanicDevice:        true,
+			CrashRestartPolicy: CrashRestartPolicyNever,
+			StopTimeout:        time.Second,
+		}))
+
+		machine, err := env.machines.Create(ctx, newMachine())
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(machine.ID).Should(fake.HaveDomainState(env.libvirt, libvirt.DomainRunning))
+		domainDesc, _, _ := env.libvirt.Domain(machine.ID)
+		Expect(domainDesc.OnCrash).To(Equal("preserve"))
+		Expect(domainDesc.Devices.Panics).To(ConsistOf(HaveField("Model", "pvpanic")))
+
+		By("crashing the guest")
+		Expect(env.libvirt.SetDomainState(machine.ID, libvirt.DomainCrashed)).To(Succeed())
+		Eventually(env.getMachine(machine.ID)).Should(SatisfyAll(
+			HaveField("Status.State", api.MachineStateTerminated),
+			HaveField("Status.Crashes", BeEquivalentTo(1)),
+			WithTransform(func(machine *api.Machine) *api.MachineCondition {
+				return machine.Status.GetCondition(api.MachineConditionStopped)
+			}, SatisfyAll(
+				HaveField("Status", api.ConditionTrue),
+				HaveField("Reason", stopReasonCrashed),
+				HaveField("Message", "Kept crashed due to crash restart policy Never"),
+			)),
+		))
+		Consistently(machine.ID, 300*time.Millisecond).Should(fake.HaveDomainState(env.libvirt, libvirt.DomainCrashed))
+
+		By("powering the machine off")
+		machine, err = env.machines.Get(ctx, machine.ID)
+		Expect(err).NotTo(HaveOccurred())
+		machine.Spec.Power = api.PowerStatePowerOff
+		_, err = env.machines.Update(ctx, machine)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(env.getMachine(machine.ID)).Should(SatisfyAll(
+			HaveField("Status.Power", api.PowerStatePowerOff),
+			HaveField("Status.Crashes", BeZero()),
+		))
+	})
+})
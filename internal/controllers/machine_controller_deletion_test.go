@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/ironcore-dev/libvirt-provider/api"
+	providervolume "github.com/ironcore-dev/libvirt-provider/internal/plugins/volume"
+	"github.com/ironcore-dev/libvirt-provider/internal/store"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	utilstrings "k8s.io/utils/strings"
+)
+
+// flakyVolumes is a volume plugin only deleting volumes, which fails while failDelete is set.
+type flakyVolumes struct {
+	failDelete atomic.Bool
+	deleted    atomic.Int32
+}
+
+func (p *flakyVolumes) Init(providervolume.Host) error { return nil }
+
+func (p *flakyVolumes) Name() string { return "test.ironcore.dev/flaky" }
+
+func (p *flakyVolumes) GetBackingVolumeID(spec *api.VolumeSpec) (string, error) {
+	return spec.Name, nil
+}
+
+func (p *flakyVolumes) CanSupport(*api.VolumeSpec) bool { return false }
+
+func (p *flakyVolumes) Apply(context.Context, *api.VolumeSpec, *api.Machine) (*providervolume.Volume, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (p *flakyVolumes) Delete(context.Context, string, string) error {
+	if p.failDelete.Load() {
+		return fmt.Errorf("volume backend unavailable")
+	}
+	p.deleted.Add(1)
+	return nil
+}
+
+func (p *flakyVolumes) GetSize(context.Context, *api.VolumeSpec) (int64, error) { return 0, nil }
+
+var _ = Describe("Machine deletion", func() {
+	var (
+		env     *testEnv
+		volumes *flakyVolumes
+	)
+
+	BeforeEach(func() {
+		volumes = &flakyVolumes{}
+		env = setupTestEnv(volumes)
+	})
+
+	// createDeletedMachine stores a deleted machine with the finalizers and a volume of the flaky plugin.
+	createDeletedMachine := func(ctx context.Context, finalizers ...string) *api.Machine {
+		machine := newMachine()
+		machine.Finalizers = finalizers
+		machine, err := env.machines.Create(ctx, machine)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(os.MkdirAll(env.host.MachineVolumeDir(machine.ID, utilstrings.EscapeQualifiedName(volumes.Name()), "disk"), 0777)).To(Succeed())
+		Expect(os.MkdirAll(env.host.MachineNetworkInterfacesDir(machine.ID), 0777)).To(Succeed())
+		Expect(env.machines.Delete(ctx, machine.ID)).To(Succeed())
+		return machine
+	}
+
+	It("should retry a failed volume teardown while the network interfaces are torn down", func(ctx SpecContext) {
+		volumes.failDelete.Store(true)
+		machine := createDeletedMachine(ctx, MachineFinalizer, VolumesFinalizer, NetworkInterfacesFinalizer)
+		start(env.newReconciler(MachineReconcilerOptions{}))
+
+		By("waiting for the network interfaces to be torn down")
+		Eventually(env.getMachine(machine.ID)).Should(HaveField("Finalizers", ConsistOf(MachineFinalizer, VolumesFinalizer)))
+		Expect(env.host.MachineNetworkInterfacesDir(machine.ID)).NotTo(BeAnExistingFile())
+
+		By("ensuring the torn down network interfaces aren't added back")
+		Consistently(env.getMachine(machine.ID), 500*time.Millisecond).Should(HaveField("Finalizers", ConsistOf(MachineFinalizer, VolumesFinalizer)))
+		Expect(env.host.MachineDir(machine.ID)).To(BeADirectory())
+
+		By("recovering the volume backend")
+		volumes.failDelete.Store(false)
+		Eventually(func() error {
+			_, err := env.machines.Get(ctx, machine.ID)
+			return err
+		}).Should(MatchError(store.ErrNotFound))
+		Expect(volumes.deleted.Load()).To(BeEquivalentTo(1))
+		Expect(env.host.MachineDir(machine.ID)).NotTo(BeAnExistingFile())
+	})
+
+	It("should add the resource finalizers to deleted machines created before them", func(ctx SpecContext) {
+		machine := createDeletedMachine(ctx, MachineFinalizer)
+		start(env.newReconciler(MachineReconcilerOptions{}))
+
+		Eventually(func() error {
+			_, err := env.machines.Get(ctx, machine.ID)
+			return err
+		}).Should(MatchError(store.ErrNotFound))
+		Expect(volumes.deleted.Load()).To(BeEquivalentTo(1))
+		Expect(env.host.MachineDir(machine.ID)).NotTo(BeAnExistingFile())
+	})
+
+	It("should not tear down machines again whose resource finalizers are gone", func(ctx SpecContext) {
+		machine := createDeletedMachine(ctx, MachineFinalizer)
+		Expect(os.RemoveAll(env.host.MachineDir(machine.ID))).To(Succeed())
+		start(env.newReconciler(MachineReconcilerOptions{}))
+
+		Eventually(func() error {
+			_, err := env.machines.Get(ctx, machine.ID)
+			return err
+		}).Should(MatchError(store.ErrNotFound))
+		Expect(volumes.deleted.Load()).To(BeZero())
+	})
+})
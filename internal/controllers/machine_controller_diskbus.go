@@ -0,0 +1,149 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"k8s.io/utils/ptr"
+	"libvirt.org/go/libvirtxml"
+)
+
+// DiskBus is the bus disks are attached to the guest with.
+type DiskBus string
+
+const (
+	DiskBusVirtio DiskBus = "virtio"
+	// DiskBusSCSI attaches disks to a virtio-scsi controller, which scales better for machines with many disks.
+	DiskBusSCSI DiskBus = "scsi"
+)
+
+func DiskBuses() []DiskBus {
+	return []DiskBus{DiskBusVirtio, DiskBusSCSI}
+}
+
+// VolumeAttributeDiskBus is the volume attribute overriding the disk bus of a volume.
+const VolumeAttributeDiskBus = "diskBus"
+
+// DiskBusOptions configure the bus disks are attached with.
+type DiskBusOptions struct {
+	// Bus is the bus of the root disk and of volumes that don't specify VolumeAttributeDiskBus.
+	Bus DiskBus
+	// VirtioBlkQueues is the number of queues of virtio-blk disks. If zero, the QEMU default is used.
+	VirtioBlkQueues uint
+	// SCSIQueues is the number of queues of the virtio-scsi controller. If zero, the QEMU default is used.
+	SCSIQueues uint
+	// SCSIIOThread processes the requests of the virtio-scsi controller in a dedicated iothread.
+	SCSIIOThread bool
+}
+
+func (o DiskBusOptions) validate() error {
+	if !slices.Contains(DiskBuses(), o.Bus) {
+		return fmt.Errorf("unsupported disk bus %q", o.Bus)
+	}
+	return nil
+}
+
+// busOrDefault returns bus, or the default bus if bus is empty.
+func (o DiskBusOptions) busOrDefault(bus DiskBus) DiskBus {
+	if bus == "" {
+		return o.Bus
+	}
+	return bus
+}
+
+// volumeDiskBus returns the disk bus requested by the attributes of the volume, if any.
+func volumeDiskBus(volume *api.VolumeSpec) (DiskBus, error) {
+	if volume.Connection == nil {
+		return "", nil
+	}
+
+	value, ok := volume.Connection.Attributes[VolumeAttributeDiskBus]
+	if !ok {
+		return "", nil
+	}
+	if !slices.Contains(DiskBuses(), DiskBus(value)) {
+		return "", fmt.Errorf("unsupported disk bus %q of volume %s", value, volume.Name)
+	}
+	return DiskBus(value), nil
+}
+
+// diskTargetDeviceName computes the target device name of a disk on bus from the Machine.Volumes.Device.
+func diskTargetDeviceName(bus DiskBus, device string) string {
+	if bus == DiskBusSCSI {
+		return "s" + device[1:]
+	}
+	return computeVirtioDiskTargetDeviceName(device)
+}
+
+// setDiskBus sets the target and queues of a disk on bus.
+func (o DiskBusOptions) setDiskBus(disk *libvirtxml.DomainDisk, bus DiskBus, device string) {
+	disk.Target = &libvirtxml.DomainDiskTarget{
+		Dev: diskTargetDeviceName(bus, device),
+		Bus: string(bus),
+	}
+	if bus == DiskBusVirtio && o.VirtioBlkQueues > 0 && disk.Driver != nil {
+		disk.Driver.Queues = ptr.To(o.VirtioBlkQueues)
+	}
+}
+
+// usesSCSI reports whether the root disk or any volume of the machine is attached via scsi.
+func (o DiskBusOptions) usesSCSI(machine *api.Machine) bool {
+	if o.Bus == DiskBusSCSI {
+		return true
+	}
+	for _, volume := range machine.Spec.Volumes {
+		if bus, err := volumeDiskBus(volume); err == nil && bus == DiskBusSCSI {
+			return true
+		}
+	}
+	return false
+}
+
+// setDomainSCSIController adds the virtio-scsi controller if the machine has scsi disks.
+// Volumes attached later via scsi reuse it, or attach it if the domain was created without scsi disks.
+func (r *MachineReconciler) setDomainSCSIController(machine *api.Machine, domain *libvirtxml.Domain) {
+	if !r.diskBus.usesSCSI(machine) {
+		return
+	}
+
+	if r.diskBus.SCSIIOThread {
+		domain.IOThreads = max(domain.IOThreads, 1)
+	}
+	domain.Devices.Controllers = append(domain.Devices.Controllers, r.diskBus.newSCSIController(domain))
+}
+
+// newSCSIController returns the virtio-scsi controller of the domain. The controller processes its
+// requests in the first iothread if requested and the domain has one, iothreads can't be added to
+// running domains.
+func (o DiskBusOptions) newSCSIController(domain *libvirtxml.Domain) libvirtxml.DomainController {
+	controller := libvirtxml.DomainController{
+		Type:  "scsi",
+		Index: ptr.To[uint](0),
+		Model: "virtio-scsi",
+	}
+	ioThread := o.SCSIIOThread && domain.IOThreads > 0
+	if o.SCSIQueues > 0 || ioThread {
+		controller.Driver = &libvirtxml.DomainControllerDriver{}
+		if o.SCSIQueues > 0 {
+			controller.Driver.Queues = ptr.To(o.SCSIQueues)
+		}
+		if ioThread {
+			controller.Driver.IOThread = 1
+		}
+	}
+	return controller
+}
+
+// hasSCSIController reports whether the domain has a scsi controller.
+func hasSCSIController(domain *libvirtxml.Domain) bool {
+	if domain.Devices == nil {
+		return false
+	}
+	return slices.ContainsFunc(domain.Devices.Controllers, func(controller libvirtxml.DomainController) bool {
+		return controller.Type == "scsi"
+	})
+}
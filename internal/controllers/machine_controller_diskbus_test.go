@@ -0,0 +1,141 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"github.com/ironcore-dev/libvirt-provider/api"
+	providervolume "github.com/ironcore-dev/libvirt-provider/internal/plugins/volume"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/ptr"
+	"libvirt.org/go/libvirtxml"
+)
+
+// attachedDevices is a DomainExecutor of a running domain recording the attached disks and controllers.
+type attachedDevices struct {
+	createDomainExecutor
+	disks       []libvirtxml.DomainDisk
+	controllers []libvirtxml.DomainController
+}
+
+func (e *attachedDevices) AttachDisk(disk *libvirtxml.DomainDisk) error {
+	e.disks = append(e.disks, *disk)
+	return nil
+}
+
+func (e *attachedDevices) AttachController(controller *libvirtxml.DomainController) error {
+	e.controllers = append(e.controllers, *controller)
+	return nil
+}
+
+func (e *attachedDevices) ApplySecret(*libvirtxml.Secret, []byte) error { return nil }
+func (e *attachedDevices) DeleteSecret(string) error                    { return nil }
+
+var _ = Describe("Disk bus", func() {
+	volumeOnBus := func(bus DiskBus) *api.VolumeSpec {
+		volume := &api.VolumeSpec{Name: "disk", Connection: &api.VolumeConnection{}}
+		if bus != "" {
+			volume.Connection.Attributes = map[string]string{VolumeAttributeDiskBus: string(bus)}
+		}
+		return volume
+	}
+
+	DescribeTable("computing the target device name",
+		func(bus DiskBus, device, expected string) {
+			Expect(diskTargetDeviceName(bus, device)).To(Equal(expected))
+		},
+		Entry("virtio disk", DiskBusVirtio, "oda", "vda"),
+		Entry("scsi disk", DiskBusSCSI, "oda", "sda"),
+		Entry("virtio root disk", DiskBusVirtio, "vdaaa", "vdaaa"),
+		Entry("scsi root disk", DiskBusSCSI, "vdaaa", "sdaaa"),
+	)
+
+	DescribeTable("setting the bus of a disk",
+		func(opts DiskBusOptions, bus DiskBus, expectedTarget *libvirtxml.DomainDiskTarget, expectedQueues *uint) {
+			disk := &libvirtxml.DomainDisk{Driver: &libvirtxml.DomainDiskDriver{Name: "qemu"}}
+			opts.setDiskBus(disk, bus, "odb")
+			Expect(disk.Target).To(Equal(expectedTarget))
+			Expect(disk.Driver.Queues).To(Equal(expectedQueues))
+		},
+		Entry("virtio disk",
+			DiskBusOptions{}, DiskBusVirtio,
+			&libvirtxml.DomainDiskTarget{Dev: "vdb", Bus: "virtio"}, nil),
+		Entry("virtio disk with queues",
+			DiskBusOptions{VirtioBlkQueues: 4}, DiskBusVirtio,
+			&libvirtxml.DomainDiskTarget{Dev: "vdb", Bus: "virtio"}, ptr.To[uint](4)),
+		Entry("scsi disk ignoring the virtio-blk queues",
+			DiskBusOptions{VirtioBlkQueues: 4}, DiskBusSCSI,
+			&libvirtxml.DomainDiskTarget{Dev: "sdb", Bus: "scsi"}, nil),
+	)
+
+	DescribeTable("detecting machines with scsi disks",
+		func(opts DiskBusOptions, volumes []*api.VolumeSpec, expected bool) {
+			machine := &api.Machine{Spec: api.MachineSpec{Volumes: volumes}}
+			Expect(opts.usesSCSI(machine)).To(Equal(expected))
+		},
+		Entry("virtio by default", DiskBusOptions{Bus: DiskBusVirtio}, []*api.VolumeSpec{volumeOnBus("")}, false),
+		Entry("scsi by default", DiskBusOptions{Bus: DiskBusSCSI}, nil, true),
+		Entry("scsi volume", DiskBusOptions{Bus: DiskBusVirtio}, []*api.VolumeSpec{volumeOnBus(""), volumeOnBus(DiskBusSCSI)}, true),
+		Entry("unsupported bus of a volume", DiskBusOptions{Bus: DiskBusVirtio}, []*api.VolumeSpec{volumeOnBus("ide")}, false),
+		Entry("volume without connection", DiskBusOptions{Bus: DiskBusVirtio}, []*api.VolumeSpec{{Name: "disk"}}, false),
+	)
+
+	Describe("hot attaching volumes", func() {
+		var (
+			executor *attachedDevices
+			domain   *libvirtxml.Domain
+			attacher VolumeAttacher
+		)
+
+		BeforeEach(func() {
+			executor = &attachedDevices{}
+			domain = &libvirtxml.Domain{IOThreads: 1, Devices: &libvirtxml.DomainDeviceList{}}
+
+			var err error
+			attacher, err = NewLibvirtVolumeAttacher(domain, executor, "none", DiskBusOptions{Bus: DiskBusVirtio, SCSIQueues: 2, SCSIIOThread: true})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		attach := func(name, device string, bus DiskBus) {
+			Expect(attacher.AttachVolume(&AttachVolume{
+				Name:   name,
+				Device: device,
+				Bus:    bus,
+				Spec:   providervolume.Volume{QCow2File: "/disks/" + name, Handle: name},
+			})).To(Succeed())
+		}
+
+		It("should attach the scsi controller with the first scsi volume", func() {
+			attach("virtio", "oda", DiskBusVirtio)
+			Expect(executor.controllers).To(BeEmpty())
+
+			attach("scsi-1", "odb", DiskBusSCSI)
+			attach("scsi-2", "odc", DiskBusSCSI)
+			Expect(executor.disks).To(HaveLen(3))
+			Expect(executor.controllers).To(Equal([]libvirtxml.DomainController{{
+				Type:   "scsi",
+				Index:  ptr.To[uint](0),
+				Model:  "virtio-scsi",
+				Driver: &libvirtxml.DomainControllerDriver{Queues: ptr.To[uint](2), IOThread: 1},
+			}}))
+			Expect(domain.Devices.Controllers).To(Equal(executor.controllers))
+		})
+
+		It("should reuse the scsi controller the domain was created with", func() {
+			domain.Devices.Controllers = []libvirtxml.DomainController{{Type: "scsi", Index: ptr.To[uint](0), Model: "virtio-scsi"}}
+
+			attach("scsi", "oda", DiskBusSCSI)
+			Expect(executor.disks).To(HaveLen(1))
+			Expect(executor.controllers).To(BeEmpty())
+		})
+
+		It("should not process the requests of the controller in an iothread the domain doesn't have", func() {
+			domain.IOThreads = 0
+
+			attach("scsi", "oda", DiskBusSCSI)
+			Expect(executor.controllers).To(HaveLen(1))
+			Expect(executor.controllers[0].Driver).To(Equal(&libvirtxml.DomainControllerDriver{Queues: ptr.To[uint](2)}))
+		})
+	})
+})
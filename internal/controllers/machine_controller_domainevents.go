@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	machineEvent "github.com/ironcore-dev/libvirt-provider/internal/event/machineevent"
+	"github.com/ironcore-dev/libvirt-provider/internal/store"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+var watchdogActions = map[libvirt.DomainEventWatchdogAction]string{
+	libvirt.DomainEventWatchdogNone:      "none",
+	libvirt.DomainEventWatchdogPause:     "pause",
+	libvirt.DomainEventWatchdogReset:     "reset",
+	libvirt.DomainEventWatchdogPoweroff:  "poweroff",
+	libvirt.DomainEventWatchdogShutdown:  "shutdown",
+	libvirt.DomainEventWatchdogDebug:     "debug",
+	libvirt.DomainEventWatchdogInjectnmi: "inject-nmi",
+}
+
+var ioErrorActions = map[libvirt.DomainEventIOErrorAction]string{
+	libvirt.DomainEventIoErrorNone:   "none",
+	libvirt.DomainEventIoErrorPause:  "pause",
+	libvirt.DomainEventIoErrorReport: "report",
+}
+
+// domainEventMachine returns the machine of the domain an event is about, or nil if the domain is not managed.
+func (r *MachineReconciler) domainEventMachine(ctx context.Context, log logr.Logger, dom libvirt.Domain) *api.Machine {
+	machine, err := r.machines.Get(ctx, dom.Name)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			log.V(2).Info("Skipped: not managed by libvirt-provider", "machineID", dom.Name)
+			return nil
+		}
+		log.Error(err, "failed to fetch machine from store")
+		return nil
+	}
+	return machine
+}
+
+// handleDomainEvent records the domain event as machine event and enqueues the machine.
+func (r *MachineReconciler) handleDomainEvent(ctx context.Context, log logr.Logger, evt any) {
+	switch evt := evt.(type) {
+	case *libvirt.DomainEventCallbackRebootMsg:
+		machine := r.domainEventMachine(ctx, log, evt.Msg.Dom)
+		if machine == nil {
+			return
+		}
+		r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, machineEvent.ReasonRebooted, "Guest rebooted")
+		r.enqueue(machine.ID, queuePriorityUpdate)
+	case *libvirt.DomainEventCallbackWatchdogMsg:
+		machine := r.domainEventMachine(ctx, log, evt.Msg.Dom)
+		if machine == nil {
+			return
+		}
+		action := watchdogActions[libvirt.DomainEventWatchdogAction(evt.Msg.Action)]
+		r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, machineEvent.ReasonWatchdogFired, "Watchdog of the guest fired, action: %s", action)
+		r.enqueue(machine.ID, queuePriorityUpdate)
+	case *libvirt.DomainEventCallbackIOErrorReasonMsg:
+		machine := r.domainEventMachine(ctx, log, evt.Msg.Dom)
+		if machine == nil {
+			return
+		}
+		action := ioErrorActions[libvirt.DomainEventIOErrorAction(evt.Msg.Action)]
+		r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, machineEvent.ReasonDiskIOError, "I/O error on disk %s: %s, action: %s", evt.Msg.SrcPath, evt.Msg.Reason, action)
+		r.enqueue(machine.ID, queuePriorityUpdate)
+	default:
+		log.V(2).Info("Ignoring unsupported domain event", "Type", fmt.Sprintf("%T", evt))
+	}
+}
+
+// startEnqueueMachineByDomainEvents subscribes to reboot, watchdog and I/O error events of domains.
+// Lifecycle events are handled by startEnqueueMachineByLibvirtEvent. The subscriptions are renewed after the
+// connection to libvirt broke.
+func (r *MachineReconciler) startEnqueueMachineByDomainEvents(ctx context.Context, log logr.Logger) {
+	var wg sync.WaitGroup
+	for _, eventID := range []libvirt.DomainEventID{
+		libvirt.DomainEventIDReboot,
+		libvirt.DomainEventIDWatchdog,
+		libvirt.DomainEventIDIoErrorReason,
+	} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wait.UntilWithContext(ctx, func(ctx context.Context) {
+				if err := r.waitForLibvirt(ctx, log); err != nil {
+					return
+				}
+
+				events, err := r.libvirt.SubscribeEvents(ctx, eventID, nil)
+				if err != nil {
+					log.Error(err, "failed to subscribe to libvirt domain events", "eventID", eventID)
+					return
+				}
+
+				for {
+					select {
+					case evt, ok := <-events:
+						if !ok {
+							log.Info("Libvirt domain event channel closed, resubscribing", "eventID", eventID)
+							return
+						}
+						r.handleDomainEvent(ctx, log, evt)
+					case <-ctx.Done():
+						return
+					}
+				}
+			}, libvirtConnectionPollInterval)
+		}()
+	}
+	wg.Wait()
+}
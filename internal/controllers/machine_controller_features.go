@@ -0,0 +1,41 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"libvirt.org/go/libvirtxml"
+)
+
+// setDomainFeatures applies the feature profile of the machine class to the domain. The profile replaces the
+// features of the domain, except for acpi and apic which every domain keeps. It has to be applied after
+// setDomainClock: profiles without Hyper-V enlightenments keep the ones of the clock, profiles with them
+// replace them.
+func (r *MachineReconciler) setDomainFeatures(log logr.Logger, machine *api.Machine, domainDesc *libvirtxml.Domain) {
+	if r.featureProfiles == nil {
+		return
+	}
+	class, ok := api.GetClassLabel(machine)
+	if !ok {
+		return
+	}
+	name, features, ok := r.featureProfiles.ForMachineClass(class)
+	if !ok {
+		return
+	}
+
+	log.V(1).Info("Applying feature profile", "FeatureProfile", name)
+	domainFeatures := *features
+	if domainFeatures.ACPI == nil {
+		domainFeatures.ACPI = &libvirtxml.DomainFeature{}
+	}
+	if domainFeatures.APIC == nil {
+		domainFeatures.APIC = &libvirtxml.DomainFeatureAPIC{}
+	}
+	if domainFeatures.HyperV == nil && domainDesc.Features != nil {
+		domainFeatures.HyperV = domainDesc.Features.HyperV
+	}
+	domainDesc.Features = &domainFeatures
+}
@@ -0,0 +1,294 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// guestAgentTimeout is the time in seconds libvirt waits for responses of the guest agent.
+const guestAgentTimeout = 5
+
+// guestAgentCommand executes the command with the guest agent of the domain and decodes its return value into res.
+func (r *MachineReconciler) guestAgentCommand(domain libvirt.Domain, command string, res any) error {
+	out, err := r.libvirt.QEMUDomainAgentCommand(domain, fmt.Sprintf(`{"execute":%q}`, command), guestAgentTimeout, 0)
+	if err != nil {
+		return err
+	}
+	if len(out) == 0 {
+		return fmt.Errorf("guest agent returned no response to %s", command)
+	}
+
+	response := &struct {
+		Return json.RawMessage `json:"return"`
+	}{}
+	if err := json.Unmarshal([]byte(out[0]), response); err != nil {
+		return fmt.Errorf("error decoding response to %s: %w", command, err)
+	}
+	if res == nil {
+		return nil
+	}
+	if err := json.Unmarshal(response.Return, res); err != nil {
+		return fmt.Errorf("error decoding return value of %s: %w", command, err)
+	}
+	return nil
+}
+
+type guestAgentOSInfo struct {
+	PrettyName    string `json:"pretty-name"`
+	KernelRelease string `json:"kernel-release"`
+}
+
+type guestAgentNetworkInterface struct {
+	Name            string `json:"name"`
+	HardwareAddress string `json:"hardware-address"`
+	IPAddresses     []struct {
+		IPAddress string `json:"ip-address"`
+	} `json:"ip-addresses"`
+}
+
+// guestInfo queries the guest information reported in the machine status and the network interfaces of the guest.
+func (r *MachineReconciler) guestInfo(domain libvirt.Domain) (*api.GuestInfo, []guestAgentNetworkInterface, error) {
+	hostname := &struct {
+		HostName string `json:"host-name"`
+	}{}
+	if err := r.guestAgentCommand(domain, "guest-get-host-name", hostname); err != nil {
+		return nil, nil, err
+	}
+
+	osInfo := &guestAgentOSInfo{}
+	if err := r.guestAgentCommand(domain, "guest-get-osinfo", osInfo); err != nil {
+		return nil, nil, err
+	}
+
+	var interfaces []guestAgentNetworkInterface
+	if err := r.guestAgentCommand(domain, "guest-network-get-interfaces", &interfaces); err != nil {
+		return nil, nil, err
+	}
+
+	var ips []string
+	for _, iface := range interfaces {
+		if iface.Name == "lo" {
+			continue
+		}
+		for _, addr := range iface.IPAddresses {
+			ips = append(ips, addr.IPAddress)
+		}
+	}
+	slices.Sort(ips)
+
+	return &api.GuestInfo{
+		Hostname:      hostname.HostName,
+		OSName:        osInfo.PrettyName,
+		KernelRelease: osInfo.KernelRelease,
+		IPs:           ips,
+	}, interfaces, nil
+}
+
+// setGuestNetworkInterfaceIPs reports the IPs the guest configured on the network interfaces of the machine,
+// none for network interfaces the guest reports without IPs. Network interfaces are matched by their MAC
+// address, so host devices passed through to the guest keep the IPs reported by the network interface plugin.
+func (r *MachineReconciler) setGuestNetworkInterfaceIPs(machine *api.Machine, interfaces []guestAgentNetworkInterface) error {
+	domainDesc, err := r.getDomainDesc(machine)
+	if err != nil {
+		return fmt.Errorf("error getting domain description: %w", err)
+	}
+
+	nicNameByMAC := make(map[string]string)
+	for _, iface := range domainDescInterfaces(domainDesc) {
+		if iface.Alias == nil || !strings.HasPrefix(iface.Alias.Name, networkInterfaceAliasPrefix) || iface.MAC == nil {
+			continue
+		}
+
+		name, err := parseNetworkInterfaceAlias(iface.Alias.Name)
+		if err != nil {
+			return err
+		}
+		nicNameByMAC[strings.ToLower(iface.MAC.Address)] = name
+	}
+
+	ipsByNicName := make(map[string][]net.IP)
+	for _, iface := range interfaces {
+		name, ok := nicNameByMAC[strings.ToLower(iface.HardwareAddress)]
+		if !ok {
+			continue
+		}
+		if _, ok := ipsByNicName[name]; !ok {
+			ipsByNicName[name] = []net.IP{}
+		}
+		for _, addr := range iface.IPAddresses {
+			if ip := net.ParseIP(addr.IPAddress); ip != nil && !ip.IsLinkLocalUnicast() {
+				ipsByNicName[name] = append(ipsByNicName[name], ip)
+			}
+		}
+	}
+
+	for i := range machine.Status.NetworkInterfaceStatus {
+		nic := &machine.Status.NetworkInterfaceStatus[i]
+		if ips, ok := ipsByNicName[nic.Name]; ok {
+			nic.IPs = ips
+		}
+	}
+	return nil
+}
+
+// guestAgentProbe is the outcome of probing the guest agent of a machine.
+type guestAgentProbe struct {
+	// err is the error pinging the guest agent, nil if it responded.
+	err error
+	// infoErr is the error getting the guest info of the responding guest agent.
+	infoErr    error
+	info       *api.GuestInfo
+	interfaces []guestAgentNetworkInterface
+}
+
+// equal reports whether both probes observed the same guest agent status.
+func (p *guestAgentProbe) equal(other *guestAgentProbe) bool {
+	errString := func(err error) string {
+		if err == nil {
+			return ""
+		}
+		return err.Error()
+	}
+	return errString(p.err) == errString(other.err) &&
+		errString(p.infoErr) == errString(other.infoErr) &&
+		reflect.DeepEqual(p.info, other.info) &&
+		reflect.DeepEqual(p.interfaces, other.interfaces)
+}
+
+// probeGuestAgent pings the guest agent of the domain and gets the guest info if it responds.
+func (r *MachineReconciler) probeGuestAgent(domain libvirt.Domain) *guestAgentProbe {
+	if err := r.guestAgentCommand(domain, "guest-ping", nil); err != nil {
+		return &guestAgentProbe{err: err}
+	}
+	info, interfaces, err := r.guestInfo(domain)
+	return &guestAgentProbe{infoErr: err, info: info, interfaces: interfaces}
+}
+
+// probeGuestAgentInBackground probes the guest agent of the machine unless it is being probed already.
+// The machine is requeued if the guest agent status changed.
+func (r *MachineReconciler) probeGuestAgentInBackground(machine *api.Machine) {
+	r.guestAgentProbesMu.Lock()
+	defer r.guestAgentProbesMu.Unlock()
+	if r.probingGuestAgents.Has(machine.ID) {
+		return
+	}
+	r.probingGuestAgents.Insert(machine.ID)
+
+	id, domain := machine.ID, machineDomain(machine)
+	go func() {
+		probe := r.probeGuestAgent(domain)
+
+		r.guestAgentProbesMu.Lock()
+		r.probingGuestAgents.Delete(id)
+		last, ok := r.guestAgentProbes[id]
+		r.guestAgentProbes[id] = probe
+		r.guestAgentProbesMu.Unlock()
+
+		if !ok || !last.equal(probe) {
+			r.enqueue(id, queuePriorityResync)
+		}
+	}()
+}
+
+// lastGuestAgentProbe returns the last probe of the guest agent of the machine, nil if it wasn't probed yet.
+func (r *MachineReconciler) lastGuestAgentProbe(machineID string) *guestAgentProbe {
+	r.guestAgentProbesMu.Lock()
+	defer r.guestAgentProbesMu.Unlock()
+	return r.guestAgentProbes[machineID]
+}
+
+// forgetGuestAgentProbe forgets the last probe of the guest agent of the machine, e.g. as its domain stopped.
+func (r *MachineReconciler) forgetGuestAgentProbe(machineID string) {
+	r.guestAgentProbesMu.Lock()
+	defer r.guestAgentProbesMu.Unlock()
+	delete(r.guestAgentProbes, machineID)
+}
+
+// reconcileGuestAgentStatus updates the GuestAgentConnected condition and the guest info of a running machine
+// from the last probe of its guest agent. The guest agent is probed in the background if it wasn't yet.
+func (r *MachineReconciler) reconcileGuestAgentStatus(log logr.Logger, machine *api.Machine, state api.MachineState) {
+	if machine.Spec.GuestAgent == api.GuestAgentNone {
+		return
+	}
+
+	setConnected := func(status api.ConditionStatus, reason, message string) {
+		machine.Status.SetCondition(api.MachineCondition{
+			Type:               api.MachineConditionGuestAgentConnected,
+			Status:             status,
+			Reason:             reason,
+			Message:            message,
+			LastTransitionTime: time.Now(),
+		})
+	}
+
+	if state != api.MachineStateRunning {
+		r.forgetGuestAgentProbe(machine.ID)
+		machine.Status.GuestInfo = nil
+		setConnected(api.ConditionFalse, "MachineNotRunning", "")
+		return
+	}
+
+	probe := r.lastGuestAgentProbe(machine.ID)
+	if probe == nil {
+		r.probeGuestAgentInBackground(machine)
+		setConnected(api.ConditionUnknown, "Probing", "")
+		return
+	}
+
+	if probe.err != nil {
+		log.V(1).Info("Guest agent is not responding", "Error", probe.err)
+		machine.Status.GuestInfo = nil
+		setConnected(api.ConditionFalse, "NotResponding", probe.err.Error())
+		return
+	}
+
+	if probe.infoErr != nil {
+		// Guest agents may block single commands, so the agent is still considered connected.
+		log.V(1).Info("Failed to get guest info", "Error", probe.infoErr)
+		setConnected(api.ConditionTrue, "Connected", fmt.Sprintf("Failed to get guest info: %v", probe.infoErr))
+		return
+	}
+	machine.Status.GuestInfo = probe.info
+	if err := r.setGuestNetworkInterfaceIPs(machine, probe.interfaces); err != nil {
+		log.V(1).Info("Failed to set network interface IPs of guest", "Error", err)
+	}
+	setConnected(api.ConditionTrue, "Connected", "")
+}
+
+// startProbeGuestAgents periodically probes the guest agents of the running machines, which are requeued
+// if the status of their guest agent changed.
+func (r *MachineReconciler) startProbeGuestAgents(ctx context.Context, log logr.Logger) {
+	if r.guestAgentProbeInterval == 0 {
+		log.V(1).Info("guest agent probe loop is disabled")
+		return
+	}
+
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		machines, err := r.machines.List(ctx)
+		if err != nil {
+			log.Error(err, "failed to list machines")
+			return
+		}
+
+		for _, machine := range machines {
+			if machine.DeletedAt != nil || machine.Spec.GuestAgent == api.GuestAgentNone || machine.Status.State != api.MachineStateRunning {
+				continue
+			}
+			r.probeGuestAgentInBackground(machine)
+		}
+	}, r.guestAgentProbeInterval)
+}
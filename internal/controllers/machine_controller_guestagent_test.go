@@ -0,0 +1,153 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/pkg/libvirt/fake"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Guest agent", func() {
+	var env *testEnv
+
+	// haveGuestAgentConnected matches machines whose GuestAgentConnected condition has the status and reason.
+	haveGuestAgentConnected := func(status api.ConditionStatus, reason string) OmegaMatcher {
+		return WithTransform(func(machine *api.Machine) *api.MachineCondition {
+			return machine.Status.GetCondition(api.MachineConditionGuestAgentConnected)
+		}, And(Not(BeNil()), HaveField("Status", status), HaveField("Reason", reason)))
+	}
+
+	respond := func(id string) {
+		for command, response := range map[string]string{
+			"guest-ping":                   `{"return":{}}`,
+			"guest-get-host-name":          `{"return":{"host-name":"guest"}}`,
+			"guest-get-osinfo":             `{"return":{"pretty-name":"Debian GNU/Linux 12","kernel-release":"6.1.0"}}`,
+			"guest-network-get-interfaces": `{"return":[{"name":"lo","ip-addresses":[{"ip-address":"127.0.0.1"}]},{"name":"eth0","hardware-address":"52:54:00:00:00:01","ip-addresses":[{"ip-address":"10.0.0.2"}]}]}`,
+		} {
+			Expect(env.libvirt.SetGuestAgentResponse(id, command, response)).To(Succeed())
+		}
+	}
+
+	BeforeEach(func() {
+		env = setupTestEnv()
+		start(env.newReconciler(MachineReconcilerOptions{
+			StopTimeout:             time.Second,
+			GuestAgentProbeInterval: 100 * time.Millisecond,
+		}))
+	})
+
+	It("should report the guest agent status and guest info of running machines", func(ctx SpecContext) {
+		machine, err := env.machines.Create(ctx, newMachine())
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(machine.ID).Should(fake.HaveDomainState(env.libvirt, libvirt.DomainRunning))
+
+		By("reporting the guest agent not responding before it started")
+		Eventually(env.getMachine(machine.ID)).Should(SatisfyAll(
+			haveGuestAgentConnected(api.ConditionFalse, "NotResponding"),
+			HaveField("Status.GuestInfo", BeNil()),
+		))
+
+		By("reporting the guest info once the guest agent responds")
+		respond(machine.ID)
+		Eventually(env.getMachine(machine.ID)).Should(SatisfyAll(
+			haveGuestAgentConnected(api.ConditionTrue, "Connected"),
+			HaveField("Status.GuestInfo", Equal(&api.GuestInfo{
+				Hostname:      "guest",
+				OSName:        "Debian GNU/Linux 12",
+				KernelRelease: "6.1.0",
+				IPs:           []string{"10.0.0.2"},
+			})),
+		))
+
+		By("reporting the guest agent not connected once the machine is powered off")
+		machine, err = env.machines.Get(ctx, machine.ID)
+		Expect(err).NotTo(HaveOccurred())
+		machine.Spec.Power = api.PowerStatePowerOff
+		_, err = env.machines.Update(ctx, machine)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(env.getMachine(machine.ID)).Should(SatisfyAll(
+			haveGuestAgentConnected(api.ConditionFalse, "MachineNotRunning"),
+			HaveField("Status.GuestInfo", BeNil()),
+		))
+	})
+
+	It("should keep the guest agent connected if it fails to report the guest info", func(ctx SpecContext) {
+		machine, err := env.machines.Create(ctx, newMachine())
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(machine.ID).Should(fake.HaveDomainState(env.libvirt, libvirt.DomainRunning))
+
+		Expect(env.libvirt.SetGuestAgentResponse(machine.ID, "guest-ping", `{"return":{}}`)).To(Succeed())
+		Eventually(env.getMachine(machine.ID)).Should(SatisfyAll(
+			haveGuestAgentConnected(api.ConditionTrue, "Connected"),
+			HaveField("Status.Conditions", ContainElement(HaveField("Message", ContainSubstring("Failed to get guest info")))),
+		))
+	})
+
+	It("should not probe guest agents of machines without", func(ctx SpecContext) {
+		machine := newMachine()
+		machine.Spec.GuestAgent = api.GuestAgentNone
+		machine, err := env.machines.Create(ctx, machine)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(env.getMachine(machine.ID)).Should(HaveField("Status.State", api.MachineStateRunning))
+		Consistently(env.getMachine(machine.ID), 300*time.Millisecond).Should(
+			HaveField("Status.Conditions", Not(ContainElement(HaveField("Type", api.MachineConditionGuestAgentConnected)))),
+		)
+	})
+
+	It("should report the IPs the guest configured on the network interfaces of the machine", func(ctx SpecContext) {
+		machine := newMachine()
+		machine.Spec.NetworkInterfaces = []*api.NetworkInterfaceSpec{{Name: "nic-1"}, {Name: "nic-2"}}
+		machine, err := env.machines.Create(ctx, machine)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(machine.ID).Should(fake.HaveDomainState(env.libvirt, libvirt.DomainRunning))
+
+		macs := map[string]string{}
+		desc, _, _ := env.libvirt.Domain(machine.ID)
+		for _, iface := range desc.Devices.Interfaces {
+			Expect(iface.MAC).NotTo(BeNil())
+			macs[iface.Alias.Name] = iface.MAC.Address
+		}
+		Expect(macs).To(HaveLen(2))
+
+		Expect(env.libvirt.SetGuestAgentResponse(machine.ID, "guest-ping", `{"return":{}}`)).To(Succeed())
+		Expect(env.libvirt.SetGuestAgentResponse(machine.ID, "guest-get-host-name", `{"return":{"host-name":"guest"}}`)).To(Succeed())
+		Expect(env.libvirt.SetGuestAgentResponse(machine.ID, "guest-get-osinfo", `{"return":{}}`)).To(Succeed())
+		Expect(env.libvirt.SetGuestAgentResponse(machine.ID, "guest-network-get-interfaces", fmt.Sprintf(
+			`{"return":[{"name":"eth0","hardware-address":%q,"ip-addresses":[{"ip-address":"10.0.0.2"},{"ip-address":"fe80::1"}]},{"name":"eth1","hardware-address":%q}]}`,
+			strings.ToUpper(macs[networkInterfaceAlias("nic-1")]), macs[networkInterfaceAlias("nic-2")],
+		))).To(Succeed())
+
+		nicIPs := func(machine *api.Machine) map[string][]net.IP {
+			ips := map[string][]net.IP{}
+			for _, nic := range machine.Status.NetworkInterfaceStatus {
+				ips[nic.Name] = nic.IPs
+			}
+			return ips
+		}
+
+		By("reporting the IPs of the guest, none for network interfaces without")
+		Eventually(env.getMachine(machine.ID)).Should(WithTransform(nicIPs, Equal(map[string][]net.IP{
+			"nic-1": {net.ParseIP("10.0.0.2")},
+			"nic-2": {},
+		})))
+
+		By("clearing the IPs of the guest once its guest agent stops responding")
+		env.libvirt.SetError("QEMUDomainAgentCommand", errors.New("guest agent is not connected"))
+		Eventually(env.getMachine(machine.ID)).Should(SatisfyAll(
+			haveGuestAgentConnected(api.ConditionFalse, "NotResponding"),
+			WithTransform(nicIPs, Equal(map[string][]net.IP{"nic-1": nil, "nic-2": nil})),
+		))
+	})
+})
@@ -0,0 +1,233 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	machineEvent "github.com/ironcore-dev/libvirt-provider/internal/event/machineevent"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+	"libvirt.org/go/libvirtxml"
+)
+
+// HotplugOptions configure the headroom domains are created with, so the vCPUs and memory of running
+// machines can grow when their machine class changes.
+type HotplugOptions struct {
+	// MaxVCPUs is the number of vCPUs domains can grow to. If zero, vCPUs are not hot plugged.
+	MaxVCPUs uint
+	// MaxMemoryBytes is the memory domains can grow to. If zero, memory is not hot plugged.
+	MaxMemoryBytes int64
+	// MemorySlots is the number of memory DIMMs that can be hot plugged into a domain.
+	MemorySlots uint
+}
+
+func (o HotplugOptions) validate() error {
+	if o.MaxMemoryBytes < 0 {
+		return fmt.Errorf("max hotplug memory must not be negative")
+	}
+	if o.MaxMemoryBytes > 0 && o.MemorySlots == 0 {
+		return fmt.Errorf("must specify memory slots to hot plug memory")
+	}
+	return nil
+}
+
+// memoryUnits are the multipliers of the memory units used by libvirt.
+var memoryUnits = map[string]int64{
+	"b":     1,
+	"bytes": 1,
+	"Byte":  1,
+	"":      1 << 10,
+	"k":     1 << 10,
+	"KiB":   1 << 10,
+	"M":     1 << 20,
+	"MiB":   1 << 20,
+	"G":     1 << 30,
+	"GiB":   1 << 30,
+	"T":     1 << 40,
+	"TiB":   1 << 40,
+}
+
+// memoryBytes converts the memory value in the libvirt unit to bytes.
+func memoryBytes(value uint, unit string) (int64, error) {
+	multiplier, ok := memoryUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("unsupported memory unit %q", unit)
+	}
+	return int64(value) * multiplier, nil
+}
+
+// setDomainHotplug creates the domain with the vCPUs and memory of the machine plugged and the headroom of
+// the hotplug options, so both can be hot plugged up to their maximum.
+func (r *MachineReconciler) setDomainHotplug(machine *api.Machine, domain *libvirtxml.Domain) {
+	if vcpus := domain.VCPU.Value; r.hotplug.MaxVCPUs > vcpus {
+		domain.VCPU.Current = vcpus
+		domain.VCPU.Value = r.hotplug.MaxVCPUs
+	}
+
+	if r.hotplug.MaxMemoryBytes <= machine.Spec.MemoryBytes {
+		return
+	}
+	domain.MaximumMemory = &libvirtxml.DomainMaxMemory{
+		Value: uint(r.hotplug.MaxMemoryBytes),
+		Unit:  "Byte",
+		Slots: r.hotplug.MemorySlots,
+	}
+	// Memory DIMMs are plugged into a NUMA node, hence the guest needs at least one.
+	domain.CPU.Numa = &libvirtxml.DomainNuma{
+		Cell: []libvirtxml.DomainCell{{
+			ID:     ptr.To[uint](0),
+			CPUs:   fmt.Sprintf("0-%d", domain.VCPU.Value-1),
+			Memory: uint(machine.Spec.MemoryBytes),
+			Unit:   "Byte",
+		}},
+	}
+}
+
+// reconcileDomainResources hot plugs the vCPUs and memory of a running domain to match its machine, e.g. after
+// a machine class change. Changes exceeding the headroom of the domain are reported by the ResizePending
+// condition and applied when the domain is created the next time.
+func (r *MachineReconciler) reconcileDomainResources(log logr.Logger, machine *api.Machine, domainDesc *libvirtxml.Domain) error {
+	var pending []string
+
+	vcpus, err := r.reconcileDomainVCPUs(log, machine, domainDesc)
+	if err != nil {
+		return err
+	}
+	if vcpus != "" {
+		pending = append(pending, vcpus)
+	}
+
+	memory, err := r.reconcileDomainMemory(log, machine, domainDesc)
+	if err != nil {
+		return err
+	}
+	if memory != "" {
+		pending = append(pending, memory)
+	}
+
+	r.setResizePending(log, machine, strings.Join(pending, ", "))
+	return nil
+}
+
+// reconcileDomainVCPUs sets the current vCPUs of the domain. It returns why the vCPUs can't be set, if so.
+func (r *MachineReconciler) reconcileDomainVCPUs(log logr.Logger, machine *api.Machine, domainDesc *libvirtxml.Domain) (string, error) {
+	if domainDesc.VCPU == nil {
+		return "", nil
+	}
+
+	desired := uint(machine.Spec.CpuMillis / 1000)
+	current := domainDesc.VCPU.Current
+	if current == 0 {
+		current = domainDesc.VCPU.Value
+	}
+	if desired == current {
+		return "", nil
+	}
+	if desired > domainDesc.VCPU.Value {
+		return fmt.Sprintf("%d vCPUs exceed the maximum of %d vCPUs", desired, domainDesc.VCPU.Value), nil
+	}
+
+	log.V(1).Info("Setting vCPUs of domain", "Current", current, "Desired", desired)
+	domain := machineDomain(machine)
+	if err := r.libvirt.DomainSetVcpusFlags(domain, uint32(desired), uint32(libvirt.DomainVCPULive)); err != nil {
+		return "", fmt.Errorf("error setting vcpus of domain: %w", err)
+	}
+
+	if quotaMillis := r.cpuQuotaMillis(machine); quotaMillis > 0 {
+		if err := r.libvirt.DomainSetSchedulerParametersFlags(domain, []libvirt.TypedParam{{
+			Field: libvirt.DomainSchedulerGlobalQuota,
+			Value: *libvirt.NewTypedParamValueLlong(cpuQuota(quotaMillis, r.cpuQuotaPeriod)),
+		}}, uint32(libvirt.DomainAffectLive)); err != nil {
+			return "", fmt.Errorf("error setting cpu quota of domain: %w", err)
+		}
+	}
+
+	r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, machineEvent.ReasonHotpluggedVCPUs, "Changed vCPUs from %d to %d", current, desired)
+	return "", nil
+}
+
+// reconcileDomainMemory grows the memory of the domain by hot plugging a DIMM. It returns why the memory
+// can't be set, if so.
+func (r *MachineReconciler) reconcileDomainMemory(log logr.Logger, machine *api.Machine, domainDesc *libvirtxml.Domain) (string, error) {
+	if domainDesc.Memory == nil {
+		return "", nil
+	}
+
+	current, err := memoryBytes(domainDesc.Memory.Value, domainDesc.Memory.Unit)
+	if err != nil {
+		return "", err
+	}
+	desired := machine.Spec.MemoryBytes
+	switch {
+	case desired == current:
+		return "", nil
+	case desired < current:
+		return "memory can't be reduced while running", nil
+	}
+
+	var maxMemory int64
+	if domainDesc.MaximumMemory != nil {
+		if maxMemory, err = memoryBytes(domainDesc.MaximumMemory.Value, domainDesc.MaximumMemory.Unit); err != nil {
+			return "", err
+		}
+	}
+	if desired > maxMemory {
+		return fmt.Sprintf("%d bytes of memory exceed the maximum of %d bytes", desired, maxMemory), nil
+	}
+	if domainDesc.Devices != nil && uint(len(domainDesc.Devices.Memorydevs)) >= domainDesc.MaximumMemory.Slots {
+		return "no free memory slot", nil
+	}
+
+	dimm := libvirtxml.DomainMemorydev{
+		Model: "dimm",
+		Target: &libvirtxml.DomainMemorydevTarget{
+			Size: &libvirtxml.DomainMemorydevTargetSize{Value: uint(desired - current), Unit: "Byte"},
+			Node: &libvirtxml.DomainMemorydevTargetNode{Value: 0},
+		},
+	}
+	dimmXML, err := dimm.Marshal()
+	if err != nil {
+		return "", err
+	}
+
+	log.V(1).Info("Hot plugging memory into domain", "Current", current, "Desired", desired)
+	if err := r.libvirt.DomainAttachDevice(machineDomain(machine), dimmXML); err != nil {
+		return "", fmt.Errorf("error hot plugging memory: %w", err)
+	}
+	r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, machineEvent.ReasonHotpluggedMemory, "Changed memory from %d to %d bytes", current, desired)
+	return "", nil
+}
+
+// setResizePending sets the ResizePending condition, which is true if message is not empty.
+func (r *MachineReconciler) setResizePending(log logr.Logger, machine *api.Machine, message string) {
+	condition := machine.Status.GetCondition(api.MachineConditionResizePending)
+	if message == "" {
+		if condition != nil {
+			machine.Status.SetCondition(api.MachineCondition{
+				Type:               api.MachineConditionResizePending,
+				Status:             api.ConditionFalse,
+				Reason:             "Resized",
+				LastTransitionTime: time.Now(),
+			})
+		}
+		return
+	}
+
+	if condition == nil || condition.Status != api.ConditionTrue || condition.Message != message {
+		r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, machineEvent.ReasonResizePending, "Resources are applied on the next power on: %s", message)
+	}
+	machine.Status.SetCondition(api.MachineCondition{
+		Type:               api.MachineConditionResizePending,
+		Status:             api.ConditionTrue,
+		Reason:             "Infeasible",
+		Message:            message,
+		LastTransitionTime: time.Now(),
+	})
+}
@@ -0,0 +1,127 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/hugepages"
+	"k8s.io/utils/cpuset"
+	"k8s.io/utils/ptr"
+	"libvirt.org/go/libvirtxml"
+)
+
+// IOThreadOptions configure the iothreads QEMU processes the disk requests of machines in.
+type IOThreadOptions struct {
+	// DisksPerIOThread is the number of disks sharing an iothread. If zero, no iothreads are allocated.
+	DisksPerIOThread uint
+	// MaxIOThreads limits the number of iothreads per machine. If zero, the number is unlimited.
+	MaxIOThreads uint
+	// CPUSet is the set of host cpus the iothreads are pinned to, e.g. 0-3,8. If empty, iothreads are not pinned.
+	CPUSet string
+}
+
+func (o IOThreadOptions) validate() error {
+	if o.CPUSet == "" {
+		return nil
+	}
+	if _, err := cpuset.Parse(o.CPUSet); err != nil {
+		return fmt.Errorf("invalid iothread cpu set %q: %w", o.CPUSet, err)
+	}
+	return nil
+}
+
+// ioThreadCount returns the number of iothreads of a machine with the given number of disks. The number
+// requested by the machine class, if any, takes precedence over the disks.
+func (o IOThreadOptions) ioThreadCount(requested uint, disks int) uint {
+	count := requested
+	if count == 0 {
+		if o.DisksPerIOThread == 0 || disks == 0 {
+			return 0
+		}
+		count = (uint(disks) + o.DisksPerIOThread - 1) / o.DisksPerIOThread
+	}
+	if o.MaxIOThreads > 0 {
+		count = min(count, o.MaxIOThreads)
+	}
+	return count
+}
+
+// setDomainIOThreads allocates the iothreads of the machine, as many as requested by its machine class or
+// one per DisksPerIOThread disks including the root disk, and pins them to the host cpus of ioThreadCPUSet.
+func (r *MachineReconciler) setDomainIOThreads(machine *api.Machine, domain *libvirtxml.Domain) {
+	disks := len(machine.Spec.Volumes)
+	if machine.Spec.Image != nil {
+		disks++
+	}
+
+	count := r.ioThreads.ioThreadCount(machine.Spec.IOThreads, disks)
+	if count == 0 {
+		return
+	}
+
+	domain.IOThreads = count
+	domain.IOThreadIDs = &libvirtxml.DomainIOThreadIDs{}
+	for id := uint(1); id <= count; id++ {
+		domain.IOThreadIDs.IOThreads = append(domain.IOThreadIDs.IOThreads, libvirtxml.DomainIOThread{ID: id})
+	}
+
+	cpus := r.ioThreadCPUSet(machine)
+	if cpus == "" {
+		return
+	}
+	if domain.CPUTune == nil {
+		domain.CPUTune = &libvirtxml.DomainCPUTune{}
+	}
+	for id := uint(1); id <= count; id++ {
+		domain.CPUTune.IOThreadPin = append(domain.CPUTune.IOThreadPin, libvirtxml.DomainCPUTuneIOThreadPin{
+			IOThread: id,
+			CPUSet:   cpus,
+		})
+	}
+}
+
+// ioThreadCPUSet returns the host cpus the iothreads of the machine are pinned to, empty if they are not pinned.
+// The iothreads of machines bound to a NUMA node stay on the cpus of the node next to their memory, restricted
+// to the iothread cpu set if it overlaps the node.
+func (r *MachineReconciler) ioThreadCPUSet(machine *api.Machine) string {
+	var node *hugepages.Node
+	if machine.Spec.NUMANode != nil && r.hugepages != nil {
+		if n, ok := r.hugepages.Node(*machine.Spec.NUMANode); ok {
+			node = &n
+		}
+	}
+
+	if node == nil {
+		return r.ioThreads.CPUSet
+	}
+	if r.ioThreads.CPUSet == "" {
+		return node.CPUs.String()
+	}
+
+	// The cpu set was validated with the options.
+	cpus, err := cpuset.Parse(r.ioThreads.CPUSet)
+	if err != nil {
+		return r.ioThreads.CPUSet
+	}
+	if onNode := cpus.Intersection(node.CPUs); !onNode.IsEmpty() {
+		return onNode.String()
+	}
+	return node.CPUs.String()
+}
+
+// assignDiskIOThread assigns the virtio-blk disk to one of the iothreads of the domain in round robin.
+// Disks on the scsi bus are processed in the iothread of their controller.
+func assignDiskIOThread(domain *libvirtxml.Domain, disk *libvirtxml.DomainDisk) {
+	if domain.IOThreads == 0 || disk.Driver == nil || disk.Target == nil || disk.Target.Bus != string(DiskBusVirtio) {
+		return
+	}
+
+	var disks uint
+	if domain.Devices != nil {
+		disks = uint(len(domain.Devices.Disks))
+	}
+	disk.Driver.IOThread = ptr.To(disks%domain.IOThreads + 1)
+}
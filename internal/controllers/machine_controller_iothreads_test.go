@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/hugepages"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/cpuset"
+	"k8s.io/utils/ptr"
+	"libvirt.org/go/libvirtxml"
+)
+
+var _ = Describe("IOThreads", func() {
+	DescribeTable("counting the iothreads of a machine",
+		func(opts IOThreadOptions, requested uint, disks int, expected uint) {
+			Expect(opts.ioThreadCount(requested, disks)).To(Equal(expected))
+		},
+		Entry("disabled", IOThreadOptions{}, uint(0), 4, uint(0)),
+		Entry("no disks", IOThreadOptions{DisksPerIOThread: 2}, uint(0), 0, uint(0)),
+		Entry("one per disk", IOThreadOptions{DisksPerIOThread: 1}, uint(0), 3, uint(3)),
+		Entry("rounding up the shared iothreads", IOThreadOptions{DisksPerIOThread: 2}, uint(0), 3, uint(2)),
+		Entry("limited", IOThreadOptions{DisksPerIOThread: 1, MaxIOThreads: 2}, uint(0), 3, uint(2)),
+		Entry("requested by the machine class", IOThreadOptions{DisksPerIOThread: 1}, uint(4), 1, uint(4)),
+		Entry("requested by the machine class while disabled", IOThreadOptions{}, uint(2), 0, uint(2)),
+		Entry("requested by the machine class limited", IOThreadOptions{MaxIOThreads: 2}, uint(4), 1, uint(2)),
+	)
+
+	Describe("pinning the iothreads", func() {
+		nodes := hugepages.NewSource([]hugepages.Node{
+			{ID: 0, CPUs: cpuset.New(0, 1, 2, 3)},
+			{ID: 1, CPUs: cpuset.New(4, 5, 6, 7)},
+		})
+
+		pins := func(r *MachineReconciler, numaNode *int) []libvirtxml.DomainCPUTuneIOThreadPin {
+			machine := &api.Machine{Spec: api.MachineSpec{
+				Volumes:   []*api.VolumeSpec{{Name: "disk"}},
+				NUMANode:  numaNode,
+				IOThreads: 2,
+			}}
+			domain := &libvirtxml.Domain{}
+			r.setDomainIOThreads(machine, domain)
+			Expect(domain.IOThreads).To(Equal(uint(2)))
+			Expect(domain.IOThreadIDs.IOThreads).To(Equal([]libvirtxml.DomainIOThread{{ID: 1}, {ID: 2}}))
+			if domain.CPUTune == nil {
+				return nil
+			}
+			return domain.CPUTune.IOThreadPin
+		}
+
+		DescribeTable("on host cpus",
+			func(cpuSet string, numaNode *int, expected string) {
+				r := &MachineReconciler{ioThreads: IOThreadOptions{CPUSet: cpuSet}, hugepages: nodes}
+				if expected == "" {
+					Expect(pins(r, numaNode)).To(BeEmpty())
+					return
+				}
+				Expect(pins(r, numaNode)).To(Equal([]libvirtxml.DomainCPUTuneIOThreadPin{
+					{IOThread: 1, CPUSet: expected},
+					{IOThread: 2, CPUSet: expected},
+				}))
+			},
+			Entry("not pinned", "", nil, ""),
+			Entry("the iothread cpu set", "0,4", nil, "0,4"),
+			Entry("the cpus of the numa node", "", ptr.To(1), "4-7"),
+			Entry("the iothread cpus on the numa node", "0,4", ptr.To(1), "4"),
+			Entry("the cpus of the numa node the iothread cpu set doesn't overlap", "0-1", ptr.To(1), "4-7"),
+			Entry("the iothread cpu set for unknown numa nodes", "0,4", ptr.To(2), "0,4"),
+		)
+	})
+})
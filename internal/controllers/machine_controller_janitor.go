@@ -0,0 +1,136 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/internal/qcow2"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// leftoverMinAge is the age leftovers need to have to be removed. It keeps the janitor from racing with
+// machines and root fs bases that are just being created.
+const leftoverMinAge = 10 * time.Minute
+
+// removeLeftovers removes the artifacts of machines that are gone: machine directories without machine and
+// domain, and root fs bases no root disk overlay is backed by. Tap devices are owned by libvirt and ceph
+// volumes are accessed via librbd, so neither can leak.
+func (r *MachineReconciler) removeLeftovers(ctx context.Context, log logr.Logger) error {
+	machines, err := r.machines.List(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing machines: %w", err)
+	}
+	domains, _, err := r.libvirt.ConnectListAllDomains(1, 0)
+	if err != nil {
+		return fmt.Errorf("error listing domains: %w", err)
+	}
+
+	// Domains are named after the ID of their machine, orphaned ones are left to the orphaned domain audit.
+	ids := sets.New[string]()
+	for _, machine := range machines {
+		ids.Insert(machine.ID)
+	}
+	for _, domain := range domains {
+		ids.Insert(domain.Name)
+	}
+
+	if err := r.removeLeftoverMachineDirs(log, ids); err != nil {
+		return err
+	}
+	return r.removeLeftoverRootFSBases(log)
+}
+
+func (r *MachineReconciler) removeLeftoverMachineDirs(log logr.Logger, ids sets.Set[string]) error {
+	entries, err := os.ReadDir(r.host.MachinesDir())
+	if err != nil {
+		return fmt.Errorf("error reading machines directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || ids.Has(entry.Name()) || !isLeftover(entry) {
+			continue
+		}
+
+		log.V(1).Info("Removing leftover machine directory", "MachineID", entry.Name())
+		if err := os.RemoveAll(r.host.MachineDir(entry.Name())); err != nil {
+			log.Error(err, "Failed to remove leftover machine directory", "MachineID", entry.Name())
+			continue
+		}
+		leftoversRemoved.WithLabelValues(leftoverKindMachineDirectory).Inc()
+	}
+	return nil
+}
+
+// removeLeftoverRootFSBases removes the root fs bases, including the partial ones of interrupted conversions,
+// that no root disk overlay of a machine directory is backed by and that don't belong to a warm image.
+func (r *MachineReconciler) removeLeftoverRootFSBases(log logr.Logger) error {
+	if r.qcow2 == nil {
+		return nil
+	}
+
+	r.rootFSBasesMu.Lock()
+	defer r.rootFSBasesMu.Unlock()
+
+	entries, err := os.ReadDir(r.host.RootFSBasesDir())
+	if err != nil {
+		return fmt.Errorf("error reading root fs bases directory: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	machineEntries, err := os.ReadDir(r.host.MachinesDir())
+	if err != nil {
+		return fmt.Errorf("error reading machines directory: %w", err)
+	}
+	backingFiles := sets.New[string]()
+	for _, machineEntry := range machineEntries {
+		rootFSFile := r.host.MachineRootFSFile(machineEntry.Name())
+		ok, err := qcow2.IsQCow2(rootFSFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			// Keep all bases rather than removing one that is still in use.
+			return fmt.Errorf("error checking root disk of machine %s: %w", machineEntry.Name(), err)
+		}
+		if !ok {
+			continue
+		}
+		backingFile, err := r.qcow2.BackingFile(rootFSFile)
+		if err != nil {
+			return fmt.Errorf("error getting backing file of root disk of machine %s: %w", machineEntry.Name(), err)
+		}
+		backingFiles.Insert(filepath.Base(backingFile))
+	}
+
+	for _, entry := range entries {
+		if backingFiles.Has(entry.Name()) || !isLeftover(entry) {
+			continue
+		}
+		// Partial bases of running conversions are not leftovers, even if the conversion queues for long.
+		baseName := strings.TrimSuffix(entry.Name(), ".tmp")
+		if r.rootFSConverter.Active(filepath.Join(r.host.RootFSBasesDir(), baseName)) || r.isWarmRootFSBase(baseName) {
+			continue
+		}
+
+		log.V(1).Info("Removing leftover root fs base", "Base", entry.Name())
+		if err := os.Remove(filepath.Join(r.host.RootFSBasesDir(), entry.Name())); err != nil {
+			log.Error(err, "Failed to remove leftover root fs base", "Base", entry.Name())
+			continue
+		}
+		leftoversRemoved.WithLabelValues(leftoverKindRootFSBase).Inc()
+	}
+	return nil
+}
+
+func isLeftover(entry os.DirEntry) bool {
+	info, err := entry.Info()
+	return err == nil && time.Since(info.ModTime()) > leftoverMinAge
+}
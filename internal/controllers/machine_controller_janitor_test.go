@@ -0,0 +1,134 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	providerhost "github.com/ironcore-dev/libvirt-provider/internal/host"
+	"github.com/ironcore-dev/libvirt-provider/internal/qcow2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"libvirt.org/go/libvirtxml"
+)
+
+// backingFiles is a qcow2.QCow2 reporting the backing files of disks only.
+type backingFiles map[string]string
+
+func (b backingFiles) Create(string, ...qcow2.CreateOption) error {
+	return fmt.Errorf("not implemented")
+}
+
+func (b backingFiles) Check(string, ...qcow2.CheckOption) (*qcow2.CheckResult, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (b backingFiles) Convert(context.Context, string, string, func(int)) error {
+	return fmt.Errorf("not implemented")
+}
+
+func (b backingFiles) BackingFile(filename string) (string, error) {
+	return b[filename], nil
+}
+
+func (b backingFiles) Flatten(string) error {
+	return fmt.Errorf("not implemented")
+}
+
+var _ = Describe("Janitor", func() {
+	var (
+		env   *testEnv
+		disks backingFiles
+		r     *MachineReconciler
+	)
+
+	BeforeEach(func() {
+		env = setupTestEnv()
+		disks = backingFiles{}
+		r = env.newReconciler(MachineReconcilerOptions{QCow2: disks})
+	})
+
+	age := func(path string) {
+		GinkgoHelper()
+		old := time.Now().Add(-2 * leftoverMinAge)
+		Expect(os.Chtimes(path, old, old)).To(Succeed())
+	}
+
+	makeMachineDir := func(old bool) string {
+		GinkgoHelper()
+		id := uuid.NewString()
+		Expect(providerhost.MakeMachineDirs(env.host, id)).To(Succeed())
+		if old {
+			age(env.host.MachineDir(id))
+		}
+		return id
+	}
+
+	makeBase := func(name string) string {
+		GinkgoHelper()
+		file := filepath.Join(env.host.RootFSBasesDir(), name)
+		Expect(os.WriteFile(file, qcow2.Magic, 0600)).To(Succeed())
+		age(file)
+		return file
+	}
+
+	makeOverlay := func(machineID, baseFile string) {
+		GinkgoHelper()
+		file := env.host.MachineRootFSFile(machineID)
+		Expect(os.WriteFile(file, qcow2.Magic, 0600)).To(Succeed())
+		disks[file] = baseFile
+	}
+
+	It("should remove old machine directories only", func(ctx SpecContext) {
+		leftover := makeMachineDir(true)
+		young := makeMachineDir(false)
+
+		Expect(r.removeLeftovers(ctx, GinkgoLogr)).To(Succeed())
+		Expect(env.host.MachineDir(leftover)).NotTo(BeAnExistingFile())
+		Expect(env.host.MachineDir(young)).To(BeADirectory())
+	})
+
+	It("should keep the directories of stored machines and existing domains", func(ctx SpecContext) {
+		machine := newMachine()
+		_, err := env.machines.Create(ctx, machine)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(providerhost.MakeMachineDirs(env.host, machine.ID)).To(Succeed())
+		age(env.host.MachineDir(machine.ID))
+
+		domainID := makeMachineDir(true)
+		domainXML, err := (&libvirtxml.Domain{Name: domainID, UUID: domainID, Type: "kvm"}).Marshal()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = env.libvirt.DomainDefineXMLFlags(domainXML, 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(r.removeLeftovers(ctx, GinkgoLogr)).To(Succeed())
+		Expect(env.host.MachineDir(machine.ID)).To(BeADirectory())
+		Expect(env.host.MachineDir(domainID)).To(BeADirectory())
+	})
+
+	It("should keep the root fs bases overlays are backed by", func(ctx SpecContext) {
+		usedBase := makeBase("used")
+		unusedBase := makeBase("unused")
+		makeOverlay(makeMachineDir(false), usedBase)
+
+		Expect(r.removeLeftovers(ctx, GinkgoLogr)).To(Succeed())
+		Expect(usedBase).To(BeARegularFile())
+		Expect(unusedBase).NotTo(BeAnExistingFile())
+	})
+
+	It("should keep all root fs bases if a root disk can't be checked", func(ctx SpecContext) {
+		base := makeBase("unused")
+		machineID := makeMachineDir(false)
+		By("making the root disk unreadable")
+		Expect(os.Mkdir(env.host.MachineRootFSFile(machineID), 0700)).To(Succeed())
+
+		Expect(r.removeLeftovers(ctx, GinkgoLogr)).To(MatchError(ContainSubstring("error checking root disk")))
+		Expect(base).To(BeARegularFile())
+	})
+})
@@ -0,0 +1,154 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	machineEvent "github.com/ironcore-dev/libvirt-provider/internal/event/machineevent"
+	corev1 "k8s.io/api/core/v1"
+	"libvirt.org/go/libvirtxml"
+)
+
+const mdevDeviceAliasPrefix = "ua-mdev-"
+
+// mdevDeviceHostdev returns the hostdev passing the mediated device instance with the given UUID through.
+func mdevDeviceHostdev(uuid string) *libvirtxml.DomainHostdev {
+	return &libvirtxml.DomainHostdev{
+		Alias: &libvirtxml.DomainAlias{
+			Name: mdevDeviceAliasPrefix + uuid,
+		},
+		SubsysMDev: &libvirtxml.DomainHostdevSubsysMDev{
+			Model: "vfio-pci",
+			Source: &libvirtxml.DomainHostdevSubsysMDevSource{
+				Address: &libvirtxml.DomainAddressMDev{
+					UUID: uuid,
+				},
+			},
+		},
+	}
+}
+
+// domainMdevDevices returns the mediated device hostdevs of the domain by UUID.
+func domainMdevDevices(domainDesc *libvirtxml.Domain) map[string]libvirtxml.DomainHostdev {
+	hostdevs := make(map[string]libvirtxml.DomainHostdev)
+	for _, hostdev := range domainDescHostDevices(domainDesc) {
+		if hostdev.Alias == nil || !strings.HasPrefix(hostdev.Alias.Name, mdevDeviceAliasPrefix) ||
+			hostdev.SubsysMDev == nil || hostdev.SubsysMDev.Source == nil || hostdev.SubsysMDev.Source.Address == nil {
+			continue
+		}
+		hostdevs[hostdev.SubsysMDev.Source.Address.UUID] = hostdev
+	}
+	return hostdevs
+}
+
+// createMdevDevice creates the instance of the device and records it in the status of the machine.
+func (r *MachineReconciler) createMdevDevice(machine *api.Machine, device api.MdevDeviceSpec) error {
+	if r.mdevDevices == nil {
+		return fmt.Errorf("no mdev devices configured")
+	}
+	if err := r.mdevDevices.Create(device); err != nil {
+		return err
+	}
+	if !slices.Contains(machine.Status.MdevDevices, device) {
+		machine.Status.MdevDevices = append(machine.Status.MdevDevices, device)
+	}
+	return nil
+}
+
+// removeMdevDevice removes the instance of the device and its record from the status of the machine.
+func (r *MachineReconciler) removeMdevDevice(machine *api.Machine, device api.MdevDeviceSpec) error {
+	if r.mdevDevices != nil {
+		if err := r.mdevDevices.Remove(device); err != nil {
+			return err
+		}
+	}
+	machine.Status.MdevDevices = slices.DeleteFunc(machine.Status.MdevDevices, func(created api.MdevDeviceSpec) bool {
+		return created.UUID == device.UUID
+	})
+	return nil
+}
+
+// removeStaleMdevDevices removes the instances of the machine no longer in its spec and not attached.
+func (r *MachineReconciler) removeStaleMdevDevices(machine *api.Machine, attached map[string]libvirtxml.DomainHostdev) error {
+	for _, device := range slices.Clone(machine.Status.MdevDevices) {
+		if _, ok := attached[device.UUID]; ok || slices.Contains(machine.Spec.MdevDevices, device) {
+			continue
+		}
+		if err := r.removeMdevDevice(machine, device); err != nil {
+			return fmt.Errorf("[mdev device %s] %w", device.UUID, err)
+		}
+	}
+	return nil
+}
+
+// setDomainMdevDevices creates the mediated device instances of the machine and passes them through to a new
+// domain. Instances no longer in the spec are removed, as no domain uses them anymore.
+func (r *MachineReconciler) setDomainMdevDevices(machine *api.Machine, domainDesc *libvirtxml.Domain) error {
+	if err := r.removeStaleMdevDevices(machine, nil); err != nil {
+		return err
+	}
+
+	for _, device := range machine.Spec.MdevDevices {
+		if err := r.createMdevDevice(machine, device); err != nil {
+			return fmt.Errorf("[mdev device %s] %w", device.UUID, err)
+		}
+		addDomainHostdev(domainDesc, *mdevDeviceHostdev(device.UUID))
+	}
+	return nil
+}
+
+// reconcileDomainMdevDevices hot plugs the mediated devices of the machine into its running domain, creating
+// their instances first, and unplugs the devices no longer in its spec, removing their instances afterwards.
+func (r *MachineReconciler) reconcileDomainMdevDevices(log logr.Logger, machine *api.Machine, domainDesc *libvirtxml.Domain, executor DomainExecutor) error {
+	attached := domainMdevDevices(domainDesc)
+
+	for _, device := range slices.Clone(machine.Status.MdevDevices) {
+		if slices.Contains(machine.Spec.MdevDevices, device) {
+			continue
+		}
+
+		if hostdev, ok := attached[device.UUID]; ok {
+			log.V(1).Info("Detaching mdev device", "UUID", device.UUID)
+			if err := executor.DetachHostdev(&hostdev); err != nil {
+				return fmt.Errorf("[mdev device %s] error detaching: %w", device.UUID, err)
+			}
+			delete(attached, device.UUID)
+			r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, machineEvent.ReasonDetachedMdevDevice, "Detached mdev device %s", device.UUID)
+		}
+	}
+	if err := r.removeStaleMdevDevices(machine, attached); err != nil {
+		return err
+	}
+
+	for _, device := range machine.Spec.MdevDevices {
+		if _, ok := attached[device.UUID]; ok {
+			continue
+		}
+
+		if err := r.createMdevDevice(machine, device); err != nil {
+			return fmt.Errorf("[mdev device %s] %w", device.UUID, err)
+		}
+		log.V(1).Info("Attaching mdev device", "Resource", device.Resource, "UUID", device.UUID)
+		if err := executor.AttachHostdev(mdevDeviceHostdev(device.UUID)); err != nil {
+			return fmt.Errorf("[mdev device %s] error attaching: %w", device.UUID, err)
+		}
+		r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, machineEvent.ReasonAttachedMdevDevice, "Attached mdev device %s of resource %s", device.UUID, device.Resource)
+	}
+	return nil
+}
+
+// removeMdevDevices removes all mediated device instances of the machine once its domain is gone.
+func (r *MachineReconciler) removeMdevDevices(machine *api.Machine) error {
+	for _, device := range slices.Concat(machine.Status.MdevDevices, machine.Spec.MdevDevices) {
+		if err := r.removeMdevDevice(machine, device); err != nil {
+			return fmt.Errorf("[mdev device %s] %w", device.UUID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/go-logr/logr"
+	machinepoolletv1alpha1 "github.com/ironcore-dev/ironcore/poollet/machinepoollet/api/v1alpha1"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	libvirtmeta "github.com/ironcore-dev/libvirt-provider/internal/libvirt/meta"
+	"libvirt.org/go/libvirtxml"
+)
+
+// metadataPrefix is the prefix of the namespace of the libvirt-provider metadata in the domain XML.
+const metadataPrefix = "libvirtprovider"
+
+// machineMetadataFor returns the ironcore machine identified by the labels of the IRI machine, if any.
+func machineMetadataFor(machine *api.Machine, iriMachineLabels map[string]string) *libvirtmeta.MachineMetadata {
+	metadata := &libvirtmeta.MachineMetadata{
+		Namespace: iriMachineLabels[machinepoolletv1alpha1.MachineNamespaceLabel],
+		Name:      iriMachineLabels[machinepoolletv1alpha1.MachineNameLabel],
+		UID:       iriMachineLabels[machinepoolletv1alpha1.MachineUIDLabel],
+	}
+	if *metadata == (libvirtmeta.MachineMetadata{}) {
+		return nil
+	}
+	metadata.Class, _ = api.GetClassLabel(machine)
+	return metadata
+}
+
+// downwardAPILabelsFor returns the downward api labels or annotations of the IRI machine, sorted by key.
+func downwardAPILabelsFor(iriMachineLabels map[string]string) []libvirtmeta.MachineLabel {
+	var labels []libvirtmeta.MachineLabel
+	for key, value := range iriMachineLabels {
+		if strings.HasPrefix(key, machinepoolletv1alpha1.DownwardAPIPrefix) {
+			labels = append(labels, libvirtmeta.MachineLabel{Key: key, Value: value})
+		}
+	}
+	slices.SortFunc(labels, func(a, b libvirtmeta.MachineLabel) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return labels
+}
+
+// domainMetadataFor returns the libvirt-provider metadata of the domain of the machine. It returns nil if the
+// IRI machine labels are not annotated in the machine.
+func domainMetadataFor(machine *api.Machine) (*libvirtmeta.LibvirtProviderMetadata, error) {
+	labels, found := machine.Metadata.Annotations[api.LabelsAnnotation]
+	if !found {
+		return nil, nil
+	}
+	var iriMachineLabels map[string]string
+	if err := json.Unmarshal([]byte(labels), &iriMachineLabels); err != nil {
+		return nil, fmt.Errorf("error unmarshalling iri machine labels: %w", err)
+	}
+
+	// Machines created by earlier versions may not have annotations annotated.
+	iriMachineAnnotations, _ := api.GetAnnotationsAnnotation(machine.Metadata)
+
+	return &libvirtmeta.LibvirtProviderMetadata{
+		IRIMmachineLabels: libvirtmeta.IRIMachineLabelsEncoder(iriMachineLabels),
+		Machine:           machineMetadataFor(machine, iriMachineLabels),
+		Labels:            downwardAPILabelsFor(iriMachineLabels),
+		Annotations:       downwardAPILabelsFor(iriMachineAnnotations),
+	}, nil
+}
+
+// reconcileDomainMetadata updates the downward api labels and annotations in the metadata of the existing
+// domain, as the annotations of the machine change while the domain exists. The machine of the metadata is
+// kept, as it describes the machine at the creation of the domain.
+func (r *MachineReconciler) reconcileDomainMetadata(log logr.Logger, machine *api.Machine, domainDesc *libvirtxml.Domain) error {
+	desired, err := domainMetadataFor(machine)
+	if err != nil || desired == nil {
+		return err
+	}
+
+	actual, ok, err := libvirtmeta.FromDomain(domainDesc)
+	if err != nil {
+		return err
+	}
+	if ok {
+		if slices.Equal(actual.Labels, desired.Labels) && slices.Equal(actual.Annotations, desired.Annotations) {
+			return nil
+		}
+		desired.IRIMmachineLabels = actual.IRIMmachineLabels
+		desired.Machine = actual.Machine
+	}
+
+	data, err := xml.Marshal(desired)
+	if err != nil {
+		return fmt.Errorf("error marshalling domain metadata: %w", err)
+	}
+
+	domain := machineDomain(machine)
+	persistent, err := r.libvirt.DomainIsPersistent(domain)
+	if err != nil {
+		return fmt.Errorf("error checking whether domain is persistent: %w", err)
+	}
+	flags := libvirt.DomainAffectLive
+	if persistent == 1 {
+		flags |= libvirt.DomainAffectConfig
+	}
+
+	log.V(1).Info("Updating domain metadata")
+	if err := r.libvirt.DomainSetMetadata(domain, int32(libvirt.DomainMetadataElement), libvirt.OptString{string(data)},
+		libvirt.OptString{metadataPrefix}, libvirt.OptString{libvirtmeta.Namespace}, flags); err != nil {
+		return fmt.Errorf("error setting domain metadata: %w", err)
+	}
+	return nil
+}
+
+// checkDomainOwner ensures an existing domain the machine takes over was created for the same ironcore machine.
+// Domains without machine metadata, e.g. created by earlier versions, are taken over as they are.
+func checkDomainOwner(log logr.Logger, machine *api.Machine, domainDesc *libvirtxml.Domain) error {
+	metadata, ok, err := libvirtmeta.FromDomain(domainDesc)
+	if err != nil {
+		return err
+	}
+	if !ok || metadata.Machine == nil || metadata.Machine.UID == "" {
+		return nil
+	}
+
+	labels, found := machine.Metadata.Annotations[api.LabelsAnnotation]
+	if !found {
+		return nil
+	}
+	var iriMachineLabels map[string]string
+	if err := json.Unmarshal([]byte(labels), &iriMachineLabels); err != nil {
+		return fmt.Errorf("error unmarshalling iri machine labels: %w", err)
+	}
+
+	uid, ok := iriMachineLabels[machinepoolletv1alpha1.MachineUIDLabel]
+	if !ok {
+		return nil
+	}
+	if metadata.Machine.UID != uid {
+		return fmt.Errorf("domain belongs to machine %s/%s with uid %s, not %s",
+			metadata.Machine.Namespace, metadata.Machine.Name, metadata.Machine.UID, uid)
+	}
+
+	log.V(2).Info("Domain belongs to machine", "Namespace", metadata.Machine.Namespace, "Name", metadata.Machine.Name, "UID", uid)
+	return nil
+}
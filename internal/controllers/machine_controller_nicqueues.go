@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"libvirt.org/go/libvirtxml"
+)
+
+// NetworkInterfaceDriver is the backend processing the packets of virtio-net network interfaces.
+type NetworkInterfaceDriver string
+
+const (
+	// NetworkInterfaceDriverVhost processes packets in the vhost-net kernel module.
+	NetworkInterfaceDriverVhost NetworkInterfaceDriver = "vhost"
+	// NetworkInterfaceDriverQEMU processes packets in QEMU userspace.
+	NetworkInterfaceDriverQEMU NetworkInterfaceDriver = "qemu"
+)
+
+func NetworkInterfaceDrivers() []NetworkInterfaceDriver {
+	return []NetworkInterfaceDriver{NetworkInterfaceDriverVhost, NetworkInterfaceDriverQEMU}
+}
+
+const (
+	// NetworkInterfaceAttributeQueues is the network interface attribute overriding the queues of a network interface.
+	NetworkInterfaceAttributeQueues = "queues"
+	// NetworkInterfaceAttributeDriver is the network interface attribute overriding the driver of a network interface.
+	NetworkInterfaceAttributeDriver = "driver"
+)
+
+// maxAutoNetworkInterfaceQueues caps the queues of network interfaces derived from the vCPUs of their machine.
+const maxAutoNetworkInterfaceQueues = 16
+
+// NetworkInterfaceOptions configure the virtio-net devices of network interfaces of provider networks.
+// Network interfaces are left to the defaults of libvirt unless queues or a driver are configured for them.
+type NetworkInterfaceOptions struct {
+	// Queues is the number of queues of network interfaces that don't specify NetworkInterfaceAttributeQueues.
+	// If zero, network interfaces keep a single queue unless Multiqueue is set.
+	Queues uint
+	// Multiqueue gives network interfaces that don't specify queues a queue per vCPU of their machine, up to 16.
+	Multiqueue bool
+	// Driver is the driver of network interfaces that don't specify NetworkInterfaceAttributeDriver.
+	// If empty, libvirt chooses the driver.
+	Driver NetworkInterfaceDriver
+}
+
+func (o NetworkInterfaceOptions) validate() error {
+	if o.Driver != "" && !slices.Contains(NetworkInterfaceDrivers(), o.Driver) {
+		return fmt.Errorf("unsupported network interface driver %q", o.Driver)
+	}
+	if o.Queues > 0 && o.Multiqueue {
+		return fmt.Errorf("network interface queues and multiqueue are mutually exclusive")
+	}
+	return nil
+}
+
+// queues returns the queues of the network interface, as requested by its attributes or by default. It returns
+// zero if no queues are configured.
+func (o NetworkInterfaceOptions) queues(machine *api.Machine, nic *api.NetworkInterfaceSpec) (uint, error) {
+	if value, ok := nic.Attributes[NetworkInterfaceAttributeQueues]; ok {
+		queues, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || queues == 0 {
+			return 0, fmt.Errorf("invalid queues %q of network interface %s", value, nic.Name)
+		}
+		return uint(queues), nil
+	}
+
+	switch {
+	case o.Queues > 0:
+		return o.Queues, nil
+	case o.Multiqueue:
+		return min(max(uint(machine.Spec.CpuMillis/1000), 1), maxAutoNetworkInterfaceQueues), nil
+	default:
+		return 0, nil
+	}
+}
+
+// driver returns the driver of the network interface, as requested by its attributes or by default.
+func (o NetworkInterfaceOptions) driver(nic *api.NetworkInterfaceSpec) (NetworkInterfaceDriver, error) {
+	value, ok := nic.Attributes[NetworkInterfaceAttributeDriver]
+	if !ok {
+		return o.Driver, nil
+	}
+	if !slices.Contains(NetworkInterfaceDrivers(), NetworkInterfaceDriver(value)) {
+		return "", fmt.Errorf("unsupported driver %q of network interface %s", value, nic.Name)
+	}
+	return NetworkInterfaceDriver(value), nil
+}
+
+// setNetworkInterfaceDriver makes the interface of a provider network a virtio-net device with the queues and
+// driver of the network interface, if any are configured. Other interfaces are left as they are.
+func (o NetworkInterfaceOptions) setNetworkInterfaceDriver(machine *api.Machine, nic *api.NetworkInterfaceSpec, iface *libvirtxml.DomainInterface) error {
+	if iface == nil || iface.Source == nil || iface.Source.Network == nil {
+		return nil
+	}
+
+	queues, err := o.queues(machine, nic)
+	if err != nil {
+		return err
+	}
+	driver, err := o.driver(nic)
+	if err != nil {
+		return err
+	}
+	if queues == 0 && driver == "" {
+		return nil
+	}
+
+	iface.Model = &libvirtxml.DomainInterfaceModel{Type: "virtio"}
+	iface.Driver = &libvirtxml.DomainInterfaceDriver{Name: string(driver)}
+	// A single queue is the default of virtio-net devices.
+	if queues > 1 {
+		iface.Driver.Queues = queues
+	}
+	return nil
+}
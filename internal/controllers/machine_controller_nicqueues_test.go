@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"github.com/ironcore-dev/libvirt-provider/api"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"libvirt.org/go/libvirtxml"
+)
+
+var _ = Describe("Network interface queues", func() {
+	machineWithCPUs := func(cpuMillis int64) *api.Machine {
+		return &api.Machine{Spec: api.MachineSpec{CpuMillis: cpuMillis}}
+	}
+
+	nicWithAttributes := func(attributes map[string]string) *api.NetworkInterfaceSpec {
+		return &api.NetworkInterfaceSpec{Name: "nic", Attributes: attributes}
+	}
+
+	providerNetworkInterface := func() *libvirtxml.DomainInterface {
+		return &libvirtxml.DomainInterface{
+			Source: &libvirtxml.DomainInterfaceSource{
+				Network: &libvirtxml.DomainInterfaceSourceNetwork{Network: "provider"},
+			},
+		}
+	}
+
+	DescribeTable("queues",
+		func(opts NetworkInterfaceOptions, cpuMillis int64, attributes map[string]string, expected uint) {
+			Expect(opts.queues(machineWithCPUs(cpuMillis), nicWithAttributes(attributes))).To(Equal(expected))
+		},
+		Entry("not configured", NetworkInterfaceOptions{}, int64(8000), nil, uint(0)),
+		Entry("fixed", NetworkInterfaceOptions{Queues: 4}, int64(8000), nil, uint(4)),
+		Entry("multiqueue per vCPU", NetworkInterfaceOptions{Multiqueue: true}, int64(8000), nil, uint(8)),
+		Entry("multiqueue below a vCPU", NetworkInterfaceOptions{Multiqueue: true}, int64(500), nil, uint(1)),
+		Entry("multiqueue capped", NetworkInterfaceOptions{Multiqueue: true}, int64(64000), nil, uint(maxAutoNetworkInterfaceQueues)),
+		Entry("requested by the attribute", NetworkInterfaceOptions{Queues: 4}, int64(8000), map[string]string{NetworkInterfaceAttributeQueues: "2"}, uint(2)),
+	)
+
+	DescribeTable("invalid queues",
+		func(value string) {
+			_, err := NetworkInterfaceOptions{}.queues(machineWithCPUs(1000), nicWithAttributes(map[string]string{NetworkInterfaceAttributeQueues: value}))
+			Expect(err).To(MatchError(ContainSubstring("invalid queues")))
+		},
+		Entry("zero", "0"),
+		Entry("negative", "-1"),
+		Entry("no number", "many"),
+	)
+
+	DescribeTable("driver",
+		func(opts NetworkInterfaceOptions, attributes map[string]string, expected NetworkInterfaceDriver, expectedErr string) {
+			driver, err := opts.driver(nicWithAttributes(attributes))
+			if expectedErr != "" {
+				Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(driver).To(Equal(expected))
+		},
+		Entry("not configured", NetworkInterfaceOptions{}, nil, NetworkInterfaceDriver(""), ""),
+		Entry("by default", NetworkInterfaceOptions{Driver: NetworkInterfaceDriverVhost}, nil, NetworkInterfaceDriverVhost, ""),
+		Entry("requested by the attribute", NetworkInterfaceOptions{Driver: NetworkInterfaceDriverVhost}, map[string]string{NetworkInterfaceAttributeDriver: "qemu"}, NetworkInterfaceDriverQEMU, ""),
+		Entry("unsupported", NetworkInterfaceOptions{}, map[string]string{NetworkInterfaceAttributeDriver: "dpdk"}, NetworkInterfaceDriver(""), `unsupported driver "dpdk"`),
+	)
+
+	DescribeTable("validating the options",
+		func(opts NetworkInterfaceOptions, expectedErr string) {
+			if expectedErr == "" {
+				Expect(opts.validate()).To(Succeed())
+				return
+			}
+			Expect(opts.validate()).To(MatchError(ContainSubstring(expectedErr)))
+		},
+		Entry("defaults", NetworkInterfaceOptions{}, ""),
+		Entry("multiqueue with a driver", NetworkInterfaceOptions{Multiqueue: true, Driver: NetworkInterfaceDriverQEMU}, ""),
+		Entry("unsupported driver", NetworkInterfaceOptions{Driver: "dpdk"}, "unsupported network interface driver"),
+		Entry("queues and multiqueue", NetworkInterfaceOptions{Queues: 2, Multiqueue: true}, "mutually exclusive"),
+	)
+
+	DescribeTable("setting the driver of an interface",
+		func(opts NetworkInterfaceOptions, attributes map[string]string, expectedModel *libvirtxml.DomainInterfaceModel, expectedDriver *libvirtxml.DomainInterfaceDriver) {
+			iface := providerNetworkInterface()
+			Expect(opts.setNetworkInterfaceDriver(machineWithCPUs(4000), nicWithAttributes(attributes), iface)).To(Succeed())
+			Expect(iface.Model).To(Equal(expectedModel))
+			Expect(iface.Driver).To(Equal(expectedDriver))
+		},
+		Entry("keeping the libvirt defaults", NetworkInterfaceOptions{}, nil, nil, nil),
+		Entry("multiqueue",
+			NetworkInterfaceOptions{Multiqueue: true}, nil,
+			&libvirtxml.DomainInterfaceModel{Type: "virtio"}, &libvirtxml.DomainInterfaceDriver{Queues: 4}),
+		Entry("driver only",
+			NetworkInterfaceOptions{Driver: NetworkInterfaceDriverVhost}, nil,
+			&libvirtxml.DomainInterfaceModel{Type: "virtio"}, &libvirtxml.DomainInterfaceDriver{Name: "vhost"}),
+		Entry("single queue requested by the attribute",
+			NetworkInterfaceOptions{}, map[string]string{NetworkInterfaceAttributeQueues: "1"},
+			&libvirtxml.DomainInterfaceModel{Type: "virtio"}, &libvirtxml.DomainInterfaceDriver{}),
+		Entry("queues and driver requested by the attributes",
+			NetworkInterfaceOptions{}, map[string]string{NetworkInterfaceAttributeQueues: "2", NetworkInterfaceAttributeDriver: "qemu"},
+			&libvirtxml.DomainInterfaceModel{Type: "virtio"}, &libvirtxml.DomainInterfaceDriver{Name: "qemu", Queues: 2}),
+	)
+
+	It("should leave interfaces of other networks as they are", func() {
+		iface := &libvirtxml.DomainInterface{Source: &libvirtxml.DomainInterfaceSource{User: &libvirtxml.DomainInterfaceSourceUser{}}}
+		opts := NetworkInterfaceOptions{Multiqueue: true, Driver: NetworkInterfaceDriverVhost}
+		Expect(opts.setNetworkInterfaceDriver(machineWithCPUs(4000), nicWithAttributes(nil), iface)).To(Succeed())
+		Expect(iface.Model).To(BeNil())
+		Expect(iface.Driver).To(BeNil())
+	})
+})
@@ -7,6 +7,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/netip"
 	"os"
 	"reflect"
 	"strings"
@@ -24,6 +25,11 @@ var (
 	errNoNetworkInterfaceAlias = errors.New("no network interface alias")
 )
 
+// nicPluginContext names the logger of ctx after the nic plugin, so its verbosity can be set separately.
+func nicPluginContext(ctx context.Context) context.Context {
+	return logr.NewContext(ctx, logr.FromContextOrDiscard(ctx).WithName("nic-plugin"))
+}
+
 func (r *MachineReconciler) deleteNetworkInterfaces(ctx context.Context, log logr.Logger, machine *api.Machine) error {
 	machineNetworkInterfaces, err := providerhost.ReadMachineNetworkInterfaces(r.host, machine.ID)
 	if err != nil {
@@ -36,7 +42,7 @@ func (r *MachineReconciler) deleteNetworkInterfaces(ctx context.Context, log log
 	}
 
 	for _, machineNic := range machineNetworkInterfaces {
-		if err := r.networkInterfacePlugin.Delete(ctx, machineNic.NetworkInterfaceName, machine.ID); err != nil {
+		if err := r.networkInterfacePlugin.Delete(nicPluginContext(ctx), machineNic.NetworkInterfaceName, machine.ID); err != nil {
 			return fmt.Errorf("[machine network interface %s] error deleting: %w", machineNic.NetworkInterfaceName, err)
 		}
 	}
@@ -66,7 +72,7 @@ func (r *MachineReconciler) setDomainNetworkInterfaces(
 	for _, nic := range machine.Spec.NetworkInterfaces {
 		specNicNames.Insert(nic.Name)
 
-		providerNic, err := r.networkInterfacePlugin.Apply(ctx, nic, machine)
+		providerNic, err := r.networkInterfacePlugin.Apply(nicPluginContext(ctx), nic, machine)
 		if err != nil {
 			return nil, fmt.Errorf("[network interface %s] %w", nic.Name, err)
 		}
@@ -75,6 +81,9 @@ func (r *MachineReconciler) setDomainNetworkInterfaces(
 		if err != nil {
 			return nil, fmt.Errorf("[network interface %s] %w", nic.Name, err)
 		}
+		if err := r.networkInterfaces.setNetworkInterfaceDriver(machine, nic, libvirtNic.iface); err != nil {
+			return nil, fmt.Errorf("[network interface %s] %w", nic.Name, err)
+		}
 
 		switch {
 		case libvirtNic.hostDev != nil:
@@ -98,7 +107,7 @@ func (r *MachineReconciler) setDomainNetworkInterfaces(
 			continue
 		}
 
-		if err := r.networkInterfacePlugin.Delete(ctx, machineNic.NetworkInterfaceName, machine.ID); err != nil {
+		if err := r.networkInterfacePlugin.Delete(nicPluginContext(ctx), machineNic.NetworkInterfaceName, machine.ID); err != nil {
 			return nil, fmt.Errorf("[network interface %s] %w", machineNic.NetworkInterfaceName, err)
 		}
 	}
@@ -127,7 +136,7 @@ func (r *MachineReconciler) attachDetachNetworkInterfaces(
 	machine *api.Machine,
 	domainDesc *libvirtxml.Domain,
 ) ([]api.NetworkInterfaceStatus, error) {
-	domain := machineDomain(machine.ID)
+	domain := machineDomain(machine)
 
 	machineNicByName, err := r.listMachineNetworkInterfaces(machine.ID)
 	if err != nil {
@@ -172,6 +181,7 @@ func (r *MachineReconciler) attachDetachNetworkInterfaces(
 				Name:   nicName,
 				Handle: mountedNic.networkInterface.Handle,
 				State:  api.NetworkInterfaceStateAttached,
+				IPs:    mountedNic.networkInterface.IPs,
 			})
 		}
 	}
@@ -200,7 +210,7 @@ func (r *MachineReconciler) deleteNetworkInterface(
 	machine *api.Machine,
 	nic providerhost.MachineNetworkInterface,
 ) error {
-	return r.networkInterfacePlugin.Delete(ctx, nic.NetworkInterfaceName, machine.ID)
+	return r.networkInterfacePlugin.Delete(nicPluginContext(ctx), nic.NetworkInterfaceName, machine.ID)
 }
 
 func (r *MachineReconciler) reconcileDesiredNetworkInterface(
@@ -210,7 +220,7 @@ func (r *MachineReconciler) reconcileDesiredNetworkInterface(
 	mountedNics map[string]mountedNetworkInterface,
 	nic *api.NetworkInterfaceSpec,
 ) (*mountedNetworkInterface, error) {
-	providerNic, err := r.networkInterfacePlugin.Apply(ctx, nic, machine)
+	providerNic, err := r.networkInterfacePlugin.Apply(nicPluginContext(ctx), nic, machine)
 	if err != nil {
 		return nil, err
 	}
@@ -231,6 +241,9 @@ func (r *MachineReconciler) reconcileDesiredNetworkInterface(
 	if err != nil {
 		return nil, err
 	}
+	if err := r.networkInterfaces.setNetworkInterfaceDriver(machine, nic, libvirtNic.iface); err != nil {
+		return nil, err
+	}
 
 	if err := r.attachDomainDevice(domain, libvirtNic.device()); err != nil {
 		return nil, fmt.Errorf("error attaching network interface device: %w", err)
@@ -406,13 +419,32 @@ func libvirtInterfaceToProviderNetworkInterface(iface *libvirtxml.DomainInterfac
 
 	switch {
 	case src.User != nil:
+		isolated := &providernetworkinterface.Isolated{}
+		for _, ip := range iface.IP {
+			addr, err := netip.ParseAddr(ip.Address)
+			if err != nil {
+				return nil, fmt.Errorf("invalid interface ip %q: %w", ip.Address, err)
+			}
+			isolated.IPs = append(isolated.IPs, netip.PrefixFrom(addr, int(ip.Prefix)))
+		}
 		return &providernetworkinterface.NetworkInterface{
-			Isolated: &providernetworkinterface.Isolated{},
+			Isolated: isolated,
 		}, nil
 	case src.Network != nil:
+		var mtu uint
+		if iface.MTU != nil {
+			mtu = iface.MTU.Size
+		}
+		portSecurity, err := providerPortSecurity(iface.FilterRef)
+		if err != nil {
+			return nil, err
+		}
 		return &providernetworkinterface.NetworkInterface{
 			ProviderNetwork: &providernetworkinterface.ProviderNetwork{
-				NetworkName: src.Network.Network,
+				NetworkName:  src.Network.Network,
+				MTU:          mtu,
+				VLAN:         providerVLAN(iface.VLan),
+				PortSecurity: portSecurity,
 			},
 		}, nil
 	default:
@@ -424,6 +456,68 @@ func networkInterfaceAlias(name string) string {
 	return fmt.Sprintf("%s%s", networkInterfaceAliasPrefix, name)
 }
 
+// libvirtVLAN returns the libvirt vlan of the VLAN trunk, with the native VLAN untagged in the guest.
+func libvirtVLAN(vlan *providernetworkinterface.VLAN) *libvirtxml.DomainInterfaceVLan {
+	libvirtVLAN := &libvirtxml.DomainInterfaceVLan{Trunk: "yes"}
+	for _, tag := range vlan.Tags {
+		libvirtTag := libvirtxml.DomainInterfaceVLanTag{ID: tag}
+		if vlan.Native != nil && *vlan.Native == tag {
+			libvirtTag.NativeMode = "untagged"
+		}
+		libvirtVLAN.Tags = append(libvirtVLAN.Tags, libvirtTag)
+	}
+	return libvirtVLAN
+}
+
+// portSecurityFilter is the libvirt nwfilter preventing MAC, IP and ARP spoofing. Its MAC parameter defaults to
+// the MAC address of the interface, without IP parameters it learns the IP the guest uses first. It drops all
+// IPv6 traffic, so it must only be used for IPv4 addresses.
+const portSecurityFilter = "clean-traffic"
+
+func libvirtFilterRef(portSecurity *providernetworkinterface.PortSecurity) *libvirtxml.DomainInterfaceFilterRef {
+	filterRef := &libvirtxml.DomainInterfaceFilterRef{Filter: portSecurityFilter}
+	for _, ip := range portSecurity.IPs {
+		filterRef.Parameters = append(filterRef.Parameters, libvirtxml.DomainInterfaceFilterParam{Name: "IP", Value: ip.String()})
+	}
+	return filterRef
+}
+
+// providerPortSecurity returns the port security of the libvirt filter reference, if any.
+func providerPortSecurity(filterRef *libvirtxml.DomainInterfaceFilterRef) (*providernetworkinterface.PortSecurity, error) {
+	if filterRef == nil || filterRef.Filter != portSecurityFilter {
+		return nil, nil
+	}
+
+	portSecurity := &providernetworkinterface.PortSecurity{}
+	for _, param := range filterRef.Parameters {
+		if param.Name != "IP" {
+			continue
+		}
+		addr, err := netip.ParseAddr(param.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter ip %q: %w", param.Value, err)
+		}
+		portSecurity.IPs = append(portSecurity.IPs, addr)
+	}
+	return portSecurity, nil
+}
+
+// providerVLAN returns the VLAN trunk of the libvirt vlan, if any.
+func providerVLAN(libvirtVLAN *libvirtxml.DomainInterfaceVLan) *providernetworkinterface.VLAN {
+	if libvirtVLAN == nil {
+		return nil
+	}
+
+	vlan := &providernetworkinterface.VLAN{}
+	for _, tag := range libvirtVLAN.Tags {
+		vlan.Tags = append(vlan.Tags, tag.ID)
+		if tag.NativeMode == "untagged" {
+			vlan.Native = &tag.ID
+		}
+	}
+	return vlan
+}
+
 func providerNetworkInterfaceToLibvirt(name string, nic *providernetworkinterface.NetworkInterface) (*libvirtNetworkInterface, error) {
 	switch {
 	case nic.HostDevice != nil:
@@ -450,29 +544,52 @@ func providerNetworkInterfaceToLibvirt(name string, nic *providernetworkinterfac
 			},
 		}, nil
 	case nic.Isolated != nil:
-		return &libvirtNetworkInterface{
-			iface: &libvirtxml.DomainInterface{
-				Alias: &libvirtxml.DomainAlias{
-					Name: networkInterfaceAlias(name),
-				},
-				Source: &libvirtxml.DomainInterfaceSource{
-					User: &libvirtxml.DomainInterfaceSourceUser{},
-				},
+		iface := &libvirtxml.DomainInterface{
+			Alias: &libvirtxml.DomainAlias{
+				Name: networkInterfaceAlias(name),
 			},
-		}, nil
+			Source: &libvirtxml.DomainInterfaceSource{
+				User: &libvirtxml.DomainInterfaceSourceUser{},
+			},
+		}
+		// Unlike slirp, passt hands out the given addresses to the guest instead of using them as network.
+		if len(nic.Isolated.IPs) > 0 {
+			iface.Backend = &libvirtxml.DomainInterfaceBackend{Type: "passt"}
+			for _, ip := range nic.Isolated.IPs {
+				family := "ipv4"
+				if ip.Addr().Is6() {
+					family = "ipv6"
+				}
+				iface.IP = append(iface.IP, libvirtxml.DomainInterfaceIP{
+					Address: ip.Addr().String(),
+					Family:  family,
+					Prefix:  uint(ip.Bits()),
+				})
+			}
+		}
+		return &libvirtNetworkInterface{iface: iface}, nil
 	case nic.ProviderNetwork != nil:
-		return &libvirtNetworkInterface{
-			iface: &libvirtxml.DomainInterface{
-				Alias: &libvirtxml.DomainAlias{
-					Name: networkInterfaceAlias(name),
-				},
-				Source: &libvirtxml.DomainInterfaceSource{
-					Network: &libvirtxml.DomainInterfaceSourceNetwork{
-						Network: nic.ProviderNetwork.NetworkName,
-					},
+		iface := &libvirtxml.DomainInterface{
+			Alias: &libvirtxml.DomainAlias{
+				Name: networkInterfaceAlias(name),
+			},
+			Source: &libvirtxml.DomainInterfaceSource{
+				Network: &libvirtxml.DomainInterfaceSourceNetwork{
+					Network: nic.ProviderNetwork.NetworkName,
 				},
 			},
-		}, nil
+		}
+		// libvirt sets the MTU of the tap device and advertises it to virtio-net guests.
+		if nic.ProviderNetwork.MTU > 0 {
+			iface.MTU = &libvirtxml.DomainInterfaceMTU{Size: nic.ProviderNetwork.MTU}
+		}
+		if vlan := nic.ProviderNetwork.VLAN; vlan != nil {
+			iface.VLan = libvirtVLAN(vlan)
+		}
+		if portSecurity := nic.ProviderNetwork.PortSecurity; portSecurity != nil {
+			iface.FilterRef = libvirtFilterRef(portSecurity)
+		}
+		return &libvirtNetworkInterface{iface: iface}, nil
 	default:
 		return nil, fmt.Errorf("unsupported provider network interface: %#+v", nic)
 	}
@@ -0,0 +1,41 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"net/netip"
+
+	providernetworkinterface "github.com/ironcore-dev/libvirt-provider/internal/plugins/networkinterface"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"libvirt.org/go/libvirtxml"
+)
+
+var _ = Describe("Port security", func() {
+	It("should reference the filter with the ipv4 addresses of the network interface", func() {
+		portSecurity := &providernetworkinterface.PortSecurity{
+			IPs: []netip.Addr{netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("10.0.0.2")},
+		}
+
+		filterRef := libvirtFilterRef(portSecurity)
+		Expect(filterRef).To(Equal(&libvirtxml.DomainInterfaceFilterRef{
+			Filter: portSecurityFilter,
+			Parameters: []libvirtxml.DomainInterfaceFilterParam{
+				{Name: "IP", Value: "10.0.0.1"},
+				{Name: "IP", Value: "10.0.0.2"},
+			},
+		}))
+		Expect(providerPortSecurity(filterRef)).To(Equal(portSecurity))
+	})
+
+	It("should learn the address without ips", func() {
+		filterRef := libvirtFilterRef(&providernetworkinterface.PortSecurity{})
+		Expect(filterRef).To(Equal(&libvirtxml.DomainInterfaceFilterRef{Filter: portSecurityFilter}))
+		Expect(providerPortSecurity(filterRef)).To(Equal(&providernetworkinterface.PortSecurity{}))
+	})
+
+	It("should ignore foreign filters", func() {
+		Expect(providerPortSecurity(&libvirtxml.DomainInterfaceFilterRef{Filter: "no-mac-spoofing"})).To(BeNil())
+	})
+})
@@ -0,0 +1,220 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/go-logr/logr"
+	machinepoolletv1alpha1 "github.com/ironcore-dev/ironcore/poollet/machinepoollet/api/v1alpha1"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	machineEvent "github.com/ironcore-dev/libvirt-provider/internal/event/machineevent"
+	libvirtmeta "github.com/ironcore-dev/libvirt-provider/internal/libvirt/meta"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"libvirt.org/go/libvirtxml"
+)
+
+// OrphanedDomainPolicy determines what happens to orphaned domains, being domains with libvirt-provider
+// metadata but without machine.
+type OrphanedDomainPolicy string
+
+const (
+	// OrphanedDomainPolicyReport only reports orphaned domains.
+	OrphanedDomainPolicyReport OrphanedDomainPolicy = "report"
+	// OrphanedDomainPolicyAdopt creates machines for orphaned domains, see api.MachineSpec.Adopted.
+	OrphanedDomainPolicyAdopt OrphanedDomainPolicy = "adopt"
+	// OrphanedDomainPolicyDestroy destroys orphaned domains and removes their machine directories.
+	OrphanedDomainPolicyDestroy OrphanedDomainPolicy = "destroy"
+)
+
+func OrphanedDomainPolicies() []OrphanedDomainPolicy {
+	return []OrphanedDomainPolicy{OrphanedDomainPolicyReport, OrphanedDomainPolicyAdopt, OrphanedDomainPolicyDestroy}
+}
+
+// OrphanedDomainOptions configure the audit of orphaned domains.
+type OrphanedDomainOptions struct {
+	// Policy determines what happens to orphaned domains. Defaults to OrphanedDomainPolicyReport.
+	Policy OrphanedDomainPolicy
+	// Interval is the interval of the audit. If zero, the audit is disabled.
+	Interval time.Duration
+}
+
+func (o OrphanedDomainOptions) validate() error {
+	if !slices.Contains(OrphanedDomainPolicies(), o.Policy) {
+		return fmt.Errorf("unsupported orphaned domain policy %q", o.Policy)
+	}
+	if o.Interval < 0 {
+		return fmt.Errorf("orphaned domain audit interval must not be negative")
+	}
+	return nil
+}
+
+func (r *MachineReconciler) startAuditOrphanedDomains(ctx context.Context, log logr.Logger) {
+	if r.orphanedDomains.Interval == 0 {
+		log.V(1).Info("orphaned domain audit is disabled")
+		return
+	}
+
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		log.V(1).Info("starting orphaned domain audit")
+		if err := r.auditOrphanedDomains(ctx, log); err != nil {
+			log.Error(err, "failed to audit orphaned domains")
+		}
+	}, r.orphanedDomains.Interval)
+}
+
+// auditOrphanedDomains handles the domains with libvirt-provider metadata whose UUID no machine has.
+// Domains without libvirt-provider metadata have not been created by libvirt-provider and are left alone.
+func (r *MachineReconciler) auditOrphanedDomains(ctx context.Context, log logr.Logger) error {
+	// Listing the domains first ensures machines created in between are not taken for orphans.
+	domains, _, err := r.libvirt.ConnectListAllDomains(1, 0)
+	if err != nil {
+		return fmt.Errorf("error listing domains: %w", err)
+	}
+
+	machines, err := r.machines.List(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing machines: %w", err)
+	}
+	domainUUIDs := make(map[libvirt.UUID]struct{}, len(machines))
+	for _, machine := range machines {
+		domainUUIDs[machineDomain(machine).UUID] = struct{}{}
+	}
+
+	for _, domain := range domains {
+		if _, ok := domainUUIDs[domain.UUID]; ok {
+			continue
+		}
+
+		domainXMLData, err := r.libvirt.DomainGetXMLDesc(domain, 0)
+		if err != nil {
+			if libvirt.IsNotFound(err) {
+				continue
+			}
+			return fmt.Errorf("error getting description of domain %s: %w", domain.Name, err)
+		}
+		domainDesc := &libvirtxml.Domain{}
+		if err := domainDesc.Unmarshal(domainXMLData); err != nil {
+			return fmt.Errorf("error unmarshalling description of domain %s: %w", domain.Name, err)
+		}
+		metadata, ok, err := libvirtmeta.FromDomain(domainDesc)
+		if err != nil {
+			log.Error(err, "Failed to parse domain metadata", "Domain", domain.Name)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		domainLog := log.WithValues("Domain", domain.Name, "DomainUUID", domainDesc.UUID)
+		if err := r.handleOrphanedDomain(ctx, domainLog, domain, domainDesc, metadata); err != nil {
+			domainLog.Error(err, "Failed to handle orphaned domain")
+		}
+	}
+	return nil
+}
+
+func (r *MachineReconciler) handleOrphanedDomain(
+	ctx context.Context,
+	log logr.Logger,
+	domain libvirt.Domain,
+	domainDesc *libvirtxml.Domain,
+	metadata *libvirtmeta.LibvirtProviderMetadata,
+) error {
+	// Domains are named after the ID of their machine.
+	orphan := api.Metadata{ID: domainDesc.Name}
+
+	switch r.orphanedDomains.Policy {
+	case OrphanedDomainPolicyAdopt:
+		if metadata.Machine == nil || metadata.Machine.Class == "" {
+			r.Eventf(log, orphan, corev1.EventTypeWarning, machineEvent.ReasonOrphanedDomain, "Found orphaned domain %s, which can't be adopted without machine class", domainDesc.UUID)
+			orphanedDomains.WithLabelValues(orphanedDomainActionReported).Inc()
+			return nil
+		}
+		machine, err := r.adoptDomain(ctx, domainDesc, metadata)
+		if err != nil {
+			return err
+		}
+		r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, machineEvent.ReasonAdoptedDomain, "Adopted orphaned domain %s", domainDesc.UUID)
+		orphanedDomains.WithLabelValues(orphanedDomainActionAdopted).Inc()
+
+	case OrphanedDomainPolicyDestroy:
+		if err := r.undefineDomain(log, domain); err != nil {
+			return err
+		}
+		if err := r.libvirt.DomainDestroyFlags(domain, libvirt.DomainDestroyDefault); err != nil && !libvirt.IsNotFound(err) {
+			return fmt.Errorf("error destroying domain: %w", err)
+		}
+		// Volumes of plugins can't be cleaned up without their specs, only the local ones of the machine directory.
+		if err := os.RemoveAll(r.host.MachineDir(domainDesc.Name)); err != nil {
+			return fmt.Errorf("error removing machine directory: %w", err)
+		}
+		r.Eventf(log, orphan, corev1.EventTypeWarning, machineEvent.ReasonDestroyedDomain, "Destroyed orphaned domain %s", domainDesc.UUID)
+		orphanedDomains.WithLabelValues(orphanedDomainActionDestroyed).Inc()
+
+	default:
+		r.Eventf(log, orphan, corev1.EventTypeWarning, machineEvent.ReasonOrphanedDomain, "Found orphaned domain %s", domainDesc.UUID)
+		orphanedDomains.WithLabelValues(orphanedDomainActionReported).Inc()
+	}
+	return nil
+}
+
+// adoptDomain creates a machine for the orphaned domain from its description and metadata.
+func (r *MachineReconciler) adoptDomain(ctx context.Context, domainDesc *libvirtxml.Domain, metadata *libvirtmeta.LibvirtProviderMetadata) (*api.Machine, error) {
+	var cpuMillis int64
+	if vcpu := domainDesc.VCPU; vcpu != nil {
+		cpuMillis = int64(vcpu.Value) * 1000
+		if vcpu.Current > 0 {
+			cpuMillis = int64(vcpu.Current) * 1000
+		}
+	}
+	var memoryBytesValue int64
+	if memory := domainDesc.Memory; memory != nil {
+		var err error
+		if memoryBytesValue, err = memoryBytes(memory.Value, memory.Unit); err != nil {
+			return nil, err
+		}
+	}
+
+	iriMachineLabels := map[string]string{
+		machinepoolletv1alpha1.MachineNamespaceLabel: metadata.Machine.Namespace,
+		machinepoolletv1alpha1.MachineNameLabel:      metadata.Machine.Name,
+		machinepoolletv1alpha1.MachineUIDLabel:       metadata.Machine.UID,
+	}
+	for _, label := range metadata.Labels {
+		iriMachineLabels[label.Key] = label.Value
+	}
+	labelsData, err := json.Marshal(iriMachineLabels)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling iri machine labels: %w", err)
+	}
+
+	machine := &api.Machine{
+		Metadata: api.Metadata{
+			ID:          domainDesc.Name,
+			Annotations: map[string]string{api.LabelsAnnotation: string(labelsData)},
+		},
+		Spec: api.MachineSpec{
+			Power:       api.PowerStatePowerOn,
+			CpuMillis:   cpuMillis,
+			MemoryBytes: memoryBytesValue,
+			Adopted:     true,
+			DomainUUID:  domainDesc.UUID,
+		},
+	}
+	api.SetClassLabel(machine, metadata.Machine.Class)
+
+	machine, err = r.machines.Create(ctx, machine)
+	if err != nil {
+		return nil, fmt.Errorf("error creating machine: %w", err)
+	}
+	return machine, nil
+}
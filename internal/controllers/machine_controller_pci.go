@@ -0,0 +1,131 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	machineEvent "github.com/ironcore-dev/libvirt-provider/internal/event/machineevent"
+	"github.com/ironcore-dev/libvirt-provider/internal/pci"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"libvirt.org/go/libvirtxml"
+)
+
+const pciDeviceAliasPrefix = "ua-pci-"
+
+// pciDeviceHostdev returns the hostdev passing the host PCI device with the given address through.
+func pciDeviceHostdev(address string) (*libvirtxml.DomainHostdev, error) {
+	addr, err := pci.ParseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+
+	return &libvirtxml.DomainHostdev{
+		Alias: &libvirtxml.DomainAlias{
+			Name: pciDeviceAliasPrefix + strings.NewReplacer(":", "-", ".", "-").Replace(addr.String()),
+		},
+		Managed: "yes",
+		SubsysPCI: &libvirtxml.DomainHostdevSubsysPCI{
+			Source: &libvirtxml.DomainHostdevSubsysPCISource{
+				Address: &libvirtxml.DomainAddressPCI{
+					Domain:   &addr.Domain,
+					Bus:      &addr.Bus,
+					Slot:     &addr.Slot,
+					Function: &addr.Function,
+				},
+			},
+		},
+		Address: &libvirtxml.DomainAddress{
+			PCI: &libvirtxml.DomainAddressPCI{},
+		},
+	}, nil
+}
+
+// domainPCIDevices returns the PCI device hostdevs of the domain by host address.
+func domainPCIDevices(domainDesc *libvirtxml.Domain) map[string]libvirtxml.DomainHostdev {
+	hostdevs := make(map[string]libvirtxml.DomainHostdev)
+	for _, hostdev := range domainDescHostDevices(domainDesc) {
+		if hostdev.Alias == nil || !strings.HasPrefix(hostdev.Alias.Name, pciDeviceAliasPrefix) ||
+			hostdev.SubsysPCI == nil || hostdev.SubsysPCI.Source == nil || hostdev.SubsysPCI.Source.Address == nil {
+			continue
+		}
+
+		source := hostdev.SubsysPCI.Source.Address
+		if source.Domain == nil || source.Bus == nil || source.Slot == nil || source.Function == nil {
+			continue
+		}
+		addr := pci.Address{Domain: *source.Domain, Bus: *source.Bus, Slot: *source.Slot, Function: *source.Function}
+		hostdevs[addr.String()] = hostdev
+	}
+	return hostdevs
+}
+
+// setDomainPCIDevices passes the PCI devices of the machine through to a new domain.
+func setDomainPCIDevices(machine *api.Machine, domainDesc *libvirtxml.Domain) error {
+	for _, device := range machine.Spec.PCIDevices {
+		hostdev, err := pciDeviceHostdev(device.Address)
+		if err != nil {
+			return fmt.Errorf("[pci device %s] %w", device.Address, err)
+		}
+		addDomainHostdev(domainDesc, *hostdev)
+	}
+
+	machine.Status.PCIDevices = nil
+	for _, device := range machine.Spec.PCIDevices {
+		machine.Status.PCIDevices = append(machine.Status.PCIDevices, device.Address)
+	}
+	return nil
+}
+
+// reconcileDomainPCIDevices hot plugs the PCI devices of the machine into its running domain and unplugs the
+// devices no longer in its spec. The devices attached are reported in the status, so devices are only handed
+// out to other machines once they have been detached.
+func (r *MachineReconciler) reconcileDomainPCIDevices(log logr.Logger, machine *api.Machine, domainDesc *libvirtxml.Domain, executor DomainExecutor) error {
+	attached := domainPCIDevices(domainDesc)
+	defer func() {
+		machine.Status.PCIDevices = sets.List(sets.KeySet(attached))
+	}()
+
+	desired := sets.New[string]()
+	for _, device := range machine.Spec.PCIDevices {
+		desired.Insert(device.Address)
+	}
+
+	for _, address := range sets.List(sets.KeySet(attached)) {
+		if desired.Has(address) {
+			continue
+		}
+
+		hostdev := attached[address]
+		log.V(1).Info("Detaching pci device", "Address", address)
+		if err := executor.DetachHostdev(&hostdev); err != nil {
+			return fmt.Errorf("[pci device %s] error detaching: %w", address, err)
+		}
+		delete(attached, address)
+		r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, machineEvent.ReasonDetachedPCIDevice, "Detached pci device %s", address)
+	}
+
+	for _, device := range machine.Spec.PCIDevices {
+		if _, ok := attached[device.Address]; ok {
+			continue
+		}
+
+		hostdev, err := pciDeviceHostdev(device.Address)
+		if err != nil {
+			return fmt.Errorf("[pci device %s] %w", device.Address, err)
+		}
+
+		log.V(1).Info("Attaching pci device", "Resource", device.Resource, "Address", device.Address)
+		if err := executor.AttachHostdev(hostdev); err != nil {
+			return fmt.Errorf("[pci device %s] error attaching: %w", device.Address, err)
+		}
+		attached[device.Address] = *hostdev
+		r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, machineEvent.ReasonAttachedPCIDevice, "Attached pci device %s of resource %s", device.Address, device.Resource)
+	}
+	return nil
+}
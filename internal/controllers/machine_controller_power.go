@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	machineEvent "github.com/ironcore-dev/libvirt-provider/internal/event/machineevent"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// DefaultStopTimeout is the default time guests get to shut down gracefully on power off.
+const DefaultStopTimeout = 2 * time.Minute
+
+// machineStopTimeout returns the time the guest of the machine gets to shut down gracefully on power off.
+func (r *MachineReconciler) machineStopTimeout(machine *api.Machine) time.Duration {
+	if machine.Spec.StopTimeout > 0 {
+		return machine.Spec.StopTimeout
+	}
+	return r.stopTimeout
+}
+
+// stopStep returns the step a power off with the given timeout escalated to after elapsed and the time until
+// it escalates further. Guests are asked to shut down via ACPI first and, if they run a guest agent, via the
+// guest agent once half of the timeout has passed. Their domain is destroyed once the timeout has passed.
+func stopStep(machine *api.Machine, timeout, elapsed time.Duration) (api.StopStep, time.Duration) {
+	acpiTimeout := timeout
+	if machine.Spec.GuestAgent == api.GuestAgentQemu {
+		acpiTimeout = timeout / 2
+	}
+
+	switch {
+	case elapsed < acpiTimeout:
+		return api.StopStepACPI, acpiTimeout - elapsed
+	case elapsed < timeout:
+		return api.StopStepGuestAgent, timeout - elapsed
+	default:
+		return api.StopStepDestroy, 0
+	}
+}
+
+// setStopStep records the step the power off of the machine escalated to and emits an event on escalation.
+func (r *MachineReconciler) setStopStep(log logr.Logger, machine *api.Machine, step api.StopStep, timeout time.Duration) {
+	if machine.Status.StopStep == step {
+		return
+	}
+	machine.Status.StopStep = step
+
+	switch step {
+	case api.StopStepACPI:
+		r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, machineEvent.ReasonPoweringOff, "Powering off machine via ACPI, the guest has %s to shut down", timeout)
+	case api.StopStepGuestAgent:
+		r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, machineEvent.ReasonEscalatedPowerOff, "Guest did not shut down via ACPI, shutting it down via the guest agent")
+	case api.StopStepDestroy:
+		r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, machineEvent.ReasonEscalatedPowerOff, "Guest did not shut down within %s, destroying domain", timeout)
+	}
+}
+
+// reconcilePowerOff converges a machine whose desired power state is off. The shutdown of its guest escalates
+// from ACPI over the guest agent to destroying its domain within the stop timeout of the machine, see stopStep.
+// The domain is not recreated until the machine is powered on again.
+func (r *MachineReconciler) reconcilePowerOff(log logr.Logger, machine *api.Machine) (api.MachineState, error) {
+	domain := machineDomain(machine)
+
+	domainState, _, err := r.libvirt.DomainGetState(domain, 0)
+	if err != nil {
+		if libvirt.IsNotFound(err) {
+			return api.MachineStateTerminated, nil
+		}
+		return "", fmt.Errorf("error getting domain state: %w", err)
+	}
+
+	// Persistent domains would be started again by libvirtd, hence drop their definition first.
+	if err := r.undefineDomain(log, domain); err != nil {
+		return "", err
+	}
+
+	if libvirt.DomainState(domainState) == libvirt.DomainShutoff {
+		return api.MachineStateTerminated, nil
+	}
+
+	if machine.Spec.ShutdownAt.IsZero() {
+		machine.Spec.ShutdownAt = time.Now()
+	}
+
+	timeout := r.machineStopTimeout(machine)
+	step, remaining := stopStep(machine, timeout, time.Since(machine.Spec.ShutdownAt))
+	r.setStopStep(log, machine, step, timeout)
+
+	switch step {
+	case api.StopStepACPI:
+		// The guest might miss the ACPI power button under load, hence it is pressed on every reconcile.
+		log.V(1).Info("Shutting down domain via ACPI", "Remaining", remaining)
+		if err := r.libvirt.DomainShutdownFlags(domain, libvirt.DomainShutdownAcpiPowerBtn); err != nil && !libvirt.IsNotFound(err) {
+			return "", fmt.Errorf("error shutting down domain via acpi: %w", err)
+		}
+	case api.StopStepGuestAgent:
+		log.V(1).Info("Shutting down domain via guest agent", "Remaining", remaining)
+		if err := r.libvirt.DomainShutdownFlags(domain, libvirt.DomainShutdownGuestAgent); err != nil && !libvirt.IsNotFound(err) {
+			// An unresponsive guest agent is no reason to fail, the domain is destroyed once the timeout has passed.
+			log.V(1).Info("Failed to shut down domain via guest agent", "Error", err)
+		}
+	default:
+		if err := r.destroyDomain(log, machine, domain); err != nil {
+			return "", err
+		}
+		return api.MachineStateTerminated, nil
+	}
+
+	// Check back in case the guest ignores the shutdown request.
+	r.queue.AddAfter(machine.ID, remaining)
+	return api.MachineStateTerminating, nil
+}
+
+// observedPower derives the observed power state of a machine from its state.
+func observedPower(state api.MachineState) api.PowerState {
+	if state == api.MachineStateTerminated {
+		return api.PowerStatePowerOff
+	}
+	return api.PowerStatePowerOn
+}
@@ -0,0 +1,129 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	machineEvent "github.com/ironcore-dev/libvirt-provider/internal/event/machineevent"
+	"github.com/ironcore-dev/libvirt-provider/internal/qcow2"
+	corev1 "k8s.io/api/core/v1"
+	"libvirt.org/go/libvirtxml"
+)
+
+// errCorruptQcow2Disk is returned if a qcow2 disk of a domain is corrupt.
+var errCorruptQcow2Disk = errors.New("qcow2 disk is corrupt")
+
+// checkQcow2DisksOnce checks the local qcow2 disks of the domain before it is started, if enabled and not done
+// for the machine yet. Leaked clusters are repaired, while corrupt disks prevent the domain from being started.
+func (r *MachineReconciler) checkQcow2DisksOnce(log logr.Logger, machine *api.Machine, domainDesc *libvirtxml.Domain) error {
+	if !r.qcow2CheckPending(machine) {
+		return nil
+	}
+
+	if err := r.checkQcow2Files(log, machine, domainDesc, false); err != nil {
+		return err
+	}
+	r.setQcow2Checked(machine)
+	return nil
+}
+
+// checkRunningQcow2DisksOnce checks the local qcow2 disks of a running domain, if enabled and not done for the
+// machine yet. Such a domain was started without the provider, i.e. autostarted by libvirtd after an unclean
+// shutdown of the host. Its disks are in use, hence they are checked in shared mode without repairing leaks.
+// A domain with corrupt disks is destroyed, so it's only started again once checkQcow2DisksOnce passed.
+func (r *MachineReconciler) checkRunningQcow2DisksOnce(log logr.Logger, machine *api.Machine, domain libvirt.Domain) error {
+	if !r.qcow2CheckPending(machine) {
+		return nil
+	}
+
+	domainXMLData, err := r.libvirt.DomainGetXMLDesc(domain, 0)
+	if err != nil {
+		return fmt.Errorf("error getting domain description: %w", err)
+	}
+	domainDesc := &libvirtxml.Domain{}
+	if err := domainDesc.Unmarshal(domainXMLData); err != nil {
+		return fmt.Errorf("error unmarshalling domain description: %w", err)
+	}
+
+	if err := r.checkQcow2Files(log, machine, domainDesc, true); err != nil {
+		if !errors.Is(err, errCorruptQcow2Disk) {
+			return err
+		}
+
+		log.V(1).Info("Destroying domain with corrupt disk")
+		if destroyErr := r.destroyDomainFlags(log, machine, domain, libvirt.DomainDestroyDefault); destroyErr != nil {
+			return destroyErr
+		}
+		return err
+	}
+	r.setQcow2Checked(machine)
+	return nil
+}
+
+func (r *MachineReconciler) qcow2CheckPending(machine *api.Machine) bool {
+	if !r.checkQcow2Disks {
+		return false
+	}
+
+	r.checkedQcow2DisksMu.Lock()
+	defer r.checkedQcow2DisksMu.Unlock()
+	return !r.checkedQcow2Disks.Has(machine.ID)
+}
+
+func (r *MachineReconciler) setQcow2Checked(machine *api.Machine) {
+	r.checkedQcow2DisksMu.Lock()
+	defer r.checkedQcow2DisksMu.Unlock()
+	r.checkedQcow2Disks.Insert(machine.ID)
+}
+
+// checkQcow2Files checks the local qcow2 disks of the domain and reports the findings as machine events. Disks in
+// use by a running domain are checked in shared mode, where leaked clusters are tolerated as they can't be repaired.
+func (r *MachineReconciler) checkQcow2Files(log logr.Logger, machine *api.Machine, domainDesc *libvirtxml.Domain, running bool) error {
+	opts := []qcow2.CheckOption{qcow2.WithRepairLeaks(true)}
+	if running {
+		opts = []qcow2.CheckOption{qcow2.WithForceShare(true)}
+	}
+
+	for _, disk := range domainDesc.Devices.Disks {
+		if disk.Driver == nil || disk.Driver.Type != "qcow2" || disk.Source == nil || disk.Source.File == nil {
+			continue
+		}
+		// Opening encrypted disks requires their key, which is not part of the domain description.
+		if disk.Source.Encryption != nil {
+			continue
+		}
+
+		file := disk.Source.File.File
+		log.V(1).Info("Checking qcow2 disk", "File", file)
+		result, err := r.qcow2.Check(file, opts...)
+		if err != nil {
+			return fmt.Errorf("error checking qcow2 disk %s: %w", file, err)
+		}
+
+		if result.LeaksFixed > 0 {
+			r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, machineEvent.ReasonRepairedDisk, "Repaired %d leaked clusters of disk %s", result.LeaksFixed, diskName(disk))
+		}
+		if running && result.Leaks > 0 {
+			log.V(1).Info("Tolerating leaked clusters of disk in use", "File", file, "Leaks", result.Leaks)
+			result.Leaks = 0
+		}
+		if !result.Clean() {
+			r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, machineEvent.ReasonCorruptDisk, "Disk %s has %d corruptions, %d leaked clusters and %d check errors", diskName(disk), result.Corruptions, result.Leaks, result.CheckErrors)
+			return fmt.Errorf("%w: %s", errCorruptQcow2Disk, file)
+		}
+	}
+	return nil
+}
+
+func diskName(disk libvirtxml.DomainDisk) string {
+	if disk.Alias != nil && disk.Alias.Name != "" {
+		return disk.Alias.Name
+	}
+	return disk.Source.File.File
+}
@@ -0,0 +1,127 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"sync"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/ironcore-dev/libvirt-provider/internal/qcow2"
+	"github.com/ironcore-dev/libvirt-provider/pkg/libvirt/fake"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"libvirt.org/go/libvirtxml"
+)
+
+// qcow2Check is a check of a qcow2 disk.
+type qcow2Check struct {
+	file string
+	opts qcow2.CheckOptions
+}
+
+// checkedDisks is a qcow2.QCow2 recording the checks of disks. Disks checked in shared mode get the shared
+// result, others the exclusive one.
+type checkedDisks struct {
+	backingFiles
+
+	mu        sync.Mutex
+	checks    []qcow2Check
+	shared    qcow2.CheckResult
+	exclusive qcow2.CheckResult
+}
+
+func (d *checkedDisks) Check(file string, opts ...qcow2.CheckOption) (*qcow2.CheckResult, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	o := qcow2.CheckOptions{}
+	o.ApplyOptions(opts)
+	d.checks = append(d.checks, qcow2Check{file: file, opts: o})
+	if o.ForceShare {
+		result := d.shared
+		return &result, nil
+	}
+	result := d.exclusive
+	return &result, nil
+}
+
+func (d *checkedDisks) getChecks() []qcow2Check {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]qcow2Check(nil), d.checks...)
+}
+
+var _ = Describe("Qcow2 checks", func() {
+	var (
+		env   *testEnv
+		disks *checkedDisks
+	)
+
+	BeforeEach(func() {
+		env = setupTestEnv()
+		disks = &checkedDisks{}
+	})
+
+	// createAutostartedDomain creates a running domain with a qcow2 disk for a new machine, like libvirtd does
+	// on its startup.
+	createAutostartedDomain := func(ctx SpecContext) string {
+		machine, err := env.machines.Create(ctx, newMachine())
+		Expect(err).NotTo(HaveOccurred())
+
+		domainDesc := &libvirtxml.Domain{
+			Type: "kvm",
+			Name: machine.ID,
+			UUID: machine.ID,
+			Devices: &libvirtxml.DomainDeviceList{
+				Disks: []libvirtxml.DomainDisk{{
+					Driver: &libvirtxml.DomainDiskDriver{Name: "qemu", Type: "qcow2"},
+					Source: &libvirtxml.DomainDiskSource{File: &libvirtxml.DomainDiskSourceFile{File: "/var/lib/disk.qcow2"}},
+					Target: &libvirtxml.DomainDiskTarget{Dev: "vda", Bus: "virtio"},
+				}},
+			},
+		}
+		domainXMLData, err := domainDesc.Marshal()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = env.libvirt.DomainCreateXML(domainXMLData, libvirt.DomainNone)
+		Expect(err).NotTo(HaveOccurred())
+		return machine.ID
+	}
+
+	It("should destroy autostarted domains with corrupt disks", func(ctx SpecContext) {
+		disks.shared = qcow2.CheckResult{Corruptions: 1}
+		machineID := createAutostartedDomain(ctx)
+		start(env.newReconciler(MachineReconcilerOptions{CheckQcow2Disks: true, QCow2: disks}))
+
+		By("waiting for the domain to be created again without the disk of the destroyed one")
+		Eventually(func() bool {
+			domainDesc, state, ok := env.libvirt.Domain(machineID)
+			if !ok || state != libvirt.DomainRunning {
+				return false
+			}
+			return domainDesc.Devices == nil || len(domainDesc.Devices.Disks) == 0
+		}).Should(BeTrue())
+		Expect(disks.getChecks()).To(Equal([]qcow2Check{{file: "/var/lib/disk.qcow2", opts: qcow2.CheckOptions{ForceShare: true}}}))
+	})
+
+	It("should tolerate leaks of autostarted domains and check them once", func(ctx SpecContext) {
+		disks.shared = qcow2.CheckResult{Leaks: 3}
+		machineID := createAutostartedDomain(ctx)
+		start(env.newReconciler(MachineReconcilerOptions{CheckQcow2Disks: true, QCow2: disks}))
+
+		Eventually(disks.getChecks).Should(HaveLen(1))
+		Consistently(disks.getChecks, "500ms").Should(HaveLen(1))
+		Expect(machineID).To(fake.HaveDomainState(env.libvirt, libvirt.DomainRunning))
+		domainDesc, _, _ := env.libvirt.Domain(machineID)
+		Expect(domainDesc.Devices.Disks).To(ContainElement(HaveField("Source.File.File", "/var/lib/disk.qcow2")))
+	})
+
+	It("should not check the disks of autostarted domains if disabled", func(ctx SpecContext) {
+		disks.shared = qcow2.CheckResult{Corruptions: 1}
+		machineID := createAutostartedDomain(ctx)
+		start(env.newReconciler(MachineReconcilerOptions{QCow2: disks}))
+
+		Consistently(disks.getChecks, "500ms").Should(BeEmpty())
+		Expect(machineID).To(fake.HaveDomainState(env.libvirt, libvirt.DomainRunning))
+	})
+})
@@ -0,0 +1,243 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/event"
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// queuePriority is the priority class of a queued machine. Higher classes are processed first.
+type queuePriority int
+
+const (
+	// queuePriorityResync is used for periodic resyncs of machines that did not change.
+	queuePriorityResync queuePriority = iota
+	// queuePriorityCreate is used for machines that have just been created.
+	queuePriorityCreate
+	// queuePriorityUpdate is used for all other changes of machines.
+	queuePriorityUpdate
+	// queuePriorityRecovery is used for machines whose last reconciliation failed.
+	queuePriorityRecovery
+	// queuePriorityPower is used for machines whose domain has to be started or stopped to match their
+	// desired power state.
+	queuePriorityPower
+	// queuePriorityDelete is used for machines being deleted, so their capacity is freed up first.
+	queuePriorityDelete
+
+	numQueuePriorities = int(queuePriorityDelete) + 1
+)
+
+// priorityQueue is a workqueue.Queue that pops machines of higher priority classes first and
+// machines of the same class in FIFO order.
+// Priorities are requested via setPriority before adding a machine to the workqueue. The highest
+// priority requested since the machine was last popped wins. Priorities of rate limited adds are requested via
+// setDelayedPriority instead, as the machine may be popped before the delayed add pushes it.
+type priorityQueue struct {
+	mu sync.Mutex
+	// requested holds the requested priorities of the machines not popped yet.
+	requested map[string]queuePriority
+	// delayed holds the priorities of rate limited adds of the machines not pushed or touched yet.
+	delayed map[string]queuePriority
+	// queued holds the priority class of the queued machines.
+	queued map[string]queuePriority
+	queues [numQueuePriorities][]string
+}
+
+var _ workqueue.Queue[string] = (*priorityQueue)(nil)
+
+func newPriorityQueue() *priorityQueue {
+	return &priorityQueue{
+		requested: make(map[string]queuePriority),
+		delayed:   make(map[string]queuePriority),
+		queued:    make(map[string]queuePriority),
+	}
+}
+
+func (q *priorityQueue) setPriority(id string, priority queuePriority) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if current, ok := q.requested[id]; !ok || priority > current {
+		q.requested[id] = priority
+	}
+}
+
+// setDelayedPriority requests the priority for the next push or touch of the machine, even if it is popped before.
+func (q *priorityQueue) setDelayedPriority(id string, priority queuePriority) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if current, ok := q.delayed[id]; !ok || priority > current {
+		q.delayed[id] = priority
+	}
+}
+
+// takePriority returns the highest priority requested for the machine, or queuePriorityUpdate if none was, and
+// forgets the delayed one.
+func (q *priorityQueue) takePriority(id string) queuePriority {
+	priority, requested := q.requested[id]
+	if delayed, ok := q.delayed[id]; ok {
+		delete(q.delayed, id)
+		if !requested || delayed > priority {
+			return delayed
+		}
+	}
+	if !requested {
+		return queuePriorityUpdate
+	}
+	return priority
+}
+
+// Touch moves an already queued machine to a higher priority class if such has been requested.
+func (q *priorityQueue) Touch(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	current, ok := q.queued[id]
+	if !ok {
+		return
+	}
+
+	priority := q.takePriority(id)
+	if priority <= current {
+		return
+	}
+
+	q.queues[current] = slices.DeleteFunc(q.queues[current], func(queued string) bool { return queued == id })
+	q.queues[priority] = append(q.queues[priority], id)
+	q.queued[id] = priority
+}
+
+func (q *priorityQueue) Push(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	priority := q.takePriority(id)
+	q.queues[priority] = append(q.queues[priority], id)
+	q.queued[id] = priority
+}
+
+func (q *priorityQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.queued)
+}
+
+// Pop returns the oldest machine of the highest non-empty priority class. It must only be called if Len is positive.
+func (q *priorityQueue) Pop() string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for priority := numQueuePriorities - 1; priority >= 0; priority-- {
+		if len(q.queues[priority]) == 0 {
+			continue
+		}
+
+		id := q.queues[priority][0]
+		q.queues[priority][0] = ""
+		q.queues[priority] = q.queues[priority][1:]
+
+		delete(q.queued, id)
+		delete(q.requested, id)
+		return id
+	}
+	return ""
+}
+
+const (
+	// DefaultBackoffBaseDelay is the default delay of the first retry of a failed machine.
+	DefaultBackoffBaseDelay = 5 * time.Millisecond
+	// DefaultBackoffMaxDelay is the default maximum delay of retries of a failed machine.
+	DefaultBackoffMaxDelay = 1000 * time.Second
+)
+
+// BackoffOptions configure the per-machine exponential backoff of failed reconciliations.
+type BackoffOptions struct {
+	// BaseDelay is the delay of the first retry, doubled on every further failure. Defaults to
+	// DefaultBackoffBaseDelay.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay of retries. Defaults to DefaultBackoffMaxDelay.
+	MaxDelay time.Duration
+}
+
+func (o BackoffOptions) validate() error {
+	if o.BaseDelay <= 0 {
+		return fmt.Errorf("backoff base delay must be positive")
+	}
+	if o.MaxDelay < o.BaseDelay {
+		return fmt.Errorf("backoff max delay must not be less than the base delay")
+	}
+	return nil
+}
+
+// newMachineQueue creates a rate limited workqueue on top of the given priority queue.
+// Besides the per-machine backoff, rate limited adds of all machines are limited like by
+// workqueue.DefaultTypedControllerRateLimiter.
+func newMachineQueue(priorities *priorityQueue, backoff BackoffOptions) workqueue.TypedRateLimitingInterface[string] {
+	return workqueue.NewTypedRateLimitingQueueWithConfig[string](
+		workqueue.NewTypedMaxOfRateLimiter[string](
+			workqueue.NewTypedItemExponentialFailureRateLimiter[string](backoff.BaseDelay, backoff.MaxDelay),
+			&workqueue.TypedBucketRateLimiter[string]{Limiter: rate.NewLimiter(rate.Limit(10), 100)},
+		),
+		workqueue.TypedRateLimitingQueueConfig[string]{
+			DelayingQueue: workqueue.NewTypedDelayingQueueWithConfig[string](workqueue.TypedDelayingQueueConfig[string]{
+				Queue: workqueue.NewTypedWithConfig[string](workqueue.TypedQueueConfig[string]{
+					Queue: priorities,
+				}),
+			}),
+		},
+	)
+}
+
+// eventPriority determines the priority of a machine from the event that triggered its reconciliation.
+func eventPriority(evt event.Event[*api.Machine]) queuePriority {
+	switch {
+	case evt.Type == event.TypeDeleted || evt.Object.DeletedAt != nil:
+		return queuePriorityDelete
+	case evt.Type == event.TypeCreated:
+		return queuePriorityCreate
+	case evt.Object.Spec.Power != evt.Object.Status.Power:
+		return queuePriorityPower
+	case evt.Type == event.TypeGeneric:
+		return queuePriorityResync
+	default:
+		return queuePriorityUpdate
+	}
+}
+
+// enqueue adds the machine with the given priority.
+func (r *MachineReconciler) enqueue(id string, priority queuePriority) {
+	r.priorities.setPriority(id, priority)
+	r.queue.Add(id)
+}
+
+// enqueueRateLimited adds the machine with the given priority after the rate limiter says it's ok.
+func (r *MachineReconciler) enqueueRateLimited(id string, priority queuePriority) {
+	r.priorities.setDelayedPriority(id, priority)
+	r.queue.AddRateLimited(id)
+}
+
+// enqueueAll adds all machines with the given priority.
+func (r *MachineReconciler) enqueueAll(ctx context.Context, log logr.Logger, priority queuePriority) {
+	machines, err := r.machines.List(ctx)
+	if err != nil {
+		log.Error(err, "failed to list machines")
+		return
+	}
+
+	for _, machine := range machines {
+		r.enqueue(machine.ID, priority)
+	}
+}
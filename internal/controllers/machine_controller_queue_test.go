@@ -0,0 +1,163 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"time"
+
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/event"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// popAll pops all machines of the queue in order.
+func popAll(q *priorityQueue) []string {
+	var ids []string
+	for q.Len() > 0 {
+		ids = append(ids, q.Pop())
+	}
+	return ids
+}
+
+var _ = Describe("Priority queue", func() {
+	It("should pop higher priority classes first and the same class in fifo order", func() {
+		q := newPriorityQueue()
+		for id, priority := range map[string]queuePriority{
+			"create":   queuePriorityCreate,
+			"delete":   queuePriorityDelete,
+			"recovery": queuePriorityRecovery,
+		} {
+			q.setPriority(id, priority)
+		}
+
+		for _, id := range []string{"update-1", "create", "recovery", "update-2", "delete"} {
+			q.Push(id)
+		}
+		Expect(q.Len()).To(Equal(5))
+		Expect(popAll(q)).To(Equal([]string{"delete", "recovery", "update-1", "update-2", "create"}))
+		Expect(q.Pop()).To(BeEmpty())
+	})
+
+	It("should keep the highest priority requested since the machine was popped", func() {
+		q := newPriorityQueue()
+		q.setPriority("a", queuePriorityDelete)
+		q.setPriority("a", queuePriorityCreate)
+		q.Push("a")
+		q.Push("b")
+		Expect(popAll(q)).To(Equal([]string{"a", "b"}))
+
+		By("forgetting the requested priority once popped")
+		q.Push("b")
+		q.Push("a")
+		Expect(popAll(q)).To(Equal([]string{"b", "a"}))
+	})
+
+	It("should move queued machines to a higher priority class on touch", func() {
+		q := newPriorityQueue()
+		q.Push("a")
+		q.Push("b")
+
+		By("ignoring a lower priority")
+		q.setPriority("b", queuePriorityCreate)
+		q.Touch("b")
+		Expect(q.Len()).To(Equal(2))
+
+		By("re-prioritising to a higher priority")
+		q.setPriority("b", queuePriorityDelete)
+		q.Touch("b")
+		q.Touch("unknown")
+		Expect(q.Len()).To(Equal(2))
+		Expect(popAll(q)).To(Equal([]string{"b", "a"}))
+	})
+
+	It("should keep the priority of rate limited adds until the machine is pushed again", func() {
+		q := newPriorityQueue()
+		q.Push("a")
+		q.setDelayedPriority("a", queuePriorityRecovery)
+		Expect(popAll(q)).To(Equal([]string{"a"}))
+
+		By("pushing the machine with the delayed priority")
+		q.Push("b")
+		q.Push("a")
+		Expect(popAll(q)).To(Equal([]string{"a", "b"}))
+
+		By("forgetting the delayed priority once pushed")
+		q.Push("b")
+		q.Push("a")
+		Expect(popAll(q)).To(Equal([]string{"b", "a"}))
+
+		By("moving a queued machine to the delayed priority on touch")
+		q.Push("b")
+		q.Push("a")
+		q.setDelayedPriority("a", queuePriorityRecovery)
+		q.Touch("a")
+		Expect(popAll(q)).To(Equal([]string{"a", "b"}))
+	})
+
+	It("should keep the priority of rate limited adds of machines popped before the delayed add", func() {
+		q := newPriorityQueue()
+		queue := newMachineQueue(q, BackoffOptions{BaseDelay: 100 * time.Millisecond, MaxDelay: 100 * time.Millisecond})
+		DeferCleanup(queue.ShutDown)
+		r := &MachineReconciler{priorities: q, queue: queue}
+
+		queue.Add("a")
+		r.enqueueRateLimited("a", queuePriorityRecovery)
+
+		By("popping the machine before the delayed add")
+		id, _ := queue.Get()
+		Expect(id).To(Equal("a"))
+		queue.Done(id)
+		queue.Add("b")
+
+		By("popping the delayed machine first")
+		Eventually(queue.Len).Should(Equal(2))
+		id, _ = queue.Get()
+		Expect(id).To(Equal("a"))
+		queue.Done(id)
+	})
+
+	It("should deduplicate machines and re-prioritise them in the workqueue", func() {
+		q := newPriorityQueue()
+		queue := workqueue.NewTypedWithConfig[string](workqueue.TypedQueueConfig[string]{Queue: q})
+		DeferCleanup(queue.ShutDown)
+
+		queue.Add("a")
+		queue.Add("b")
+		queue.Add("a")
+		Expect(queue.Len()).To(Equal(2))
+
+		q.setPriority("b", queuePriorityDelete)
+		queue.Add("b")
+		Expect(queue.Len()).To(Equal(2))
+
+		id, _ := queue.Get()
+		Expect(id).To(Equal("b"))
+		queue.Done(id)
+		id, _ = queue.Get()
+		Expect(id).To(Equal("a"))
+		queue.Done(id)
+	})
+})
+
+var _ = Describe("Event priority", func() {
+	newEvent := func(typ event.Type) event.Event[*api.Machine] {
+		return event.Event[*api.Machine]{Type: typ, Object: &api.Machine{}}
+	}
+
+	It("should prioritise deletions", func() {
+		Expect(eventPriority(newEvent(event.TypeDeleted))).To(Equal(queuePriorityDelete))
+
+		evt := newEvent(event.TypeUpdated)
+		now := time.Now()
+		evt.Object.DeletedAt = &now
+		Expect(eventPriority(evt)).To(Equal(queuePriorityDelete))
+	})
+
+	It("should prioritise creations below updates", func() {
+		Expect(eventPriority(newEvent(event.TypeCreated))).To(Equal(queuePriorityCreate))
+		Expect(eventPriority(newEvent(event.TypeUpdated))).To(Equal(queuePriorityUpdate))
+	})
+})
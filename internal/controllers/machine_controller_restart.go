@@ -0,0 +1,298 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	machineEvent "github.com/ironcore-dev/libvirt-provider/internal/event/machineevent"
+	"github.com/ironcore-dev/libvirt-provider/internal/store"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Reasons of the Stopped condition, i.e. why the guest of a machine stopped unexpectedly.
+const (
+	stopReasonCrashed       = "Crashed"
+	stopReasonFailed        = "Failed"
+	stopReasonGuestShutdown = "GuestShutdown"
+)
+
+const (
+	restartBackoffBase = 10 * time.Second
+	restartBackoffMax  = 5 * time.Minute
+	// restartResetInterval is the time a restarted guest has to keep running until its restarts are reset.
+	restartResetInterval = 10 * time.Minute
+	// stopReasonGracePeriod is the time the lifecycle event of a vanished domain gets to record why the guest
+	// stopped, before the domain is recreated.
+	stopReasonGracePeriod = time.Second
+)
+
+// restartBackoff returns the time a stopped guest is kept stopped before it is restarted.
+// The backoff doubles with every consecutive restart of the machine.
+func restartBackoff(restarts int32) time.Duration {
+	backoff := restartBackoffBase
+	for i := int32(0); i < restarts && backoff < restartBackoffMax; i++ {
+		backoff *= 2
+	}
+	return min(backoff, restartBackoffMax)
+}
+
+// restartPolicy returns the restart policy of the machine, which defaults to api.RestartPolicyAlways.
+func restartPolicy(machine *api.Machine) api.RestartPolicy {
+	if machine.Spec.RestartPolicy == "" {
+		return api.RestartPolicyAlways
+	}
+	return machine.Spec.RestartPolicy
+}
+
+// restartsOnStop reports whether the policy restarts guests that stopped for the given reason.
+func restartsOnStop(policy api.RestartPolicy, reason string) bool {
+	switch policy {
+	case api.RestartPolicyAlways:
+		return true
+	case api.RestartPolicyOnFailure:
+		return reason != stopReasonGuestShutdown
+	default:
+		return false
+	}
+}
+
+// eventStopReason returns the reason of the Stopped condition of a guest stopped with the detail of a lifecycle
+// event. Stops not caused by the guest or its QEMU process, e.g. destroying the domain, have no reason.
+func eventStopReason(detail libvirt.DomainEventStoppedDetailType) (string, bool) {
+	switch detail {
+	case libvirt.DomainEventStoppedShutdown:
+		return stopReasonGuestShutdown, true
+	case libvirt.DomainEventStoppedCrashed:
+		return stopReasonCrashed, true
+	case libvirt.DomainEventStoppedFailed:
+		return stopReasonFailed, true
+	default:
+		return "", false
+	}
+}
+
+// shutoffStopReason returns the reason of the Stopped condition of a guest whose domain is shut off for the
+// reason reported by DomainGetState.
+func shutoffStopReason(reason libvirt.DomainShutoffReason) (string, bool) {
+	switch reason {
+	case libvirt.DomainShutoffShutdown:
+		return stopReasonGuestShutdown, true
+	case libvirt.DomainShutoffCrashed:
+		return stopReasonCrashed, true
+	case libvirt.DomainShutoffFailed:
+		return stopReasonFailed, true
+	default:
+		return "", false
+	}
+}
+
+// persistStoppedDomain records why the domain of a machine stopped, as reported by a lifecycle event, in the
+// status of the machine. Transient domains vanish once stopped, so the reason can't be taken from the domain
+// state when the machine is reconciled. Domains stopped by the provider itself, e.g. on power off, and domains
+// already running again are not recorded.
+func (r *MachineReconciler) persistStoppedDomain(ctx context.Context, log logr.Logger, machine *api.Machine, detail libvirt.DomainEventStoppedDetailType) {
+	reason, ok := eventStopReason(detail)
+	if !ok {
+		return
+	}
+
+	for {
+		if machine.DeletedAt != nil || machine.Spec.Power == api.PowerStatePowerOff {
+			return
+		}
+		if state, _, err := r.libvirt.DomainGetState(machineDomain(machine), 0); err == nil && libvirt.DomainState(state) != libvirt.DomainShutoff {
+			return
+		}
+		if !markStopped(machine, reason) {
+			return
+		}
+
+		_, err := r.machines.Update(ctx, machine)
+		if err == nil {
+			r.stoppedEvent(log, machine, reason)
+			return
+		}
+		if !errors.Is(err, store.ErrResourceVersionNotLatest) {
+			log.Error(err, "failed to record stopped domain", "machineID", machine.ID, "reason", reason)
+			return
+		}
+
+		if machine, err = r.machines.Get(ctx, machine.ID); err != nil {
+			if !errors.Is(err, store.ErrNotFound) {
+				log.Error(err, "failed to fetch machine from store")
+			}
+			return
+		}
+	}
+}
+
+// awaitStopReason reports whether the domain of a machine vanished while its guest was running and the lifecycle
+// event reporting why has not been persisted by persistStoppedDomain yet. Meanwhile, the Stopped condition is
+// unknown. If no reason is persisted within stopReasonGracePeriod, e.g. as the event was missed while the provider
+// was not running, the domain is recreated without counting a restart.
+func (r *MachineReconciler) awaitStopReason(machine *api.Machine) bool {
+	condition := machine.Status.GetCondition(api.MachineConditionStopped)
+	switch {
+	case condition != nil && condition.Status == api.ConditionUnknown:
+		remaining := time.Until(condition.LastTransitionTime.Add(stopReasonGracePeriod))
+		if remaining <= 0 {
+			return false
+		}
+		r.queue.AddAfter(machine.ID, remaining)
+		return true
+	case condition != nil && condition.Status == api.ConditionTrue:
+		return false
+	case machine.Status.State != api.MachineStateRunning:
+		return false
+	}
+
+	machine.Status.SetCondition(api.MachineCondition{
+		Type:               api.MachineConditionStopped,
+		Status:             api.ConditionUnknown,
+		Reason:             "DomainVanished",
+		Message:            "Waiting for the reason the guest stopped",
+		LastTransitionTime: time.Now(),
+	})
+	r.queue.AddAfter(machine.ID, stopReasonGracePeriod)
+	return true
+}
+
+// setStopped marks the guest of the machine as stopped unexpectedly for the given reason.
+func (r *MachineReconciler) setStopped(log logr.Logger, machine *api.Machine, reason string) {
+	if markStopped(machine, reason) {
+		r.stoppedEvent(log, machine, reason)
+	}
+}
+
+// markStopped sets the Stopped condition of the machine and counts crashes. It reports whether the machine was
+// not known to be stopped before.
+func markStopped(machine *api.Machine, reason string) bool {
+	if condition := machine.Status.GetCondition(api.MachineConditionStopped); condition != nil && condition.Status == api.ConditionTrue {
+		return false
+	}
+
+	now := time.Now()
+	if reason == stopReasonCrashed {
+		machine.Status.Crashes++
+	}
+	machine.Status.SetCondition(api.MachineCondition{
+		Type:               api.MachineConditionStopped,
+		Status:             api.ConditionTrue,
+		Reason:             reason,
+		Message:            fmt.Sprintf("Machine stopped at %s", now.Format(time.RFC3339)),
+		LastTransitionTime: now,
+	})
+	return true
+}
+
+// stoppedEvent emits the event of a guest that stopped unexpectedly for the given reason.
+func (r *MachineReconciler) stoppedEvent(log logr.Logger, machine *api.Machine, reason string) {
+	stoppedAt := machine.Status.GetCondition(api.MachineConditionStopped).LastTransitionTime.Format(time.RFC3339)
+	if reason == stopReasonCrashed {
+		r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, machineEvent.ReasonMachineCrashed, "Machine crashed at %s", stoppedAt)
+		return
+	}
+	r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, machineEvent.ReasonMachineStopped, "Machine stopped unexpectedly at %s: %s", stoppedAt, reason)
+}
+
+// setStoppedMessage updates the message of the Stopped condition and reports whether it changed.
+func setStoppedMessage(machine *api.Machine, message string) bool {
+	condition := machine.Status.GetCondition(api.MachineConditionStopped)
+	if condition.Message == message {
+		return false
+	}
+	condition.Message = message
+	return true
+}
+
+// restartDue reports whether the guest of the machine is to be started. Guests that stopped unexpectedly are
+// restarted according to the restart policy of the machine, once their backoff has passed and as long as the
+// restart limit is not reached.
+func (r *MachineReconciler) restartDue(log logr.Logger, machine *api.Machine) bool {
+	condition := machine.Status.GetCondition(api.MachineConditionStopped)
+	if condition == nil || condition.Status != api.ConditionTrue {
+		return true
+	}
+
+	if policy := restartPolicy(machine); !restartsOnStop(policy, condition.Reason) {
+		if setStoppedMessage(machine, fmt.Sprintf("Not restarted due to restart policy %s", policy)) {
+			r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, machineEvent.ReasonNotRestarted, "Machine is not restarted due to restart policy %s", policy)
+		}
+		return false
+	}
+
+	if r.maxRestarts > 0 && machine.Status.Restarts >= r.maxRestarts {
+		if setStoppedMessage(machine, fmt.Sprintf("Not restarted after %d restarts", machine.Status.Restarts)) {
+			r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, machineEvent.ReasonRestartLimitReached, "Machine is not restarted after %d restarts, power it off and on to retry", machine.Status.Restarts)
+		}
+		return false
+	}
+
+	if remaining := time.Until(condition.LastTransitionTime.Add(restartBackoff(machine.Status.Restarts))); remaining > 0 {
+		log.V(1).Info("Delaying restart of stopped machine", "Restarts", machine.Status.Restarts, "Remaining", remaining)
+		setStoppedMessage(machine, "Waiting for restart backoff")
+		r.queue.AddAfter(machine.ID, remaining)
+		return false
+	}
+	return true
+}
+
+// setRestarted records the restart of a guest that stopped unexpectedly. Guests whose domain vanished for an
+// unknown reason are not counted.
+func (r *MachineReconciler) setRestarted(log logr.Logger, machine *api.Machine) {
+	condition := machine.Status.GetCondition(api.MachineConditionStopped)
+	if condition == nil || condition.Status == api.ConditionFalse {
+		return
+	}
+
+	if condition.Status == api.ConditionTrue {
+		machine.Status.Restarts++
+		r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, machineEvent.ReasonRestarted, "Machine restarted after it stopped unexpectedly (%s), restart %d", condition.Reason, machine.Status.Restarts)
+	}
+	machine.Status.SetCondition(api.MachineCondition{
+		Type:               api.MachineConditionStopped,
+		Status:             api.ConditionFalse,
+		Reason:             "Restarted",
+		LastTransitionTime: time.Now(),
+	})
+}
+
+// resetStopped forgets that the guest of a machine stopped unexpectedly, e.g. once the machine is powered off.
+func (r *MachineReconciler) resetStopped(machine *api.Machine) {
+	machine.Status.Restarts = 0
+	machine.Status.Crashes = 0
+	if condition := machine.Status.GetCondition(api.MachineConditionStopped); condition != nil && condition.Status != api.ConditionFalse {
+		machine.Status.SetCondition(api.MachineCondition{
+			Type:               api.MachineConditionStopped,
+			Status:             api.ConditionFalse,
+			Reason:             "PoweredOff",
+			LastTransitionTime: time.Now(),
+		})
+	}
+}
+
+// reconcileRestarts resets the restarts and crashes of a machine whose guest keeps running after its last restart.
+func (r *MachineReconciler) reconcileRestarts(machine *api.Machine, state api.MachineState) {
+	if (machine.Status.Restarts == 0 && machine.Status.Crashes == 0) || state != api.MachineStateRunning {
+		return
+	}
+
+	condition := machine.Status.GetCondition(api.MachineConditionStopped)
+	if condition == nil || condition.Status != api.ConditionFalse {
+		return
+	}
+	if remaining := time.Until(condition.LastTransitionTime.Add(restartResetInterval)); remaining > 0 {
+		r.queue.AddAfter(machine.ID, remaining)
+		return
+	}
+	machine.Status.Restarts = 0
+	machine.Status.Crashes = 0
+}
@@ -0,0 +1,232 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/pkg/libvirt/fake"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"libvirt.org/go/libvirtxml"
+)
+
+var _ = Describe("Restarts", func() {
+	DescribeTable("restartBackoff",
+		func(restarts int32, expected time.Duration) {
+			Expect(restartBackoff(restarts)).To(Equal(expected))
+		},
+		Entry("without restarts", int32(0), restartBackoffBase),
+		Entry("doubling per restart", int32(1), 2*restartBackoffBase),
+		Entry("doubling per restart", int32(3), 8*restartBackoffBase),
+		Entry("capped", int32(5), restartBackoffMax),
+		Entry("capped without overflow", int32(1000), restartBackoffMax),
+	)
+
+	DescribeTable("restartsOnStop",
+		func(policy api.RestartPolicy, reason string, expected bool) {
+			Expect(restartsOnStop(policy, reason)).To(Equal(expected))
+		},
+		Entry("Always on guest shutdown", api.RestartPolicyAlways, stopReasonGuestShutdown, true),
+		Entry("Always on crash", api.RestartPolicyAlways, stopReasonCrashed, true),
+		Entry("OnFailure on guest shutdown", api.RestartPolicyOnFailure, stopReasonGuestShutdown, false),
+		Entry("OnFailure on crash", api.RestartPolicyOnFailure, stopReasonCrashed, true),
+		Entry("OnFailure on failure", api.RestartPolicyOnFailure, stopReasonFailed, true),
+		Entry("Never on guest shutdown", api.RestartPolicyNever, stopReasonGuestShutdown, false),
+		Entry("Never on crash", api.RestartPolicyNever, stopReasonCrashed, false),
+	)
+
+	DescribeTable("eventStopReason",
+		func(detail libvirt.DomainEventStoppedDetailType, expected string, expectedOK bool) {
+			reason, ok := eventStopReason(detail)
+			Expect(ok).To(Equal(expectedOK))
+			Expect(reason).To(Equal(expected))
+		},
+		Entry("guest shutdown", libvirt.DomainEventStoppedShutdown, stopReasonGuestShutdown, true),
+		Entry("crash", libvirt.DomainEventStoppedCrashed, stopReasonCrashed, true),
+		Entry("failure", libvirt.DomainEventStoppedFailed, stopReasonFailed, true),
+		Entry("destroyed", libvirt.DomainEventStoppedDestroyed, "", false),
+		Entry("saved", libvirt.DomainEventStoppedSaved, "", false),
+	)
+
+	DescribeTable("shutoffStopReason",
+		func(reason libvirt.DomainShutoffReason, expected string, expectedOK bool) {
+			stopReason, ok := shutoffStopReason(reason)
+			Expect(ok).To(Equal(expectedOK))
+			Expect(stopReason).To(Equal(expected))
+		},
+		Entry("guest shutdown", libvirt.DomainShutoffShutdown, stopReasonGuestShutdown, true),
+		Entry("crash", libvirt.DomainShutoffCrashed, stopReasonCrashed, true),
+		Entry("failure", libvirt.DomainShutoffFailed, stopReasonFailed, true),
+		Entry("destroyed", libvirt.DomainShutoffDestroyed, "", false),
+		Entry("unknown", libvirt.DomainShutoffUnknown, "", false),
+	)
+
+	Describe("restartDue", func() {
+		var r *MachineReconciler
+
+		BeforeEach(func() {
+			r = setupTestEnv().newReconciler(MachineReconcilerOptions{MaxRestarts: 10})
+		})
+
+		// stoppedMachine returns a machine with the policy whose guest stopped for the reason stoppedFor ago.
+		stoppedMachine := func(policy api.RestartPolicy, reason string, stoppedFor time.Duration, restarts int32) *api.Machine {
+			machine := newMachine()
+			machine.Spec.RestartPolicy = policy
+			machine.Status.Restarts = restarts
+			machine.Status.SetCondition(api.MachineCondition{
+				Type:               api.MachineConditionStopped,
+				Status:             api.ConditionTrue,
+				Reason:             reason,
+				LastTransitionTime: time.Now().Add(-stoppedFor),
+			})
+			return machine
+		}
+
+		It("should start machines that did not stop unexpectedly", func() {
+			Expect(r.restartDue(GinkgoLogr, newMachine())).To(BeTrue())
+		})
+
+		DescribeTable("stopped machines",
+			func(policy api.RestartPolicy, reason string, stoppedFor time.Duration, restarts int32, expected bool, message string) {
+				machine := stoppedMachine(policy, reason, stoppedFor, restarts)
+				Expect(r.restartDue(GinkgoLogr, machine)).To(Equal(expected))
+				Expect(machine.Status.GetCondition(api.MachineConditionStopped).Message).To(Equal(message))
+			},
+			Entry("Always after the backoff", api.RestartPolicyAlways, stopReasonGuestShutdown, restartBackoffBase, int32(0), true, ""),
+			Entry("Always within the backoff", api.RestartPolicyAlways, stopReasonCrashed, time.Second, int32(0), false, "Waiting for restart backoff"),
+			Entry("Always within the doubled backoff", api.RestartPolicyAlways, stopReasonCrashed, restartBackoffBase, int32(1), false, "Waiting for restart backoff"),
+			Entry("Always within the capped backoff", api.RestartPolicyAlways, stopReasonCrashed, restartBackoffMax-time.Second, int32(8), false, "Waiting for restart backoff"),
+			Entry("Always after the capped backoff", api.RestartPolicyAlways, stopReasonCrashed, restartBackoffMax, int32(8), true, ""),
+			Entry("Always at the restart limit", api.RestartPolicyAlways, stopReasonCrashed, restartBackoffMax, int32(10), false, "Not restarted after 10 restarts"),
+			Entry("defaulting to Always", api.RestartPolicy(""), stopReasonGuestShutdown, restartBackoffBase, int32(0), true, ""),
+			Entry("OnFailure on crash", api.RestartPolicyOnFailure, stopReasonCrashed, restartBackoffBase, int32(0), true, ""),
+			Entry("OnFailure on guest shutdown", api.RestartPolicyOnFailure, stopReasonGuestShutdown, restartBackoffBase, int32(0), false, "Not restarted due to restart policy OnFailure"),
+			Entry("Never", api.RestartPolicyNever, stopReasonCrashed, restartBackoffMax, int32(0), false, "Not restarted due to restart policy Never"),
+		)
+	})
+
+	Describe("awaitStopReason", func() {
+		var r *MachineReconciler
+
+		BeforeEach(func() {
+			r = setupTestEnv().newReconciler(MachineReconcilerOptions{})
+		})
+
+		machineWithStopped := func(state api.MachineState, status api.ConditionStatus, stoppedFor time.Duration) *api.Machine {
+			machine := newMachine()
+			machine.Status.State = state
+			if status != "" {
+				machine.Status.SetCondition(api.MachineCondition{
+					Type:               api.MachineConditionStopped,
+					Status:             status,
+					LastTransitionTime: time.Now().Add(-stoppedFor),
+				})
+			}
+			return machine
+		}
+
+		It("should wait for the reason once the domain of a running guest vanished", func() {
+			machine := machineWithStopped(api.MachineStateRunning, "", 0)
+			Expect(r.awaitStopReason(machine)).To(BeTrue())
+			Expect(machine.Status.GetCondition(api.MachineConditionStopped)).To(SatisfyAll(
+				HaveField("Status", api.ConditionUnknown),
+				HaveField("Reason", "DomainVanished"),
+			))
+
+			By("recreating the domain without counting a restart after the grace period")
+			machine.Status.GetCondition(api.MachineConditionStopped).LastTransitionTime = time.Now().Add(-stopReasonGracePeriod)
+			Expect(r.awaitStopReason(machine)).To(BeFalse())
+			r.setRestarted(GinkgoLogr, machine)
+			Expect(machine.Status.Restarts).To(BeZero())
+			Expect(machine.Status.GetCondition(api.MachineConditionStopped)).To(HaveField("Status", api.ConditionFalse))
+		})
+
+		DescribeTable("machines",
+			func(state api.MachineState, status api.ConditionStatus, stoppedFor time.Duration, expected bool) {
+				Expect(r.awaitStopReason(machineWithStopped(state, status, stoppedFor))).To(Equal(expected))
+			},
+			Entry("without domain yet", api.MachineStatePending, api.ConditionStatus(""), time.Duration(0), false),
+			Entry("powered on again", api.MachineStateTerminated, api.ConditionFalse, time.Duration(0), false),
+			Entry("restarted before", api.MachineStateRunning, api.ConditionFalse, time.Minute, true),
+			Entry("within the grace period", api.MachineStateTerminated, api.ConditionUnknown, time.Duration(0), true),
+			Entry("after the grace period", api.MachineStateTerminated, api.ConditionUnknown, stopReasonGracePeriod, false),
+			Entry("with the reason persisted", api.MachineStateRunning, api.ConditionTrue, time.Duration(0), false),
+		)
+	})
+
+	DescribeTable("reconcileRestarts",
+		func(state api.MachineState, runningFor time.Duration, expectedReset bool) {
+			r := setupTestEnv().newReconciler(MachineReconcilerOptions{})
+			machine := newMachine()
+			machine.Status.Restarts = 2
+			machine.Status.Crashes = 1
+			machine.Status.SetCondition(api.MachineCondition{
+				Type:               api.MachineConditionStopped,
+				Status:             api.ConditionFalse,
+				Reason:             "Restarted",
+				LastTransitionTime: time.Now().Add(-runningFor),
+			})
+
+			r.reconcileRestarts(machine, state)
+			if expectedReset {
+				Expect(machine.Status).To(SatisfyAll(HaveField("Restarts", BeZero()), HaveField("Crashes", BeZero())))
+			} else {
+				Expect(machine.Status).To(SatisfyAll(HaveField("Restarts", BeEquivalentTo(2)), HaveField("Crashes", BeEquivalentTo(1))))
+			}
+		},
+		Entry("running after the reset interval", api.MachineStateRunning, restartResetInterval, true),
+		Entry("running within the reset interval", api.MachineStateRunning, time.Minute, false),
+		Entry("not running", api.MachineStateTerminated, restartResetInterval, false),
+	)
+
+	It("should take the stop reason from a shut off persistent domain", func() {
+		env := setupTestEnv()
+		r := env.newReconciler(MachineReconcilerOptions{})
+		machine := newMachine()
+
+		data, err := (&libvirtxml.Domain{Name: machine.ID, UUID: machine.ID, Type: "kvm"}).Marshal()
+		Expect(err).NotTo(HaveOccurred())
+		domain, err := env.libvirt.DomainDefineXMLFlags(data, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(env.libvirt.DomainCreate(domain)).To(Succeed())
+		Expect(env.libvirt.StopDomain(machine.ID, libvirt.DomainEventStoppedCrashed)).To(Succeed())
+
+		err = r.removeStoppedPersistentDomain(GinkgoLogr, machine, domain)
+		Expect(libvirt.IsNotFound(err)).To(BeTrue())
+		Expect(machine.ID).NotTo(fake.HaveDomain(env.libvirt))
+		Expect(machine.Status.Crashes).To(BeEquivalentTo(1))
+		Expect(machine.Status.GetCondition(api.MachineConditionStopped)).To(SatisfyAll(
+			HaveField("Status", api.ConditionTrue),
+			HaveField("Reason", stopReasonCrashed),
+		))
+	})
+
+	It("should persist the stop reason of a vanished transient domain", func(ctx SpecContext) {
+		env := setupTestEnv()
+		start(env.newReconciler(MachineReconcilerOptions{}))
+
+		machine := newMachine()
+		machine.Spec.RestartPolicy = api.RestartPolicyOnFailure
+		machine, err := env.machines.Create(ctx, machine)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(env.getMachine(machine.ID)).Should(HaveField("Status.State", api.MachineStateRunning))
+
+		By("shutting down the guest")
+		Expect(env.libvirt.StopDomain(machine.ID, libvirt.DomainEventStoppedShutdown)).To(Succeed())
+		Eventually(env.getMachine(machine.ID)).Should(SatisfyAll(
+			HaveField("Status.State", api.MachineStateTerminated),
+			WithTransform(func(machine *api.Machine) *api.MachineCondition {
+				return machine.Status.GetCondition(api.MachineConditionStopped)
+			}, SatisfyAll(
+				HaveField("Status", api.ConditionTrue),
+				HaveField("Reason", stopReasonGuestShutdown),
+				HaveField("Message", "Not restarted due to restart policy OnFailure"),
+			)),
+		))
+		Consistently(machine.ID, 300*time.Millisecond).ShouldNot(fake.HaveDomain(env.libvirt))
+	})
+})
@@ -0,0 +1,232 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	machineEvent "github.com/ironcore-dev/libvirt-provider/internal/event/machineevent"
+	"github.com/ironcore-dev/libvirt-provider/internal/inflight"
+	providerimage "github.com/ironcore-dev/libvirt-provider/internal/oci"
+	"github.com/ironcore-dev/libvirt-provider/internal/osutils"
+	"github.com/ironcore-dev/libvirt-provider/internal/qcow2"
+	"github.com/ironcore-dev/libvirt-provider/internal/raw"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+)
+
+// RootDiskMode determines how the root disks of machines are created from their image.
+type RootDiskMode string
+
+const (
+	// RootDiskModeCopy copies the root fs of the image into a raw disk per machine.
+	RootDiskModeCopy RootDiskMode = "copy"
+	// RootDiskModeOverlay converts the root fs of the image once into a read-only qcow2 base
+	// and creates a thin qcow2 overlay backed by it per machine.
+	RootDiskModeOverlay RootDiskMode = "overlay"
+)
+
+func RootDiskModes() []RootDiskMode {
+	return []RootDiskMode{RootDiskModeCopy, RootDiskModeOverlay}
+}
+
+const baseFilePerm = 0444
+
+// ensureRootFSBase converts the root fs of the image into a qcow2 base unless it exists already.
+// The conversion runs in the background on behalf of waiter, qcow2.ErrConverting is returned until it finished.
+func (r *MachineReconciler) ensureRootFSBase(log logr.Logger, waiter string, rootFS *providerimage.FileLayer) (string, error) {
+	baseFile := filepath.Join(r.host.RootFSBasesDir(), rootFS.Descriptor.Digest.Encoded()+".qcow2")
+
+	r.rootFSBasesMu.Lock()
+	defer r.rootFSBasesMu.Unlock()
+
+	ok, err := osutils.RegularFileExists(baseFile)
+	if err != nil || ok {
+		return baseFile, err
+	}
+
+	if err := r.rootFSConverter.Convert(baseFile, waiter, func(ctx context.Context, progress func(int)) error {
+		return r.convertRootFSBase(ctx, log, rootFS, baseFile, progress)
+	}); err != nil {
+		if errors.Is(err, qcow2.ErrConverting) {
+			return "", err
+		}
+		return "", fmt.Errorf("error converting root fs to qcow2 base: %w", err)
+	}
+	return baseFile, nil
+}
+
+// convertRootFSBase converts the root fs of the image into the qcow2 base file.
+func (r *MachineReconciler) convertRootFSBase(ctx context.Context, log logr.Logger, rootFS *providerimage.FileLayer, baseFile string, progress func(int)) error {
+	log.V(1).Info("Converting root fs to qcow2 base", "Base", baseFile)
+	// Convert to a temporary file first, so an interrupted conversion never leaves a partial base behind.
+	tmpFile := baseFile + ".tmp"
+	_ = os.Remove(tmpFile)
+	if err := r.qcow2.Convert(ctx, rootFS.Path, tmpFile, progress); err != nil {
+		_ = os.Remove(tmpFile)
+		return err
+	}
+
+	r.rootFSBasesMu.Lock()
+	defer r.rootFSBasesMu.Unlock()
+
+	if err := os.Chmod(tmpFile, baseFilePerm); err != nil {
+		return fmt.Errorf("error changing qcow2 base mode: %w", err)
+	}
+	if err := os.Rename(tmpFile, baseFile); err != nil {
+		return fmt.Errorf("error renaming qcow2 base: %w", err)
+	}
+	log.V(1).Info("Converted root fs to qcow2 base", "Base", baseFile)
+	return nil
+}
+
+// rootFSSize returns the virtual size of the root fs disk of the machine. Requested sizes smaller than
+// the root fs of the image are ignored, as the root disk can't be shrunk.
+func (r *MachineReconciler) rootFSSize(log logr.Logger, machine *api.Machine, rootFS *providerimage.FileLayer) (int64, error) {
+	stat, err := os.Stat(rootFS.Path)
+	if err != nil {
+		return 0, fmt.Errorf("error getting root fs size: %w", err)
+	}
+
+	size := machine.Spec.RootDiskBytes
+	if size == 0 {
+		return stat.Size(), nil
+	}
+	if size < stat.Size() {
+		r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, machineEvent.ReasonRootDiskSizeTooSmall, "Requested root disk size %d is smaller than image size %d, keeping image size", size, stat.Size())
+		return stat.Size(), nil
+	}
+	return size, nil
+}
+
+// createRootFS creates the root fs disk from the image root fs unless it exists already.
+// The disk is resized to the requested root disk size of the machine.
+// A disk left behind by an interrupted creation is recreated.
+func (r *MachineReconciler) createRootFS(log logr.Logger, machine *api.Machine, rootFSFile string, rootFS *providerimage.FileLayer) (err error) {
+	op, err := r.operations.Begin(inflight.KindRootFS, machine.ID)
+	if err != nil {
+		return fmt.Errorf("error tracking root fs creation: %w", err)
+	}
+	defer func() { op.Done(err) }()
+
+	ok, err := osutils.RegularFileExists(rootFSFile)
+	if err != nil {
+		return err
+	}
+	if ok && op.Resumed() {
+		log.V(1).Info("Removing root fs disk of interrupted creation")
+		if err := os.Remove(rootFSFile); err != nil {
+			return fmt.Errorf("error removing incomplete root fs disk: %w", err)
+		}
+		ok = false
+	}
+	if ok {
+		return nil
+	}
+
+	size, err := r.rootFSSize(log, machine, rootFS)
+	if err != nil {
+		return err
+	}
+
+	switch r.rootDiskMode {
+	case RootDiskModeOverlay:
+		baseFile, err := r.ensureRootFSBase(log, machine.ID, rootFS)
+		if err != nil {
+			return err
+		}
+		if err := r.qcow2.Create(rootFSFile, qcow2.WithSourceFile(baseFile), qcow2.WithSourceFormat("qcow2"), qcow2.WithSize(size)); err != nil {
+			return fmt.Errorf("error creating root fs overlay: %w", err)
+		}
+	default:
+		if err := r.raw.Create(rootFSFile, raw.WithSourceFile(rootFS.Path), raw.WithSize(size)); err != nil {
+			return fmt.Errorf("error creating root fs disk: %w", err)
+		}
+	}
+	if err := os.Chmod(rootFSFile, filePerm); err != nil {
+		return fmt.Errorf("error changing root fs disk mode: %w", err)
+	}
+	return nil
+}
+
+// rootFSDriverType returns the format of an existing root fs disk, which stays the same if the root disk mode changes.
+func rootFSDriverType(rootFSFile string) (string, error) {
+	ok, err := qcow2.IsQCow2(rootFSFile)
+	if err != nil {
+		return "", fmt.Errorf("error detecting root fs disk format: %w", err)
+	}
+	if ok {
+		return "qcow2", nil
+	}
+	return "raw", nil
+}
+
+// flattenRootFSIfRequested flattens the root fs overlay of a powered off machine into a standalone disk
+// if requested by the FlattenRootDiskAnnotation.
+func (r *MachineReconciler) flattenRootFSIfRequested(log logr.Logger, machine *api.Machine) error {
+	if annotations, err := api.GetAnnotationsAnnotation(machine.Metadata); err != nil || annotations[api.FlattenRootDiskAnnotation] != "true" {
+		return nil
+	}
+
+	rootFSFile := r.host.MachineRootFSFile(machine.ID)
+	if ok, err := osutils.RegularFileExists(rootFSFile); err != nil || !ok {
+		return err
+	}
+	if ok, err := qcow2.IsQCow2(rootFSFile); err != nil || !ok {
+		return err
+	}
+
+	baseFile, err := r.qcow2.BackingFile(rootFSFile)
+	if err != nil {
+		return fmt.Errorf("error getting backing file of root fs disk: %w", err)
+	}
+	if baseFile == "" {
+		return nil
+	}
+
+	log.V(1).Info("Flattening root fs disk", "Base", baseFile)
+	if err := r.qcow2.Flatten(rootFSFile); err != nil {
+		return fmt.Errorf("error flattening root fs disk: %w", err)
+	}
+	r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, machineEvent.ReasonFlattenedRootDisk, "Flattened root disk, it no longer depends on base %s", filepath.Base(baseFile))
+	return nil
+}
+
+// reconcileRebuild rebuilds the root disk of the machine if requested by its spec. The domain is destroyed and
+// the root disk removed, so both are recreated from the image of the machine with the same volumes and network
+// interfaces. Powered off machines get the new root disk on their next power on.
+func (r *MachineReconciler) reconcileRebuild(ctx context.Context, log logr.Logger, machine *api.Machine) error {
+	if machine.Spec.Rebuild == nil || machine.Spec.Rebuild.ID == machine.Status.RebuildID {
+		return nil
+	}
+
+	r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, machineEvent.ReasonRebuilding, "Rebuilding root disk from image %s", ptr.Deref(machine.Spec.Image, ""))
+	domain := machineDomain(machine)
+	if err := r.undefineDomain(log, domain); err != nil {
+		return err
+	}
+	if err := r.destroyDomain(log, machine, domain); err != nil {
+		return err
+	}
+
+	log.V(1).Info("Removing root fs disk to rebuild it", "RebuildID", machine.Spec.Rebuild.ID)
+	if err := os.Remove(r.host.MachineRootFSFile(machine.ID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing root fs disk: %w", err)
+	}
+	// The rebuild is recorded right away, so a failure to create the domain doesn't rebuild the root disk again.
+	machine.Status.RebuildID = machine.Spec.Rebuild.ID
+	machine.Status.State = api.MachineStateTerminated
+	machine.Status.PCIDevices = nil
+	machine.Status.USBDevices = nil
+	if _, err := r.machines.Update(ctx, machine); err != nil {
+		return fmt.Errorf("failed to update rebuild id: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	providerhost "github.com/ironcore-dev/libvirt-provider/internal/host"
+	providerimage "github.com/ironcore-dev/libvirt-provider/internal/oci"
+	"github.com/ironcore-dev/libvirt-provider/internal/qcow2"
+	"github.com/ironcore-dev/libvirt-provider/internal/raw"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"libvirt.org/go/libvirtxml"
+)
+
+// rootFSImage is an image cache serving an image with the given root fs to all machines.
+type rootFSImage struct {
+	noImages
+	rootFS string
+}
+
+func (c rootFSImage) Get(context.Context, string) (*providerimage.Image, error) {
+	return &providerimage.Image{
+		RootFS:    &providerimage.FileLayer{Path: c.rootFS},
+		Kernel:    &providerimage.FileLayer{},
+		InitRAMFs: &providerimage.FileLayer{},
+	}, nil
+}
+
+var _ = Describe("Root fs", func() {
+	writeFile := func(data []byte) string {
+		filename := filepath.Join(GinkgoT().TempDir(), "rootfs")
+		Expect(os.WriteFile(filename, data, 0600)).To(Succeed())
+		return filename
+	}
+
+	DescribeTable("detecting the driver type of an existing root fs disk",
+		func(data []byte, expected string) {
+			driverType, err := rootFSDriverType(writeFile(data))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(driverType).To(Equal(expected))
+		},
+		Entry("qcow2 overlay", append(append([]byte{}, qcow2.Magic...), 0, 0, 0, 3), "qcow2"),
+		Entry("raw disk", make([]byte, 512), "raw"),
+	)
+
+	DescribeTable("sizing the root fs disk",
+		func(requested, expected int64) {
+			r := setupTestEnv().newReconciler(MachineReconcilerOptions{})
+			machine := newMachine()
+			machine.Spec.RootDiskBytes = requested
+
+			rootFS := &providerimage.FileLayer{Path: writeFile(make([]byte, 4096))}
+			Expect(r.rootFSSize(GinkgoLogr, machine, rootFS)).To(Equal(expected))
+		},
+		Entry("the image size if none is requested", int64(0), int64(4096)),
+		Entry("the requested size", int64(8192), int64(8192)),
+		Entry("the image size if the requested size is smaller", int64(1024), int64(4096)),
+	)
+
+	DescribeTable("attaching the root fs disk",
+		func(requested, expectedSize int64, readOnly bool) {
+			env := setupTestEnv()
+			r := env.newReconciler(MachineReconcilerOptions{Raw: raw.Exec{}})
+			r.imageCache = rootFSImage{rootFS: writeFile(make([]byte, 4096))}
+			machine := newMachine()
+			machine.Spec.RootDiskBytes = requested
+			Expect(providerhost.MakeMachineDirs(env.host, machine.ID)).To(Succeed())
+
+			domain := &libvirtxml.Domain{OS: &libvirtxml.DomainOS{}, Devices: &libvirtxml.DomainDeviceList{}}
+			Expect(r.setDomainImage(context.Background(), GinkgoLogr, machine, domain, "example.org/image")).To(Succeed())
+
+			stat, err := os.Stat(env.host.MachineRootFSFile(machine.ID))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stat.Size()).To(Equal(expectedSize))
+
+			Expect(domain.Devices.Disks).To(HaveLen(1))
+			Expect(domain.Devices.Disks[0].ReadOnly != nil).To(Equal(readOnly))
+		},
+		Entry("read-only with the image size", int64(0), int64(4096), true),
+		Entry("writable and resized to the requested size", int64(8192), int64(8192), false),
+	)
+})
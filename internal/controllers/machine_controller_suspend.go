@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	machineEvent "github.com/ironcore-dev/libvirt-provider/internal/event/machineevent"
+	corev1 "k8s.io/api/core/v1"
+	"libvirt.org/go/libvirtxml"
+)
+
+// reconcileSuspend converges a machine that is to be suspended. Its domain is saved to disk via managed save,
+// which requires the domain to be persistent, hence transient domains are defined first. Machines without
+// a domain are not started until they are resumed.
+func (r *MachineReconciler) reconcileSuspend(log logr.Logger, machine *api.Machine) (api.MachineState, error) {
+	domain := machineDomain(machine)
+
+	domainState, _, err := r.libvirt.DomainGetState(domain, 0)
+	if err != nil {
+		if libvirt.IsNotFound(err) {
+			return api.MachineStateTerminated, nil
+		}
+		return "", fmt.Errorf("error getting domain state: %w", err)
+	}
+
+	if libvirt.DomainState(domainState) == libvirt.DomainShutoff {
+		saved, err := r.libvirt.DomainHasManagedSaveImage(domain, 0)
+		if err != nil {
+			return "", fmt.Errorf("error checking for managed save image: %w", err)
+		}
+		if saved == 0 {
+			// The domain stopped without being saved, nothing to resume from.
+			if err := r.undefineDomain(log, domain); err != nil {
+				return "", err
+			}
+			return api.MachineStateTerminated, nil
+		}
+		return api.MachineStateSuspended, nil
+	}
+
+	persistent, err := r.libvirt.DomainIsPersistent(domain)
+	if err != nil {
+		return "", fmt.Errorf("error checking whether domain is persistent: %w", err)
+	}
+	if persistent == 0 {
+		domainXMLData, err := r.libvirt.DomainGetXMLDesc(domain, libvirt.DomainXMLInactive)
+		if err != nil {
+			return "", fmt.Errorf("error getting inactive domain description: %w", err)
+		}
+
+		log.V(1).Info("Defining domain persistently to save it")
+		if domain, err = r.libvirt.DomainDefineXMLFlags(domainXMLData, 0); err != nil {
+			return "", fmt.Errorf("error defining domain: %w", err)
+		}
+	}
+
+	// DomainManagedSave blocks until the memory of the guest is written to disk.
+	log.V(1).Info("Saving domain")
+	if err := r.libvirt.DomainManagedSave(domain, 0); err != nil {
+		return "", fmt.Errorf("error saving domain: %w", err)
+	}
+	r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, machineEvent.ReasonSuspended, "Suspended machine to disk")
+	return api.MachineStateSuspended, nil
+}
+
+// resumeDomain starts a domain that has been suspended to disk, which restores it from its managed save image.
+// Domains are kept persistent only if the autostart policy asks for it.
+func (r *MachineReconciler) resumeDomain(log logr.Logger, machine *api.Machine, domain libvirt.Domain) error {
+	saved, err := r.libvirt.DomainHasManagedSaveImage(domain, 0)
+	if err != nil {
+		return fmt.Errorf("error checking for managed save image: %w", err)
+	}
+	if saved == 0 {
+		return nil
+	}
+
+	if r.qcow2CheckPending(machine) {
+		domainXMLData, err := r.libvirt.DomainGetXMLDesc(domain, libvirt.DomainXMLInactive)
+		if err != nil {
+			return fmt.Errorf("error getting inactive domain description: %w", err)
+		}
+		domainDesc := &libvirtxml.Domain{}
+		if err := domainDesc.Unmarshal(domainXMLData); err != nil {
+			return fmt.Errorf("error unmarshalling domain description: %w", err)
+		}
+		if err := r.checkQcow2DisksOnce(log, machine, domainDesc); err != nil {
+			return err
+		}
+	}
+
+	log.V(1).Info("Restoring domain")
+	if err := r.libvirt.DomainCreate(domain); err != nil {
+		return fmt.Errorf("error restoring domain: %w", err)
+	}
+	r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, machineEvent.ReasonResumed, "Resumed machine from disk")
+
+	if r.domainAutostart == DomainAutostartEnabled {
+		return nil
+	}
+	return r.undefineDomain(log, domain)
+}
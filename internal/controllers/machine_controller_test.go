@@ -0,0 +1,191 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/google/uuid"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/event"
+	"github.com/ironcore-dev/libvirt-provider/internal/event/machineevent"
+	providerhost "github.com/ironcore-dev/libvirt-provider/internal/host"
+	"github.com/ironcore-dev/libvirt-provider/internal/libvirt/guest"
+	providerimage "github.com/ironcore-dev/libvirt-provider/internal/oci"
+	"github.com/ironcore-dev/libvirt-provider/internal/plugins/networkinterface/isolated"
+	providervolume "github.com/ironcore-dev/libvirt-provider/internal/plugins/volume"
+	"github.com/ironcore-dev/libvirt-provider/internal/store"
+	"github.com/ironcore-dev/libvirt-provider/internal/strategy"
+	"github.com/ironcore-dev/libvirt-provider/pkg/libvirt/fake"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// noImages is an image cache without images, the machines of the specs boot without root disk.
+type noImages struct{}
+
+func (noImages) Get(_ context.Context, ref string) (*providerimage.Image, error) {
+	return nil, fmt.Errorf("no image %s", ref)
+}
+
+func (noImages) AddListener(providerimage.Listener) {}
+
+type testEnv struct {
+	libvirt  *fake.Libvirt
+	host     providerhost.LibvirtHost
+	machines *providerhost.Store[*api.Machine]
+	plugins  *providervolume.PluginManager
+}
+
+// setupTestEnv creates a machine store on a temp host dir with the fake libvirt. plugins are the volume plugins
+// of the host.
+func setupTestEnv(plugins ...providervolume.Plugin) *testEnv {
+	lv := fake.SetupLibvirt()
+
+	host, err := providerhost.NewLibvirtAt(GinkgoT().TempDir(), lv)
+	Expect(err).NotTo(HaveOccurred())
+
+	machines, err := providerhost.NewStore(providerhost.Options[*api.Machine]{
+		Dir:            host.MachineStoreDir(),
+		NewFunc:        func() *api.Machine { return &api.Machine{} },
+		CreateStrategy: strategy.MachineStrategy,
+		AttrsStrategy:  strategy.MachineStrategy,
+	})
+	Expect(err).NotTo(HaveOccurred())
+
+	volumePlugins := providervolume.NewPluginManager()
+	Expect(volumePlugins.InitPlugins(host, plugins)).To(Succeed())
+
+	return &testEnv{
+		libvirt:  lv,
+		host:     host,
+		machines: machines,
+		plugins:  volumePlugins,
+	}
+}
+
+// newReconciler creates a MachineReconciler of the env with the isolated network interface plugin.
+func (e *testEnv) newReconciler(opts MachineReconcilerOptions) *MachineReconciler {
+	caps, err := guest.DetectCapabilities(e.libvirt, guest.CapabilitiesOptions{})
+	Expect(err).NotTo(HaveOccurred())
+
+	nicPlugin := isolated.NewPlugin(false)
+	Expect(nicPlugin.Init(e.host)).To(Succeed())
+
+	// Machines created before the reconciler registered its handler are only picked up by a resync.
+	machineEvents, err := event.NewListWatchSource[*api.Machine](e.machines.List, e.machines.Watch, event.ListWatchSourceOptions{
+		ResyncDuration: 100 * time.Millisecond,
+	})
+	Expect(err).NotTo(HaveOccurred())
+
+	opts.GuestCapabilities = caps
+	opts.ImageCache = noImages{}
+	opts.Host = e.host
+	opts.VolumePluginManager = e.plugins
+	opts.NetworkInterfacePlugin = nicPlugin
+	if opts.ResyncIntervalGarbageCollector == 0 {
+		opts.ResyncIntervalGarbageCollector = 100 * time.Millisecond
+	}
+	if opts.ResyncIntervalVolumeSize == 0 {
+		opts.ResyncIntervalVolumeSize = time.Minute
+	}
+	if opts.GuestAgentProbeInterval == 0 {
+		opts.GuestAgentProbeInterval = time.Minute
+	}
+
+	r, err := NewMachineReconciler(
+		GinkgoLogr,
+		e.libvirt,
+		e.machines,
+		machineEvents,
+		machineevent.NewEventStore(GinkgoLogr, machineevent.EventStoreOptions{MachineEventMaxEvents: 10}),
+		opts,
+	)
+	Expect(err).NotTo(HaveOccurred())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	DeferCleanup(cancel)
+	go func() {
+		defer GinkgoRecover()
+		Expect(machineEvents.Start(ctx)).To(Succeed())
+	}()
+	return r
+}
+
+// start runs the reconciler until the spec is done.
+func start(r *MachineReconciler) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	DeferCleanup(func() {
+		cancel()
+		<-done
+	})
+	go func() {
+		defer GinkgoRecover()
+		defer close(done)
+		Expect(r.Start(ctx)).To(Succeed())
+	}()
+}
+
+func newMachine() *api.Machine {
+	return &api.Machine{
+		Metadata: api.Metadata{ID: uuid.NewString()},
+		Spec: api.MachineSpec{
+			CpuMillis:   1000,
+			MemoryBytes: 1024 * 1024 * 1024,
+		},
+	}
+}
+
+func (e *testEnv) getMachine(id string) func() (*api.Machine, error) {
+	return func() (*api.Machine, error) {
+		return e.machines.Get(context.Background(), id)
+	}
+}
+
+var _ = Describe("MachineReconciler", func() {
+	It("should run a machine through its lifecycle", func(ctx SpecContext) {
+		env := setupTestEnv()
+		start(env.newReconciler(MachineReconcilerOptions{
+			StopTimeout:                 time.Second,
+			GCVMGracefulShutdownTimeout: time.Second,
+		}))
+
+		By("creating the machine")
+		machine := newMachine()
+		machine.Annotations = map[string]string{api.TraceParentAnnotation: "00-01000000000000000000000000000000-0200000000000000-01"}
+		machine, err := env.machines.Create(ctx, machine)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(machine.ID).Should(fake.HaveDomainState(env.libvirt, libvirt.DomainRunning))
+		Eventually(env.getMachine(machine.ID)).Should(SatisfyAll(
+			HaveField("Status.State", api.MachineStateRunning),
+			HaveField("Annotations", Not(HaveKey(api.TraceParentAnnotation))),
+		))
+		Expect(env.host.MachineDir(machine.ID)).To(BeADirectory())
+
+		By("powering the machine off")
+		machine, err = env.machines.Get(ctx, machine.ID)
+		Expect(err).NotTo(HaveOccurred())
+		machine.Spec.Power = api.PowerStatePowerOff
+		_, err = env.machines.Update(ctx, machine)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(machine.ID).ShouldNot(fake.HaveDomainState(env.libvirt, libvirt.DomainRunning))
+		Eventually(env.getMachine(machine.ID)).Should(HaveField("Status.Power", api.PowerStatePowerOff))
+
+		By("deleting the machine")
+		Expect(env.machines.Delete(ctx, machine.ID)).To(Succeed())
+
+		Eventually(func() error {
+			_, err := env.machines.Get(ctx, machine.ID)
+			return err
+		}).Should(MatchError(store.ErrNotFound))
+		Expect(machine.ID).NotTo(fake.HaveDomain(env.libvirt))
+		Expect(env.host.MachineDir(machine.ID)).NotTo(BeAnExistingFile())
+	})
+})
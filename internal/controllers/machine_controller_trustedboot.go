@@ -0,0 +1,149 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/attestation"
+	corev1 "k8s.io/api/core/v1"
+	"libvirt.org/go/libvirtxml"
+)
+
+// sevPolicy is the SEV policy of guests: debugging (0x1) and sharing keys with other guests (0x2) are disallowed.
+const sevPolicy = 0x0003
+
+// setDomainTrustedBoot adds the emulated TPM and the launch security requested by the machine.
+// It has to be called once all devices of the domain are set.
+func (r *MachineReconciler) setDomainTrustedBoot(machine *api.Machine, domainDesc *libvirtxml.Domain) error {
+	if machine.Spec.TPM {
+		setDomainTPM(domainDesc)
+	}
+
+	switch machine.Spec.LaunchSecurity {
+	case "":
+		return nil
+	case api.LaunchSecuritySEV:
+		return r.setDomainSEV(domainDesc)
+	default:
+		return fmt.Errorf("unsupported launch security %q", machine.Spec.LaunchSecurity)
+	}
+}
+
+// setDomainTPM adds an emulated TPM 2.0 backed by swtpm. Its state is persisted, so the keys and the
+// sealed secrets of the guest survive the recreation of its transient domain.
+func setDomainTPM(domainDesc *libvirtxml.Domain) {
+	if domainDesc.Devices == nil {
+		domainDesc.Devices = &libvirtxml.DomainDeviceList{}
+	}
+
+	domainDesc.Devices.TPMs = append(domainDesc.Devices.TPMs, libvirtxml.DomainTPM{
+		Model: "tpm-crb",
+		Backend: &libvirtxml.DomainTPMBackend{
+			Emulator: &libvirtxml.DomainTPMBackendEmulator{
+				Version:         "2.0",
+				PersistentState: "yes",
+			},
+		},
+	})
+}
+
+// setDomainSEV encrypts the memory of the domain with AMD SEV. The encryption parameters are taken from the
+// host, virtio devices are switched to the IOMMU platform, as the guest can only share unencrypted memory with
+// them.
+func (r *MachineReconciler) setDomainSEV(domainDesc *libvirtxml.Domain) error {
+	params, _, err := r.libvirt.NodeGetSevInfo(0, 0)
+	if err != nil {
+		return fmt.Errorf("error getting SEV info of host: %w", err)
+	}
+
+	var cbitPos, reducedPhysBits *uint
+	for _, param := range params {
+		value, ok := param.Value.I.(uint32)
+		if !ok {
+			continue
+		}
+		v := uint(value)
+		switch param.Field {
+		case "cbitpos":
+			cbitPos = &v
+		case "reduced-phys-bits":
+			reducedPhysBits = &v
+		}
+	}
+	if cbitPos == nil || reducedPhysBits == nil {
+		return fmt.Errorf("host reported no SEV cbitpos or reduced-phys-bits")
+	}
+
+	policy := uint(sevPolicy)
+	domainDesc.LaunchSecurity = &libvirtxml.DomainLaunchSecurity{
+		SEV: &libvirtxml.DomainLaunchSecuritySEV{
+			CBitPos:         cbitPos,
+			ReducedPhysBits: reducedPhysBits,
+			Policy:          &policy,
+		},
+	}
+
+	if domainDesc.Devices == nil {
+		return nil
+	}
+	for i := range domainDesc.Devices.Disks {
+		disk := &domainDesc.Devices.Disks[i]
+		if disk.Target == nil || disk.Target.Bus != "virtio" {
+			continue
+		}
+		if disk.Driver == nil {
+			disk.Driver = &libvirtxml.DomainDiskDriver{}
+		}
+		disk.Driver.IOMMU = "on"
+	}
+	for i := range domainDesc.Devices.Interfaces {
+		iface := &domainDesc.Devices.Interfaces[i]
+		if iface.Model == nil || iface.Model.Type != "virtio" {
+			continue
+		}
+		if iface.Driver == nil {
+			iface.Driver = &libvirtxml.DomainInterfaceDriver{}
+		}
+		iface.Driver.IOMMU = "on"
+	}
+	for i := range domainDesc.Devices.Controllers {
+		controller := &domainDesc.Devices.Controllers[i]
+		if controller.Type != "scsi" || controller.Model != "virtio-scsi" {
+			continue
+		}
+		if controller.Driver == nil {
+			controller.Driver = &libvirtxml.DomainControllerDriver{}
+		}
+		controller.Driver.IOMMU = "on"
+	}
+	for i := range domainDesc.Devices.RNGs {
+		rng := &domainDesc.Devices.RNGs[i]
+		if rng.Model != "virtio" {
+			continue
+		}
+		if rng.Driver == nil {
+			rng.Driver = &libvirtxml.DomainRNGDriver{}
+		}
+		rng.Driver.IOMMU = "on"
+	}
+	return nil
+}
+
+// storeLaunchMeasurement stores the SEV launch measurement of the created domain of the machine for attestation.
+// Failures are reported as events only, the measurement is collected again once it is requested.
+func (r *MachineReconciler) storeLaunchMeasurement(log logr.Logger, machine *api.Machine) {
+	measurement, err := attestation.GetLaunchMeasurement(r.libvirt, machineDomain(machine))
+	if err == nil {
+		err = attestation.NewStore(r.host).WriteLaunchMeasurement(machine.ID, measurement)
+	}
+	if err != nil {
+		log.Error(err, "Failed to store launch measurement")
+		r.Eventf(log, machine.Metadata, corev1.EventTypeWarning, "LaunchMeasurementFailed", "Failed to store launch measurement: %s", err)
+		return
+	}
+	log.V(1).Info("Stored launch measurement")
+}
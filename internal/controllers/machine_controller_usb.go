@@ -0,0 +1,203 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	machineEvent "github.com/ironcore-dev/libvirt-provider/internal/event/machineevent"
+	"github.com/ironcore-dev/libvirt-provider/internal/usb"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"libvirt.org/go/libvirtxml"
+)
+
+const usbDeviceAliasPrefix = "ua-usb-"
+
+// usbDeviceResyncInterval is the interval machines with usb devices are reconciled at, to attach devices plugged
+// into the host again.
+const usbDeviceResyncInterval = 30 * time.Second
+
+func usbDeviceAlias(id string) string {
+	return usbDeviceAliasPrefix + strings.NewReplacer(":", "-", ".", "-").Replace(id)
+}
+
+// usbDeviceHostdev returns the hostdev passing the host USB device with the given id at addr through.
+func usbDeviceHostdev(id string, addr usb.Address) *libvirtxml.DomainHostdev {
+	return &libvirtxml.DomainHostdev{
+		Alias: &libvirtxml.DomainAlias{
+			Name: usbDeviceAlias(id),
+		},
+		SubsysUSB: &libvirtxml.DomainHostdevSubsysUSB{
+			Source: &libvirtxml.DomainHostdevSubsysUSBSource{
+				Address: &libvirtxml.DomainAddressUSB{
+					Bus:    &addr.Bus,
+					Device: &addr.Device,
+				},
+			},
+		},
+	}
+}
+
+// usbHostdevAddress returns the host address of a usb hostdev.
+func usbHostdevAddress(hostdev libvirtxml.DomainHostdev) (usb.Address, bool) {
+	if hostdev.SubsysUSB == nil || hostdev.SubsysUSB.Source == nil || hostdev.SubsysUSB.Source.Address == nil {
+		return usb.Address{}, false
+	}
+	address := hostdev.SubsysUSB.Source.Address
+	if address.Bus == nil || address.Device == nil {
+		return usb.Address{}, false
+	}
+	return usb.Address{Bus: *address.Bus, Device: *address.Device}, true
+}
+
+// domainUSBDevices returns the USB device hostdevs of the domain by the id of the device. Devices are matched
+// by their alias with the devices in the spec and status of the machine.
+func domainUSBDevices(machine *api.Machine, domainDesc *libvirtxml.Domain) map[string]libvirtxml.DomainHostdev {
+	idsByAlias := make(map[string]string)
+	for _, id := range machine.Status.USBDevices {
+		idsByAlias[usbDeviceAlias(id)] = id
+	}
+	for _, device := range machine.Spec.USBDevices {
+		idsByAlias[usbDeviceAlias(device.ID)] = device.ID
+	}
+
+	hostdevs := make(map[string]libvirtxml.DomainHostdev)
+	for _, hostdev := range domainDescHostDevices(domainDesc) {
+		if hostdev.Alias == nil || !strings.HasPrefix(hostdev.Alias.Name, usbDeviceAliasPrefix) {
+			continue
+		}
+		id, ok := idsByAlias[hostdev.Alias.Name]
+		if !ok {
+			id = strings.TrimPrefix(hostdev.Alias.Name, usbDeviceAliasPrefix)
+		}
+		hostdevs[id] = hostdev
+	}
+	return hostdevs
+}
+
+// resolveUSBDevice returns the current address of the device. Devices not plugged into the host are no error,
+// they are attached once they are plugged in again.
+func (r *MachineReconciler) resolveUSBDevice(log logr.Logger, device api.USBDeviceSpec) (usb.Address, bool, error) {
+	if r.usbDevices == nil {
+		return usb.Address{}, false, fmt.Errorf("no usb devices configured")
+	}
+
+	addr, err := r.usbDevices.Resolve(device)
+	if err != nil {
+		if errors.Is(err, usb.ErrDeviceNotPresent) {
+			log.V(1).Info("USB device not present, attaching it once plugged in", "ID", device.ID)
+			return usb.Address{}, false, nil
+		}
+		return usb.Address{}, false, err
+	}
+	return addr, true, nil
+}
+
+// setDomainUSBDevices passes the USB devices of the machine plugged into the host through to a new domain.
+func (r *MachineReconciler) setDomainUSBDevices(log logr.Logger, machine *api.Machine, domainDesc *libvirtxml.Domain) error {
+	machine.Status.USBDevices = nil
+	for _, device := range machine.Spec.USBDevices {
+		addr, ok, err := r.resolveUSBDevice(log, device)
+		if err != nil {
+			return fmt.Errorf("[usb device %s] %w", device.ID, err)
+		}
+		if !ok {
+			continue
+		}
+
+		addDomainHostdev(domainDesc, *usbDeviceHostdev(device.ID, addr))
+		machine.Status.USBDevices = append(machine.Status.USBDevices, device.ID)
+	}
+	return nil
+}
+
+// reconcileDomainUSBDevices hot plugs the USB devices of the machine into its running domain and unplugs the
+// devices no longer in its spec. Devices plugged into the host again get a new address, their stale hostdevs are
+// replaced. As for pci devices, the devices attached are reported in the status.
+func (r *MachineReconciler) reconcileDomainUSBDevices(log logr.Logger, machine *api.Machine, domainDesc *libvirtxml.Domain, executor DomainExecutor) error {
+	attached := domainUSBDevices(machine, domainDesc)
+	defer func() {
+		machine.Status.USBDevices = sets.List(sets.KeySet(attached))
+	}()
+
+	detach := func(id string) error {
+		hostdev := attached[id]
+		log.V(1).Info("Detaching usb device", "ID", id)
+		if err := executor.DetachHostdev(&hostdev); err != nil {
+			return fmt.Errorf("[usb device %s] error detaching: %w", id, err)
+		}
+		delete(attached, id)
+		r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, machineEvent.ReasonDetachedUSBDevice, "Detached usb device %s", id)
+		return nil
+	}
+
+	for _, id := range sets.List(sets.KeySet(attached)) {
+		if slices.ContainsFunc(machine.Spec.USBDevices, func(device api.USBDeviceSpec) bool { return device.ID == id }) {
+			continue
+		}
+		if err := detach(id); err != nil {
+			return err
+		}
+	}
+
+	for _, device := range machine.Spec.USBDevices {
+		addr, ok, err := r.resolveUSBDevice(log, device)
+		if err != nil {
+			return fmt.Errorf("[usb device %s] %w", device.ID, err)
+		}
+		if !ok {
+			continue
+		}
+
+		if hostdev, ok := attached[device.ID]; ok {
+			if current, ok := usbHostdevAddress(hostdev); ok && current == addr {
+				continue
+			}
+			if err := detach(device.ID); err != nil {
+				return err
+			}
+		}
+
+		hostdev := usbDeviceHostdev(device.ID, addr)
+		log.V(1).Info("Attaching usb device", "Resource", device.Resource, "ID", device.ID, "Bus", addr.Bus, "Device", addr.Device)
+		if err := executor.AttachHostdev(hostdev); err != nil {
+			return fmt.Errorf("[usb device %s] error attaching: %w", device.ID, err)
+		}
+		attached[device.ID] = *hostdev
+		r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, machineEvent.ReasonAttachedUSBDevice, "Attached usb device %s of resource %s", device.ID, device.Resource)
+	}
+	return nil
+}
+
+// startResyncUSBDevices periodically reconciles the running machines with usb devices, attaching the devices
+// plugged into the host again.
+func (r *MachineReconciler) startResyncUSBDevices(ctx context.Context, log logr.Logger) {
+	if r.usbDevices == nil {
+		return
+	}
+
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		machines, err := r.machines.List(ctx)
+		if err != nil {
+			log.Error(err, "failed to list machines")
+			return
+		}
+
+		for _, machine := range machines {
+			if machine.DeletedAt != nil || len(machine.Spec.USBDevices) == 0 || machine.Status.State != api.MachineStateRunning {
+				continue
+			}
+			r.enqueue(machine.ID, queuePriorityUpdate)
+		}
+	}, usbDeviceResyncInterval)
+}
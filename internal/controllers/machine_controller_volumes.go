@@ -5,7 +5,6 @@ package controllers
 
 import (
 	"context"
-	"crypto/sha256"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -16,11 +15,14 @@ import (
 
 	"github.com/digitalocean/go-libvirt"
 	"github.com/go-logr/logr"
-	"github.com/google/uuid"
 	"github.com/ironcore-dev/libvirt-provider/api"
+	machineEvent "github.com/ironcore-dev/libvirt-provider/internal/event/machineevent"
 	providerhost "github.com/ironcore-dev/libvirt-provider/internal/host"
+	"github.com/ironcore-dev/libvirt-provider/internal/inflight"
+	providersecret "github.com/ironcore-dev/libvirt-provider/internal/libvirt/secret"
 	libvirtutils "github.com/ironcore-dev/libvirt-provider/internal/libvirt/utils"
 	providervolume "github.com/ironcore-dev/libvirt-provider/internal/plugins/volume"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 	utilstrings "k8s.io/utils/strings"
 	"libvirt.org/go/libvirtxml"
@@ -35,6 +37,11 @@ func (r *MachineReconciler) deleteVolumes(ctx context.Context, log logr.Logger,
 		if err := mounter.DeleteVolume(ctx, volume.ComputeVolumeName); err != nil {
 			errs = append(errs, fmt.Errorf("[volume %s] error deleting volume: %w", volume.ComputeVolumeName, err))
 		}
+
+		log.V(1).Info("Deleting volume secrets", "volumeName", volume.ComputeVolumeName)
+		if err := r.secrets.DeleteVolumeSecrets(machine.GetDomainUUID(), volume.ComputeVolumeName); err != nil {
+			errs = append(errs, fmt.Errorf("[volume %s] error deleting secrets: %w", volume.ComputeVolumeName, err))
+		}
 		return true
 	}); err != nil && !errors.Is(err, os.ErrNotExist) {
 		if len(errs) > 0 {
@@ -115,8 +122,9 @@ func (r *MachineReconciler) attachDetachVolumes(ctx context.Context, log logr.Lo
 		}
 	}
 
+	// Volumes are applied in the order of the spec, so the disks of new domains keep it.
 	var volumeStates []api.VolumeStatus
-	for _, volume := range specVolumes {
+	for _, volume := range machine.Spec.Volumes {
 		log.V(1).Info("Reconciling volume", "volumeName", volume.Name)
 		volumeID, volumeSize, err := r.applyVolume(ctx, log, machine, volume, mounter, attacher)
 		if err != nil {
@@ -156,7 +164,12 @@ func (r *MachineReconciler) deleteVolume(ctx context.Context, log logr.Logger, m
 type AttachVolume struct {
 	Name   string
 	Device string
-	Spec   providervolume.Volume
+	// Bus is the disk bus of the volume. If empty, the default disk bus is used.
+	Bus  DiskBus
+	Spec providervolume.Volume
+	// CachePolicy is the cache policy of the attached disk, empty if it uses the default of the hypervisor.
+	// It is reported for attached volumes and ignored when attaching them.
+	CachePolicy string
 }
 
 type VolumeAttacher interface {
@@ -165,7 +178,9 @@ type VolumeAttacher interface {
 	GetVolume(name string) (*AttachVolume, error)
 	AttachVolume(volume *AttachVolume) error
 	DetachVolume(name string) error
-	ResizeVolume(volume *AttachVolume) error
+	// ResizeVolume resizes the disk of the attached volume. It returns whether the disk was resized online,
+	// which is not the case for domains yet to be created, as they are created with the new size.
+	ResizeVolume(volume *AttachVolume) (bool, error)
 }
 
 var (
@@ -176,47 +191,60 @@ var (
 type DomainExecutor interface {
 	AttachDisk(disk *libvirtxml.DomainDisk) error
 	DetachDisk(disk *libvirtxml.DomainDisk) error
-	ResizeDisk(device string, size int64) error
+	// ResizeDisk resizes the disk with the target device. It returns whether the disk was resized online.
+	ResizeDisk(device string, size int64) (bool, error)
+	AttachHostdev(hostdev *libvirtxml.DomainHostdev) error
+	DetachHostdev(hostdev *libvirtxml.DomainHostdev) error
+	AttachController(controller *libvirtxml.DomainController) error
 
 	ApplySecret(secret *libvirtxml.Secret, data []byte) error
 	DeleteSecret(secretUUID string) error
 }
 
 type createDomainExecutor struct {
-	libvirt *libvirt.Libvirt
+	libvirt libvirtutils.Client
 }
 
-func NewCreateDomainExecutor(lv *libvirt.Libvirt) DomainExecutor {
+func NewCreateDomainExecutor(lv libvirtutils.Client) DomainExecutor {
 	return &createDomainExecutor{libvirt: lv}
 }
 
 func (e *createDomainExecutor) AttachDisk(*libvirtxml.DomainDisk) error { return nil }
 func (e *createDomainExecutor) DetachDisk(*libvirtxml.DomainDisk) error { return nil }
-func (e *createDomainExecutor) ResizeDisk(string, int64) error          { return nil }
+func (e *createDomainExecutor) ResizeDisk(string, int64) (bool, error) {
+	return false, nil
+}
+func (e *createDomainExecutor) AttachHostdev(*libvirtxml.DomainHostdev) error {
+	return nil
+}
+func (e *createDomainExecutor) DetachHostdev(*libvirtxml.DomainHostdev) error {
+	return nil
+}
+func (e *createDomainExecutor) AttachController(*libvirtxml.DomainController) error {
+	return nil
+}
 func (e *createDomainExecutor) ApplySecret(secret *libvirtxml.Secret, value []byte) error {
-	return libvirtutils.ApplySecret(e.libvirt, secret, value)
+	return providersecret.NewManager(e.libvirt).Apply(secret, value)
 }
 
 func (e *createDomainExecutor) DeleteSecret(secretUUID string) error {
-	return e.libvirt.SecretUndefine(libvirt.Secret{
-		UUID: libvirtutils.UUIDStringToBytes(secretUUID),
-	})
+	return providersecret.NewManager(e.libvirt).Delete(secretUUID)
 }
 
 type domainExecutor struct {
-	libvirt   *libvirt.Libvirt
-	machineID string
+	libvirt libvirtutils.Client
+	dom     libvirt.Domain
 }
 
-func NewRunningDomainExecutor(lv *libvirt.Libvirt, machineID string) DomainExecutor {
+func NewRunningDomainExecutor(lv libvirtutils.Client, domain libvirt.Domain) DomainExecutor {
 	return &domainExecutor{
-		libvirt:   lv,
-		machineID: machineID,
+		libvirt: lv,
+		dom:     domain,
 	}
 }
 
 func (a *domainExecutor) domain() libvirt.Domain {
-	return machineDomain(a.machineID)
+	return a.dom
 }
 
 func (a *domainExecutor) AttachDisk(disk *libvirtxml.DomainDisk) error {
@@ -237,31 +265,61 @@ func (a *domainExecutor) DetachDisk(disk *libvirtxml.DomainDisk) error {
 	return a.libvirt.DomainDetachDevice(a.domain(), data)
 }
 
+func (a *domainExecutor) AttachHostdev(hostdev *libvirtxml.DomainHostdev) error {
+	data, err := hostdev.Marshal()
+	if err != nil {
+		return err
+	}
+
+	return a.libvirt.DomainAttachDevice(a.domain(), data)
+}
+
+func (a *domainExecutor) DetachHostdev(hostdev *libvirtxml.DomainHostdev) error {
+	data, err := hostdev.Marshal()
+	if err != nil {
+		return err
+	}
+
+	return a.libvirt.DomainDetachDevice(a.domain(), data)
+}
+
+func (a *domainExecutor) AttachController(controller *libvirtxml.DomainController) error {
+	data, err := controller.Marshal()
+	if err != nil {
+		return err
+	}
+
+	return a.libvirt.DomainAttachDevice(a.domain(), data)
+}
+
 func (a *domainExecutor) ApplySecret(secret *libvirtxml.Secret, value []byte) error {
-	return libvirtutils.ApplySecret(a.libvirt, secret, value)
+	return providersecret.NewManager(a.libvirt).Apply(secret, value)
 }
 
 func (a *domainExecutor) DeleteSecret(secretUUID string) error {
-	return a.libvirt.SecretUndefine(libvirt.Secret{
-		UUID: libvirtutils.UUIDStringToBytes(secretUUID),
-	})
+	return providersecret.NewManager(a.libvirt).Delete(secretUUID)
 }
 
-func (a *domainExecutor) ResizeDisk(device string, size int64) error {
-	return a.libvirt.DomainBlockResize(a.domain(), computeVirtioDiskTargetDeviceName(device), uint64(size), libvirt.DomainBlockResizeBytes)
+func (a *domainExecutor) ResizeDisk(device string, size int64) (bool, error) {
+	if err := a.libvirt.DomainBlockResize(a.domain(), device, uint64(size), libvirt.DomainBlockResizeBytes); err != nil {
+		return false, err
+	}
+	return true, nil
 }
 
 type libvirtVolumeAttacher struct {
 	domainDesc        *libvirtxml.Domain
 	executor          DomainExecutor
 	volumeCachePolicy string
+	diskBus           DiskBusOptions
 }
 
-func NewLibvirtVolumeAttacher(domainDesc *libvirtxml.Domain, executor DomainExecutor, policy string) (VolumeAttacher, error) {
+func NewLibvirtVolumeAttacher(domainDesc *libvirtxml.Domain, executor DomainExecutor, policy string, diskBus DiskBusOptions) (VolumeAttacher, error) {
 	a := &libvirtVolumeAttacher{
 		domainDesc:        domainDesc,
 		executor:          executor,
 		volumeCachePolicy: policy,
+		diskBus:           diskBus,
 	}
 	return a, nil
 }
@@ -292,6 +350,25 @@ func (a *libvirtVolumeAttacher) diskByVolumeNameIndex(name string) (int, error)
 	return -1, nil
 }
 
+func (a *libvirtVolumeAttacher) hostdevByVolumeNameIndex(name string) (int, error) {
+	for i, hostdev := range a.domainDevices().Hostdevs {
+		alias := hostdev.Alias
+		if alias == nil || !isDiskAlias(alias.Name) {
+			continue
+		}
+
+		parsed, err := parseVolumeDiskAlias(alias.Name)
+		if err != nil {
+			return 0, err
+		}
+
+		if parsed == name {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
+
 func (a *libvirtVolumeAttacher) ListVolumes() ([]AttachVolume, error) {
 	var res []AttachVolume
 	if err := a.ForEachVolume(func(volume *AttachVolume) bool {
@@ -347,9 +424,11 @@ func (a *libvirtVolumeAttacher) forEachVolumeAndDisk(f func(*libvirtxml.DomainDi
 		}
 
 		attachedVolume := AttachVolume{
-			Name:   parsed,
-			Device: device,
-			Spec:   *volume,
+			Name:        parsed,
+			Device:      device,
+			Bus:         DiskBus(disk.Target.Bus),
+			Spec:        *volume,
+			CachePolicy: diskCachePolicy(&disk),
 		}
 		if !f(&disk, &attachedVolume) {
 			return nil
@@ -359,66 +438,128 @@ func (a *libvirtVolumeAttacher) forEachVolumeAndDisk(f func(*libvirtxml.DomainDi
 }
 
 func (a *libvirtVolumeAttacher) ForEachVolume(f func(*AttachVolume) bool) error {
-	return a.forEachVolumeAndDisk(func(disk *libvirtxml.DomainDisk, volume *AttachVolume) bool {
-		return f(volume)
-	})
+	done := false
+	if err := a.forEachVolumeAndDisk(func(disk *libvirtxml.DomainDisk, volume *AttachVolume) bool {
+		done = !f(volume)
+		return !done
+	}); err != nil || done {
+		return err
+	}
+
+	for _, hostdev := range a.domainDevices().Hostdevs {
+		alias := hostdev.Alias
+		if alias == nil || !isDiskAlias(alias.Name) {
+			continue
+		}
+
+		parsed, err := parseVolumeDiskAlias(alias.Name)
+		if err != nil {
+			return err
+		}
+
+		volume, err := libvirtHostdevToProviderVolume(&hostdev)
+		if err != nil {
+			return err
+		}
+
+		if !f(&AttachVolume{Name: parsed, Spec: *volume}) {
+			return nil
+		}
+	}
+	return nil
 }
 
 func (a *libvirtVolumeAttacher) AttachVolume(volume *AttachVolume) error {
+	if volume.Spec.HostDevice != nil {
+		return a.attachHostdevVolume(volume)
+	}
+
 	existingIdx, err := a.diskByVolumeNameIndex(volume.Name)
 	if err != nil {
 		return err
 	}
 
+	disk, secret, encryptionSecret, secretValue, encryptionSecretValue, err := a.providerVolumeToLibvirt(volume.Name, &volume.Spec, volume.Device)
+	if err != nil {
+		return err
+	}
+	bus := a.diskBus.busOrDefault(volume.Bus)
+	a.diskBus.setDiskBus(disk, bus, volume.Device)
+	assignDiskIOThread(a.domainDesc, disk)
+
+	// Applying the secrets of an attached volume rotates its credentials.
+	if err := a.applySecret(secret, secretValue, a.secretUUID(volume.Name)); err != nil {
+		return fmt.Errorf("error applying secret: %w", err)
+	}
+	if err := a.applySecret(encryptionSecret, encryptionSecretValue, a.secretEncryptionUUID(volume.Name)); err != nil {
+		return fmt.Errorf("error applying encryption secret: %w", err)
+	}
+
 	if existingIdx != -1 {
 		return ErrAttachedVolumeAlreadyExists
 	}
 
-	if err := func() error {
-		disk, secret, encryptionSecret, secretValue, encryptionSecretValue, err := a.providerVolumeToLibvirt(volume.Name, &volume.Spec, volume.Device)
-		if err != nil {
+	if bus == DiskBusSCSI {
+		if err := a.ensureSCSIController(); err != nil {
 			return err
 		}
+	}
+	if err := a.executor.AttachDisk(disk); err != nil {
+		return err
+	}
 
-		if secret != nil {
-			if err := a.executor.ApplySecret(secret, secretValue); err != nil {
-				return err
-			}
-		} else {
-			if err := a.executor.DeleteSecret(a.secretUUID(volume.Name)); libvirtutils.IgnoreErrorCode(err, libvirt.ErrNoSecret) != nil {
-				return err
-			}
-		}
+	a.domainDevices().Disks = append(a.domainDevices().Disks, *disk)
+	return nil
+}
 
-		if encryptionSecret != nil {
-			if err := a.executor.ApplySecret(encryptionSecret, encryptionSecretValue); err != nil {
-				return err
-			}
-		} else {
-			if err := a.executor.DeleteSecret(a.secretEncryptionUUID(volume.Name)); libvirtutils.IgnoreErrorCode(err, libvirt.ErrNoSecret) != nil {
-				return err
-			}
-		}
+// ensureSCSIController attaches the virtio-scsi controller if the domain has none yet, as it was
+// created without scsi disks. Otherwise libvirt would add a controller of its default model.
+func (a *libvirtVolumeAttacher) ensureSCSIController() error {
+	if hasSCSIController(a.domainDesc) {
+		return nil
+	}
 
-		if err := a.executor.AttachDisk(disk); err != nil {
-			return err
-		}
+	controller := a.diskBus.newSCSIController(a.domainDesc)
+	if err := a.executor.AttachController(&controller); err != nil {
+		return fmt.Errorf("error attaching scsi controller: %w", err)
+	}
+	a.domainDevices().Controllers = append(a.domainDevices().Controllers, controller)
+	return nil
+}
 
-		a.domainDevices().Disks = append(a.domainDevices().Disks, *disk)
-		return nil
-	}(); err != nil {
+func (a *libvirtVolumeAttacher) attachHostdevVolume(volume *AttachVolume) error {
+	existingIdx, err := a.hostdevByVolumeNameIndex(volume.Name)
+	if err != nil {
 		return err
 	}
+	if existingIdx != -1 {
+		return ErrAttachedVolumeAlreadyExists
+	}
+
+	hostdev := providerVolumeToLibvirtHostdev(volume.Name, volume.Spec.HostDevice)
+	if err := a.executor.AttachHostdev(hostdev); err != nil {
+		return err
+	}
+
+	a.domainDevices().Hostdevs = append(a.domainDevices().Hostdevs, *hostdev)
 	return nil
 }
 
+// applySecret applies secret or deletes the secret with the given UUID if the volume does not need it.
+func (a *libvirtVolumeAttacher) applySecret(secret *libvirtxml.Secret, value []byte, secretUUID string) error {
+	if secret == nil {
+		return a.executor.DeleteSecret(secretUUID)
+	}
+	return a.executor.ApplySecret(secret, value)
+}
+
 func (a *libvirtVolumeAttacher) DetachVolume(name string) error {
 	idx, err := a.diskByVolumeNameIndex(name)
 	if err != nil {
 		return err
 	}
 	if idx == -1 {
-		return ErrAttachedVolumeNotFound
+		return a.detachHostdevVolume(name)
 	}
 
 	disk := &a.domainDevices().Disks[idx]
@@ -427,11 +568,11 @@ func (a *libvirtVolumeAttacher) DetachVolume(name string) error {
 		return err
 	}
 
-	if err := a.executor.DeleteSecret(a.secretUUID(name)); libvirtutils.IgnoreErrorCode(err, libvirt.ErrNoSecret) != nil {
+	if err := a.executor.DeleteSecret(a.secretUUID(name)); err != nil {
 		return err
 	}
 
-	if err := a.executor.DeleteSecret(a.secretEncryptionUUID(name)); libvirtutils.IgnoreErrorCode(err, libvirt.ErrNoSecret) != nil {
+	if err := a.executor.DeleteSecret(a.secretEncryptionUUID(name)); err != nil {
 		return err
 	}
 
@@ -440,8 +581,37 @@ func (a *libvirtVolumeAttacher) DetachVolume(name string) error {
 	return nil
 }
 
-func (a *libvirtVolumeAttacher) ResizeVolume(volume *AttachVolume) error {
-	return a.executor.ResizeDisk(volume.Device, volume.Spec.Size)
+func (a *libvirtVolumeAttacher) detachHostdevVolume(name string) error {
+	idx, err := a.hostdevByVolumeNameIndex(name)
+	if err != nil {
+		return err
+	}
+	if idx == -1 {
+		return ErrAttachedVolumeNotFound
+	}
+
+	if err := a.executor.DetachHostdev(&a.domainDevices().Hostdevs[idx]); err != nil {
+		return err
+	}
+
+	a.domainDevices().Hostdevs = slices.Delete(a.domainDevices().Hostdevs, idx, idx+1)
+	return nil
+}
+
+func (a *libvirtVolumeAttacher) ResizeVolume(volume *AttachVolume) (bool, error) {
+	idx, err := a.diskByVolumeNameIndex(volume.Name)
+	if err != nil {
+		return false, err
+	}
+	if idx == -1 {
+		return false, ErrAttachedVolumeNotFound
+	}
+
+	device, err := getDiskTargetDevice(&a.domainDevices().Disks[idx])
+	if err != nil {
+		return false, err
+	}
+	return a.executor.ResizeDisk(device, volume.Spec.Size)
 }
 
 func (a *libvirtVolumeAttacher) GetVolume(name string) (*AttachVolume, error) {
@@ -450,7 +620,7 @@ func (a *libvirtVolumeAttacher) GetVolume(name string) (*AttachVolume, error) {
 		return nil, err
 	}
 	if idx == -1 {
-		return nil, ErrAttachedVolumeNotFound
+		return a.getHostdevVolume(name)
 	}
 
 	disk := &a.domainDevices().Disks[idx]
@@ -466,9 +636,39 @@ func (a *libvirtVolumeAttacher) GetVolume(name string) (*AttachVolume, error) {
 	}
 
 	return &AttachVolume{
-		Name:   name,
-		Device: device,
-		Spec:   *volume,
+		Name:        name,
+		Device:      device,
+		Bus:         DiskBus(disk.Target.Bus),
+		Spec:        *volume,
+		CachePolicy: diskCachePolicy(disk),
+	}, nil
+}
+
+// diskCachePolicy returns the cache policy of the disk, empty if it uses the default of the hypervisor.
+func diskCachePolicy(disk *libvirtxml.DomainDisk) string {
+	if disk.Driver == nil {
+		return ""
+	}
+	return disk.Driver.Cache
+}
+
+func (a *libvirtVolumeAttacher) getHostdevVolume(name string) (*AttachVolume, error) {
+	idx, err := a.hostdevByVolumeNameIndex(name)
+	if err != nil {
+		return nil, err
+	}
+	if idx == -1 {
+		return nil, ErrAttachedVolumeNotFound
+	}
+
+	volume, err := libvirtHostdevToProviderVolume(&a.domainDevices().Hostdevs[idx])
+	if err != nil {
+		return nil, err
+	}
+
+	return &AttachVolume{
+		Name: name,
+		Spec: *volume,
 	}, nil
 }
 
@@ -622,8 +822,16 @@ func (r *MachineReconciler) applyVolume(
 	attacher VolumeAttacher,
 ) (string, int64, error) {
 	log.V(1).Info("Getting volume spec")
+	bus, err := volumeDiskBus(desiredVolume)
+	if err != nil {
+		return "", 0, err
+	}
 
 	log.V(1).Info("Applying volume")
+	op, err := r.operations.Begin(inflight.KindVolumeApply, machine.ID+"/"+desiredVolume.Name)
+	if err != nil {
+		return "", 0, fmt.Errorf("error tracking volume apply: %w", err)
+	}
 	volumeID, providerVolume, err := mountedVolumes.ApplyVolume(ctx, desiredVolume, func(outdated *MountVolume) error {
 		log.V(1).Info("Detaching outdated mounted volume before deleting", "PluginName", outdated.PluginName)
 		if err := attacher.DetachVolume(outdated.ComputeVolumeName); err != nil && !errors.Is(err, ErrAttachedVolumeNotFound) {
@@ -631,6 +839,7 @@ func (r *MachineReconciler) applyVolume(
 		}
 		return nil
 	})
+	op.Done(err)
 	if err != nil {
 		return "", 0, fmt.Errorf("error applying volume mount: %w", err)
 	}
@@ -639,6 +848,7 @@ func (r *MachineReconciler) applyVolume(
 	if err := attacher.AttachVolume(&AttachVolume{
 		Name:   desiredVolume.Name,
 		Device: desiredVolume.Device,
+		Bus:    bus,
 		Spec:   *providerVolume,
 	}); err != nil && !errors.Is(err, ErrAttachedVolumeAlreadyExists) {
 		return "", 0, fmt.Errorf("error ensuring volume is attached: %w", err)
@@ -646,14 +856,30 @@ func (r *MachineReconciler) applyVolume(
 
 	//TODO do epsilon comparison
 	if lastVolumeSize := getLastVolumeSize(machine, volumeID); lastVolumeSize != 0 && providerVolume.Size != lastVolumeSize {
+		// The cache policy of the attached disk is checked, as disks keep the one they were attached with.
+		attachedVolume, err := attacher.GetVolume(desiredVolume.Name)
+		if err != nil {
+			return "", 0, fmt.Errorf("error getting attached volume: %w", err)
+		}
+		if cachePolicy := attachedVolume.CachePolicy; cachePolicy != "" && slices.Contains(r.noOnlineResizeCachePolicies, cachePolicy) {
+			log.V(1).Info("Skipping online volume resize for cache policy", "volumeID", volumeID, "cachePolicy", cachePolicy)
+			r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, machineEvent.ReasonSkippedVolumeResize, "Online resize of volume %s from %d to %d bytes is disabled for cache policy %s, the new size is visible after a restart", desiredVolume.Name, lastVolumeSize, providerVolume.Size, cachePolicy)
+			return volumeID, providerVolume.Size, nil
+		}
+
 		log.V(1).Info("Resize volume", "volumeID", volumeID, "lastSize", lastVolumeSize, "volumeSize", providerVolume.Size)
-		if err := attacher.ResizeVolume(&AttachVolume{
+		resized, err := attacher.ResizeVolume(&AttachVolume{
 			Name:   desiredVolume.Name,
 			Device: desiredVolume.Device,
+			Bus:    bus,
 			Spec:   *providerVolume,
-		}); err != nil {
+		})
+		if err != nil {
 			return "", 0, fmt.Errorf("failed to resize volume: %w", err)
 		}
+		if resized {
+			r.Eventf(log, machine.Metadata, corev1.EventTypeNormal, machineEvent.ReasonResizedVolume, "Resized volume %s from %d to %d bytes", desiredVolume.Name, lastVolumeSize, providerVolume.Size)
+		}
 	}
 
 	return volumeID, providerVolume.Size, nil
@@ -696,49 +922,69 @@ func volumeDiskAlias(computeVolumeName string) string {
 }
 
 func (a *libvirtVolumeAttacher) secretUUID(computeVolumeName string) string {
-	return uuid.NewHash(sha256.New(), uuid.Nil, []byte(fmt.Sprintf("%s/%s", a.domainDesc.UUID, computeVolumeName)), 5).String()
+	return providersecret.VolumeUUID(a.domainDesc.UUID, computeVolumeName)
 }
 
 func (a *libvirtVolumeAttacher) secretEncryptionUUID(computeVolumeName string) string {
-	return uuid.NewHash(sha256.New(), uuid.Nil, []byte(fmt.Sprintf("enc/%s/%s", a.domainDesc.UUID, computeVolumeName)), 5).String()
+	return providersecret.VolumeEncryptionUUID(a.domainDesc.UUID, computeVolumeName)
 }
 
 func (a *libvirtVolumeAttacher) providerVolumeToLibvirt(computeVolumeName string, vol *providervolume.Volume, dev string) (*libvirtxml.DomainDisk, *libvirtxml.Secret, *libvirtxml.Secret, []byte, []byte, error) {
-	deviceName := computeVirtioDiskTargetDeviceName(dev)
-
 	disk := &libvirtxml.DomainDisk{
 		Alias: &libvirtxml.DomainAlias{
 			Name: volumeDiskAlias(computeVolumeName),
 		},
 		Device: "disk",
-		Target: &libvirtxml.DomainDiskTarget{
-			Dev: deviceName,
-			Bus: "virtio",
-		},
 		Serial: dev + "-" + vol.Handle,
 	}
 
+	var (
+		fileDiskEncryption        *libvirtxml.DomainDiskEncryption
+		fileEncryptionSecret      *libvirtxml.Secret
+		fileEncryptionSecretValue []byte
+	)
+	if encryption := vol.FileEncryption; encryption != nil && encryption.EncryptionKey != "" {
+		fileDiskEncryption, fileEncryptionSecret, fileEncryptionSecretValue = a.volumeEncryption(computeVolumeName, "luks", "qemu", encryption.EncryptionKey)
+	}
+
 	switch {
 	case vol.QCow2File != "":
 		disk.Driver = &libvirtxml.DomainDiskDriver{
 			Name: "qemu",
 			Type: "qcow2",
 		}
+		setDiskDriverDiscard(disk.Driver, vol.Discard)
 		disk.Source = &libvirtxml.DomainDiskSource{
 			File: &libvirtxml.DomainDiskSourceFile{
 				File: vol.QCow2File,
 			},
+			Encryption: fileDiskEncryption,
 		}
-		return disk, nil, nil, nil, nil, nil
+		return disk, nil, fileEncryptionSecret, nil, fileEncryptionSecretValue, nil
 	case vol.RawFile != "":
 		disk.Driver = &libvirtxml.DomainDiskDriver{
 			Name: "qemu",
 			Type: "raw",
 		}
+		setDiskDriverDiscard(disk.Driver, vol.Discard)
 		disk.Source = &libvirtxml.DomainDiskSource{
 			File: &libvirtxml.DomainDiskSourceFile{
 				File: vol.RawFile,
 			},
+			Encryption: fileDiskEncryption,
+		}
+		return disk, nil, fileEncryptionSecret, nil, fileEncryptionSecretValue, nil
+	case vol.BlockDevice != "":
+		disk.Driver = &libvirtxml.DomainDiskDriver{
+			Name:  "qemu",
+			Type:  "raw",
+			Cache: "none",
+			IO:    "native",
+		}
+		disk.Source = &libvirtxml.DomainDiskSource{
+			Block: &libvirtxml.DomainDiskSourceBlock{
+				Dev: vol.BlockDevice,
+			},
 		}
 		return disk, nil, nil, nil, nil, nil
 	case vol.CephDisk != nil:
@@ -780,29 +1026,7 @@ func (a *libvirtVolumeAttacher) providerVolumeToLibvirt(computeVolumeName string
 		}
 
 		if encryption := vol.CephDisk.Encryption; encryption != nil && encryption.EncryptionKey != "" {
-			diskEncryption = &libvirtxml.DomainDiskEncryption{
-				Format: "luks2",
-				Engine: "librbd",
-				Secrets: []libvirtxml.DomainDiskSecret{
-					{
-						Type: "passphrase",
-						UUID: a.secretEncryptionUUID(computeVolumeName),
-					},
-				},
-			}
-
-			encryptionSecret = &libvirtxml.Secret{
-				Ephemeral: "no",
-				Private:   "yes",
-				UUID:      a.secretEncryptionUUID(computeVolumeName),
-				Usage: &libvirtxml.SecretUsage{
-					Type:   "volume",
-					Name:   fmt.Sprintf("domain.%s.volume.%s secret", a.domainDesc.UUID, computeVolumeName),
-					Volume: fmt.Sprintf("domain.%s.volume.%s", a.domainDesc.UUID, computeVolumeName),
-				},
-			}
-
-			encryptionSecretValue = []byte(encryption.EncryptionKey)
+			diskEncryption, encryptionSecret, encryptionSecretValue = a.volumeEncryption(computeVolumeName, "luks2", "librbd", encryption.EncryptionKey)
 		}
 
 		hosts := make([]libvirtxml.DomainDiskSourceHost, 0, len(vol.CephDisk.Monitors))
@@ -832,6 +1056,86 @@ func (a *libvirtVolumeAttacher) providerVolumeToLibvirt(computeVolumeName string
 	}
 }
 
+// setDiskDriverDiscard makes the driver pass discard requests through and unmap zeroed blocks if discard is set.
+func setDiskDriverDiscard(driver *libvirtxml.DomainDiskDriver, discard bool) {
+	if !discard {
+		return
+	}
+
+	driver.Discard = "unmap"
+	driver.DetectZeros = "unmap"
+}
+
+// volumeEncryption returns the disk encryption of a volume and the secret holding its passphrase.
+func (a *libvirtVolumeAttacher) volumeEncryption(computeVolumeName, format, engine, encryptionKey string) (*libvirtxml.DomainDiskEncryption, *libvirtxml.Secret, []byte) {
+	diskEncryption := &libvirtxml.DomainDiskEncryption{
+		Format: format,
+		Engine: engine,
+		Secrets: []libvirtxml.DomainDiskSecret{
+			{
+				Type: "passphrase",
+				UUID: a.secretEncryptionUUID(computeVolumeName),
+			},
+		},
+	}
+
+	encryptionSecret := &libvirtxml.Secret{
+		Ephemeral: "no",
+		Private:   "yes",
+		UUID:      a.secretEncryptionUUID(computeVolumeName),
+		Usage: &libvirtxml.SecretUsage{
+			Type:   "volume",
+			Name:   fmt.Sprintf("domain.%s.volume.%s secret", a.domainDesc.UUID, computeVolumeName),
+			Volume: fmt.Sprintf("domain.%s.volume.%s", a.domainDesc.UUID, computeVolumeName),
+		},
+	}
+
+	return diskEncryption, encryptionSecret, []byte(encryptionKey)
+}
+
+func providerVolumeToLibvirtHostdev(computeVolumeName string, hostDevice *providervolume.HostDevice) *libvirtxml.DomainHostdev {
+	return &libvirtxml.DomainHostdev{
+		Alias: &libvirtxml.DomainAlias{
+			Name: volumeDiskAlias(computeVolumeName),
+		},
+		Managed: "yes",
+		SubsysPCI: &libvirtxml.DomainHostdevSubsysPCI{
+			Source: &libvirtxml.DomainHostdevSubsysPCISource{
+				Address: &libvirtxml.DomainAddressPCI{
+					Domain:   &hostDevice.Domain,
+					Bus:      &hostDevice.Bus,
+					Slot:     &hostDevice.Slot,
+					Function: &hostDevice.Function,
+				},
+			},
+		},
+		Address: &libvirtxml.DomainAddress{
+			//if not defined, not conflicting pci address will be selected
+			PCI: &libvirtxml.DomainAddressPCI{},
+		},
+	}
+}
+
+func libvirtHostdevToProviderVolume(hostdev *libvirtxml.DomainHostdev) (*providervolume.Volume, error) {
+	if hostdev.SubsysPCI == nil || hostdev.SubsysPCI.Source == nil || hostdev.SubsysPCI.Source.Address == nil {
+		return nil, fmt.Errorf("no pci subsystem: %#v", hostdev)
+	}
+
+	sourceAddr := hostdev.SubsysPCI.Source.Address
+	if sourceAddr.Domain == nil || sourceAddr.Bus == nil || sourceAddr.Slot == nil || sourceAddr.Function == nil {
+		return nil, fmt.Errorf("missing pci subsystem source address fields: %#v", sourceAddr)
+	}
+
+	return &providervolume.Volume{
+		HostDevice: &providervolume.HostDevice{
+			Domain:   *sourceAddr.Domain,
+			Bus:      *sourceAddr.Bus,
+			Slot:     *sourceAddr.Slot,
+			Function: *sourceAddr.Function,
+		},
+	}, nil
+}
+
 func libvirtDiskToProviderVolume(disk *libvirtxml.DomainDisk) (*providervolume.Volume, error) {
 	src := disk.Source
 	if src == nil {
@@ -847,6 +1151,10 @@ func libvirtDiskToProviderVolume(disk *libvirtxml.DomainDisk) (*providervolume.V
 		return &providervolume.Volume{
 			RawFile: src.File.File,
 		}, nil
+	case src.Block != nil && src.Block.Dev != "":
+		return &providervolume.Volume{
+			BlockDevice: src.Block.Dev,
+		}, nil
 	case src.Network != nil && src.Network.Protocol == "rbd":
 		netSrc := src.Network
 		monitors := make([]providervolume.CephMonitor, 0, len(netSrc.Hosts))
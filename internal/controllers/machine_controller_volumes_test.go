@@ -0,0 +1,238 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	machineEvent "github.com/ironcore-dev/libvirt-provider/internal/event/machineevent"
+	providersecret "github.com/ironcore-dev/libvirt-provider/internal/libvirt/secret"
+	providervolume "github.com/ironcore-dev/libvirt-provider/internal/plugins/volume"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"libvirt.org/go/libvirtxml"
+)
+
+// appliedSecrets is a DomainExecutor of a domain to be created recording the applied and deleted secrets.
+type appliedSecrets struct {
+	createDomainExecutor
+	secrets map[string]*libvirtxml.Secret
+	values  map[string][]byte
+	deleted []string
+}
+
+func (e *appliedSecrets) ApplySecret(secret *libvirtxml.Secret, value []byte) error {
+	e.secrets[secret.UUID] = secret
+	e.values[secret.UUID] = value
+	return nil
+}
+
+func (e *appliedSecrets) DeleteSecret(secretUUID string) error {
+	e.deleted = append(e.deleted, secretUUID)
+	return nil
+}
+
+// resizedDisks is a DomainExecutor recording the resized disks, which reports them as resized online if online
+// is set.
+type resizedDisks struct {
+	attachedDevices
+	online  bool
+	resized []string
+}
+
+func (e *resizedDisks) ResizeDisk(device string, _ int64) (bool, error) {
+	e.resized = append(e.resized, device)
+	return e.online, nil
+}
+
+// appliedVolumes is a VolumeMounter applying every volume as the given one.
+type appliedVolumes struct {
+	VolumeMounter
+	volume providervolume.Volume
+}
+
+func (m *appliedVolumes) ApplyVolume(context.Context, *api.VolumeSpec, func(*MountVolume) error) (string, *providervolume.Volume, error) {
+	volume := m.volume
+	return "test/disk", &volume, nil
+}
+
+// recordedEvents is an EventRecorder recording the reasons of the events.
+type recordedEvents struct {
+	reasons []string
+}
+
+func (e *recordedEvents) Eventf(_ logr.Logger, _ api.Metadata, _, reason, _ string, _ ...any) {
+	e.reasons = append(e.reasons, reason)
+}
+
+var _ = Describe("Volumes", func() {
+	const domainUUID = "b6b9b4ea-6e64-4c8b-8d4e-6e5c0c6a1f5e"
+
+	var (
+		executor *appliedSecrets
+		domain   *libvirtxml.Domain
+		attacher VolumeAttacher
+	)
+
+	BeforeEach(func() {
+		executor = &appliedSecrets{secrets: map[string]*libvirtxml.Secret{}, values: map[string][]byte{}}
+		domain = &libvirtxml.Domain{UUID: domainUUID}
+
+		var err error
+		attacher, err = NewLibvirtVolumeAttacher(domain, executor, "none", DiskBusOptions{Bus: DiskBusVirtio})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	DescribeTable("attaching encrypted file volumes",
+		func(spec providervolume.Volume, driverType string) {
+			spec.FileEncryption = &providervolume.FileEncryption{EncryptionKey: "s3cr3t"}
+			Expect(attacher.AttachVolume(&AttachVolume{Name: "disk", Device: "oda", Spec: spec})).To(Succeed())
+
+			secretUUID := providersecret.VolumeEncryptionUUID(domainUUID, "disk")
+			Expect(domain.Devices.Disks).To(HaveLen(1))
+			disk := domain.Devices.Disks[0]
+			Expect(disk.Driver.Type).To(Equal(driverType))
+
+			By("rendering the luks encryption of the disk")
+			diskXML, err := disk.Marshal()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(diskXML).To(ContainSubstring(`<encryption format="luks" engine="qemu">`))
+			Expect(diskXML).To(ContainSubstring(`<secret type="passphrase" uuid="` + secretUUID + `">`))
+			Expect(diskXML).NotTo(ContainSubstring("s3cr3t"))
+
+			By("applying the private secret holding the passphrase")
+			Expect(executor.secrets).To(HaveKey(secretUUID))
+			Expect(executor.secrets[secretUUID]).To(Equal(&libvirtxml.Secret{
+				Ephemeral: "no",
+				Private:   "yes",
+				UUID:      secretUUID,
+				Usage: &libvirtxml.SecretUsage{
+					Type:   "volume",
+					Name:   "domain." + domainUUID + ".volume.disk secret",
+					Volume: "domain." + domainUUID + ".volume.disk",
+				},
+			}))
+			Expect(executor.values[secretUUID]).To(Equal([]byte("s3cr3t")))
+		},
+		Entry("raw file", providervolume.Volume{RawFile: "/disks/disk.raw", Handle: "disk"}, "raw"),
+		Entry("qcow2 file", providervolume.Volume{QCow2File: "/disks/disk.qcow2", Handle: "disk"}, "qcow2"),
+	)
+
+	DescribeTable("rendering the discard setting of file volumes",
+		func(spec providervolume.Volume, discard, detectZeroes string) {
+			Expect(attacher.AttachVolume(&AttachVolume{Name: "disk", Device: "oda", Spec: spec})).To(Succeed())
+
+			Expect(domain.Devices.Disks).To(HaveLen(1))
+			driver := domain.Devices.Disks[0].Driver
+			Expect(driver.Discard).To(Equal(discard))
+			Expect(driver.DetectZeros).To(Equal(detectZeroes))
+
+			diskXML, err := domain.Devices.Disks[0].Marshal()
+			Expect(err).NotTo(HaveOccurred())
+			if discard == "" {
+				Expect(diskXML).NotTo(ContainSubstring("discard="))
+				Expect(diskXML).NotTo(ContainSubstring("detect_zeroes="))
+			} else {
+				Expect(diskXML).To(ContainSubstring(`discard="unmap"`))
+				Expect(diskXML).To(ContainSubstring(`detect_zeroes="unmap"`))
+			}
+		},
+		Entry("raw file with discard", providervolume.Volume{RawFile: "/disks/disk.raw", Handle: "disk", Discard: true}, "unmap", "unmap"),
+		Entry("qcow2 file with discard", providervolume.Volume{QCow2File: "/disks/disk.qcow2", Handle: "disk", Discard: true}, "unmap", "unmap"),
+		Entry("raw file without discard", providervolume.Volume{RawFile: "/disks/disk.raw", Handle: "disk"}, "", ""),
+		Entry("qcow2 file without discard", providervolume.Volume{QCow2File: "/disks/disk.qcow2", Handle: "disk"}, "", ""),
+	)
+
+	It("should delete the encryption secret of unencrypted file volumes", func() {
+		Expect(attacher.AttachVolume(&AttachVolume{
+			Name:   "disk",
+			Device: "oda",
+			Spec:   providervolume.Volume{RawFile: "/disks/disk.raw", Handle: "disk"},
+		})).To(Succeed())
+
+		Expect(domain.Devices.Disks).To(ConsistOf(HaveField("Source.Encryption", BeNil())))
+		Expect(executor.secrets).To(BeEmpty())
+		Expect(executor.deleted).To(ContainElement(providersecret.VolumeEncryptionUUID(domainUUID, "disk")))
+	})
+
+	Describe("resizing volumes", func() {
+		const (
+			lastSize = 1024 * 1024 * 1024
+			newSize  = 2 * lastSize
+		)
+
+		var (
+			r        *MachineReconciler
+			events   *recordedEvents
+			executor *resizedDisks
+			machine  *api.Machine
+		)
+
+		BeforeEach(func() {
+			r = setupTestEnv().newReconciler(MachineReconcilerOptions{NoOnlineResizeCachePolicies: []string{"writeback"}})
+			events = &recordedEvents{}
+			r.EventRecorder = events
+
+			executor = &resizedDisks{online: true}
+			machine = newMachine()
+			machine.Status.VolumeStatus = []api.VolumeStatus{{Name: "disk", Handle: "test/disk", Size: lastSize}}
+		})
+
+		// applyVolume applies the ceph volume of the machine with the new size to a domain, whose disks get the
+		// given cache policy when attached.
+		applyVolume := func(ctx context.Context, domain *libvirtxml.Domain, cachePolicy string) int64 {
+			attacher, err := NewLibvirtVolumeAttacher(domain, executor, cachePolicy, DiskBusOptions{Bus: DiskBusVirtio})
+			Expect(err).NotTo(HaveOccurred())
+
+			mounter := &appliedVolumes{volume: providervolume.Volume{
+				CephDisk: &providervolume.CephDisk{Name: "pool/disk"},
+				Handle:   "disk",
+				Size:     newSize,
+			}}
+			_, size, err := r.applyVolume(ctx, GinkgoLogr, machine, &api.VolumeSpec{Name: "disk", Device: "oda"}, mounter, attacher)
+			Expect(err).NotTo(HaveOccurred())
+			return size
+		}
+
+		It("should resize volumes online and record it", func(ctx SpecContext) {
+			Expect(applyVolume(ctx, &libvirtxml.Domain{}, "none")).To(BeEquivalentTo(newSize))
+
+			Expect(executor.resized).To(Equal([]string{"vda"}))
+			Expect(events.reasons).To(Equal([]string{machineEvent.ReasonResizedVolume}))
+		})
+
+		It("should skip the online resize of disks with a disabled cache policy", func(ctx SpecContext) {
+			Expect(applyVolume(ctx, &libvirtxml.Domain{}, "writeback")).To(BeEquivalentTo(newSize))
+
+			Expect(executor.resized).To(BeEmpty())
+			Expect(events.reasons).To(Equal([]string{machineEvent.ReasonSkippedVolumeResize}))
+		})
+
+		It("should check the cache policy the disk was attached with", func(ctx SpecContext) {
+			domain := &libvirtxml.Domain{}
+			attacher, err := NewLibvirtVolumeAttacher(domain, executor, "writeback", DiskBusOptions{Bus: DiskBusVirtio})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(attacher.AttachVolume(&AttachVolume{
+				Name:   "disk",
+				Device: "oda",
+				Spec:   providervolume.Volume{CephDisk: &providervolume.CephDisk{Name: "pool/disk"}, Handle: "disk"},
+			})).To(Succeed())
+
+			By("applying the volume with a cache policy which isn't disabled")
+			applyVolume(ctx, domain, "none")
+			Expect(executor.resized).To(BeEmpty())
+			Expect(events.reasons).To(Equal([]string{machineEvent.ReasonSkippedVolumeResize}))
+		})
+
+		It("should not record resizes of domains yet to be created", func(ctx SpecContext) {
+			executor.online = false
+			Expect(applyVolume(ctx, &libvirtxml.Domain{}, "none")).To(BeEquivalentTo(newSize))
+
+			Expect(executor.resized).To(Equal([]string{"vda"}))
+			Expect(events.reasons).To(BeEmpty())
+		})
+	})
+})
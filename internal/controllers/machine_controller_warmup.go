@@ -0,0 +1,80 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"time"
+
+	"github.com/go-logr/logr"
+	providerimage "github.com/ironcore-dev/libvirt-provider/internal/oci"
+	"github.com/ironcore-dev/libvirt-provider/internal/qcow2"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	warmImagesInterval = time.Minute
+
+	// warmImagesWaiter is the waiter of the root fs conversions started for warm images instead of a machine ID.
+	warmImagesWaiter = "warm-images"
+)
+
+// startWarmImages pulls the warm images ahead of the machines using them and, in root disk mode overlay,
+// converts them to qcow2 bases. Pulls and conversions run in the background and are checked periodically,
+// which also recovers images evicted or bases removed in the meantime.
+func (r *MachineReconciler) startWarmImages(ctx context.Context, log logr.Logger) {
+	if len(r.warmImages) == 0 {
+		return
+	}
+
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		warm := 0
+		for _, ref := range r.warmImages {
+			ok, err := r.warmImage(ctx, log, ref)
+			switch {
+			case err != nil:
+				log.Error(err, "Failed to warm image", "Image", ref)
+			case ok:
+				warm++
+			}
+		}
+		warmImages.Set(float64(warm))
+	}, warmImagesInterval)
+}
+
+// warmImage reports whether the image is pulled and, in root disk mode overlay, converted to a qcow2 base.
+func (r *MachineReconciler) warmImage(ctx context.Context, log logr.Logger, ref string) (bool, error) {
+	img, err := r.imageCache.Get(ctx, ref)
+	if err != nil {
+		if errors.Is(err, providerimage.ErrImagePulling) {
+			return false, nil
+		}
+		return false, err
+	}
+	if r.rootDiskMode != RootDiskModeOverlay {
+		return true, nil
+	}
+
+	baseFile, err := r.ensureRootFSBase(log.WithValues("Image", ref), warmImagesWaiter, img.RootFS)
+	if err != nil {
+		if errors.Is(err, qcow2.ErrConverting) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	r.warmRootFSBasesMu.Lock()
+	defer r.warmRootFSBasesMu.Unlock()
+	r.warmRootFSBases.Insert(filepath.Base(baseFile))
+	return true, nil
+}
+
+// isWarmRootFSBase reports whether the base file, or the partial one of its conversion, belongs to a warm image.
+func (r *MachineReconciler) isWarmRootFSBase(name string) bool {
+	r.warmRootFSBasesMu.Lock()
+	defer r.warmRootFSBasesMu.Unlock()
+	return r.warmRootFSBases.Has(name)
+}
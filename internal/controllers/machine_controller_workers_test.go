@@ -0,0 +1,110 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/store"
+	"github.com/ironcore-dev/libvirt-provider/pkg/libvirt/fake"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// blockingMachines is a machine store blocking the gets of a machine until released, which records how many of
+// them run at once.
+type blockingMachines struct {
+	store.Store[*api.Machine]
+	id        string
+	entered   chan struct{}
+	release   chan struct{}
+	active    atomic.Int32
+	maxActive atomic.Int32
+}
+
+func (s *blockingMachines) Get(ctx context.Context, id string) (*api.Machine, error) {
+	if id == s.id {
+		active := s.active.Add(1)
+		defer s.active.Add(-1)
+		for {
+			maxActive := s.maxActive.Load()
+			if active <= maxActive || s.maxActive.CompareAndSwap(maxActive, active) {
+				break
+			}
+		}
+
+		select {
+		case s.entered <- struct{}{}:
+		default:
+		}
+		<-s.release
+	}
+	return s.Store.Get(ctx, id)
+}
+
+var _ = Describe("Workers", func() {
+	var env *testEnv
+
+	BeforeEach(func() {
+		env = setupTestEnv()
+	})
+
+	It("should not reconcile a machine in two workers at once", func(ctx SpecContext) {
+		machine := newMachine()
+		r := env.newReconciler(MachineReconcilerOptions{Workers: 4})
+		machines := &blockingMachines{
+			Store:   r.machines,
+			id:      machine.ID,
+			entered: make(chan struct{}, 1),
+			release: make(chan struct{}),
+		}
+		r.machines = machines
+		start(r)
+
+		_, err := env.machines.Create(ctx, machine)
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(machines.entered).Should(Receive())
+
+		By("adding the machine again while it is reconciled")
+		r.queue.Add(machine.ID)
+		r.queue.Add(machine.ID)
+		Consistently(machines.entered, 300*time.Millisecond).ShouldNot(Receive())
+
+		By("finishing the reconciliation")
+		close(machines.release)
+		Eventually(machine.ID).Should(fake.HaveDomainState(env.libvirt, libvirt.DomainRunning))
+		Expect(machines.maxActive.Load()).To(BeEquivalentTo(1))
+	})
+
+	It("should let the garbage collector wait for the machine lock", func(ctx SpecContext) {
+		r := env.newReconciler(MachineReconcilerOptions{})
+
+		machine := newMachine()
+		machine.Finalizers = []string{MachineFinalizer}
+		machine, err := env.machines.Create(ctx, machine)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(env.machines.Delete(ctx, machine.ID)).To(Succeed())
+
+		By("collecting the garbage while the machine is locked")
+		r.machineLocks.Lock(machine.ID)
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			r.collectGarbage(ctx, GinkgoLogr)
+		}()
+		Consistently(done, 300*time.Millisecond).ShouldNot(BeClosed())
+		Expect(env.machines.Get(ctx, machine.ID)).To(HaveField("DeletedAt", Not(BeNil())))
+
+		By("unlocking the machine")
+		r.machineLocks.Unlock(machine.ID)
+		Eventually(done).Should(BeClosed())
+		_, err = env.machines.Get(ctx, machine.ID)
+		Expect(err).To(MatchError(store.ErrNotFound))
+	})
+})
@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	reconcileResultSuccess = "success"
+	reconcileResultError   = "error"
+)
+
+var reconcileDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "libvirt_provider_machine_reconcile_duration_seconds",
+		Help:    "Duration of machine reconciliations, partitioned by result (success or error). Exemplars carry the reconcile ID.",
+		Buckets: prometheus.DefBuckets,
+	},
+	[]string{"result"},
+)
+
+const (
+	orphanedDomainActionReported  = "reported"
+	orphanedDomainActionAdopted   = "adopted"
+	orphanedDomainActionDestroyed = "destroyed"
+)
+
+var orphanedDomains = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "libvirt_provider_orphaned_domains_total",
+		Help: "Number of orphaned domains found by the audit, partitioned by the action taken (reported, adopted or destroyed).",
+	},
+	[]string{"action"},
+)
+
+const (
+	leftoverKindMachineDirectory = "machine-directory"
+	leftoverKindRootFSBase       = "rootfs-base"
+)
+
+var leftoversRemoved = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "libvirt_provider_leftovers_removed_total",
+		Help: "Number of leftover artifacts of machines removed by the garbage collector, partitioned by kind (machine-directory or rootfs-base).",
+	},
+	[]string{"kind"},
+)
+
+var (
+	maxWorkers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "libvirt_provider_machine_reconcile_workers",
+		Help: "Number of workers reconciling machines concurrently.",
+	})
+	activeWorkers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "libvirt_provider_machine_reconcile_active_workers",
+		Help: "Number of workers currently reconciling a machine.",
+	})
+)
+
+var warmImages = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "libvirt_provider_warm_images",
+	Help: "Number of warm images which are pulled and, in root disk mode overlay, converted to a qcow2 base.",
+})
+
+func init() {
+	prometheus.MustRegister(reconcileDuration)
+	prometheus.MustRegister(orphanedDomains)
+	prometheus.MustRegister(leftoversRemoved)
+	prometheus.MustRegister(maxWorkers, activeWorkers)
+	prometheus.MustRegister(warmImages)
+}
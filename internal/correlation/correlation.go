@@ -0,0 +1,133 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package correlation correlates the logs, trace spans and metric exemplars of requests and reconciliations
+// by a common ID.
+package correlation
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// ExemplarLabelID is the exemplar label holding the correlation ID.
+	ExemplarLabelID = "correlation_id"
+	// ExemplarLabelTraceID is the exemplar label holding the trace ID, if a span is recorded.
+	ExemplarLabelTraceID = "trace_id"
+
+	// AttributeID is the span attribute holding the correlation ID.
+	AttributeID = "libvirt_provider.correlation_id"
+	// AttributeMachineID is the span attribute holding the ID of the machine operated on, linking the spans
+	// of requests to the spans of the reconciliations of their machine.
+	AttributeMachineID = "libvirt_provider.machine_id"
+
+	tracerName = "github.com/ironcore-dev/libvirt-provider"
+
+	traceParentKey = "traceparent"
+)
+
+type idKey struct{}
+
+// NewID returns a new correlation ID.
+func NewID() string {
+	return uuid.NewString()
+}
+
+// IDFrom returns the correlation ID of ctx or an empty string.
+func IDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(idKey{}).(string)
+	return id
+}
+
+// Start starts a correlated operation. The returned context carries id, a logger with id added under logKey
+// and a new span of the global tracer provider, which has to be ended by the caller.
+func Start(ctx context.Context, spanName, logKey, id string) (context.Context, trace.Span) {
+	ctx = context.WithValue(ctx, idKey{}, id)
+	ctx = logr.NewContext(ctx, logr.FromContextOrDiscard(ctx).WithValues(logKey, id))
+	return otel.Tracer(tracerName).Start(ctx, spanName, trace.WithAttributes(attribute.String(AttributeID, id)))
+}
+
+// StartSpan starts a span of a step of the operation of ctx, which has to be ended by the caller.
+func StartSpan(ctx context.Context, spanName string) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, spanName)
+}
+
+// Step runs fn as step of the operation of ctx in its own span, recording the error returned by fn.
+func Step(ctx context.Context, spanName string, fn func(ctx context.Context) error) error {
+	ctx, span := StartSpan(ctx, spanName)
+	defer span.End()
+
+	if err := fn(ctx); err != nil {
+		RecordError(span, err)
+		return err
+	}
+	return nil
+}
+
+// SetMachineID sets the ID of the machine operated on as attribute of the span of ctx.
+func SetMachineID(ctx context.Context, machineID string) {
+	if machineID != "" {
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String(AttributeMachineID, machineID))
+	}
+}
+
+// TraceParent returns the W3C trace context of the span of ctx, or an empty string if there is no valid span.
+func TraceParent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get(traceParentKey)
+}
+
+// ContinueTrace starts a span continuing the trace of traceParent, as returned by TraceParent, which has to be
+// ended by the caller. The span is linked to the span of ctx. If traceParent is invalid, the span is a child
+// of the span of ctx.
+func ContinueTrace(ctx context.Context, traceParent, spanName string) (context.Context, trace.Span) {
+	remoteCtx := propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier{traceParentKey: traceParent})
+	if !trace.SpanContextFromContext(remoteCtx).IsRemote() {
+		return StartSpan(ctx, spanName)
+	}
+	return otel.Tracer(tracerName).Start(remoteCtx, spanName, trace.WithLinks(trace.LinkFromContext(ctx)))
+}
+
+// RecordError marks span as failed with err.
+func RecordError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Exemplar returns the exemplar labels linking a metric observation to the operation of ctx.
+func Exemplar(ctx context.Context) prometheus.Labels {
+	labels := prometheus.Labels{}
+	if id := IDFrom(ctx); id != "" {
+		labels[ExemplarLabelID] = id
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		labels[ExemplarLabelTraceID] = spanContext.TraceID().String()
+	}
+	return labels
+}
+
+// Observe observes value, attaching the exemplar of ctx if observer supports exemplars.
+func Observe(ctx context.Context, observer prometheus.Observer, value float64) {
+	exemplarObserver, ok := observer.(prometheus.ExemplarObserver)
+	if !ok {
+		observer.Observe(value)
+		return
+	}
+
+	exemplar := Exemplar(ctx)
+	if len(exemplar) == 0 {
+		observer.Observe(value)
+		return
+	}
+	exemplarObserver.ObserveWithExemplar(value, exemplar)
+}
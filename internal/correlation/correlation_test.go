@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package correlation_test
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	iri "github.com/ironcore-dev/ironcore/iri/apis/machine/v1alpha1"
+	irimeta "github.com/ironcore-dev/ironcore/iri/apis/meta/v1alpha1"
+	"github.com/ironcore-dev/libvirt-provider/internal/correlation"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var _ = Describe("Correlation", func() {
+	It("should correlate logs and metric exemplars", func() {
+		var logged []string
+		log := funcr.New(func(prefix, args string) {
+			logged = append(logged, args)
+		}, funcr.Options{})
+
+		By("starting a correlated operation")
+		ctx, span := correlation.Start(logr.NewContext(context.Background(), log), "Test", "RequestID", "foo")
+		defer span.End()
+		Expect(correlation.IDFrom(ctx)).To(Equal("foo"))
+
+		By("logging with the logger of the context")
+		logr.FromContextOrDiscard(ctx).Info("Test")
+		Expect(logged).To(ConsistOf(ContainSubstring(`"RequestID"="foo"`)))
+
+		By("observing a histogram")
+		histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test"})
+		correlation.Observe(ctx, histogram, 0.5)
+
+		metric := &dto.Metric{}
+		Expect(histogram.Write(metric)).To(Succeed())
+		Expect(metric.Histogram.Bucket).To(ContainElement(HaveField("Exemplar.Label", ConsistOf(
+			SatisfyAll(
+				HaveField("Name", HaveValue(Equal(correlation.ExemplarLabelID))),
+				HaveField("Value", HaveValue(Equal("foo"))),
+			),
+		))))
+	})
+
+	It("should observe without exemplar if uncorrelated", func() {
+		histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "test"})
+		correlation.Observe(context.Background(), histogram, 0.5)
+
+		metric := &dto.Metric{}
+		Expect(histogram.Write(metric)).To(Succeed())
+		Expect(metric.Histogram.GetSampleCount()).To(BeEquivalentTo(1))
+		Expect(metric.Histogram.Bucket).To(HaveEach(HaveField("Exemplar", BeNil())))
+	})
+
+	It("should determine the machine of requests", func() {
+		Expect(correlation.MachineIDFrom(&iri.DeleteMachineRequest{MachineId: "foo"}, &iri.DeleteMachineResponse{})).To(Equal("foo"))
+		Expect(correlation.MachineIDFrom(&iri.CreateMachineRequest{}, &iri.CreateMachineResponse{
+			Machine: &iri.Machine{Metadata: &irimeta.ObjectMetadata{Id: "bar"}},
+		})).To(Equal("bar"))
+		Expect(correlation.MachineIDFrom(&iri.ListMachinesRequest{}, nil)).To(BeEmpty())
+	})
+
+	It("should continue traces by their trace parent", func() {
+		spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+			TraceID:    trace.TraceID{0x01},
+			SpanID:     trace.SpanID{0x02},
+			TraceFlags: trace.FlagsSampled,
+		})
+		traceParent := correlation.TraceParent(trace.ContextWithSpanContext(context.Background(), spanContext))
+		Expect(traceParent).To(Equal("00-01000000000000000000000000000000-0200000000000000-01"))
+
+		ctx, span := correlation.ContinueTrace(context.Background(), traceParent, "Test")
+		defer span.End()
+		Expect(trace.SpanContextFromContext(ctx).TraceID()).To(Equal(spanContext.TraceID()))
+
+		Expect(correlation.TraceParent(context.Background())).To(BeEmpty())
+	})
+
+	It("should export continued traces as part of the trace of their parent", func() {
+		recorder := tracetest.NewSpanRecorder()
+		provider := otel.GetTracerProvider()
+		DeferCleanup(otel.SetTracerProvider, provider)
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+		By("starting a request")
+		requestCtx, requestSpan := correlation.Start(context.Background(), "Request", "RequestID", "foo")
+		traceParent := correlation.TraceParent(requestCtx)
+		requestSpan.End()
+
+		By("continuing the trace of the request in a reconciliation")
+		reconcileCtx, reconcileSpan := correlation.Start(context.Background(), "Reconcile", "ReconcileID", "bar")
+		_, span := correlation.ContinueTrace(reconcileCtx, traceParent, "Continued")
+		span.End()
+		reconcileSpan.End()
+
+		spans := map[string]sdktrace.ReadOnlySpan{}
+		for _, span := range recorder.Ended() {
+			spans[span.Name()] = span
+		}
+		Expect(spans).To(HaveLen(3))
+		continued := spans["Continued"]
+		Expect(continued.Parent().SpanID()).To(Equal(spans["Request"].SpanContext().SpanID()))
+		Expect(continued.SpanContext().TraceID()).To(Equal(spans["Request"].SpanContext().TraceID()))
+		Expect(continued.Links()).To(ConsistOf(HaveField("SpanContext.SpanID()", spans["Reconcile"].SpanContext().SpanID())))
+	})
+})
@@ -0,0 +1,82 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package correlation
+
+import (
+	"context"
+	"time"
+
+	iri "github.com/ironcore-dev/ironcore/iri/apis/machine/v1alpha1"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// RequestIDMetadataKey is the gRPC metadata key of the request ID. A request ID sent by clients is reused,
+	// otherwise a new one is generated. It is returned as response header.
+	RequestIDMetadataKey = "x-request-id"
+
+	maxRequestIDLength = 64
+)
+
+var grpcRequestDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "libvirt_provider_grpc_request_duration_seconds",
+		Help:    "Duration of gRPC requests, partitioned by method and status code. Exemplars carry the request ID.",
+		Buckets: prometheus.DefBuckets,
+	},
+	[]string{"method", "code"},
+)
+
+func init() {
+	prometheus.MustRegister(grpcRequestDuration)
+}
+
+// UnaryServerInterceptor correlates the logs, trace span and request duration metric of a request by its
+// request ID. The logger has to be injected into the context before.
+func UnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+
+	id := requestIDFrom(ctx)
+	ctx, span := Start(ctx, info.FullMethod, "RequestID", id)
+	defer span.End()
+
+	_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDMetadataKey, id))
+
+	resp, err := handler(ctx, req)
+	SetMachineID(ctx, MachineIDFrom(req, resp))
+	if err != nil {
+		RecordError(span, err)
+	}
+
+	Observe(ctx, grpcRequestDuration.WithLabelValues(info.FullMethod, status.Code(err).String()), time.Since(start).Seconds())
+	return resp, err
+}
+
+// MachineIDFrom returns the ID of the machine a request operated on, being the machine ID of req or the ID of
+// the machine of resp, e.g. of CreateMachine.
+func MachineIDFrom(req, resp interface{}) string {
+	if r, ok := req.(interface{ GetMachineId() string }); ok && r.GetMachineId() != "" {
+		return r.GetMachineId()
+	}
+	if r, ok := resp.(interface{ GetMachine() *iri.Machine }); ok {
+		return r.GetMachine().GetMetadata().GetId()
+	}
+	return ""
+}
+
+func requestIDFrom(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return NewID()
+	}
+
+	ids := md.Get(RequestIDMetadataKey)
+	if len(ids) == 0 || ids[0] == "" || len(ids[0]) > maxRequestIDLength {
+		return NewID()
+	}
+	return ids[0]
+}
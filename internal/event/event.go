@@ -97,6 +97,12 @@ func (s *ListWatchSource[E]) Start(ctx context.Context) error {
 			case <-ctx.Done():
 				return
 			case evt := <-watch.Events():
+				if evt.Type == store.WatchEventTypeResync {
+					log.V(1).Info("Watch events have been dropped, relisting objects")
+					s.relist(ctx, log)
+					continue
+				}
+
 				eventType, err := typeFromWatchType(evt.Type)
 				if err != nil {
 					log.Error(err, "error converting watch event type")
@@ -116,24 +122,28 @@ func (s *ListWatchSource[E]) Start(ctx context.Context) error {
 		defer wg.Done()
 
 		wait.UntilWithContext(ctx, func(ctx context.Context) {
-			objs, err := s.listFunc(ctx)
-			if err != nil {
-				log.Error(err, "failed to list objects")
-				return
-			}
-
-			for _, obj := range objs {
-				s.enqueue(Event[E]{
-					Type:   TypeGeneric,
-					Object: obj,
-				})
-			}
+			s.relist(ctx, log)
 		}, s.resyncDuration)
 	}()
 
 	return nil
 }
 
+func (s *ListWatchSource[E]) relist(ctx context.Context, log logr.Logger) {
+	objs, err := s.listFunc(ctx)
+	if err != nil {
+		log.Error(err, "failed to list objects")
+		return
+	}
+
+	for _, obj := range objs {
+		s.enqueue(Event[E]{
+			Type:   TypeGeneric,
+			Object: obj,
+		})
+	}
+}
+
 func (s *ListWatchSource[E]) AddHandler(handler Handler[E]) (HandlerRegistration, error) {
 	s.handlesMu.Lock()
 	defer s.handlesMu.Unlock()
@@ -4,8 +4,10 @@
 package machineevent
 
 import (
+	"cmp"
 	"context"
 	"fmt"
+	"slices"
 	"sync"
 	"time"
 
@@ -14,6 +16,7 @@ import (
 	irievent "github.com/ironcore-dev/ironcore/iri/apis/event/v1alpha1"
 	irimeta "github.com/ironcore-dev/ironcore/iri/apis/meta/v1alpha1"
 	"github.com/ironcore-dev/libvirt-provider/api"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
 )
 
@@ -25,6 +28,29 @@ type EventRecorder interface {
 // EventStore defines an interface for listing events
 type EventStore interface {
 	ListEvents() []*irievent.Event
+	ListEventsWithOptions(opts ListOptions) []*irievent.Event
+}
+
+// Forwarder forwards recorded events, e.g. to site alerting. Forward must not block.
+type Forwarder interface {
+	Forward(event *irievent.Event)
+}
+
+// ListOptions filter the events listed. The zero value lists all events.
+type ListOptions struct {
+	// MachineID restricts the events to the ones of the machine with the given ID.
+	MachineID string
+	// Since restricts the events to the ones recorded at or after the given time.
+	Since time.Time
+	// Types restricts the events to the ones of the given types, e.g. corev1.EventTypeWarning.
+	Types []string
+}
+
+func (o ListOptions) matches(event *irievent.Event) bool {
+	if !o.Since.IsZero() && event.Spec.EventTime < o.Since.Unix() {
+		return false
+	}
+	return len(o.Types) == 0 || slices.Contains(o.Types, event.Spec.Type)
 }
 
 // EventStoreOptions defines options to initialize the machine event store
@@ -32,6 +58,11 @@ type EventStoreOptions struct {
 	MachineEventMaxEvents      int
 	MachineEventTTL            time.Duration
 	MachineEventResyncInterval time.Duration
+	// MachineEventMaxPersistedEvents is the maximum number of events a persistent store keeps on disk,
+	// including the events beyond MachineEventMaxEvents only kept on disk.
+	MachineEventMaxPersistedEvents int
+	// Forwarder is forwarded every recorded event, including every repetition of collapsed events.
+	Forwarder Forwarder
 }
 
 // Store implements the EventRecorder and EventStore interface and represents an in-memory event store with TTL for events.
@@ -44,6 +75,20 @@ type Store struct {
 	head                int               // Index of the oldest event
 	count               int               // Current number of events in the store
 	log                 logr.Logger       // Logger for logging overridden events
+	forwarder           Forwarder         // Forwarder of recorded events, if any
+	// byMachine indexes the events by the ID of their machine, in the order they were recorded.
+	byMachine map[string][]*irievent.Event
+	// series tracks the repetitions collapsed into events, see recordEvent.
+	series map[*irievent.Event]*series
+
+	// journal persists the events of persistent stores, see NewPersistentEventStore.
+	journal            *journal
+	maxPersistedEvents int
+	// nextSeq is the sequence number of the next event. The events in memory have the sequence numbers
+	// nextSeq-count to nextSeq-1, older ones are only persisted.
+	nextSeq uint64
+	// oldestPersistedSeq is the sequence number of the oldest persisted event.
+	oldestPersistedSeq uint64
 }
 
 // NewEventStore creates a new EventStore with a fixed number of events and set TTL for events.
@@ -56,10 +101,76 @@ func NewEventStore(log logr.Logger, opts EventStoreOptions) *Store {
 		head:                0,
 		count:               0,
 		log:                 log,
+		forwarder:           opts.Forwarder,
+		byMachine:           make(map[string][]*irievent.Event),
+		series:              make(map[*irievent.Event]*series),
 	}
 }
 
-// Eventf logs and records an event with formatted message.
+// series is a repeated event. Repetitions of an event are collapsed into it, counting them, like
+// Kubernetes does, so an error recurring on every reconciliation doesn't push out all other events.
+type series struct {
+	Count int `json:"count"`
+	// FirstSeen is the time of the first occurrence in seconds since the epoch. The event time of the event
+	// is the time of the last occurrence.
+	FirstSeen int64 `json:"firstSeen"`
+	// Message is the message of the event without the count appended.
+	Message string `json:"message"`
+}
+
+func (s *series) message(lastSeen int64) string {
+	return fmt.Sprintf("%s (x%d over %s)", s.Message, s.Count, time.Duration(lastSeen-s.FirstSeen)*time.Second)
+}
+
+// NewPersistentEventStore creates an EventStore persisting its events in dir, so they survive restarts.
+// Events beyond the maximum number of events kept in memory are kept on disk up to
+// opts.MachineEventMaxPersistedEvents. Persisted events expire after the same TTL as events in memory.
+func NewPersistentEventStore(log logr.Logger, opts EventStoreOptions, dir string) (*Store, error) {
+	if opts.MachineEventMaxPersistedEvents < opts.MachineEventMaxEvents {
+		return nil, fmt.Errorf("maximum number of persisted machine events must be at least the maximum number of machine events")
+	}
+
+	j, records, err := openJournal(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	es := NewEventStore(log, opts)
+	es.journal = j
+	es.maxPersistedEvents = opts.MachineEventMaxPersistedEvents
+
+	// Restored events are numbered anew, so the newest ones can be kept in memory.
+	records = es.retained(records)
+	for i := range records {
+		records[i].Seq = uint64(i)
+	}
+	if err := j.rewrite(records); err != nil {
+		_ = j.close()
+		return nil, err
+	}
+	for _, record := range records[max(0, len(records)-es.maxEvents):] {
+		es.insert(record.Event)
+		if record.Series != nil {
+			es.series[record.Event] = record.Series
+		}
+	}
+	es.nextSeq = uint64(len(records))
+	return es, nil
+}
+
+// Close closes the journal of a persistent store.
+func (es *Store) Close() error {
+	if es.journal == nil {
+		return nil
+	}
+
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+	return es.journal.close()
+}
+
+// Eventf logs and records an event with formatted message. The event type has to be corev1.EventTypeNormal or
+// corev1.EventTypeWarning, events of other types are recorded as warnings. Reasons are the Reason constants.
 func (es *Store) Eventf(log logr.Logger, apiMetadata api.Metadata, eventType, reason, messageFormat string, args ...any) {
 	metadata, err := api.GetObjectMetadata(apiMetadata)
 	if err != nil {
@@ -67,6 +178,11 @@ func (es *Store) Eventf(log logr.Logger, apiMetadata api.Metadata, eventType, re
 		return
 	}
 
+	if eventType != corev1.EventTypeNormal && eventType != corev1.EventTypeWarning {
+		log.Error(fmt.Errorf("unknown event type %q", eventType), "Recording event as warning", "reason", reason)
+		eventType = corev1.EventTypeWarning
+	}
+
 	// Format the message using the provided format and arguments
 	message := fmt.Sprintf(messageFormat, args...)
 
@@ -74,19 +190,24 @@ func (es *Store) Eventf(log logr.Logger, apiMetadata api.Metadata, eventType, re
 }
 
 // recordEvent adds a new Event to the store. Implements the EventRecorder interface.
+// An event identical to one of the same machine still in the store is collapsed into that one instead.
 func (es *Store) recordEvent(metadata *irimeta.ObjectMetadata, eventType, reason, message string) {
 	es.mutex.Lock()
 	defer es.mutex.Unlock()
 
-	// Calculate the index where the new event will be inserted
-	index := (es.head + es.count) % es.maxEvents
-
-	// If the store is full, log and overwrite the oldest event and move the head
-	if es.count == es.maxEvents {
-		es.log.V(1).Info("Overriding event", "event", es.events[es.head])
-		es.head = (es.head + 1) % es.maxEvents
-	} else {
-		es.count++
+	now := time.Now().Unix()
+	if event := es.findRepeated(metadata.GetId(), eventType, reason, message); event != nil {
+		s, ok := es.series[event]
+		if !ok {
+			s = &series{Count: 1, FirstSeen: event.Spec.EventTime, Message: message}
+			es.series[event] = s
+		}
+		s.Count++
+		event.Spec.EventTime = now
+		event.Spec.Message = s.message(now)
+		es.persistRepeated(event)
+		es.forward(event)
+		return
 	}
 
 	event := &irievent.Event{
@@ -95,11 +216,183 @@ func (es *Store) recordEvent(metadata *irimeta.ObjectMetadata, eventType, reason
 			Type:               eventType,
 			Reason:             reason,
 			Message:            message,
-			EventTime:          time.Now().Unix(),
+			EventTime:          now,
 		},
 	}
+	es.insert(event)
+	es.persist(event)
+	es.forward(event)
+}
+
+func (es *Store) forward(event *irievent.Event) {
+	if es.forwarder == nil {
+		return
+	}
+	// Events are modified when repetitions are collapsed into them.
+	if clone, ok := proto.Clone(event).(*irievent.Event); ok {
+		es.forwarder.Forward(clone)
+	}
+}
+
+// findRepeated returns the newest event of the machine with the given type, reason and message, if any.
+func (es *Store) findRepeated(machineID, eventType, reason, message string) *irievent.Event {
+	events := es.byMachine[machineID]
+	for i := len(events) - 1; i >= 0; i-- {
+		event := events[i]
+		if event.Spec.Type != eventType || event.Spec.Reason != reason {
+			continue
+		}
+		eventMessage := event.Spec.Message
+		if s, ok := es.series[event]; ok {
+			eventMessage = s.Message
+		}
+		if eventMessage == message {
+			return event
+		}
+	}
+	return nil
+}
+
+// insert adds event to the events in memory.
+func (es *Store) insert(event *irievent.Event) {
+	// If the store is full, log and drop the oldest event
+	if es.count == es.maxEvents {
+		es.log.V(1).Info("Overriding event", "event", es.events[es.head])
+		es.removeOldest()
+	}
+
+	// Calculate the index where the new event will be inserted
+	index := (es.head + es.count) % es.maxEvents
+	es.count++
 
 	es.events[index] = event
+	machineID := event.Spec.InvolvedObjectMeta.GetId()
+	es.byMachine[machineID] = append(es.byMachine[machineID], event)
+}
+
+// persist appends event to the journal of a persistent store.
+func (es *Store) persist(event *irievent.Event) {
+	if es.journal == nil {
+		return
+	}
+
+	seq := es.nextSeq
+	es.nextSeq++
+	es.appendRecord(journalRecord{Seq: seq, Event: event})
+}
+
+// persistRepeated appends event, which collapsed another repetition, to the journal of a persistent store
+// again, replacing its previous record.
+func (es *Store) persistRepeated(event *irievent.Event) {
+	if es.journal == nil {
+		return
+	}
+
+	for i := 0; i < es.count; i++ {
+		if es.events[(es.head+i)%es.maxEvents] == event {
+			es.appendRecord(journalRecord{Seq: es.nextSeq - uint64(es.count-i), Event: event, Series: es.series[event]})
+			return
+		}
+	}
+}
+
+// appendRecord appends record to the journal, which is compacted once it holds twice the events to be kept.
+func (es *Store) appendRecord(record journalRecord) {
+	if err := es.journal.append(record); err != nil {
+		es.log.Error(err, "Failed to persist machine event")
+		return
+	}
+	if es.journal.records > 2*es.maxPersistedEvents {
+		if err := es.compact(); err != nil {
+			es.log.Error(err, "Failed to compact machine events journal")
+		}
+	}
+}
+
+// compact removes the expired events and the events beyond the maximum number of persisted events from
+// the journal.
+func (es *Store) compact() error {
+	records, err := es.journal.read()
+	if err != nil {
+		return err
+	}
+	if retained := es.retained(records); len(retained) < len(records) || es.journal.records > len(records) {
+		records = retained
+		if err := es.journal.rewrite(records); err != nil {
+			return err
+		}
+	}
+
+	es.oldestPersistedSeq = es.nextSeq
+	if len(records) > 0 {
+		es.oldestPersistedSeq = records[0].Seq
+	}
+	return nil
+}
+
+// retained returns the records to keep of the records of the journal, being the newest unexpired ones up to
+// the maximum number of persisted events.
+func (es *Store) retained(records []journalRecord) []journalRecord {
+	records = slices.DeleteFunc(slices.Clone(records), func(record journalRecord) bool {
+		return es.expired(record.Event, time.Now())
+	})
+	return records[max(0, len(records)-es.maxPersistedEvents):]
+}
+
+func (es *Store) expired(event *irievent.Event, now time.Time) bool {
+	return !time.Unix(event.Spec.EventTime, 0).Add(es.eventTTL).After(now)
+}
+
+// persistedOnly returns the persisted events matching opts that are no longer kept in memory.
+func (es *Store) persistedOnly(opts ListOptions) []*irievent.Event {
+	if es.journal == nil {
+		return nil
+	}
+	firstInMemory := es.nextSeq - uint64(es.count)
+	if es.oldestPersistedSeq >= firstInMemory {
+		return nil
+	}
+
+	records, err := es.journal.read()
+	if err != nil {
+		es.log.Error(err, "Failed to read persisted machine events")
+		return nil
+	}
+
+	// The journal may hold more events than retained until it is compacted.
+	end, _ := slices.BinarySearchFunc(records, firstInMemory, func(record journalRecord, seq uint64) int {
+		return cmp.Compare(record.Seq, seq)
+	})
+	records = es.retained(records[:end])
+	records = records[max(0, len(records)-(es.maxPersistedEvents-es.count)):]
+
+	var events []*irievent.Event
+	for _, record := range records {
+		if (opts.MachineID != "" && record.Event.Spec.InvolvedObjectMeta.GetId() != opts.MachineID) || !opts.matches(record.Event) {
+			continue
+		}
+		events = append(events, record.Event)
+	}
+	return events
+}
+
+// removeOldest removes the oldest event from the store and the index. The oldest event of the store is the
+// oldest event of its machine as well.
+func (es *Store) removeOldest() {
+	event := es.events[es.head]
+	machineID := event.Spec.InvolvedObjectMeta.GetId()
+	if events := es.byMachine[machineID][1:]; len(events) > 0 {
+		es.byMachine[machineID] = events
+	} else {
+		delete(es.byMachine, machineID)
+	}
+
+	delete(es.series, event)
+
+	// Clear the reference to the removed event
+	es.events[es.head] = nil
+	es.head = (es.head + 1) % es.maxEvents
+	es.count--
 }
 
 // removeExpiredEvents checks and removes events whose TTL has expired.
@@ -110,8 +403,7 @@ func (es *Store) removeExpiredEvents() {
 	now := time.Now()
 
 	for es.count > 0 {
-		index := es.head % es.maxEvents
-		event := es.events[index]
+		event := es.events[es.head]
 		eventTime := time.Unix(event.Spec.EventTime, 0)
 		eventTimeWithDuration := eventTime.Add(es.eventTTL)
 
@@ -119,10 +411,13 @@ func (es *Store) removeExpiredEvents() {
 			break
 		}
 
-		// Clear the reference to the expired event
-		es.events[index] = nil
-		es.head = (es.head + 1) % es.maxEvents
-		es.count--
+		es.removeOldest()
+	}
+
+	if es.journal != nil {
+		if err := es.compact(); err != nil {
+			es.log.Error(err, "Failed to compact machine events journal")
+		}
 	}
 }
 
@@ -135,16 +430,35 @@ func (es *Store) Start(ctx context.Context) {
 
 // ListEvents returns a copy of all events currently in the store.
 func (es *Store) ListEvents() []*irievent.Event {
+	return es.ListEventsWithOptions(ListOptions{})
+}
+
+// ListEventsWithOptions returns a copy of the events currently in the store matching opts, oldest first.
+// Events of a machine are looked up by their index instead of going through all events.
+func (es *Store) ListEventsWithOptions(opts ListOptions) []*irievent.Event {
 	es.mutex.Lock()
 	defer es.mutex.Unlock()
 
-	result := make([]*irievent.Event, 0, es.count)
-	for i := 0; i < es.count; i++ {
-		index := (es.head + i) % es.maxEvents
+	var events []*irievent.Event
+	if opts.MachineID != "" {
+		events = es.byMachine[opts.MachineID]
+	} else {
+		events = make([]*irievent.Event, 0, es.count)
+		for i := 0; i < es.count; i++ {
+			events = append(events, es.events[(es.head+i)%es.maxEvents])
+		}
+	}
+
+	// Events read from the journal are copies already.
+	result := es.persistedOnly(opts)
+	for _, event := range events {
+		if !opts.matches(event) {
+			continue
+		}
 		// Create a deep copy of the event to break the reference
-		clone, ok := proto.Clone(es.events[index]).(*irievent.Event)
+		clone, ok := proto.Clone(event).(*irievent.Event)
 		if !ok {
-			es.log.Error(fmt.Errorf("failed to clone event: %s", es.events[index]), "assertion error")
+			es.log.Error(fmt.Errorf("failed to clone event: %s", event), "assertion error")
 			continue
 		}
 		result = append(result, clone)
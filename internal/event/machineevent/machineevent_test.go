@@ -6,6 +6,8 @@ package machineevent_test
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -17,6 +19,7 @@ import (
 	. "github.com/ironcore-dev/libvirt-provider/internal/event/machineevent"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
 )
 
 func TestHandler(t *testing.T) {
@@ -27,7 +30,7 @@ func TestHandler(t *testing.T) {
 const (
 	maxEvents      = 5
 	eventTTL       = 2 * time.Second
-	eventType      = "TestType"
+	eventType      = corev1.EventTypeNormal
 	reason         = "TestReason"
 	message        = "TestMessage"
 	resyncInterval = 2 * time.Second
@@ -100,6 +103,40 @@ var _ = Describe("Machine EventStore", func() {
 
 			Expect(events[maxEvents-1].Spec.Message).To(Equal("New Event"))
 		})
+
+		It("should collapse repeated events", func() {
+			es.Eventf(log, apiMetadata, corev1.EventTypeWarning, reason, message)
+			es.Eventf(log, apiMetadata, eventType, reason, "other")
+			es.Eventf(log, apiMetadata, corev1.EventTypeWarning, reason, message)
+			es.Eventf(log, apiMetadata, corev1.EventTypeWarning, reason, message)
+			Expect(logOutput.String()).To(BeEmpty())
+
+			events := es.ListEvents()
+			Expect(events).To(HaveExactElements(
+				HaveField("Spec.Message", HavePrefix(message+" (x3 over ")),
+				HaveField("Spec.Message", "other"),
+			))
+		})
+
+		It("should not collapse events of different machines, types or reasons", func() {
+			otherMetadata := api.Metadata{
+				ID:          "test-id-5678",
+				Annotations: apiMetadata.Annotations,
+			}
+			es.Eventf(log, apiMetadata, eventType, reason, message)
+			es.Eventf(log, otherMetadata, eventType, reason, message)
+			es.Eventf(log, apiMetadata, corev1.EventTypeWarning, reason, message)
+			es.Eventf(log, apiMetadata, eventType, "OtherReason", message)
+
+			Expect(es.ListEvents()).To(HaveEach(HaveField("Spec.Message", message)))
+			Expect(es.ListEvents()).To(HaveLen(4))
+		})
+
+		It("should record events of unknown types as warnings", func() {
+			es.Eventf(log, apiMetadata, "Unknown", reason, message)
+			Expect(logOutput.String()).To(ContainSubstring("unknown event type"))
+			Expect(es.ListEvents()).To(HaveExactElements(HaveField("Spec.Type", corev1.EventTypeWarning)))
+		})
 	})
 
 	Context("removeExpiredEvents", func() {
@@ -171,4 +208,136 @@ var _ = Describe("Machine EventStore", func() {
 			Expect(storedEvents[0].Spec.Message).ToNot(Equal(events[0].Spec.Message))
 		})
 	})
+
+	Context("ListEventsWithOptions", func() {
+		otherMetadata := api.Metadata{
+			ID:          "test-id-5678",
+			Annotations: apiMetadata.Annotations,
+		}
+
+		It("should filter events by machine and type", func() {
+			es.Eventf(log, apiMetadata, "Normal", reason, "first")
+			es.Eventf(log, otherMetadata, "Normal", reason, "other")
+			es.Eventf(log, apiMetadata, "Warning", reason, "second")
+
+			events := es.ListEventsWithOptions(ListOptions{MachineID: apiMetadata.ID})
+			Expect(events).To(HaveExactElements(
+				HaveField("Spec.Message", "first"),
+				HaveField("Spec.Message", "second"),
+			))
+
+			events = es.ListEventsWithOptions(ListOptions{MachineID: apiMetadata.ID, Types: []string{"Warning"}})
+			Expect(events).To(HaveExactElements(HaveField("Spec.Message", "second")))
+
+			Expect(es.ListEventsWithOptions(ListOptions{MachineID: "unknown"})).To(BeEmpty())
+		})
+
+		It("should filter events by time", func() {
+			es.Eventf(log, apiMetadata, eventType, reason, message)
+
+			Expect(es.ListEventsWithOptions(ListOptions{Since: time.Now().Add(-time.Minute)})).To(HaveLen(1))
+			Expect(es.ListEventsWithOptions(ListOptions{Since: time.Now().Add(time.Minute)})).To(BeEmpty())
+		})
+
+		It("should drop overridden events from the machine index", func() {
+			es.Eventf(log, otherMetadata, eventType, reason, "other")
+			for i := 0; i < maxEvents; i++ {
+				es.Eventf(log, apiMetadata, eventType, reason, fmt.Sprintf("%s %d", message, i))
+			}
+
+			Expect(es.ListEventsWithOptions(ListOptions{MachineID: otherMetadata.ID})).To(BeEmpty())
+			Expect(es.ListEventsWithOptions(ListOptions{MachineID: apiMetadata.ID})).To(HaveLen(maxEvents))
+		})
+	})
+
+	Context("NewPersistentEventStore", func() {
+		var (
+			dir            string
+			persistentOpts EventStoreOptions
+		)
+
+		BeforeEach(func() {
+			dir = GinkgoT().TempDir()
+			persistentOpts = opts
+			persistentOpts.MachineEventMaxPersistedEvents = 2 * maxEvents
+		})
+
+		It("should keep events beyond the maximum number of events on disk", func() {
+			es, err := NewPersistentEventStore(log, persistentOpts, dir)
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(es.Close)
+
+			for i := 0; i < maxEvents+2; i++ {
+				es.Eventf(log, apiMetadata, eventType, reason, fmt.Sprintf("%s %d", message, i))
+			}
+
+			events := es.ListEvents()
+			Expect(events).To(HaveLen(maxEvents + 2))
+			Expect(events[0].Spec.Message).To(Equal(message + " 0"))
+			Expect(events[maxEvents+1].Spec.Message).To(Equal(fmt.Sprintf("%s %d", message, maxEvents+1)))
+			Expect(es.ListEventsWithOptions(ListOptions{MachineID: apiMetadata.ID})).To(HaveLen(maxEvents + 2))
+		})
+
+		It("should restore the persisted events", func() {
+			es, err := NewPersistentEventStore(log, persistentOpts, dir)
+			Expect(err).NotTo(HaveOccurred())
+			for i := 0; i < maxEvents+2; i++ {
+				es.Eventf(log, apiMetadata, eventType, reason, fmt.Sprintf("%s %d", message, i))
+			}
+			Expect(es.Close()).To(Succeed())
+
+			es, err = NewPersistentEventStore(log, persistentOpts, dir)
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(es.Close)
+
+			events := es.ListEvents()
+			Expect(events).To(HaveLen(maxEvents + 2))
+			Expect(events[0].Spec.Message).To(Equal(message + " 0"))
+
+			By("recording further events")
+			es.Eventf(log, apiMetadata, eventType, reason, "new")
+			events = es.ListEvents()
+			Expect(events).To(HaveLen(maxEvents + 3))
+			Expect(events[maxEvents+2].Spec.Message).To(Equal("new"))
+		})
+
+		It("should restore collapsed events", func() {
+			es, err := NewPersistentEventStore(log, persistentOpts, dir)
+			Expect(err).NotTo(HaveOccurred())
+			es.Eventf(log, apiMetadata, eventType, reason, message)
+			es.Eventf(log, apiMetadata, eventType, reason, message)
+			Expect(es.Close()).To(Succeed())
+
+			es, err = NewPersistentEventStore(log, persistentOpts, dir)
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(es.Close)
+			Expect(es.ListEvents()).To(HaveExactElements(HaveField("Spec.Message", HavePrefix(message+" (x2 over "))))
+
+			By("collapsing further repetitions")
+			es.Eventf(log, apiMetadata, eventType, reason, message)
+			Expect(es.ListEvents()).To(HaveExactElements(HaveField("Spec.Message", HavePrefix(message+" (x3 over "))))
+		})
+
+		It("should drop expired and excess persisted events", func() {
+			es, err := NewPersistentEventStore(log, persistentOpts, dir)
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(es.Close)
+
+			for i := 0; i < 3*maxEvents; i++ {
+				es.Eventf(log, apiMetadata, eventType, reason, fmt.Sprintf("%s %d", message, i))
+			}
+			events := es.ListEvents()
+			Expect(events).To(HaveLen(2 * maxEvents))
+			Expect(events[0].Spec.Message).To(Equal(fmt.Sprintf("%s %d", message, maxEvents)))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			DeferCleanup(cancel)
+			go es.Start(ctx)
+
+			Eventually(func(g Gomega) {
+				g.Expect(es.ListEvents()).To(BeEmpty())
+			}).WithTimeout(eventTTL + 2*resyncInterval).WithPolling(resyncInterval / 4).Should(Succeed())
+			Expect(os.ReadFile(filepath.Join(dir, "events.jsonl"))).To(BeEmpty())
+		})
+	})
 })
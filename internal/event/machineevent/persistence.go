@@ -0,0 +1,149 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package machineevent
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	irievent "github.com/ironcore-dev/ironcore/iri/apis/event/v1alpha1"
+)
+
+const (
+	journalFile = "events.jsonl"
+	perm        = 0777
+)
+
+// journalRecord is a persisted event. Seq orders the events of a journal and tells the events kept in
+// memory from the ones only persisted. An event collapsing repetitions is appended again with the same Seq
+// on every repetition, the last record of a Seq wins.
+type journalRecord struct {
+	Seq    uint64          `json:"seq"`
+	Event  *irievent.Event `json:"event"`
+	Series *series         `json:"series,omitempty"`
+}
+
+// journal is an append-only file of events as JSON lines, rewritten on compaction.
+type journal struct {
+	path string
+	file *os.File
+	// records is the number of records in the file.
+	records int
+}
+
+func openJournal(dir string) (*journal, []journalRecord, error) {
+	if err := os.MkdirAll(dir, perm); err != nil {
+		return nil, nil, fmt.Errorf("error creating machine events directory: %w", err)
+	}
+
+	j := &journal{path: filepath.Join(dir, journalFile)}
+	records, err := j.read()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := j.open(); err != nil {
+		return nil, nil, err
+	}
+	j.records = len(records)
+	return j, records, nil
+}
+
+func (j *journal) open() error {
+	file, err := os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening machine events journal: %w", err)
+	}
+	j.file = file
+	return nil
+}
+
+// read reads all records of the journal. Records that can't be decoded, e.g. a line partially written
+// before a crash, are skipped.
+func (j *journal) read() ([]journalRecord, error) {
+	file, err := os.Open(j.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error opening machine events journal: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	var records []journalRecord
+	indexes := make(map[uint64]int)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var record journalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil || record.Event.GetSpec() == nil {
+			continue
+		}
+		if i, ok := indexes[record.Seq]; ok {
+			records[i] = record
+			continue
+		}
+		indexes[record.Seq] = len(records)
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading machine events journal: %w", err)
+	}
+	return records, nil
+}
+
+func (j *journal) append(record journalRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("error marshalling machine event: %w", err)
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("error persisting machine event: %w", err)
+	}
+	j.records++
+	return nil
+}
+
+// rewrite replaces the records of the journal by records.
+func (j *journal) rewrite(records []journalRecord) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(j.path), "."+journalFile+"-")
+	if err != nil {
+		return fmt.Errorf("error creating machine events journal: %w", err)
+	}
+	defer func() { _ = os.Remove(tmpFile.Name()) }()
+
+	writer := bufio.NewWriter(tmpFile)
+	for _, record := range records {
+		data, err := json.Marshal(record)
+		if err != nil {
+			_ = tmpFile.Close()
+			return fmt.Errorf("error marshalling machine event: %w", err)
+		}
+		_, _ = writer.Write(append(data, '\n'))
+	}
+	if err := writer.Flush(); err != nil {
+		_ = tmpFile.Close()
+		return fmt.Errorf("error writing machine events journal: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("error closing machine events journal: %w", err)
+	}
+
+	if err := j.file.Close(); err != nil {
+		return fmt.Errorf("error closing machine events journal: %w", err)
+	}
+	if err := os.Rename(tmpFile.Name(), j.path); err != nil {
+		// Keep appending to the old journal.
+		return errors.Join(fmt.Errorf("error replacing machine events journal: %w", err), j.open())
+	}
+	j.records = len(records)
+	return j.open()
+}
+
+func (j *journal) close() error {
+	return j.file.Close()
+}
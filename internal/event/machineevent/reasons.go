@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package machineevent
+
+// Reasons of the events recorded for machines. Clients may match on them, so their values must not change.
+const (
+	// Reasons of events of type corev1.EventTypeNormal.
+	ReasonAttachedPCIDevice    = "AttachedPCIDevice"
+	ReasonAttachedMdevDevice   = "AttachedMdevDevice"
+	ReasonAttachedUSBDevice    = "AttachedUSBDevice"
+	ReasonAttachedNIC          = "AttchedNIC"
+	ReasonAttachedVolume       = "AttchedVolume"
+	ReasonCompletedDeletion    = "CompletedDeletion"
+	ReasonConsoleSessionClosed = "ConsoleSessionClosed"
+	ReasonConvertedImage       = "ConvertedImage"
+	ReasonConvertingImage      = "ConvertingImage"
+	ReasonDetachedPCIDevice    = "DetachedPCIDevice"
+	ReasonDetachedMdevDevice   = "DetachedMdevDevice"
+	ReasonDetachedUSBDevice    = "DetachedUSBDevice"
+	ReasonFlattenedRootDisk    = "FlattenedRootDisk"
+	ReasonHotpluggedMemory     = "HotpluggedMemory"
+	ReasonHotpluggedVCPUs      = "HotpluggedVCPUs"
+	ReasonNotRestarted         = "NotRestarted"
+	ReasonPoweringOff          = "PoweringOff"
+	ReasonPulledImage          = "PulledImage"
+	ReasonPullingImage         = "PullingImage"
+	ReasonRebooted             = "Rebooted"
+	ReasonRebuilding           = "Rebuilding"
+	ReasonRepairedDisk         = "RepairedDisk"
+	ReasonResizedVolume        = "ResizedVolume"
+	ReasonRestarted            = "Restarted"
+	ReasonResumed              = "Resumed"
+	ReasonSizeChangedVolume    = "SizeChangedVolume"
+	ReasonSkippedVolumeResize  = "SkippedVolumeResize"
+	ReasonSuspended            = "Suspended"
+	ReasonTriggeringShutdown   = "TriggeringShutdown"
+
+	// Reasons of events of type corev1.EventTypeWarning.
+	ReasonAdoptedDomain           = "AdoptedDomain"
+	ReasonAttachDetachNIC         = "AttchDetachNIC"
+	ReasonAttachDetachPCIDevice   = "AttachDetachPCIDevice"
+	ReasonAttachDetachMdevDevice  = "AttachDetachMdevDevice"
+	ReasonAttachDetachUSBDevice   = "AttachDetachUSBDevice"
+	ReasonAttachDetachVolume      = "AttchDetachVolume"
+	ReasonCorruptDisk             = "CorruptDisk"
+	ReasonDestroyedDomain         = "DestroyedDomain"
+	ReasonDiskIOError             = "DiskIOError"
+	ReasonDomainHookFailed        = "DomainHookFailed"
+	ReasonDomainOwnerMismatch     = "DomainOwnerMismatch"
+	ReasonEscalatedPowerOff       = "EscalatedPowerOff"
+	ReasonFailedConvertImage      = "FailedConvertImage"
+	ReasonFailedPullImage         = "FailedPullImage"
+	ReasonFailedVerifyImage       = "FailedVerifyImage"
+	ReasonForceDeleting           = "ForceDeleting"
+	ReasonHotplugFailed           = "Hotplug"
+	ReasonMachineCrashed          = "MachineCrashed"
+	ReasonMachineStopped          = "MachineStopped"
+	ReasonNoIgnitionData          = "NoIgnitionData"
+	ReasonOrphanedDomain          = "OrphanedDomain"
+	ReasonPullImageUnauthorized   = "PullImageUnauthorized"
+	ReasonResizePending           = "ResizePending"
+	ReasonRestartLimitReached     = "RestartLimitReached"
+	ReasonRootDiskSizeTooSmall    = "RootDiskSizeTooSmall"
+	ReasonUnreachableCephMonitors = "UnreachableCephMonitors"
+	ReasonWatchdogFired           = "WatchdogFired"
+)
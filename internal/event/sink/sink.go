@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/go-logr/logr"
+	irievent "github.com/ironcore-dev/ironcore/iri/apis/event/v1alpha1"
+)
+
+const (
+	DefaultQueueSize = 100
+	DefaultTimeout   = 10 * time.Second
+)
+
+// Message is a machine event as sent to sinks.
+type Message struct {
+	Time      time.Time         `json:"time"`
+	MachineID string            `json:"machineID"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	Type      string            `json:"type"`
+	Reason    string            `json:"reason"`
+	Message   string            `json:"message"`
+}
+
+func messageFor(event *irievent.Event) Message {
+	spec := event.GetSpec()
+	return Message{
+		Time:      time.Unix(spec.GetEventTime(), 0).UTC(),
+		MachineID: spec.GetInvolvedObjectMeta().GetId(),
+		Labels:    spec.GetInvolvedObjectMeta().GetLabels(),
+		Type:      spec.GetType(),
+		Reason:    spec.GetReason(),
+		Message:   spec.GetMessage(),
+	}
+}
+
+// Sink is a destination machine events are forwarded to, e.g. to trigger site alerting.
+type Sink interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// ForwarderOptions configure which events are forwarded and how.
+type ForwarderOptions struct {
+	// Types are the event types forwarded. If empty, all are forwarded.
+	Types []string
+	// Reasons are the event reasons forwarded. If empty, all are forwarded.
+	Reasons []string
+	// QueueSize is the number of events queued for sending. Events beyond are dropped. Defaults to
+	// DefaultQueueSize.
+	QueueSize int
+	// Timeout is the timeout of sending an event to a sink. Defaults to DefaultTimeout.
+	Timeout time.Duration
+}
+
+func setForwarderOptionsDefaults(o *ForwarderOptions) {
+	if o.QueueSize == 0 {
+		o.QueueSize = DefaultQueueSize
+	}
+	if o.Timeout == 0 {
+		o.Timeout = DefaultTimeout
+	}
+}
+
+// Forwarder forwards machine events to sinks. Events are queued and sent in the background, so recording
+// events never waits for a sink. Events that fail to be sent are logged and dropped.
+type Forwarder struct {
+	log   logr.Logger
+	sinks []Sink
+	opts  ForwarderOptions
+	queue chan Message
+}
+
+func NewForwarder(log logr.Logger, sinks []Sink, opts ForwarderOptions) *Forwarder {
+	setForwarderOptionsDefaults(&opts)
+
+	return &Forwarder{
+		log:   log,
+		sinks: sinks,
+		opts:  opts,
+		queue: make(chan Message, opts.QueueSize),
+	}
+}
+
+// Forward queues event for sending if it matches the types and reasons to forward. It doesn't block, events
+// are dropped if the queue is full.
+func (f *Forwarder) Forward(event *irievent.Event) {
+	msg := messageFor(event)
+	if (len(f.opts.Types) > 0 && !slices.Contains(f.opts.Types, msg.Type)) ||
+		(len(f.opts.Reasons) > 0 && !slices.Contains(f.opts.Reasons, msg.Reason)) {
+		return
+	}
+
+	select {
+	case f.queue <- msg:
+	default:
+		f.log.Info("Dropping machine event, forwarding queue is full", "MachineID", msg.MachineID, "Reason", msg.Reason)
+	}
+}
+
+// Start sends the queued events until ctx is done. Sinks holding connections, i.e. implementing
+// io.Closer, are closed afterwards.
+func (f *Forwarder) Start(ctx context.Context) {
+	defer f.close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-f.queue:
+			if err := f.send(ctx, msg); err != nil {
+				f.log.Error(err, "Failed to forward machine event", "MachineID", msg.MachineID, "Reason", msg.Reason)
+			}
+		}
+	}
+}
+
+func (f *Forwarder) send(ctx context.Context, msg Message) error {
+	var errs []error
+	for _, sink := range f.sinks {
+		sendCtx, cancel := context.WithTimeout(ctx, f.opts.Timeout)
+		if err := sink.Send(sendCtx, msg); err != nil {
+			errs = append(errs, fmt.Errorf("%T: %w", sink, err))
+		}
+		cancel()
+	}
+	return errors.Join(errs...)
+}
+
+func (f *Forwarder) close() {
+	for _, sink := range f.sinks {
+		if closer, ok := sink.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				f.log.Error(err, "Failed to close event sink", "Sink", fmt.Sprintf("%T", sink))
+			}
+		}
+	}
+}
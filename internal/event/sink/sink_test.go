@@ -0,0 +1,186 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package sink_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	irievent "github.com/ironcore-dev/ironcore/iri/apis/event/v1alpha1"
+	irimeta "github.com/ironcore-dev/ironcore/iri/apis/meta/v1alpha1"
+	. "github.com/ironcore-dev/libvirt-provider/internal/event/sink"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+)
+
+type sinkFunc func(ctx context.Context, msg Message) error
+
+func (f sinkFunc) Send(ctx context.Context, msg Message) error {
+	return f(ctx, msg)
+}
+
+func newEvent(eventType, reason string) *irievent.Event {
+	return &irievent.Event{
+		Spec: &irievent.EventSpec{
+			InvolvedObjectMeta: &irimeta.ObjectMetadata{Id: "machine-1"},
+			Type:               eventType,
+			Reason:             reason,
+			Message:            "message",
+			EventTime:          time.Now().Unix(),
+		},
+	}
+}
+
+var _ = Describe("Forwarder", func() {
+	It("should forward the events of the configured types and reasons", func(ctx SpecContext) {
+		received := make(chan Message, 10)
+		forwarder := NewForwarder(logr.Discard(), []Sink{sinkFunc(func(_ context.Context, msg Message) error {
+			received <- msg
+			return nil
+		})}, ForwarderOptions{
+			Types:   []string{corev1.EventTypeWarning},
+			Reasons: []string{"MachineCrashed"},
+		})
+
+		forwarderCtx, cancel := context.WithCancel(ctx)
+		DeferCleanup(cancel)
+		go forwarder.Start(forwarderCtx)
+
+		forwarder.Forward(newEvent(corev1.EventTypeNormal, "MachineCrashed"))
+		forwarder.Forward(newEvent(corev1.EventTypeWarning, "OtherReason"))
+		forwarder.Forward(newEvent(corev1.EventTypeWarning, "MachineCrashed"))
+
+		var msg Message
+		Eventually(received).Should(Receive(&msg))
+		Expect(msg).To(And(
+			HaveField("MachineID", "machine-1"),
+			HaveField("Type", corev1.EventTypeWarning),
+			HaveField("Reason", "MachineCrashed"),
+			HaveField("Message", "message"),
+		))
+		Consistently(received).WithTimeout(100 * time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("should drop events if the queue is full", func(ctx SpecContext) {
+		received := make(chan Message, 10)
+		forwarder := NewForwarder(logr.Discard(), []Sink{sinkFunc(func(_ context.Context, msg Message) error {
+			received <- msg
+			return nil
+		})}, ForwarderOptions{QueueSize: 1})
+
+		forwarder.Forward(newEvent(corev1.EventTypeWarning, "First"))
+		forwarder.Forward(newEvent(corev1.EventTypeWarning, "Second"))
+
+		forwarderCtx, cancel := context.WithCancel(ctx)
+		DeferCleanup(cancel)
+		go forwarder.Start(forwarderCtx)
+
+		Eventually(received).Should(Receive(HaveField("Reason", "First")))
+		Consistently(received).WithTimeout(100 * time.Millisecond).ShouldNot(Receive())
+	})
+})
+
+var _ = Describe("Webhook", func() {
+	It("should post the event as JSON", func(ctx SpecContext) {
+		var msg Message
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.Method).To(Equal(http.MethodPost))
+			Expect(r.Header.Get("Content-Type")).To(Equal("application/json"))
+			Expect(json.NewDecoder(r.Body).Decode(&msg)).To(Succeed())
+		}))
+		DeferCleanup(server.Close)
+
+		Expect(NewWebhook(server.URL).Send(ctx, Message{MachineID: "machine-1", Reason: "MachineCrashed"})).To(Succeed())
+		Expect(msg).To(And(HaveField("MachineID", "machine-1"), HaveField("Reason", "MachineCrashed")))
+	})
+
+	It("should fail on error responses", func(ctx SpecContext) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		DeferCleanup(server.Close)
+
+		Expect(NewWebhook(server.URL).Send(ctx, Message{})).To(MatchError(ContainSubstring("502")))
+	})
+})
+
+var _ = Describe("NATS", func() {
+	// serveNATS accepts a single connection and answers it like a NATS server, sending the received
+	// operations to ops. If connectErr is set, the CONNECT is answered with it.
+	serveNATS := func(listener net.Listener, ops chan<- string, connectErr string) {
+		defer GinkgoRecover()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		_, _ = fmt.Fprint(conn, "INFO {\"server_id\":\"test\",\"max_payload\":1048576,\"headers\":true}\r\n")
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimSpace(line)
+			switch {
+			case strings.HasPrefix(line, "CONNECT "):
+				ops <- line
+				if connectErr != "" {
+					_, _ = fmt.Fprintf(conn, "-ERR '%s'\r\n", connectErr)
+					return
+				}
+			case line == "PING":
+				_, _ = fmt.Fprint(conn, "PONG\r\n")
+			case strings.HasPrefix(line, "PUB "):
+				payload, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				ops <- line
+				ops <- strings.TrimSpace(payload)
+			}
+		}
+	}
+
+	It("should publish the events to the subject over a single connection", func(ctx SpecContext) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(listener.Close)
+		ops := make(chan string, 10)
+		go serveNATS(listener, ops, "")
+
+		nats := NewNATS("nats://user:secret@"+listener.Addr().String(), "events")
+		DeferCleanup(nats.Close)
+		Expect(nats.Send(ctx, Message{MachineID: "machine-1"})).To(Succeed())
+		Expect(nats.Send(ctx, Message{MachineID: "machine-2"})).To(Succeed())
+
+		Expect(<-ops).To(And(HavePrefix("CONNECT "), ContainSubstring(`"user":"user"`), ContainSubstring(`"pass":"secret"`)))
+		Expect(<-ops).To(HavePrefix("PUB events "))
+		Expect(<-ops).To(ContainSubstring(`"machineID":"machine-1"`))
+		Expect(<-ops).To(HavePrefix("PUB events "))
+		Expect(<-ops).To(ContainSubstring(`"machineID":"machine-2"`))
+	})
+
+	It("should fail if the server rejects the connection", func(ctx SpecContext) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(listener.Close)
+		go serveNATS(listener, make(chan string, 10), "Authorization Violation")
+
+		nats := NewNATS("nats://"+listener.Addr().String(), "events")
+		DeferCleanup(nats.Close)
+		Expect(nats.Send(ctx, Message{})).To(MatchError(ContainSubstring("Authorization Violation")))
+	})
+})
@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// SyslogTag is the tag events are written to syslog with.
+const SyslogTag = "libvirt-provider"
+
+// Syslog writes events as JSON to syslog, warnings with severity warning and all others with severity
+// info. The connection is established lazily and re-established after errors.
+type Syslog struct {
+	// Network and Addr are the syslog server to write to. If empty, the local syslog server is used.
+	Network, Addr string
+
+	mu     sync.Mutex
+	writer *syslog.Writer
+}
+
+func NewSyslog(network, addr string) *Syslog {
+	return &Syslog{Network: network, Addr: addr}
+}
+
+func (s *Syslog) Send(_ context.Context, msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("error marshalling event: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.writer == nil {
+		writer, err := syslog.Dial(s.Network, s.Addr, syslog.LOG_DAEMON|syslog.LOG_INFO, SyslogTag)
+		if err != nil {
+			return fmt.Errorf("error connecting to syslog: %w", err)
+		}
+		s.writer = writer
+	}
+
+	if msg.Type == corev1.EventTypeWarning {
+		err = s.writer.Warning(string(data))
+	} else {
+		err = s.writer.Info(string(data))
+	}
+	if err != nil {
+		_ = s.writer.Close()
+		s.writer = nil
+		return fmt.Errorf("error writing to syslog: %w", err)
+	}
+	return nil
+}
@@ -4,23 +4,116 @@
 package healthcheck
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"os"
+	"time"
 
-	"github.com/digitalocean/go-libvirt"
 	"github.com/go-logr/logr"
 	libvirtutils "github.com/ironcore-dev/libvirt-provider/internal/libvirt/utils"
 )
 
+// DefaultCheckTimeout is the default time a readiness check may take.
+const DefaultCheckTimeout = 5 * time.Second
+
+// Check is a readiness check of a dependency of the provider.
+type Check struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// CheckResult is the result of a Check as reported by the readiness endpoint.
+type CheckResult struct {
+	Name  string `json:"name"`
+	Ready bool   `json:"ready"`
+	Error string `json:"error,omitempty"`
+}
+
+// ReadinessResult is the body of the readiness endpoint.
+type ReadinessResult struct {
+	Ready  bool          `json:"ready"`
+	Checks []CheckResult `json:"checks"`
+}
+
 type HealthCheck struct {
-	Libvirt *libvirt.Libvirt
-	Log     logr.Logger
+	Log logr.Logger
+	// ReadinessChecks are the checks that have to succeed for the provider to be ready.
+	ReadinessChecks []Check
+	// CheckTimeout is the time every readiness check may take. Defaults to DefaultCheckTimeout.
+	CheckTimeout time.Duration
 }
 
+// HealthCheckHandler reports the provider as alive as long as it serves requests. Unavailable dependencies like
+// libvirt are recovered from without restart, so they only affect the readiness.
 func (h HealthCheck) HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
-	if err := libvirtutils.IsConnected(h.Libvirt); err == nil {
+	w.WriteHeader(http.StatusOK)
+}
+
+// ReadinessHandler runs the readiness checks and reports their results as ReadinessResult. The status is
+// OK if all checks succeed and ServiceUnavailable otherwise.
+func (h HealthCheck) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	result := h.checkReadiness(r.Context())
+
+	w.Header().Set("Content-Type", "application/json")
+	if result.Ready {
 		w.WriteHeader(http.StatusOK)
 	} else {
-		h.Log.Error(err, "failed to get active connection to libvirtd")
 		w.WriteHeader(http.StatusServiceUnavailable)
 	}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		h.Log.Error(err, "failed to write readiness result")
+	}
+}
+
+func (h HealthCheck) checkReadiness(ctx context.Context) ReadinessResult {
+	timeout := h.CheckTimeout
+	if timeout == 0 {
+		timeout = DefaultCheckTimeout
+	}
+
+	result := ReadinessResult{Ready: true, Checks: []CheckResult{}}
+	for _, check := range h.ReadinessChecks {
+		checkCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := check.Check(checkCtx)
+		cancel()
+
+		checkResult := CheckResult{Name: check.Name, Ready: err == nil}
+		if err != nil {
+			h.Log.Error(err, "Readiness check failed", "Check", check.Name)
+			checkResult.Error = err.Error()
+			result.Ready = false
+		}
+		result.Checks = append(result.Checks, checkResult)
+	}
+	return result
+}
+
+// LibvirtCheck checks that libvirt is connected.
+func LibvirtCheck(client libvirtutils.Client) Check {
+	return Check{
+		Name: "libvirt",
+		Check: func(context.Context) error {
+			return libvirtutils.IsConnected(client)
+		},
+	}
+}
+
+// WritableDirCheck checks that files can be written to dir.
+func WritableDirCheck(name, dir string) Check {
+	return Check{
+		Name: name,
+		Check: func(context.Context) error {
+			file, err := os.CreateTemp(dir, ".readiness-")
+			if err != nil {
+				return fmt.Errorf("error writing to %s: %w", dir, err)
+			}
+			_ = file.Close()
+			if err := os.Remove(file.Name()); err != nil {
+				return fmt.Errorf("error removing readiness probe file: %w", err)
+			}
+			return nil
+		},
+	}
 }
@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package healthcheck_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/internal/healthcheck"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HealthCheck", func() {
+	readiness := func(h healthcheck.HealthCheck) (int, healthcheck.ReadinessResult) {
+		rec := httptest.NewRecorder()
+		h.ReadinessHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+		var result healthcheck.ReadinessResult
+		Expect(json.Unmarshal(rec.Body.Bytes(), &result)).To(Succeed())
+		return rec.Code, result
+	}
+
+	It("should be ready if all checks succeed", func() {
+		code, result := readiness(healthcheck.HealthCheck{
+			Log: logr.Discard(),
+			ReadinessChecks: []healthcheck.Check{
+				healthcheck.WritableDirCheck("dir", GinkgoT().TempDir()),
+			},
+		})
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(result).To(Equal(healthcheck.ReadinessResult{
+			Ready:  true,
+			Checks: []healthcheck.CheckResult{{Name: "dir", Ready: true}},
+		}))
+	})
+
+	It("should report the failed checks", func() {
+		code, result := readiness(healthcheck.HealthCheck{
+			Log: logr.Discard(),
+			ReadinessChecks: []healthcheck.Check{
+				{Name: "ok", Check: func(context.Context) error { return nil }},
+				{Name: "failing", Check: func(context.Context) error { return errors.New("unavailable") }},
+			},
+		})
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(result).To(Equal(healthcheck.ReadinessResult{
+			Checks: []healthcheck.CheckResult{
+				{Name: "ok", Ready: true},
+				{Name: "failing", Error: "unavailable"},
+			},
+		}))
+	})
+
+	It("should be alive regardless of the readiness", func() {
+		rec := httptest.NewRecorder()
+		healthcheck.HealthCheck{
+			ReadinessChecks: []healthcheck.Check{
+				{Name: "failing", Check: func(context.Context) error { return errors.New("unavailable") }},
+			},
+		}.HealthCheckHandler(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		Expect(rec.Code).To(Equal(http.StatusOK))
+	})
+})
@@ -0,0 +1,127 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package host
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ironcore-dev/libvirt-provider/internal/store"
+)
+
+// Backend persists the serialized objects of a Store.
+// Implementations have to return an error wrapping store.ErrNotFound if an object does not exist.
+// Selections are not pushed down to backends: Store.List decodes all objects returned by ReadAll, only
+// Store.ListWithOptions reads the objects selected by its index of labels and fields.
+type Backend interface {
+	Read(id string) ([]byte, error)
+	Write(id string, data []byte) error
+	Delete(id string) error
+	ReadAll() ([][]byte, error)
+}
+
+const tmpFilePrefix = "."
+
+// NewFileBackend creates a Backend storing every object as a separate file in dir.
+func NewFileBackend(dir string) (Backend, error) {
+	if err := os.MkdirAll(dir, perm); err != nil {
+		return nil, fmt.Errorf("error creating store directory: %w", err)
+	}
+
+	return &fileBackend{dir: dir}, nil
+}
+
+type fileBackend struct {
+	dir string
+}
+
+func (b *fileBackend) Read(id string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(b.dir, id))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+
+		return nil, fmt.Errorf("object with id %q %w", id, store.ErrNotFound)
+	}
+
+	return data, nil
+}
+
+func (b *fileBackend) Write(id string, data []byte) error {
+	// Write to a temporary file first so that concurrent readers never observe a partially written object.
+	tmpFile, err := os.CreateTemp(b.dir, tmpFilePrefix+id+"-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(tmpFile.Name())
+	}()
+
+	if _, err := tmpFile.Write(data); err != nil {
+		_ = tmpFile.Close()
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+
+	if err := os.Chmod(tmpFile.Name(), 0666); err != nil {
+		return fmt.Errorf("failed to change mode of temporary file: %w", err)
+	}
+
+	if err := os.Rename(tmpFile.Name(), filepath.Join(b.dir, id)); err != nil {
+		return fmt.Errorf("failed to rename temporary file: %w", err)
+	}
+
+	return nil
+}
+
+func (b *fileBackend) Delete(id string) error {
+	if err := os.Remove(filepath.Join(b.dir, id)); err != nil {
+		return fmt.Errorf("failed to delete object from store: %w", err)
+	}
+
+	return nil
+}
+
+func (b *fileBackend) ReadAll() ([][]byte, error) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	var res [][]byte
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), tmpFilePrefix) {
+			continue
+		}
+
+		data, err := b.Read(entry.Name())
+		if err != nil {
+			if store.IgnoreErrNotFound(err) == nil {
+				// object got deleted in between listing and reading it
+				continue
+			}
+			return nil, err
+		}
+
+		res = append(res, data)
+	}
+
+	return res, nil
+}
+
+const (
+	BackendTypeFile   = "file"
+	BackendTypeSQLite = "sqlite"
+)
+
+// BackendTypes returns the available store backend types.
+func BackendTypes() []string {
+	return []string{BackendTypeFile, BackendTypeSQLite}
+}
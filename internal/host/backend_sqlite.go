@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package host
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/ironcore-dev/libvirt-provider/internal/store"
+	// The pure Go SQLite driver keeps the provider free of a cgo dependency on libsqlite3.
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteDriverName is the database/sql driver name the SQLite backend is opened with.
+const SQLiteDriverName = "sqlite"
+
+const sqliteTable = "objects"
+
+// OpenSQLiteBackend opens (and if necessary creates) the SQLite database at file and returns a Backend using it.
+func OpenSQLiteBackend(file string) (Backend, func() error, error) {
+	db, err := sql.Open(SQLiteDriverName, file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open sqlite database %s: %w", file, err)
+	}
+
+	backend, err := NewSQLiteBackend(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, nil, err
+	}
+
+	return backend, db.Close, nil
+}
+
+// NewSQLiteBackend creates a Backend storing all objects as rows of a single table in db.
+func NewSQLiteBackend(db *sql.DB) (Backend, error) {
+	// SQLite only supports a single writer, serializing on the connection avoids SQLITE_BUSY errors.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS ` + sqliteTable + ` (id TEXT PRIMARY KEY, data BLOB NOT NULL)`); err != nil {
+		return nil, fmt.Errorf("failed to create table: %w", err)
+	}
+
+	return &sqliteBackend{db: db}, nil
+}
+
+type sqliteBackend struct {
+	db *sql.DB
+}
+
+func (b *sqliteBackend) Read(id string) ([]byte, error) {
+	var data []byte
+	if err := b.db.QueryRow(`SELECT data FROM `+sqliteTable+` WHERE id = ?`, id).Scan(&data); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("object with id %q %w", id, store.ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+
+	return data, nil
+}
+
+func (b *sqliteBackend) Write(id string, data []byte) error {
+	if _, err := b.db.Exec(
+		`INSERT INTO `+sqliteTable+` (id, data) VALUES (?, ?) ON CONFLICT(id) DO UPDATE SET data = excluded.data`,
+		id, data,
+	); err != nil {
+		return fmt.Errorf("failed to write object: %w", err)
+	}
+
+	return nil
+}
+
+func (b *sqliteBackend) Delete(id string) error {
+	res, err := b.db.Exec(`DELETE FROM `+sqliteTable+` WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete object from store: %w", err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("failed to delete object from store: object with id %q %w", id, store.ErrNotFound)
+	}
+
+	return nil
+}
+
+func (b *sqliteBackend) ReadAll() ([][]byte, error) {
+	rows, err := b.db.Query(`SELECT data FROM ` + sqliteTable)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	var res [][]byte
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to scan object: %w", err)
+		}
+		res = append(res, data)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,438 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package host
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/store"
+	utilssync "github.com/ironcore-dev/libvirt-provider/internal/sync"
+	"github.com/ironcore-dev/libvirt-provider/internal/utils"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	cacheResultHit  = "hit"
+	cacheResultMiss = "miss"
+)
+
+var cacheRequests = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "libvirt_provider_store_cache_requests_total",
+		Help: "Number of get and list requests served by the store cache, partitioned by result (hit or miss).",
+	},
+	[]string{"store", "result"},
+)
+
+func init() {
+	prometheus.MustRegister(cacheRequests)
+}
+
+type CachedStoreOptions[E api.Object] struct {
+	// Name identifies the store in the cache metrics.
+	Name string
+	// DeepCopyFunc copies objects going in and out of the cache, so callers can't modify cached objects.
+	DeepCopyFunc func(E) E
+	// AttrsStrategy has to match the one of the underlying store. Defaults to DefaultAttrs.
+	AttrsStrategy AttrsStrategy[E]
+	// TombstoneTTL is how long late watch events of removed objects are dropped. Defaults to DefaultTombstoneTTL.
+	TombstoneTTL time.Duration
+}
+
+// DefaultTombstoneTTL is the default time late watch events of removed objects are dropped.
+const DefaultTombstoneTTL = 5 * time.Minute
+
+type cacheEntry[E api.Object] struct {
+	obj   E
+	attrs *indexEntry
+	// write is the number of the write that stored the entry.
+	write uint64
+}
+
+// CachedStore is a read-through cache of decoded objects in front of a store.Store.
+// It is kept consistent by its own writes and the watch events of the underlying store,
+// hence all writes have to go through the CachedStore.
+// Until Start has populated the cache, List calls are passed through to the underlying store.
+// Hits and misses are counted in the libvirt_provider_store_cache_requests_total metric.
+type CachedStore[E api.Object] struct {
+	store store.Store[E]
+
+	name          string
+	deepCopyFunc  func(E) E
+	attrsStrategy AttrsStrategy[E]
+
+	idMu *utilssync.MutexMap[string]
+
+	mu      sync.RWMutex
+	started bool
+	synced  bool
+	// invalidations counts the objects dropped from the cache to detect races with populating it.
+	invalidations uint64
+	// writes counts the objects stored in the cache, so populating it keeps objects stored after the list started.
+	writes uint64
+	cache  map[string]*cacheEntry[E]
+	// removed holds the expirations of the tombstones of objects removed from the underlying store by their id,
+	// so that late watch events don't resurrect them.
+	removed      map[string]time.Time
+	tombstoneTTL time.Duration
+}
+
+func NewCachedStore[E api.Object](s store.Store[E], opts CachedStoreOptions[E]) (*CachedStore[E], error) {
+	if s == nil {
+		return nil, fmt.Errorf("must specify store")
+	}
+
+	if opts.DeepCopyFunc == nil {
+		return nil, fmt.Errorf("must specify opts.DeepCopyFunc")
+	}
+
+	if opts.TombstoneTTL == 0 {
+		opts.TombstoneTTL = DefaultTombstoneTTL
+	}
+	if opts.TombstoneTTL < 0 {
+		return nil, fmt.Errorf("tombstone ttl must not be negative")
+	}
+
+	return &CachedStore[E]{
+		store:         s,
+		name:          opts.Name,
+		deepCopyFunc:  opts.DeepCopyFunc,
+		attrsStrategy: opts.AttrsStrategy,
+		idMu:          utilssync.NewMutexMap[string](),
+		cache:         make(map[string]*cacheEntry[E]),
+		removed:       make(map[string]time.Time),
+		tombstoneTTL:  opts.TombstoneTTL,
+	}, nil
+}
+
+// Start populates the cache and keeps it up to date with the watch events of the underlying store until ctx is done.
+func (c *CachedStore[E]) Start(ctx context.Context) error {
+	log := logr.FromContextOrDiscard(ctx)
+
+	watch, err := c.store.Watch(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start watch: %w", err)
+	}
+
+	c.mu.Lock()
+	c.started = true
+	invalidations, writes := c.invalidations, c.writes
+	c.mu.Unlock()
+
+	objs, err := c.store.List(ctx)
+	if err != nil {
+		watch.Stop()
+		return fmt.Errorf("failed to list objects: %w", err)
+	}
+	c.populate(log, objs, invalidations, writes)
+
+	go func() {
+		defer watch.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case evt := <-watch.Events():
+				if evt.Type == store.WatchEventTypeResync {
+					c.resync(ctx, log)
+					continue
+				}
+
+				c.idMu.Lock(evt.Object.GetID())
+				c.observe(log, evt.Object)
+				c.idMu.Unlock(evt.Object.GetID())
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (c *CachedStore[E]) Create(ctx context.Context, obj E) (E, error) {
+	c.idMu.Lock(obj.GetID())
+	defer c.idMu.Unlock(obj.GetID())
+
+	obj, err := c.store.Create(ctx, obj)
+	if err != nil {
+		return utils.Zero[E](), err
+	}
+
+	c.mu.Lock()
+	delete(c.removed, obj.GetID())
+	c.mu.Unlock()
+
+	c.set(obj)
+	return obj, nil
+}
+
+func (c *CachedStore[E]) Get(ctx context.Context, id string) (E, error) {
+	if obj, ok := c.get(id); ok {
+		cacheRequests.WithLabelValues(c.name, cacheResultHit).Inc()
+		return obj, nil
+	}
+	cacheRequests.WithLabelValues(c.name, cacheResultMiss).Inc()
+
+	c.idMu.Lock(id)
+	defer c.idMu.Unlock(id)
+
+	obj, err := c.store.Get(ctx, id)
+	if err != nil {
+		return utils.Zero[E](), err
+	}
+
+	c.set(obj)
+	return obj, nil
+}
+
+func (c *CachedStore[E]) Update(ctx context.Context, obj E) (E, error) {
+	c.idMu.Lock(obj.GetID())
+	defer c.idMu.Unlock(obj.GetID())
+
+	obj, err := c.store.Update(ctx, obj)
+	if err != nil {
+		return utils.Zero[E](), err
+	}
+
+	if obj.GetDeletedAt() != nil && len(obj.GetFinalizers()) == 0 {
+		// the underlying store removed the object without emitting an event
+		c.remove(obj.GetID())
+		return obj, nil
+	}
+
+	c.set(obj)
+	return obj, nil
+}
+
+func (c *CachedStore[E]) Delete(ctx context.Context, id string) error {
+	c.idMu.Lock(id)
+	defer c.idMu.Unlock(id)
+
+	if err := c.store.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	// Depending on its finalizers the object was either removed or marked as deleted.
+	obj, err := c.store.Get(ctx, id)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			c.invalidate(id)
+			return nil
+		}
+		c.remove(id)
+		return nil
+	}
+
+	c.set(obj)
+	return nil
+}
+
+func (c *CachedStore[E]) List(ctx context.Context) ([]E, error) {
+	objs, ok := c.list(store.ListOptions{})
+	if ok {
+		cacheRequests.WithLabelValues(c.name, cacheResultHit).Inc()
+		return objs, nil
+	}
+	cacheRequests.WithLabelValues(c.name, cacheResultMiss).Inc()
+
+	c.mu.RLock()
+	started, invalidations, writes := c.started, c.invalidations, c.writes
+	c.mu.RUnlock()
+
+	objs, err := c.store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if started {
+		c.populate(logr.FromContextOrDiscard(ctx), objs, invalidations, writes)
+	}
+	return objs, nil
+}
+
+func (c *CachedStore[E]) ListWithOptions(ctx context.Context, opts store.ListOptions) ([]E, string, error) {
+	objs, ok := c.list(opts)
+	if !ok {
+		cacheRequests.WithLabelValues(c.name, cacheResultMiss).Inc()
+		return c.store.ListWithOptions(ctx, opts)
+	}
+	cacheRequests.WithLabelValues(c.name, cacheResultHit).Inc()
+
+	if opts.Limit > 0 && int64(len(objs)) > opts.Limit {
+		objs = objs[:opts.Limit]
+		return objs, objs[len(objs)-1].GetID(), nil
+	}
+	return objs, "", nil
+}
+
+func (c *CachedStore[E]) Watch(ctx context.Context) (store.Watch[E], error) {
+	return c.store.Watch(ctx)
+}
+
+func (c *CachedStore[E]) get(id string) (E, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.cache[id]
+	if !ok {
+		return utils.Zero[E](), false
+	}
+	return c.deepCopyFunc(entry.obj), true
+}
+
+// HasSynced returns whether the cache has been populated.
+func (c *CachedStore[E]) HasSynced() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.synced
+}
+
+// list returns copies of all cached objects matching opts ordered by their id.
+// It returns false if the cache has not been populated yet.
+func (c *CachedStore[E]) list(opts store.ListOptions) ([]E, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if !c.synced {
+		return nil, false
+	}
+
+	var ids []string
+	for id, entry := range c.cache {
+		if entry.attrs.matches(id, opts) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+
+	objs := make([]E, 0, len(ids))
+	for _, id := range ids {
+		objs = append(objs, c.deepCopyFunc(c.cache[id].obj))
+	}
+	return objs, true
+}
+
+// resync catches up with events dropped by the underlying store.
+func (c *CachedStore[E]) resync(ctx context.Context, log logr.Logger) {
+	c.mu.RLock()
+	invalidations, writes := c.invalidations, c.writes
+	c.mu.RUnlock()
+
+	objs, err := c.store.List(ctx)
+	if err != nil {
+		log.Error(err, "failed to list objects, dropping cache")
+		c.mu.Lock()
+		c.cache = make(map[string]*cacheEntry[E])
+		c.invalidations++
+		c.synced = false
+		c.mu.Unlock()
+		return
+	}
+	c.populate(log, objs, invalidations, writes)
+}
+
+// populate observes the listed objects, drops the cached objects missing from the list, as their watch events
+// may have been dropped, and marks the cache as synced unless objects have been invalidated since the list was
+// started. Objects stored after the list was started, i.e. after writes writes, are kept.
+func (c *CachedStore[E]) populate(log logr.Logger, objs []E, invalidations, writes uint64) {
+	listed := make(map[string]struct{}, len(objs))
+	for _, obj := range objs {
+		listed[obj.GetID()] = struct{}{}
+
+		c.idMu.Lock(obj.GetID())
+		c.observe(log, obj)
+		c.idMu.Unlock(obj.GetID())
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id, entry := range c.cache {
+		if _, ok := listed[id]; !ok && entry.write <= writes {
+			delete(c.cache, id)
+		}
+	}
+
+	if c.invalidations == invalidations {
+		c.synced = true
+	}
+}
+
+// observe stores obj unless the cache already holds a newer version or the object has been removed.
+// It has to be called with the id of obj locked.
+func (c *CachedStore[E]) observe(log logr.Logger, obj E) {
+	c.mu.RLock()
+	entry, ok := c.cache[obj.GetID()]
+	expiration, removed := c.removed[obj.GetID()]
+	c.mu.RUnlock()
+	removed = removed && time.Now().Before(expiration)
+
+	if removed || (ok && entry.obj.GetResourceVersion() >= obj.GetResourceVersion()) {
+		return
+	}
+
+	if err := c.trySet(obj); err != nil {
+		log.Error(err, "failed to cache object", "ID", obj.GetID())
+	}
+}
+
+// set stores a copy of obj. If its attributes can't be determined, the object is dropped from the cache
+// so it is read through on the next access.
+// It has to be called with the id of obj locked.
+func (c *CachedStore[E]) set(obj E) {
+	if err := c.trySet(obj); err != nil {
+		c.invalidate(obj.GetID())
+	}
+}
+
+func (c *CachedStore[E]) trySet(obj E) error {
+	attrs, err := getAttrs(c.attrsStrategy, obj)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.writes++
+	c.cache[obj.GetID()] = &cacheEntry[E]{
+		obj:   c.deepCopyFunc(obj),
+		attrs: attrs,
+		write: c.writes,
+	}
+	return nil
+}
+
+// invalidate drops the object with the given id from the cache. Lists are passed through
+// to the underlying store until the next one of them populates the cache again.
+func (c *CachedStore[E]) invalidate(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.cache, id)
+	c.invalidations++
+	c.synced = false
+}
+
+func (c *CachedStore[E]) remove(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for removedID, expiration := range c.removed {
+		if !now.Before(expiration) {
+			delete(c.removed, removedID)
+		}
+	}
+
+	delete(c.cache, id)
+	c.removed[id] = now.Add(c.tombstoneTTL)
+}
@@ -0,0 +1,162 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package host_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/host"
+	"github.com/ironcore-dev/libvirt-provider/internal/store"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+var _ = Describe("CachedStore", func() {
+	var (
+		fileStore   *host.Store[*api.Machine]
+		cachedStore *host.CachedStore[*api.Machine]
+	)
+
+	BeforeEach(func(ctx SpecContext) {
+		var err error
+		fileStore, err = host.NewStore[*api.Machine](host.Options[*api.Machine]{
+			Dir:     GinkgoT().TempDir(),
+			NewFunc: func() *api.Machine { return &api.Machine{} },
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		By("creating a machine before the cache is started")
+		_, err = fileStore.Create(ctx, &api.Machine{Metadata: api.Metadata{ID: "machine-a"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		cachedStore, err = host.NewCachedStore[*api.Machine](fileStore, host.CachedStoreOptions[*api.Machine]{
+			Name:         "test",
+			DeepCopyFunc: (*api.Machine).DeepCopy,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		cacheCtx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		Expect(cachedStore.Start(cacheCtx)).To(Succeed())
+	})
+
+	It("should serve objects from the cache", func(ctx SpecContext) {
+		By("getting the machine created before start")
+		machine, err := cachedStore.Get(ctx, "machine-a")
+		Expect(err).NotTo(HaveOccurred())
+
+		By("modifying the returned machine without updating it")
+		machine.Labels = map[string]string{"foo": "bar"}
+		machine, err = cachedStore.Get(ctx, "machine-a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(machine.Labels).To(BeEmpty())
+
+		By("updating the machine")
+		machine.Labels = map[string]string{"foo": "bar"}
+		_, err = cachedStore.Update(ctx, machine)
+		Expect(err).NotTo(HaveOccurred())
+
+		By("listing machines by label")
+		machines, _, err := cachedStore.ListWithOptions(ctx, store.ListOptions{
+			LabelSelector: labels.SelectorFromSet(labels.Set{"foo": "bar"}),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(machines).To(ConsistOf(HaveField("ID", "machine-a")))
+	})
+
+	It("should pick up changes via watch events", func(ctx SpecContext) {
+		By("updating the machine in the underlying store")
+		machine, err := fileStore.Get(ctx, "machine-a")
+		Expect(err).NotTo(HaveOccurred())
+		machine.Spec.Power = api.PowerStatePowerOff
+		_, err = fileStore.Update(ctx, machine)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func() (*api.Machine, error) {
+			return cachedStore.Get(ctx, "machine-a")
+		}).Should(HaveField("Spec.Power", api.PowerStatePowerOff))
+	})
+
+	It("should remove deleted objects", func(ctx SpecContext) {
+		By("creating and deleting a machine")
+		_, err := cachedStore.Create(ctx, &api.Machine{Metadata: api.Metadata{ID: "machine-b"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cachedStore.Delete(ctx, "machine-b")).To(Succeed())
+
+		_, err = cachedStore.Get(ctx, "machine-b")
+		Expect(err).To(MatchError(store.ErrNotFound))
+		Expect(cachedStore.List(ctx)).To(ConsistOf(HaveField("ID", "machine-a")))
+	})
+
+	It("should forget removed objects after the tombstone ttl", func(ctx SpecContext) {
+		cachedStore, err := host.NewCachedStore[*api.Machine](fileStore, host.CachedStoreOptions[*api.Machine]{
+			Name:         "test",
+			DeepCopyFunc: (*api.Machine).DeepCopy,
+			TombstoneTTL: 100 * time.Millisecond,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		cacheCtx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		Expect(cachedStore.Start(cacheCtx)).To(Succeed())
+
+		By("creating and deleting a machine")
+		_, err = cachedStore.Create(ctx, &api.Machine{Metadata: api.Metadata{ID: "machine-b"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cachedStore.Delete(ctx, "machine-b")).To(Succeed())
+
+		By("recreating the machine in the underlying store after the tombstone expired")
+		time.Sleep(100 * time.Millisecond)
+		_, err = fileStore.Create(ctx, &api.Machine{Metadata: api.Metadata{ID: "machine-b"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func() ([]*api.Machine, error) {
+			return cachedStore.List(ctx)
+		}).Should(ContainElement(HaveField("ID", "machine-b")))
+	})
+
+	It("should drop objects removed while watch events were dropped on resync", func(ctx SpecContext) {
+		overflowingStore := &overflowingStore{Store: fileStore, events: make(chan store.WatchEvent[*api.Machine], 1)}
+		cachedStore, err := host.NewCachedStore[*api.Machine](overflowingStore, host.CachedStoreOptions[*api.Machine]{
+			Name:         "test",
+			DeepCopyFunc: (*api.Machine).DeepCopy,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		cacheCtx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		Expect(cachedStore.Start(cacheCtx)).To(Succeed())
+		Expect(cachedStore.Get(ctx, "machine-a")).To(HaveField("ID", "machine-a"))
+
+		By("deleting the machine while the watch drops its events")
+		Expect(fileStore.Delete(ctx, "machine-a")).To(Succeed())
+		Expect(cachedStore.Get(ctx, "machine-a")).To(HaveField("ID", "machine-a"))
+
+		By("signaling the overflow of the watch")
+		overflowingStore.events <- store.WatchEvent[*api.Machine]{Type: store.WatchEventTypeResync}
+
+		Eventually(func() error {
+			_, err := cachedStore.Get(ctx, "machine-a")
+			return err
+		}).Should(MatchError(store.ErrNotFound))
+		Expect(cachedStore.List(ctx)).To(BeEmpty())
+	})
+})
+
+// overflowingStore is a store whose watch drops all events, only the resync events sent to events are delivered.
+type overflowingStore struct {
+	*host.Store[*api.Machine]
+	events chan store.WatchEvent[*api.Machine]
+}
+
+func (s *overflowingStore) Watch(context.Context) (store.Watch[*api.Machine], error) {
+	return s, nil
+}
+
+func (s *overflowingStore) Events() <-chan store.WatchEvent[*api.Machine] {
+	return s.events
+}
+
+func (s *overflowingStore) Stop() {}
@@ -0,0 +1,12 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package host
+
+// DropIndex drops the index of the store, so the next list by selectors rebuilds it.
+func (s *Store[E]) DropIndex() {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	s.index = nil
+}
@@ -8,24 +8,44 @@ import (
 	"os"
 	"path/filepath"
 
-	"github.com/digitalocean/go-libvirt"
 	ocistore "github.com/ironcore-dev/ironcore-image/oci/store"
+	libvirtutils "github.com/ironcore-dev/libvirt-provider/internal/libvirt/utils"
 )
 
 const (
 	DefaultImagesDir  = "images"
 	DefaultPluginsDir = "plugins"
+	// DefaultRootFSBasesDir holds the qcow2 bases root fs overlays of machines are backed by.
+	DefaultRootFSBasesDir = "rootfs-bases"
+	// DefaultOperationsDir holds the resume markers of in-flight operations.
+	DefaultOperationsDir = "operations"
+	// DefaultIdempotencyKeysDir holds the idempotency keys of recently created machines.
+	DefaultIdempotencyKeysDir = "idempotency-keys"
+	// DefaultMachineEventsDir holds the persisted machine events.
+	DefaultMachineEventsDir = "machine-events"
+	// DefaultProfilesDir holds the perf profiles recorded of machines.
+	DefaultProfilesDir = "profiles"
+	// DefaultRunMarkerFile is present while the provider is running.
+	DefaultRunMarkerFile = "running"
+	// DefaultMaintenanceFile holds the maintenance state while the host is in maintenance mode.
+	DefaultMaintenanceFile = "maintenance"
 
 	DefaultMachinesDir                 = "machines"
 	DefaultStoreDir                    = "store"
 	DefaultMachineStoreDir             = "machines"
+	DefaultMachineStoreDBFile          = "machines.db"
 	DefaultMachineVolumesDir           = "volumes"
 	DefaultMachineIgnitionsDir         = "ignitions"
 	DefaultMachineIgnitionFile         = "data.ign"
 	DefaultMachineRootFSDir            = "rootfs"
 	DefaultMachineRootFSFile           = "rootfs"
 	DefaultMachinePluginsDir           = "plugins"
+	DefaultMachineAttestationDir       = "attestation"
 	DefaultMachineNetworkInterfacesDir = "networkinterfaces"
+	// DefaultMachineIPXEDir holds the iPXE binary and script a machine boots from the network with.
+	DefaultMachineIPXEDir = "ipxe"
+	// DefaultMachineConsoleLogFile holds the serial console output of a machine, rotated by virtlogd.
+	DefaultMachineConsoleLogFile = "console.log"
 )
 
 type Paths interface {
@@ -34,8 +54,16 @@ type Paths interface {
 
 	MachinesDir() string
 	MachineStoreDir() string
+	MachineStoreDBFile() string
 	ImagesDir() string
+	RootFSBasesDir() string
 	PluginsDir() string
+	OperationsDir() string
+	IdempotencyKeysDir() string
+	MachineEventsDir() string
+	ProfilesDir() string
+	RunMarkerFile() string
+	MaintenanceFile() string
 
 	PluginDir(pluginName string) string
 	MachinePluginsDir(machineUID string) string
@@ -44,6 +72,7 @@ type Paths interface {
 	MachineDir(machineUID string) string
 	MachineRootFSDir(machineUID string) string
 	MachineRootFSFile(machineUID string) string
+	MachineAttestationDir(machineUID string) string
 	MachineVolumesDir(machineUID string) string
 
 	MachineVolumesPluginDir(machineUID string, pluginName string) string
@@ -54,6 +83,10 @@ type Paths interface {
 
 	MachineIgnitionsDir(machineUID string) string
 	MachineIgnitionFile(machineUID string) string
+
+	MachineIPXEDir(machineUID string) string
+
+	MachineConsoleLogFile(machineUID string) string
 }
 
 type paths struct {
@@ -76,14 +109,46 @@ func (p *paths) MachineStoreDir() string {
 	return filepath.Join(p.StoreDir(), DefaultMachineStoreDir)
 }
 
+func (p *paths) MachineStoreDBFile() string {
+	return filepath.Join(p.StoreDir(), DefaultMachineStoreDBFile)
+}
+
 func (p *paths) ImagesDir() string {
 	return filepath.Join(p.rootDir, DefaultImagesDir)
 }
 
+func (p *paths) RootFSBasesDir() string {
+	return filepath.Join(p.rootDir, DefaultRootFSBasesDir)
+}
+
 func (p *paths) PluginsDir() string {
 	return filepath.Join(p.rootDir, DefaultPluginsDir)
 }
 
+func (p *paths) OperationsDir() string {
+	return filepath.Join(p.rootDir, DefaultOperationsDir)
+}
+
+func (p *paths) IdempotencyKeysDir() string {
+	return filepath.Join(p.rootDir, DefaultIdempotencyKeysDir)
+}
+
+func (p *paths) MachineEventsDir() string {
+	return filepath.Join(p.rootDir, DefaultMachineEventsDir)
+}
+
+func (p *paths) ProfilesDir() string {
+	return filepath.Join(p.rootDir, DefaultProfilesDir)
+}
+
+func (p *paths) RunMarkerFile() string {
+	return filepath.Join(p.rootDir, DefaultRunMarkerFile)
+}
+
+func (p *paths) MaintenanceFile() string {
+	return filepath.Join(p.rootDir, DefaultMaintenanceFile)
+}
+
 func (p *paths) PluginDir(pluginName string) string {
 	return filepath.Join(p.PluginsDir(), pluginName)
 }
@@ -100,6 +165,10 @@ func (p *paths) MachineRootFSFile(machineUID string) string {
 	return filepath.Join(p.MachineRootFSDir(machineUID), DefaultMachineRootFSFile)
 }
 
+func (p *paths) MachineAttestationDir(machineUID string) string {
+	return filepath.Join(p.MachineDir(machineUID), DefaultMachineAttestationDir)
+}
+
 func (p *paths) MachineVolumesDir(machineUID string) string {
 	return filepath.Join(p.MachineDir(machineUID), DefaultMachineVolumesDir)
 }
@@ -136,6 +205,14 @@ func (p *paths) MachineIgnitionFile(machineUID string) string {
 	return filepath.Join(p.MachineIgnitionsDir(machineUID), DefaultMachineIgnitionFile)
 }
 
+func (p *paths) MachineIPXEDir(machineUID string) string {
+	return filepath.Join(p.MachineDir(machineUID), DefaultMachineIPXEDir)
+}
+
+func (p *paths) MachineConsoleLogFile(machineUID string) string {
+	return filepath.Join(p.MachineDir(machineUID), DefaultMachineConsoleLogFile)
+}
+
 type Host interface {
 	Paths
 	OCIStore() *ocistore.Store
@@ -143,7 +220,7 @@ type Host interface {
 
 type LibvirtHost interface {
 	Host
-	Libvirt() *libvirt.Libvirt
+	Libvirt() libvirtutils.Client
 }
 
 type host struct {
@@ -163,9 +240,15 @@ func PathsAt(rootDir string) (Paths, error) {
 	if err := os.MkdirAll(p.ImagesDir(), perm); err != nil {
 		return nil, fmt.Errorf("error creating images directory: %w", err)
 	}
+	if err := os.MkdirAll(p.RootFSBasesDir(), perm); err != nil {
+		return nil, fmt.Errorf("error creating root fs bases directory: %w", err)
+	}
 	if err := os.MkdirAll(p.MachinesDir(), perm); err != nil {
 		return nil, fmt.Errorf("error creating machines directory: %w", err)
 	}
+	if err := os.MkdirAll(p.OperationsDir(), perm); err != nil {
+		return nil, fmt.Errorf("error creating operations directory: %w", err)
+	}
 	return p, nil
 }
 
@@ -188,14 +271,14 @@ func NewAt(rootDir string) (Host, error) {
 
 type libvirtHost struct {
 	Host
-	libvirt *libvirt.Libvirt
+	libvirt libvirtutils.Client
 }
 
-func (h *libvirtHost) Libvirt() *libvirt.Libvirt {
+func (h *libvirtHost) Libvirt() libvirtutils.Client {
 	return h.libvirt
 }
 
-func NewLibvirtAt(rootDir string, libvirt *libvirt.Libvirt) (LibvirtHost, error) {
+func NewLibvirtAt(rootDir string, libvirt libvirtutils.Client) (LibvirtHost, error) {
 	host, err := NewAt(rootDir)
 	if err != nil {
 		return nil, err
@@ -204,6 +287,31 @@ func NewLibvirtAt(rootDir string, libvirt *libvirt.Libvirt) (LibvirtHost, error)
 	return &libvirtHost{host, libvirt}, nil
 }
 
+// MarkRunning persists the run marker. It reports whether the marker of a previous run was still present,
+// i.e. whether the provider did not shut down cleanly, e.g. due to a crash of the host.
+func MarkRunning(paths Paths) (bool, error) {
+	_, err := os.Stat(paths.RunMarkerFile())
+	switch {
+	case err == nil:
+		return true, nil
+	case !os.IsNotExist(err):
+		return false, fmt.Errorf("error checking run marker: %w", err)
+	}
+
+	if err := os.WriteFile(paths.RunMarkerFile(), nil, 0666); err != nil {
+		return false, fmt.Errorf("error writing run marker: %w", err)
+	}
+	return false, nil
+}
+
+// ClearRunning removes the run marker once the provider shut down cleanly.
+func ClearRunning(paths Paths) error {
+	if err := os.Remove(paths.RunMarkerFile()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing run marker: %w", err)
+	}
+	return nil
+}
+
 type MachineVolume struct {
 	PluginName        string
 	ComputeVolumeName string
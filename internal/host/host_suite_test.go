@@ -7,20 +7,12 @@ import (
 	"testing"
 	"time"
 
-	"github.com/ironcore-dev/libvirt-provider/api"
-	"github.com/ironcore-dev/libvirt-provider/internal/host"
-	"github.com/ironcore-dev/libvirt-provider/internal/store"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 )
 
-var (
-	tmpDir       string
-	machineStore store.Store[*api.Machine]
-)
-
 const (
 	eventuallyTimeout    = 5 * time.Second
 	pollingInterval      = 250 * time.Millisecond
@@ -39,16 +31,4 @@ func TestServer(t *testing.T) {
 
 var _ = BeforeSuite(func() {
 	logf.SetLogger(zap.New(zap.WriteTo(GinkgoWriter), zap.UseDevMode(true)))
-
-	var err error
-
-	tmpDir = GinkgoT().TempDir()
-
-	machineStore, err = host.NewStore[*api.Machine](host.Options[*api.Machine]{
-		Dir: tmpDir,
-		NewFunc: func() *api.Machine {
-			return &api.Machine{}
-		},
-	})
-	Expect(err).NotTo(HaveOccurred())
 })
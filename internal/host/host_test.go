@@ -0,0 +1,33 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package host_test
+
+import (
+	"github.com/ironcore-dev/libvirt-provider/internal/host"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Run marker", func() {
+	It("should detect runs that did not shut down cleanly", func() {
+		paths, err := host.PathsAt(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+
+		By("marking the first run as running")
+		unclean, err := host.MarkRunning(paths)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(unclean).To(BeFalse())
+
+		By("marking a run while the marker of the previous one is still present")
+		unclean, err = host.MarkRunning(paths)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(unclean).To(BeTrue())
+
+		By("clearing the marker on a clean shutdown")
+		Expect(host.ClearRunning(paths)).To(Succeed())
+		unclean, err = host.MarkRunning(paths)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(unclean).To(BeFalse())
+	})
+})
@@ -0,0 +1,164 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package host
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/store"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// AttrsStrategy determines the labels and fields an object can be selected by in Store.ListWithOptions.
+type AttrsStrategy[E api.Object] interface {
+	GetAttrs(obj E) (labels.Set, fields.Set, error)
+}
+
+// DefaultAttrs returns the labels of obj and its default fields.
+func DefaultAttrs(obj api.Object) (labels.Set, fields.Set) {
+	return labels.Set(obj.GetLabels()), fields.Set{
+		store.FieldID:      obj.GetID(),
+		store.FieldDeleted: strconv.FormatBool(obj.GetDeletedAt() != nil),
+	}
+}
+
+type indexEntry struct {
+	labels labels.Set
+	fields fields.Set
+}
+
+// matches reports whether the entry of the object with the given id is selected by opts.
+func (e *indexEntry) matches(id string, opts store.ListOptions) bool {
+	if opts.Continue != "" && id <= opts.Continue {
+		return false
+	}
+	if opts.LabelSelector != nil && !opts.LabelSelector.Matches(e.labels) {
+		return false
+	}
+	if opts.FieldSelector != nil && !opts.FieldSelector.Matches(e.fields) {
+		return false
+	}
+	return true
+}
+
+func getAttrs[E api.Object](strategy AttrsStrategy[E], obj E) (*indexEntry, error) {
+	if strategy == nil {
+		l, f := DefaultAttrs(obj)
+		return &indexEntry{labels: l, fields: f}, nil
+	}
+
+	l, f, err := strategy.GetAttrs(obj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attributes of object %s: %w", obj.GetID(), err)
+	}
+	return &indexEntry{labels: l, fields: f}, nil
+}
+
+func (s *Store[E]) getAttrs(obj E) (*indexEntry, error) {
+	return getAttrs(s.attrsStrategy, obj)
+}
+
+// ensureIndex builds the index from all stored objects if it has not been built yet.
+// It has to be called with indexMu held.
+func (s *Store[E]) ensureIndex() error {
+	if s.index != nil {
+		return nil
+	}
+
+	entries, err := s.backend.ReadAll()
+	if err != nil {
+		return err
+	}
+
+	index := make(map[string]*indexEntry, len(entries))
+	for _, data := range entries {
+		obj, err := s.decode(data)
+		if err != nil {
+			return fmt.Errorf("failed to read object: %w", err)
+		}
+
+		entry, err := s.getAttrs(obj)
+		if err != nil {
+			return err
+		}
+		index[obj.GetID()] = entry
+	}
+
+	s.index = index
+	return nil
+}
+
+// updateIndex updates the entry of obj if the index has been built.
+// It has to be called with indexMu held, along with writing obj to the backend.
+func (s *Store[E]) updateIndex(obj E) {
+	if s.index == nil {
+		return
+	}
+
+	entry, err := s.getAttrs(obj)
+	if err != nil {
+		// drop the index, it will be rebuilt on the next list call
+		s.index = nil
+		return
+	}
+	s.index[obj.GetID()] = entry
+}
+
+// removeFromIndex removes the entry of the object with the given id if the index has been built.
+// It has to be called with indexMu held, along with deleting the object from the backend.
+func (s *Store[E]) removeFromIndex(id string) {
+	if s.index != nil {
+		delete(s.index, id)
+	}
+}
+
+func (s *Store[E]) selectIDs(opts store.ListOptions) ([]string, error) {
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	if err := s.ensureIndex(); err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for id, entry := range s.index {
+		if entry.matches(id, opts) {
+			ids = append(ids, id)
+		}
+	}
+
+	slices.Sort(ids)
+	return ids, nil
+}
+
+func (s *Store[E]) ListWithOptions(_ context.Context, opts store.ListOptions) ([]E, string, error) {
+	ids, err := s.selectIDs(opts)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var objs []E
+	for i, id := range ids {
+		if opts.Limit > 0 && int64(len(objs)) == opts.Limit {
+			return objs, ids[i-1], nil
+		}
+
+		obj, err := s.lockedGet(id)
+		if err != nil {
+			if store.IgnoreErrNotFound(err) == nil {
+				continue
+			}
+			return nil, "", fmt.Errorf("failed to read object: %w", err)
+		}
+
+		objs = append(objs, obj)
+	}
+
+	return objs, "", nil
+}
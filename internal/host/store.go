@@ -7,8 +7,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
 	"reflect"
 	"sync"
 	"time"
@@ -23,11 +21,19 @@ import (
 
 const perm = 0777
 
+const defaultWatchBufferSize = 10
+
 type Options[E api.Object] struct {
-	//TODO
-	Dir            string
+	// Dir is the directory objects are stored at if no Backend is specified.
+	Dir string
+	// Backend persists the objects. Defaults to a file backend at Dir.
+	Backend        Backend
 	NewFunc        func() E
 	CreateStrategy CreateStrategy[E]
+	// AttrsStrategy determines the labels and fields objects can be selected by. Defaults to DefaultAttrs.
+	AttrsStrategy AttrsStrategy[E]
+	// WatchBufferSize is the number of events buffered per watch before events are dropped. Defaults to 10.
+	WatchBufferSize int
 }
 
 func NewStore[E api.Object](opts Options[E]) (*Store[E], error) {
@@ -36,32 +42,50 @@ func NewStore[E api.Object](opts Options[E]) (*Store[E], error) {
 		return nil, fmt.Errorf("must specify opts.NewFunc")
 	}
 
-	if err := os.MkdirAll(opts.Dir, perm); err != nil {
-		return nil, fmt.Errorf("error creating store directory: %w", err)
+	watchBufferSize := opts.WatchBufferSize
+	if watchBufferSize <= 0 {
+		watchBufferSize = defaultWatchBufferSize
+	}
+
+	backend := opts.Backend
+	if backend == nil {
+		var err error
+		backend, err = NewFileBackend(opts.Dir)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return &Store[E]{
-		dir: opts.Dir,
+		backend: backend,
 
 		idMu: utilssync.NewMutexMap[string](),
 
 		newFunc:        opts.NewFunc,
 		createStrategy: opts.CreateStrategy,
+		attrsStrategy:  opts.AttrsStrategy,
 
-		watches: sets.New[*watch[E]](),
+		watches:         sets.New[*watch[E]](),
+		watchBufferSize: watchBufferSize,
 	}, nil
 }
 
 type Store[E api.Object] struct {
-	dir string
+	backend Backend
 
 	idMu *utilssync.MutexMap[string]
 
 	newFunc        func() E
 	createStrategy CreateStrategy[E]
+	attrsStrategy  AttrsStrategy[E]
+
+	// indexMu guards the index along with the writes of the backend it reflects.
+	indexMu sync.Mutex
+	index   map[string]*indexEntry
 
-	watchesMu sync.RWMutex
-	watches   sets.Set[*watch[E]]
+	watchesMu       sync.RWMutex
+	watches         sets.Set[*watch[E]]
+	watchBufferSize int
 }
 
 type CreateStrategy[E api.Object] interface {
@@ -102,10 +126,7 @@ func (s *Store[E]) Create(_ context.Context, obj E) (E, error) {
 }
 
 func (s *Store[E]) Get(_ context.Context, id string) (E, error) {
-	s.idMu.Lock(id)
-	defer s.idMu.Unlock(id)
-
-	object, err := s.get(id)
+	object, err := s.lockedGet(id)
 	if err != nil {
 		return utils.Zero[E](), fmt.Errorf("failed to read object: %w", err)
 	}
@@ -113,6 +134,13 @@ func (s *Store[E]) Get(_ context.Context, id string) (E, error) {
 	return object, nil
 }
 
+func (s *Store[E]) lockedGet(id string) (E, error) {
+	s.idMu.Lock(id)
+	defer s.idMu.Unlock(id)
+
+	return s.get(id)
+}
+
 func (s *Store[E]) Update(_ context.Context, obj E) (E, error) {
 	s.idMu.Lock(obj.GetID())
 	defer s.idMu.Unlock(obj.GetID())
@@ -185,19 +213,15 @@ func (s *Store[E]) Delete(_ context.Context, id string) error {
 	return nil
 }
 
-func (s *Store[E]) List(ctx context.Context) ([]E, error) {
-	entries, err := os.ReadDir(s.dir)
+func (s *Store[E]) List(_ context.Context) ([]E, error) {
+	entries, err := s.backend.ReadAll()
 	if err != nil {
-		return nil, fmt.Errorf("failed to list objects: %w", err)
+		return nil, err
 	}
 
 	var objs []E
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-
-		object, err := s.Get(ctx, entry.Name())
+	for _, data := range entries {
+		object, err := s.decode(data)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read object: %w", err)
 		}
@@ -209,14 +233,14 @@ func (s *Store[E]) List(ctx context.Context) ([]E, error) {
 }
 
 func (s *Store[E]) Watch(_ context.Context) (store.Watch[E], error) {
-	//TODO make configurable
-	const bufferSize = 10
 	s.watchesMu.Lock()
 	defer s.watchesMu.Unlock()
 
 	w := &watch[E]{
-		store:  s,
-		events: make(chan store.WatchEvent[E], bufferSize),
+		store:      s,
+		bufferSize: s.watchBufferSize,
+		// reserve one slot for the resync event
+		events: make(chan store.WatchEvent[E], s.watchBufferSize+1),
 	}
 
 	s.watches.Insert(w)
@@ -225,21 +249,26 @@ func (s *Store[E]) Watch(_ context.Context) (store.Watch[E], error) {
 }
 
 func (s *Store[E]) get(id string) (E, error) {
-	file, err := os.ReadFile(filepath.Join(s.dir, id))
+	data, err := s.backend.Read(id)
 	if err != nil {
-		if !os.IsNotExist(err) {
-			return utils.Zero[E](), fmt.Errorf("failed to read file: %w", err)
-		}
+		return utils.Zero[E](), err
+	}
 
-		return utils.Zero[E](), fmt.Errorf("object with id %q %w", id, store.ErrNotFound)
+	obj, err := s.decode(data)
+	if err != nil {
+		return utils.Zero[E](), fmt.Errorf("failed to unmarshal object %s: %w", id, err)
 	}
 
+	return obj, nil
+}
+
+func (s *Store[E]) decode(data []byte) (E, error) {
 	obj := s.newFunc()
-	if err := json.Unmarshal(file, &obj); err != nil {
-		return utils.Zero[E](), fmt.Errorf("failed to unmarshal object from file %s: %w", id, err)
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return utils.Zero[E](), err
 	}
 
-	return obj, err
+	return obj, nil
 }
 
 func (s *Store[E]) set(obj E) (E, error) {
@@ -248,17 +277,27 @@ func (s *Store[E]) set(obj E) (E, error) {
 		return utils.Zero[E](), fmt.Errorf("failed to marshal obj: %w", err)
 	}
 
-	if err := os.WriteFile(filepath.Join(s.dir, obj.GetID()), data, 0666); err != nil {
-		return utils.Zero[E](), nil
+	// Writing the backend and updating the index in one critical section orders them strictly with building
+	// the index, which would otherwise be able to overwrite the entry with the one of an older version.
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	if err := s.backend.Write(obj.GetID(), data); err != nil {
+		return utils.Zero[E](), err
 	}
+	s.updateIndex(obj)
 
 	return obj, nil
 }
 
 func (s *Store[E]) delete(id string) error {
-	if err := os.Remove(filepath.Join(s.dir, id)); err != nil {
-		return fmt.Errorf("failed to delete object from store: %w", err)
+	s.indexMu.Lock()
+	defer s.indexMu.Unlock()
+
+	if err := s.backend.Delete(id); err != nil {
+		return err
 	}
+	s.removeFromIndex(id)
 
 	return nil
 }
@@ -272,9 +311,6 @@ func (s *Store[E]) watchHandlers() []*watch[E] {
 
 func (s *Store[E]) enqueue(evt store.WatchEvent[E]) {
 	for _, handler := range s.watchHandlers() {
-		select {
-		case handler.events <- evt:
-		default:
-		}
+		handler.send(evt)
 	}
 }
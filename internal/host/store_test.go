@@ -4,16 +4,52 @@
 package host_test
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"sync"
 
 	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/host"
 	"github.com/ironcore-dev/libvirt-provider/internal/store"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
-var _ = Describe("Store", func() {
+// newBackend creates the backend of a store in dir.
+type newBackend func(dir string) (host.Backend, error)
+
+func newSQLiteBackend(dir string) (host.Backend, error) {
+	backend, closeBackend, err := host.OpenSQLiteBackend(filepath.Join(dir, "machines.db"))
+	if err != nil {
+		return nil, err
+	}
+	DeferCleanup(closeBackend)
+	return backend, nil
+}
+
+var _ = DescribeTableSubtree("Store", func(newBackend newBackend) {
+	var machineStore *host.Store[*api.Machine]
+
+	newStore := func(watchBufferSize int) *host.Store[*api.Machine] {
+		backend, err := newBackend(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+
+		s, err := host.NewStore[*api.Machine](host.Options[*api.Machine]{
+			Backend:         backend,
+			NewFunc:         func() *api.Machine { return &api.Machine{} },
+			WatchBufferSize: watchBufferSize,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return s
+	}
+
+	BeforeEach(func() {
+		machineStore = newStore(0)
+	})
 
 	It("should correctly create a object", func(ctx SpecContext) {
 		By("creating a watch")
@@ -33,9 +69,9 @@ var _ = Describe("Store", func() {
 		Expect(machine).NotTo(BeNil())
 
 		By("checking that the store object exists")
-		data, err := os.ReadFile(filepath.Join(tmpDir, machine.ID))
+		stored, err := machineStore.Get(ctx, machine.ID)
 		Expect(err).NotTo(HaveOccurred())
-		Expect(data).NotTo(BeNil())
+		Expect(stored.ID).To(Equal(machine.ID))
 
 		By("checking that the event got fired")
 		event := &store.WatchEvent[*api.Machine]{
@@ -44,4 +80,211 @@ var _ = Describe("Store", func() {
 		}
 		Eventually(watch.Events()).Should(Receive(event))
 	})
+	It("should list objects by selectors and paginate", func(ctx SpecContext) {
+		By("creating machine objects")
+		for _, id := range []string{"select-a", "select-b", "select-c"} {
+			_, err := machineStore.Create(ctx, &api.Machine{
+				Metadata: api.Metadata{
+					ID:     id,
+					Labels: map[string]string{"app": "selected"},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(machineStore.Delete, id)
+		}
+		_, err := machineStore.Create(ctx, &api.Machine{
+			Metadata: api.Metadata{
+				ID:     "select-other",
+				Labels: map[string]string{"app": "other"},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(machineStore.Delete, "select-other")
+
+		By("listing by label selector")
+		machines, cont, err := machineStore.ListWithOptions(ctx, store.ListOptions{
+			LabelSelector: labels.SelectorFromSet(labels.Set{"app": "selected"}),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cont).To(BeEmpty())
+		Expect(machines).To(HaveExactElements(
+			HaveField("ID", "select-a"),
+			HaveField("ID", "select-b"),
+			HaveField("ID", "select-c"),
+		))
+
+		By("listing by field selector")
+		machines, _, err = machineStore.ListWithOptions(ctx, store.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector(store.FieldID, "select-other"),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(machines).To(HaveExactElements(HaveField("ID", "select-other")))
+
+		By("listing the first page")
+		machines, cont, err = machineStore.ListWithOptions(ctx, store.ListOptions{
+			LabelSelector: labels.SelectorFromSet(labels.Set{"app": "selected"}),
+			Limit:         2,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cont).NotTo(BeEmpty())
+		Expect(machines).To(HaveExactElements(HaveField("ID", "select-a"), HaveField("ID", "select-b")))
+
+		By("listing the second page")
+		machines, cont, err = machineStore.ListWithOptions(ctx, store.ListOptions{
+			LabelSelector: labels.SelectorFromSet(labels.Set{"app": "selected"}),
+			Limit:         2,
+			Continue:      cont,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cont).To(BeEmpty())
+		Expect(machines).To(HaveExactElements(HaveField("ID", "select-c")))
+
+		By("updating the labels of an object")
+		machine, err := machineStore.Get(ctx, "select-c")
+		Expect(err).NotTo(HaveOccurred())
+		machine.Labels = map[string]string{"app": "other"}
+		_, err = machineStore.Update(ctx, machine)
+		Expect(err).NotTo(HaveOccurred())
+
+		machines, _, err = machineStore.ListWithOptions(ctx, store.ListOptions{
+			LabelSelector: labels.SelectorFromSet(labels.Set{"app": "other"}),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(machines).To(HaveExactElements(HaveField("ID", "select-c"), HaveField("ID", "select-other")))
+	})
+	It("should keep the index in sync with objects updated while it is rebuilt", func(ctx SpecContext) {
+		const (
+			objects     = 5
+			generations = 20
+		)
+
+		By("creating machine objects")
+		var ids []string
+		for i := range objects {
+			id := fmt.Sprintf("rebuild-%d", i)
+			_, err := machineStore.Create(ctx, &api.Machine{
+				Metadata: api.Metadata{
+					ID:     id,
+					Labels: map[string]string{"generation": "0"},
+				},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(machineStore.Delete, id)
+			ids = append(ids, id)
+		}
+
+		By("updating the objects while rebuilding the index")
+		var wg sync.WaitGroup
+		for _, id := range ids {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				for generation := 1; generation <= generations; generation++ {
+					machine, err := machineStore.Get(ctx, id)
+					Expect(err).NotTo(HaveOccurred())
+					machine.Labels = map[string]string{"generation": strconv.Itoa(generation)}
+					_, err = machineStore.Update(ctx, machine)
+					Expect(err).NotTo(HaveOccurred())
+				}
+			}()
+		}
+		done := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(done)
+		}()
+		Eventually(func(g Gomega) <-chan struct{} {
+			machineStore.DropIndex()
+			_, _, err := machineStore.ListWithOptions(ctx, store.ListOptions{
+				LabelSelector: labels.SelectorFromSet(labels.Set{"generation": "0"}),
+			})
+			g.Expect(err).NotTo(HaveOccurred())
+			return done
+		}).WithPolling(0).Should(BeClosed())
+
+		machines, _, err := machineStore.ListWithOptions(ctx, store.ListOptions{
+			LabelSelector: labels.SelectorFromSet(labels.Set{"generation": strconv.Itoa(generations)}),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(machines).To(HaveLen(objects))
+	})
+
+	It("should signal a resync once watch events are dropped", func(ctx SpecContext) {
+		By("creating a store with a small watch buffer")
+		smallBufferStore := newStore(2)
+
+		watch, err := smallBufferStore.Watch(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(watch.Stop)
+
+		By("creating more objects than the watch buffers")
+		for _, id := range []string{"overflow-a", "overflow-b", "overflow-c", "overflow-d"} {
+			_, err := smallBufferStore.Create(ctx, &api.Machine{Metadata: api.Metadata{ID: id}})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		By("receiving the buffered events followed by a single resync event")
+		Expect(watch.Events()).To(Receive(HaveField("Object.ID", "overflow-a")))
+		Expect(watch.Events()).To(Receive(HaveField("Object.ID", "overflow-b")))
+		Expect(watch.Events()).To(Receive(HaveField("Type", store.WatchEventTypeResync)))
+		Expect(watch.Events()).NotTo(Receive())
+
+		By("receiving events again after the resync")
+		_, err = smallBufferStore.Create(ctx, &api.Machine{Metadata: api.Metadata{ID: "overflow-e"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(watch.Events()).To(Receive(HaveField("Object.ID", "overflow-e")))
+	})
+},
+	Entry("with the file backend", newBackend(host.NewFileBackend)),
+	Entry("with the sqlite backend", newBackend(newSQLiteBackend)),
+)
+
+var _ = Describe("File backend", func() {
+	var (
+		tmpDir       string
+		machineStore *host.Store[*api.Machine]
+	)
+
+	BeforeEach(func() {
+		tmpDir = GinkgoT().TempDir()
+
+		var err error
+		machineStore, err = host.NewStore[*api.Machine](host.Options[*api.Machine]{
+			Dir:     tmpDir,
+			NewFunc: func() *api.Machine { return &api.Machine{} },
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should store objects as files", func(ctx SpecContext) {
+		machine, err := machineStore.Create(ctx, &api.Machine{Metadata: api.Metadata{ID: "test-id"}})
+		Expect(err).NotTo(HaveOccurred())
+
+		data, err := os.ReadFile(filepath.Join(tmpDir, machine.ID))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(data).NotTo(BeNil())
+	})
+
+	It("should list objects and ignore incomplete writes", func(ctx SpecContext) {
+		By("creating a machine object")
+		machine, err := machineStore.Create(ctx, &api.Machine{
+			Metadata: api.Metadata{
+				ID: "test-list-id",
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(machineStore.Delete, machine.ID)
+
+		By("leaving a temporary file of an interrupted write behind")
+		Expect(os.WriteFile(filepath.Join(tmpDir, ".test-list-id-123"), []byte("{"), 0666)).To(Succeed())
+
+		By("listing the objects")
+		machines, err := machineStore.List(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(machines).To(ContainElement(HaveField("ID", machine.ID)))
+		for _, m := range machines {
+			Expect(m.ID).NotTo(HavePrefix("."))
+		}
+	})
 })
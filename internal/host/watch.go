@@ -4,6 +4,8 @@
 package host
 
 import (
+	"sync"
+
 	"github.com/ironcore-dev/libvirt-provider/api"
 	"github.com/ironcore-dev/libvirt-provider/internal/store"
 )
@@ -11,6 +13,36 @@ import (
 type watch[E api.Object] struct {
 	store  *Store[E]
 	events chan store.WatchEvent[E]
+
+	mu         sync.Mutex
+	bufferSize int
+	// overflowed is set once an event has been dropped until the watcher received the resync event.
+	overflowed bool
+}
+
+// send delivers evt without blocking. If the buffer is full, evt is dropped and a single
+// resync event is put into the slot reserved for it.
+func (w *watch[E]) send(evt store.WatchEvent[E]) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.overflowed && len(w.events) == 0 {
+		// the resync event has been consumed, the watcher relists from here on
+		w.overflowed = false
+	}
+
+	if w.overflowed {
+		// the event is covered by the pending resync
+		return
+	}
+
+	if len(w.events) < w.bufferSize {
+		w.events <- evt
+		return
+	}
+
+	w.overflowed = true
+	w.events <- store.WatchEvent[E]{Type: store.WatchEventTypeResync}
 }
 
 func (w *watch[E]) Stop() {
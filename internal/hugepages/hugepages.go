@@ -0,0 +1,181 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package hugepages
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"k8s.io/utils/cpuset"
+)
+
+// DefaultNodesDir is the sysfs directory of the NUMA nodes of the host.
+const DefaultNodesDir = "/sys/devices/system/node"
+
+// ErrInsufficientHugepages is returned if no NUMA node has enough free hugepages for a machine.
+var ErrInsufficientHugepages = errors.New("insufficient hugepages")
+
+// Node is a NUMA node of the host along with its pool of hugepages.
+type Node struct {
+	ID int
+	// CPUs are the host cpus of the node.
+	CPUs cpuset.CPUSet
+	// PageSize is the size of the hugepages in bytes.
+	PageSize int64
+	// Pages is the number of hugepages of the node.
+	Pages int64
+}
+
+// Bytes returns the hugepage memory of the node in bytes.
+func (n Node) Bytes() int64 {
+	return n.PageSize * n.Pages
+}
+
+// ReadNodes reads the NUMA nodes in dir, usually DefaultNodesDir, along with their pools of hugepages of
+// the given size.
+func ReadNodes(dir string, pageSize int64) ([]Node, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading numa nodes: %w", err)
+	}
+
+	var nodes []Node
+	for _, entry := range entries {
+		idValue, ok := strings.CutPrefix(entry.Name(), "node")
+		if !ok {
+			continue
+		}
+		id, err := strconv.Atoi(idValue)
+		if err != nil {
+			continue
+		}
+
+		node, err := readNode(filepath.Join(dir, entry.Name()), id, pageSize)
+		if err != nil {
+			return nil, fmt.Errorf("[numa node %d] %w", id, err)
+		}
+		nodes = append(nodes, node)
+	}
+	slices.SortFunc(nodes, func(a, b Node) int { return a.ID - b.ID })
+	return nodes, nil
+}
+
+func readNode(dir string, id int, pageSize int64) (Node, error) {
+	cpuList, err := os.ReadFile(filepath.Join(dir, "cpulist"))
+	if err != nil {
+		return Node{}, fmt.Errorf("error reading cpus: %w", err)
+	}
+	cpus, err := cpuset.Parse(strings.TrimSpace(string(cpuList)))
+	if err != nil {
+		return Node{}, fmt.Errorf("error parsing cpus: %w", err)
+	}
+
+	pagesFile := filepath.Join(dir, "hugepages", fmt.Sprintf("hugepages-%dkB", pageSize/1024), "nr_hugepages")
+	pagesValue, err := os.ReadFile(pagesFile)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return Node{}, fmt.Errorf("error reading hugepages: %w", err)
+		}
+		// The node has no pool of hugepages of the size.
+		pagesValue = []byte("0")
+	}
+	pages, err := strconv.ParseInt(strings.TrimSpace(string(pagesValue)), 10, 64)
+	if err != nil {
+		return Node{}, fmt.Errorf("error parsing hugepages: %w", err)
+	}
+
+	return Node{ID: id, CPUs: cpus, PageSize: pageSize, Pages: pages}, nil
+}
+
+// Source hands out the hugepage memory of the NUMA nodes of the host to machines, so the memory and the
+// vCPUs of a machine are on the same node. It is stateless, the memory in use is determined by the machines
+// the nodes are allocated to.
+type Source struct {
+	nodes []Node
+}
+
+func NewSource(nodes []Node) *Source {
+	return &Source{nodes: slices.Clone(nodes)}
+}
+
+// Nodes returns the nodes of the host.
+func (s *Source) Nodes() []Node {
+	return slices.Clone(s.nodes)
+}
+
+// Node returns the node with the given ID.
+func (s *Source) Node(id int) (Node, bool) {
+	for _, node := range s.nodes {
+		if node.ID == id {
+			return node, true
+		}
+	}
+	return Node{}, false
+}
+
+// Quantity returns the number of machines with the given memory fitting into the hugepages of the nodes,
+// with every machine on a single node.
+func (s *Source) Quantity(memoryBytes int64) int64 {
+	if memoryBytes <= 0 {
+		return 0
+	}
+
+	var quantity int64
+	for _, node := range s.nodes {
+		quantity += node.Bytes() / memoryBytes
+	}
+	return quantity
+}
+
+// Hints are the placement preferences of a machine. Nodes without enough free memory are never chosen.
+type Hints struct {
+	// Preferred is the node the machine is placed on if it has enough free memory.
+	Preferred *int
+	// Avoid are the nodes the machine is only placed on if no other node has enough free memory.
+	Avoid []int
+}
+
+// Allocate returns the node for a machine with the given memory, allocated is the memory in bytes already
+// allocated to other machines per node. The current node of the machine, if any, is kept as machines can't
+// move between nodes. Otherwise the node is chosen according to hints, falling back to the node with the most
+// free memory to spread machines. It fails with ErrInsufficientHugepages if the node has not enough free memory.
+func (s *Source) Allocate(memoryBytes int64, current *int, allocated map[int]int64, hints Hints) (int, error) {
+	if current != nil {
+		node, ok := s.Node(*current)
+		if !ok {
+			return 0, fmt.Errorf("unknown numa node %d", *current)
+		}
+		if free := node.Bytes() - allocated[node.ID]; free < memoryBytes {
+			return 0, fmt.Errorf("%w: numa node %d has %d bytes free, %d requested", ErrInsufficientHugepages, node.ID, free, memoryBytes)
+		}
+		return node.ID, nil
+	}
+
+	if hints.Preferred != nil {
+		if node, ok := s.Node(*hints.Preferred); ok && node.Bytes()-allocated[node.ID] >= memoryBytes {
+			return node.ID, nil
+		}
+	}
+
+	best, bestFree, bestAvoided := -1, int64(0), false
+	for _, node := range s.nodes {
+		free := node.Bytes() - allocated[node.ID]
+		if free < memoryBytes {
+			continue
+		}
+		avoided := slices.Contains(hints.Avoid, node.ID)
+		if best < 0 || (bestAvoided && !avoided) || (bestAvoided == avoided && free > bestFree) {
+			best, bestFree, bestAvoided = node.ID, free, avoided
+		}
+	}
+	if best < 0 {
+		return 0, fmt.Errorf("%w: no numa node has %d bytes free", ErrInsufficientHugepages, memoryBytes)
+	}
+	return best, nil
+}
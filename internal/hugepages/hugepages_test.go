@@ -0,0 +1,86 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package hugepages_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/ironcore-dev/libvirt-provider/internal/hugepages"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/cpuset"
+	"k8s.io/utils/ptr"
+)
+
+const pageSize = 2 * 1024 * 1024
+
+var _ = Describe("Hugepages", func() {
+	Describe("ReadNodes", func() {
+		writeFile := func(name, data string) {
+			GinkgoHelper()
+			Expect(os.MkdirAll(filepath.Dir(name), 0777)).To(Succeed())
+			Expect(os.WriteFile(name, []byte(data), 0666)).To(Succeed())
+		}
+
+		It("should read the hugepages of the numa nodes", func() {
+			dir := GinkgoT().TempDir()
+			writeFile(filepath.Join(dir, "node0", "cpulist"), "0-3,8-11\n")
+			writeFile(filepath.Join(dir, "node0", "hugepages", "hugepages-2048kB", "nr_hugepages"), "512\n")
+			writeFile(filepath.Join(dir, "node0", "hugepages", "hugepages-1048576kB", "nr_hugepages"), "4\n")
+			writeFile(filepath.Join(dir, "node1", "cpulist"), "4-7\n")
+			writeFile(filepath.Join(dir, "possible"), "0-1\n")
+
+			nodes, err := ReadNodes(dir, pageSize)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(nodes).To(Equal([]Node{
+				{ID: 0, CPUs: cpuset.New(0, 1, 2, 3, 8, 9, 10, 11), PageSize: pageSize, Pages: 512},
+				{ID: 1, CPUs: cpuset.New(4, 5, 6, 7), PageSize: pageSize, Pages: 0},
+			}))
+		})
+	})
+
+	Describe("Source", func() {
+		var source *Source
+
+		BeforeEach(func() {
+			source = NewSource([]Node{
+				{ID: 0, CPUs: cpuset.New(0, 1), PageSize: pageSize, Pages: 1024},
+				{ID: 1, CPUs: cpuset.New(2, 3), PageSize: pageSize, Pages: 512},
+			})
+		})
+
+		It("should count the machines fitting into single nodes", func() {
+			Expect(source.Quantity(768 * 1024 * 1024)).To(BeEquivalentTo(3))
+			Expect(source.Quantity(1536 * 1024 * 1024)).To(BeEquivalentTo(1))
+			Expect(source.Quantity(4096 * 1024 * 1024)).To(BeZero())
+		})
+
+		It("should allocate the node with the most free memory", func() {
+			Expect(source.Allocate(512*1024*1024, nil, nil, Hints{})).To(Equal(0))
+			Expect(source.Allocate(512*1024*1024, nil, map[int]int64{0: 1536 * 1024 * 1024}, Hints{})).To(Equal(1))
+		})
+
+		It("should allocate the preferred node if it has enough free memory", func() {
+			Expect(source.Allocate(512*1024*1024, nil, nil, Hints{Preferred: ptr.To(1)})).To(Equal(1))
+			Expect(source.Allocate(512*1024*1024, nil, map[int]int64{1: 1024 * 1024 * 1024}, Hints{Preferred: ptr.To(1)})).To(Equal(0))
+		})
+
+		It("should only allocate avoided nodes if no other node has enough free memory", func() {
+			Expect(source.Allocate(512*1024*1024, nil, nil, Hints{Avoid: []int{0}})).To(Equal(1))
+			Expect(source.Allocate(1536*1024*1024, nil, nil, Hints{Avoid: []int{0}})).To(Equal(0))
+		})
+
+		It("should keep the current node of the machine", func() {
+			Expect(source.Allocate(512*1024*1024, ptr.To(1), map[int]int64{1: 512 * 1024 * 1024}, Hints{})).To(Equal(1))
+			_, err := source.Allocate(512*1024*1024, ptr.To(1), map[int]int64{1: 1024 * 1024 * 1024}, Hints{})
+			Expect(err).To(MatchError(ErrInsufficientHugepages))
+		})
+
+		It("should fail if no node has enough free memory", func() {
+			_, err := source.Allocate(3*1024*1024*1024, nil, nil, Hints{})
+			Expect(err).To(MatchError(ErrInsufficientHugepages))
+		})
+	})
+})
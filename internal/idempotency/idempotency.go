@@ -0,0 +1,143 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package idempotency
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	utilssync "github.com/ironcore-dev/libvirt-provider/internal/sync"
+)
+
+const perm = 0777
+
+// MaxKeyLength is the maximum length of idempotency keys.
+const MaxKeyLength = 256
+
+// Store remembers the object created for an idempotency key, so that retried requests return that object
+// instead of creating another one. Keys expire after their TTL. Every key is persisted as file named after
+// the hash of the key, containing the object ID and the digest of the request that created it, so keys survive
+// restarts.
+// A nil Store remembers nothing.
+type Store struct {
+	dir   string
+	ttl   time.Duration
+	locks *utilssync.MutexMap[string]
+}
+
+// NewStore creates a Store persisting its keys in dir. Expired keys left behind by a previous run are removed.
+func NewStore(dir string, ttl time.Duration) (*Store, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("idempotency key ttl must be positive")
+	}
+	if err := os.MkdirAll(dir, perm); err != nil {
+		return nil, fmt.Errorf("error creating idempotency keys directory: %w", err)
+	}
+
+	s := &Store{
+		dir:   dir,
+		ttl:   ttl,
+		locks: utilssync.NewMutexMap[string](),
+	}
+	if err := s.Prune(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Locker returns a lock of key. It has to be held from looking up the key until its object is put, so
+// concurrent requests with the same key don't create the object twice.
+func (s *Store) Locker(key string) sync.Locker {
+	if s == nil {
+		return noopLocker{}
+	}
+	return s.locks.Locker(key)
+}
+
+// Get returns the ID of the object created for key and the digest of the request that created it, if key has not
+// expired yet. The digest is empty for keys put before digests were remembered.
+func (s *Store) Get(key string) (id, requestDigest string, ok bool, err error) {
+	if s == nil {
+		return "", "", false, nil
+	}
+
+	file := s.keyFile(key)
+	info, err := os.Stat(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", "", false, nil
+		}
+		return "", "", false, fmt.Errorf("error checking idempotency key: %w", err)
+	}
+	if s.expired(info) {
+		return "", "", false, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", "", false, nil
+		}
+		return "", "", false, fmt.Errorf("error reading idempotency key: %w", err)
+	}
+	id, requestDigest, _ = strings.Cut(string(data), "\n")
+	return id, requestDigest, true, nil
+}
+
+// Put remembers id as ID of the object created for key by the request with the given digest. Expired keys are
+// pruned along the way, objects are created rarely enough to keep the number of keys low.
+func (s *Store) Put(key, id, requestDigest string) error {
+	if s == nil {
+		return nil
+	}
+
+	if err := os.WriteFile(s.keyFile(key), []byte(id+"\n"+requestDigest), 0666); err != nil {
+		return fmt.Errorf("error persisting idempotency key: %w", err)
+	}
+	return s.Prune()
+}
+
+// Prune removes the expired keys.
+func (s *Store) Prune() error {
+	if s == nil {
+		return nil
+	}
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("error reading idempotency keys directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !s.expired(info) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.dir, entry.Name())); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error removing expired idempotency key: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) expired(info os.FileInfo) bool {
+	return time.Since(info.ModTime()) > s.ttl
+}
+
+func (s *Store) keyFile(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
+
+type noopLocker struct{}
+
+func (noopLocker) Lock()   {}
+func (noopLocker) Unlock() {}
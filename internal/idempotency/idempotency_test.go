@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package idempotency_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ironcore-dev/libvirt-provider/internal/idempotency"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Store", func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+
+	It("should remember keys across restarts", func() {
+		store, err := idempotency.NewStore(dir, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+
+		By("putting a key")
+		Expect(store.Put("key-a", "machine-a", "sha256:a")).To(Succeed())
+
+		By("restarting the store")
+		store, err = idempotency.NewStore(dir, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+
+		id, requestDigest, ok, err := store.Get("key-a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(id).To(Equal("machine-a"))
+		Expect(requestDigest).To(Equal("sha256:a"))
+
+		_, _, ok, err = store.Get("key-b")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeFalse())
+	})
+
+	It("should support keys up to the maximum length", func() {
+		store, err := idempotency.NewStore(dir, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+
+		key := strings.Repeat("k", idempotency.MaxKeyLength)
+		Expect(store.Put(key, "machine-a", "sha256:a")).To(Succeed())
+		id, _, ok, err := store.Get(key)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(id).To(Equal("machine-a"))
+	})
+
+	It("should expire and prune keys after their ttl", func() {
+		store, err := idempotency.NewStore(dir, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store.Put("key-a", "machine-a", "sha256:a")).To(Succeed())
+
+		By("aging the key beyond its ttl")
+		entries, err := os.ReadDir(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+		past := time.Now().Add(-2 * time.Hour)
+		Expect(os.Chtimes(filepath.Join(dir, entries[0].Name()), past, past)).To(Succeed())
+
+		_, _, ok, err := store.Get("key-a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeFalse())
+
+		By("pruning the expired key")
+		Expect(store.Prune()).To(Succeed())
+		Expect(os.ReadDir(dir)).To(BeEmpty())
+	})
+
+	It("should remember nothing if nil", func() {
+		var store *idempotency.Store
+		Expect(store.Put("key-a", "machine-a", "sha256:a")).To(Succeed())
+		_, _, ok, err := store.Get("key-a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeFalse())
+	})
+	It("should read keys put without request digest", func() {
+		store, err := idempotency.NewStore(dir, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store.Put("key-a", "machine-a", "sha256:a")).To(Succeed())
+
+		By("dropping the request digest of the key")
+		entries, err := os.ReadDir(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+		Expect(os.WriteFile(filepath.Join(dir, entries[0].Name()), []byte("machine-a"), 0666)).To(Succeed())
+
+		id, requestDigest, ok, err := store.Get("key-a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(id).To(Equal("machine-a"))
+		Expect(requestDigest).To(BeEmpty())
+	})
+})
@@ -0,0 +1,204 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package inflight
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const perm = 0777
+
+// Kinds of tracked operations.
+const (
+	KindImagePull   = "image-pull"
+	KindRootFS      = "rootfs"
+	KindVolumeApply = "volume-apply"
+)
+
+var ErrShuttingDown = errors.New("shutting down, not accepting new operations")
+
+type key struct {
+	kind string
+	id   string
+}
+
+// Tracker tracks long-running operations, so that a graceful shutdown can wait for them.
+// For every operation a resume marker is persisted that is only removed once the operation succeeded.
+// A marker that is present when an operation begins tells it that a previous attempt was interrupted.
+// A nil Tracker tracks nothing.
+type Tracker struct {
+	dir string
+
+	mu          sync.Mutex
+	draining    bool
+	active      sync.WaitGroup
+	interrupted sets.Set[key]
+	// persisted are the operations whose marker is on disk, so repeated operations don't rewrite it.
+	persisted sets.Set[key]
+}
+
+// NewTracker creates a Tracker persisting its markers in dir. Markers left behind by a previous run
+// are considered interrupted.
+func NewTracker(dir string) (*Tracker, error) {
+	if err := os.MkdirAll(dir, perm); err != nil {
+		return nil, fmt.Errorf("error creating operations directory: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading operations directory: %w", err)
+	}
+
+	interrupted := sets.New[key]()
+	for _, entry := range entries {
+		k, err := parseMarkerName(entry.Name())
+		if err != nil {
+			continue
+		}
+		interrupted.Insert(k)
+	}
+
+	return &Tracker{
+		dir:         dir,
+		interrupted: interrupted,
+		persisted:   interrupted.Clone(),
+	}, nil
+}
+
+// Operation is an in-flight operation. Done has to be called once it returns.
+type Operation struct {
+	tracker *Tracker
+	key     key
+	resumed bool
+	once    sync.Once
+}
+
+// Begin starts tracking the operation of the given kind and id.
+// It returns ErrShuttingDown once the tracker is draining.
+func (t *Tracker) Begin(kind, id string) (*Operation, error) {
+	if t == nil {
+		return nil, nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.draining {
+		return nil, ErrShuttingDown
+	}
+
+	k := key{kind: kind, id: id}
+	if !t.persisted.Has(k) {
+		if err := os.WriteFile(t.markerFile(k), nil, 0666); err != nil {
+			return nil, fmt.Errorf("error persisting operation marker: %w", err)
+		}
+		t.persisted.Insert(k)
+	}
+
+	t.active.Add(1)
+	return &Operation{
+		tracker: t,
+		key:     k,
+		resumed: t.interrupted.Has(k),
+	}, nil
+}
+
+// Resumed reports whether a previous attempt of the operation was interrupted or failed.
+// Operations have to clean up partial results of such an attempt.
+func (o *Operation) Resumed() bool {
+	return o != nil && o.resumed
+}
+
+// Done finishes the operation. The resume marker is only removed if err is nil.
+func (o *Operation) Done(err error) {
+	if o == nil {
+		return
+	}
+
+	o.once.Do(func() {
+		t := o.tracker
+		defer t.active.Done()
+
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		if err != nil {
+			t.interrupted.Insert(o.key)
+			return
+		}
+
+		t.interrupted.Delete(o.key)
+		if err := os.Remove(t.markerFile(o.key)); err == nil || errors.Is(err, os.ErrNotExist) {
+			t.persisted.Delete(o.key)
+		}
+	})
+}
+
+// Drain stops accepting new operations and waits until all in-flight operations are done or ctx is done.
+func (t *Tracker) Drain(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	t.draining = true
+	t.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		t.active.Wait()
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("operations still in flight: %w", ctx.Err())
+	}
+}
+
+// Interrupted returns the ids of the interrupted operations of the given kind.
+func (t *Tracker) Interrupted(kind string) []string {
+	if t == nil {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var ids []string
+	for k := range t.interrupted {
+		if k.kind == kind {
+			ids = append(ids, k.id)
+		}
+	}
+	return ids
+}
+
+func (t *Tracker) markerFile(k key) string {
+	return filepath.Join(t.dir, fmt.Sprintf("%s.%s", k.kind, base64.RawURLEncoding.EncodeToString([]byte(k.id))))
+}
+
+func parseMarkerName(name string) (key, error) {
+	kind, encodedID, ok := strings.Cut(name, ".")
+	if !ok {
+		return key{}, fmt.Errorf("invalid marker name %q", name)
+	}
+
+	id, err := base64.RawURLEncoding.DecodeString(encodedID)
+	if err != nil {
+		return key{}, fmt.Errorf("invalid marker name %q: %w", name, err)
+	}
+	return key{kind: kind, id: string(id)}, nil
+}
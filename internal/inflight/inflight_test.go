@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package inflight_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ironcore-dev/libvirt-provider/internal/inflight"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tracker", func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+
+	It("should resume operations interrupted in a previous run", func() {
+		tracker, err := inflight.NewTracker(dir)
+		Expect(err).NotTo(HaveOccurred())
+
+		By("beginning operations and finishing only one of them")
+		pull, err := tracker.Begin(inflight.KindImagePull, "registry.example.org/image:latest")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pull.Resumed()).To(BeFalse())
+		_, err = tracker.Begin(inflight.KindRootFS, "machine-a")
+		Expect(err).NotTo(HaveOccurred())
+		pull.Done(nil)
+
+		By("restarting the tracker")
+		tracker, err = inflight.NewTracker(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tracker.Interrupted(inflight.KindImagePull)).To(BeEmpty())
+		Expect(tracker.Interrupted(inflight.KindRootFS)).To(ConsistOf("machine-a"))
+
+		By("resuming the interrupted operation")
+		rootFS, err := tracker.Begin(inflight.KindRootFS, "machine-a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rootFS.Resumed()).To(BeTrue())
+		rootFS.Done(nil)
+		Expect(tracker.Interrupted(inflight.KindRootFS)).To(BeEmpty())
+		Expect(readDir(dir)).To(BeEmpty())
+	})
+
+	It("should keep the marker of failed operations", func() {
+		tracker, err := inflight.NewTracker(dir)
+		Expect(err).NotTo(HaveOccurred())
+
+		op, err := tracker.Begin(inflight.KindVolumeApply, "machine-a/disk-1")
+		Expect(err).NotTo(HaveOccurred())
+		op.Done(errors.New("failed"))
+
+		op, err = tracker.Begin(inflight.KindVolumeApply, "machine-a/disk-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(op.Resumed()).To(BeTrue())
+		op.Done(nil)
+	})
+
+	It("should only write the marker when an operation begins anew", func() {
+		tracker, err := inflight.NewTracker(dir)
+		Expect(err).NotTo(HaveOccurred())
+
+		op, err := tracker.Begin(inflight.KindVolumeApply, "machine-a/disk-1")
+		Expect(err).NotTo(HaveOccurred())
+		op.Done(errors.New("failed"))
+		Expect(readDir(dir)).To(HaveLen(1))
+
+		By("removing the marker behind the tracker's back")
+		for _, name := range readDir(dir) {
+			Expect(os.Remove(filepath.Join(dir, name))).To(Succeed())
+		}
+
+		By("beginning the operation again without rewriting the marker")
+		op, err = tracker.Begin(inflight.KindVolumeApply, "machine-a/disk-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(readDir(dir)).To(BeEmpty())
+
+		By("writing the marker again once the operation succeeded")
+		op.Done(nil)
+		_, err = tracker.Begin(inflight.KindVolumeApply, "machine-a/disk-1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(readDir(dir)).To(HaveLen(1))
+	})
+
+	It("should wait for in-flight operations when draining", func(ctx SpecContext) {
+		tracker, err := inflight.NewTracker(dir)
+		Expect(err).NotTo(HaveOccurred())
+
+		op, err := tracker.Begin(inflight.KindImagePull, "registry.example.org/image:latest")
+		Expect(err).NotTo(HaveOccurred())
+
+		By("draining with a timeout while the operation is running")
+		timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		Expect(tracker.Drain(timeoutCtx)).To(MatchError(context.DeadlineExceeded))
+
+		By("rejecting new operations")
+		_, err = tracker.Begin(inflight.KindRootFS, "machine-a")
+		Expect(err).To(MatchError(inflight.ErrShuttingDown))
+
+		By("draining after the operation is done")
+		op.Done(nil)
+		Expect(tracker.Drain(ctx)).To(Succeed())
+	})
+
+	It("should track nothing if nil", func(ctx SpecContext) {
+		var tracker *inflight.Tracker
+		op, err := tracker.Begin(inflight.KindRootFS, "machine-a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(op.Resumed()).To(BeFalse())
+		op.Done(nil)
+		Expect(tracker.Drain(ctx)).To(Succeed())
+	})
+})
+
+func readDir(dir string) []string {
+	entries, err := os.ReadDir(dir)
+	Expect(err).NotTo(HaveOccurred())
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
@@ -0,0 +1,240 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ironcore-dev/libvirt-provider/internal/mdev"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// DefaultSysDir is the mount point of sysfs.
+const DefaultSysDir = "/sys"
+
+// Inventory is the hardware of the host as discovered by the provider, along with the resources handed out to
+// machines. It helps to find out why a resource isn't advertised.
+type Inventory struct {
+	CPU               CPUTopology        `json:"cpu"`
+	HugepagePools     []HugepagePool     `json:"hugepagePools,omitempty"`
+	PCIDevices        []PCIDevice        `json:"pciDevices,omitempty"`
+	MdevTypes         []MdevType         `json:"mdevTypes,omitempty"`
+	USBDevices        []USBDevice        `json:"usbDevices,omitempty"`
+	NetworkInterfaces []NetworkInterface `json:"networkInterfaces,omitempty"`
+}
+
+// CPUTopology is the topology of the online cpus of the host.
+type CPUTopology struct {
+	CPUs    int        `json:"cpus"`
+	Sockets int        `json:"sockets"`
+	Cores   int        `json:"cores"`
+	Nodes   []NUMANode `json:"nodes,omitempty"`
+}
+
+// NUMANode is a NUMA node of the host.
+type NUMANode struct {
+	ID int `json:"id"`
+	// CPUs are the cpus of the node as cpu list, e.g. 0-3,8-11.
+	CPUs string `json:"cpus"`
+}
+
+// HugepagePool is the pool of hugepages of a NUMA node machines are bound to.
+type HugepagePool struct {
+	NUMANode       int   `json:"numaNode"`
+	PageSize       int64 `json:"pageSize"`
+	Pages          int64 `json:"pages"`
+	AllocatedBytes int64 `json:"allocatedBytes"`
+}
+
+// PCIDevice is a configured host PCI device.
+type PCIDevice struct {
+	Resource string `json:"resource"`
+	Address  string `json:"address"`
+	// Present reports whether the device exists on the host.
+	Present  bool   `json:"present"`
+	Vendor   string `json:"vendor,omitempty"`
+	Device   string `json:"device,omitempty"`
+	Class    string `json:"class,omitempty"`
+	Driver   string `json:"driver,omitempty"`
+	NUMANode *int   `json:"numaNode,omitempty"`
+	// AllocatedTo is the machine the device is allocated to, if any.
+	AllocatedTo string `json:"allocatedTo,omitempty"`
+}
+
+// MdevType is a mediated device type of a parent device.
+type MdevType struct {
+	mdev.Type
+	// Resource is the resource configured for the type, if any.
+	Resource string `json:"resource,omitempty"`
+	// AllocatedTo are the machines instances of the type are allocated to.
+	AllocatedTo []string `json:"allocatedTo,omitempty"`
+}
+
+// USBDevice is a configured host USB device.
+type USBDevice struct {
+	Resource string `json:"resource"`
+	ID       string `json:"id"`
+	// Present reports whether the device is plugged into the host.
+	Present bool `json:"present"`
+	Bus     uint `json:"bus,omitempty"`
+	Device  uint `json:"device,omitempty"`
+	// AllocatedTo is the machine the device is allocated to, if any.
+	AllocatedTo string `json:"allocatedTo,omitempty"`
+}
+
+// NetworkInterface is a physical network interface of the host.
+type NetworkInterface struct {
+	Name       string `json:"name"`
+	MAC        string `json:"mac,omitempty"`
+	Driver     string `json:"driver,omitempty"`
+	PCIAddress string `json:"pciAddress,omitempty"`
+	NUMANode   *int   `json:"numaNode,omitempty"`
+	OperState  string `json:"operState,omitempty"`
+	// SRIOVTotalVFs and SRIOVNumVFs are the virtual functions supported and enabled.
+	SRIOVTotalVFs int `json:"sriovTotalVFs,omitempty"`
+	SRIOVNumVFs   int `json:"sriovNumVFs,omitempty"`
+}
+
+func readAttribute(dir, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func readIntAttribute(dir, name string) (int, bool) {
+	value, err := strconv.Atoi(readAttribute(dir, name))
+	return value, err == nil
+}
+
+// readNUMANode returns the NUMA node of a device, sysfs reports -1 for devices without node.
+func readNUMANode(dir string) *int {
+	node, ok := readIntAttribute(dir, "numa_node")
+	if !ok || node < 0 {
+		return nil
+	}
+	return &node
+}
+
+// readDriver returns the name of the driver a device is bound to, if any.
+func readDriver(dir string) string {
+	driver, err := os.Readlink(filepath.Join(dir, "driver"))
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(driver)
+}
+
+// ReadCPUTopology reads the topology of the online cpus from sysDir, usually DefaultSysDir.
+func ReadCPUTopology(sysDir string) (CPUTopology, error) {
+	cpuDir := filepath.Join(sysDir, "devices", "system", "cpu")
+	entries, err := os.ReadDir(cpuDir)
+	if err != nil {
+		return CPUTopology{}, fmt.Errorf("error reading cpus: %w", err)
+	}
+
+	var topology CPUTopology
+	sockets, cores := sets.New[int](), sets.New[[2]int]()
+	for _, entry := range entries {
+		idValue, ok := strings.CutPrefix(entry.Name(), "cpu")
+		if !ok {
+			continue
+		}
+		if _, err := strconv.Atoi(idValue); err != nil {
+			continue
+		}
+		dir := filepath.Join(cpuDir, entry.Name())
+		// cpu0 usually has no online file as it can't be taken offline.
+		if online, ok := readIntAttribute(dir, "online"); ok && online == 0 {
+			continue
+		}
+
+		topology.CPUs++
+		socket, _ := readIntAttribute(dir, filepath.Join("topology", "physical_package_id"))
+		core, _ := readIntAttribute(dir, filepath.Join("topology", "core_id"))
+		sockets.Insert(socket)
+		cores.Insert([2]int{socket, core})
+	}
+	topology.Sockets, topology.Cores = sockets.Len(), cores.Len()
+
+	nodeDir := filepath.Join(sysDir, "devices", "system", "node")
+	nodes, err := os.ReadDir(nodeDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return CPUTopology{}, fmt.Errorf("error reading numa nodes: %w", err)
+	}
+	for _, entry := range nodes {
+		idValue, ok := strings.CutPrefix(entry.Name(), "node")
+		if !ok {
+			continue
+		}
+		id, err := strconv.Atoi(idValue)
+		if err != nil {
+			continue
+		}
+		topology.Nodes = append(topology.Nodes, NUMANode{ID: id, CPUs: readAttribute(filepath.Join(nodeDir, entry.Name()), "cpulist")})
+	}
+	slices.SortFunc(topology.Nodes, func(a, b NUMANode) int { return a.ID - b.ID })
+	return topology, nil
+}
+
+// ReadPCIDevice fills in the details of the PCI device from sysDir, usually DefaultSysDir. Devices missing on
+// the host are reported as not present.
+func ReadPCIDevice(sysDir string, device PCIDevice) PCIDevice {
+	dir := filepath.Join(sysDir, "bus", "pci", "devices", device.Address)
+	if _, err := os.Stat(dir); err != nil {
+		device.Present = false
+		return device
+	}
+
+	device.Present = true
+	device.Vendor = readAttribute(dir, "vendor")
+	device.Device = readAttribute(dir, "device")
+	device.Class = readAttribute(dir, "class")
+	device.Driver = readDriver(dir)
+	device.NUMANode = readNUMANode(dir)
+	return device
+}
+
+// ReadNetworkInterfaces reads the network interfaces of the host backed by a device from sysDir, usually
+// DefaultSysDir. Virtual interfaces like bridges and taps are left out.
+func ReadNetworkInterfaces(sysDir string) ([]NetworkInterface, error) {
+	netDir := filepath.Join(sysDir, "class", "net")
+	entries, err := os.ReadDir(netDir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading network interfaces: %w", err)
+	}
+
+	var nics []NetworkInterface
+	for _, entry := range entries {
+		dir := filepath.Join(netDir, entry.Name())
+		deviceDir := filepath.Join(dir, "device")
+		device, err := filepath.EvalSymlinks(deviceDir)
+		if err != nil {
+			continue
+		}
+
+		nic := NetworkInterface{
+			Name:      entry.Name(),
+			MAC:       readAttribute(dir, "address"),
+			OperState: readAttribute(dir, "operstate"),
+			Driver:    readDriver(deviceDir),
+			NUMANode:  readNUMANode(deviceDir),
+		}
+		// Only PCI devices have a vendor attribute.
+		if readAttribute(deviceDir, "vendor") != "" {
+			nic.PCIAddress = filepath.Base(device)
+		}
+		nic.SRIOVTotalVFs, _ = readIntAttribute(deviceDir, "sriov_totalvfs")
+		nic.SRIOVNumVFs, _ = readIntAttribute(deviceDir, "sriov_numvfs")
+		nics = append(nics, nic)
+	}
+	return nics, nil
+}
@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package inventory_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/ironcore-dev/libvirt-provider/internal/inventory"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/ptr"
+)
+
+var _ = Describe("Inventory", func() {
+	var dir string
+
+	writeFile := func(name, data string) {
+		GinkgoHelper()
+		name = filepath.Join(dir, name)
+		Expect(os.MkdirAll(filepath.Dir(name), 0777)).To(Succeed())
+		Expect(os.WriteFile(name, []byte(data+"\n"), 0666)).To(Succeed())
+	}
+
+	symlink := func(target, name string) {
+		GinkgoHelper()
+		name = filepath.Join(dir, name)
+		Expect(os.MkdirAll(filepath.Dir(name), 0777)).To(Succeed())
+		Expect(os.Symlink(filepath.Join(dir, target), name)).To(Succeed())
+	}
+
+	writeCPU := func(name, online, socket, core string) {
+		GinkgoHelper()
+		if online != "" {
+			writeFile(filepath.Join("devices", "system", "cpu", name, "online"), online)
+		}
+		writeFile(filepath.Join("devices", "system", "cpu", name, "topology", "physical_package_id"), socket)
+		writeFile(filepath.Join("devices", "system", "cpu", name, "topology", "core_id"), core)
+	}
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+
+	It("should read the topology of the online cpus", func() {
+		writeCPU("cpu0", "", "0", "0")
+		writeCPU("cpu1", "1", "0", "0")
+		writeCPU("cpu2", "1", "1", "0")
+		writeCPU("cpu3", "0", "1", "1")
+		writeFile(filepath.Join("devices", "system", "cpu", "online"), "0-2")
+		writeFile(filepath.Join("devices", "system", "node", "node1", "cpulist"), "2-3")
+		writeFile(filepath.Join("devices", "system", "node", "node0", "cpulist"), "0-1")
+
+		Expect(inventory.ReadCPUTopology(dir)).To(Equal(inventory.CPUTopology{
+			CPUs:    3,
+			Sockets: 2,
+			Cores:   2,
+			Nodes: []inventory.NUMANode{
+				{ID: 0, CPUs: "0-1"},
+				{ID: 1, CPUs: "2-3"},
+			},
+		}))
+	})
+
+	It("should read pci devices and report missing ones", func() {
+		deviceDir := filepath.Join("bus", "pci", "devices", "0000:65:00.0")
+		writeFile(filepath.Join(deviceDir, "vendor"), "0x10de")
+		writeFile(filepath.Join(deviceDir, "device"), "0x1eb8")
+		writeFile(filepath.Join(deviceDir, "class"), "0x030200")
+		writeFile(filepath.Join(deviceDir, "numa_node"), "1")
+		symlink(filepath.Join("bus", "pci", "drivers", "vfio-pci"), filepath.Join(deviceDir, "driver"))
+
+		Expect(inventory.ReadPCIDevice(dir, inventory.PCIDevice{Resource: "nvidia.com/gpu", Address: "0000:65:00.0"})).To(Equal(inventory.PCIDevice{
+			Resource: "nvidia.com/gpu",
+			Address:  "0000:65:00.0",
+			Present:  true,
+			Vendor:   "0x10de",
+			Device:   "0x1eb8",
+			Class:    "0x030200",
+			Driver:   "vfio-pci",
+			NUMANode: ptr.To(1),
+		}))
+		Expect(inventory.ReadPCIDevice(dir, inventory.PCIDevice{Address: "0000:66:00.0"})).To(HaveField("Present", false))
+	})
+
+	It("should read the network interfaces backed by a device", func() {
+		deviceDir := filepath.Join("devices", "pci0000:00", "0000:3b:00.0")
+		writeFile(filepath.Join(deviceDir, "vendor"), "0x15b3")
+		writeFile(filepath.Join(deviceDir, "numa_node"), "-1")
+		writeFile(filepath.Join(deviceDir, "sriov_totalvfs"), "8")
+		writeFile(filepath.Join(deviceDir, "sriov_numvfs"), "2")
+		symlink(filepath.Join("bus", "pci", "drivers", "mlx5_core"), filepath.Join(deviceDir, "driver"))
+		writeFile(filepath.Join("class", "net", "eth0", "address"), "0c:42:a1:00:00:01")
+		writeFile(filepath.Join("class", "net", "eth0", "operstate"), "up")
+		symlink(deviceDir, filepath.Join("class", "net", "eth0", "device"))
+		writeFile(filepath.Join("class", "net", "br0", "address"), "0c:42:a1:00:00:02")
+
+		Expect(inventory.ReadNetworkInterfaces(dir)).To(Equal([]inventory.NetworkInterface{{
+			Name:          "eth0",
+			MAC:           "0c:42:a1:00:00:01",
+			Driver:        "mlx5_core",
+			PCIAddress:    "0000:3b:00.0",
+			OperState:     "up",
+			SRIOVTotalVFs: 8,
+			SRIOVNumVFs:   2,
+		}}))
+	})
+})
@@ -0,0 +1,194 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package guest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/digitalocean/go-libvirt"
+	libvirtutils "github.com/ironcore-dev/libvirt-provider/internal/libvirt/utils"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"libvirt.org/go/libvirtxml"
+)
+
+// FeatureProfile is a named set of libvirt domain features applied to the domains of its machine classes.
+type FeatureProfile struct {
+	Name string `json:"name"`
+	// MachineClasses are the machine classes whose domains get the features of the profile.
+	MachineClasses []string `json:"machineClasses"`
+	// Features is the libvirt <features> element of the profile, e.g.
+	// <features><hyperv mode="custom"><relaxed state="on"/></hyperv></features>.
+	Features string `json:"features"`
+}
+
+func LoadFeatureProfiles(reader io.Reader) ([]FeatureProfile, error) {
+	var profiles []FeatureProfile
+	if err := yaml.NewYAMLOrJSONDecoder(reader, 4096).Decode(&profiles); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal feature profiles: %w", err)
+	}
+
+	return profiles, nil
+}
+
+func LoadFeatureProfilesFile(filename string) ([]FeatureProfile, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open feature profile file (%s): %w", filename, err)
+	}
+	defer file.Close()
+
+	return LoadFeatureProfiles(file)
+}
+
+// DetectDomainCapabilities gets the capabilities of the domains created for the given requests.
+func DetectDomainCapabilities(lv libvirtutils.Client, caps Capabilities, reqs Requests) (*libvirtxml.DomainCaps, error) {
+	settings, err := caps.SettingsFor(reqs)
+	if err != nil {
+		return nil, err
+	}
+
+	domainCapsData, err := lv.ConnectGetDomainCapabilities(
+		nil,
+		libvirt.OptString{reqs.Architecture},
+		libvirt.OptString{settings.Machine},
+		libvirt.OptString{settings.Type},
+		0,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error getting domain capabilities: %w", err)
+	}
+
+	var domainCaps libvirtxml.DomainCaps
+	if err := xml.Unmarshal([]byte(domainCapsData), &domainCaps); err != nil {
+		return nil, fmt.Errorf("error unmarshalling domain capabilities: %w", err)
+	}
+	return &domainCaps, nil
+}
+
+// FeatureProfiles are the feature profiles by machine class.
+type FeatureProfiles struct {
+	byMachineClass map[string]*featureProfile
+}
+
+type featureProfile struct {
+	name     string
+	features *libvirtxml.DomainFeatureList
+}
+
+// NewFeatureProfiles validates the profiles against the domain capabilities. Every machine class may have
+// at most one profile.
+func NewFeatureProfiles(profiles []FeatureProfile, domainCaps *libvirtxml.DomainCaps) (*FeatureProfiles, error) {
+	registry := FeatureProfiles{
+		byMachineClass: map[string]*featureProfile{},
+	}
+
+	names := map[string]struct{}{}
+	for _, profile := range profiles {
+		if profile.Name == "" {
+			return nil, fmt.Errorf("feature profile without name found")
+		}
+		if _, ok := names[profile.Name]; ok {
+			return nil, fmt.Errorf("multiple feature profiles with same name (%s) found", profile.Name)
+		}
+		names[profile.Name] = struct{}{}
+
+		features := &libvirtxml.DomainFeatureList{}
+		if err := xml.Unmarshal([]byte(profile.Features), features); err != nil {
+			return nil, fmt.Errorf("invalid features of feature profile %s: %w", profile.Name, err)
+		}
+		if err := validateFeatures(features, domainCaps); err != nil {
+			return nil, fmt.Errorf("feature profile %s is not supported: %w", profile.Name, err)
+		}
+
+		for _, class := range profile.MachineClasses {
+			if other, ok := registry.byMachineClass[class]; ok {
+				return nil, fmt.Errorf("machine class %s has multiple feature profiles (%s, %s)", class, other.name, profile.Name)
+			}
+			registry.byMachineClass[class] = &featureProfile{name: profile.Name, features: features}
+		}
+	}
+
+	return &registry, nil
+}
+
+// ForMachineClass returns the name and features of the profile of the machine class.
+// The features must not be modified.
+func (p *FeatureProfiles) ForMachineClass(class string) (string, *libvirtxml.DomainFeatureList, bool) {
+	profile, ok := p.byMachineClass[class]
+	if !ok {
+		return "", nil, false
+	}
+	return profile.name, profile.features, true
+}
+
+// validateFeatures checks the Hyper-V enlightenments of the features, being the features whose support
+// libvirt reports in the domain capabilities.
+func validateFeatures(features *libvirtxml.DomainFeatureList, domainCaps *libvirtxml.DomainCaps) error {
+	if features.HyperV == nil {
+		return nil
+	}
+
+	var hypervCaps *libvirtxml.DomainCapsFeatureHyperV
+	if domainCaps != nil && domainCaps.Features != nil {
+		hypervCaps = domainCaps.Features.HyperV
+	}
+	if hypervCaps == nil || hypervCaps.Supported != "yes" {
+		return fmt.Errorf("hyperv enlightenments are not supported")
+	}
+
+	var supported []string
+	for _, enum := range hypervCaps.Enums {
+		if enum.Name == "features" {
+			supported = enum.Values
+		}
+	}
+	for _, name := range enabledHyperVFeatures(features.HyperV) {
+		if !slices.Contains(supported, name) {
+			return fmt.Errorf("hyperv enlightenment %s is not supported", name)
+		}
+	}
+	return nil
+}
+
+// enabledHyperVFeatures returns the names, as used by the domain capabilities, of the enabled enlightenments.
+func enabledHyperVFeatures(hyperv *libvirtxml.DomainFeatureHyperV) []string {
+	states := map[string]*libvirtxml.DomainFeatureState{
+		"relaxed":         hyperv.Relaxed,
+		"vapic":           hyperv.VAPIC,
+		"vpindex":         hyperv.VPIndex,
+		"runtime":         hyperv.Runtime,
+		"synic":           hyperv.Synic,
+		"reset":           hyperv.Reset,
+		"frequencies":     hyperv.Frequencies,
+		"reenlightenment": hyperv.ReEnlightenment,
+		"tlbflush":        hyperv.TLBFlush,
+		"ipi":             hyperv.IPI,
+		"evmcs":           hyperv.EVMCS,
+		"avic":            hyperv.AVIC,
+		"emsr_bitmap":     hyperv.EMSRBitmap,
+		"xmm_input":       hyperv.XMMInput,
+	}
+	if hyperv.Spinlocks != nil {
+		states["spinlocks"] = &hyperv.Spinlocks.DomainFeatureState
+	}
+	if hyperv.STimer != nil {
+		states["stimer"] = &hyperv.STimer.DomainFeatureState
+	}
+	if hyperv.VendorId != nil {
+		states["vendor_id"] = &hyperv.VendorId.DomainFeatureState
+	}
+
+	var names []string
+	for name, state := range states {
+		if state != nil && state.State == "on" {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
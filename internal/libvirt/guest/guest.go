@@ -9,7 +9,7 @@ import (
 	"regexp"
 	"strconv"
 
-	"github.com/digitalocean/go-libvirt"
+	libvirtutils "github.com/ironcore-dev/libvirt-provider/internal/libvirt/utils"
 	"libvirt.org/go/libvirtxml"
 )
 
@@ -31,10 +31,13 @@ type Settings struct {
 
 type Capabilities interface {
 	SettingsFor(reqs Requests) (*Settings, error)
+	// HostArchitecture returns the cpu architecture of the host, e.g. x86_64.
+	HostArchitecture() string
 }
 
 type capabilties struct {
-	caps []libvirtxml.CapsGuest
+	caps     []libvirtxml.CapsGuest
+	hostArch string
 
 	preferredDomainTypes  []string
 	preferredMachineTypes []string
@@ -161,6 +164,10 @@ func (m *MachineTypeVersion) String() string {
 	return fmt.Sprintf("%d.%d", m.Major, m.Minor)
 }
 
+func (c *capabilties) HostArchitecture() string {
+	return c.hostArch
+}
+
 func (c *capabilties) SettingsFor(reqs Requests) (*Settings, error) {
 	if reqs.Architecture == "" {
 		return nil, fmt.Errorf("must specify Requests.Architecture")
@@ -220,7 +227,7 @@ type CapabilitiesOptions struct {
 }
 
 // DetectCapabilities
-func DetectCapabilities(lv *libvirt.Libvirt, opts CapabilitiesOptions) (Capabilities, error) {
+func DetectCapabilities(lv libvirtutils.Client, opts CapabilitiesOptions) (Capabilities, error) {
 	capsData, err := lv.Capabilities()
 	if err != nil {
 		return nil, fmt.Errorf("error getting capabilities: %w", err)
@@ -231,8 +238,14 @@ func DetectCapabilities(lv *libvirt.Libvirt, opts CapabilitiesOptions) (Capabili
 		return nil, fmt.Errorf("error unmarshalling guest capabilities: %w", err)
 	}
 
+	var hostArch string
+	if caps.Host.CPU != nil {
+		hostArch = caps.Host.CPU.Arch
+	}
+
 	return &capabilties{
 		caps:                  caps.Guests,
+		hostArch:              hostArch,
 		preferredDomainTypes:  opts.PreferredDomainTypes,
 		preferredMachineTypes: opts.PreferredMachineTypes,
 	}, nil
@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package guest_test
+
+import (
+	"strings"
+
+	"github.com/ironcore-dev/libvirt-provider/internal/libvirt/guest"
+	"github.com/ironcore-dev/libvirt-provider/pkg/libvirt/fake"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"libvirt.org/go/libvirtxml"
+)
+
+var _ = Describe("Guest", func() {
+	var lv *fake.Libvirt
+
+	BeforeEach(func() {
+		lv = fake.SetupLibvirt()
+	})
+
+	It("should detect guest capabilities", func() {
+		caps, err := guest.DetectCapabilities(lv, guest.CapabilitiesOptions{
+			PreferredDomainTypes:  []string{"kvm", "qemu"},
+			PreferredMachineTypes: []string{"pc-q35"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		settings, err := caps.SettingsFor(guest.Requests{Architecture: "x86_64", OSType: guest.OSTypeHVM})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(settings).To(Equal(&guest.Settings{Type: "kvm", Machine: "pc-q35-8.2"}))
+		Expect(caps.HostArchitecture()).To(Equal("x86_64"))
+	})
+
+	It("should validate feature profiles against the domain capabilities", func() {
+		caps, err := guest.DetectCapabilities(lv, guest.CapabilitiesOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		domainCaps, err := guest.DetectDomainCapabilities(lv, caps, guest.Requests{Architecture: caps.HostArchitecture(), OSType: guest.OSTypeHVM})
+		Expect(err).NotTo(HaveOccurred())
+
+		By("loading a supported profile")
+		profiles, err := guest.LoadFeatureProfiles(strings.NewReader(`
+- name: windows
+  machineClasses: [x3-xlarge]
+  features: |
+    <features>
+      <hyperv mode="custom">
+        <relaxed state="on"/>
+        <stimer state="on"/>
+      </hyperv>
+    </features>
+`))
+		Expect(err).NotTo(HaveOccurred())
+		featureProfiles, err := guest.NewFeatureProfiles(profiles, domainCaps)
+		Expect(err).NotTo(HaveOccurred())
+
+		name, features, ok := featureProfiles.ForMachineClass("x3-xlarge")
+		Expect(ok).To(BeTrue())
+		Expect(name).To(Equal("windows"))
+		Expect(features.HyperV.Relaxed).To(Equal(&libvirtxml.DomainFeatureState{State: "on"}))
+		_, _, ok = featureProfiles.ForMachineClass("x2-medium")
+		Expect(ok).To(BeFalse())
+
+		By("rejecting an unsupported enlightenment")
+		_, err = guest.NewFeatureProfiles([]guest.FeatureProfile{{
+			Name:     "evmcs",
+			Features: `<features><hyperv mode="custom"><evmcs state="on"/></hyperv></features>`,
+		}}, domainCaps)
+		Expect(err).To(MatchError(ContainSubstring("evmcs is not supported")))
+
+		By("rejecting machine classes with multiple profiles")
+		_, err = guest.NewFeatureProfiles([]guest.FeatureProfile{
+			{Name: "a", MachineClasses: []string{"x3-xlarge"}, Features: "<features/>"},
+			{Name: "b", MachineClasses: []string{"x3-xlarge"}, Features: "<features/>"},
+		}, domainCaps)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -5,12 +5,39 @@ package meta
 
 import (
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
 	"strings"
+
+	"libvirt.org/go/libvirtxml"
 )
 
+// Namespace is the XML namespace of the metadata libvirt-provider writes into domains.
+const Namespace = "https://github.com/ironcore-dev/libvirt-provider"
+
 type LibvirtProviderMetadata struct {
 	IRIMmachineLabels string `xml:"irimachinelabels"`
+	// Machine identifies the ironcore machine of the domain.
+	Machine *MachineMetadata
+	// Labels are the downward api labels of the ironcore machine.
+	Labels []MachineLabel
+	// Annotations are the downward api annotations of the ironcore machine. Unlike the labels, they are
+	// updated while the domain exists.
+	Annotations []MachineLabel
+}
+
+type MachineMetadata struct {
+	Namespace string `xml:"namespace,attr"`
+	Name      string `xml:"name,attr"`
+	UID       string `xml:"uid,attr"`
+	// Class is the machine class of the machine at the creation of the domain.
+	Class string `xml:"class,attr,omitempty"`
+}
+
+type MachineLabel struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:"value,attr"`
 }
 
 // Since go does not support XML namespaces easily (see https://github.com/golang/go/issues/9519),
@@ -19,10 +46,18 @@ type LibvirtProviderMetadata struct {
 
 func (m *LibvirtProviderMetadata) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 	start.Name.Local = "libvirtprovider:metadata"
-	return e.EncodeElement(&marshalMetadata{
-		XMLNS:             "https://github.com/ironcore-dev/libvirt-provider",
+	metadata := &marshalMetadata{
+		XMLNS:             Namespace,
 		IRIMmachineLabels: m.IRIMmachineLabels,
-	}, start)
+		Machine:           m.Machine,
+	}
+	if len(m.Labels) > 0 {
+		metadata.Labels = &marshalLabels{Labels: m.Labels}
+	}
+	if len(m.Annotations) > 0 {
+		metadata.Annotations = &marshalAnnotations{Annotations: m.Annotations}
+	}
+	return e.EncodeElement(metadata, start)
 }
 
 func (m *LibvirtProviderMetadata) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
@@ -32,18 +67,71 @@ func (m *LibvirtProviderMetadata) UnmarshalXML(d *xml.Decoder, start xml.StartEl
 	}
 
 	m.IRIMmachineLabels = unmarshal.IRIMmachineLabels
+	m.Machine = unmarshal.Machine
+	m.Labels = unmarshal.Labels
+	m.Annotations = unmarshal.Annotations
 	return nil
 }
 
 type marshalMetadata struct {
-	XMLName           xml.Name `xml:"libvirtprovider:metadata"`
-	XMLNS             string   `xml:"xmlns:libvirtprovider,attr"`
-	IRIMmachineLabels string   `xml:"libvirtprovider:irimachinelabels"`
+	XMLName           xml.Name            `xml:"libvirtprovider:metadata"`
+	XMLNS             string              `xml:"xmlns:libvirtprovider,attr"`
+	IRIMmachineLabels string              `xml:"libvirtprovider:irimachinelabels"`
+	Machine           *MachineMetadata    `xml:"libvirtprovider:machine,omitempty"`
+	Labels            *marshalLabels      `xml:"libvirtprovider:labels,omitempty"`
+	Annotations       *marshalAnnotations `xml:"libvirtprovider:annotations,omitempty"`
+}
+
+type marshalLabels struct {
+	Labels []MachineLabel `xml:"libvirtprovider:label"`
+}
+
+type marshalAnnotations struct {
+	Annotations []MachineLabel `xml:"libvirtprovider:annotation"`
 }
 
 type unmarshalMetadata struct {
-	XMLName           xml.Name `xml:"metadata"`
-	IRIMmachineLabels string   `xml:"irimachinelabels"`
+	XMLName           xml.Name         `xml:"metadata"`
+	IRIMmachineLabels string           `xml:"irimachinelabels"`
+	Machine           *MachineMetadata `xml:"machine"`
+	Labels            []MachineLabel   `xml:"labels>label"`
+	Annotations       []MachineLabel   `xml:"annotations>annotation"`
+}
+
+// FromDomain parses the libvirt-provider metadata of the domain, next to which the domain may have metadata of
+// other applications. It returns false if the domain has no libvirt-provider metadata.
+func FromDomain(domain *libvirtxml.Domain) (*LibvirtProviderMetadata, bool, error) {
+	if domain.Metadata == nil {
+		return nil, false, nil
+	}
+
+	d := xml.NewDecoder(strings.NewReader(domain.Metadata.XML))
+	for {
+		token, err := d.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, false, nil
+			}
+			return nil, false, fmt.Errorf("error parsing domain metadata: %w", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if start.Name.Space != Namespace || start.Name.Local != "metadata" {
+			if err := d.Skip(); err != nil {
+				return nil, false, fmt.Errorf("error parsing domain metadata: %w", err)
+			}
+			continue
+		}
+
+		metadata := &LibvirtProviderMetadata{}
+		if err := d.DecodeElement(metadata, &start); err != nil {
+			return nil, false, fmt.Errorf("error parsing libvirt-provider metadata: %w", err)
+		}
+		return metadata, true, nil
+	}
 }
 
 func IRIMachineLabelsEncoder(data map[string]string) string {
@@ -9,6 +9,7 @@ import (
 	. "github.com/ironcore-dev/libvirt-provider/internal/libvirt/meta"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"libvirt.org/go/libvirtxml"
 )
 
 const libvirtProviderURL = "https://github.com/ironcore-dev/libvirt-provider"
@@ -50,6 +51,38 @@ var _ = Describe("LibvirtProviderMetadata", func() {
 		})
 	})
 
+	Context("FromDomain", func() {
+		It("parses the machine, labels and annotations next to metadata of other applications", func() {
+			metadata := &LibvirtProviderMetadata{
+				Machine: &MachineMetadata{Namespace: "default", Name: "foo", UID: "test-uid"},
+				Labels: []MachineLabel{
+					{Key: "downward-api.machinepoollet.ironcore.dev/root-machine-name", Value: "root-test-name"},
+				},
+				Annotations: []MachineLabel{
+					{Key: "downward-api.machinepoollet.ironcore.dev/owner", Value: "team-a"},
+				},
+			}
+			data, err := xml.Marshal(metadata)
+			Expect(err).NotTo(HaveOccurred())
+
+			domain := &libvirtxml.Domain{
+				Metadata: &libvirtxml.DomainMetadata{
+					XML: `<libosinfo:libosinfo xmlns:libosinfo="http://libosinfo.org/xmlns/libvirt/domain/1.0"><libosinfo:os id="http://microsoft.com/win/11"/></libosinfo:libosinfo>` + string(data),
+				},
+			}
+			parsed, ok, err := FromDomain(domain)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(parsed).To(Equal(metadata))
+		})
+
+		It("reports domains without libvirt-provider metadata", func() {
+			_, ok, err := FromDomain(&libvirtxml.Domain{})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		})
+	})
+
 	Context("IRIMachineLabelsEncoder", func() {
 		It("encodes IRIMachineLabels correctly when labels are populated", func() {
 			labels := map[string]string{
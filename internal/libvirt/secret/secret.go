@@ -0,0 +1,57 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package secret
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/google/uuid"
+	libvirtutils "github.com/ironcore-dev/libvirt-provider/internal/libvirt/utils"
+	"libvirt.org/go/libvirtxml"
+)
+
+// VolumeUUID returns the UUID of the secret holding the credentials of a volume of a domain.
+func VolumeUUID(domainUUID, computeVolumeName string) string {
+	return uuid.NewHash(sha256.New(), uuid.Nil, []byte(fmt.Sprintf("%s/%s", domainUUID, computeVolumeName)), 5).String()
+}
+
+// VolumeEncryptionUUID returns the UUID of the secret holding the encryption key of a volume of a domain.
+func VolumeEncryptionUUID(domainUUID, computeVolumeName string) string {
+	return uuid.NewHash(sha256.New(), uuid.Nil, []byte(fmt.Sprintf("enc/%s/%s", domainUUID, computeVolumeName)), 5).String()
+}
+
+// Manager maintains the libvirt secrets volumes reference by UUID in their disk definition.
+type Manager struct {
+	libvirt libvirtutils.Client
+}
+
+func NewManager(lv libvirtutils.Client) *Manager {
+	return &Manager{libvirt: lv}
+}
+
+// Apply defines the secret if it does not exist yet and sets its value.
+// Applying a secret again with a new value rotates it.
+func (m *Manager) Apply(secret *libvirtxml.Secret, value []byte) error {
+	return libvirtutils.ApplySecret(m.libvirt, secret, value)
+}
+
+// Delete removes the secret with the given UUID. Missing secrets are ignored.
+func (m *Manager) Delete(secretUUID string) error {
+	if err := m.libvirt.SecretUndefine(libvirt.Secret{
+		UUID: libvirtutils.UUIDStringToBytes(secretUUID),
+	}); libvirtutils.IgnoreErrorCode(err, libvirt.ErrNoSecret) != nil {
+		return fmt.Errorf("error deleting secret %s: %w", secretUUID, err)
+	}
+	return nil
+}
+
+// DeleteVolumeSecrets removes all secrets of a volume of a domain.
+func (m *Manager) DeleteVolumeSecrets(domainUUID, computeVolumeName string) error {
+	if err := m.Delete(VolumeUUID(domainUUID, computeVolumeName)); err != nil {
+		return err
+	}
+	return m.Delete(VolumeEncryptionUUID(domainUUID, computeVolumeName))
+}
@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package secret_test
+
+import (
+	"github.com/google/uuid"
+	"github.com/ironcore-dev/libvirt-provider/internal/libvirt/secret"
+	"github.com/ironcore-dev/libvirt-provider/pkg/libvirt/fake"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"libvirt.org/go/libvirtxml"
+)
+
+var _ = Describe("Manager", func() {
+	var (
+		lv      *fake.Libvirt
+		manager *secret.Manager
+	)
+
+	BeforeEach(func() {
+		lv = fake.SetupLibvirt()
+		manager = secret.NewManager(lv)
+	})
+
+	It("should apply, rotate and delete volume secrets", func() {
+		domainUUID := uuid.NewString()
+		secretUUID := secret.VolumeUUID(domainUUID, "disk-1")
+		Expect(secretUUID).NotTo(Equal(secret.VolumeEncryptionUUID(domainUUID, "disk-1")))
+
+		By("applying the secret")
+		desc := &libvirtxml.Secret{
+			UUID:  secretUUID,
+			Usage: &libvirtxml.SecretUsage{Type: "ceph", Name: "disk-1 secret"},
+		}
+		Expect(manager.Apply(desc, []byte("key-1"))).To(Succeed())
+		value, ok := lv.Secret(secretUUID)
+		Expect(ok).To(BeTrue())
+		Expect(value).To(Equal([]byte("key-1")))
+
+		By("rotating the secret")
+		Expect(manager.Apply(desc, []byte("key-2"))).To(Succeed())
+		value, _ = lv.Secret(secretUUID)
+		Expect(value).To(Equal([]byte("key-2")))
+
+		By("deleting the volume secrets")
+		Expect(manager.DeleteVolumeSecrets(domainUUID, "disk-1")).To(Succeed())
+		_, ok = lv.Secret(secretUUID)
+		Expect(ok).To(BeFalse())
+
+		By("deleting them again")
+		Expect(manager.DeleteVolumeSecrets(domainUUID, "disk-1")).To(Succeed())
+	})
+})
@@ -0,0 +1,52 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"context"
+
+	"github.com/digitalocean/go-libvirt"
+)
+
+// Client is the subset of the libvirt API used by libvirt-provider.
+// It is implemented by *libvirt.Libvirt and by the in-memory fake in pkg/libvirt/fake.
+type Client interface {
+	IsConnected() bool
+	Capabilities() ([]byte, error)
+	ConnectGetDomainCapabilities(emulatorbin, arch, machine, virttype libvirt.OptString, flags uint32) (string, error)
+	LifecycleEvents(ctx context.Context) (<-chan libvirt.DomainEventLifecycleMsg, error)
+	SubscribeEvents(ctx context.Context, eventID libvirt.DomainEventID, dom libvirt.OptDomain) (<-chan any, error)
+
+	ConnectListAllDomains(needResults int32, flags libvirt.ConnectListAllDomainsFlags) ([]libvirt.Domain, uint32, error)
+	DomainLookupByUUID(uuid libvirt.UUID) (libvirt.Domain, error)
+	DomainCreateXML(xmlDesc string, flags libvirt.DomainCreateFlags) (libvirt.Domain, error)
+	DomainCreate(dom libvirt.Domain) error
+	DomainDefineXMLFlags(xml string, flags libvirt.DomainDefineFlags) (libvirt.Domain, error)
+	DomainUndefineFlags(dom libvirt.Domain, flags libvirt.DomainUndefineFlagsValues) error
+	DomainIsPersistent(dom libvirt.Domain) (int32, error)
+	DomainGetAutostart(dom libvirt.Domain) (int32, error)
+	DomainSetAutostart(dom libvirt.Domain, autostart int32) error
+	DomainGetXMLDesc(dom libvirt.Domain, flags libvirt.DomainXMLFlags) (string, error)
+	DomainGetState(dom libvirt.Domain, flags uint32) (int32, int32, error)
+	DomainShutdownFlags(dom libvirt.Domain, flags libvirt.DomainShutdownFlagValues) error
+	DomainDestroyFlags(dom libvirt.Domain, flags libvirt.DomainDestroyFlagsValues) error
+	DomainManagedSave(dom libvirt.Domain, flags uint32) error
+	DomainHasManagedSaveImage(dom libvirt.Domain, flags uint32) (int32, error)
+	DomainAttachDevice(dom libvirt.Domain, xml string) error
+	DomainDetachDevice(dom libvirt.Domain, xml string) error
+	DomainBlockResize(dom libvirt.Domain, disk string, size uint64, flags libvirt.DomainBlockResizeFlags) error
+	DomainSetVcpusFlags(dom libvirt.Domain, nvcpus uint32, flags uint32) error
+	DomainSetSchedulerParametersFlags(dom libvirt.Domain, params []libvirt.TypedParam, flags uint32) error
+	DomainSetMetadata(dom libvirt.Domain, typ int32, metadata, key, uri libvirt.OptString, flags libvirt.DomainModificationImpact) error
+	QEMUDomainAgentCommand(dom libvirt.Domain, cmd string, timeout int32, flags uint32) (libvirt.OptString, error)
+	NodeGetSevInfo(nparams int32, flags uint32) ([]libvirt.TypedParam, int32, error)
+	DomainGetLaunchSecurityInfo(dom libvirt.Domain, flags uint32) ([]libvirt.TypedParam, error)
+
+	SecretLookupByUUID(uuid libvirt.UUID) (libvirt.Secret, error)
+	SecretDefineXML(xml string, flags uint32) (libvirt.Secret, error)
+	SecretSetValue(secret libvirt.Secret, value []byte, flags uint32) error
+	SecretUndefine(secret libvirt.Secret) error
+}
+
+var _ Client = (*libvirt.Libvirt)(nil)
@@ -0,0 +1,127 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// DefaultReconnectInitialBackoff is the default delay of the first retry to reconnect to libvirt.
+	DefaultReconnectInitialBackoff = 1 * time.Second
+	// DefaultReconnectMaxBackoff is the default maximum delay of retries to reconnect to libvirt.
+	DefaultReconnectMaxBackoff = 1 * time.Minute
+)
+
+var (
+	connected = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "libvirt_provider_libvirt_connected",
+		Help: "Whether the provider is connected to libvirt (1) or not (0).",
+	})
+	reconnects = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "libvirt_provider_libvirt_reconnects_total",
+			Help: "Number of attempts to reconnect to libvirt, partitioned by result (success or error).",
+		},
+		[]string{"result"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(connected, reconnects)
+}
+
+// ConnectionOptions configure the reconnects of a ConnectionManager.
+type ConnectionOptions struct {
+	// InitialBackoff is the delay of the first retry to reconnect, doubled on every further failure.
+	// Defaults to DefaultReconnectInitialBackoff.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay of retries to reconnect. Defaults to DefaultReconnectMaxBackoff.
+	MaxBackoff time.Duration
+}
+
+// ConnectionManager keeps a libvirt client connected: it detects broken connections and reconnects the
+// client with exponential backoff. Users of the client check Client.IsConnected to pause while disconnected,
+// event subscriptions have to be renewed after a reconnect.
+type ConnectionManager struct {
+	lv             *libvirt.Libvirt
+	uri            string
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+// NewConnectionManager creates a ConnectionManager for the connected client lv. The uri is the one lv was
+// connected to by Connect, it may be empty to probe the well known connect URIs again.
+func NewConnectionManager(lv *libvirt.Libvirt, uri string, opts ConnectionOptions) (*ConnectionManager, error) {
+	if opts.InitialBackoff == 0 {
+		opts.InitialBackoff = DefaultReconnectInitialBackoff
+	}
+	if opts.MaxBackoff == 0 {
+		opts.MaxBackoff = DefaultReconnectMaxBackoff
+	}
+	if opts.InitialBackoff < 0 {
+		return nil, fmt.Errorf("reconnect initial backoff must not be negative")
+	}
+	if opts.MaxBackoff < 0 {
+		return nil, fmt.Errorf("reconnect max backoff must not be negative")
+	}
+	if opts.MaxBackoff < opts.InitialBackoff {
+		return nil, fmt.Errorf("reconnect max backoff must not be less than the initial backoff")
+	}
+
+	return &ConnectionManager{
+		lv:             lv,
+		uri:            uri,
+		initialBackoff: opts.InitialBackoff,
+		maxBackoff:     opts.MaxBackoff,
+	}, nil
+}
+
+// Start watches the connection and reconnects after it broke until ctx is done.
+func (m *ConnectionManager) Start(ctx context.Context) error {
+	for {
+		if m.lv.IsConnected() {
+			connected.Set(1)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-m.lv.Disconnected():
+		}
+
+		connected.Set(0)
+		log.Info("Lost connection to libvirt, reconnecting")
+		if !m.reconnect(ctx) {
+			return nil
+		}
+		log.Info("Reconnected to libvirt")
+	}
+}
+
+// reconnect reconnects with exponential backoff. It returns false if ctx is done before.
+func (m *ConnectionManager) reconnect(ctx context.Context) bool {
+	backoff := m.initialBackoff
+	for {
+		err := Connect(m.lv, m.uri)
+		if err == nil {
+			reconnects.WithLabelValues("success").Inc()
+			return true
+		}
+		reconnects.WithLabelValues("error").Inc()
+		log.Error(err, "Failed to reconnect to libvirt", "Backoff", backoff)
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, m.maxBackoff)
+	}
+}
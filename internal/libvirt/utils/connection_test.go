@@ -0,0 +1,235 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package utils_test
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/digitalocean/go-libvirt/socket/dialers"
+	libvirtutils "github.com/ironcore-dev/libvirt-provider/internal/libvirt/utils"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	remoteProgram       = 0x20008086
+	procConnectOpen     = 1
+	procAuthList        = 66
+	packetTypeReply     = 1
+	packetHeaderSize    = 4 + 6*4
+	authListNoneReply   = "\x00\x00\x00\x01\x00\x00\x00\x00"
+	connectedMetricName = "libvirt_provider_libvirt_connected"
+)
+
+// libvirtd is a fake libvirt daemon on a unix socket, answering just enough of the RPC protocol to open
+// connections. It can drop the open connection and refuse new ones.
+type libvirtd struct {
+	listener net.Listener
+	path     string
+
+	mu      sync.Mutex
+	conn    net.Conn
+	refuse  int
+	accepts []time.Time
+}
+
+func startLibvirtd() *libvirtd {
+	d := &libvirtd{path: filepath.Join(GinkgoT().TempDir(), "libvirt-sock")}
+	var err error
+	d.listener, err = net.Listen("unix", d.path)
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(d.close)
+
+	go d.serve()
+	return d
+}
+
+func (d *libvirtd) serve() {
+	for {
+		conn, err := d.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		d.mu.Lock()
+		d.accepts = append(d.accepts, time.Now())
+		refuse := d.refuse > 0
+		if refuse {
+			d.refuse--
+		} else {
+			d.conn = conn
+		}
+		d.mu.Unlock()
+
+		if refuse {
+			_ = conn.Close()
+			continue
+		}
+		go d.handle(conn)
+	}
+}
+
+// handle answers AuthList with no authentication and ConnectOpen with success until conn is closed.
+func (d *libvirtd) handle(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+	for {
+		var length uint32
+		if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+			return
+		}
+		packet := make([]byte, length-4)
+		if _, err := io.ReadFull(conn, packet); err != nil {
+			return
+		}
+
+		var payload []byte
+		switch binary.BigEndian.Uint32(packet[8:12]) {
+		case procAuthList:
+			payload = []byte(authListNoneReply)
+		case procConnectOpen:
+		default:
+			return
+		}
+
+		reply := binary.BigEndian.AppendUint32(nil, uint32(packetHeaderSize+len(payload)))
+		reply = binary.BigEndian.AppendUint32(reply, remoteProgram)
+		reply = append(reply, packet[4:8]...)  // version
+		reply = append(reply, packet[8:12]...) // procedure
+		reply = binary.BigEndian.AppendUint32(reply, packetTypeReply)
+		reply = append(reply, packet[16:20]...) // serial
+		reply = binary.BigEndian.AppendUint32(reply, 0)
+		reply = append(reply, payload...)
+		if _, err := conn.Write(reply); err != nil {
+			return
+		}
+	}
+}
+
+// drop closes the open connection and refuses the next n connections.
+func (d *libvirtd) drop(n int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.refuse = n
+	d.accepts = nil
+	if d.conn != nil {
+		_ = d.conn.Close()
+		d.conn = nil
+	}
+}
+
+// acceptTimes returns the times connections were accepted at since the last drop.
+func (d *libvirtd) acceptTimes() []time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return slices.Clone(d.accepts)
+}
+
+func (d *libvirtd) close() {
+	_ = d.listener.Close()
+	d.drop(0)
+}
+
+// connectedGauge returns the value of the connected gauge from the default registry.
+func connectedGauge() float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	Expect(err).NotTo(HaveOccurred())
+	for _, family := range families {
+		if family.GetName() == connectedMetricName {
+			return family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	return -1
+}
+
+var _ = Describe("ConnectionManager", func() {
+	var (
+		d  *libvirtd
+		lv *libvirt.Libvirt
+	)
+
+	BeforeEach(func() {
+		d = startLibvirtd()
+		lv = libvirt.NewWithDialer(dialers.NewLocal(dialers.WithSocket(d.path)))
+		Expect(libvirtutils.Connect(lv, string(libvirt.QEMUSystem))).To(Succeed())
+	})
+
+	startManager := func(ctx context.Context, opts libvirtutils.ConnectionOptions) <-chan error {
+		m, err := libvirtutils.NewConnectionManager(lv, string(libvirt.QEMUSystem), opts)
+		Expect(err).NotTo(HaveOccurred())
+
+		done := make(chan error, 1)
+		go func() { done <- m.Start(ctx) }()
+		return done
+	}
+
+	It("should reconnect with a doubling backoff capped at the max backoff", func(ctx SpecContext) {
+		const (
+			initialBackoff = 50 * time.Millisecond
+			maxBackoff     = 200 * time.Millisecond
+		)
+
+		managerCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		done := startManager(managerCtx, libvirtutils.ConnectionOptions{
+			InitialBackoff: initialBackoff,
+			MaxBackoff:     maxBackoff,
+		})
+		Eventually(connectedGauge).Should(Equal(1.0))
+
+		By("dropping the connection and refusing the first four reconnects")
+		d.drop(4)
+		Eventually(connectedGauge).Should(Equal(0.0))
+		Eventually(connectedGauge).WithTimeout(5 * time.Second).Should(Equal(1.0))
+		Expect(lv.IsConnected()).To(BeTrue())
+
+		By("validating the backoff between the reconnects")
+		accepts := d.acceptTimes()
+		Expect(accepts).To(HaveLen(5))
+		for i, backoff := range []time.Duration{initialBackoff, 2 * initialBackoff, maxBackoff, maxBackoff} {
+			Expect(accepts[i+1].Sub(accepts[i])).To(BeNumerically(">=", backoff), "backoff before reconnect %d", i+1)
+		}
+		Expect(accepts[4].Sub(accepts[3])).To(BeNumerically("<", 2*maxBackoff), "capped backoff")
+
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+	})
+
+	It("should return once the context is done while backing off", func(ctx SpecContext) {
+		managerCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		done := startManager(managerCtx, libvirtutils.ConnectionOptions{
+			InitialBackoff: time.Hour,
+			MaxBackoff:     time.Hour,
+		})
+		Eventually(connectedGauge).Should(Equal(1.0))
+
+		By("dropping the connection and refusing the reconnect")
+		d.drop(1)
+		Eventually(d.acceptTimes).Should(HaveLen(1))
+		Expect(connectedGauge()).To(Equal(0.0))
+
+		By("cancelling the context during the backoff")
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+	})
+
+	It("should reject negative backoffs", func() {
+		_, err := libvirtutils.NewConnectionManager(lv, "", libvirtutils.ConnectionOptions{InitialBackoff: -time.Second})
+		Expect(err).To(MatchError("reconnect initial backoff must not be negative"))
+
+		_, err = libvirtutils.NewConnectionManager(lv, "", libvirtutils.ConnectionOptions{MaxBackoff: -time.Second})
+		Expect(err).To(MatchError("reconnect max backoff must not be negative"))
+	})
+})
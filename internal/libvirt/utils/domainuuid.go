@@ -0,0 +1,42 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// DomainUUIDMapping determines how the UUID of a domain is obtained from the ID of its machine.
+type DomainUUIDMapping string
+
+const (
+	// DomainUUIDMappingMachineID uses the machine ID as domain UUID. The machine ID has to be a UUID.
+	DomainUUIDMappingMachineID DomainUUIDMapping = "machine-id"
+	// DomainUUIDMappingDerived derives a name based (version 5) UUID from the machine ID.
+	DomainUUIDMappingDerived DomainUUIDMapping = "derived"
+)
+
+func DomainUUIDMappings() []DomainUUIDMapping {
+	return []DomainUUIDMapping{DomainUUIDMappingMachineID, DomainUUIDMappingDerived}
+}
+
+// domainUUIDNamespace is the namespace derived domain UUIDs are generated in.
+var domainUUIDNamespace = uuid.MustParse("6b7c1d0e-2f4a-4c9b-8e3d-5a1f0c7b9d24")
+
+// DomainUUID returns the domain UUID of the machine with the given ID according to mapping.
+func DomainUUID(mapping DomainUUIDMapping, machineID string) (string, error) {
+	switch mapping {
+	case "", DomainUUIDMappingMachineID:
+		if _, err := uuid.Parse(machineID); err != nil {
+			return "", fmt.Errorf("machine id %q is not a valid domain uuid: %w", machineID, err)
+		}
+		return machineID, nil
+	case DomainUUIDMappingDerived:
+		return uuid.NewSHA1(domainUUIDNamespace, []byte(machineID)).String(), nil
+	default:
+		return "", fmt.Errorf("unsupported domain uuid mapping %q", mapping)
+	}
+}
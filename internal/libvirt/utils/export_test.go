@@ -0,0 +1,14 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import "k8s.io/client-go/util/flowcontrol"
+
+// NewRateLimitedClientWithLimiter returns the Client of NewRateLimitedClient limited by limiter.
+func NewRateLimitedClientWithLimiter(client Client, limiter flowcontrol.RateLimiter) Client {
+	return &rateLimitedClient{
+		client:  client,
+		limiter: limiter,
+	}
+}
@@ -153,7 +153,7 @@ func UUIDStringToBytes(uid string) libvirt.UUID {
 	return lUUID
 }
 
-func ApplySecret(lv *libvirt.Libvirt, secret *libvirtxml.Secret, value []byte) error {
+func ApplySecret(lv Client, secret *libvirtxml.Secret, value []byte) error {
 	data, err := secret.Marshal()
 	if err != nil {
 		return err
@@ -178,7 +178,7 @@ func ApplySecret(lv *libvirt.Libvirt, secret *libvirtxml.Secret, value []byte) e
 	return nil
 }
 
-func IsConnected(clnt *libvirt.Libvirt) error {
+func IsConnected(clnt Client) error {
 	if !clnt.IsConnected() {
 		return errors.New("no active libvirt connection")
 	}
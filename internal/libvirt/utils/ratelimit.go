@@ -0,0 +1,189 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"context"
+
+	"github.com/digitalocean/go-libvirt"
+	"k8s.io/client-go/util/flowcontrol"
+)
+
+// rateLimitedClient is a Client whose calls to libvirt wait for the rate limiter. Checking the connection
+// and subscribing to events are not limited, as they don't cost libvirtd any work per call.
+type rateLimitedClient struct {
+	client  Client
+	limiter flowcontrol.RateLimiter
+}
+
+// NewRateLimitedClient returns a Client limiting the calls of client to libvirt to qps per second, with
+// bursts of up to burst calls, to keep libvirtd from being overloaded.
+func NewRateLimitedClient(client Client, qps float32, burst int) Client {
+	return &rateLimitedClient{
+		client:  client,
+		limiter: flowcontrol.NewTokenBucketRateLimiter(qps, burst),
+	}
+}
+
+func (c *rateLimitedClient) IsConnected() bool {
+	return c.client.IsConnected()
+}
+
+func (c *rateLimitedClient) Capabilities() ([]byte, error) {
+	c.limiter.Accept()
+	return c.client.Capabilities()
+}
+
+func (c *rateLimitedClient) ConnectGetDomainCapabilities(emulatorbin, arch, machine, virttype libvirt.OptString, flags uint32) (string, error) {
+	c.limiter.Accept()
+	return c.client.ConnectGetDomainCapabilities(emulatorbin, arch, machine, virttype, flags)
+}
+
+func (c *rateLimitedClient) LifecycleEvents(ctx context.Context) (<-chan libvirt.DomainEventLifecycleMsg, error) {
+	return c.client.LifecycleEvents(ctx)
+}
+
+func (c *rateLimitedClient) SubscribeEvents(ctx context.Context, eventID libvirt.DomainEventID, dom libvirt.OptDomain) (<-chan any, error) {
+	return c.client.SubscribeEvents(ctx, eventID, dom)
+}
+
+func (c *rateLimitedClient) ConnectListAllDomains(needResults int32, flags libvirt.ConnectListAllDomainsFlags) ([]libvirt.Domain, uint32, error) {
+	c.limiter.Accept()
+	return c.client.ConnectListAllDomains(needResults, flags)
+}
+
+func (c *rateLimitedClient) DomainLookupByUUID(uuid libvirt.UUID) (libvirt.Domain, error) {
+	c.limiter.Accept()
+	return c.client.DomainLookupByUUID(uuid)
+}
+
+func (c *rateLimitedClient) DomainCreateXML(xmlDesc string, flags libvirt.DomainCreateFlags) (libvirt.Domain, error) {
+	c.limiter.Accept()
+	return c.client.DomainCreateXML(xmlDesc, flags)
+}
+
+func (c *rateLimitedClient) DomainCreate(dom libvirt.Domain) error {
+	c.limiter.Accept()
+	return c.client.DomainCreate(dom)
+}
+
+func (c *rateLimitedClient) DomainDefineXMLFlags(xml string, flags libvirt.DomainDefineFlags) (libvirt.Domain, error) {
+	c.limiter.Accept()
+	return c.client.DomainDefineXMLFlags(xml, flags)
+}
+
+func (c *rateLimitedClient) DomainUndefineFlags(dom libvirt.Domain, flags libvirt.DomainUndefineFlagsValues) error {
+	c.limiter.Accept()
+	return c.client.DomainUndefineFlags(dom, flags)
+}
+
+func (c *rateLimitedClient) DomainIsPersistent(dom libvirt.Domain) (int32, error) {
+	c.limiter.Accept()
+	return c.client.DomainIsPersistent(dom)
+}
+
+func (c *rateLimitedClient) DomainGetAutostart(dom libvirt.Domain) (int32, error) {
+	c.limiter.Accept()
+	return c.client.DomainGetAutostart(dom)
+}
+
+func (c *rateLimitedClient) DomainSetAutostart(dom libvirt.Domain, autostart int32) error {
+	c.limiter.Accept()
+	return c.client.DomainSetAutostart(dom, autostart)
+}
+
+func (c *rateLimitedClient) DomainGetXMLDesc(dom libvirt.Domain, flags libvirt.DomainXMLFlags) (string, error) {
+	c.limiter.Accept()
+	return c.client.DomainGetXMLDesc(dom, flags)
+}
+
+func (c *rateLimitedClient) DomainGetState(dom libvirt.Domain, flags uint32) (int32, int32, error) {
+	c.limiter.Accept()
+	return c.client.DomainGetState(dom, flags)
+}
+
+func (c *rateLimitedClient) DomainShutdownFlags(dom libvirt.Domain, flags libvirt.DomainShutdownFlagValues) error {
+	c.limiter.Accept()
+	return c.client.DomainShutdownFlags(dom, flags)
+}
+
+func (c *rateLimitedClient) DomainDestroyFlags(dom libvirt.Domain, flags libvirt.DomainDestroyFlagsValues) error {
+	c.limiter.Accept()
+	return c.client.DomainDestroyFlags(dom, flags)
+}
+
+func (c *rateLimitedClient) DomainManagedSave(dom libvirt.Domain, flags uint32) error {
+	c.limiter.Accept()
+	return c.client.DomainManagedSave(dom, flags)
+}
+
+func (c *rateLimitedClient) DomainHasManagedSaveImage(dom libvirt.Domain, flags uint32) (int32, error) {
+	c.limiter.Accept()
+	return c.client.DomainHasManagedSaveImage(dom, flags)
+}
+
+func (c *rateLimitedClient) DomainAttachDevice(dom libvirt.Domain, xml string) error {
+	c.limiter.Accept()
+	return c.client.DomainAttachDevice(dom, xml)
+}
+
+func (c *rateLimitedClient) DomainDetachDevice(dom libvirt.Domain, xml string) error {
+	c.limiter.Accept()
+	return c.client.DomainDetachDevice(dom, xml)
+}
+
+func (c *rateLimitedClient) DomainBlockResize(dom libvirt.Domain, disk string, size uint64, flags libvirt.DomainBlockResizeFlags) error {
+	c.limiter.Accept()
+	return c.client.DomainBlockResize(dom, disk, size, flags)
+}
+
+func (c *rateLimitedClient) DomainSetVcpusFlags(dom libvirt.Domain, nvcpus uint32, flags uint32) error {
+	c.limiter.Accept()
+	return c.client.DomainSetVcpusFlags(dom, nvcpus, flags)
+}
+
+func (c *rateLimitedClient) DomainSetSchedulerParametersFlags(dom libvirt.Domain, params []libvirt.TypedParam, flags uint32) error {
+	c.limiter.Accept()
+	return c.client.DomainSetSchedulerParametersFlags(dom, params, flags)
+}
+
+func (c *rateLimitedClient) DomainSetMetadata(dom libvirt.Domain, typ int32, metadata, key, uri libvirt.OptString, flags libvirt.DomainModificationImpact) error {
+	c.limiter.Accept()
+	return c.client.DomainSetMetadata(dom, typ, metadata, key, uri, flags)
+}
+
+func (c *rateLimitedClient) QEMUDomainAgentCommand(dom libvirt.Domain, cmd string, timeout int32, flags uint32) (libvirt.OptString, error) {
+	c.limiter.Accept()
+	return c.client.QEMUDomainAgentCommand(dom, cmd, timeout, flags)
+}
+
+func (c *rateLimitedClient) NodeGetSevInfo(nparams int32, flags uint32) ([]libvirt.TypedParam, int32, error) {
+	c.limiter.Accept()
+	return c.client.NodeGetSevInfo(nparams, flags)
+}
+
+func (c *rateLimitedClient) DomainGetLaunchSecurityInfo(dom libvirt.Domain, flags uint32) ([]libvirt.TypedParam, error) {
+	c.limiter.Accept()
+	return c.client.DomainGetLaunchSecurityInfo(dom, flags)
+}
+
+func (c *rateLimitedClient) SecretLookupByUUID(uuid libvirt.UUID) (libvirt.Secret, error) {
+	c.limiter.Accept()
+	return c.client.SecretLookupByUUID(uuid)
+}
+
+func (c *rateLimitedClient) SecretDefineXML(xml string, flags uint32) (libvirt.Secret, error) {
+	c.limiter.Accept()
+	return c.client.SecretDefineXML(xml, flags)
+}
+
+func (c *rateLimitedClient) SecretSetValue(secret libvirt.Secret, value []byte, flags uint32) error {
+	c.limiter.Accept()
+	return c.client.SecretSetValue(secret, value, flags)
+}
+
+func (c *rateLimitedClient) SecretUndefine(secret libvirt.Secret) error {
+	c.limiter.Accept()
+	return c.client.SecretUndefine(secret)
+}
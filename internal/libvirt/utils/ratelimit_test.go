@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package utils_test
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/digitalocean/go-libvirt"
+	libvirtutils "github.com/ironcore-dev/libvirt-provider/internal/libvirt/utils"
+	"github.com/ironcore-dev/libvirt-provider/pkg/libvirt/fake"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// countingLimiter counts the tokens taken without ever blocking.
+type countingLimiter struct {
+	accepted int
+}
+
+func (l *countingLimiter) TryAccept() bool                { l.accepted++; return true }
+func (l *countingLimiter) Accept()                        { l.accepted++ }
+func (l *countingLimiter) Wait(ctx context.Context) error { l.accepted++; return nil }
+func (l *countingLimiter) Stop()                          {}
+func (l *countingLimiter) QPS() float32                   { return 0 }
+
+// unlimitedMethods are the methods of the Client passed through without waiting for the limiter.
+var unlimitedMethods = map[string]bool{
+	"IsConnected":     true,
+	"LifecycleEvents": true,
+	"SubscribeEvents": true,
+}
+
+var _ = Describe("RateLimitedClient", func() {
+	const (
+		qps   = 5
+		burst = 1
+	)
+
+	var (
+		l      *fake.Libvirt
+		client libvirtutils.Client
+	)
+
+	BeforeEach(func() {
+		l = fake.SetupLibvirt()
+		client = libvirtutils.NewRateLimitedClient(l, qps, burst)
+	})
+
+	It("should throttle calls to libvirt to the qps once the burst is used up", func() {
+		const calls = 4
+
+		start := time.Now()
+		for range calls {
+			_, err := client.Capabilities()
+			Expect(err).NotTo(HaveOccurred())
+		}
+		// The first call takes the token of the burst, the others wait for a token each.
+		Expect(time.Since(start)).To(BeNumerically(">=", (calls-burst)*time.Second/qps-10*time.Millisecond))
+	})
+
+	It("should pass checking the connection and subscribing to events through", func(ctx SpecContext) {
+		By("using up the burst")
+		_, err := client.Capabilities()
+		Expect(err).NotTo(HaveOccurred())
+
+		By("calling the unlimited methods")
+		start := time.Now()
+		for range 10 {
+			client.IsConnected()
+		}
+		_, err = client.LifecycleEvents(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = client.SubscribeEvents(ctx, libvirt.DomainEventIDReboot, libvirt.OptDomain{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second/qps/2))
+	})
+})
+
+var _ = Describe("NewRateLimitedClientWithLimiter", func() {
+	It("should take a token for every method of the Client except the unlimited ones", func() {
+		clientType := reflect.TypeFor[libvirtutils.Client]()
+		for i := range clientType.NumMethod() {
+			method := clientType.Method(i)
+
+			limiter := &countingLimiter{}
+			// The wrapped client is nil, so the calls panic once they are passed on, after the limiter was asked.
+			client := reflect.ValueOf(libvirtutils.NewRateLimitedClientWithLimiter(nil, limiter))
+			args := make([]reflect.Value, method.Type.NumIn())
+			for j := range args {
+				args[j] = reflect.Zero(method.Type.In(j))
+			}
+			func() {
+				defer func() { _ = recover() }()
+				client.MethodByName(method.Name).Call(args)
+			}()
+
+			expected := 1
+			if unlimitedMethods[method.Name] {
+				expected = 0
+			}
+			Expect(limiter.accepted).To(Equal(expected), "tokens taken by %s", method.Name)
+		}
+	})
+})
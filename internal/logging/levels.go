@@ -0,0 +1,279 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	SubsystemReconciler      = "reconciler"
+	SubsystemResourceManager = "resource-manager"
+	SubsystemNICPlugin       = "nic-plugin"
+)
+
+// subsystemLoggerNames are the names of the loggers of the subsystems. A log entry belongs to the subsystem of
+// the innermost name of its logger, e.g. machine-reconciler.nic-plugin to the nic plugin.
+var subsystemLoggerNames = map[string]string{
+	SubsystemReconciler:      "machine-reconciler",
+	SubsystemResourceManager: "resource-manager",
+	SubsystemNICPlugin:       "nic-plugin",
+}
+
+// Subsystems returns the subsystems whose verbosity can be set.
+func Subsystems() []string {
+	return slices.Sorted(maps.Keys(subsystemLoggerNames))
+}
+
+// ParseLevel parses a level as accepted by --zap-log-level: debug, info, warn, error or an integer
+// verbosity greater than 0, e.g. 3 for V(3).
+func ParseLevel(value string) (zapcore.Level, error) {
+	if verbosity, err := strconv.Atoi(value); err == nil {
+		if verbosity <= 0 {
+			return 0, fmt.Errorf("invalid log level %q, verbosity has to be greater than 0", value)
+		}
+		return zapcore.Level(-verbosity), nil
+	}
+
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q", value)
+	}
+	return level, nil
+}
+
+// FormatLevel formats a level as parsed by ParseLevel.
+func FormatLevel(level zapcore.Level) string {
+	if level < zapcore.DebugLevel {
+		return strconv.Itoa(-int(level))
+	}
+	return level.String()
+}
+
+// ParseSubsystemLevels parses comma separated subsystem=level pairs, e.g. reconciler=debug,nic-plugin=3.
+func ParseSubsystemLevels(value string) (map[string]zapcore.Level, error) {
+	levels := make(map[string]zapcore.Level)
+	if value == "" {
+		return levels, nil
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		subsystem, levelValue, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("%q must be formatted as subsystem=level", pair)
+		}
+		if _, ok := subsystemLoggerNames[subsystem]; !ok {
+			return nil, fmt.Errorf("unknown subsystem %q, available: %v", subsystem, Subsystems())
+		}
+		level, err := ParseLevel(levelValue)
+		if err != nil {
+			return nil, fmt.Errorf("[subsystem %s] %w", subsystem, err)
+		}
+		levels[subsystem] = level
+	}
+	return levels, nil
+}
+
+// Levels are the log levels of the provider: a global level and overrides of the verbosity of subsystems.
+// Both can be changed at runtime. Levels is the zapcore.LevelEnabler of the logger and its WrapCore
+// filters the entries by the level of their subsystem.
+type Levels struct {
+	global zap.AtomicLevel
+
+	// mu serializes changes of overrides, which are replaced as a whole so logging reads them without lock.
+	mu        sync.Mutex
+	overrides atomic.Pointer[map[string]zapcore.Level]
+}
+
+// NewLevels creates Levels with the given global level and no overrides.
+func NewLevels(global zapcore.Level) *Levels {
+	l := &Levels{global: zap.NewAtomicLevelAt(global)}
+	l.overrides.Store(&map[string]zapcore.Level{})
+	return l
+}
+
+// Global returns the global level.
+func (l *Levels) Global() zapcore.Level {
+	return l.global.Level()
+}
+
+// SetGlobal sets the global level, which applies to all subsystems without override.
+func (l *Levels) SetGlobal(level zapcore.Level) {
+	l.global.SetLevel(level)
+}
+
+// Overrides returns the levels of the subsystems with override.
+func (l *Levels) Overrides() map[string]zapcore.Level {
+	return maps.Clone(*l.overrides.Load())
+}
+
+// SetOverrides replaces the levels of all subsystems.
+func (l *Levels) SetOverrides(levels map[string]zapcore.Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	overrides := maps.Clone(levels)
+	l.overrides.Store(&overrides)
+}
+
+// SetOverride sets the level of a subsystem. A nil level removes the override.
+func (l *Levels) SetOverride(subsystem string, level *zapcore.Level) error {
+	if _, ok := subsystemLoggerNames[subsystem]; !ok {
+		return fmt.Errorf("unknown subsystem %q, available: %v", subsystem, Subsystems())
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	overrides := maps.Clone(*l.overrides.Load())
+	if level == nil {
+		delete(overrides, subsystem)
+	} else {
+		overrides[subsystem] = *level
+	}
+	l.overrides.Store(&overrides)
+	return nil
+}
+
+// Enabled reports whether the level is enabled globally or for any subsystem.
+func (l *Levels) Enabled(level zapcore.Level) bool {
+	if l.global.Enabled(level) {
+		return true
+	}
+	for _, override := range *l.overrides.Load() {
+		if override.Enabled(level) {
+			return true
+		}
+	}
+	return false
+}
+
+// EnabledFor reports whether the level is enabled for entries of the logger.
+func (l *Levels) EnabledFor(loggerName string, level zapcore.Level) bool {
+	overrides := *l.overrides.Load()
+	if len(overrides) > 0 {
+		names := strings.Split(loggerName, ".")
+		for i := len(names) - 1; i >= 0; i-- {
+			for subsystem, override := range overrides {
+				if subsystemLoggerNames[subsystem] == names[i] {
+					return override.Enabled(level)
+				}
+			}
+		}
+	}
+	return l.global.Enabled(level)
+}
+
+// WrapCore wraps the core of the logger, see zap.WrapCore.
+func (l *Levels) WrapCore(core zapcore.Core) zapcore.Core {
+	return &levelsCore{Core: core, levels: l}
+}
+
+type levelsCore struct {
+	zapcore.Core
+	levels *Levels
+}
+
+func (c *levelsCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelsCore{Core: c.Core.With(fields), levels: c.levels}
+}
+
+func (c *levelsCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.levels.EnabledFor(ent.LoggerName, ent.Level) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// LevelsState is the state of Levels reported and accepted by Levels.ServeHTTP.
+type LevelsState struct {
+	// Level is the global level.
+	Level string `json:"level,omitempty"`
+	// Subsystems are the levels of the subsystems with override. Setting the level of a subsystem to an
+	// empty string removes its override.
+	Subsystems map[string]string `json:"subsystems,omitempty"`
+}
+
+func (l *Levels) state() LevelsState {
+	state := LevelsState{Level: FormatLevel(l.Global())}
+	for subsystem, level := range l.Overrides() {
+		if state.Subsystems == nil {
+			state.Subsystems = make(map[string]string)
+		}
+		state.Subsystems[subsystem] = FormatLevel(level)
+	}
+	return state
+}
+
+func (l *Levels) apply(state LevelsState) error {
+	var global *zapcore.Level
+	if state.Level != "" {
+		level, err := ParseLevel(state.Level)
+		if err != nil {
+			return err
+		}
+		global = &level
+	}
+
+	overrides := make(map[string]*zapcore.Level, len(state.Subsystems))
+	for subsystem, value := range state.Subsystems {
+		if _, ok := subsystemLoggerNames[subsystem]; !ok {
+			return fmt.Errorf("unknown subsystem %q, available: %v", subsystem, Subsystems())
+		}
+		if value == "" {
+			overrides[subsystem] = nil
+			continue
+		}
+		level, err := ParseLevel(value)
+		if err != nil {
+			return fmt.Errorf("[subsystem %s] %w", subsystem, err)
+		}
+		overrides[subsystem] = &level
+	}
+
+	if global != nil {
+		l.SetGlobal(*global)
+	}
+	for subsystem, level := range overrides {
+		if err := l.SetOverride(subsystem, level); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServeHTTP reports the levels on GET and changes them on PUT with a LevelsState as body. Levels missing in
+// the body are kept. Both methods respond with the resulting levels. Changes are not persisted, they last
+// until the next restart or reload of the configuration.
+func (l *Levels) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var state LevelsState
+		if err := json.NewDecoder(r.Body).Decode(&state); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := l.apply(state); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(l.state())
+}
@@ -0,0 +1,133 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/internal/logging"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	ctrlzap "sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+var _ = Describe("Levels", func() {
+	var (
+		levels *logging.Levels
+		out    *bytes.Buffer
+		log    logr.Logger
+	)
+
+	BeforeEach(func() {
+		levels = logging.NewLevels(zapcore.InfoLevel)
+		out = &bytes.Buffer{}
+		log = ctrlzap.New(
+			ctrlzap.WriteTo(out),
+			ctrlzap.Level(levels),
+			ctrlzap.RawZapOpts(zap.WrapCore(levels.WrapCore)),
+		)
+	})
+
+	logged := func() []string {
+		var msgs []string
+		for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+			if line == "" {
+				continue
+			}
+			var entry struct {
+				Msg string `json:"msg"`
+			}
+			Expect(json.Unmarshal([]byte(line), &entry)).To(Succeed())
+			msgs = append(msgs, entry.Msg)
+		}
+		out.Reset()
+		return msgs
+	}
+
+	It("should parse and format levels", func() {
+		Expect(logging.ParseLevel("debug")).To(Equal(zapcore.DebugLevel))
+		Expect(logging.ParseLevel("3")).To(Equal(zapcore.Level(-3)))
+		Expect(logging.ParseLevel("0")).Error().To(HaveOccurred())
+		Expect(logging.ParseLevel("loud")).Error().To(HaveOccurred())
+		Expect(logging.FormatLevel(zapcore.Level(-3))).To(Equal("3"))
+		Expect(logging.FormatLevel(zapcore.ErrorLevel)).To(Equal("error"))
+
+		Expect(logging.ParseSubsystemLevels("reconciler=debug, nic-plugin=3")).To(Equal(map[string]zapcore.Level{
+			logging.SubsystemReconciler: zapcore.DebugLevel,
+			logging.SubsystemNICPlugin:  zapcore.Level(-3),
+		}))
+		Expect(logging.ParseSubsystemLevels("scheduler=debug")).Error().To(MatchError(ContainSubstring("unknown subsystem")))
+	})
+
+	It("should log subsystems with their own level", func() {
+		Expect(levels.SetOverride(logging.SubsystemNICPlugin, ptr(zapcore.Level(-2)))).To(Succeed())
+
+		reconciler := log.WithName("machine-reconciler")
+		reconciler.V(1).Info("reconciler debug")
+		reconciler.WithName("nic-plugin").V(2).Info("nic plugin verbose")
+		log.WithName("iri-server").WithName("nic-plugin").V(3).Info("nic plugin too verbose")
+		log.V(1).Info("global debug")
+		log.Info("global info")
+		Expect(logged()).To(Equal([]string{"nic plugin verbose", "global info"}))
+
+		By("raising the global level")
+		levels.SetGlobal(zapcore.DebugLevel)
+		reconciler.V(1).Info("reconciler debug")
+		reconciler.V(2).Info("reconciler verbose")
+		Expect(logged()).To(Equal([]string{"reconciler debug"}))
+
+		By("lowering the level of a subsystem")
+		Expect(levels.SetOverride(logging.SubsystemReconciler, ptr(zapcore.ErrorLevel))).To(Succeed())
+		reconciler.Info("reconciler info")
+		reconciler.Error(nil, "reconciler error")
+		Expect(logged()).To(Equal([]string{"reconciler error"}))
+
+		By("removing the override")
+		Expect(levels.SetOverride(logging.SubsystemReconciler, nil)).To(Succeed())
+		reconciler.Info("reconciler info")
+		Expect(logged()).To(Equal([]string{"reconciler info"}))
+	})
+
+	It("should report and change the levels via http", func() {
+		do := func(method, body string) (int, logging.LevelsState) {
+			rec := httptest.NewRecorder()
+			levels.ServeHTTP(rec, httptest.NewRequest(method, "/loglevel", strings.NewReader(body)))
+			var state logging.LevelsState
+			if rec.Code == http.StatusOK {
+				Expect(json.Unmarshal(rec.Body.Bytes(), &state)).To(Succeed())
+			}
+			return rec.Code, state
+		}
+
+		code, state := do(http.MethodGet, "")
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(state).To(Equal(logging.LevelsState{Level: "info"}))
+
+		code, state = do(http.MethodPut, `{"level":"debug","subsystems":{"reconciler":"4","nic-plugin":"error"}}`)
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(state).To(Equal(logging.LevelsState{Level: "debug", Subsystems: map[string]string{"reconciler": "4", "nic-plugin": "error"}}))
+
+		code, state = do(http.MethodPut, `{"subsystems":{"reconciler":""}}`)
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(state).To(Equal(logging.LevelsState{Level: "debug", Subsystems: map[string]string{"nic-plugin": "error"}}))
+
+		code, _ = do(http.MethodPut, `{"level":"info","subsystems":{"scheduler":"debug"}}`)
+		Expect(code).To(Equal(http.StatusBadRequest))
+		Expect(levels.Global()).To(Equal(zapcore.DebugLevel))
+
+		code, _ = do(http.MethodPost, "")
+		Expect(code).To(Equal(http.StatusMethodNotAllowed))
+	})
+})
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,182 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package maintenance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var enabledGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "libvirt_provider_maintenance_mode",
+	Help: "Whether the host is in maintenance mode (1) or not (0).",
+})
+
+func init() {
+	prometheus.MustRegister(enabledGauge)
+}
+
+// State is the maintenance state of the host.
+type State struct {
+	Enabled bool `json:"enabled"`
+	// Reason is the reason given when enabling the maintenance mode.
+	Reason string `json:"reason,omitempty"`
+	// Since is the time the maintenance mode was enabled.
+	Since *time.Time `json:"since,omitempty"`
+}
+
+// Mode is the maintenance mode of the host. While it is enabled, no new machines should be scheduled onto
+// the host, whereas the existing ones keep being managed. The mode is persisted in a file, so it survives restarts.
+// A nil Mode is never enabled.
+type Mode struct {
+	file string
+
+	mu    sync.RWMutex
+	state State
+}
+
+// Load creates a Mode persisted in file, restoring the state of a previous run.
+func Load(file string) (*Mode, error) {
+	m := &Mode{file: file}
+
+	data, err := os.ReadFile(file)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("error reading maintenance state: %w", err)
+	default:
+		if err := json.Unmarshal(data, &m.state); err != nil {
+			return nil, fmt.Errorf("error decoding maintenance state: %w", err)
+		}
+	}
+
+	m.setGauge()
+	return m, nil
+}
+
+// State returns the current maintenance state.
+func (m *Mode) State() State {
+	if m == nil {
+		return State{}
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state
+}
+
+// Enabled reports whether the maintenance mode is enabled.
+func (m *Mode) Enabled() bool {
+	return m.State().Enabled
+}
+
+// Enable enables the maintenance mode. Enabling it again only updates the reason.
+func (m *Mode) Enable(reason string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state := State{Enabled: true, Reason: reason, Since: m.state.Since}
+	if state.Since == nil {
+		now := time.Now().UTC().Truncate(time.Second)
+		state.Since = &now
+	}
+	return m.persist(state)
+}
+
+// Disable disables the maintenance mode.
+func (m *Mode) Disable() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.persist(State{})
+}
+
+// persist writes the state to the file before taking it over, so the state in memory never differs from the
+// one restored after a restart.
+func (m *Mode) persist(state State) error {
+	if !state.Enabled {
+		if err := os.Remove(m.file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error removing maintenance state: %w", err)
+		}
+	} else {
+		data, err := json.Marshal(state)
+		if err != nil {
+			return fmt.Errorf("error encoding maintenance state: %w", err)
+		}
+
+		tmpFile, err := os.CreateTemp(filepath.Dir(m.file), "."+filepath.Base(m.file)+"-")
+		if err != nil {
+			return fmt.Errorf("error creating maintenance state: %w", err)
+		}
+		defer func() { _ = os.Remove(tmpFile.Name()) }()
+
+		if _, err := tmpFile.Write(data); err != nil {
+			_ = tmpFile.Close()
+			return fmt.Errorf("error writing maintenance state: %w", err)
+		}
+		if err := tmpFile.Close(); err != nil {
+			return fmt.Errorf("error closing maintenance state: %w", err)
+		}
+		if err := os.Rename(tmpFile.Name(), m.file); err != nil {
+			return fmt.Errorf("error replacing maintenance state: %w", err)
+		}
+	}
+
+	m.state = state
+	m.setGauge()
+	return nil
+}
+
+func (m *Mode) setGauge() {
+	if m.state.Enabled {
+		enabledGauge.Set(1)
+	} else {
+		enabledGauge.Set(0)
+	}
+}
+
+// EnableRequest is the optional body of requests enabling the maintenance mode.
+type EnableRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// ServeHTTP reports the maintenance state on GET, enables the maintenance mode on PUT, optionally with an
+// EnableRequest as body, and disables it on DELETE. All methods respond with the resulting state.
+func (m *Mode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req EnableRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+		if err := m.Enable(req.Reason); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	case http.MethodDelete:
+		if err := m.Disable(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(m.State())
+}
@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package maintenance_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+
+	"github.com/ironcore-dev/libvirt-provider/internal/maintenance"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Mode", func() {
+	var file string
+
+	BeforeEach(func() {
+		file = filepath.Join(GinkgoT().TempDir(), "maintenance")
+	})
+
+	It("should persist the state across loads", func() {
+		mode, err := maintenance.Load(file)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mode.Enabled()).To(BeFalse())
+
+		Expect(mode.Enable("kernel update")).To(Succeed())
+		Expect(mode.Enabled()).To(BeTrue())
+		since := mode.State().Since
+		Expect(since).NotTo(BeNil())
+
+		restored, err := maintenance.Load(file)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restored.State()).To(Equal(mode.State()))
+
+		Expect(restored.Enable("firmware update")).To(Succeed())
+		Expect(restored.State().Reason).To(Equal("firmware update"))
+		Expect(restored.State().Since).To(Equal(since))
+
+		Expect(restored.Disable()).To(Succeed())
+		Expect(file).NotTo(BeAnExistingFile())
+
+		restored, err = maintenance.Load(file)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(restored.Enabled()).To(BeFalse())
+	})
+
+	It("should never be enabled if nil", func() {
+		var mode *maintenance.Mode
+		Expect(mode.Enabled()).To(BeFalse())
+	})
+
+	It("should be toggled via http", func() {
+		mode, err := maintenance.Load(file)
+		Expect(err).NotTo(HaveOccurred())
+
+		serve := func(method, body string) (int, maintenance.State) {
+			rec := httptest.NewRecorder()
+			mode.ServeHTTP(rec, httptest.NewRequest(method, "/maintenance", strings.NewReader(body)))
+
+			var state maintenance.State
+			if rec.Code == http.StatusOK {
+				Expect(json.Unmarshal(rec.Body.Bytes(), &state)).To(Succeed())
+			}
+			return rec.Code, state
+		}
+
+		code, state := serve(http.MethodPut, `{"reason":"kernel update"}`)
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(state.Enabled).To(BeTrue())
+		Expect(state.Reason).To(Equal("kernel update"))
+
+		code, state = serve(http.MethodGet, "")
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(state.Enabled).To(BeTrue())
+
+		code, _ = serve(http.MethodPut, `{`)
+		Expect(code).To(Equal(http.StatusBadRequest))
+
+		code, _ = serve(http.MethodPost, "")
+		Expect(code).To(Equal(http.StatusMethodNotAllowed))
+
+		code, state = serve(http.MethodDelete, "")
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(state.Enabled).To(BeFalse())
+		Expect(mode.Enabled()).To(BeFalse())
+	})
+})
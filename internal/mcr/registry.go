@@ -9,16 +9,61 @@ import (
 	"io"
 	"math"
 	"os"
+	"slices"
+	"sync"
 
 	iri "github.com/ironcore-dev/ironcore/iri/apis/machine/v1alpha1"
+	"github.com/ironcore-dev/libvirt-provider/api"
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/mem"
 	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/yaml"
 )
 
-func LoadMachineClasses(reader io.Reader) ([]iri.MachineClass, error) {
-	var classList []iri.MachineClass
+// MachineClass is a machine class of the machine classes file.
+type MachineClass struct {
+	iri.MachineClass
+	// Overcommit is the overcommit of the machine class. If nil, its resources are not overcommitted.
+	Overcommit *Overcommit `json:"overcommit,omitempty"`
+	// Resources are the extended resources of the machines of the class besides cpu and memory, e.g.
+	// hugepages-2Mi, sgx.intel.com/epc or nvidia.com/gpu.
+	Resources map[string]resource.Quantity `json:"resources,omitempty"`
+	// QoS is the QoS tier of the machines of the class. If empty, their cpu and memory are not tuned.
+	QoS api.QoSTier `json:"qos,omitempty"`
+	// IOThreads is the number of QEMU iothreads of the machines of the class. If zero, the number is derived
+	// from the disks of the machines.
+	IOThreads uint `json:"ioThreads,omitempty"`
+}
+
+// Overcommit are the ratios the resources of the machines of a class are overcommitted by, e.g. a CPU ratio
+// of 4 lets four vCPUs share a host cpu. Ratios of zero default to 1, i.e. dedicated resources.
+type Overcommit struct {
+	CPU    float64 `json:"cpu,omitempty"`
+	Memory float64 `json:"memory,omitempty"`
+}
+
+func (o Overcommit) validate() error {
+	if o.CPU < 0 || o.Memory < 0 {
+		return fmt.Errorf("overcommit ratios must not be negative")
+	}
+	return nil
+}
+
+// Host returns the host resources consumed by a machine with the given resources.
+func (o Overcommit) Host(cpuMillis, memoryBytes int64) (int64, int64) {
+	return overcommitted(cpuMillis, o.CPU), overcommitted(memoryBytes, o.Memory)
+}
+
+func overcommitted(value int64, ratio float64) int64 {
+	if ratio == 0 {
+		return value
+	}
+	return int64(math.Ceil(float64(value) / ratio))
+}
+
+func LoadMachineClasses(reader io.Reader) ([]MachineClass, error) {
+	var classList []MachineClass
 	if err := yaml.NewYAMLOrJSONDecoder(reader, 4096).Decode(&classList); err != nil {
 		return nil, fmt.Errorf("unable to unmarshal machine classes: %w", err)
 	}
@@ -26,7 +71,7 @@ func LoadMachineClasses(reader io.Reader) ([]iri.MachineClass, error) {
 	return classList, nil
 }
 
-func LoadMachineClassesFile(filename string) ([]iri.MachineClass, error) {
+func LoadMachineClassesFile(filename string) ([]MachineClass, error) {
 	file, err := os.Open(filename)
 	if err != nil {
 		return nil, fmt.Errorf("unable to open machine class file (%s): %w", filename, err)
@@ -35,42 +80,128 @@ func LoadMachineClassesFile(filename string) ([]iri.MachineClass, error) {
 	return LoadMachineClasses(file)
 }
 
-func NewMachineClassRegistry(classes []iri.MachineClass) (*Mcr, error) {
+func NewMachineClassRegistry(classes []MachineClass) (*Mcr, error) {
 	registry := Mcr{
-		classes: map[string]iri.MachineClass{},
+		classes:     map[string]MachineClass{},
+		overcommits: map[string]Overcommit{},
 	}
 
 	for _, class := range classes {
 		if _, ok := registry.classes[class.Name]; ok {
 			return nil, fmt.Errorf("multiple classes with same name (%s) found", class.Name)
 		}
+		if err := validateOvercommit(class); err != nil {
+			return nil, err
+		}
+		if class.QoS != "" && !slices.Contains(api.QoSTiers(), class.QoS) {
+			return nil, fmt.Errorf("unsupported qos tier %q of class %s, supported: %v", class.QoS, class.Name, api.QoSTiers())
+		}
+		for name, quantity := range class.Resources {
+			if errs := validation.IsQualifiedName(name); len(errs) > 0 {
+				return nil, fmt.Errorf("invalid resource name %q of class %s: %v", name, class.Name, errs)
+			}
+			if quantity.Sign() < 0 {
+				return nil, fmt.Errorf("resource %s of class %s must not be negative", name, class.Name)
+			}
+		}
 		registry.classes[class.Name] = class
+		if class.Overcommit != nil {
+			registry.overcommits[class.Name] = *class.Overcommit
+		}
 	}
 
 	return &registry, nil
 }
 
+func validateOvercommit(class MachineClass) error {
+	if class.Overcommit != nil {
+		if err := class.Overcommit.validate(); err != nil {
+			return fmt.Errorf("invalid overcommit of class %s: %w", class.Name, err)
+		}
+	}
+	return nil
+}
+
 type Mcr struct {
-	classes map[string]iri.MachineClass
+	classes map[string]MachineClass
+	// overcommits holds the overcommit of the overcommitted classes, which is reloadable.
+	overcommitsMu sync.RWMutex
+	overcommits   map[string]Overcommit
 }
 
 func (m *Mcr) Get(machineClassName string) (*iri.MachineClass, bool) {
 	class, found := m.classes[machineClassName]
-	return &class, found
+	return &class.MachineClass, found
 }
 
 func (m *Mcr) List() []*iri.MachineClass {
 	var classes []*iri.MachineClass
 	for name := range m.classes {
 		class := m.classes[name]
-		classes = append(classes, &class)
+		classes = append(classes, &class.MachineClass)
 	}
 	return classes
 }
 
+// Overcommit returns the overcommit of the machine class. Unknown classes, e.g. of machines whose class was
+// removed, are not overcommitted.
+func (m *Mcr) Overcommit(machineClassName string) Overcommit {
+	m.overcommitsMu.RLock()
+	defer m.overcommitsMu.RUnlock()
+	return m.overcommits[machineClassName]
+}
+
+// ReloadOvercommit takes over the overcommit of the known classes of classes, e.g. of the reloaded machine
+// classes file. Everything else, including added and removed classes, only takes effect after a restart.
+// Nothing is taken over if an overcommit is invalid.
+func (m *Mcr) ReloadOvercommit(classes []MachineClass) error {
+	for _, class := range classes {
+		if err := validateOvercommit(class); err != nil {
+			return err
+		}
+	}
+
+	m.overcommitsMu.Lock()
+	defer m.overcommitsMu.Unlock()
+
+	for _, class := range classes {
+		if _, ok := m.classes[class.Name]; !ok {
+			continue
+		}
+		if class.Overcommit != nil {
+			m.overcommits[class.Name] = *class.Overcommit
+		} else {
+			delete(m.overcommits, class.Name)
+		}
+	}
+	return nil
+}
+
+// QoS returns the QoS tier of the machine class.
+func (m *Mcr) QoS(machineClassName string) api.QoSTier {
+	return m.classes[machineClassName].QoS
+}
+
+// IOThreads returns the number of iothreads of the machines of the machine class, zero if not set.
+func (m *Mcr) IOThreads(machineClassName string) uint {
+	return m.classes[machineClassName].IOThreads
+}
+
+// Resources returns the extended resources of the machine class.
+func (m *Mcr) Resources(machineClassName string) map[string]resource.Quantity {
+	return m.classes[machineClassName].Resources
+}
+
 func GetQuantity(class *iri.MachineClass, host *Host) int64 {
-	cpuRatio := host.Cpu.Value() / class.Capabilities.CpuMillis
-	memoryRatio := host.Mem.Value() / class.Capabilities.MemoryBytes
+	return GetOvercommittedQuantity(class, Overcommit{}, host)
+}
+
+// GetOvercommittedQuantity returns the number of machines of the class fitting onto the host if the class is
+// overcommitted by overcommit.
+func GetOvercommittedQuantity(class *iri.MachineClass, overcommit Overcommit, host *Host) int64 {
+	cpuMillis, memoryBytes := overcommit.Host(class.Capabilities.CpuMillis, class.Capabilities.MemoryBytes)
+	cpuRatio := host.Cpu.Value() / cpuMillis
+	memoryRatio := host.Mem.Value() / memoryBytes
 
 	return int64(math.Min(float64(cpuRatio), float64(memoryRatio)))
 }
@@ -0,0 +1,134 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package mcr_test
+
+import (
+	"strings"
+
+	"github.com/ironcore-dev/libvirt-provider/api"
+	. "github.com/ironcore-dev/libvirt-provider/internal/mcr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+var _ = Describe("Registry", func() {
+	const classes = `[
+  {"name": "dedicated", "capabilities": {"cpu_millis": 2000, "memory_bytes": 2147483648}},
+  {"name": "burstable", "capabilities": {"cpu_millis": 2000, "memory_bytes": 2147483648}, "overcommit": {"cpu": 4, "memory": 2}}
+]`
+
+	It("should load the overcommit of machine classes", func() {
+		machineClasses, err := LoadMachineClasses(strings.NewReader(classes))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(machineClasses).To(HaveLen(2))
+		Expect(machineClasses[0].Name).To(Equal("dedicated"))
+		Expect(machineClasses[0].Overcommit).To(BeNil())
+		Expect(machineClasses[1].Capabilities.CpuMillis).To(BeEquivalentTo(2000))
+		Expect(machineClasses[1].Overcommit).To(Equal(&Overcommit{CPU: 4, Memory: 2}))
+
+		registry, err := NewMachineClassRegistry(machineClasses)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(registry.Overcommit("dedicated")).To(Equal(Overcommit{}))
+		Expect(registry.Overcommit("burstable")).To(Equal(Overcommit{CPU: 4, Memory: 2}))
+		Expect(registry.Overcommit("unknown")).To(Equal(Overcommit{}))
+	})
+
+	It("should reject negative overcommit ratios", func() {
+		machineClasses, err := LoadMachineClasses(strings.NewReader(`[{"name": "invalid", "overcommit": {"cpu": -1}}]`))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = NewMachineClassRegistry(machineClasses)
+		Expect(err).To(MatchError(ContainSubstring("invalid overcommit of class invalid")))
+	})
+
+	It("should reload the overcommit of known machine classes", func() {
+		machineClasses, err := LoadMachineClasses(strings.NewReader(classes))
+		Expect(err).NotTo(HaveOccurred())
+		registry, err := NewMachineClassRegistry(machineClasses)
+		Expect(err).NotTo(HaveOccurred())
+
+		reloaded, err := LoadMachineClasses(strings.NewReader(`[
+  {"name": "dedicated", "overcommit": {"cpu": 2}},
+  {"name": "burstable"},
+  {"name": "added", "overcommit": {"cpu": 8}}
+]`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(registry.ReloadOvercommit(reloaded)).To(Succeed())
+		Expect(registry.Overcommit("dedicated")).To(Equal(Overcommit{CPU: 2}))
+		Expect(registry.Overcommit("burstable")).To(Equal(Overcommit{}))
+		Expect(registry.Overcommit("added")).To(Equal(Overcommit{}))
+		Expect(registry.List()).To(HaveLen(2))
+
+		invalid, err := LoadMachineClasses(strings.NewReader(`[{"name": "dedicated", "overcommit": {"cpu": -1}}]`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(registry.ReloadOvercommit(invalid)).To(MatchError(ContainSubstring("invalid overcommit of class dedicated")))
+		Expect(registry.Overcommit("dedicated")).To(Equal(Overcommit{CPU: 2}))
+	})
+
+	It("should load the extended resources of machine classes", func() {
+		machineClasses, err := LoadMachineClasses(strings.NewReader(`[
+  {"name": "gpu", "capabilities": {"cpu_millis": 2000, "memory_bytes": 2147483648}, "resources": {"nvidia.com/gpu": "1", "hugepages-2Mi": "2Gi"}}
+]`))
+		Expect(err).NotTo(HaveOccurred())
+
+		registry, err := NewMachineClassRegistry(machineClasses)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(registry.Resources("gpu")).To(Equal(map[string]resource.Quantity{
+			"nvidia.com/gpu": resource.MustParse("1"),
+			"hugepages-2Mi":  resource.MustParse("2Gi"),
+		}))
+		Expect(registry.Resources("unknown")).To(BeEmpty())
+	})
+
+	It("should reject invalid extended resources", func() {
+		machineClasses, err := LoadMachineClasses(strings.NewReader(`[{"name": "invalid", "resources": {"nvidia.com/gpu": "-1"}}]`))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = NewMachineClassRegistry(machineClasses)
+		Expect(err).To(MatchError(ContainSubstring("must not be negative")))
+	})
+
+	It("should load the qos tiers of machine classes", func() {
+		machineClasses, err := LoadMachineClasses(strings.NewReader(`[
+  {"name": "guaranteed", "capabilities": {"cpu_millis": 2000, "memory_bytes": 2147483648}, "qos": "guaranteed"},
+  {"name": "untuned", "capabilities": {"cpu_millis": 2000, "memory_bytes": 2147483648}}
+]`))
+		Expect(err).NotTo(HaveOccurred())
+
+		registry, err := NewMachineClassRegistry(machineClasses)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(registry.QoS("guaranteed")).To(Equal(api.QoSTierGuaranteed))
+		Expect(registry.QoS("untuned")).To(BeEmpty())
+
+		machineClasses, err = LoadMachineClasses(strings.NewReader(`[{"name": "invalid", "qos": "besteffort"}]`))
+		Expect(err).NotTo(HaveOccurred())
+		_, err = NewMachineClassRegistry(machineClasses)
+		Expect(err).To(MatchError(ContainSubstring(`unsupported qos tier "besteffort"`)))
+	})
+
+	It("should load the iothreads of machine classes", func() {
+		machineClasses, err := LoadMachineClasses(strings.NewReader(`[
+  {"name": "storage", "capabilities": {"cpu_millis": 2000, "memory_bytes": 2147483648}, "ioThreads": 4},
+  {"name": "default", "capabilities": {"cpu_millis": 2000, "memory_bytes": 2147483648}}
+]`))
+		Expect(err).NotTo(HaveOccurred())
+
+		registry, err := NewMachineClassRegistry(machineClasses)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(registry.IOThreads("storage")).To(Equal(uint(4)))
+		Expect(registry.IOThreads("default")).To(BeZero())
+		Expect(registry.IOThreads("unknown")).To(BeZero())
+	})
+
+	It("should calculate the quantity of overcommitted classes", func() {
+		machineClasses, err := LoadMachineClasses(strings.NewReader(classes))
+		Expect(err).NotTo(HaveOccurred())
+		host := &Host{
+			Cpu: resource.NewScaledQuantity(8, resource.Kilo),
+			Mem: resource.NewQuantity(16*1024*1024*1024, resource.BinarySI),
+		}
+
+		Expect(GetQuantity(&machineClasses[0].MachineClass, host)).To(BeEquivalentTo(4))
+		Expect(GetOvercommittedQuantity(&machineClasses[1].MachineClass, *machineClasses[1].Overcommit, host)).To(BeEquivalentTo(16))
+	})
+})
@@ -0,0 +1,119 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package mcr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DefaultCgroupRoot is the mount point of the cgroup filesystem.
+const DefaultCgroupRoot = "/sys/fs/cgroup"
+
+// MemoryReservationMode determines how the host memory not available to machines is determined.
+type MemoryReservationMode string
+
+const (
+	// MemoryReservationModeNone reserves no memory.
+	MemoryReservationModeNone MemoryReservationMode = "none"
+	// MemoryReservationModeStatic reserves a fixed amount of memory.
+	MemoryReservationModeStatic MemoryReservationMode = "static"
+	// MemoryReservationModeCgroup reserves the memory of cgroups, e.g. the system.slice and the cgroup of
+	// the kubelet reservations.
+	MemoryReservationModeCgroup MemoryReservationMode = "cgroup"
+)
+
+func MemoryReservationModes() []MemoryReservationMode {
+	return []MemoryReservationMode{MemoryReservationModeNone, MemoryReservationModeStatic, MemoryReservationModeCgroup}
+}
+
+// MemoryReservation determines the host memory in bytes not available to machines.
+type MemoryReservation interface {
+	ReservedMemory(ctx context.Context) (int64, error)
+}
+
+// StaticMemoryReservation reserves a fixed amount of memory in bytes.
+type StaticMemoryReservation int64
+
+func (r StaticMemoryReservation) ReservedMemory(context.Context) (int64, error) {
+	return int64(r), nil
+}
+
+// CgroupMemoryReservation reserves the memory of cgroups: their memory limit or, if they are not limited,
+// their current memory usage. As it is read anew on every call, the reservation follows changed limits
+// and growing usage. Both cgroup v2 and v1 are supported.
+type CgroupMemoryReservation struct {
+	// Root is the mount point of the cgroup filesystem of the host. Defaults to DefaultCgroupRoot.
+	Root string
+	// Cgroups are the paths of the cgroups relative to Root, e.g. system.slice.
+	Cgroups []string
+}
+
+func (r CgroupMemoryReservation) ReservedMemory(context.Context) (int64, error) {
+	root := r.Root
+	if root == "" {
+		root = DefaultCgroupRoot
+	}
+
+	var reserved int64
+	for _, cgroup := range r.Cgroups {
+		bytes, err := cgroupMemory(root, cgroup)
+		if err != nil {
+			return 0, fmt.Errorf("[cgroup %s] %w", cgroup, err)
+		}
+		reserved += bytes
+	}
+	return reserved, nil
+}
+
+// cgroupMemory returns the memory limit of the cgroup or, if it is not limited, its memory usage.
+func cgroupMemory(root, cgroup string) (int64, error) {
+	// cgroup v2 is mounted at the root, cgroup v1 has a hierarchy per controller.
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		dir := filepath.Join(root, cgroup)
+		return limitOrUsage(filepath.Join(dir, "memory.max"), filepath.Join(dir, "memory.current"))
+	}
+	dir := filepath.Join(root, "memory", cgroup)
+	return limitOrUsage(filepath.Join(dir, "memory.limit_in_bytes"), filepath.Join(dir, "memory.usage_in_bytes"))
+}
+
+// unlimited is the memory limit of cgroup v1 cgroups without limit, the maximum int64 rounded down to pages.
+const unlimited = 1<<63 - 4096
+
+func limitOrUsage(limitFile, usageFile string) (int64, error) {
+	limit, err := readCgroupValue(limitFile)
+	if err != nil {
+		return 0, err
+	}
+	if limit >= 0 && limit < unlimited {
+		return limit, nil
+	}
+	return readCgroupValue(usageFile)
+}
+
+// readCgroupValue reads a cgroup value in bytes, -1 if it is "max".
+func readCgroupValue(file string) (int64, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, fmt.Errorf("cgroup doesn't exist or has no memory controller: %w", err)
+		}
+		return 0, fmt.Errorf("error reading %s: %w", filepath.Base(file), err)
+	}
+
+	value := strings.TrimSpace(string(data))
+	if value == "max" {
+		return -1, nil
+	}
+	bytes, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing %s: %w", filepath.Base(file), err)
+	}
+	return bytes, nil
+}
@@ -0,0 +1,58 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package mcr_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/ironcore-dev/libvirt-provider/internal/mcr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CgroupMemoryReservation", func() {
+	var root string
+
+	writeFile := func(name, data string) {
+		GinkgoHelper()
+		Expect(os.MkdirAll(filepath.Dir(name), 0777)).To(Succeed())
+		Expect(os.WriteFile(name, []byte(data), 0666)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		root = GinkgoT().TempDir()
+	})
+
+	It("should reserve the limits or usage of cgroup v2 cgroups", func(ctx SpecContext) {
+		writeFile(filepath.Join(root, "cgroup.controllers"), "cpu memory\n")
+		writeFile(filepath.Join(root, "system.slice", "memory.max"), "2147483648\n")
+		writeFile(filepath.Join(root, "system.slice", "memory.current"), "1024\n")
+		writeFile(filepath.Join(root, "kube.slice", "memory.max"), "max\n")
+		writeFile(filepath.Join(root, "kube.slice", "memory.current"), "1073741824\n")
+
+		reservation := CgroupMemoryReservation{Root: root, Cgroups: []string{"system.slice", "kube.slice"}}
+		Expect(reservation.ReservedMemory(ctx)).To(BeEquivalentTo(3 * 1024 * 1024 * 1024))
+
+		By("following changed limits")
+		writeFile(filepath.Join(root, "system.slice", "memory.max"), "1073741824\n")
+		Expect(reservation.ReservedMemory(ctx)).To(BeEquivalentTo(2 * 1024 * 1024 * 1024))
+	})
+
+	It("should reserve the limits or usage of cgroup v1 cgroups", func(ctx SpecContext) {
+		writeFile(filepath.Join(root, "memory", "system.slice", "memory.limit_in_bytes"), "9223372036854771712\n")
+		writeFile(filepath.Join(root, "memory", "system.slice", "memory.usage_in_bytes"), "4096\n")
+
+		reservation := CgroupMemoryReservation{Root: root, Cgroups: []string{"system.slice"}}
+		Expect(reservation.ReservedMemory(ctx)).To(BeEquivalentTo(4096))
+	})
+
+	It("should fail for unknown cgroups", func(ctx SpecContext) {
+		writeFile(filepath.Join(root, "cgroup.controllers"), "cpu memory\n")
+
+		reservation := CgroupMemoryReservation{Root: root, Cgroups: []string{"unknown.slice"}}
+		_, err := reservation.ReservedMemory(ctx)
+		Expect(err).To(MatchError(ContainSubstring("cgroup unknown.slice")))
+	})
+})
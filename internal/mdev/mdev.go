@@ -0,0 +1,278 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package mdev
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// DefaultBusDir is the sysfs directory of the host devices supporting mediated devices.
+const DefaultBusDir = "/sys/class/mdev_bus"
+
+// DeviceAPIVFIOPCI is the device api of mediated devices passed through as PCI devices, e.g. NVIDIA vGPUs.
+// Types with other device apis are not handed out.
+const DeviceAPIVFIOPCI = "vfio-pci"
+
+// ErrInsufficientDevices is returned if there are not enough free mediated devices of a resource.
+var ErrInsufficientDevices = errors.New("insufficient mediated devices")
+
+// Type is a mediated device type supported by a parent device, e.g. a vGPU profile of a GPU.
+type Type struct {
+	// Parent is the address of the parent device, e.g. the PCI address 0000:65:00.0 of a GPU.
+	Parent string `json:"parent"`
+	// ID is the id of the type, e.g. nvidia-222.
+	ID string `json:"id"`
+	// Name is the human readable name of the type, e.g. GRID T4-4Q.
+	Name      string `json:"name,omitempty"`
+	DeviceAPI string `json:"deviceAPI"`
+	// Available is the number of instances of the type that can still be created on the parent.
+	Available int `json:"available"`
+	// Instances are the UUIDs of the instances of the type created on the parent.
+	Instances []string `json:"instances,omitempty"`
+}
+
+// ReadTypes reads the mediated device types of the parent devices in dir, usually DefaultBusDir. A missing dir
+// is no error, the host just has no devices supporting mediated devices.
+func ReadTypes(dir string) ([]Type, error) {
+	parents, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading mdev parent devices: %w", err)
+	}
+
+	var types []Type
+	for _, parent := range parents {
+		typesDir := filepath.Join(dir, parent.Name(), "mdev_supported_types")
+		entries, err := os.ReadDir(typesDir)
+		if err != nil {
+			return nil, fmt.Errorf("[parent %s] error reading mdev types: %w", parent.Name(), err)
+		}
+
+		for _, entry := range entries {
+			typ, err := readType(filepath.Join(typesDir, entry.Name()), parent.Name(), entry.Name())
+			if err != nil {
+				return nil, fmt.Errorf("[parent %s] [type %s] %w", parent.Name(), entry.Name(), err)
+			}
+			types = append(types, typ)
+		}
+	}
+	return types, nil
+}
+
+func readType(dir, parent, id string) (Type, error) {
+	typ := Type{Parent: parent, ID: id}
+
+	// The name is optional.
+	if name, err := os.ReadFile(filepath.Join(dir, "name")); err == nil {
+		typ.Name = strings.TrimSpace(string(name))
+	}
+
+	deviceAPI, err := os.ReadFile(filepath.Join(dir, "device_api"))
+	if err != nil {
+		return Type{}, fmt.Errorf("error reading device api: %w", err)
+	}
+	typ.DeviceAPI = strings.TrimSpace(string(deviceAPI))
+
+	available, err := os.ReadFile(filepath.Join(dir, "available_instances"))
+	if err != nil {
+		return Type{}, fmt.Errorf("error reading available instances: %w", err)
+	}
+	if typ.Available, err = strconv.Atoi(strings.TrimSpace(string(available))); err != nil {
+		return Type{}, fmt.Errorf("error parsing available instances: %w", err)
+	}
+
+	instances, err := os.ReadDir(filepath.Join(dir, "devices"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Type{}, fmt.Errorf("error reading instances: %w", err)
+	}
+	for _, instance := range instances {
+		typ.Instances = append(typ.Instances, instance.Name())
+	}
+	return typ, nil
+}
+
+// Profile maps the name machines request mediated devices by to a mediated device type.
+type Profile struct {
+	// Resource is the name machines request the devices by, e.g. nvidia.com/grid-t4-4q.
+	Resource string
+	// Type is the id of the mediated device type, e.g. nvidia-222.
+	Type string
+}
+
+// ParseProfiles parses profiles in the form resource=type, e.g. nvidia.com/grid-t4-4q=nvidia-222.
+func ParseProfiles(specs []string) ([]Profile, error) {
+	var profiles []Profile
+	for _, spec := range specs {
+		resource, typ, ok := strings.Cut(spec, "=")
+		if !ok || resource == "" || typ == "" {
+			return nil, fmt.Errorf("expected resource=type, got %q", spec)
+		}
+		profiles = append(profiles, Profile{Resource: resource, Type: typ})
+	}
+	return profiles, nil
+}
+
+// Source hands out instances of the mediated device types of the configured profiles to machines, creates
+// and removes them. Like the pci.Source it is stateless: the capacity is read from sysfs and the instances
+// allocated but not yet created are determined by the machines they are allocated to.
+type Source struct {
+	dir      string
+	profiles []Profile
+	newUUID  func() string
+}
+
+// NewSource creates a Source of the mediated devices in dir, usually DefaultBusDir.
+func NewSource(dir string, profiles []Profile) (*Source, error) {
+	resources := sets.New[string]()
+	for _, profile := range profiles {
+		if resources.Has(profile.Resource) {
+			return nil, fmt.Errorf("mdev resource %s configured multiple times", profile.Resource)
+		}
+		resources.Insert(profile.Resource)
+	}
+	return &Source{dir: dir, profiles: slices.Clone(profiles), newUUID: uuid.NewString}, nil
+}
+
+// Profiles returns the configured profiles.
+func (s *Source) Profiles() []Profile {
+	return slices.Clone(s.profiles)
+}
+
+// Types returns the mediated device types of the host, whether configured for a resource or not.
+func (s *Source) Types() ([]Type, error) {
+	return ReadTypes(s.dir)
+}
+
+func (s *Source) profileType(resource string) (string, bool) {
+	for _, profile := range s.profiles {
+		if profile.Resource == resource {
+			return profile.Type, true
+		}
+	}
+	return "", false
+}
+
+// Capacity returns the number of instances per resource the host supports, the ones created included.
+func (s *Source) Capacity() (map[string]int, error) {
+	types, err := ReadTypes(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	capacity := make(map[string]int)
+	for _, profile := range s.profiles {
+		capacity[profile.Resource] = 0
+		for _, typ := range types {
+			if typ.ID == profile.Type && typ.DeviceAPI == DeviceAPIVFIOPCI {
+				capacity[profile.Resource] += typ.Available + len(typ.Instances)
+			}
+		}
+	}
+	return capacity, nil
+}
+
+// Allocate returns the mediated devices of a machine requesting the given number of devices per resource. The
+// current devices of the machine are kept as far as they are still requested, further devices are allocated
+// on the parents with available instances of the type of the resource. As instances are only created once the
+// machine is reconciled, the allocated devices of other machines not created yet are subtracted. It fails with
+// ErrInsufficientDevices if there are not enough free instances.
+func (s *Source) Allocate(requests map[string]int, current, others []api.MdevDeviceSpec) ([]api.MdevDeviceSpec, error) {
+	var devices []api.MdevDeviceSpec
+	kept := make(map[string]int)
+	for _, device := range current {
+		if kept[device.Resource] < requests[device.Resource] {
+			devices = append(devices, device)
+			kept[device.Resource]++
+		}
+	}
+
+	resources := make([]string, 0, len(requests))
+	for resource, count := range requests {
+		if _, ok := s.profileType(resource); !ok && count > 0 {
+			return nil, fmt.Errorf("%w: unknown resource %s", ErrInsufficientDevices, resource)
+		}
+		resources = append(resources, resource)
+	}
+	slices.Sort(resources)
+
+	types, err := ReadTypes(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	free := make([]int, len(types))
+	for i, typ := range types {
+		created := sets.New(typ.Instances...)
+		free[i] = typ.Available
+		for _, device := range slices.Concat(devices, others) {
+			if device.Parent == typ.Parent && device.Type == typ.ID && !created.Has(device.UUID) {
+				free[i]--
+			}
+		}
+	}
+
+	for _, resource := range resources {
+		typeID, _ := s.profileType(resource)
+		missing := requests[resource] - kept[resource]
+		for i, typ := range types {
+			if typ.ID != typeID || typ.DeviceAPI != DeviceAPIVFIOPCI {
+				continue
+			}
+			for ; missing > 0 && free[i] > 0; missing-- {
+				devices = append(devices, api.MdevDeviceSpec{
+					Resource: resource,
+					Parent:   typ.Parent,
+					Type:     typ.ID,
+					UUID:     s.newUUID(),
+				})
+				free[i]--
+			}
+		}
+		if missing > 0 {
+			return nil, fmt.Errorf("%w: %d more devices of resource %s requested than available", ErrInsufficientDevices, missing, resource)
+		}
+	}
+	return devices, nil
+}
+
+func (s *Source) typeDir(device api.MdevDeviceSpec) string {
+	return filepath.Join(s.dir, device.Parent, "mdev_supported_types", device.Type)
+}
+
+// Create creates the instance of the device unless it exists already.
+func (s *Source) Create(device api.MdevDeviceSpec) error {
+	if _, err := os.Stat(filepath.Join(s.typeDir(device), "devices", device.UUID)); err == nil {
+		return nil
+	}
+
+	if err := os.WriteFile(filepath.Join(s.typeDir(device), "create"), []byte(device.UUID), 0200); err != nil {
+		return fmt.Errorf("error creating mdev %s: %w", device.UUID, err)
+	}
+	return nil
+}
+
+// Remove removes the instance of the device, if it exists.
+func (s *Source) Remove(device api.MdevDeviceSpec) error {
+	removeFile := filepath.Join(s.typeDir(device), "devices", device.UUID, "remove")
+	if _, err := os.Stat(removeFile); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err := os.WriteFile(removeFile, []byte("1"), 0200); err != nil {
+		return fmt.Errorf("error removing mdev %s: %w", device.UUID, err)
+	}
+	return nil
+}
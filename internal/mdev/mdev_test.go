@@ -0,0 +1,142 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package mdev_test
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/mdev"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	gpu0 = "0000:65:00.0"
+	gpu1 = "0000:66:00.0"
+)
+
+var _ = Describe("Mdev", func() {
+	var dir string
+
+	writeFile := func(name, data string) {
+		GinkgoHelper()
+		Expect(os.MkdirAll(filepath.Dir(name), 0777)).To(Succeed())
+		Expect(os.WriteFile(name, []byte(data), 0666)).To(Succeed())
+	}
+
+	writeType := func(parent, id, deviceAPI string, available int, instances ...string) {
+		GinkgoHelper()
+		typeDir := filepath.Join(dir, parent, "mdev_supported_types", id)
+		writeFile(filepath.Join(typeDir, "name"), "GRID "+id+"\n")
+		writeFile(filepath.Join(typeDir, "device_api"), deviceAPI+"\n")
+		writeFile(filepath.Join(typeDir, "available_instances"), strconv.Itoa(available)+"\n")
+		Expect(os.MkdirAll(filepath.Join(typeDir, "devices"), 0777)).To(Succeed())
+		for _, instance := range instances {
+			writeFile(filepath.Join(typeDir, "devices", instance, "remove"), "")
+		}
+	}
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		writeType(gpu0, "nvidia-222", "vfio-pci", 1, "created")
+		writeType(gpu0, "nvidia-223", "vfio-ccw", 4)
+		writeType(gpu1, "nvidia-222", "vfio-pci", 1)
+	})
+
+	It("should read the mdev types", func() {
+		types, err := mdev.ReadTypes(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(types).To(ConsistOf(
+			mdev.Type{Parent: gpu0, ID: "nvidia-222", Name: "GRID nvidia-222", DeviceAPI: "vfio-pci", Available: 1, Instances: []string{"created"}},
+			mdev.Type{Parent: gpu0, ID: "nvidia-223", Name: "GRID nvidia-223", DeviceAPI: "vfio-ccw", Available: 4},
+			mdev.Type{Parent: gpu1, ID: "nvidia-222", Name: "GRID nvidia-222", DeviceAPI: "vfio-pci", Available: 1},
+		))
+	})
+
+	It("should report no types if the host has no mdev bus", func() {
+		Expect(mdev.ReadTypes(filepath.Join(dir, "missing"))).To(BeEmpty())
+	})
+
+	It("should parse profiles", func() {
+		Expect(mdev.ParseProfiles([]string{"nvidia.com/grid-t4-4q=nvidia-222"})).To(Equal([]mdev.Profile{
+			{Resource: "nvidia.com/grid-t4-4q", Type: "nvidia-222"},
+		}))
+		_, err := mdev.ParseProfiles([]string{"nvidia-222"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	Describe("Source", func() {
+		const resource = "nvidia.com/grid-t4-4q"
+		var source *mdev.Source
+
+		BeforeEach(func() {
+			var err error
+			source, err = mdev.NewSource(dir, []mdev.Profile{
+				{Resource: resource, Type: "nvidia-222"},
+				{Resource: "example.com/ccw", Type: "nvidia-223"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should reject resources configured multiple times", func() {
+			_, err := mdev.NewSource(dir, []mdev.Profile{{Resource: "a", Type: "x"}, {Resource: "a", Type: "y"}})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should report the capacity of vfio-pci types including created instances", func() {
+			Expect(source.Capacity()).To(Equal(map[string]int{resource: 3, "example.com/ccw": 0}))
+		})
+
+		It("should allocate free instances and keep the current ones", func() {
+			current := []api.MdevDeviceSpec{{Resource: resource, Parent: gpu0, Type: "nvidia-222", UUID: "created"}}
+			devices, err := source.Allocate(map[string]int{resource: 3}, current, nil)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(devices).To(HaveLen(3))
+			Expect(devices[0]).To(Equal(current[0]))
+			Expect(devices[1:]).To(ConsistOf(
+				HaveField("Parent", gpu0),
+				HaveField("Parent", gpu1),
+			))
+			Expect(devices[1].UUID).NotTo(Equal(devices[2].UUID))
+		})
+
+		It("should subtract the instances of other machines not created yet", func() {
+			others := []api.MdevDeviceSpec{
+				{Resource: resource, Parent: gpu0, Type: "nvidia-222", UUID: "created"},
+				{Resource: resource, Parent: gpu1, Type: "nvidia-222", UUID: "pending"},
+			}
+			devices, err := source.Allocate(map[string]int{resource: 1}, nil, others)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(devices).To(ConsistOf(HaveField("Parent", gpu0)))
+
+			_, err = source.Allocate(map[string]int{resource: 2}, nil, others)
+			Expect(err).To(MatchError(mdev.ErrInsufficientDevices))
+		})
+
+		It("should release devices no longer requested", func() {
+			current := []api.MdevDeviceSpec{{Resource: resource, Parent: gpu0, Type: "nvidia-222", UUID: "created"}}
+			Expect(source.Allocate(map[string]int{}, current, nil)).To(BeEmpty())
+		})
+
+		It("should not hand out types with other device apis", func() {
+			_, err := source.Allocate(map[string]int{"example.com/ccw": 1}, nil, nil)
+			Expect(err).To(MatchError(mdev.ErrInsufficientDevices))
+		})
+
+		It("should create and remove instances", func() {
+			typeDir := filepath.Join(dir, gpu1, "mdev_supported_types", "nvidia-222")
+			device := api.MdevDeviceSpec{Resource: resource, Parent: gpu1, Type: "nvidia-222", UUID: "new"}
+			Expect(source.Create(device)).To(Succeed())
+			Expect(os.ReadFile(filepath.Join(typeDir, "create"))).To(BeEquivalentTo("new"))
+
+			Expect(source.Remove(device)).To(Succeed())
+			writeFile(filepath.Join(typeDir, "devices", "new", "remove"), "")
+			Expect(source.Remove(device)).To(Succeed())
+			Expect(os.ReadFile(filepath.Join(typeDir, "devices", "new", "remove"))).To(BeEquivalentTo("1"))
+		})
+	})
+})
@@ -10,16 +10,20 @@ import (
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 )
 
-type isolatedOptions struct{}
+type isolatedOptions struct {
+	AssignIPs bool
+}
 
-func (o *isolatedOptions) AddFlags(fs *pflag.FlagSet) {}
+func (o *isolatedOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.BoolVar(&o.AssignIPs, "isolated-assign-ips", false, "Hand out the IPs of isolated network interfaces to guests via DHCP, using the passt backend of libvirt.")
+}
 
 func (o *isolatedOptions) PluginName() string {
 	return "isolated"
 }
 
 func (o *isolatedOptions) NetworkInterfacePlugin() (providernetworkinterface.Plugin, func(), error) {
-	return isolated.NewPlugin(), nil, nil
+	return isolated.NewPlugin(o.AssignIPs), nil, nil
 }
 
 func init() {
@@ -4,22 +4,28 @@
 package networkinterfaceplugin
 
 import (
+	"fmt"
+
 	providernetworkinterface "github.com/ironcore-dev/libvirt-provider/internal/plugins/networkinterface"
 	"github.com/ironcore-dev/libvirt-provider/internal/plugins/networkinterface/providernetwork"
 	"github.com/spf13/pflag"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 )
 
-type libvirtNetworkOptions struct{}
+type libvirtNetworkOptions struct {
+	PortSecurity bool
+}
 
-func (o *libvirtNetworkOptions) AddFlags(fs *pflag.FlagSet) {}
+func (o *libvirtNetworkOptions) AddFlags(fs *pflag.FlagSet) {
+	fs.BoolVar(&o.PortSecurity, "providernet-port-security", false, fmt.Sprintf("Restrict the traffic of provider network interfaces to their MAC address and IPs unless their %q attribute disables it. Only IPv4 addresses are supported.", providernetworkinterface.AttributePortSecurity))
+}
 
 func (o *libvirtNetworkOptions) PluginName() string {
 	return "providernet"
 }
 
 func (o *libvirtNetworkOptions) NetworkInterfacePlugin() (providernetworkinterface.Plugin, func(), error) {
-	return providernetwork.NewPlugin(), nil, nil
+	return providernetwork.NewPlugin(o.PortSecurity), nil, nil
 }
 
 func init() {
@@ -8,6 +8,7 @@ import (
 	"sort"
 
 	providernetworkinterface "github.com/ironcore-dev/libvirt-provider/internal/plugins/networkinterface"
+	"github.com/ironcore-dev/libvirt-provider/internal/plugins/networkinterface/dispatch"
 	"github.com/spf13/pflag"
 )
 
@@ -87,7 +88,10 @@ func (r *TypeOptionsRegistry) PluginTypeOptsByName(pluginName string) (TypeOptio
 
 type Options struct {
 	PluginName string
-	registry   *TypeOptionsRegistry
+	// AdditionalPluginNames are the plugins network interfaces can select besides the default plugin, see
+	// dispatch.AttributePlugin.
+	AdditionalPluginNames []string
+	registry              *TypeOptionsRegistry
 }
 
 func NewOptions(registry *TypeOptionsRegistry) *Options {
@@ -98,6 +102,7 @@ func NewOptions(registry *TypeOptionsRegistry) *Options {
 
 func (o *Options) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&o.PluginName, "network-interface-plugin-name", o.registry.DefaultPluginName(), fmt.Sprintf("Name of the network interface plugin to use. Available: %v", o.registry.PluginNames()))
+	fs.StringSliceVar(&o.AdditionalPluginNames, "network-interface-additional-plugin-names", nil, fmt.Sprintf("Names of further network interface plugins network interfaces can select with the %q attribute. Available: %v", dispatch.AttributePlugin, o.registry.PluginNames()))
 	o.registry.ForeachPluginTypeOpts(func(pluginName string, pluginOpts TypeOptions) bool {
 		pluginOpts.AddFlags(fs)
 		return true
@@ -105,17 +110,49 @@ func (o *Options) AddFlags(fs *pflag.FlagSet) {
 }
 
 func (o *Options) NetworkInterfacePlugin() (providernetworkinterface.Plugin, func(), error) {
-	pluginOpts, err := o.registry.PluginTypeOptsByName(o.PluginName)
+	nicPlugin, cleanup, err := o.networkInterfacePlugin(o.PluginName)
 	if err != nil {
 		return nil, nil, err
 	}
+	if len(o.AdditionalPluginNames) == 0 {
+		return nicPlugin, cleanup, nil
+	}
+
+	cleanups := []func(){cleanup}
+	cleanupAll := func() {
+		for _, cleanup := range cleanups {
+			if cleanup != nil {
+				cleanup()
+			}
+		}
+	}
+
+	var additionalPlugins []providernetworkinterface.Plugin
+	for _, pluginName := range o.AdditionalPluginNames {
+		additionalPlugin, cleanup, err := o.networkInterfacePlugin(pluginName)
+		if err != nil {
+			cleanupAll()
+			return nil, nil, err
+		}
+		cleanups = append(cleanups, cleanup)
+		additionalPlugins = append(additionalPlugins, additionalPlugin)
+	}
+
+	dispatchPlugin, err := dispatch.NewPlugin(nicPlugin, additionalPlugins...)
+	if err != nil {
+		cleanupAll()
+		return nil, nil, err
+	}
+	return dispatchPlugin, cleanupAll, nil
+}
 
-	nicPlugin, cleanup, err := pluginOpts.NetworkInterfacePlugin()
+func (o *Options) networkInterfacePlugin(pluginName string) (providernetworkinterface.Plugin, func(), error) {
+	pluginOpts, err := o.registry.PluginTypeOptsByName(pluginName)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	return nicPlugin, cleanup, nil
+	return pluginOpts.NetworkInterfacePlugin()
 }
 
 var (
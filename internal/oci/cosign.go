@@ -0,0 +1,203 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package oci
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/distribution/reference"
+	"github.com/ironcore-dev/ironcore-image/oci/image"
+	"github.com/ironcore-dev/ironcore-image/oci/remote"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	cosignSimpleSigningMediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+	cosignSignatureAnnotation    = "dev.cosignproject.cosign/signature"
+)
+
+// ErrImageVerificationFailed is returned if an image has no signature matching the configured keys.
+var ErrImageVerificationFailed = errors.New("oci verification failed")
+
+// Verifier verifies an image in the registry before it is pulled.
+type Verifier interface {
+	Verify(ctx context.Context, registry *remote.Registry, ref string, img image.Image) error
+}
+
+// CosignVerifier verifies cosign signatures of images against public keys.
+// Signatures are looked up at the tag cosign attaches them to, i.e. <repository>:sha256-<hex>.sig.
+// Keyless signatures, which require a transparency log, are not supported.
+type CosignVerifier struct {
+	keys []crypto.PublicKey
+}
+
+// NewCosignVerifier creates a CosignVerifier for the PEM encoded public keys in keyFile.
+// Images have to be signed by one of the keys.
+func NewCosignVerifier(keyFile string) (*CosignVerifier, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading keys: %w", err)
+	}
+
+	var keys []crypto.PublicKey
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing public key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no public keys found in %s", keyFile)
+	}
+	return &CosignVerifier{keys: keys}, nil
+}
+
+type simpleSigningPayload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+func signatureTag(ref string, dgst digest.Digest) (string, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid ref %s: %w", ref, err)
+	}
+	return fmt.Sprintf("%s:%s-%s.sig", reference.TrimNamed(named).String(), dgst.Algorithm(), dgst.Encoded()), nil
+}
+
+// signatureResolveError classifies an error resolving the signature tag. Only a missing tag fails
+// the verification, transient errors are returned as is so the pull is retried.
+func signatureResolveError(sigRef string, err error) error {
+	switch {
+	case errdefs.IsNotFound(err):
+		return fmt.Errorf("%w: no signatures found in %s: %w", ErrImageVerificationFailed, sigRef, err)
+	case isUnauthorized(err):
+		return fmt.Errorf("%w: error resolving signatures %s: %w", ErrImagePullUnauthorized, sigRef, err)
+	default:
+		return fmt.Errorf("error resolving signatures %s: %w", sigRef, err)
+	}
+}
+
+func (v *CosignVerifier) Verify(ctx context.Context, registry *remote.Registry, ref string, img image.Image) error {
+	dgst := img.Descriptor().Digest
+	sigRef, err := signatureTag(ref, dgst)
+	if err != nil {
+		return err
+	}
+
+	sigImg, err := registry.Resolve(ctx, sigRef)
+	if err != nil {
+		return signatureResolveError(sigRef, err)
+	}
+
+	layers, err := sigImg.Layers(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting signatures: %w", err)
+	}
+
+	var errs []error
+	for _, layer := range layers {
+		desc := layer.Descriptor()
+		if desc.MediaType != cosignSimpleSigningMediaType {
+			continue
+		}
+
+		signature, err := base64.StdEncoding.DecodeString(desc.Annotations[cosignSignatureAnnotation])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("error decoding signature: %w", err))
+			continue
+		}
+
+		payload, err := readLayer(ctx, layer)
+		if err != nil {
+			return err
+		}
+
+		if err := v.VerifyPayload(dgst, payload, signature); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		return nil
+	}
+
+	if len(errs) == 0 {
+		return fmt.Errorf("%w: no signatures found in %s", ErrImageVerificationFailed, sigRef)
+	}
+	return fmt.Errorf("%w: %w", ErrImageVerificationFailed, errors.Join(errs...))
+}
+
+func readLayer(ctx context.Context, layer image.Layer) ([]byte, error) {
+	rc, err := layer.Content(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error getting content of %s: %w", layer.Descriptor().Digest, err)
+	}
+	defer func() { _ = rc.Close() }()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("error reading content of %s: %w", layer.Descriptor().Digest, err)
+	}
+	return data, nil
+}
+
+// VerifyPayload verifies that signature is a signature of the simple signing payload by one of the keys
+// and that the payload is about the image with the manifest digest dgst.
+func (v *CosignVerifier) VerifyPayload(dgst digest.Digest, payload, signature []byte) error {
+	if !v.verifySignature(payload, signature) {
+		return fmt.Errorf("signature does not match any key")
+	}
+
+	p := &simpleSigningPayload{}
+	if err := json.Unmarshal(payload, p); err != nil {
+		return fmt.Errorf("error decoding payload: %w", err)
+	}
+	if !strings.EqualFold(p.Critical.Type, "cosign container image signature") {
+		return fmt.Errorf("unsupported payload type %q", p.Critical.Type)
+	}
+	if p.Critical.Image.DockerManifestDigest != dgst.String() {
+		return fmt.Errorf("signature is for digest %s instead of %s", p.Critical.Image.DockerManifestDigest, dgst)
+	}
+	return nil
+}
+
+func (v *CosignVerifier) verifySignature(payload, signature []byte) bool {
+	hash := sha256.Sum256(payload)
+	for _, key := range v.keys {
+		switch key := key.(type) {
+		case *ecdsa.PublicKey:
+			if ecdsa.VerifyASN1(key, hash[:], signature) {
+				return true
+			}
+		case *rsa.PublicKey:
+			if rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature) == nil {
+				return true
+			}
+		case ed25519.PublicKey:
+			if ed25519.Verify(key, payload, signature) {
+				return true
+			}
+		}
+	}
+	return false
+}
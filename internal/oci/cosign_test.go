@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package oci_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/containerd/containerd/errdefs"
+	remoteerrors "github.com/containerd/containerd/remotes/errors"
+	"github.com/ironcore-dev/libvirt-provider/internal/oci"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+)
+
+var _ = Describe("CosignVerifier", func() {
+	var (
+		key      *ecdsa.PrivateKey
+		verifier *oci.CosignVerifier
+		dgst     = digest.FromString("manifest")
+	)
+
+	payloadFor := func(dgst digest.Digest) []byte {
+		return []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":"example.org/image"},"image":{"docker-manifest-digest":%q},"type":"cosign container image signature"},"optional":null}`, dgst))
+	}
+
+	sign := func(key *ecdsa.PrivateKey, payload []byte) []byte {
+		hash := sha256.Sum256(payload)
+		signature, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+		Expect(err).NotTo(HaveOccurred())
+		return signature
+	}
+
+	BeforeEach(func() {
+		var err error
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+
+		der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		Expect(err).NotTo(HaveOccurred())
+		keyFile := filepath.Join(GinkgoT().TempDir(), "cosign.pub")
+		Expect(os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600)).To(Succeed())
+
+		verifier, err = oci.NewCosignVerifier(keyFile)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should accept a signature of the image digest", func() {
+		payload := payloadFor(dgst)
+		Expect(verifier.VerifyPayload(dgst, payload, sign(key, payload))).To(Succeed())
+	})
+
+	It("should reject a signature of another key", func() {
+		otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).NotTo(HaveOccurred())
+
+		payload := payloadFor(dgst)
+		Expect(verifier.VerifyPayload(dgst, payload, sign(otherKey, payload))).NotTo(Succeed())
+	})
+
+	It("should reject a signature of another image", func() {
+		payload := payloadFor(digest.FromString("other"))
+		Expect(verifier.VerifyPayload(dgst, payload, sign(key, payload))).NotTo(Succeed())
+	})
+
+	It("should fail without keys", func() {
+		keyFile := filepath.Join(GinkgoT().TempDir(), "empty.pub")
+		Expect(os.WriteFile(keyFile, nil, 0600)).To(Succeed())
+
+		_, err := oci.NewCosignVerifier(keyFile)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should only fail the verification if the signature tag is missing", func() {
+		const sigRef = "example.org/image:sha256-0.sig"
+
+		err := oci.SignatureResolveError(sigRef, fmt.Errorf("%s: %w", sigRef, errdefs.ErrNotFound))
+		Expect(err).To(MatchError(oci.ErrImageVerificationFailed))
+
+		err = oci.SignatureResolveError(sigRef, remoteerrors.ErrUnexpectedStatus{StatusCode: http.StatusUnauthorized})
+		Expect(err).To(MatchError(oci.ErrImagePullUnauthorized))
+		Expect(err).NotTo(MatchError(oci.ErrImageVerificationFailed))
+
+		By("returning transient errors as is")
+		for _, cause := range []error{
+			context.DeadlineExceeded,
+			remoteerrors.ErrUnexpectedStatus{StatusCode: http.StatusServiceUnavailable},
+		} {
+			err = oci.SignatureResolveError(sigRef, cause)
+			Expect(err).To(MatchError(cause))
+			Expect(err).NotTo(MatchError(oci.ErrImageVerificationFailed))
+			Expect(err).NotTo(MatchError(oci.ErrImagePullUnauthorized))
+		}
+	})
+})
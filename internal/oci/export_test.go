@@ -0,0 +1,19 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package oci
+
+// EvictionCandidates exposes evictionCandidates to the specs.
+var EvictionCandidates = evictionCandidates
+
+// IsUnauthorized exposes isUnauthorized to the specs.
+var IsUnauthorized = isUnauthorized
+
+// SignatureResolveError exposes signatureResolveError to the specs.
+var SignatureResolveError = signatureResolveError
+
+// PullProgress returns the func adding downloaded bytes to the progress of a pull of total bytes.
+func PullProgress(ref string, total int64, notify func(evt PullProgressEvent)) func(n int64) {
+	progress := &pullProgress{ref: ref, total: total, notify: notify}
+	return progress.add
+}
@@ -0,0 +1,190 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package oci
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/containerd/containerd/content"
+	"github.com/ironcore-dev/ironcore-image/oci/descriptormatcher"
+	"github.com/ironcore-dev/ironcore-image/utils/sets"
+	"github.com/opencontainers/go-digest"
+	ocispecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	cacheResultHit  = "hit"
+	cacheResultMiss = "miss"
+)
+
+var (
+	cacheSize = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "libvirt_provider_oci_cache_size_bytes",
+			Help: "Size of all blobs in the local oci cache.",
+		},
+	)
+	cacheRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "libvirt_provider_oci_cache_requests_total",
+			Help: "Number of image requests to the local oci cache, partitioned by result (hit or miss).",
+		},
+		[]string{"result"},
+	)
+	cacheEvictions = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "libvirt_provider_oci_cache_evictions_total",
+			Help: "Number of images evicted from the local oci cache.",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(cacheSize, cacheRequests, cacheEvictions)
+}
+
+// InUseFunc returns the refs of the images that must not be evicted from the cache.
+type InUseFunc func(ctx context.Context) (sets.Set[string], error)
+
+type evictionCandidate struct {
+	ref      string
+	lastUsed time.Time
+}
+
+// evictionCandidates returns the refs of descs which are not in use, least recently used first.
+// Refs that were not used since the start of the cache fall back to the creation time of their manifest.
+func evictionCandidates(descs []ocispecv1.Descriptor, inUse sets.Set[string], lastUsed map[string]time.Time, created map[digest.Digest]time.Time) []string {
+	var candidates []evictionCandidate
+	for _, desc := range descs {
+		ref := desc.Annotations[ocispecv1.AnnotationRefName]
+		if ref == "" || inUse.Has(ref) {
+			continue
+		}
+
+		used, ok := lastUsed[ref]
+		if !ok {
+			used = created[desc.Digest]
+		}
+		candidates = append(candidates, evictionCandidate{ref: ref, lastUsed: used})
+	}
+
+	slices.SortStableFunc(candidates, func(a, b evictionCandidate) int {
+		return a.lastUsed.Compare(b.lastUsed)
+	})
+
+	refs := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		refs = append(refs, candidate.ref)
+	}
+	return refs
+}
+
+func (c *LocalCache) touch(ref string) {
+	c.lastUsed[ref] = time.Now()
+}
+
+func (c *LocalCache) blobInfos(ctx context.Context) (map[digest.Digest]content.Info, error) {
+	infos := make(map[digest.Digest]content.Info)
+	if err := c.store.Layout().Store().Walk(ctx, func(info content.Info) error {
+		infos[info.Digest] = info
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("error walking blobs: %w", err)
+	}
+	return infos, nil
+}
+
+func (c *LocalCache) reachableBlobs(ctx context.Context, descs []ocispecv1.Descriptor) (sets.Set[digest.Digest], error) {
+	reachable := sets.New[digest.Digest]()
+	for _, desc := range descs {
+		reachable.Insert(desc.Digest)
+
+		img, err := c.store.Layout().Image(ctx, desc)
+		if err != nil {
+			return nil, fmt.Errorf("error getting image %s: %w", desc.Digest, err)
+		}
+		manifest, err := img.Manifest(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("error getting manifest of image %s: %w", desc.Digest, err)
+		}
+
+		reachable.Insert(manifest.Config.Digest)
+		for _, layer := range manifest.Layers {
+			reachable.Insert(layer.Digest)
+		}
+	}
+	return reachable, nil
+}
+
+// gc evicts the least recently used images which are not in use until the cache fits into its maximum size.
+// It has to be called from the loop and is skipped while images are pulled, as the blobs of pulls in progress
+// are not yet referenced by the index.
+func (c *LocalCache) gc(ctx context.Context, activePulls sets.Set[string]) error {
+	infos, err := c.blobInfos(ctx)
+	if err != nil {
+		return err
+	}
+
+	var size int64
+	created := make(map[digest.Digest]time.Time, len(infos))
+	for dgst, info := range infos {
+		size += info.Size
+		created[dgst] = info.CreatedAt
+	}
+	cacheSize.Set(float64(size))
+
+	if c.maxSize <= 0 || size <= c.maxSize || len(activePulls) > 0 {
+		return nil
+	}
+
+	inUse, err := c.inUse(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing images in use: %w", err)
+	}
+
+	descs, err := c.store.Layout().Indexer().List(ctx, descriptormatcher.Every)
+	if err != nil {
+		return fmt.Errorf("error listing images: %w", err)
+	}
+
+	for _, ref := range evictionCandidates(descs, inUse, c.lastUsed, created) {
+		if size <= c.maxSize {
+			break
+		}
+
+		log := c.log.WithValues("Ref", ref)
+		log.V(1).Info("Evicting image")
+		if err := c.store.Delete(ctx, ref); err != nil {
+			return fmt.Errorf("error deleting image %s: %w", ref, err)
+		}
+		delete(c.lastUsed, ref)
+		cacheEvictions.Inc()
+
+		descs = slices.DeleteFunc(descs, func(desc ocispecv1.Descriptor) bool {
+			return desc.Annotations[ocispecv1.AnnotationRefName] == ref
+		})
+		reachable, err := c.reachableBlobs(ctx, descs)
+		if err != nil {
+			return err
+		}
+
+		for dgst, info := range infos {
+			if reachable.Has(dgst) {
+				continue
+			}
+			if err := c.store.Layout().Store().Delete(ctx, dgst); err != nil {
+				return fmt.Errorf("error deleting blob %s: %w", dgst, err)
+			}
+			delete(infos, dgst)
+			size -= info.Size
+		}
+		cacheSize.Set(float64(size))
+		log.Info("Evicted image", "CacheSize", size)
+	}
+	return nil
+}
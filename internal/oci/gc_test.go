@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package oci_test
+
+import (
+	"time"
+
+	"github.com/ironcore-dev/ironcore-image/utils/sets"
+	"github.com/ironcore-dev/libvirt-provider/internal/oci"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/opencontainers/go-digest"
+	ocispecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+var _ = Describe("EvictionCandidates", func() {
+	now := time.Now()
+
+	descriptor := func(ref string) ocispecv1.Descriptor {
+		desc := ocispecv1.Descriptor{Digest: digest.FromString(ref)}
+		if ref != "" {
+			desc.Annotations = map[string]string{ocispecv1.AnnotationRefName: ref}
+		}
+		return desc
+	}
+
+	It("should order the images not in use by their last use", func() {
+		descs := []ocispecv1.Descriptor{descriptor("a"), descriptor("b"), descriptor("c"), descriptor("d")}
+		lastUsed := map[string]time.Time{
+			"a": now,
+			"b": now.Add(-time.Hour),
+			"c": now.Add(-2 * time.Hour),
+		}
+
+		Expect(oci.EvictionCandidates(descs, sets.New("c"), lastUsed, nil)).To(Equal([]string{"d", "b", "a"}))
+	})
+
+	It("should fall back to the creation of the manifest for images not used since the start", func() {
+		descs := []ocispecv1.Descriptor{descriptor("a"), descriptor("b"), descriptor("c")}
+		lastUsed := map[string]time.Time{"a": now.Add(-time.Hour)}
+		created := map[digest.Digest]time.Time{
+			descriptor("b").Digest: now.Add(-2 * time.Hour),
+			descriptor("c").Digest: now.Add(-time.Minute),
+		}
+
+		Expect(oci.EvictionCandidates(descs, sets.New[string](), lastUsed, created)).To(Equal([]string{"b", "a", "c"}))
+	})
+
+	It("should skip descriptors without ref", func() {
+		descs := []ocispecv1.Descriptor{descriptor(""), descriptor("a")}
+		Expect(oci.EvictionCandidates(descs, sets.New[string](), nil, nil)).To(Equal([]string{"a"}))
+	})
+})
@@ -8,10 +8,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
 	"sync"
 	"time"
 
 	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	remoteerrors "github.com/containerd/containerd/remotes/errors"
 	"github.com/go-logr/logr"
 	ironcoreimage "github.com/ironcore-dev/ironcore-image"
 	"github.com/ironcore-dev/ironcore-image/oci/image"
@@ -19,6 +22,7 @@ import (
 	"github.com/ironcore-dev/ironcore-image/oci/remote"
 	"github.com/ironcore-dev/ironcore-image/oci/store"
 	"github.com/ironcore-dev/ironcore-image/utils/sets"
+	"github.com/ironcore-dev/libvirt-provider/internal/inflight"
 	ocispecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
@@ -45,6 +49,20 @@ type LocalCache struct {
 
 	pullRequests chan pullRequest
 	listeners    []Listener
+
+	operations *inflight.Tracker
+
+	pullConcurrency int
+	verifier        Verifier
+
+	maxSize    int64
+	gcInterval time.Duration
+	inUse      InUseFunc
+	// gcChanged is signaled once gcInterval changed.
+	gcChanged chan struct{}
+	// lastUsed and failedPulls are only accessed by the loop.
+	lastUsed    map[string]time.Time
+	failedPulls map[string]error
 }
 
 type pullRequest struct {
@@ -58,6 +76,11 @@ type pullResult struct {
 	err   error
 }
 
+type pullDoneResult struct {
+	ref string
+	err error
+}
+
 func readImageConfig(ctx context.Context, img image.Image) (*ironcoreimage.Config, error) {
 	configLayer, err := img.Config(ctx)
 	if err != nil {
@@ -144,17 +167,55 @@ func (c *LocalCache) resolveImage(ctx context.Context, ociImg image.Image) (*Ima
 func (c *LocalCache) loop(ctx context.Context) {
 	var (
 		activePulls = sets.New[string]()
-		pullDone    = make(chan string)
+		pullDone    = make(chan pullDoneResult)
+		gcTicker    *time.Ticker
+		gcTick      <-chan time.Time
 	)
 
+	resetGCTicker := func() {
+		if gcTicker != nil {
+			gcTicker.Stop()
+			gcTicker, gcTick = nil, nil
+		}
+		c.mu.Lock()
+		gcInterval := c.gcInterval
+		c.mu.Unlock()
+		if gcInterval > 0 {
+			gcTicker = time.NewTicker(gcInterval)
+			gcTick = gcTicker.C
+		}
+	}
+	resetGCTicker()
+	defer func() {
+		if gcTicker != nil {
+			gcTicker.Stop()
+		}
+	}()
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case ref := <-pullDone:
-			activePulls.Delete(ref)
+		case <-c.gcChanged:
+			resetGCTicker()
+		case <-gcTick:
+			if err := c.gc(ctx, activePulls); err != nil {
+				c.log.Error(err, "Error garbage collecting oci cache")
+			}
+		case res := <-pullDone:
+			activePulls.Delete(res.ref)
+			if errors.Is(res.err, inflight.ErrShuttingDown) {
+				// The pull never started. It's neither a failure nor done: the machines waiting for it are
+				// reconciled again on the next start and request it anew.
+				continue
+			}
+			if res.err != nil {
+				c.failedPulls[res.ref] = res.err
+			} else {
+				c.touch(res.ref)
+			}
 			for _, listener := range c.listeners {
-				listener.HandlePullDone(PullDoneEvent{Ref: ref})
+				listener.HandlePullDone(PullDoneEvent{Ref: res.ref, Err: res.err})
 			}
 		case req := <-c.pullRequests:
 			req.ctx = setupMediaTypeKeyPrefixes(ctx)
@@ -167,20 +228,42 @@ func (c *LocalCache) loop(ctx context.Context) {
 			if err != nil {
 				if !errors.Is(err, indexer.ErrNotFound) {
 					req.res <- pullResult{err: fmt.Errorf("error pulling %s: %w", req.ref, err)}
+					continue
 				}
 
+				// Report a failed pull once, the next request pulls again.
+				if pullErr, ok := c.failedPulls[req.ref]; ok {
+					delete(c.failedPulls, req.ref)
+					req.res <- pullResult{err: fmt.Errorf("error pulling %s: %w", req.ref, pullErr)}
+					continue
+				}
+
+				cacheRequests.WithLabelValues(cacheResultMiss).Inc()
 				activePulls.Insert(req.ref)
 				go func() {
 					log := c.log.WithValues("Ref", req.ref)
+					var err error
 					defer func() {
 						select {
-						case pullDone <- req.ref:
+						case pullDone <- pullDoneResult{ref: req.ref, err: err}:
 						case <-ctx.Done():
 						}
 					}()
 
-					log.V(1).Info("Start pulling")
-					err := c.retryPullImage(ctx, req.ref)
+					var op *inflight.Operation
+					op, err = c.operations.Begin(inflight.KindImagePull, req.ref)
+					if err != nil {
+						if errors.Is(err, inflight.ErrShuttingDown) {
+							log.Info("Not pulling while shutting down, the pull is requested again on the next start")
+							return
+						}
+						log.Error(err, "Error starting pull")
+						return
+					}
+
+					log.V(1).Info("Start pulling", "Resumed", op.Resumed())
+					err = c.retryPullImage(ctx, req.ref)
+					op.Done(err)
 					if err != nil {
 						log.Error(err, "Error copying oci")
 						return
@@ -192,6 +275,8 @@ func (c *LocalCache) loop(ctx context.Context) {
 				continue
 			}
 
+			cacheRequests.WithLabelValues(cacheResultHit).Inc()
+			c.touch(req.ref)
 			img, err := c.resolveImage(req.ctx, ociImg)
 			req.res <- pullResult{image: img, err: err}
 		}
@@ -218,6 +303,10 @@ func (c *LocalCache) retryPullImage(ctx context.Context, ref string) error {
 		if err == nil {
 			return nil
 		}
+		if errors.Is(err, ErrImagePullUnauthorized) || errors.Is(err, ErrImageVerificationFailed) {
+			// Retrying won't help until the credentials or signatures are fixed.
+			return err
+		}
 		log.Error(err, "oci couldn't be pulled")
 		errs = append(errs, fmt.Errorf("trial %d of oci pull failed with: %w ", i+1, err))
 	}
@@ -225,30 +314,23 @@ func (c *LocalCache) retryPullImage(ctx context.Context, ref string) error {
 	return fmt.Errorf("exceeded max retries, oci pull failed with error(s): %v", errs)
 }
 
-func (c *LocalCache) pullImage(ctx context.Context, ref string) error {
-	sourceImg, err := image.Copy(ctx, c.store, c.registry, ref)
-	if err != nil {
-		return err
-	}
-	ociImg, err := c.store.Resolve(ctx, ref)
-	if err != nil {
-		return fmt.Errorf("error resolving ref locally %s: %w", ref, err)
-	}
-
-	srcDigest := sourceImg.Descriptor().Digest
-	copiedDigest := ociImg.Descriptor().Digest
+var (
+	ErrImagePulling = errors.New("oci pulling")
+	// ErrImagePullUnauthorized is returned if the registry denied pulling an image, e.g. as credentials are missing.
+	ErrImagePullUnauthorized = errors.New("not authorized to pull oci")
+)
 
-	if srcDigest != copiedDigest {
-		if err = c.store.Delete(ctx, ref); err != nil {
-			return fmt.Errorf("error deleting oci from local oci store %s: %w", ref, err)
-		}
-		return fmt.Errorf("oci digest verification failed for oci %s: source digest %s, copied digest %s", ref, srcDigest, copiedDigest)
+func isUnauthorized(err error) bool {
+	if errors.Is(err, docker.ErrInvalidAuthorization) {
+		return true
 	}
-	return nil
+	var statusErr remoteerrors.ErrUnexpectedStatus
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusUnauthorized || statusErr.StatusCode == http.StatusForbidden
+	}
+	return false
 }
 
-var ErrImagePulling = errors.New("oci pulling")
-
 func IgnoreImagePulling(err error) error {
 	if errors.Is(err, ErrImagePulling) {
 		return nil
@@ -291,12 +373,43 @@ func (c *LocalCache) Start(ctx context.Context) error {
 	return nil
 }
 
-func NewLocalCache(log logr.Logger, registry *remote.Registry, store *store.Store) (*LocalCache, error) {
+type LocalCacheOptions struct {
+	// PullConcurrency is the number of blobs of an image downloaded in parallel. Defaults to DefaultPullConcurrency.
+	PullConcurrency int
+	// Verifier verifies images before they are pulled. If nil, images are not verified.
+	Verifier Verifier
+	// MaxSize is the size in bytes the cache is shrunk to by evicting the least recently used images.
+	// If zero, images are never evicted.
+	MaxSize int64
+	// GCInterval is the interval the cache size is checked at. If zero, the cache is never garbage collected.
+	GCInterval time.Duration
+	// InUse reports the images which are in use, e.g. as root disk of a machine. Required if MaxSize is set.
+	InUse InUseFunc
+}
+
+// NewLocalCache creates a LocalCache. Image pulls are tracked by operations, which may be nil.
+func NewLocalCache(log logr.Logger, registry *remote.Registry, store *store.Store, operations *inflight.Tracker, opts LocalCacheOptions) (*LocalCache, error) {
+	if opts.MaxSize > 0 && opts.InUse == nil {
+		return nil, fmt.Errorf("must specify opts.InUse if opts.MaxSize is set")
+	}
+	if opts.PullConcurrency <= 0 {
+		opts.PullConcurrency = DefaultPullConcurrency
+	}
+
 	return &LocalCache{
-		log:          log,
-		store:        store,
-		registry:     registry,
-		pullRequests: make(chan pullRequest),
+		log:             log,
+		store:           store,
+		registry:        registry,
+		pullRequests:    make(chan pullRequest),
+		operations:      operations,
+		pullConcurrency: opts.PullConcurrency,
+		verifier:        opts.Verifier,
+		maxSize:         opts.MaxSize,
+		gcInterval:      opts.GCInterval,
+		gcChanged:       make(chan struct{}, 1),
+		inUse:           opts.InUse,
+		lastUsed:        make(map[string]time.Time),
+		failedPulls:     make(map[string]error),
 	}, nil
 }
 
@@ -307,14 +420,18 @@ type Cache interface {
 
 type PullDoneEvent struct {
 	Ref string
+	// Err is set if the pull failed.
+	Err error
 }
 
 type Listener interface {
 	HandlePullDone(evt PullDoneEvent)
+	HandlePullProgress(evt PullProgressEvent)
 }
 
 type ListenerFuncs struct {
-	HandlePullDoneFunc func(evt PullDoneEvent)
+	HandlePullDoneFunc     func(evt PullDoneEvent)
+	HandlePullProgressFunc func(evt PullProgressEvent)
 }
 
 func (l ListenerFuncs) HandlePullDone(evt PullDoneEvent) {
@@ -323,6 +440,12 @@ func (l ListenerFuncs) HandlePullDone(evt PullDoneEvent) {
 	}
 }
 
+func (l ListenerFuncs) HandlePullProgress(evt PullProgressEvent) {
+	if l.HandlePullProgressFunc != nil {
+		l.HandlePullProgressFunc(evt)
+	}
+}
+
 func (c *LocalCache) Get(ctx context.Context, ref string) (*Image, error) {
 	c.mu.Lock()
 	running := c.running
@@ -347,6 +470,18 @@ func (c *LocalCache) Get(ctx context.Context, ref string) (*Image, error) {
 	return res.image, res.err
 }
 
+// SetGCInterval changes the interval the cache size is checked at. If zero, the cache is not garbage collected anymore.
+func (c *LocalCache) SetGCInterval(interval time.Duration) {
+	c.mu.Lock()
+	c.gcInterval = interval
+	c.mu.Unlock()
+
+	select {
+	case c.gcChanged <- struct{}{}:
+	default:
+	}
+}
+
 func (c *LocalCache) AddListener(listener Listener) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
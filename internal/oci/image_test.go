@@ -0,0 +1,29 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package oci_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/containerd/containerd/remotes/docker"
+	remoteerrors "github.com/containerd/containerd/remotes/errors"
+	"github.com/ironcore-dev/libvirt-provider/internal/oci"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("IsUnauthorized", func() {
+	DescribeTable("classifying pull errors",
+		func(err error, unauthorized bool) {
+			Expect(oci.IsUnauthorized(err)).To(Equal(unauthorized))
+		},
+		Entry("invalid authorization", fmt.Errorf("error resolving: %w", docker.ErrInvalidAuthorization), true),
+		Entry("unauthorized status", remoteerrors.ErrUnexpectedStatus{StatusCode: http.StatusUnauthorized}, true),
+		Entry("forbidden status", fmt.Errorf("error fetching: %w", remoteerrors.ErrUnexpectedStatus{StatusCode: http.StatusForbidden}), true),
+		Entry("other status", remoteerrors.ErrUnexpectedStatus{StatusCode: http.StatusInternalServerError}, false),
+		Entry("other error", errors.New("connection refused"), false),
+	)
+})
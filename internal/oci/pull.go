@@ -0,0 +1,181 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package oci
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/remotes"
+	"github.com/ironcore-dev/ironcore-image/oci/image"
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultPullConcurrency is the default number of blobs of an image that are downloaded in parallel.
+const DefaultPullConcurrency = 3
+
+// PullProgressEvent reports the progress of a pull in steps of 10%.
+type PullProgressEvent struct {
+	Ref        string
+	Percent    int
+	Bytes      int64
+	TotalBytes int64
+}
+
+type pullProgress struct {
+	mu       sync.Mutex
+	ref      string
+	total    int64
+	done     int64
+	reported int
+
+	notify func(evt PullProgressEvent)
+}
+
+func (p *pullProgress) add(n int64) {
+	if n <= 0 || p.total <= 0 {
+		return
+	}
+
+	p.mu.Lock()
+	p.done += n
+	percent := int(p.done * 100 / p.total)
+	if percent/10 <= p.reported/10 {
+		p.mu.Unlock()
+		return
+	}
+	p.reported = percent
+	evt := PullProgressEvent{Ref: p.ref, Percent: percent, Bytes: p.done, TotalBytes: p.total}
+	p.mu.Unlock()
+
+	p.notify(evt)
+}
+
+// progressWriter counts the bytes written to a blob.
+type progressWriter struct {
+	content.Writer
+	progress *pullProgress
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.progress.add(int64(n))
+	return n, err
+}
+
+func (c *LocalCache) notifyPullProgress(evt PullProgressEvent) {
+	c.mu.Lock()
+	listeners := c.listeners
+	c.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener.HandlePullProgress(evt)
+	}
+}
+
+// writeBlob downloads the blob of the layer into the local store.
+// Partial downloads of a previous run are resumed, since blobs are ingested under a stable ref.
+func (c *LocalCache) writeBlob(ctx context.Context, layer image.Layer, progress *pullProgress) error {
+	desc := layer.Descriptor()
+	w, err := content.OpenWriter(ctx, c.store.Layout().Store(), content.WithRef(remotes.MakeRefKey(ctx, desc)), content.WithDescriptor(desc))
+	if err != nil {
+		if errdefs.IsAlreadyExists(err) {
+			progress.add(desc.Size)
+			return nil
+		}
+		return fmt.Errorf("error opening writer: %w", err)
+	}
+	defer func() { _ = w.Close() }()
+
+	status, err := w.Status()
+	if err != nil {
+		return fmt.Errorf("error getting writer status: %w", err)
+	}
+	if status.Offset > 0 {
+		c.log.V(1).Info("Resuming blob download", "Digest", desc.Digest, "Offset", status.Offset)
+		progress.add(status.Offset)
+	}
+
+	rc, err := layer.Content(ctx)
+	if err != nil {
+		return fmt.Errorf("error getting content: %w", err)
+	}
+	defer func() { _ = rc.Close() }()
+
+	if err := content.Copy(ctx, &progressWriter{Writer: w, progress: progress}, rc, desc.Size, desc.Digest); err != nil {
+		return fmt.Errorf("error copying content: %w", err)
+	}
+	return nil
+}
+
+// pullImage downloads the config and layers of the image in parallel before adding the image to the store.
+func (c *LocalCache) pullImage(ctx context.Context, ref string) error {
+	err := c.doPullImage(ctx, ref)
+	if err != nil && isUnauthorized(err) {
+		return fmt.Errorf("%w: %w", ErrImagePullUnauthorized, err)
+	}
+	return err
+}
+
+func (c *LocalCache) doPullImage(ctx context.Context, ref string) error {
+	sourceImg, err := c.registry.Resolve(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	if c.verifier != nil {
+		if err := c.verifier.Verify(ctx, c.registry, ref, sourceImg); err != nil {
+			return err
+		}
+	}
+
+	// The last layer is the manifest, which is written by the store once all blobs are present.
+	layers, err := image.AsWriteLayers(ctx, sourceImg)
+	if err != nil {
+		return fmt.Errorf("error getting layers of %s: %w", ref, err)
+	}
+	blobs := layers[:len(layers)-1]
+
+	progress := &pullProgress{ref: ref, notify: c.notifyPullProgress}
+	for _, blob := range blobs {
+		progress.total += blob.Descriptor().Size
+	}
+
+	g, blobCtx := errgroup.WithContext(ctx)
+	g.SetLimit(c.pullConcurrency)
+	for _, blob := range blobs {
+		g.Go(func() error {
+			if err := c.writeBlob(blobCtx, blob, progress); err != nil {
+				return fmt.Errorf("error writing blob %s: %w", blob.Descriptor().Digest, err)
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	if err := c.store.Push(ctx, ref, sourceImg); err != nil {
+		return fmt.Errorf("error pushing to ref %s: %w", ref, err)
+	}
+
+	ociImg, err := c.store.Resolve(ctx, ref)
+	if err != nil {
+		return fmt.Errorf("error resolving ref locally %s: %w", ref, err)
+	}
+
+	srcDigest := sourceImg.Descriptor().Digest
+	copiedDigest := ociImg.Descriptor().Digest
+
+	if srcDigest != copiedDigest {
+		if err = c.store.Delete(ctx, ref); err != nil {
+			return fmt.Errorf("error deleting oci from local oci store %s: %w", ref, err)
+		}
+		return fmt.Errorf("oci digest verification failed for oci %s: source digest %s, copied digest %s", ref, srcDigest, copiedDigest)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package oci_test
+
+import (
+	"github.com/ironcore-dev/libvirt-provider/internal/oci"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PullProgress", func() {
+	var events []oci.PullProgressEvent
+
+	BeforeEach(func() {
+		events = nil
+	})
+
+	notify := func(evt oci.PullProgressEvent) {
+		events = append(events, evt)
+	}
+
+	It("should report the progress in steps of 10%", func() {
+		add := oci.PullProgress("example.org/image", 1000, notify)
+		for _, n := range []int64{50, 60, 5, 300, 585} {
+			add(n)
+		}
+
+		Expect(events).To(Equal([]oci.PullProgressEvent{
+			{Ref: "example.org/image", Percent: 11, Bytes: 110, TotalBytes: 1000},
+			{Ref: "example.org/image", Percent: 41, Bytes: 415, TotalBytes: 1000},
+			{Ref: "example.org/image", Percent: 100, Bytes: 1000, TotalBytes: 1000},
+		}))
+	})
+
+	It("should not report the progress of pulls of unknown size", func() {
+		add := oci.PullProgress("example.org/image", 0, notify)
+		add(100)
+		Expect(events).To(BeEmpty())
+	})
+})
@@ -0,0 +1,52 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package oci
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/distribution/reference"
+)
+
+// LoadWarmList reads the image references of a warm list, one per line. Empty lines and lines starting
+// with # are ignored, duplicates are dropped.
+func LoadWarmList(reader io.Reader) ([]string, error) {
+	var (
+		refs []string
+		seen = make(map[string]struct{})
+	)
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		ref := strings.TrimSpace(scanner.Text())
+		if ref == "" || strings.HasPrefix(ref, "#") {
+			continue
+		}
+		if _, err := reference.ParseNormalizedNamed(ref); err != nil {
+			return nil, fmt.Errorf("invalid image reference %q in line %d: %w", ref, line, err)
+		}
+		if _, ok := seen[ref]; ok {
+			continue
+		}
+		seen[ref] = struct{}{}
+		refs = append(refs, ref)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading warm list: %w", err)
+	}
+	return refs, nil
+}
+
+func LoadWarmListFile(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open warm list file (%s): %w", filename, err)
+	}
+	defer func() { _ = file.Close() }()
+
+	return LoadWarmList(file)
+}
@@ -0,0 +1,33 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package oci_test
+
+import (
+	"strings"
+
+	"github.com/ironcore-dev/libvirt-provider/internal/oci"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LoadWarmList", func() {
+	It("should load the image references, ignoring comments, empty lines and duplicates", func() {
+		refs, err := oci.LoadWarmList(strings.NewReader(`# base images
+ghcr.io/ironcore-dev/os-images/gardenlinux:1443
+
+  ghcr.io/ironcore-dev/os-images/ubuntu:24.04
+ghcr.io/ironcore-dev/os-images/gardenlinux:1443
+`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(refs).To(Equal([]string{
+			"ghcr.io/ironcore-dev/os-images/gardenlinux:1443",
+			"ghcr.io/ironcore-dev/os-images/ubuntu:24.04",
+		}))
+	})
+
+	It("should reject invalid image references", func() {
+		_, err := oci.LoadWarmList(strings.NewReader("ghcr.io/ironcore-dev/os-images/gardenlinux:1443\nNot A Reference\n"))
+		Expect(err).To(MatchError(ContainSubstring("line 2")))
+	})
+})
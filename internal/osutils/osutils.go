@@ -49,3 +49,19 @@ func WriteFileIfNoFileExists(name string, data []byte, perm os.FileMode) error {
 	}
 	return os.WriteFile(name, data, perm)
 }
+
+// DataPipe returns the read end of a pipe holding data, e.g. to pass a secret to a child process
+// via exec.Cmd.ExtraFiles instead of its arguments. The caller has to close the returned file.
+func DataPipe(data []byte) (*os.File, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = w.Close() }()
+
+	if _, err := w.Write(data); err != nil {
+		_ = r.Close()
+		return nil, err
+	}
+	return r, nil
+}
@@ -0,0 +1,153 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package pci
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// ErrInsufficientDevices is returned if there are not enough free devices of a resource.
+var ErrInsufficientDevices = errors.New("insufficient pci devices")
+
+// Address is the address of a host PCI device.
+type Address struct {
+	Domain   uint
+	Bus      uint
+	Slot     uint
+	Function uint
+}
+
+// ParseAddress parses a PCI address in the form domain:bus:slot.function, e.g. 0000:65:00.0.
+func ParseAddress(addr string) (Address, error) {
+	var address Address
+	if _, err := fmt.Sscanf(addr, "%x:%x:%x.%x", &address.Domain, &address.Bus, &address.Slot, &address.Function); err != nil {
+		return Address{}, fmt.Errorf("expected domain:bus:slot.function, got %q", addr)
+	}
+	return address, nil
+}
+
+func (a Address) String() string {
+	return fmt.Sprintf("%04x:%02x:%02x.%x", a.Domain, a.Bus, a.Slot, a.Function)
+}
+
+// Device is a host PCI device that can be passed through to machines.
+type Device struct {
+	// Resource is the name machines request the device by, e.g. nvidia.com/gpu.
+	Resource string
+	Address  Address
+}
+
+// ParseDevices parses devices in the form resource=address, e.g. nvidia.com/gpu=0000:65:00.0.
+func ParseDevices(specs []string) ([]Device, error) {
+	var devices []Device
+	for _, spec := range specs {
+		resource, addr, ok := strings.Cut(spec, "=")
+		if !ok || resource == "" {
+			return nil, fmt.Errorf("expected resource=address, got %q", spec)
+		}
+
+		address, err := ParseAddress(addr)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, Device{Resource: resource, Address: address})
+	}
+	return devices, nil
+}
+
+// ParseRequests parses the number of requested devices per resource in the form resource=count[,resource=count].
+func ParseRequests(value string) (map[string]int, error) {
+	requests := make(map[string]int)
+	if value == "" {
+		return requests, nil
+	}
+
+	for _, request := range strings.Split(value, ",") {
+		resource, countValue, ok := strings.Cut(strings.TrimSpace(request), "=")
+		if !ok || resource == "" {
+			return nil, fmt.Errorf("expected resource=count, got %q", request)
+		}
+
+		count, err := strconv.Atoi(countValue)
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("invalid count of resource %s: %q", resource, countValue)
+		}
+		requests[resource] += count
+	}
+	return requests, nil
+}
+
+// Source hands out the configured host PCI devices to machines. It is stateless, the devices in use are
+// determined by the machines they are allocated to.
+type Source struct {
+	devices []Device
+}
+
+func NewSource(devices []Device) (*Source, error) {
+	addresses := sets.New[Address]()
+	for _, device := range devices {
+		if addresses.Has(device.Address) {
+			return nil, fmt.Errorf("pci device %s configured multiple times", device.Address)
+		}
+		addresses.Insert(device.Address)
+	}
+	return &Source{devices: slices.Clone(devices)}, nil
+}
+
+// Devices returns the configured devices.
+func (s *Source) Devices() []Device {
+	return slices.Clone(s.devices)
+}
+
+// Allocate returns the devices of a machine requesting the given number of devices per resource. The current
+// devices of the machine are kept as far as they are still requested, further devices are allocated from the
+// devices not in use. It fails with ErrInsufficientDevices if there are not enough free devices.
+func (s *Source) Allocate(requests map[string]int, current []api.PCIDeviceSpec, inUse sets.Set[string]) ([]api.PCIDeviceSpec, error) {
+	var devices []api.PCIDeviceSpec
+	kept := make(map[string]int)
+	for _, device := range current {
+		if kept[device.Resource] < requests[device.Resource] {
+			devices = append(devices, device)
+			kept[device.Resource]++
+		}
+	}
+
+	taken := sets.New[string]()
+	for _, device := range devices {
+		taken.Insert(device.Address)
+	}
+
+	resources := make([]string, 0, len(requests))
+	for resource := range requests {
+		resources = append(resources, resource)
+	}
+	slices.Sort(resources)
+
+	for _, resource := range resources {
+		missing := requests[resource] - kept[resource]
+		for _, device := range s.devices {
+			if missing == 0 {
+				break
+			}
+			address := device.Address.String()
+			if device.Resource != resource || inUse.Has(address) || taken.Has(address) {
+				continue
+			}
+			devices = append(devices, api.PCIDeviceSpec{Resource: resource, Address: address})
+			taken.Insert(address)
+			missing--
+		}
+		if missing > 0 {
+			return nil, fmt.Errorf("%w: %d more devices of resource %s requested than available", ErrInsufficientDevices, missing, resource)
+		}
+	}
+	return devices, nil
+}
@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package pci_test
+
+import (
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/pci"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+var _ = Describe("Source", func() {
+	var source *pci.Source
+
+	BeforeEach(func() {
+		devices, err := pci.ParseDevices([]string{
+			"nvidia.com/gpu=0000:65:00.0",
+			"nvidia.com/gpu=0000:66:00.0",
+			"example.com/fpga=0000:b1:00.1",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		source, err = pci.NewSource(devices)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should parse requests", func() {
+		Expect(pci.ParseRequests("nvidia.com/gpu=2, example.com/fpga=1")).To(Equal(map[string]int{
+			"nvidia.com/gpu":   2,
+			"example.com/fpga": 1,
+		}))
+		_, err := pci.ParseRequests("nvidia.com/gpu")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reject devices configured multiple times", func() {
+		devices, err := pci.ParseDevices([]string{"a=0000:65:00.0", "b=0000:65:00.0"})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = pci.NewSource(devices)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should allocate free devices and keep the current ones", func() {
+		current := []api.PCIDeviceSpec{{Resource: "nvidia.com/gpu", Address: "0000:66:00.0"}}
+		devices, err := source.Allocate(map[string]int{"nvidia.com/gpu": 2, "example.com/fpga": 1}, current, sets.New("0000:66:00.0"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(devices).To(ConsistOf(
+			api.PCIDeviceSpec{Resource: "nvidia.com/gpu", Address: "0000:66:00.0"},
+			api.PCIDeviceSpec{Resource: "nvidia.com/gpu", Address: "0000:65:00.0"},
+			api.PCIDeviceSpec{Resource: "example.com/fpga", Address: "0000:b1:00.1"},
+		))
+	})
+
+	It("should release devices no longer requested", func() {
+		current := []api.PCIDeviceSpec{{Resource: "nvidia.com/gpu", Address: "0000:66:00.0"}}
+		Expect(source.Allocate(map[string]int{}, current, sets.New[string]())).To(BeEmpty())
+	})
+
+	It("should fail if devices are in use", func() {
+		_, err := source.Allocate(map[string]int{"nvidia.com/gpu": 2}, nil, sets.New("0000:65:00.0"))
+		Expect(err).To(MatchError(pci.ErrInsufficientDevices))
+	})
+})
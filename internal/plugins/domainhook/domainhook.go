@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package domainhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"libvirt.org/go/libvirtxml"
+)
+
+// Hook mutates the domain of a machine after the provider generated it and before it is created in libvirt,
+// e.g. to add site-specific devices.
+type Hook interface {
+	Name() string
+	MutateDomain(ctx context.Context, machine *api.Machine, domain *libvirtxml.Domain) error
+}
+
+// Apply runs the hooks in order. Hooks must not change the name or UUID of the domain.
+func Apply(ctx context.Context, hooks []Hook, machine *api.Machine, domain *libvirtxml.Domain) error {
+	name, uuid := domain.Name, domain.UUID
+	for _, hook := range hooks {
+		if err := hook.MutateDomain(ctx, machine, domain); err != nil {
+			return fmt.Errorf("domain hook %s failed: %w", hook.Name(), err)
+		}
+		if domain.Name != name || domain.UUID != uuid {
+			return fmt.Errorf("domain hook %s must not change the name or uuid of the domain", hook.Name())
+		}
+	}
+	return nil
+}
+
+const (
+	// EnvMachineID is the environment variable passing the machine id to executable hooks.
+	EnvMachineID = "LIBVIRT_PROVIDER_MACHINE_ID"
+	// EnvMachineClass is the environment variable passing the machine class to executable hooks.
+	EnvMachineClass = "LIBVIRT_PROVIDER_MACHINE_CLASS"
+)
+
+// DefaultExecTimeout is the default time an executable hook may take.
+const DefaultExecTimeout = 10 * time.Second
+
+type execHook struct {
+	path    string
+	timeout time.Duration
+}
+
+// NewExecHook returns a hook running the executable at path. The executable reads the domain XML from
+// stdin and writes the mutated domain XML to stdout. Writing nothing keeps the domain as it is.
+// The executable fails the creation of the domain by exiting with a non-zero code.
+func NewExecHook(path string, timeout time.Duration) Hook {
+	if timeout <= 0 {
+		timeout = DefaultExecTimeout
+	}
+	return &execHook{path: path, timeout: timeout}
+}
+
+func (h *execHook) Name() string {
+	return filepath.Base(h.path)
+}
+
+func (h *execHook) MutateDomain(ctx context.Context, machine *api.Machine, domain *libvirtxml.Domain) error {
+	domainXMLData, err := domain.Marshal()
+	if err != nil {
+		return fmt.Errorf("error marshalling domain: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	class, _ := api.GetClassLabel(machine)
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, h.path)
+	cmd.Env = append(os.Environ(),
+		EnvMachineID+"="+machine.ID,
+		EnvMachineClass+"="+class,
+	)
+	cmd.Stdin = strings.NewReader(domainXMLData)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error running %s: %w: %s", h.path, err, strings.TrimSpace(stderr.String()))
+	}
+
+	if len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+		return nil
+	}
+
+	mutated := &libvirtxml.Domain{}
+	if err := mutated.Unmarshal(stdout.String()); err != nil {
+		return fmt.Errorf("error unmarshalling domain written by %s: %w", h.path, err)
+	}
+	*domain = *mutated
+	return nil
+}
@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package domainhook_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/plugins/domainhook"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"libvirt.org/go/libvirtxml"
+)
+
+var _ = Describe("Exec hook", func() {
+	var (
+		machine *api.Machine
+		domain  *libvirtxml.Domain
+	)
+
+	BeforeEach(func() {
+		machine = &api.Machine{Metadata: api.Metadata{ID: "foo"}}
+		domain = &libvirtxml.Domain{
+			Name:    "foo",
+			UUID:    "0e4b9e4b-2dd6-4c4a-a6e1-2a3c1b7f3c1d",
+			Type:    "kvm",
+			Devices: &libvirtxml.DomainDeviceList{},
+		}
+	})
+
+	writeHook := func(script string) string {
+		path := filepath.Join(GinkgoT().TempDir(), "hook")
+		Expect(os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755)).To(Succeed())
+		return path
+	}
+
+	It("should apply the domain written by the executable", func(ctx SpecContext) {
+		hook := domainhook.NewExecHook(writeHook(`sed "s|</devices>|<watchdog model=\"i6300esb\" action=\"$`+domainhook.EnvMachineID+`\"/></devices>|"`), 0)
+
+		Expect(domainhook.Apply(ctx, []domainhook.Hook{hook}, machine, domain)).To(Succeed())
+		Expect(domain.Devices.Watchdogs).To(ConsistOf(SatisfyAll(
+			HaveField("Model", "i6300esb"),
+			HaveField("Action", "foo"),
+		)))
+	})
+
+	It("should keep the domain if the executable writes nothing", func(ctx SpecContext) {
+		hook := domainhook.NewExecHook(writeHook("cat > /dev/null"), 0)
+
+		Expect(domainhook.Apply(ctx, []domainhook.Hook{hook}, machine, domain)).To(Succeed())
+		Expect(domain.Type).To(Equal("kvm"))
+	})
+
+	It("should fail if the executable fails", func(ctx SpecContext) {
+		hook := domainhook.NewExecHook(writeHook("echo rejected >&2; exit 1"), 0)
+
+		Expect(domainhook.Apply(ctx, []domainhook.Hook{hook}, machine, domain)).To(MatchError(ContainSubstring("rejected")))
+	})
+
+	It("should reject hooks changing the uuid of the domain", func(ctx SpecContext) {
+		hook := domainhook.NewExecHook(writeHook(`sed "s|<uuid>.*</uuid>|<uuid>00000000-0000-0000-0000-000000000000</uuid>|"`), 0)
+
+		Expect(domainhook.Apply(ctx, []domainhook.Hook{hook}, machine, domain)).To(MatchError(ContainSubstring("must not change")))
+	})
+})
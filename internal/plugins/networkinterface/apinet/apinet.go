@@ -62,12 +62,28 @@ func (p *Plugin) Init(host providerhost.Host) error {
 	return nil
 }
 
-func ironcoreIPsToAPInetIPs(ips []string) []apinet.IP {
-	res := make([]apinet.IP, len(ips))
-	for i, ip := range ips {
-		res[i] = apinet.MustParseIP(ip)
+// Validate ensures the network interface requests no MTU, as the provider doesn't configure the host devices of
+// apinet network interfaces, and has at most one IP per family, like apinet network interfaces. The MTU is checked
+// here only, so network interfaces accepted before keep being applied, without their MTU.
+func (p *Plugin) Validate(spec *api.NetworkInterfaceSpec) error {
+	if err := providernetworkinterface.ValidateNoMTU(spec, pluginAPInet); err != nil {
+		return err
+	}
+	_, err := providernetworkinterface.DualStackIPs(spec)
+	return err
+}
+
+func ironcoreIPsToAPInetIPs(spec *api.NetworkInterfaceSpec) ([]apinet.IP, error) {
+	addrs, err := providernetworkinterface.DualStackIPs(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]apinet.IP, len(addrs))
+	for i, addr := range addrs {
+		res[i] = apinet.NewIP(addr)
 	}
-	return res
+	return res, nil
 }
 
 type apiNetNetworkInterfaceConfig struct {
@@ -112,6 +128,11 @@ func (p *Plugin) Apply(ctx context.Context, spec *api.NetworkInterfaceSpec, mach
 		return nil, err
 	}
 
+	ips, err := ironcoreIPsToAPInetIPs(spec)
+	if err != nil {
+		return nil, err
+	}
+
 	apinetNamespace, apinetNetworkName, _, _, err := provider.ParseNetworkID(spec.NetworkId)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing ApiNet NetworkID %s: %w", spec.NetworkId, err)
@@ -140,7 +161,7 @@ func (p *Plugin) Apply(ctx context.Context, spec *api.NetworkInterfaceSpec, mach
 			NodeRef: corev1.LocalObjectReference{
 				Name: p.nodeName,
 			},
-			IPs: ironcoreIPsToAPInetIPs(spec.Ips),
+			IPs: ips,
 		},
 	}
 
@@ -190,8 +211,7 @@ func (p *Plugin) Apply(ctx context.Context, spec *api.NetworkInterfaceSpec, mach
 	log.V(1).Info("Host device is ready", "HostDevice", hostDev)
 	nicIPs := make([]net.IP, 0, len(apinetNic.Spec.IPs))
 	for _, apinetNicIP := range apinetNic.Spec.IPs {
-		// TODO: do proper IP type conversion here
-		nicIPs = append(nicIPs, net.ParseIP(apinetNicIP.String()))
+		nicIPs = append(nicIPs, net.IP(apinetNicIP.Unmap().AsSlice()))
 	}
 	return &providernetworkinterface.NetworkInterface{
 		Handle: provider.GetNetworkInterfaceID(
@@ -302,3 +322,18 @@ func (p *Plugin) Delete(ctx context.Context, computeNicName string, machineID st
 func (p *Plugin) Name() string {
 	return pluginAPInet
 }
+
+func (p *Plugin) Options() map[string]string {
+	return map[string]string{
+		"node-name": p.nodeName,
+	}
+}
+
+// CheckHealth checks that the apinet api server is reachable. Lacking permissions to list network interfaces
+// across namespaces still proves that.
+func (p *Plugin) CheckHealth(ctx context.Context) error {
+	if err := p.apinetClient.List(ctx, &apinetv1alpha1.NetworkInterfaceList{}, client.Limit(1)); err != nil && !apierrors.IsForbidden(err) {
+		return fmt.Errorf("error reaching apinet: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package apinet_test
+
+import (
+	"github.com/ironcore-dev/libvirt-provider/api"
+	providernetworkinterface "github.com/ironcore-dev/libvirt-provider/internal/plugins/networkinterface"
+	. "github.com/ironcore-dev/libvirt-provider/internal/plugins/networkinterface/apinet"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("APInet", func() {
+	DescribeTable("Validate",
+		func(spec *api.NetworkInterfaceSpec, expectedErr string) {
+			err := GetAPInetPlugin().Validate(spec)
+			if expectedErr == "" {
+				Expect(err).NotTo(HaveOccurred())
+				return
+			}
+			Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+		},
+		Entry("dual-stack network interface",
+			&api.NetworkInterfaceSpec{Name: "nic", Ips: []string{"10.0.0.1", "fd00::1"}}, ""),
+		Entry("network interface requesting an mtu",
+			&api.NetworkInterfaceSpec{Name: "nic", Attributes: map[string]string{providernetworkinterface.AttributeMTU: "9000"}},
+			"not supported by the apinet plugin"),
+	)
+})
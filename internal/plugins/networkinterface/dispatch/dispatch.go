@@ -0,0 +1,155 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ironcore-dev/libvirt-provider/api"
+	providerhost "github.com/ironcore-dev/libvirt-provider/internal/host"
+	providernetworkinterface "github.com/ironcore-dev/libvirt-provider/internal/plugins/networkinterface"
+)
+
+// AttributePlugin is the network interface attribute selecting the plugin handling a network interface, e.g.
+// "providernet". Network interfaces without it are handled by the default plugin.
+const AttributePlugin = "plugin"
+
+const (
+	perm     = 0777
+	filePerm = 0666
+
+	// pluginFile records the plugin handling a network interface in its directory, so it is deleted by the same
+	// plugin even if its attributes are gone.
+	pluginFile = "plugin"
+)
+
+type plugin struct {
+	host          providerhost.Host
+	defaultPlugin providernetworkinterface.Plugin
+	plugins       map[string]providernetworkinterface.Plugin
+}
+
+// NewPlugin returns a plugin dispatching every network interface to the plugin selected by its AttributePlugin,
+// or to defaultPlugin.
+func NewPlugin(defaultPlugin providernetworkinterface.Plugin, plugins ...providernetworkinterface.Plugin) (providernetworkinterface.Plugin, error) {
+	p := &plugin{
+		defaultPlugin: defaultPlugin,
+		plugins:       map[string]providernetworkinterface.Plugin{defaultPlugin.Name(): defaultPlugin},
+	}
+	for _, plugin := range plugins {
+		if _, ok := p.plugins[plugin.Name()]; ok {
+			return nil, fmt.Errorf("plugin %q specified more than once", plugin.Name())
+		}
+		p.plugins[plugin.Name()] = plugin
+	}
+	return p, nil
+}
+
+func (p *plugin) Init(host providerhost.Host) error {
+	p.host = host
+	for name, plugin := range p.plugins {
+		if err := plugin.Init(host); err != nil {
+			return fmt.Errorf("failed to initialize plugin %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+func (p *plugin) pluginFor(name string) (providernetworkinterface.Plugin, error) {
+	if name == "" {
+		return p.defaultPlugin, nil
+	}
+	plugin, ok := p.plugins[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown network interface plugin %q", name)
+	}
+	return plugin, nil
+}
+
+func (p *plugin) pluginFile(machineID, networkInterfaceName string) string {
+	return filepath.Join(p.host.MachineNetworkInterfaceDir(machineID, networkInterfaceName), pluginFile)
+}
+
+func (p *plugin) Apply(ctx context.Context, spec *api.NetworkInterfaceSpec, machine *api.Machine) (*providernetworkinterface.NetworkInterface, error) {
+	plugin, err := p.pluginFor(spec.Attributes[AttributePlugin])
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(p.host.MachineNetworkInterfaceDir(machine.ID, spec.Name), perm); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(p.pluginFile(machine.ID, spec.Name), []byte(plugin.Name()), filePerm); err != nil {
+		return nil, fmt.Errorf("error recording plugin of network interface: %w", err)
+	}
+
+	return plugin.Apply(ctx, spec, machine)
+}
+
+// Validate validates the network interface with the plugin it selects, if that plugin is a validator.
+func (p *plugin) Validate(spec *api.NetworkInterfaceSpec) error {
+	plugin, err := p.pluginFor(spec.Attributes[AttributePlugin])
+	if err != nil {
+		return err
+	}
+	if validator, ok := plugin.(providernetworkinterface.Validator); ok {
+		return validator.Validate(spec)
+	}
+	return nil
+}
+
+func (p *plugin) Delete(ctx context.Context, computeNicName string, machineID string) error {
+	data, err := os.ReadFile(p.pluginFile(machineID, computeNicName))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error reading plugin of network interface: %w", err)
+	}
+
+	// Network interfaces applied before the plugin was recorded were handled by the default plugin.
+	plugin, err := p.pluginFor(strings.TrimSpace(string(data)))
+	if err != nil {
+		return err
+	}
+	return plugin.Delete(ctx, computeNicName, machineID)
+}
+
+// Name returns the names of the plugins, the default plugin first.
+func (p *plugin) Name() string {
+	names := []string{p.defaultPlugin.Name()}
+	for name := range p.plugins {
+		if name != p.defaultPlugin.Name() {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names[1:])
+	return strings.Join(names, ",")
+}
+
+// PluginOptions returns the options of all plugins reporting them, by plugin name.
+func (p *plugin) PluginOptions() map[string]map[string]string {
+	options := make(map[string]map[string]string)
+	for _, plugin := range p.plugins {
+		maps.Copy(options, providernetworkinterface.PluginOptions(plugin))
+	}
+	return options
+}
+
+// CheckHealth checks the health of all plugins depending on external services.
+func (p *plugin) CheckHealth(ctx context.Context) error {
+	var errs []error
+	for name, plugin := range p.plugins {
+		if checker, ok := plugin.(providernetworkinterface.HealthChecker); ok {
+			if err := checker.CheckHealth(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("plugin %s: %w", name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
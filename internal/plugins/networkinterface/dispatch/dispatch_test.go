@@ -0,0 +1,95 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package dispatch_test
+
+import (
+	"context"
+
+	"github.com/ironcore-dev/libvirt-provider/api"
+	providerhost "github.com/ironcore-dev/libvirt-provider/internal/host"
+	providernetworkinterface "github.com/ironcore-dev/libvirt-provider/internal/plugins/networkinterface"
+	. "github.com/ironcore-dev/libvirt-provider/internal/plugins/networkinterface/dispatch"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type fakePlugin struct {
+	name    string
+	options map[string]string
+	applied []string
+	deleted []string
+}
+
+func (p *fakePlugin) Name() string                      { return p.name }
+func (p *fakePlugin) Init(host providerhost.Host) error { return nil }
+func (p *fakePlugin) Options() map[string]string        { return p.options }
+
+func (p *fakePlugin) Apply(ctx context.Context, spec *api.NetworkInterfaceSpec, machine *api.Machine) (*providernetworkinterface.NetworkInterface, error) {
+	p.applied = append(p.applied, spec.Name)
+	return &providernetworkinterface.NetworkInterface{Handle: p.name}, nil
+}
+
+func (p *fakePlugin) Delete(ctx context.Context, computeNicName string, machineID string) error {
+	p.deleted = append(p.deleted, computeNicName)
+	return nil
+}
+
+var _ = Describe("Dispatch", func() {
+	var (
+		defaultPlugin, sriovPlugin *fakePlugin
+		plugin                     providernetworkinterface.Plugin
+		machine                    *api.Machine
+	)
+
+	BeforeEach(func() {
+		host, err := providerhost.NewAt(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+
+		defaultPlugin = &fakePlugin{name: "providernet", options: map[string]string{"port-security": "true"}}
+		sriovPlugin = &fakePlugin{name: "sriov"}
+		plugin, err = NewPlugin(defaultPlugin, sriovPlugin)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(plugin.Init(host)).To(Succeed())
+
+		machine = &api.Machine{Metadata: api.Metadata{ID: "machine"}}
+	})
+
+	It("should dispatch network interfaces to the plugin of their attribute", func() {
+		nic, err := plugin.Apply(context.TODO(), &api.NetworkInterfaceSpec{Name: "default"}, machine)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nic.Handle).To(Equal("providernet"))
+
+		nic, err = plugin.Apply(context.TODO(), &api.NetworkInterfaceSpec{Name: "vf", Attributes: map[string]string{AttributePlugin: "sriov"}}, machine)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nic.Handle).To(Equal("sriov"))
+
+		Expect(defaultPlugin.applied).To(ConsistOf("default"))
+		Expect(sriovPlugin.applied).To(ConsistOf("vf"))
+	})
+
+	It("should delete network interfaces with the plugin that applied them", func() {
+		_, err := plugin.Apply(context.TODO(), &api.NetworkInterfaceSpec{Name: "vf", Attributes: map[string]string{AttributePlugin: "sriov"}}, machine)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(plugin.Delete(context.TODO(), "vf", machine.ID)).To(Succeed())
+		Expect(plugin.Delete(context.TODO(), "unknown", machine.ID)).To(Succeed())
+		Expect(sriovPlugin.deleted).To(ConsistOf("vf"))
+		Expect(defaultPlugin.deleted).To(ConsistOf("unknown"))
+	})
+
+	It("should reject unknown plugins", func() {
+		_, err := plugin.Apply(context.TODO(), &api.NetworkInterfaceSpec{Name: "vf", Attributes: map[string]string{AttributePlugin: "unknown"}}, machine)
+		Expect(err).To(MatchError(ContainSubstring(`unknown network interface plugin "unknown"`)))
+	})
+
+	It("should name all plugins", func() {
+		Expect(plugin.Name()).To(Equal("providernet,sriov"))
+	})
+	It("should report the options of all plugins", func() {
+		Expect(providernetworkinterface.PluginOptions(plugin)).To(Equal(map[string]map[string]string{
+			"providernet": {"port-security": "true"},
+			"sriov":       nil,
+		}))
+	})
+})
@@ -5,7 +5,9 @@ package isolated
 
 import (
 	"context"
+	"net/netip"
 	"os"
+	"strconv"
 
 	"github.com/ironcore-dev/libvirt-provider/api"
 	providerhost "github.com/ironcore-dev/libvirt-provider/internal/host"
@@ -17,12 +19,34 @@ const (
 	pluginIsolated = "isolated"
 )
 
+const (
+	ipv4PrefixLength = 24
+	ipv6PrefixLength = 64
+)
+
 type plugin struct {
-	host providerhost.Host
+	host      providerhost.Host
+	assignIPs bool
 }
 
-func NewPlugin() providernetworkinterface.Plugin {
-	return &plugin{}
+// NewPlugin returns a plugin attaching network interfaces to a user mode network private to the machine. If
+// assignIPs is set, the guest gets the IPs of its network interfaces via DHCP.
+func NewPlugin(assignIPs bool) providernetworkinterface.Plugin {
+	return &plugin{assignIPs: assignIPs}
+}
+
+// Validate ensures the network interface requests no MTU, as the user mode network keeps its default one, and has
+// at most one IP per family if IPs are assigned to guests. The MTU is checked here only, so network interfaces
+// accepted before keep being applied, without their MTU.
+func (p *plugin) Validate(spec *api.NetworkInterfaceSpec) error {
+	if err := providernetworkinterface.ValidateNoMTU(spec, pluginIsolated); err != nil {
+		return err
+	}
+	if !p.assignIPs {
+		return nil
+	}
+	_, err := providernetworkinterface.DualStackIPs(spec)
+	return err
 }
 
 func (p *plugin) Init(host providerhost.Host) error {
@@ -31,12 +55,27 @@ func (p *plugin) Init(host providerhost.Host) error {
 }
 
 func (p *plugin) Apply(ctx context.Context, spec *api.NetworkInterfaceSpec, machine *api.Machine) (*providernetworkinterface.NetworkInterface, error) {
+	isolated := &providernetworkinterface.Isolated{}
+	if p.assignIPs {
+		addrs, err := providernetworkinterface.DualStackIPs(spec)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			prefixLength := ipv4PrefixLength
+			if addr.Is6() {
+				prefixLength = ipv6PrefixLength
+			}
+			isolated.IPs = append(isolated.IPs, netip.PrefixFrom(addr, prefixLength))
+		}
+	}
+
 	if err := os.MkdirAll(p.host.MachineNetworkInterfaceDir(machine.ID, spec.Name), perm); err != nil {
 		return nil, err
 	}
 
 	return &providernetworkinterface.NetworkInterface{
-		Isolated: &providernetworkinterface.Isolated{},
+		Isolated: isolated,
 	}, nil
 }
 
@@ -47,3 +86,9 @@ func (p *plugin) Delete(ctx context.Context, computeNicName string, machineID st
 func (p *plugin) Name() string {
 	return pluginIsolated
 }
+
+func (p *plugin) Options() map[string]string {
+	return map[string]string{
+		"assign-ips": strconv.FormatBool(p.assignIPs),
+	}
+}
@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package isolated_test
+
+import (
+	"context"
+	"net/netip"
+
+	"github.com/ironcore-dev/libvirt-provider/api"
+	providerhost "github.com/ironcore-dev/libvirt-provider/internal/host"
+	providernetworkinterface "github.com/ironcore-dev/libvirt-provider/internal/plugins/networkinterface"
+	. "github.com/ironcore-dev/libvirt-provider/internal/plugins/networkinterface/isolated"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Isolated", func() {
+	var (
+		plugin  providernetworkinterface.Plugin
+		machine *api.Machine
+	)
+
+	BeforeEach(func() {
+		host, err := providerhost.NewAt(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+
+		plugin = NewPlugin(true)
+		Expect(plugin.Init(host)).To(Succeed())
+
+		machine = &api.Machine{Metadata: api.Metadata{ID: "machine"}}
+	})
+
+	It("should assign the ips of the network interface", func() {
+		nic, err := plugin.Apply(context.TODO(), &api.NetworkInterfaceSpec{Name: "nic", Ips: []string{"10.0.0.1", "fd00::1"}}, machine)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nic.Isolated.IPs).To(Equal([]netip.Prefix{
+			netip.MustParsePrefix("10.0.0.1/24"),
+			netip.MustParsePrefix("fd00::1/64"),
+		}))
+	})
+
+	It("should reject network interfaces requesting an mtu", func() {
+		spec := &api.NetworkInterfaceSpec{Name: "nic", Attributes: map[string]string{providernetworkinterface.AttributeMTU: "9000"}}
+		Expect(plugin.(providernetworkinterface.Validator).Validate(spec)).To(MatchError(ContainSubstring("not supported by the isolated plugin")))
+	})
+
+	It("should apply network interfaces accepted with an mtu before, without the mtu", func() {
+		spec := &api.NetworkInterfaceSpec{Name: "nic", Attributes: map[string]string{providernetworkinterface.AttributeMTU: "9000"}}
+		nic, err := plugin.Apply(context.TODO(), spec, machine)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nic.Isolated).NotTo(BeNil())
+	})
+})
@@ -7,6 +7,10 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
 
 	computev1alpha1 "github.com/ironcore-dev/ironcore/api/compute/v1alpha1"
 	networkingv1alpha1 "github.com/ironcore-dev/ironcore/api/networking/v1alpha1"
@@ -88,6 +92,153 @@ func GetSpec(ctx context.Context, c client.Reader, namespace, machineName string
 	}, nil
 }
 
+// AttributeMTU is the network interface attribute requesting the MTU of a network interface, e.g. 9000 for
+// jumbo frames.
+const AttributeMTU = "mtu"
+
+const (
+	minMTU = 68
+	maxMTU = 65535
+)
+
+// MTU returns the MTU requested by the attributes of the network interface, or zero if there is none.
+func MTU(spec *api.NetworkInterfaceSpec) (uint, error) {
+	value, ok := spec.Attributes[AttributeMTU]
+	if !ok {
+		return 0, nil
+	}
+
+	mtu, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || mtu < minMTU || mtu > maxMTU {
+		return 0, fmt.Errorf("invalid mtu %q of network interface %s, expected %d to %d", value, spec.Name, minMTU, maxMTU)
+	}
+	return uint(mtu), nil
+}
+
+// ValidateNoMTU returns an error if the network interface requests an MTU, for plugins that cannot honour it.
+func ValidateNoMTU(spec *api.NetworkInterfaceSpec, plugin string) error {
+	if _, err := MTU(spec); err != nil {
+		return err
+	}
+	if _, ok := spec.Attributes[AttributeMTU]; ok {
+		return fmt.Errorf("mtu of network interface %s is not supported by the %s plugin", spec.Name, plugin)
+	}
+	return nil
+}
+
+const (
+	// AttributeVLANs is the network interface attribute requesting a VLAN trunk with the given comma-separated
+	// VLAN tags, e.g. "100,200".
+	AttributeVLANs = "vlans"
+	// AttributeNativeVLAN is the network interface attribute requesting the VLAN untagged traffic of the guest
+	// belongs to, e.g. 100. It is added to the tags of the trunk.
+	AttributeNativeVLAN = "native-vlan"
+)
+
+const (
+	minVLAN = 1
+	maxVLAN = 4094
+)
+
+// VLAN is a VLAN trunk of a network interface.
+type VLAN struct {
+	// Tags are the VLAN tags the guest may use.
+	Tags []uint
+	// Native is the tag of the untagged traffic of the guest, if any. It is one of Tags.
+	Native *uint
+}
+
+// VLANs returns the VLAN trunk requested by the attributes of the network interface, or nil if there is none.
+func VLANs(spec *api.NetworkInterfaceSpec) (*VLAN, error) {
+	tags, hasTags := spec.Attributes[AttributeVLANs]
+	native, hasNative := spec.Attributes[AttributeNativeVLAN]
+	if !hasTags && !hasNative {
+		return nil, nil
+	}
+
+	vlan := &VLAN{}
+	if hasTags {
+		for _, value := range strings.Split(tags, ",") {
+			tag, err := parseVLAN(spec.Name, strings.TrimSpace(value))
+			if err != nil {
+				return nil, err
+			}
+			if slices.Contains(vlan.Tags, tag) {
+				return nil, fmt.Errorf("duplicate vlan %d of network interface %s", tag, spec.Name)
+			}
+			vlan.Tags = append(vlan.Tags, tag)
+		}
+	}
+	if hasNative {
+		tag, err := parseVLAN(spec.Name, native)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(vlan.Tags, tag) {
+			vlan.Tags = append(vlan.Tags, tag)
+		}
+		vlan.Native = &tag
+	}
+	return vlan, nil
+}
+
+func parseVLAN(networkInterfaceName, value string) (uint, error) {
+	tag, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || tag < minVLAN || tag > maxVLAN {
+		return 0, fmt.Errorf("invalid vlan %q of network interface %s, expected %d to %d", value, networkInterfaceName, minVLAN, maxVLAN)
+	}
+	return uint(tag), nil
+}
+
+// AttributePortSecurity is the network interface attribute enabling ("true") or disabling ("false") the
+// anti-spoofing filter of a network interface, overriding the default of the plugin. The filter only supports
+// IPv4, network interfaces with IPv6 addresses have to disable it.
+const AttributePortSecurity = "port-security"
+
+// PortSecurityEnabled returns whether the attributes of the network interface enable port security, or
+// defaultEnabled if they don't say.
+func PortSecurityEnabled(spec *api.NetworkInterfaceSpec, defaultEnabled bool) (bool, error) {
+	value, ok := spec.Attributes[AttributePortSecurity]
+	if !ok {
+		return defaultEnabled, nil
+	}
+
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid port security %q of network interface %s, expected a boolean", value, spec.Name)
+	}
+	return enabled, nil
+}
+
+// UnsupportedIPsError is returned by plugins for network interfaces with IPs they can't configure.
+type UnsupportedIPsError struct {
+	NetworkInterfaceName string
+	IPs                  []string
+	Reason               string
+}
+
+func (e *UnsupportedIPsError) Error() string {
+	return fmt.Sprintf("unsupported ips %v of network interface %s: %s", e.IPs, e.NetworkInterfaceName, e.Reason)
+}
+
+// DualStackIPs parses the IPs of the network interface, which may be at most one IPv4 and one IPv6 address.
+// IPv4-mapped IPv6 addresses are treated as IPv4 addresses.
+func DualStackIPs(spec *api.NetworkInterfaceSpec) ([]netip.Addr, error) {
+	var addrs []netip.Addr
+	for _, ip := range spec.Ips {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return nil, &UnsupportedIPsError{NetworkInterfaceName: spec.Name, IPs: spec.Ips, Reason: fmt.Sprintf("invalid ip %q", ip)}
+		}
+		addr = addr.Unmap()
+		if slices.ContainsFunc(addrs, func(other netip.Addr) bool { return other.Is4() == addr.Is4() }) {
+			return nil, &UnsupportedIPsError{NetworkInterfaceName: spec.Name, IPs: spec.Ips, Reason: "at most one ip per family is supported"}
+		}
+		addrs = append(addrs, addr)
+	}
+	return addrs, nil
+}
+
 type Plugin interface {
 	Name() string
 	Init(host providerhost.Host) error
@@ -96,6 +247,41 @@ type Plugin interface {
 	Delete(ctx context.Context, computeNicName string, machineID string) error
 }
 
+// Validator is implemented by plugins supporting only some network interfaces, e.g. only dual-stack IPs. It
+// allows rejecting network interfaces before machines are created or network interfaces are attached.
+type Validator interface {
+	Validate(spec *api.NetworkInterfaceSpec) error
+}
+
+// OptionsReporter is implemented by plugins with options, which are reported by Status and Version as part of the
+// provider configuration, so misconfigured hosts can be detected.
+type OptionsReporter interface {
+	Options() map[string]string
+}
+
+// PluginOptionsReporter is implemented by plugins dispatching to further plugins, reporting the options of those
+// by plugin name.
+type PluginOptionsReporter interface {
+	PluginOptions() map[string]map[string]string
+}
+
+// PluginOptions returns the options of the plugin, or of the plugins it dispatches to, by plugin name.
+func PluginOptions(plugin Plugin) map[string]map[string]string {
+	switch reporter := plugin.(type) {
+	case PluginOptionsReporter:
+		return reporter.PluginOptions()
+	case OptionsReporter:
+		return map[string]map[string]string{plugin.Name(): reporter.Options()}
+	default:
+		return nil
+	}
+}
+
+// HealthChecker is implemented by plugins depending on external services, checking the services are reachable.
+type HealthChecker interface {
+	CheckHealth(ctx context.Context) error
+}
+
 type NetworkInterface struct {
 	Handle          string
 	HostDevice      *HostDevice
@@ -104,10 +290,26 @@ type NetworkInterface struct {
 	IPs             []net.IP
 }
 
-type Isolated struct{}
+type Isolated struct {
+	// IPs are handed out to the guest by the DHCP and NDP responder of the user mode network, if any.
+	IPs []netip.Prefix
+}
 
 type ProviderNetwork struct {
 	NetworkName string
+	// MTU is the MTU of the host-side link and of the guest. If zero, the MTU of the network applies.
+	MTU uint
+	// VLAN is the VLAN trunk of the network interface, if any.
+	VLAN *VLAN
+	// PortSecurity restricts the traffic of the guest to its addresses, if set.
+	PortSecurity *PortSecurity
+}
+
+// PortSecurity restricts the traffic of a network interface to its MAC address and IPs, so guests can't spoof
+// the addresses of other guests.
+type PortSecurity struct {
+	// IPs are the IPv4 addresses the guest may use. If empty, the first address the guest uses is learned.
+	IPs []netip.Addr
 }
 
 type HostDevice struct {
@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package networkinterface_test
+
+import (
+	"github.com/ironcore-dev/libvirt-provider/api"
+	. "github.com/ironcore-dev/libvirt-provider/internal/plugins/networkinterface"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Plugins", func() {
+	nicWithMTU := func(mtu string) *api.NetworkInterfaceSpec {
+		spec := &api.NetworkInterfaceSpec{Name: "nic"}
+		if mtu != "" {
+			spec.Attributes = map[string]string{AttributeMTU: mtu}
+		}
+		return spec
+	}
+
+	DescribeTable("MTU",
+		func(mtu string, expected uint, expectedErr string) {
+			actual, err := MTU(nicWithMTU(mtu))
+			if expectedErr != "" {
+				Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+				return
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(actual).To(Equal(expected))
+		},
+		Entry("not requested", "", uint(0), ""),
+		Entry("jumbo frames", "9000", uint(9000), ""),
+		Entry("minimum", "68", uint(68), ""),
+		Entry("maximum", "65535", uint(65535), ""),
+		Entry("below the minimum", "67", uint(0), `invalid mtu "67"`),
+		Entry("above the maximum", "65536", uint(0), `invalid mtu "65536"`),
+		Entry("no number", "jumbo", uint(0), `invalid mtu "jumbo"`),
+	)
+
+	DescribeTable("ValidateNoMTU",
+		func(mtu string, expectedErr string) {
+			err := ValidateNoMTU(nicWithMTU(mtu), "test")
+			if expectedErr == "" {
+				Expect(err).NotTo(HaveOccurred())
+				return
+			}
+			Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+		},
+		Entry("not requested", "", ""),
+		Entry("requested", "9000", "not supported by the test plugin"),
+		Entry("invalid", "0", `invalid mtu "0"`),
+	)
+})
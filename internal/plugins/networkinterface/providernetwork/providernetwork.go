@@ -5,7 +5,10 @@ package providernetwork
 
 import (
 	"context"
+	"fmt"
+	"net/netip"
 	"os"
+	"strconv"
 
 	"github.com/ironcore-dev/libvirt-provider/api"
 	providerhost "github.com/ironcore-dev/libvirt-provider/internal/host"
@@ -18,11 +21,14 @@ const (
 )
 
 type plugin struct {
-	host providerhost.Host
+	host         providerhost.Host
+	portSecurity bool
 }
 
-func NewPlugin() providernetworkinterface.Plugin {
-	return &plugin{}
+// NewPlugin returns a plugin attaching network interfaces to libvirt networks. portSecurity is the default of
+// the AttributePortSecurity of network interfaces.
+func NewPlugin(portSecurity bool) providernetworkinterface.Plugin {
+	return &plugin{portSecurity: portSecurity}
 }
 
 func (p *plugin) Init(host providerhost.Host) error {
@@ -31,17 +37,63 @@ func (p *plugin) Init(host providerhost.Host) error {
 }
 
 func (p *plugin) Apply(ctx context.Context, spec *api.NetworkInterfaceSpec, machine *api.Machine) (*providernetworkinterface.NetworkInterface, error) {
+	mtu, err := providernetworkinterface.MTU(spec)
+	if err != nil {
+		return nil, err
+	}
+	vlan, err := providernetworkinterface.VLANs(spec)
+	if err != nil {
+		return nil, err
+	}
+	portSecurity, err := p.portSecurityFor(spec)
+	if err != nil {
+		return nil, err
+	}
+
 	if err := os.MkdirAll(p.host.MachineNetworkInterfaceDir(machine.ID, spec.Name), perm); err != nil {
 		return nil, err
 	}
 
 	return &providernetworkinterface.NetworkInterface{
 		ProviderNetwork: &providernetworkinterface.ProviderNetwork{
-			NetworkName: spec.NetworkId,
+			NetworkName:  spec.NetworkId,
+			MTU:          mtu,
+			VLAN:         vlan,
+			PortSecurity: portSecurity,
 		},
 	}, nil
 }
 
+func (p *plugin) portSecurityFor(spec *api.NetworkInterfaceSpec) (*providernetworkinterface.PortSecurity, error) {
+	enabled, err := providernetworkinterface.PortSecurityEnabled(spec, p.portSecurity)
+	if err != nil || !enabled {
+		return nil, err
+	}
+
+	portSecurity := &providernetworkinterface.PortSecurity{}
+	var ipv6IPs []string
+	for _, ip := range spec.Ips {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ip %q of network interface %s: %w", ip, spec.Name, err)
+		}
+		if addr = addr.Unmap(); !addr.Is4() {
+			ipv6IPs = append(ipv6IPs, ip)
+			continue
+		}
+		portSecurity.IPs = append(portSecurity.IPs, addr)
+	}
+	// The anti-spoofing filter of libvirt drops all IPv6 traffic, so IPv6 addresses would be unreachable.
+	if len(ipv6IPs) > 0 {
+		return nil, &providernetworkinterface.UnsupportedIPsError{
+			NetworkInterfaceName: spec.Name,
+			IPs:                  ipv6IPs,
+			Reason:               fmt.Sprintf("port security only supports ipv4, disable it with the %s attribute", providernetworkinterface.AttributePortSecurity),
+		}
+	}
+	return portSecurity, nil
+}
+
 func (p *plugin) Delete(ctx context.Context, computeNicName string, machineID string) error {
 	return os.RemoveAll(p.host.MachineNetworkInterfaceDir(machineID, computeNicName))
 }
@@ -49,3 +101,9 @@ func (p *plugin) Delete(ctx context.Context, computeNicName string, machineID st
 func (p *plugin) Name() string {
 	return pluginProvidernet
 }
+
+func (p *plugin) Options() map[string]string {
+	return map[string]string{
+		"port-security": strconv.FormatBool(p.portSecurity),
+	}
+}
@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package providernetwork_test
+
+import (
+	"context"
+	"net/netip"
+
+	"github.com/ironcore-dev/libvirt-provider/api"
+	providerhost "github.com/ironcore-dev/libvirt-provider/internal/host"
+	providernetworkinterface "github.com/ironcore-dev/libvirt-provider/internal/plugins/networkinterface"
+	. "github.com/ironcore-dev/libvirt-provider/internal/plugins/networkinterface/providernetwork"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ProviderNetwork", func() {
+	var (
+		plugin  providernetworkinterface.Plugin
+		machine *api.Machine
+	)
+
+	BeforeEach(func() {
+		host, err := providerhost.NewAt(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+
+		plugin = NewPlugin(true)
+		Expect(plugin.Init(host)).To(Succeed())
+
+		machine = &api.Machine{Metadata: api.Metadata{ID: "machine"}}
+	})
+
+	It("should restrict the traffic to the ipv4 addresses of the network interface", func() {
+		nic, err := plugin.Apply(context.TODO(), &api.NetworkInterfaceSpec{Name: "nic", NetworkId: "net", Ips: []string{"10.0.0.1", "::ffff:10.0.0.2"}}, machine)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nic.ProviderNetwork.PortSecurity).To(Equal(&providernetworkinterface.PortSecurity{
+			IPs: []netip.Addr{netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("10.0.0.2")},
+		}))
+	})
+
+	It("should reject port security for dual-stack network interfaces", func() {
+		_, err := plugin.Apply(context.TODO(), &api.NetworkInterfaceSpec{Name: "nic", NetworkId: "net", Ips: []string{"10.0.0.1", "fd00::1"}}, machine)
+		var unsupportedErr *providernetworkinterface.UnsupportedIPsError
+		Expect(err).To(BeAssignableToTypeOf(unsupportedErr))
+		Expect(err).To(MatchError(ContainSubstring("fd00::1")))
+	})
+
+	It("should attach dual-stack network interfaces with port security disabled", func() {
+		nic, err := plugin.Apply(context.TODO(), &api.NetworkInterfaceSpec{
+			Name:       "nic",
+			NetworkId:  "net",
+			Ips:        []string{"10.0.0.1", "fd00::1"},
+			Attributes: map[string]string{providernetworkinterface.AttributePortSecurity: "false"},
+		}, machine)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nic.ProviderNetwork.PortSecurity).To(BeNil())
+	})
+	It("should apply the mtu requested by the network interface", func() {
+		nic, err := plugin.Apply(context.TODO(), &api.NetworkInterfaceSpec{
+			Name:       "nic",
+			NetworkId:  "net",
+			Attributes: map[string]string{providernetworkinterface.AttributeMTU: "9000"},
+		}, machine)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nic.ProviderNetwork.MTU).To(BeEquivalentTo(9000))
+	})
+
+	It("should reject invalid mtus", func() {
+		_, err := plugin.Apply(context.TODO(), &api.NetworkInterfaceSpec{
+			Name:       "nic",
+			NetworkId:  "net",
+			Attributes: map[string]string{providernetworkinterface.AttributeMTU: "10"},
+		}, machine)
+		Expect(err).To(MatchError(ContainSubstring(`invalid mtu "10"`)))
+	})
+})
@@ -6,11 +6,15 @@ package ceph
 import (
 	"context"
 	"fmt"
-	"net"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/go-logr/logr"
 	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/event/machineevent"
 	"github.com/ironcore-dev/libvirt-provider/internal/plugins/volume"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/utils/ptr"
 )
 
@@ -25,11 +29,27 @@ const (
 	secretUserIDKey  = "userID"
 	secretUserKeyKey = "userKey"
 
-	secretEncryptionKey = "encryptionKey"
+	secretEncryptionKey = volume.EncryptionKeyDataKey
 )
 
+type Options struct {
+	// MonitorProbeTimeout is the timeout for probing the reachability of monitors when applying a volume.
+	// Reachable monitors are preferred. The reachability is cached for a minute. Probing is disabled if zero.
+	MonitorProbeTimeout time.Duration
+	// EventRecorder records unreachable monitors as machine events. May be nil.
+	EventRecorder machineevent.EventRecorder
+}
+
 type plugin struct {
 	host volume.Host
+
+	// monitorProber is nil if probing is disabled.
+	monitorProber *monitorProber
+	eventRecorder machineevent.EventRecorder
+
+	// unreachableMonitors holds the unreachable monitors last reported per machine volume.
+	unreachableMonitorsMu sync.Mutex
+	unreachableMonitors   map[string]string
 }
 
 type volumeData struct {
@@ -41,8 +61,15 @@ type volumeData struct {
 	encryptionKey *string
 }
 
-func NewPlugin() volume.Plugin {
-	return &plugin{}
+func NewPlugin(opts Options) volume.Plugin {
+	p := &plugin{
+		eventRecorder:       opts.EventRecorder,
+		unreachableMonitors: make(map[string]string),
+	}
+	if opts.MonitorProbeTimeout > 0 {
+		p.monitorProber = newMonitorProber(opts.MonitorProbeTimeout)
+	}
+	return p
 }
 
 func (p *plugin) Init(host volume.Host) error {
@@ -54,6 +81,16 @@ func (p *plugin) Name() string {
 	return pluginName
 }
 
+func (p *plugin) Options() map[string]string {
+	var probeTimeout time.Duration
+	if p.monitorProber != nil {
+		probeTimeout = p.monitorProber.timeout
+	}
+	return map[string]string{
+		"monitor-probe-timeout": probeTimeout.String(),
+	}
+}
+
 func (p *plugin) GetBackingVolumeID(spec *api.VolumeSpec) (string, error) {
 	storage := spec.Connection
 	if storage == nil {
@@ -109,12 +146,12 @@ func readVolumeAttributes(attrs map[string]string) (monitors []volume.CephMonito
 	monitorsParts := strings.Split(monitorsString, ",")
 	monitors = make([]volume.CephMonitor, 0, len(monitorsParts))
 	for _, monitorsPart := range monitorsParts {
-		host, port, err := net.SplitHostPort(monitorsPart)
+		monitor, err := parseMonitor(monitorsPart)
 		if err != nil {
 			return nil, "", fmt.Errorf("[monitor %s] error splitting host / port: %w", monitorsPart, err)
 		}
 
-		monitors = append(monitors, volume.CephMonitor{Name: host, Port: port})
+		monitors = append(monitors, monitor)
 	}
 
 	image, ok = attrs[volumeAttributeImageKey]
@@ -143,6 +180,12 @@ func (p *plugin) Apply(ctx context.Context, spec *api.VolumeSpec, machine *api.M
 		return nil, fmt.Errorf("failed to get volume size: %w", err)
 	}
 
+	if p.monitorProber != nil {
+		var unreachable []volume.CephMonitor
+		volumeData.monitors, unreachable = p.monitorProber.probe(ctx, volumeData.monitors)
+		p.reportUnreachableMonitors(ctx, machine, spec.Name, unreachable)
+	}
+
 	return &volume.Volume{
 		QCow2File: "",
 		RawFile:   "",
@@ -200,6 +243,32 @@ func (p *plugin) getVolumeData(spec *api.VolumeSpec) (vData *volumeData, err err
 	return vData, nil
 }
 
+// reportUnreachableMonitors records a machine event if the unreachable monitors of a volume changed.
+func (p *plugin) reportUnreachableMonitors(ctx context.Context, machine *api.Machine, volumeName string, unreachable []volume.CephMonitor) {
+	key := machine.ID + "/" + volumeName
+	addrs := strings.Join(monitorAddresses(unreachable), ",")
+
+	p.unreachableMonitorsMu.Lock()
+	last := p.unreachableMonitors[key]
+	if addrs == "" {
+		delete(p.unreachableMonitors, key)
+	} else {
+		p.unreachableMonitors[key] = addrs
+	}
+	p.unreachableMonitorsMu.Unlock()
+
+	if addrs == "" || addrs == last || p.eventRecorder == nil {
+		return
+	}
+
+	log := logr.FromContextOrDiscard(ctx)
+	p.eventRecorder.Eventf(log, machine.Metadata, corev1.EventTypeWarning, machineevent.ReasonUnreachableCephMonitors, "Ceph monitors of volume %s are unreachable: %s", volumeName, addrs)
+}
+
 func (p *plugin) Delete(ctx context.Context, computeVolumeName string, machineID string) error {
+	p.unreachableMonitorsMu.Lock()
+	defer p.unreachableMonitorsMu.Unlock()
+
+	delete(p.unreachableMonitors, machineID+"/"+computeVolumeName)
 	return nil
 }
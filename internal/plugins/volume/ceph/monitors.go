@@ -0,0 +1,158 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package ceph
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ironcore-dev/libvirt-provider/internal/plugins/volume"
+)
+
+const (
+	// monitorPortV1 is the default port of the legacy messenger protocol.
+	monitorPortV1 = "6789"
+	// monitorPortV2 is the default port of the msgr2 protocol. Ceph clients use msgr2 when connecting to it.
+	monitorPortV2 = "3300"
+
+	monitorProtocolV1Prefix = "v1:"
+	monitorProtocolV2Prefix = "v2:"
+)
+
+// parseMonitor parses a monitor address of the form [v1:|v2:]host[:port][/nonce].
+// Without port, the default port of the protocol is used, i.e. 3300 for msgr2 and 6789 otherwise.
+func parseMonitor(addr string) (volume.CephMonitor, error) {
+	addr, _, _ = strings.Cut(addr, "/")
+
+	defaultPort := monitorPortV1
+	switch {
+	case strings.HasPrefix(addr, monitorProtocolV2Prefix):
+		addr = strings.TrimPrefix(addr, monitorProtocolV2Prefix)
+		defaultPort = monitorPortV2
+	case strings.HasPrefix(addr, monitorProtocolV1Prefix):
+		addr = strings.TrimPrefix(addr, monitorProtocolV1Prefix)
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		var defaultErr error
+		host, port, defaultErr = net.SplitHostPort(net.JoinHostPort(strings.Trim(addr, "[]"), defaultPort))
+		if defaultErr != nil || host == "" {
+			return volume.CephMonitor{}, err
+		}
+	}
+
+	return volume.CephMonitor{Name: host, Port: port}, nil
+}
+
+// monitorProbeTTL is how long the reachability of a monitor is cached. Volumes are applied on every
+// reconciliation of their machine, which would otherwise dial their monitors each time.
+const monitorProbeTTL = time.Minute
+
+// monitorProbe is the cached reachability of a monitor.
+type monitorProbe struct {
+	reachable bool
+	probedAt  time.Time
+}
+
+// monitorProber probes the reachability of monitors and caches the results for monitorProbeTTL.
+type monitorProber struct {
+	timeout time.Duration
+	dial    func(ctx context.Context, addr string, timeout time.Duration) error
+	now     func() time.Time
+
+	mu     sync.Mutex
+	probes map[string]monitorProbe
+}
+
+func newMonitorProber(timeout time.Duration) *monitorProber {
+	return &monitorProber{
+		timeout: timeout,
+		dial:    dialMonitor,
+		now:     time.Now,
+		probes:  make(map[string]monitorProbe),
+	}
+}
+
+func dialMonitor(ctx context.Context, addr string, timeout time.Duration) error {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// cachedProbe returns whether the monitor at addr was reachable when last probed within monitorProbeTTL.
+func (p *monitorProber) cachedProbe(addr string) (reachable, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	probe, ok := p.probes[addr]
+	if !ok || p.now().Sub(probe.probedAt) >= monitorProbeTTL {
+		return false, false
+	}
+	return probe.reachable, true
+}
+
+func (p *monitorProber) setProbe(addr string, reachable bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	for cachedAddr, probe := range p.probes {
+		if now.Sub(probe.probedAt) >= monitorProbeTTL {
+			delete(p.probes, cachedAddr)
+		}
+	}
+	p.probes[addr] = monitorProbe{reachable: reachable, probedAt: now}
+}
+
+// probe dials the monitors not probed within monitorProbeTTL concurrently and returns the reachable monitors
+// followed by the unreachable ones, preserving their order otherwise.
+func (p *monitorProber) probe(ctx context.Context, monitors []volume.CephMonitor) (ordered, unreachable []volume.CephMonitor) {
+	reachable := make([]bool, len(monitors))
+
+	var wg sync.WaitGroup
+	for i, monitor := range monitors {
+		addr := net.JoinHostPort(monitor.Name, monitor.Port)
+		if cached, ok := p.cachedProbe(addr); ok {
+			reachable[i] = cached
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			reachable[i] = p.dial(ctx, addr, p.timeout) == nil
+			// Don't cache monitors deemed unreachable because the reconciliation was canceled.
+			if ctx.Err() == nil {
+				p.setProbe(addr, reachable[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	ordered = make([]volume.CephMonitor, 0, len(monitors))
+	for i, monitor := range monitors {
+		if reachable[i] {
+			ordered = append(ordered, monitor)
+		} else {
+			unreachable = append(unreachable, monitor)
+		}
+	}
+	return append(ordered, unreachable...), unreachable
+}
+
+func monitorAddresses(monitors []volume.CephMonitor) []string {
+	addrs := make([]string, 0, len(monitors))
+	for _, monitor := range monitors {
+		addrs = append(addrs, net.JoinHostPort(monitor.Name, monitor.Port))
+	}
+	return addrs
+}
@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package ceph
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ironcore-dev/libvirt-provider/internal/plugins/volume"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Monitors", func() {
+	DescribeTable("parsing monitor addresses",
+		func(addr string, expected volume.CephMonitor) {
+			Expect(parseMonitor(addr)).To(Equal(expected))
+		},
+		Entry("host and port", "10.0.0.1:6789", volume.CephMonitor{Name: "10.0.0.1", Port: "6789"}),
+		Entry("host only", "mon-a.example.org", volume.CephMonitor{Name: "mon-a.example.org", Port: monitorPortV1}),
+		Entry("msgr2 without port", "v2:10.0.0.1", volume.CephMonitor{Name: "10.0.0.1", Port: monitorPortV2}),
+		Entry("msgr2 with port and nonce", "v2:10.0.0.1:3301/0", volume.CephMonitor{Name: "10.0.0.1", Port: "3301"}),
+		Entry("legacy protocol without port", "v1:10.0.0.1/12345", volume.CephMonitor{Name: "10.0.0.1", Port: monitorPortV1}),
+		Entry("ipv6 with port", "[fd00::1]:6789", volume.CephMonitor{Name: "fd00::1", Port: "6789"}),
+		Entry("ipv6 without port", "v2:[fd00::1]", volume.CephMonitor{Name: "fd00::1", Port: monitorPortV2}),
+	)
+
+	It("should reject monitors without host", func() {
+		_, err := parseMonitor("v2:")
+		Expect(err).To(HaveOccurred())
+	})
+
+	Describe("probing", func() {
+		var (
+			prober      *monitorProber
+			now         time.Time
+			mu          sync.Mutex
+			dialed      []string
+			unreachable map[string]bool
+		)
+
+		a := volume.CephMonitor{Name: "10.0.0.1", Port: "3300"}
+		b := volume.CephMonitor{Name: "10.0.0.2", Port: "3300"}
+		c := volume.CephMonitor{Name: "10.0.0.3", Port: "3300"}
+
+		BeforeEach(func() {
+			now = time.Now()
+			dialed = nil
+			unreachable = map[string]bool{"10.0.0.1:3300": true}
+			prober = newMonitorProber(time.Second)
+			prober.now = func() time.Time { return now }
+			prober.dial = func(_ context.Context, addr string, _ time.Duration) error {
+				mu.Lock()
+				defer mu.Unlock()
+				dialed = append(dialed, addr)
+				if unreachable[addr] {
+					return errors.New("connection refused")
+				}
+				return nil
+			}
+		})
+
+		It("should put reachable monitors first", func(ctx SpecContext) {
+			ordered, unreachableMonitors := prober.probe(ctx, []volume.CephMonitor{a, b, c})
+			Expect(ordered).To(Equal([]volume.CephMonitor{b, c, a}))
+			Expect(unreachableMonitors).To(Equal([]volume.CephMonitor{a}))
+		})
+
+		It("should cache the reachability until it expired", func(ctx SpecContext) {
+			prober.probe(ctx, []volume.CephMonitor{a, b})
+			Expect(dialed).To(ConsistOf("10.0.0.1:3300", "10.0.0.2:3300"))
+
+			By("probing again within the ttl")
+			dialed = nil
+			unreachable = map[string]bool{"10.0.0.2:3300": true}
+			ordered, _ := prober.probe(ctx, []volume.CephMonitor{a, b, c})
+			Expect(dialed).To(ConsistOf("10.0.0.3:3300"))
+			Expect(ordered).To(Equal([]volume.CephMonitor{b, c, a}))
+
+			By("probing again after the ttl")
+			dialed = nil
+			now = now.Add(monitorProbeTTL)
+			ordered, _ = prober.probe(ctx, []volume.CephMonitor{a, b, c})
+			Expect(dialed).To(ConsistOf("10.0.0.1:3300", "10.0.0.2:3300", "10.0.0.3:3300"))
+			Expect(ordered).To(Equal([]volume.CephMonitor{a, c, b}))
+		})
+
+		It("should not cache probes of canceled reconciliations", func(ctx SpecContext) {
+			canceledCtx, cancel := context.WithCancel(ctx)
+			cancel()
+			prober.probe(canceledCtx, []volume.CephMonitor{b})
+
+			dialed = nil
+			prober.probe(ctx, []volume.CephMonitor{b})
+			Expect(dialed).To(ConsistOf("10.0.0.2:3300"))
+		})
+	})
+})
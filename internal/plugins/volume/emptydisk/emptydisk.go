@@ -4,6 +4,7 @@
 package emptydisk
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"encoding/hex"
@@ -11,6 +12,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"unicode/utf8"
 
 	"github.com/ironcore-dev/libvirt-provider/api"
 	"github.com/ironcore-dev/libvirt-provider/internal/plugins/volume"
@@ -26,22 +30,46 @@ const (
 
 	perm     = 0777
 	filePerm = 0666
+
+	// AttributePreallocation overrides Options.Preallocation for the empty disk of a volume connection.
+	AttributePreallocation = "preallocation"
+	// AttributeDiscard overrides Options.Discard for the empty disk of a volume connection.
+	AttributeDiscard = "discard"
 )
 
+type Options struct {
+	// Preallocation is the preallocation mode of new disks, one of raw.PreallocationModes. Defaults to raw.PreallocationOff.
+	Preallocation string
+	// Discard passes discard requests of guests through to the disks and unmaps zeroed blocks.
+	Discard bool
+}
+
 type plugin struct {
 	host  volume.Host
 	qcow2 qcow2.QCow2
 	raw   raw.Raw
+
+	preallocation string
+	discard       bool
 }
 
-func NewPlugin(qcow2 qcow2.QCow2, raw raw.Raw) volume.Plugin {
+func NewPlugin(qcow2 qcow2.QCow2, raw raw.Raw, opts Options) volume.Plugin {
 	return &plugin{
-		qcow2: qcow2,
-		raw:   raw,
+		qcow2:         qcow2,
+		raw:           raw,
+		preallocation: opts.Preallocation,
+		discard:       opts.Discard,
 	}
 }
 
 func (p *plugin) Init(host volume.Host) error {
+	if p.preallocation == "" {
+		p.preallocation = raw.PreallocationOff
+	}
+	if !slices.Contains(raw.PreallocationModes(), p.preallocation) {
+		return fmt.Errorf("unsupported preallocation mode %q", p.preallocation)
+	}
+
 	p.host = host
 	return nil
 }
@@ -50,6 +78,13 @@ func (p *plugin) Name() string {
 	return pluginName
 }
 
+func (p *plugin) Options() map[string]string {
+	return map[string]string{
+		"preallocation": p.preallocation,
+		"discard":       strconv.FormatBool(p.discard),
+	}
+}
+
 func (p *plugin) GetBackingVolumeID(volume *api.VolumeSpec) (string, error) {
 	if volume.EmptyDisk == nil {
 		return "", fmt.Errorf("volume does not specify an EmptyDisk")
@@ -81,20 +116,76 @@ func (p *plugin) Apply(ctx context.Context, spec *api.VolumeSpec, machine *api.M
 		size = defaultSize
 	}
 
+	encryption, err := readEncryption(spec.Connection)
+	if err != nil {
+		return nil, err
+	}
+
+	preallocation, discard, err := p.readAttributes(spec.Connection)
+	if err != nil {
+		return nil, err
+	}
+
 	diskFilename := p.diskFilename(spec.Name, machine.ID)
 	if _, err := os.Stat(diskFilename); err != nil {
 		if !errors.Is(err, os.ErrNotExist) {
 			return nil, fmt.Errorf("error stat-ing disk: %w", err)
 		}
 
-		if err := p.raw.Create(diskFilename, raw.WithSize(size)); err != nil {
+		opts := []raw.CreateOption{raw.WithSize(size), raw.WithPreallocation(preallocation)}
+		if encryption != nil {
+			opts = append(opts, raw.WithEncryptionKey(encryption.EncryptionKey))
+		}
+		if err := p.raw.Create(diskFilename, opts...); err != nil {
 			return nil, fmt.Errorf("error creating disk %w", err)
 		}
 		if err := os.Chmod(diskFilename, filePerm); err != nil {
 			return nil, fmt.Errorf("error changing disk file mode: %w", err)
 		}
 	}
-	return &volume.Volume{RawFile: diskFilename, Handle: handle, Size: size}, nil
+	return &volume.Volume{RawFile: diskFilename, FileEncryption: encryption, Discard: discard, Handle: handle, Size: size}, nil
+}
+
+// readAttributes reads the preallocation mode and discard setting of an empty disk from the attributes of its
+// connection, defaulting to the ones of the plugin. The preallocation mode only applies when creating the disk.
+func (p *plugin) readAttributes(connection *api.VolumeConnection) (preallocation string, discard bool, err error) {
+	preallocation, discard = p.preallocation, p.discard
+	if connection == nil {
+		return preallocation, discard, nil
+	}
+
+	if value, ok := connection.Attributes[AttributePreallocation]; ok {
+		if !slices.Contains(raw.PreallocationModes(), value) {
+			return "", false, fmt.Errorf("unsupported preallocation mode %q at %s", value, AttributePreallocation)
+		}
+		preallocation = value
+	}
+
+	if value, ok := connection.Attributes[AttributeDiscard]; ok {
+		discard, err = strconv.ParseBool(value)
+		if err != nil {
+			return "", false, fmt.Errorf("invalid %s attribute: %w", AttributeDiscard, err)
+		}
+	}
+	return preallocation, discard, nil
+}
+
+// readEncryption reads the LUKS passphrase of an encrypted empty disk from the encryption data of its connection.
+// The passphrase can't be changed once the disk has been created.
+func readEncryption(connection *api.VolumeConnection) (*volume.FileEncryption, error) {
+	if connection == nil || connection.EncryptionData == nil {
+		return nil, nil
+	}
+
+	encryptionKey, ok := connection.EncryptionData[volume.EncryptionKeyDataKey]
+	if !ok || len(encryptionKey) == 0 {
+		return nil, fmt.Errorf("no encryption key at %s", volume.EncryptionKeyDataKey)
+	}
+	// qemu reads the passphrase as UTF-8 string, which can't hold NUL bytes.
+	if !utf8.Valid(encryptionKey) || bytes.IndexByte(encryptionKey, 0) >= 0 {
+		return nil, fmt.Errorf("encryption key at %s is no valid UTF-8 string", volume.EncryptionKeyDataKey)
+	}
+	return &volume.FileEncryption{EncryptionKey: string(encryptionKey)}, nil
 }
 
 func (p *plugin) Delete(ctx context.Context, computeVolumeName string, machineID string) error {
@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package emptydisk_test
+
+import (
+	"context"
+	"os"
+
+	"github.com/ironcore-dev/libvirt-provider/api"
+	providerhost "github.com/ironcore-dev/libvirt-provider/internal/host"
+	"github.com/ironcore-dev/libvirt-provider/internal/plugins/volume"
+	. "github.com/ironcore-dev/libvirt-provider/internal/plugins/volume/emptydisk"
+	"github.com/ironcore-dev/libvirt-provider/internal/raw"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// createdDisks is a raw.Raw recording the options disks are created with.
+type createdDisks struct {
+	opts []raw.CreateOptions
+}
+
+func (d *createdDisks) Create(filename string, opts ...raw.CreateOption) error {
+	o := raw.CreateOptions{}
+	o.ApplyOptions(opts)
+	d.opts = append(d.opts, o)
+	return os.WriteFile(filename, nil, 0600)
+}
+
+var _ = Describe("EmptyDisk", func() {
+	var (
+		disks   *createdDisks
+		plugin  volume.Plugin
+		machine *api.Machine
+	)
+
+	BeforeEach(func() {
+		host, err := providerhost.NewAt(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+
+		disks = &createdDisks{}
+		plugin = NewPlugin(nil, disks, Options{})
+		Expect(plugin.Init(host)).To(Succeed())
+
+		machine = &api.Machine{Metadata: api.Metadata{ID: "machine"}}
+	})
+
+	emptyDisk := func(connection *api.VolumeConnection) *api.VolumeSpec {
+		return &api.VolumeSpec{Name: "disk", EmptyDisk: &api.EmptyDiskSpec{Size: 1024}, Connection: connection}
+	}
+
+	It("should create encrypted disks with the key of the connection", func() {
+		vol, err := plugin.Apply(context.TODO(), emptyDisk(&api.VolumeConnection{
+			EncryptionData: map[string][]byte{volume.EncryptionKeyDataKey: []byte("s3cr3t")},
+		}), machine)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vol.FileEncryption).To(Equal(&volume.FileEncryption{EncryptionKey: "s3cr3t"}))
+		Expect(disks.opts).To(ConsistOf(HaveField("EncryptionKey", "s3cr3t")))
+	})
+
+	It("should create unencrypted disks without encryption data", func() {
+		vol, err := plugin.Apply(context.TODO(), emptyDisk(&api.VolumeConnection{}), machine)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vol.FileEncryption).To(BeNil())
+		Expect(disks.opts).To(ConsistOf(HaveField("EncryptionKey", "")))
+	})
+
+	DescribeTable("rejecting invalid encryption keys",
+		func(encryptionData map[string][]byte, expectedErr string) {
+			_, err := plugin.Apply(context.TODO(), emptyDisk(&api.VolumeConnection{EncryptionData: encryptionData}), machine)
+			Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+			Expect(disks.opts).To(BeEmpty())
+		},
+		Entry("missing key", map[string][]byte{"other": []byte("s3cr3t")}, "no encryption key at encryptionKey"),
+		Entry("empty key", map[string][]byte{volume.EncryptionKeyDataKey: {}}, "no encryption key at encryptionKey"),
+		Entry("key with a NUL byte", map[string][]byte{volume.EncryptionKeyDataKey: []byte("s3c\x00r3t")}, "no valid UTF-8 string"),
+		Entry("key with invalid UTF-8", map[string][]byte{volume.EncryptionKeyDataKey: {0xff, 0xfe}}, "no valid UTF-8 string"),
+	)
+
+	DescribeTable("reading the preallocation and discard attributes",
+		func(opts Options, attributes map[string]string, preallocation string, discard bool) {
+			plugin = NewPlugin(nil, disks, opts)
+			host, err := providerhost.NewAt(GinkgoT().TempDir())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plugin.Init(host)).To(Succeed())
+
+			vol, err := plugin.Apply(context.TODO(), emptyDisk(&api.VolumeConnection{Attributes: attributes}), machine)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(vol.Discard).To(Equal(discard))
+			Expect(disks.opts).To(ConsistOf(HaveField("Preallocation", preallocation)))
+		},
+		Entry("defaults", Options{}, nil, raw.PreallocationOff, false),
+		Entry("options of the plugin", Options{Preallocation: raw.PreallocationFull, Discard: true}, nil, raw.PreallocationFull, true),
+		Entry("attributes",
+			Options{},
+			map[string]string{AttributePreallocation: raw.PreallocationFalloc, AttributeDiscard: "true"},
+			raw.PreallocationFalloc, true),
+		Entry("attributes overriding the options of the plugin",
+			Options{Preallocation: raw.PreallocationFull, Discard: true},
+			map[string]string{AttributePreallocation: raw.PreallocationMetadata, AttributeDiscard: "false"},
+			raw.PreallocationMetadata, false),
+		Entry("other attributes", Options{Discard: true}, map[string]string{"other": "value"}, raw.PreallocationOff, true),
+	)
+
+	DescribeTable("rejecting invalid attributes",
+		func(attributes map[string]string, expectedErr string) {
+			_, err := plugin.Apply(context.TODO(), emptyDisk(&api.VolumeConnection{Attributes: attributes}), machine)
+			Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+			Expect(disks.opts).To(BeEmpty())
+		},
+		Entry("unsupported preallocation mode", map[string]string{AttributePreallocation: "sparse"}, `unsupported preallocation mode "sparse"`),
+		Entry("empty preallocation mode", map[string]string{AttributePreallocation: ""}, `unsupported preallocation mode ""`),
+		Entry("invalid discard setting", map[string]string{AttributeDiscard: "unmap"}, "invalid discard attribute"),
+	)
+
+	It("should reject an unsupported preallocation mode of the plugin", func() {
+		host, err := providerhost.NewAt(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(NewPlugin(nil, disks, Options{Preallocation: "sparse"}).Init(host)).
+			To(MatchError(`unsupported preallocation mode "sparse"`))
+	})
+})
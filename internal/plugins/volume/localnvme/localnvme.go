@@ -0,0 +1,304 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package localnvme
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/plugins/volume"
+	"github.com/prometheus/client_golang/prometheus"
+	utilstrings "k8s.io/utils/strings"
+)
+
+const (
+	pluginName = "libvirt-provider.ironcore.dev/local-nvme"
+
+	// DriverName is the driver of volume connections claiming a local NVMe namespace.
+	DriverName = "local-nvme"
+
+	// AttributeMode requests a namespace passed to the guest in the given mode.
+	AttributeMode = "mode"
+
+	claimsDir = "claims"
+
+	perm     = 0777
+	filePerm = 0666
+)
+
+var namespacesGauge = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "libvirt_provider_local_nvme_namespaces",
+		Help: "Number of local NVMe namespaces, partitioned by state (free or claimed).",
+	},
+	[]string{"state"},
+)
+
+func init() {
+	prometheus.MustRegister(namespacesGauge)
+}
+
+type Options struct {
+	// NamespacesFile lists the namespaces that can be claimed, see LoadNamespacesFile.
+	// Without file, no namespaces can be claimed.
+	NamespacesFile string
+}
+
+// claim is the persisted claim of a namespace by a machine volume.
+type claim struct {
+	MachineID  string `json:"machineID"`
+	VolumeName string `json:"volumeName"`
+	Handle     string `json:"handle"`
+}
+
+type plugin struct {
+	host           volume.Host
+	namespacesFile string
+
+	mu         sync.Mutex
+	namespaces []Namespace
+	// claims holds the claims by namespace name.
+	claims map[string]claim
+}
+
+// NewPlugin creates a plugin claiming whole local NVMe namespaces for volumes with the driver DriverName.
+// Released namespaces are discarded before they are claimed again.
+func NewPlugin(opts Options) volume.Plugin {
+	return &plugin{
+		namespacesFile: opts.NamespacesFile,
+	}
+}
+
+func (p *plugin) Init(host volume.Host) error {
+	if p.namespacesFile != "" {
+		namespaces, err := LoadNamespacesFile(p.namespacesFile)
+		if err != nil {
+			return err
+		}
+		p.namespaces = namespaces
+	}
+
+	p.host = host
+
+	dir := p.claimsDir()
+	if err := os.MkdirAll(dir, perm); err != nil {
+		return fmt.Errorf("error creating claims directory: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("error reading claims directory: %w", err)
+	}
+
+	p.claims = make(map[string]claim)
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("error reading claim of namespace %s: %w", entry.Name(), err)
+		}
+
+		var c claim
+		if err := json.Unmarshal(data, &c); err != nil {
+			return fmt.Errorf("error decoding claim of namespace %s: %w", entry.Name(), err)
+		}
+		p.claims[entry.Name()] = c
+	}
+
+	p.updateMetrics()
+	return nil
+}
+
+func (p *plugin) Name() string {
+	return pluginName
+}
+
+func (p *plugin) Options() map[string]string {
+	if p.namespacesFile == "" {
+		return nil
+	}
+	return map[string]string{
+		"namespaces-file": p.namespacesFile,
+	}
+}
+
+func (p *plugin) GetBackingVolumeID(spec *api.VolumeSpec) (string, error) {
+	if !p.CanSupport(spec) {
+		return "", fmt.Errorf("volume does not specify a local nvme connection")
+	}
+
+	handle := spec.Connection.Handle
+	if handle == "" {
+		return "", fmt.Errorf("volume access does not specify handle")
+	}
+	return handle, nil
+}
+
+func (p *plugin) CanSupport(spec *api.VolumeSpec) bool {
+	return spec.Connection != nil && spec.Connection.Driver == DriverName
+}
+
+func (p *plugin) claimsDir() string {
+	return filepath.Join(p.host.PluginDir(utilstrings.EscapeQualifiedName(pluginName)), claimsDir)
+}
+
+func (p *plugin) volumeDir(computeVolumeName, machineID string) string {
+	return p.host.MachineVolumeDir(machineID, utilstrings.EscapeQualifiedName(pluginName), computeVolumeName)
+}
+
+// claimed returns the namespace claimed by the given volume, if any.
+func (p *plugin) claimed(computeVolumeName, machineID string) *Namespace {
+	for i, namespace := range p.namespaces {
+		if c, ok := p.claims[namespace.Name]; ok && c.MachineID == machineID && c.VolumeName == computeVolumeName {
+			return &p.namespaces[i]
+		}
+	}
+	return nil
+}
+
+func (p *plugin) Apply(ctx context.Context, spec *api.VolumeSpec, machine *api.Machine) (*volume.Volume, error) {
+	mode := spec.Connection.Attributes[AttributeMode]
+	if mode != "" && mode != ModeVirtioBlk && mode != ModeHostdev {
+		return nil, fmt.Errorf("unsupported mode %q at %s", mode, AttributeMode)
+	}
+
+	if spec.Connection.Handle == "" {
+		return nil, fmt.Errorf("volume access does not specify handle")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := os.MkdirAll(p.volumeDir(spec.Name, machine.ID), perm); err != nil {
+		return nil, err
+	}
+
+	namespace := p.claimed(spec.Name, machine.ID)
+	if namespace == nil {
+		var err error
+		if namespace, err = p.claim(spec.Name, machine.ID, spec.Connection.Handle, mode); err != nil {
+			return nil, err
+		}
+	}
+
+	size, err := deviceSize(namespace.Device)
+	if err != nil {
+		return nil, err
+	}
+
+	handle, err := randomHex(8)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate WWN/handle for the disk: %w", err)
+	}
+
+	vol := &volume.Volume{Handle: handle, Size: size}
+	switch namespace.Mode {
+	case ModeHostdev:
+		vol.HostDevice = namespace.hostDevice
+	default:
+		vol.BlockDevice = namespace.Device
+	}
+	return vol, nil
+}
+
+// claim claims the first free namespace of the given mode for the volume.
+func (p *plugin) claim(computeVolumeName, machineID, handle, mode string) (*Namespace, error) {
+	for i, namespace := range p.namespaces {
+		if _, ok := p.claims[namespace.Name]; ok {
+			continue
+		}
+		if mode != "" && namespace.Mode != mode {
+			continue
+		}
+
+		c := claim{MachineID: machineID, VolumeName: computeVolumeName, Handle: handle}
+		data, err := json.Marshal(c)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(filepath.Join(p.claimsDir(), namespace.Name), data, filePerm); err != nil {
+			return nil, fmt.Errorf("error persisting claim of namespace %s: %w", namespace.Name, err)
+		}
+
+		p.claims[namespace.Name] = c
+		p.updateMetrics()
+		return &p.namespaces[i], nil
+	}
+	return nil, fmt.Errorf("no free local nvme namespace")
+}
+
+func (p *plugin) Delete(ctx context.Context, computeVolumeName string, machineID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if namespace := p.claimed(computeVolumeName, machineID); namespace != nil {
+		// Discard the data of the machine, so that it is not visible to the next one.
+		if res, err := exec.CommandContext(ctx, "blkdiscard", namespace.Device).CombinedOutput(); err != nil {
+			return fmt.Errorf("error discarding namespace %s: %s, exit error %w", namespace.Name, string(res), err)
+		}
+
+		if err := os.Remove(filepath.Join(p.claimsDir(), namespace.Name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error removing claim of namespace %s: %w", namespace.Name, err)
+		}
+		delete(p.claims, namespace.Name)
+		p.updateMetrics()
+	}
+
+	return os.RemoveAll(p.volumeDir(computeVolumeName, machineID))
+}
+
+func (p *plugin) GetSize(ctx context.Context, spec *api.VolumeSpec) (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, namespace := range p.namespaces {
+		if c, ok := p.claims[namespace.Name]; ok && spec.Connection != nil && c.Handle == spec.Connection.Handle {
+			return deviceSize(namespace.Device)
+		}
+	}
+	return 0, fmt.Errorf("volume %s has not claimed a namespace", spec.Name)
+}
+
+func (p *plugin) updateMetrics() {
+	var claimed int
+	for _, namespace := range p.namespaces {
+		if _, ok := p.claims[namespace.Name]; ok {
+			claimed++
+		}
+	}
+	namespacesGauge.WithLabelValues("free").Set(float64(len(p.namespaces) - claimed))
+	namespacesGauge.WithLabelValues("claimed").Set(float64(claimed))
+}
+
+func deviceSize(device string) (int64, error) {
+	f, err := os.Open(device)
+	if err != nil {
+		return 0, fmt.Errorf("error opening device: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, fmt.Errorf("error determining size of device %s: %w", device, err)
+	}
+	return size, nil
+}
+
+// randomHex generates random hexadecimal digits of the length n*2.
+func randomHex(n int) (string, error) {
+	bytes := make([]byte, n)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
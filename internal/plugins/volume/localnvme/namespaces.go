@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package localnvme
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ironcore-dev/libvirt-provider/internal/plugins/volume"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const (
+	// ModeVirtioBlk passes the block device of a namespace to the guest as virtio-blk disk.
+	ModeVirtioBlk = "virtio-blk"
+	// ModeHostdev passes the NVMe controller of a namespace through to the guest. The controller must only
+	// have the one namespace.
+	ModeHostdev = "hostdev"
+)
+
+// Namespace is a local NVMe namespace that can be claimed by a volume.
+type Namespace struct {
+	// Name identifies the namespace in claims, e.g. its EUI.
+	Name string `json:"name"`
+	// Device is the block device of the namespace. Use a stable path, e.g. below /dev/disk/by-id.
+	Device string `json:"device"`
+	// Mode is how the namespace is passed to guests, ModeVirtioBlk by default.
+	Mode string `json:"mode,omitempty"`
+	// PCIAddress is the address of the NVMe controller in the form domain:bus:slot.function.
+	// Required for ModeHostdev.
+	PCIAddress string `json:"pciAddress,omitempty"`
+
+	hostDevice *volume.HostDevice
+}
+
+func LoadNamespaces(reader io.Reader) ([]Namespace, error) {
+	var namespaces []Namespace
+	if err := yaml.NewYAMLOrJSONDecoder(reader, 4096).Decode(&namespaces); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal local nvme namespaces: %w", err)
+	}
+
+	names := sets.New[string]()
+	for i := range namespaces {
+		namespace := &namespaces[i]
+		switch {
+		case namespace.Name == "":
+			return nil, fmt.Errorf("local nvme namespace %d does not specify a name", i)
+		case names.Has(namespace.Name):
+			return nil, fmt.Errorf("duplicate local nvme namespace %s", namespace.Name)
+		case namespace.Device == "":
+			return nil, fmt.Errorf("local nvme namespace %s does not specify a device", namespace.Name)
+		}
+		names.Insert(namespace.Name)
+
+		switch namespace.Mode {
+		case "":
+			namespace.Mode = ModeVirtioBlk
+		case ModeVirtioBlk:
+		case ModeHostdev:
+			hostDevice, err := parsePCIAddress(namespace.PCIAddress)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pci address of local nvme namespace %s: %w", namespace.Name, err)
+			}
+			namespace.hostDevice = hostDevice
+		default:
+			return nil, fmt.Errorf("unsupported mode %q of local nvme namespace %s", namespace.Mode, namespace.Name)
+		}
+	}
+
+	return namespaces, nil
+}
+
+// LoadNamespacesFile loads the namespaces from a YAML or JSON file containing a list of Namespace.
+func LoadNamespacesFile(filename string) ([]Namespace, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open local nvme namespaces file (%s): %w", filename, err)
+	}
+	defer func() { _ = file.Close() }()
+
+	return LoadNamespaces(file)
+}
+
+func parsePCIAddress(addr string) (*volume.HostDevice, error) {
+	var hostDevice volume.HostDevice
+	if _, err := fmt.Sscanf(addr, "%x:%x:%x.%x", &hostDevice.Domain, &hostDevice.Bus, &hostDevice.Slot, &hostDevice.Function); err != nil {
+		return nil, fmt.Errorf("expected domain:bus:slot.function, got %q", addr)
+	}
+	return &hostDevice, nil
+}
@@ -0,0 +1,41 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package localnvme_test
+
+import (
+	"strings"
+
+	"github.com/ironcore-dev/libvirt-provider/internal/plugins/volume/localnvme"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Namespaces", func() {
+	It("should load namespaces and default their mode", func() {
+		namespaces, err := localnvme.LoadNamespaces(strings.NewReader(`
+- name: ns0
+  device: /dev/disk/by-id/nvme-eui.0
+- name: ns1
+  device: /dev/disk/by-id/nvme-eui.1
+  mode: hostdev
+  pciAddress: "0000:5e:00.0"
+`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(namespaces).To(ConsistOf(
+			SatisfyAll(HaveField("Name", "ns0"), HaveField("Mode", localnvme.ModeVirtioBlk)),
+			SatisfyAll(HaveField("Name", "ns1"), HaveField("Mode", localnvme.ModeHostdev)),
+		))
+	})
+
+	DescribeTable("should reject invalid namespaces",
+		func(data string) {
+			_, err := localnvme.LoadNamespaces(strings.NewReader(data))
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("without device", `[{"name": "ns0"}]`),
+		Entry("duplicate names", `[{"name": "ns0", "device": "/dev/a"}, {"name": "ns0", "device": "/dev/b"}]`),
+		Entry("unsupported mode", `[{"name": "ns0", "device": "/dev/a", "mode": "vfio"}]`),
+		Entry("hostdev without pci address", `[{"name": "ns0", "device": "/dev/a", "mode": "hostdev"}]`),
+	)
+})
@@ -6,6 +6,8 @@ package volume
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
 	"sync"
 
 	"github.com/ironcore-dev/libvirt-provider/api"
@@ -30,12 +32,41 @@ type Plugin interface {
 	GetSize(ctx context.Context, spec *api.VolumeSpec) (int64, error)
 }
 
+// OptionsReporter is implemented by plugins with options, which are reported by Status and Version as part of the
+// provider configuration, so misconfigured hosts can be detected.
+type OptionsReporter interface {
+	Options() map[string]string
+}
+
+// EncryptionKeyDataKey is the key of the LUKS passphrase in the encryption data of a volume connection.
+const EncryptionKeyDataKey = "encryptionKey"
+
 type Volume struct {
 	QCow2File string
 	RawFile   string
-	CephDisk  *CephDisk
-	Handle    string
-	Size      int64
+	// FileEncryption is the LUKS encryption of QCow2File or RawFile, if any.
+	FileEncryption *FileEncryption
+	// Discard passes discard requests of the guest through to QCow2File or RawFile and unmaps zeroed blocks.
+	Discard  bool
+	CephDisk *CephDisk
+	// BlockDevice is a local block device passed to the guest as virtio-blk disk.
+	BlockDevice string
+	// HostDevice is a local PCI device, e.g. an NVMe controller, passed through to the guest.
+	HostDevice *HostDevice
+	Handle     string
+	Size       int64
+}
+
+// HostDevice is the PCI address of a host device.
+type HostDevice struct {
+	Domain   uint
+	Bus      uint
+	Slot     uint
+	Function uint
+}
+
+type FileEncryption struct {
+	EncryptionKey string
 }
 
 type CephDisk struct {
@@ -96,6 +127,28 @@ func (m *PluginManager) InitPlugins(host Host, plugins []Plugin) error {
 	return nil
 }
 
+// PluginNames returns the sorted names of all initialized plugins.
+func (m *PluginManager) PluginNames() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return slices.Sorted(maps.Keys(m.plugins))
+}
+
+// PluginOptions returns the options of the initialized plugins reporting them, by plugin name.
+func (m *PluginManager) PluginOptions() map[string]map[string]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	options := make(map[string]map[string]string)
+	for name, plugin := range m.plugins {
+		if reporter, ok := plugin.(OptionsReporter); ok {
+			options[name] = reporter.Options()
+		}
+	}
+	return options
+}
+
 func (m *PluginManager) FindPluginByName(name string) (Plugin, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
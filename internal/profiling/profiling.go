@@ -0,0 +1,312 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package profiling
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const perm = 0777
+
+const (
+	// DefaultPIDDir is the directory libvirt writes the pid files of the QEMU processes of domains to.
+	DefaultPIDDir = "/run/libvirt/qemu"
+	// DefaultMaxDuration is the default maximum duration of a profiling session.
+	DefaultMaxDuration = 5 * time.Minute
+
+	profileSuffix = ".data"
+	timeLayout    = "20060102T150405Z"
+)
+
+var (
+	// ErrSessionActive is returned if a profiling session of the machine is running already.
+	ErrSessionActive = errors.New("profiling session active")
+	// ErrNoSession is returned if there is no running profiling session of the machine.
+	ErrNoSession = errors.New("no profiling session active")
+	// ErrProfileNotFound is returned if a profile doesn't exist.
+	ErrProfileNotFound = errors.New("profile not found")
+)
+
+// Profile is a perf profile recorded of a machine.
+type Profile struct {
+	MachineID string    `json:"machineID"`
+	Name      string    `json:"name"`
+	StartedAt time.Time `json:"startedAt"`
+	// Running reports whether the profile is still being recorded.
+	Running bool `json:"running"`
+	// Size is the size of the profile in bytes once it is recorded.
+	Size int64 `json:"size,omitempty"`
+}
+
+type session struct {
+	profile Profile
+	cmd     *exec.Cmd
+	timer   *time.Timer
+	done    chan struct{}
+}
+
+// stop interrupts perf, making it write the profile, and waits for it to exit.
+func (s *session) stop() {
+	s.timer.Stop()
+	_ = s.cmd.Process.Signal(syscall.SIGINT)
+	<-s.done
+}
+
+type Options struct {
+	// Perf is the path of the perf binary. Defaults to perf.
+	Perf string
+	// PIDDir is the directory of the pid files of the QEMU processes. Defaults to DefaultPIDDir.
+	PIDDir string
+	// MaxDuration is the maximum duration of a session. Defaults to DefaultMaxDuration.
+	MaxDuration time.Duration
+}
+
+func setOptionsDefaults(o *Options) {
+	if o.Perf == "" {
+		o.Perf = "perf"
+	}
+	if o.PIDDir == "" {
+		o.PIDDir = DefaultPIDDir
+	}
+	if o.MaxDuration <= 0 {
+		o.MaxDuration = DefaultMaxDuration
+	}
+}
+
+// Profiler records the QEMU processes of machines with perf kvm, so guest performance issues can be
+// diagnosed, e.g. with flamegraphs of perf script output. Every machine has at most one running session, the
+// profiles are kept in a directory per machine until the machine is removed.
+type Profiler struct {
+	dir         string
+	perf        string
+	pidDir      string
+	maxDuration time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// NewProfiler creates a Profiler writing the profiles to dir.
+func NewProfiler(dir string, opts Options) (*Profiler, error) {
+	setOptionsDefaults(&opts)
+
+	if err := os.MkdirAll(dir, perm); err != nil {
+		return nil, fmt.Errorf("error creating profiles directory: %w", err)
+	}
+	return &Profiler{
+		dir:         dir,
+		perf:        opts.Perf,
+		pidDir:      opts.PIDDir,
+		maxDuration: opts.MaxDuration,
+		sessions:    make(map[string]*session),
+	}, nil
+}
+
+func (p *Profiler) machineDir(machineID string) string {
+	return filepath.Join(p.dir, machineID)
+}
+
+func (p *Profiler) readPID(domainName string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(p.pidDir, domainName+".pid"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, fmt.Errorf("domain %s is not running", domainName)
+		}
+		return 0, fmt.Errorf("error reading pid of domain %s: %w", domainName, err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid pid of domain %s: %w", domainName, err)
+	}
+	return pid, nil
+}
+
+// Start starts recording the QEMU process of the domain of the machine. The session stops after the given
+// duration, capped to the maximum duration. A duration <= 0 records for the maximum duration. It fails with
+// ErrSessionActive if a session of the machine is running already.
+func (p *Profiler) Start(machineID, domainName string, duration time.Duration) (Profile, error) {
+	if duration <= 0 || duration > p.maxDuration {
+		duration = p.maxDuration
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.sessions[machineID]; ok {
+		return Profile{}, fmt.Errorf("%w: machine %s", ErrSessionActive, machineID)
+	}
+
+	pid, err := p.readPID(domainName)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	if err := os.MkdirAll(p.machineDir(machineID), perm); err != nil {
+		return Profile{}, fmt.Errorf("error creating profiles directory of machine %s: %w", machineID, err)
+	}
+
+	startedAt := time.Now().UTC()
+	profile := Profile{
+		MachineID: machineID,
+		Name:      startedAt.Format(timeLayout) + profileSuffix,
+		StartedAt: startedAt,
+		Running:   true,
+	}
+
+	cmd := exec.Command(p.perf, "kvm", "--guest", "record", "-g", "-p", strconv.Itoa(pid),
+		"-o", filepath.Join(p.machineDir(machineID), profile.Name))
+	if err := cmd.Start(); err != nil {
+		return Profile{}, fmt.Errorf("error starting perf: %w", err)
+	}
+
+	s := &session{profile: profile, cmd: cmd, done: make(chan struct{})}
+	s.timer = time.AfterFunc(duration, func() { _ = cmd.Process.Signal(syscall.SIGINT) })
+	go func() {
+		defer close(s.done)
+		_ = cmd.Wait()
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.sessions[machineID] == s {
+			delete(p.sessions, machineID)
+		}
+	}()
+
+	p.sessions[machineID] = s
+	return profile, nil
+}
+
+// Stop stops the running session of the machine and returns its profile. It fails with ErrNoSession if there
+// is no running session.
+func (p *Profiler) Stop(machineID string) (Profile, error) {
+	p.mu.Lock()
+	s, ok := p.sessions[machineID]
+	p.mu.Unlock()
+	if !ok {
+		return Profile{}, fmt.Errorf("%w: machine %s", ErrNoSession, machineID)
+	}
+
+	s.stop()
+	return p.profile(machineID, s.profile.Name)
+}
+
+func (p *Profiler) profile(machineID, name string) (Profile, error) {
+	if filepath.Base(name) != name || !strings.HasSuffix(name, profileSuffix) {
+		return Profile{}, fmt.Errorf("%w: invalid name %q", ErrProfileNotFound, name)
+	}
+
+	startedAt, err := time.Parse(timeLayout, strings.TrimSuffix(name, profileSuffix))
+	if err != nil {
+		return Profile{}, fmt.Errorf("%w: invalid name %q", ErrProfileNotFound, name)
+	}
+
+	profile := Profile{MachineID: machineID, Name: name, StartedAt: startedAt}
+
+	p.mu.Lock()
+	s, ok := p.sessions[machineID]
+	p.mu.Unlock()
+	if ok && s.profile.Name == name {
+		profile.Running = true
+		return profile, nil
+	}
+
+	info, err := os.Stat(filepath.Join(p.machineDir(machineID), name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Profile{}, fmt.Errorf("%w: %s of machine %s", ErrProfileNotFound, name, machineID)
+		}
+		return Profile{}, fmt.Errorf("error reading profile %s of machine %s: %w", name, machineID, err)
+	}
+	profile.Size = info.Size()
+	return profile, nil
+}
+
+// List returns the profiles of the machine, the oldest first.
+func (p *Profiler) List(machineID string) ([]Profile, error) {
+	entries, err := os.ReadDir(p.machineDir(machineID))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("error reading profiles of machine %s: %w", machineID, err)
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	p.mu.Lock()
+	if s, ok := p.sessions[machineID]; ok && !slices.Contains(names, s.profile.Name) {
+		names = append(names, s.profile.Name)
+	}
+	p.mu.Unlock()
+	slices.Sort(names)
+
+	var profiles []Profile
+	for _, name := range names {
+		profile, err := p.profile(machineID, name)
+		if err != nil {
+			if errors.Is(err, ErrProfileNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		profiles = append(profiles, profile)
+	}
+	return profiles, nil
+}
+
+// Open opens the recorded profile of the machine. It fails with ErrProfileNotFound if the profile doesn't
+// exist or is still being recorded.
+func (p *Profiler) Open(machineID, name string) (*os.File, error) {
+	profile, err := p.profile(machineID, name)
+	if err != nil {
+		return nil, err
+	}
+	if profile.Running {
+		return nil, fmt.Errorf("%w: %s of machine %s is still being recorded", ErrProfileNotFound, name, machineID)
+	}
+
+	file, err := os.Open(filepath.Join(p.machineDir(machineID), name))
+	if err != nil {
+		return nil, fmt.Errorf("error opening profile %s of machine %s: %w", name, machineID, err)
+	}
+	return file, nil
+}
+
+// Remove stops the running session of the machine, if any, and removes its profiles.
+func (p *Profiler) Remove(machineID string) error {
+	p.mu.Lock()
+	s, ok := p.sessions[machineID]
+	p.mu.Unlock()
+	if ok {
+		s.stop()
+	}
+
+	if err := os.RemoveAll(p.machineDir(machineID)); err != nil {
+		return fmt.Errorf("error removing profiles of machine %s: %w", machineID, err)
+	}
+	return nil
+}
+
+// Close stops all running sessions.
+func (p *Profiler) Close() {
+	p.mu.Lock()
+	sessions := make([]*session, 0, len(p.sessions))
+	for _, s := range p.sessions {
+		sessions = append(sessions, s)
+	}
+	p.mu.Unlock()
+
+	for _, s := range sessions {
+		s.stop()
+	}
+}
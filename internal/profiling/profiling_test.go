@@ -0,0 +1,118 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package profiling_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ironcore-dev/libvirt-provider/internal/profiling"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakePerf records until it is interrupted, writing its arguments as profile.
+const fakePerf = `#!/bin/sh
+args="$*"
+while [ $# -gt 0 ]; do
+	[ "$1" = "-o" ] && out=$2
+	shift
+done
+trap 'echo "$args" > "$out"; exit 0' INT
+touch "$out"
+while true; do sleep 0.05; done
+`
+
+var _ = Describe("Profiler", func() {
+	const machineID = "machine-1"
+
+	var (
+		dir      string
+		profiler *profiling.Profiler
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		perf := filepath.Join(dir, "perf")
+		Expect(os.WriteFile(perf, []byte(fakePerf), 0755)).To(Succeed())
+		pidDir := filepath.Join(dir, "run")
+		Expect(os.MkdirAll(pidDir, 0777)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(pidDir, machineID+".pid"), []byte("4242\n"), 0666)).To(Succeed())
+
+		var err error
+		profiler, err = profiling.NewProfiler(filepath.Join(dir, "profiles"), profiling.Options{
+			Perf:        perf,
+			PIDDir:      pidDir,
+			MaxDuration: time.Minute,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(profiler.Close)
+	})
+
+	readProfile := func(name string) string {
+		GinkgoHelper()
+		file, err := profiler.Open(machineID, name)
+		Expect(err).NotTo(HaveOccurred())
+		defer func() { _ = file.Close() }()
+		data, err := io.ReadAll(file)
+		Expect(err).NotTo(HaveOccurred())
+		return string(data)
+	}
+
+	It("should record the qemu process of a machine until stopped", func() {
+		started, err := profiler.Start(machineID, machineID, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(started.Running).To(BeTrue())
+
+		_, err = profiler.Start(machineID, machineID, 0)
+		Expect(err).To(MatchError(profiling.ErrSessionActive))
+		Expect(profiler.List(machineID)).To(ConsistOf(HaveField("Running", true)))
+		_, err = profiler.Open(machineID, started.Name)
+		Expect(err).To(MatchError(profiling.ErrProfileNotFound))
+		// Wait for perf to be recording, so it writes the profile on interruption.
+		Eventually(filepath.Join(dir, "profiles", machineID, started.Name)).Should(BeAnExistingFile())
+
+		stopped, err := profiler.Stop(machineID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stopped.Name).To(Equal(started.Name))
+		Expect(stopped.Running).To(BeFalse())
+		Expect(stopped.Size).To(BeNumerically(">", 0))
+		Expect(readProfile(stopped.Name)).To(HavePrefix("kvm --guest record -g -p 4242 -o "))
+
+		_, err = profiler.Stop(machineID)
+		Expect(err).To(MatchError(profiling.ErrNoSession))
+	})
+
+	It("should stop sessions after their duration", func() {
+		started, err := profiler.Start(machineID, machineID, 100*time.Millisecond)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func() ([]profiling.Profile, error) {
+			return profiler.List(machineID)
+		}).Should(ConsistOf(SatisfyAll(
+			HaveField("Name", started.Name),
+			HaveField("Running", false),
+		)))
+	})
+
+	It("should fail to profile machines without running domain", func() {
+		_, err := profiler.Start("machine-2", "machine-2", 0)
+		Expect(err).To(MatchError(ContainSubstring("not running")))
+	})
+
+	It("should reject invalid profile names", func() {
+		_, err := profiler.Open(machineID, "../machine-2/20240101T000000Z.data")
+		Expect(err).To(MatchError(profiling.ErrProfileNotFound))
+	})
+
+	It("should remove the profiles of a machine", func() {
+		_, err := profiler.Start(machineID, machineID, 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(profiler.Remove(machineID)).To(Succeed())
+		Expect(profiler.List(machineID)).To(BeEmpty())
+	})
+})
@@ -0,0 +1,201 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package qcow2
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// DefaultMaxConcurrentConversions is the default number of conversions a Converter runs at once.
+const DefaultMaxConcurrentConversions = 2
+
+// ErrConverting is returned while a conversion is still in progress.
+var ErrConverting = errors.New("qcow2 converting")
+
+// IgnoreErrConverting returns nil if err is ErrConverting, err otherwise.
+func IgnoreErrConverting(err error) error {
+	if errors.Is(err, ErrConverting) {
+		return nil
+	}
+	return err
+}
+
+// ConvertFunc performs a conversion. It has to stop once ctx is done and may report its progress.
+type ConvertFunc func(ctx context.Context, progress func(percent int)) error
+
+type ConversionDoneEvent struct {
+	Key     string
+	Waiters []string
+	// Err is set if the conversion failed or was canceled.
+	Err error
+}
+
+type ConversionProgressEvent struct {
+	Key     string
+	Waiters []string
+	Percent int
+}
+
+// ConverterListener is notified about conversions. Handlers are called from the goroutine of the conversion.
+type ConverterListener interface {
+	HandleConversionDone(evt ConversionDoneEvent)
+	HandleConversionProgress(evt ConversionProgressEvent)
+}
+
+type ConverterListenerFuncs struct {
+	HandleConversionDoneFunc     func(evt ConversionDoneEvent)
+	HandleConversionProgressFunc func(evt ConversionProgressEvent)
+}
+
+func (l ConverterListenerFuncs) HandleConversionDone(evt ConversionDoneEvent) {
+	if l.HandleConversionDoneFunc != nil {
+		l.HandleConversionDoneFunc(evt)
+	}
+}
+
+func (l ConverterListenerFuncs) HandleConversionProgress(evt ConversionProgressEvent) {
+	if l.HandleConversionProgressFunc != nil {
+		l.HandleConversionProgressFunc(evt)
+	}
+}
+
+type conversion struct {
+	cancel  context.CancelFunc
+	waiters sets.Set[string]
+	percent int
+	done    bool
+	err     error
+}
+
+// Converter runs conversions in the background, at most a fixed number of them at once. Conversions are
+// identified by a key, e.g. their target file, and started on behalf of waiters, e.g. machines. A conversion
+// nobody waits for anymore is canceled.
+type Converter struct {
+	sem chan struct{}
+
+	mu          sync.Mutex
+	conversions map[string]*conversion
+	listeners   []ConverterListener
+}
+
+// NewConverter creates a Converter running at most maxConcurrent conversions at once.
+func NewConverter(maxConcurrent int) *Converter {
+	if maxConcurrent <= 0 {
+		maxConcurrent = DefaultMaxConcurrentConversions
+	}
+	return &Converter{
+		sem:         make(chan struct{}, maxConcurrent),
+		conversions: make(map[string]*conversion),
+	}
+}
+
+func (c *Converter) AddListener(listener ConverterListener) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.listeners = append(c.listeners, listener)
+}
+
+// Convert starts the conversion of key on behalf of waiter unless it is in progress already, in which
+// case waiter is added to the waiters of the running conversion. ErrConverting is returned until the
+// conversion finished. The outcome of a finished conversion is returned once and then forgotten, so a
+// failed conversion is retried by the next call.
+func (c *Converter) Convert(key, waiter string, fn ConvertFunc) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if conv, ok := c.conversions[key]; ok {
+		if conv.done {
+			delete(c.conversions, key)
+			return conv.err
+		}
+		conv.waiters.Insert(waiter)
+		return ErrConverting
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	conv := &conversion{
+		cancel:  cancel,
+		waiters: sets.New(waiter),
+	}
+	c.conversions[key] = conv
+	go c.run(ctx, key, conv, fn)
+	return ErrConverting
+}
+
+func (c *Converter) run(ctx context.Context, key string, conv *conversion, fn ConvertFunc) {
+	defer conv.cancel()
+
+	var err error
+	select {
+	case c.sem <- struct{}{}:
+		err = fn(ctx, func(percent int) {
+			c.mu.Lock()
+			changed := percent != conv.percent
+			conv.percent = percent
+			evt := ConversionProgressEvent{Key: key, Waiters: sets.List(conv.waiters), Percent: percent}
+			listeners := c.listeners
+			c.mu.Unlock()
+
+			if !changed {
+				return
+			}
+			for _, listener := range listeners {
+				listener.HandleConversionProgress(evt)
+			}
+		})
+		<-c.sem
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	c.mu.Lock()
+	conv.done = true
+	conv.err = err
+	evt := ConversionDoneEvent{Key: key, Waiters: sets.List(conv.waiters), Err: err}
+	if len(evt.Waiters) == 0 {
+		// Nobody is left to pick up the outcome of the canceled conversion.
+		delete(c.conversions, key)
+	}
+	listeners := c.listeners
+	c.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener.HandleConversionDone(evt)
+	}
+}
+
+// Release removes waiter from the waiters of all conversions and cancels the running conversions
+// nobody waits for anymore.
+func (c *Converter) Release(waiter string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, conv := range c.conversions {
+		if !conv.waiters.Has(waiter) {
+			continue
+		}
+		conv.waiters.Delete(waiter)
+		if conv.waiters.Len() > 0 {
+			continue
+		}
+		if conv.done {
+			delete(c.conversions, key)
+			continue
+		}
+		conv.cancel()
+	}
+}
+
+// Active reports whether the conversion of key is in progress.
+func (c *Converter) Active(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	conv, ok := c.conversions[key]
+	return ok && !conv.done
+}
@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package qcow2_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"github.com/ironcore-dev/libvirt-provider/internal/qcow2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Converter", func() {
+	var (
+		converter *qcow2.Converter
+		done      chan qcow2.ConversionDoneEvent
+	)
+
+	BeforeEach(func() {
+		converter = qcow2.NewConverter(1)
+		done = make(chan qcow2.ConversionDoneEvent, 10)
+		events := done
+		converter.AddListener(qcow2.ConverterListenerFuncs{
+			HandleConversionDoneFunc: func(evt qcow2.ConversionDoneEvent) {
+				events <- evt
+			},
+		})
+	})
+
+	// blocking returns a conversion that reports 50% and blocks until release is closed or it is canceled.
+	blocking := func(release <-chan struct{}) qcow2.ConvertFunc {
+		return func(ctx context.Context, progress func(int)) error {
+			progress(50)
+			select {
+			case <-release:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+
+	It("should run a conversion in the background and return its outcome once", func() {
+		release := make(chan struct{})
+		Expect(converter.Convert("base", "machine-1", blocking(release))).To(MatchError(qcow2.ErrConverting))
+		Expect(converter.Convert("base", "machine-2", blocking(release))).To(MatchError(qcow2.ErrConverting))
+		Eventually(func() bool { return converter.Active("base") }).Should(BeTrue())
+
+		close(release)
+		var evt qcow2.ConversionDoneEvent
+		Eventually(done).Should(Receive(&evt))
+		Expect(evt.Key).To(Equal("base"))
+		Expect(evt.Waiters).To(ConsistOf("machine-1", "machine-2"))
+		Expect(evt.Err).NotTo(HaveOccurred())
+
+		Expect(converter.Active("base")).To(BeFalse())
+		Expect(converter.Convert("base", "machine-1", blocking(release))).To(Succeed())
+	})
+
+	It("should retry a failed conversion", func() {
+		var calls atomic.Int32
+		failing := func(context.Context, func(int)) error {
+			calls.Add(1)
+			return errors.New("boom")
+		}
+		Expect(converter.Convert("base", "machine-1", failing)).To(MatchError(qcow2.ErrConverting))
+		Eventually(done).Should(Receive())
+		Expect(converter.Convert("base", "machine-1", failing)).To(MatchError("boom"))
+		Expect(converter.Convert("base", "machine-1", failing)).To(MatchError(qcow2.ErrConverting))
+		Eventually(done).Should(Receive())
+		Expect(calls.Load()).To(BeEquivalentTo(2))
+	})
+
+	It("should limit the number of concurrent conversions", func() {
+		release := make(chan struct{})
+		defer close(release)
+		var started atomic.Int32
+		convert := func(ctx context.Context, progress func(int)) error {
+			started.Add(1)
+			return blocking(release)(ctx, progress)
+		}
+		Expect(converter.Convert("base-1", "machine-1", convert)).To(MatchError(qcow2.ErrConverting))
+		Expect(converter.Convert("base-2", "machine-2", convert)).To(MatchError(qcow2.ErrConverting))
+		Eventually(started.Load).Should(BeEquivalentTo(1))
+		Consistently(started.Load).Should(BeEquivalentTo(1))
+	})
+
+	It("should cancel a conversion nobody waits for anymore", func() {
+		release := make(chan struct{})
+		defer close(release)
+		Expect(converter.Convert("base", "machine-1", blocking(release))).To(MatchError(qcow2.ErrConverting))
+		Expect(converter.Convert("base", "machine-2", blocking(release))).To(MatchError(qcow2.ErrConverting))
+
+		converter.Release("machine-1")
+		Consistently(done).ShouldNot(Receive())
+
+		converter.Release("machine-2")
+		var evt qcow2.ConversionDoneEvent
+		Eventually(done).Should(Receive(&evt))
+		Expect(evt.Err).To(MatchError(context.Canceled))
+		Expect(evt.Waiters).To(BeEmpty())
+		Expect(converter.Active("base")).To(BeFalse())
+	})
+})
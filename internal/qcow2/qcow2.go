@@ -4,12 +4,62 @@
 package qcow2
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"sort"
 )
 
 type QCow2 interface {
 	Create(filename string, opts ...CreateOption) error
+	// Check checks the consistency of the given disk, repairing leaked clusters if requested.
+	Check(filename string, opts ...CheckOption) (*CheckResult, error)
+	// Convert converts the raw source file to a new qcow2 disk at filename. The conversion is aborted
+	// once ctx is done. progress, if set, is called with the percentage converted so far.
+	Convert(ctx context.Context, sourceFile, filename string, progress func(percent int)) error
+	// BackingFile returns the backing file of the given disk, or an empty string if it has none.
+	BackingFile(filename string) (string, error)
+	// Flatten copies all data of the backing chain into the given disk and removes its backing file.
+	Flatten(filename string) error
+}
+
+// Magic is the magic number qcow2 disks start with.
+var Magic = []byte{'Q', 'F', 'I', 0xfb}
+
+// IsQCow2 reports whether the given file is a qcow2 disk.
+func IsQCow2(filename string) (bool, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = f.Close() }()
+
+	header := make([]byte, len(Magic))
+	if _, err := io.ReadFull(f, header); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return false, nil
+		}
+		return false, err
+	}
+	return bytes.Equal(header, Magic), nil
+}
+
+// CheckResult is the outcome of a consistency check. Counts of fixed findings are not included in the
+// remaining ones.
+type CheckResult struct {
+	Corruptions      int `json:"corruptions"`
+	Leaks            int `json:"leaks"`
+	CheckErrors      int `json:"check-errors"`
+	CorruptionsFixed int `json:"corruptions-fixed"`
+	LeaksFixed       int `json:"leaks-fixed"`
+}
+
+// Clean reports whether no unfixed findings remain.
+func (r *CheckResult) Clean() bool {
+	return r.Corruptions == 0 && r.Leaks == 0 && r.CheckErrors == 0
 }
 
 type CreateOption interface {
@@ -28,9 +78,25 @@ func (s WithSourceFile) ApplyToCreate(o *CreateOptions) {
 	o.SourceFile = string(s)
 }
 
+// WithSourceFormat is the format of the source file. Defaults to raw.
+type WithSourceFormat string
+
+func (s WithSourceFormat) ApplyToCreate(o *CreateOptions) {
+	o.SourceFormat = string(s)
+}
+
+// WithEncryptionKey encrypts the created disk with LUKS using the given passphrase.
+type WithEncryptionKey string
+
+func (s WithEncryptionKey) ApplyToCreate(o *CreateOptions) {
+	o.EncryptionKey = string(s)
+}
+
 type CreateOptions struct {
-	Size       *int64
-	SourceFile string
+	Size          *int64
+	SourceFile    string
+	SourceFormat  string
+	EncryptionKey string
 }
 
 func (o *CreateOptions) ApplyToCreate(o2 *CreateOptions) {
@@ -40,6 +106,12 @@ func (o *CreateOptions) ApplyToCreate(o2 *CreateOptions) {
 	if o.SourceFile != "" {
 		o2.SourceFile = o.SourceFile
 	}
+	if o.SourceFormat != "" {
+		o2.SourceFormat = o.SourceFormat
+	}
+	if o.EncryptionKey != "" {
+		o2.EncryptionKey = o.EncryptionKey
+	}
 }
 
 func (o *CreateOptions) ApplyOptions(opts []CreateOption) {
@@ -48,6 +120,45 @@ func (o *CreateOptions) ApplyOptions(opts []CreateOption) {
 	}
 }
 
+type CheckOption interface {
+	ApplyToCheck(o *CheckOptions)
+}
+
+// WithRepairLeaks repairs leaked clusters, which is safe as they only waste space.
+type WithRepairLeaks bool
+
+func (s WithRepairLeaks) ApplyToCheck(o *CheckOptions) {
+	o.RepairLeaks = bool(s)
+}
+
+// WithForceShare checks a disk that is in use, e.g. by a running domain. The result may be inconsistent
+// with writes of the user, hence leaks can't be repaired.
+type WithForceShare bool
+
+func (s WithForceShare) ApplyToCheck(o *CheckOptions) {
+	o.ForceShare = bool(s)
+}
+
+type CheckOptions struct {
+	RepairLeaks bool
+	ForceShare  bool
+}
+
+func (o *CheckOptions) ApplyToCheck(o2 *CheckOptions) {
+	if o.RepairLeaks {
+		o2.RepairLeaks = o.RepairLeaks
+	}
+	if o.ForceShare {
+		o2.ForceShare = o.ForceShare
+	}
+}
+
+func (o *CheckOptions) ApplyOptions(opts []CheckOption) {
+	for _, opt := range opts {
+		opt.ApplyToCheck(o)
+	}
+}
+
 type qcow2AndPriority struct {
 	qcow2    QCow2
 	priority int
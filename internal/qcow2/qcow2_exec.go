@@ -4,16 +4,27 @@
 package qcow2
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
 	"strconv"
+	"strings"
 
+	"github.com/ironcore-dev/libvirt-provider/internal/osutils"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 )
 
 type Exec struct {
 }
 
+// combinedOutput runs the command and returns its combined output. Specs replace it to inspect the commands.
+var combinedOutput = (*exec.Cmd).CombinedOutput
+
 func (Exec) Create(filename string, opts ...CreateOption) error {
 	o := &CreateOptions{}
 	o.ApplyOptions(opts)
@@ -24,10 +35,30 @@ func (Exec) Create(filename string, opts ...CreateOption) error {
 
 	args := []string{"create", "-f", "qcow2"}
 
+	cmd := exec.Command("qemu-img")
+	if o.EncryptionKey != "" {
+		// The passphrase is passed as first extra file (fd 3) to keep it out of the arguments.
+		keyFile, err := osutils.DataPipe([]byte(o.EncryptionKey))
+		if err != nil {
+			return fmt.Errorf("error passing encryption key: %w", err)
+		}
+		defer func() { _ = keyFile.Close() }()
+		cmd.ExtraFiles = []*os.File{keyFile}
+
+		args = append(args,
+			"--object", "secret,id=sec0,file=/dev/fd/3",
+			"-o", "encrypt.format=luks,encrypt.key-secret=sec0",
+		)
+	}
+
 	if o.SourceFile != "" {
+		sourceFormat := o.SourceFormat
+		if sourceFormat == "" {
+			sourceFormat = "raw"
+		}
 		args = append(args,
 			"-b", o.SourceFile,
-			"-F", "raw",
+			"-F", sourceFormat,
 		)
 	}
 
@@ -37,7 +68,134 @@ func (Exec) Create(filename string, opts ...CreateOption) error {
 		args = append(args, strconv.FormatInt(*o.Size, 10))
 	}
 
-	res, err := exec.Command("qemu-img", args...).CombinedOutput()
+	cmd.Args = append(cmd.Args, args...)
+	res, err := combinedOutput(cmd)
+	if err != nil {
+		return fmt.Errorf("error running qemu-img: %s, exit error %w", string(res), err)
+	}
+	return nil
+}
+
+// Exit codes of qemu-img check, see qemu-img(1).
+const (
+	checkExitCorruptions = 2
+	checkExitLeaks       = 3
+)
+
+func (Exec) Check(filename string, opts ...CheckOption) (*CheckResult, error) {
+	o := &CheckOptions{}
+	o.ApplyOptions(opts)
+
+	if o.RepairLeaks && o.ForceShare {
+		return nil, fmt.Errorf("can't repair leaks of a shared disk")
+	}
+
+	args := []string{"check", "-f", "qcow2", "--output=json"}
+	if o.RepairLeaks {
+		args = append(args, "-r", "leaks")
+	}
+	if o.ForceShare {
+		args = append(args, "-U")
+	}
+	args = append(args, filename)
+
+	cmd := exec.Command("qemu-img", args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		// Findings are reported via the exit code, the result is printed nevertheless.
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || (exitErr.ExitCode() != checkExitCorruptions && exitErr.ExitCode() != checkExitLeaks) {
+			return nil, fmt.Errorf("error running qemu-img: %s, exit error %w", stderr.String(), err)
+		}
+	}
+
+	result := &CheckResult{}
+	if err := json.Unmarshal(out, result); err != nil {
+		return nil, fmt.Errorf("error decoding qemu-img check result: %w", err)
+	}
+	return result, nil
+}
+
+func (Exec) Convert(ctx context.Context, sourceFile, filename string, progress func(percent int)) error {
+	cmd := exec.CommandContext(ctx, "qemu-img", "convert", "-p", "-f", "raw", "-O", "qcow2", sourceFile, filename)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("error creating qemu-img output pipe: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("error starting qemu-img: %w", err)
+	}
+
+	// qemu-img reports the progress as "(12.34/100%)", each report terminated by a carriage return.
+	scanner := bufio.NewScanner(stdout)
+	scanner.Split(scanProgressReports)
+	for scanner.Scan() {
+		if percent, ok := parseProgressReport(scanner.Text()); ok && progress != nil {
+			progress(percent)
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("error running qemu-img: %s, exit error %w", stderr.String(), err)
+	}
+	return nil
+}
+
+func scanProgressReports(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+func parseProgressReport(report string) (int, bool) {
+	report = strings.TrimSpace(report)
+	report, ok := strings.CutPrefix(report, "(")
+	if !ok {
+		return 0, false
+	}
+	report, _, ok = strings.Cut(report, "/100%)")
+	if !ok {
+		return 0, false
+	}
+	percent, err := strconv.ParseFloat(report, 64)
+	if err != nil {
+		return 0, false
+	}
+	return int(percent), true
+}
+
+func (Exec) BackingFile(filename string) (string, error) {
+	cmd := exec.Command("qemu-img", "info", "-f", "qcow2", "--output=json", filename)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("error running qemu-img: %s, exit error %w", stderr.String(), err)
+	}
+
+	info := struct {
+		BackingFilename string `json:"backing-filename"`
+	}{}
+	if err := json.Unmarshal(out, &info); err != nil {
+		return "", fmt.Errorf("error decoding qemu-img info result: %w", err)
+	}
+	return info.BackingFilename, nil
+}
+
+func (Exec) Flatten(filename string) error {
+	// Rebasing onto no backing file copies all data of the backing chain into the disk.
+	res, err := exec.Command("qemu-img", "rebase", "-f", "qcow2", "-b", "", filename).CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("error running qemu-img: %s, exit error %w", string(res), err)
 	}
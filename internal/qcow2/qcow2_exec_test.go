@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package qcow2_test
+
+import (
+	"io"
+	"os/exec"
+
+	"github.com/ironcore-dev/libvirt-provider/internal/qcow2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Exec", func() {
+	var (
+		args       []string
+		extraFiles []string
+	)
+
+	BeforeEach(func() {
+		args, extraFiles = nil, nil
+		DeferCleanup(qcow2.SetCombinedOutput(func(cmd *exec.Cmd) ([]byte, error) {
+			args = cmd.Args
+			for _, file := range cmd.ExtraFiles {
+				data, err := io.ReadAll(file)
+				Expect(err).NotTo(HaveOccurred())
+				extraFiles = append(extraFiles, string(data))
+			}
+			return nil, nil
+		}))
+	})
+
+	It("should create encrypted disks with the key passed on fd 3 only", func() {
+		Expect(qcow2.Exec{}.Create("/disks/disk.qcow2", qcow2.WithSize(1024), qcow2.WithEncryptionKey("s3cr3t"))).To(Succeed())
+
+		Expect(args).To(Equal([]string{
+			"qemu-img", "create", "-f", "qcow2",
+			"--object", "secret,id=sec0,file=/dev/fd/3",
+			"-o", "encrypt.format=luks,encrypt.key-secret=sec0",
+			"/disks/disk.qcow2", "1024",
+		}))
+		Expect(args).NotTo(ContainElement(ContainSubstring("s3cr3t")))
+		Expect(extraFiles).To(Equal([]string{"s3cr3t"}))
+	})
+
+	It("should create encrypted disks on top of a backing file", func() {
+		Expect(qcow2.Exec{}.Create("/disks/disk.qcow2", qcow2.WithSourceFile("/images/root.raw"), qcow2.WithEncryptionKey("s3cr3t"))).To(Succeed())
+
+		Expect(args).To(Equal([]string{
+			"qemu-img", "create", "-f", "qcow2",
+			"--object", "secret,id=sec0,file=/dev/fd/3",
+			"-o", "encrypt.format=luks,encrypt.key-secret=sec0",
+			"-b", "/images/root.raw", "-F", "raw",
+			"/disks/disk.qcow2",
+		}))
+		Expect(extraFiles).To(Equal([]string{"s3cr3t"}))
+	})
+
+	It("should create unencrypted disks without extra files", func() {
+		Expect(qcow2.Exec{}.Create("/disks/disk.qcow2", qcow2.WithSize(1024))).To(Succeed())
+
+		Expect(args).To(Equal([]string{"qemu-img", "create", "-f", "qcow2", "/disks/disk.qcow2", "1024"}))
+		Expect(extraFiles).To(BeEmpty())
+	})
+})
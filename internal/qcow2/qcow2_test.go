@@ -0,0 +1,35 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package qcow2_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/ironcore-dev/libvirt-provider/internal/qcow2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("IsQCow2", func() {
+	DescribeTable("detecting qcow2 disks by their magic number",
+		func(data []byte, expected bool) {
+			filename := filepath.Join(GinkgoT().TempDir(), "disk")
+			Expect(os.WriteFile(filename, data, 0600)).To(Succeed())
+
+			ok, err := qcow2.IsQCow2(filename)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(Equal(expected))
+		},
+		Entry("qcow2 disk", append(append([]byte{}, qcow2.Magic...), 0, 0, 0, 3), true),
+		Entry("raw disk", make([]byte, 512), false),
+		Entry("file shorter than the magic number", qcow2.Magic[:2], false),
+		Entry("empty file", []byte{}, false),
+	)
+
+	It("should fail if the file doesn't exist", func() {
+		_, err := qcow2.IsQCow2(filepath.Join(GinkgoT().TempDir(), "missing"))
+		Expect(err).To(MatchError(os.ErrNotExist))
+	})
+})
@@ -0,0 +1,13 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package raw
+
+import "os/exec"
+
+// SetCombinedOutput replaces the runner of the qemu-img commands until restore is called.
+func SetCombinedOutput(f func(cmd *exec.Cmd) ([]byte, error)) (restore func()) {
+	old := combinedOutput
+	combinedOutput = f
+	return func() { combinedOutput = old }
+}
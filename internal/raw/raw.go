@@ -28,9 +28,39 @@ func (s WithSourceFile) ApplyToCreate(o *CreateOptions) {
 	o.SourceFile = string(s)
 }
 
+// WithEncryptionKey encrypts the created disk with LUKS using the given passphrase.
+type WithEncryptionKey string
+
+func (s WithEncryptionKey) ApplyToCreate(o *CreateOptions) {
+	o.EncryptionKey = string(s)
+}
+
+// Preallocation modes of disks created without source file.
+const (
+	PreallocationOff      = "off"
+	PreallocationMetadata = "metadata"
+	PreallocationFalloc   = "falloc"
+	PreallocationFull     = "full"
+)
+
+// PreallocationModes returns the supported preallocation modes.
+func PreallocationModes() []string {
+	return []string{PreallocationOff, PreallocationMetadata, PreallocationFalloc, PreallocationFull}
+}
+
+// WithPreallocation sets the preallocation mode of a disk created without source file.
+// Raw disks have no metadata, so PreallocationMetadata only affects encrypted disks.
+type WithPreallocation string
+
+func (s WithPreallocation) ApplyToCreate(o *CreateOptions) {
+	o.Preallocation = string(s)
+}
+
 type CreateOptions struct {
-	Size       *int64
-	SourceFile string
+	Size          *int64
+	SourceFile    string
+	EncryptionKey string
+	Preallocation string
 }
 
 func (o *CreateOptions) ApplyToCreate(o2 *CreateOptions) {
@@ -40,6 +70,12 @@ func (o *CreateOptions) ApplyToCreate(o2 *CreateOptions) {
 	if o.SourceFile != "" {
 		o2.SourceFile = o.SourceFile
 	}
+	if o.EncryptionKey != "" {
+		o2.EncryptionKey = o.EncryptionKey
+	}
+	if o.Preallocation != "" {
+		o2.Preallocation = o.Preallocation
+	}
 }
 
 func (o *CreateOptions) ApplyOptions(opts []CreateOption) {
@@ -7,8 +7,11 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
+	"strconv"
 
 	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/internal/osutils"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
@@ -17,11 +20,24 @@ type Exec struct{}
 
 const filePerm = 0660
 
+// combinedOutput runs the command and returns its combined output. Specs replace it to inspect the commands.
+var combinedOutput = (*exec.Cmd).CombinedOutput
+
 func (Exec) Create(filename string, opts ...CreateOption) error {
 	o := &CreateOptions{}
 	o.ApplyOptions(opts)
 	log := ctrl.Log.WithName("raw-disk").WithValues("filename", filename)
 
+	if o.EncryptionKey != "" || o.Preallocation == PreallocationFalloc || o.Preallocation == PreallocationFull {
+		if o.SourceFile != "" || o.Size == nil {
+			return fmt.Errorf("must specify Size and no source file when creating an encrypted or preallocated disk")
+		}
+		if err := createFileWithQemuImg(filename, *o.Size, o.EncryptionKey, o.Preallocation); err != nil {
+			return fmt.Errorf("failed creating the empty ephemeral disk at %s: %w", filename, err)
+		}
+		return nil
+	}
+
 	if o.SourceFile == "" {
 		if o.Size == nil {
 			return fmt.Errorf("must specify Size when creating without source file")
@@ -36,11 +52,64 @@ func (Exec) Create(filename string, opts ...CreateOption) error {
 		if err := copyFile(log, o.SourceFile, filename); err != nil {
 			return fmt.Errorf("failed creating virtual disk image, source: %s, destination: %s: %w", o.SourceFile, filename, err)
 		}
+		if o.Size != nil {
+			if err := growFile(filename, *o.Size); err != nil {
+				return fmt.Errorf("failed resizing virtual disk image %s: %w", filename, err)
+			}
+		}
 	}
 
 	return nil
 }
 
+// growFile extends the file to size. Files which are larger already are left as they are.
+func growFile(filename string, size int64) error {
+	stat, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	if stat.Size() >= size {
+		return nil
+	}
+	return os.Truncate(filename, size)
+}
+
+// createFileWithQemuImg creates a raw disk with the given virtual size. The disk is LUKS encrypted
+// if an encryption key is given.
+func createFileWithQemuImg(filename string, size int64, encryptionKey, preallocation string) error {
+	format := "raw"
+	if encryptionKey != "" {
+		format = "luks"
+	}
+
+	args := []string{"create", "-f", format}
+	if preallocation != "" && preallocation != PreallocationOff && (encryptionKey != "" || preallocation != PreallocationMetadata) {
+		args = append(args, "-o", "preallocation="+preallocation)
+	}
+
+	cmd := exec.Command("qemu-img")
+	if encryptionKey != "" {
+		// The passphrase is passed as first extra file (fd 3) to keep it out of the arguments.
+		keyFile, err := osutils.DataPipe([]byte(encryptionKey))
+		if err != nil {
+			return fmt.Errorf("error passing encryption key: %w", err)
+		}
+		defer func() { _ = keyFile.Close() }()
+		cmd.ExtraFiles = []*os.File{keyFile}
+
+		args = append(args,
+			"--object", "secret,id=sec0,file=/dev/fd/3",
+			"-o", "key-secret=sec0",
+		)
+	}
+
+	cmd.Args = append(cmd.Args, append(args, filename, strconv.FormatInt(size, 10))...)
+	if res, err := combinedOutput(cmd); err != nil {
+		return fmt.Errorf("error running qemu-img: %s, exit error %w", string(res), err)
+	}
+	return os.Chmod(filename, filePerm)
+}
+
 func createEmptyFileWithSeek(log logr.Logger, filename string, seek int64) error {
 	dstFile, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, filePerm)
 	if err != nil {
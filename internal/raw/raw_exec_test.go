@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package raw_test
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/ironcore-dev/libvirt-provider/internal/raw"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// qemuImgCommand is a qemu-img command along with the data it could read from its extra files.
+type qemuImgCommand struct {
+	args       []string
+	extraFiles []string
+}
+
+// recordQemuImg replaces running qemu-img by recording its commands and creating the disk.
+func recordQemuImg() *[]qemuImgCommand {
+	var commands []qemuImgCommand
+	DeferCleanup(raw.SetCombinedOutput(func(cmd *exec.Cmd) ([]byte, error) {
+		command := qemuImgCommand{args: cmd.Args}
+		for _, file := range cmd.ExtraFiles {
+			data, err := io.ReadAll(file)
+			Expect(err).NotTo(HaveOccurred())
+			command.extraFiles = append(command.extraFiles, string(data))
+		}
+		commands = append(commands, command)
+		return nil, os.WriteFile(cmd.Args[len(cmd.Args)-2], nil, 0600)
+	}))
+	return &commands
+}
+
+var _ = Describe("Exec", func() {
+	var (
+		commands *[]qemuImgCommand
+		disk     string
+	)
+
+	BeforeEach(func() {
+		commands = recordQemuImg()
+		disk = filepath.Join(GinkgoT().TempDir(), "disk.raw")
+	})
+
+	It("should create encrypted disks with the key passed on fd 3 only", func() {
+		Expect(raw.Exec{}.Create(disk, raw.WithSize(1024), raw.WithEncryptionKey("s3cr3t"))).To(Succeed())
+
+		Expect(*commands).To(HaveLen(1))
+		command := (*commands)[0]
+		Expect(command.args).To(Equal([]string{
+			"qemu-img", "create", "-f", "luks",
+			"--object", "secret,id=sec0,file=/dev/fd/3",
+			"-o", "key-secret=sec0",
+			disk, "1024",
+		}))
+		Expect(command.args).NotTo(ContainElement(ContainSubstring("s3cr3t")))
+		Expect(command.extraFiles).To(Equal([]string{"s3cr3t"}))
+	})
+
+	It("should reject encrypted disks with a source file", func() {
+		err := raw.Exec{}.Create(disk, raw.WithSize(1024), raw.WithSourceFile("/images/root.raw"), raw.WithEncryptionKey("s3cr3t"))
+		Expect(err).To(MatchError(ContainSubstring("must specify Size and no source file")))
+		Expect(*commands).To(BeEmpty())
+	})
+
+	It("should create unencrypted disks without qemu-img", func() {
+		Expect(raw.Exec{}.Create(disk, raw.WithSize(1024))).To(Succeed())
+
+		Expect(*commands).To(BeEmpty())
+		Expect(disk).To(BeAnExistingFile())
+	})
+
+	DescribeTable("creating preallocated disks",
+		func(opts []raw.CreateOption, expectedArgs []string) {
+			Expect(raw.Exec{}.Create(disk, append(opts, raw.WithSize(1024))...)).To(Succeed())
+
+			if expectedArgs == nil {
+				Expect(*commands).To(BeEmpty())
+				Expect(disk).To(BeAnExistingFile())
+				return
+			}
+			Expect(*commands).To(HaveLen(1))
+			Expect((*commands)[0].args).To(Equal(append(append([]string{"qemu-img", "create"}, expectedArgs...), disk, "1024")))
+		},
+		Entry("off", []raw.CreateOption{raw.WithPreallocation(raw.PreallocationOff)}, nil),
+		Entry("metadata of an unencrypted disk", []raw.CreateOption{raw.WithPreallocation(raw.PreallocationMetadata)}, nil),
+		Entry("falloc", []raw.CreateOption{raw.WithPreallocation(raw.PreallocationFalloc)},
+			[]string{"-f", "raw", "-o", "preallocation=falloc"}),
+		Entry("full", []raw.CreateOption{raw.WithPreallocation(raw.PreallocationFull)},
+			[]string{"-f", "raw", "-o", "preallocation=full"}),
+		Entry("metadata of an encrypted disk",
+			[]raw.CreateOption{raw.WithPreallocation(raw.PreallocationMetadata), raw.WithEncryptionKey("s3cr3t")},
+			[]string{"-f", "luks", "-o", "preallocation=metadata", "--object", "secret,id=sec0,file=/dev/fd/3", "-o", "key-secret=sec0"}),
+	)
+})
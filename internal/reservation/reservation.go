@@ -0,0 +1,146 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package reservation
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// ErrDone is returned when changing a transaction that is committed or rolled back already.
+var ErrDone = errors.New("transaction is done")
+
+// Transaction allocates the resources of a machine from several sources, all or nothing. The sources are
+// stateless, so an allocation is a change of the machine that is only effective once the machine is stored.
+// Until then, the allocated resources are reserved in the Ledger of their source, so allocations of other
+// machines don't hand them out as well.
+//
+// On Commit, after the machine is stored, the reservations are released as the allocations are derived from
+// the stored machine from then on. On Rollback the reservations are released and the changes of the machine
+// are undone in reverse order, so an allocation failing in a later source leaves neither reservations nor
+// allocations of earlier sources behind. A transaction is meant to be rolled back deferred, which is a no-op
+// once it is committed. A machine has at most one transaction at a time.
+type Transaction struct {
+	machineID string
+
+	mu       sync.Mutex
+	done     bool
+	releases []func()
+	undos    []func()
+}
+
+// Begin begins a transaction allocating resources to the machine with the given ID.
+func Begin(machineID string) *Transaction {
+	return &Transaction{machineID: machineID}
+}
+
+// OnRollback registers undo to revert a change of the machine on rollback.
+func (t *Transaction) OnRollback(undo func()) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.done {
+		return ErrDone
+	}
+	t.undos = append(t.undos, undo)
+	return nil
+}
+
+// Commit releases the reservations of the transaction. It has to be called once the machine is stored.
+func (t *Transaction) Commit() {
+	t.finish(false)
+}
+
+// Rollback releases the reservations of the transaction and undoes the changes of the machine.
+func (t *Transaction) Rollback() {
+	t.finish(true)
+}
+
+func (t *Transaction) finish(undo bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.done {
+		return
+	}
+	t.done = true
+
+	for _, release := range t.releases {
+		release()
+	}
+	if undo {
+		for _, undo := range slices.Backward(t.undos) {
+			undo()
+		}
+	}
+	t.releases, t.undos = nil, nil
+}
+
+// Ledger holds the resources of a source reserved by transactions, as quantity per resource key, e.g. the
+// number of devices per address or the bytes of memory per NUMA node.
+type Ledger[K comparable] struct {
+	mu       sync.Mutex
+	reserved map[string]map[K]int64
+}
+
+func NewLedger[K comparable]() *Ledger[K] {
+	return &Ledger[K]{reserved: make(map[string]map[K]int64)}
+}
+
+// Reserve reserves the given quantities for the machine of the transaction until it is done. Reserving a key
+// again replaces its quantity, as it is the pending allocation of the machine.
+func (l *Ledger[K]) Reserve(tx *Transaction, quantities map[K]int64) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.done {
+		return ErrDone
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	reserved, ok := l.reserved[tx.machineID]
+	if !ok {
+		reserved = make(map[K]int64)
+		l.reserved[tx.machineID] = reserved
+	}
+	maps.Copy(reserved, quantities)
+
+	keys := slices.Collect(maps.Keys(quantities))
+	tx.releases = append(tx.releases, func() { l.release(tx.machineID, keys) })
+	return nil
+}
+
+func (l *Ledger[K]) release(machineID string, keys []K) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	reserved := l.reserved[machineID]
+	for _, key := range keys {
+		delete(reserved, key)
+	}
+	if len(reserved) == 0 {
+		delete(l.reserved, machineID)
+	}
+}
+
+// Reserved returns the quantities per key reserved for the machines other than the given one.
+func (l *Ledger[K]) Reserved(machineID string) map[K]int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	total := make(map[K]int64)
+	for id, reserved := range l.reserved {
+		if id == machineID {
+			continue
+		}
+		for key, quantity := range reserved {
+			total[key] += quantity
+		}
+	}
+	return total
+}
@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package reservation_test
+
+import (
+	"errors"
+
+	"github.com/ironcore-dev/libvirt-provider/internal/reservation"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Transaction", func() {
+	var (
+		devices *reservation.Ledger[string]
+		memory  *reservation.Ledger[int]
+	)
+
+	BeforeEach(func() {
+		devices = reservation.NewLedger[string]()
+		memory = reservation.NewLedger[int]()
+	})
+
+	It("should make reservations visible to other machines only", func() {
+		tx := reservation.Begin("machine-1")
+		Expect(devices.Reserve(tx, map[string]int64{"0000:65:00.0": 1})).To(Succeed())
+		Expect(memory.Reserve(tx, map[int]int64{0: 1024})).To(Succeed())
+		Expect(memory.Reserve(tx, map[int]int64{0: 2048})).To(Succeed())
+
+		Expect(devices.Reserved("machine-2")).To(Equal(map[string]int64{"0000:65:00.0": 1}))
+		Expect(memory.Reserved("machine-2")).To(Equal(map[int]int64{0: 2048}))
+		Expect(devices.Reserved("machine-1")).To(BeEmpty())
+	})
+
+	It("should sum the reservations of several machines", func() {
+		tx1, tx2 := reservation.Begin("machine-1"), reservation.Begin("machine-2")
+		Expect(memory.Reserve(tx1, map[int]int64{0: 1024})).To(Succeed())
+		Expect(memory.Reserve(tx2, map[int]int64{0: 512, 1: 256})).To(Succeed())
+
+		Expect(memory.Reserved("machine-3")).To(Equal(map[int]int64{0: 1536, 1: 256}))
+		Expect(memory.Reserved("machine-1")).To(Equal(map[int]int64{0: 512, 1: 256}))
+	})
+
+	It("should release the reservations but keep the changes on commit", func() {
+		var node int
+		tx := reservation.Begin("machine-1")
+		Expect(memory.Reserve(tx, map[int]int64{1: 1024})).To(Succeed())
+		Expect(tx.OnRollback(func() { node = 0 })).To(Succeed())
+		node = 1
+
+		tx.Commit()
+		tx.Rollback()
+		Expect(node).To(Equal(1))
+		Expect(memory.Reserved("")).To(BeEmpty())
+	})
+
+	It("should release the reservations and undo the changes in reverse order on rollback", func() {
+		var undone []string
+		tx := reservation.Begin("machine-1")
+		Expect(memory.Reserve(tx, map[int]int64{0: 1024})).To(Succeed())
+		Expect(tx.OnRollback(func() { undone = append(undone, "memory") })).To(Succeed())
+		Expect(devices.Reserve(tx, map[string]int64{"0000:65:00.0": 1})).To(Succeed())
+		Expect(tx.OnRollback(func() { undone = append(undone, "devices") })).To(Succeed())
+
+		tx.Rollback()
+		tx.Rollback()
+		Expect(undone).To(Equal([]string{"devices", "memory"}))
+		Expect(memory.Reserved("")).To(BeEmpty())
+		Expect(devices.Reserved("")).To(BeEmpty())
+	})
+
+	It("should leave no partial allocation if a later source fails", func() {
+		allocate := func(tx *reservation.Transaction) error {
+			if err := memory.Reserve(tx, map[int]int64{0: 1024}); err != nil {
+				return err
+			}
+			return errors.New("insufficient pci devices")
+		}
+
+		tx := reservation.Begin("machine-1")
+		Expect(allocate(tx)).NotTo(Succeed())
+		tx.Rollback()
+		Expect(memory.Reserved("")).To(BeEmpty())
+	})
+
+	It("should keep the reservations of other transactions", func() {
+		tx1, tx2 := reservation.Begin("machine-1"), reservation.Begin("machine-2")
+		Expect(devices.Reserve(tx1, map[string]int64{"0000:65:00.0": 1})).To(Succeed())
+		Expect(devices.Reserve(tx2, map[string]int64{"0000:66:00.0": 1})).To(Succeed())
+
+		tx1.Rollback()
+		Expect(devices.Reserved("")).To(Equal(map[string]int64{"0000:66:00.0": 1}))
+	})
+
+	It("should reject changes of done transactions", func() {
+		tx := reservation.Begin("machine-1")
+		tx.Commit()
+		Expect(devices.Reserve(tx, map[string]int64{"0000:65:00.0": 1})).To(MatchError(reservation.ErrDone))
+		Expect(tx.OnRollback(func() {})).To(MatchError(reservation.ErrDone))
+		Expect(devices.Reserved("")).To(BeEmpty())
+	})
+})
@@ -0,0 +1,221 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ironcore-dev/libvirt-provider/internal/mcr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// Header keys the capacity of the host is reported with in the response metadata of Status, in the form
+// resource=quantity[,resource=quantity], e.g. cpu=64,memory=256Gi,nvidia.com/gpu=2. Besides cpu and memory
+// they report the pci, mdev and usb device resources. The IRI response only reports the number of machines
+// per machine class, schedulers packing machines onto hosts need the resources themselves.
+const (
+	// CapacityHeader reports the resources of the host available to machines in total.
+	CapacityHeader = "libvirt-provider-capacity"
+	// AllocatableHeader reports the resources of the host not allocated to machines. Nothing is allocatable
+	// while the host is in maintenance mode.
+	AllocatableHeader = "libvirt-provider-allocatable"
+)
+
+// Header keys the hugepage pools of the NUMA nodes are reported with in the response metadata of Status, one
+// value per pool in the form node:resource=quantity[,resource=quantity], e.g. 0:memory=64Gi. Machines can't
+// span nodes, so the host may have memory allocatable that no single machine can use. They are only reported
+// if machines are backed by hugepages.
+const (
+	// PoolCapacityHeader reports the resources of the pools in total.
+	PoolCapacityHeader = "libvirt-provider-pool-capacity"
+	// PoolAllocatableHeader reports the resources of the pools not allocated to machines. Nothing is
+	// allocatable while the host is in maintenance mode.
+	PoolAllocatableHeader = "libvirt-provider-pool-allocatable"
+)
+
+// pool is the hugepage pool of a NUMA node.
+type pool struct {
+	node        int
+	capacity    corev1.ResourceList
+	allocatable corev1.ResourceList
+}
+
+// pools returns the hugepage pools of the NUMA nodes, including the allocations not committed yet.
+func (s *Server) pools(ctx context.Context) ([]pool, error) {
+	if s.hugepages == nil {
+		return nil, nil
+	}
+
+	// Like the machines, the reservations are read first, see reservations.
+	reserved := s.reservations.numaNodes.Reserved("")
+	allocated, err := s.numaNodeAllocations(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var pools []pool
+	for _, node := range s.hugepages.Nodes() {
+		free := node.Bytes() - allocated[node.ID] - reserved[node.ID]
+		pools = append(pools, pool{
+			node: node.ID,
+			capacity: corev1.ResourceList{
+				corev1.ResourceMemory: *resource.NewQuantity(node.Bytes(), resource.BinarySI),
+			},
+			allocatable: corev1.ResourceList{
+				corev1.ResourceMemory: *resource.NewQuantity(max(0, free), resource.BinarySI),
+			},
+		})
+	}
+	return pools, nil
+}
+
+// capacity returns the resources of the host available to machines in total and the ones not allocated to
+// machines yet, including the allocations not committed yet.
+func (s *Server) capacity(ctx context.Context, host *mcr.Host) (capacity, allocatable corev1.ResourceList, err error) {
+	// Like the machines, the reservations are read first, see reservations.
+	reservedCapacity := s.reservations.capacity.Reserved("")
+	reservedPCIDevices := s.reservations.pciDevices.Reserved("")
+	reservedMdevDevices := s.reservations.mdevDevices.Reserved("")
+	reservedUSBDevices := s.reservations.usbDevices.Reserved("")
+
+	machines, err := s.machineStore.List(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list machines: %w", err)
+	}
+
+	// Like the host, the allocations hold the cpu in millis, see checkCapacity.
+	allocatedCPUMillis, allocatedMemoryBytes := s.allocatedResources(machines, "")
+	allocatedCPUMillis += reservedCapacity[capacityResourceCPU]
+	allocatedMemoryBytes += reservedCapacity[capacityResourceMemory]
+
+	capacity = corev1.ResourceList{
+		corev1.ResourceCPU:    *resource.NewMilliQuantity(host.Cpu.Value(), resource.DecimalSI),
+		corev1.ResourceMemory: *resource.NewQuantity(host.Mem.Value(), resource.BinarySI),
+	}
+	allocatable = corev1.ResourceList{
+		corev1.ResourceCPU:    *resource.NewMilliQuantity(max(0, host.Cpu.Value()-allocatedCPUMillis), resource.DecimalSI),
+		corev1.ResourceMemory: *resource.NewQuantity(max(0, host.Mem.Value()-allocatedMemoryBytes), resource.BinarySI),
+	}
+
+	// Devices are counted per resource.
+	totalDevices, freeDevices := make(map[string]int64), make(map[string]int64)
+
+	if s.pciDevices != nil {
+		inUse := sets.KeySet(reservedPCIDevices)
+		for _, machine := range machines {
+			inUse.Insert(machine.Status.PCIDevices...)
+			for _, device := range machine.Spec.PCIDevices {
+				inUse.Insert(device.Address)
+			}
+		}
+		for _, device := range s.pciDevices.Devices() {
+			totalDevices[device.Resource]++
+			if !inUse.Has(device.Address.String()) {
+				freeDevices[device.Resource]++
+			}
+		}
+	}
+
+	if s.mdevDevices != nil {
+		total, err := s.mdevDevices.Capacity()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get mdev capacity: %w", err)
+		}
+		for name, count := range total {
+			totalDevices[name] += int64(count)
+			freeDevices[name] += int64(count)
+		}
+		for device := range reservedMdevDevices {
+			freeDevices[device.Resource]--
+		}
+		for _, machine := range machines {
+			for _, device := range machine.Spec.MdevDevices {
+				freeDevices[device.Resource]--
+			}
+		}
+	}
+
+	if s.usbDevices != nil {
+		inUse := sets.KeySet(reservedUSBDevices)
+		for _, machine := range machines {
+			inUse.Insert(machine.Status.USBDevices...)
+			for _, device := range machine.Spec.USBDevices {
+				inUse.Insert(device.ID)
+			}
+		}
+		for _, device := range s.usbDevices.Devices() {
+			totalDevices[device.Resource]++
+			if !inUse.Has(device.ID()) {
+				freeDevices[device.Resource]++
+			}
+		}
+	}
+
+	for name, total := range totalDevices {
+		capacity[corev1.ResourceName(name)] = *resource.NewQuantity(total, resource.DecimalSI)
+		allocatable[corev1.ResourceName(name)] = *resource.NewQuantity(max(0, freeDevices[name]), resource.DecimalSI)
+	}
+
+	return capacity, allocatable, nil
+}
+
+// formatResources formats the resources in the form resource=quantity[,resource=quantity], sorted by resource.
+func formatResources(resources corev1.ResourceList) string {
+	values := make([]string, 0, len(resources))
+	for _, name := range slices.Sorted(maps.Keys(resources)) {
+		quantity := resources[name]
+		values = append(values, string(name)+"="+quantity.String())
+	}
+	return strings.Join(values, configurationSeparator)
+}
+
+// clearResources sets the quantities of the resources to zero.
+func clearResources(resources corev1.ResourceList) {
+	for name, quantity := range resources {
+		quantity.Set(0)
+		resources[name] = quantity
+	}
+}
+
+// setCapacityHeader reports the capacity and the allocatable resources of the host and its pools, see
+// CapacityHeader and PoolCapacityHeader.
+func (s *Server) setCapacityHeader(ctx context.Context, host *mcr.Host, inMaintenance bool) {
+	log := s.loggerFrom(ctx)
+
+	capacity, allocatable, err := s.capacity(ctx, host)
+	if err != nil {
+		log.V(1).Info("Unable to report capacity", "Error", err)
+		return
+	}
+	pools, err := s.pools(ctx)
+	if err != nil {
+		log.V(1).Info("Unable to report capacity", "Error", err)
+		return
+	}
+	if inMaintenance {
+		clearResources(allocatable)
+		for _, pool := range pools {
+			clearResources(pool.allocatable)
+		}
+	}
+
+	md := metadata.Pairs(CapacityHeader, formatResources(capacity), AllocatableHeader, formatResources(allocatable))
+	for _, pool := range pools {
+		node := strconv.Itoa(pool.node) + ":"
+		md.Append(PoolCapacityHeader, node+formatResources(pool.capacity))
+		md.Append(PoolAllocatableHeader, node+formatResources(pool.allocatable))
+	}
+	if err := grpc.SetHeader(ctx, md); err != nil {
+		log.V(1).Info("Unable to report capacity", "Error", err)
+	}
+}
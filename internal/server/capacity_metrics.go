@@ -0,0 +1,172 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/mcr"
+	"github.com/ironcore-dev/libvirt-provider/internal/store"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	capacityResourceCPU    = "cpu"
+	capacityResourceMemory = "memory"
+)
+
+var (
+	resourcesTotal = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "libvirt_provider_resources_total",
+			Help: "Resources of the host available to machines, partitioned by resource (cpu in cores or memory in bytes).",
+		},
+		[]string{"resource"},
+	)
+	resourcesAvailable = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "libvirt_provider_resources_available",
+			Help: "Resources of the host not allocated to machines, partitioned by resource (cpu in cores or memory in bytes).",
+		},
+		[]string{"resource"},
+	)
+	machineAllocatedResources = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "libvirt_provider_machine_allocated_resources",
+			Help: "Resources of the host allocated to a machine after overcommitment, partitioned by resource (cpu in cores or memory in bytes).",
+		},
+		[]string{"machine", "resource"},
+	)
+	machineClassAvailableSlots = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "libvirt_provider_machine_class_available_slots",
+			Help: "Number of further machines of the machine class fitting into the available resources of the host.",
+		},
+		[]string{"machine_class"},
+	)
+	machineClassQuantity = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "libvirt_provider_machine_class_quantity",
+			Help: "Number of machines of the machine class fitting onto the host, as reported by the status.",
+		},
+		[]string{"machine_class"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(resourcesTotal, resourcesAvailable, machineAllocatedResources, machineClassAvailableSlots, machineClassQuantity)
+}
+
+// allocatedResources returns the cpu millis and memory bytes of the host allocated to the machines, taking the
+// overcommitment of their machine classes into account. The machine with the ID exclude is skipped.
+func (s *Server) allocatedResources(machines []*api.Machine, exclude string) (cpuMillis, memoryBytes int64) {
+	for _, machine := range machines {
+		// Suspended machines release their CPU and memory until they are resumed.
+		if machine.ID == exclude || machine.Spec.Suspend {
+			continue
+		}
+		className, _ := api.GetClassLabel(machine)
+		machineCPUMillis, machineMemoryBytes := s.machineClasses.Overcommit(className).Host(machine.Spec.CpuMillis, machine.Spec.MemoryBytes)
+		cpuMillis += machineCPUMillis
+		memoryBytes += machineMemoryBytes
+	}
+	return cpuMillis, memoryBytes
+}
+
+// StartCapacityMetrics updates the capacity metrics whenever machines are created, changed or removed until ctx
+// is done, so the resources allocated to machines can be graphed without calling Status.
+func (s *Server) StartCapacityMetrics(ctx context.Context) error {
+	log := logr.FromContextOrDiscard(ctx)
+
+	watch, err := s.machineStore.Watch(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start watch: %w", err)
+	}
+	defer watch.Stop()
+
+	allocations, err := s.updateCapacityMetrics(ctx)
+	if err != nil {
+		log.Error(err, "Failed to update capacity metrics")
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case evt := <-watch.Events():
+			// Status updates of machines don't change their allocations.
+			if evt.Type == store.WatchEventTypeUpdated && allocations != nil {
+				if allocation, ok := allocations[evt.Object.ID]; ok && allocation == s.allocation(evt.Object) {
+					continue
+				}
+			}
+			if allocations, err = s.updateCapacityMetrics(ctx); err != nil {
+				log.Error(err, "Failed to update capacity metrics")
+			}
+		}
+	}
+}
+
+// allocation is the cpu millis and memory bytes of the host allocated to a machine.
+type allocation struct {
+	cpuMillis   int64
+	memoryBytes int64
+}
+
+func (s *Server) allocation(machine *api.Machine) allocation {
+	cpuMillis, memoryBytes := s.allocatedResources([]*api.Machine{machine}, "")
+	return allocation{cpuMillis: cpuMillis, memoryBytes: memoryBytes}
+}
+
+// updateCapacityMetrics sets the capacity metrics from the machines in the store and returns their allocations.
+// Like Status, it takes the host resources from the snapshot, so bursts of machine events don't query the host
+// for each event.
+func (s *Server) updateCapacityMetrics(ctx context.Context) (map[string]allocation, error) {
+	host, err := s.hostResourcesFromSnapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	machines, err := s.machineStore.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list machines: %w", err)
+	}
+
+	allocations := make(map[string]allocation, len(machines))
+	machineAllocatedResources.Reset()
+	for _, machine := range machines {
+		allocations[machine.ID] = s.allocation(machine)
+		machineAllocatedResources.WithLabelValues(machine.ID, capacityResourceCPU).Set(cores(allocations[machine.ID].cpuMillis))
+		machineAllocatedResources.WithLabelValues(machine.ID, capacityResourceMemory).Set(float64(allocations[machine.ID].memoryBytes))
+	}
+
+	// Like the host, the available resources hold the cpu in millis, see checkCapacity.
+	allocatedCPUMillis, allocatedMemoryBytes := s.allocatedResources(machines, "")
+	available := &mcr.Host{
+		Cpu: resource.NewQuantity(max(0, host.Cpu.Value()-allocatedCPUMillis), resource.DecimalSI),
+		Mem: resource.NewQuantity(max(0, host.Mem.Value()-allocatedMemoryBytes), resource.BinarySI),
+	}
+
+	resourcesTotal.WithLabelValues(capacityResourceCPU).Set(cores(host.Cpu.Value()))
+	resourcesTotal.WithLabelValues(capacityResourceMemory).Set(float64(host.Mem.Value()))
+	resourcesAvailable.WithLabelValues(capacityResourceCPU).Set(cores(available.Cpu.Value()))
+	resourcesAvailable.WithLabelValues(capacityResourceMemory).Set(float64(available.Mem.Value()))
+
+	machineClassAvailableSlots.Reset()
+	machineClassQuantity.Reset()
+	for _, machineClass := range s.machineClasses.List() {
+		overcommit := s.machineClasses.Overcommit(machineClass.Name)
+		machineClassAvailableSlots.WithLabelValues(machineClass.Name).Set(float64(mcr.GetOvercommittedQuantity(machineClass, overcommit, available)))
+		machineClassQuantity.WithLabelValues(machineClass.Name).Set(float64(s.machineClassQuantity(machineClass, host)))
+	}
+	return allocations, nil
+}
+
+func cores(cpuMillis int64) float64 {
+	return float64(cpuMillis) / 1000
+}
@@ -0,0 +1,129 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package server_test
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+	iri "github.com/ironcore-dev/ironcore/iri/apis/machine/v1alpha1"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/mcr"
+	"github.com/ironcore-dev/libvirt-provider/internal/server"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// countingMemoryReservation reserves a fixed amount of memory and counts how often the host is queried for it.
+type countingMemoryReservation struct {
+	reserved int64
+	calls    atomic.Int32
+}
+
+func (r *countingMemoryReservation) ReservedMemory(context.Context) (int64, error) {
+	r.calls.Add(1)
+	return r.reserved, nil
+}
+
+// gaugeValue returns the value of the gauge name with the labels from the default registry, or nil if there is
+// none.
+func gaugeValue(name string, labels map[string]string) *float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	Expect(err).NotTo(HaveOccurred())
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if labels[label.GetName()] != label.GetValue() {
+					continue metrics
+				}
+			}
+			value := metric.GetGauge().GetValue()
+			return &value
+		}
+	}
+	return nil
+}
+
+func newMetricsMachine(cpuMillis, memoryBytes int64, suspend bool) *api.Machine {
+	machine := &api.Machine{
+		Metadata: api.Metadata{ID: uuid.NewString()},
+		Spec: api.MachineSpec{
+			CpuMillis:   cpuMillis,
+			MemoryBytes: memoryBytes,
+			Suspend:     suspend,
+		},
+	}
+	api.SetClassLabel(machine, machineClassx3xlarge)
+	return machine
+}
+
+var _ = Describe("CapacityMetrics", func() {
+	It("should report the resources allocated to machines from the host snapshot", func(ctx SpecContext) {
+		reservation := &countingMemoryReservation{reserved: 1 << 30}
+		srv, machines := newFakeServer(server.Options{MemoryReservation: reservation})
+
+		By("storing a running and a suspended machine")
+		running, err := machines.Create(ctx, newMetricsMachine(2000, 4<<30, false))
+		Expect(err).NotTo(HaveOccurred())
+		suspended, err := machines.Create(ctx, newMetricsMachine(4000, 8<<30, true))
+		Expect(err).NotTo(HaveOccurred())
+
+		By("starting the capacity metrics")
+		metricsCtx, cancel := context.WithCancel(ctx)
+		DeferCleanup(cancel)
+		go func() {
+			defer GinkgoRecover()
+			Expect(srv.StartCapacityMetrics(metricsCtx)).To(Succeed())
+		}()
+
+		host, err := mcr.GetResources(ctx, false)
+		Expect(err).NotTo(HaveOccurred())
+		hostCPUMillis, hostMemoryBytes := host.Cpu.Value(), host.Mem.Value()-reservation.reserved
+		available := &mcr.Host{
+			Cpu: resource.NewQuantity(max(0, hostCPUMillis-2000), resource.DecimalSI),
+			Mem: resource.NewQuantity(max(0, hostMemoryBytes-4<<30), resource.BinarySI),
+		}
+
+		By("inspecting the gauges")
+		Eventually(func() *float64 {
+			return gaugeValue("libvirt_provider_machine_allocated_resources", map[string]string{"machine": running.ID, "resource": "cpu"})
+		}).Should(HaveValue(BeNumerically("==", 2)))
+		Expect(gaugeValue("libvirt_provider_machine_allocated_resources", map[string]string{"machine": running.ID, "resource": "memory"})).
+			To(HaveValue(BeNumerically("==", 4<<30)))
+		Expect(gaugeValue("libvirt_provider_machine_allocated_resources", map[string]string{"machine": suspended.ID, "resource": "cpu"})).
+			To(HaveValue(BeZero()))
+		Expect(gaugeValue("libvirt_provider_resources_total", map[string]string{"resource": "cpu"})).
+			To(HaveValue(BeNumerically("==", float64(hostCPUMillis)/1000)))
+		Expect(gaugeValue("libvirt_provider_resources_total", map[string]string{"resource": "memory"})).
+			To(HaveValue(BeNumerically("==", hostMemoryBytes)))
+		Expect(gaugeValue("libvirt_provider_resources_available", map[string]string{"resource": "cpu"})).
+			To(HaveValue(BeNumerically("==", float64(available.Cpu.Value())/1000)))
+		Expect(gaugeValue("libvirt_provider_resources_available", map[string]string{"resource": "memory"})).
+			To(HaveValue(BeNumerically("==", available.Mem.Value())))
+		machineClass := &iri.MachineClass{
+			Name:         machineClassx3xlarge,
+			Capabilities: &iri.MachineClassCapabilities{CpuMillis: 4000, MemoryBytes: 8589934592},
+		}
+		Expect(gaugeValue("libvirt_provider_machine_class_available_slots", map[string]string{"machine_class": machineClassx3xlarge})).
+			To(HaveValue(BeNumerically("==", mcr.GetQuantity(machineClass, available))))
+
+		By("creating another machine")
+		calls := reservation.calls.Load()
+		other, err := machines.Create(ctx, newMetricsMachine(1000, 1<<30, false))
+		Expect(err).NotTo(HaveOccurred())
+		Eventually(func() *float64 {
+			return gaugeValue("libvirt_provider_machine_allocated_resources", map[string]string{"machine": other.ID, "resource": "cpu"})
+		}).Should(HaveValue(BeNumerically("==", 1)))
+
+		By("asserting the host was not queried again")
+		Expect(reservation.calls.Load()).To(Equal(calls))
+	})
+})
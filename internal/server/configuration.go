@@ -0,0 +1,114 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+
+	providernetworkinterface "github.com/ironcore-dev/libvirt-provider/internal/plugins/networkinterface"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Header keys the provider configuration is reported with in the response metadata of Status and Version.
+// The IRI responses have no fields for it, hence operators have to read it from the gRPC headers.
+const (
+	VolumePluginsHeader    = "libvirt-provider-volume-plugins"
+	NetworkPluginHeader    = "libvirt-provider-network-plugin"
+	Qcow2TypeHeader        = "libvirt-provider-qcow2-type"
+	GuestAgentHeader       = "libvirt-provider-guest-agent"
+	configurationSeparator = ","
+
+	// MachineClassResourcesHeader reports the extended resources of the machine classes with a value per
+	// class with extended resources, e.g. t3-small:hugepages-2Mi=1Gi,nvidia.com/gpu=1.
+	MachineClassResourcesHeader = "libvirt-provider-machine-class-resources"
+
+	// VolumePluginOptionsHeader and NetworkPluginOptionsHeader report the options of the plugins with a value per
+	// plugin with options, e.g. ceph:monitor-probe-timeout=5s or providernet:port-security=true.
+	VolumePluginOptionsHeader  = "libvirt-provider-volume-plugin-options"
+	NetworkPluginOptionsHeader = "libvirt-provider-network-plugin-options"
+
+	// MaintenanceHeader is set while the host is in maintenance mode, with the given reason as value.
+	MaintenanceHeader = "libvirt-provider-maintenance"
+)
+
+func (s *Server) configuration() metadata.MD {
+	md := metadata.MD{}
+	if s.volumePlugins != nil {
+		md.Set(VolumePluginsHeader, strings.Join(s.volumePlugins.PluginNames(), configurationSeparator))
+		if options := pluginOptions(s.volumePlugins.PluginOptions()); len(options) > 0 {
+			md.Set(VolumePluginOptionsHeader, options...)
+		}
+	}
+	if s.networkInterfacePlugin != nil {
+		md.Set(NetworkPluginHeader, s.networkInterfacePlugin.Name())
+		if options := pluginOptions(providernetworkinterface.PluginOptions(s.networkInterfacePlugin)); len(options) > 0 {
+			md.Set(NetworkPluginOptionsHeader, options...)
+		}
+	}
+	if s.qcow2Type != "" {
+		md.Set(Qcow2TypeHeader, s.qcow2Type)
+	}
+	md.Set(GuestAgentHeader, string(s.guestAgent))
+	if classResources := s.machineClassResources(); len(classResources) > 0 {
+		md.Set(MachineClassResourcesHeader, classResources...)
+	}
+	if state := s.maintenance.State(); state.Enabled {
+		md.Set(MaintenanceHeader, state.Reason)
+	}
+	return md
+}
+
+// machineClassResources returns the extended resources of the machine classes in the form
+// class:resource=quantity[,resource=quantity], sorted by class and resource.
+func (s *Server) machineClassResources() []string {
+	if s.machineClasses == nil {
+		return nil
+	}
+
+	var classResources []string
+	for _, class := range s.machineClasses.List() {
+		resources := s.machineClasses.Resources(class.Name)
+		if len(resources) == 0 {
+			continue
+		}
+
+		var values []string
+		for _, name := range slices.Sorted(maps.Keys(resources)) {
+			quantity := resources[name]
+			values = append(values, name+"="+quantity.String())
+		}
+		classResources = append(classResources, class.Name+":"+strings.Join(values, configurationSeparator))
+	}
+	slices.Sort(classResources)
+	return classResources
+}
+
+// pluginOptions returns the options of the plugins in the form plugin:key=value[,key=value], sorted by plugin
+// and key. Plugins without options are omitted.
+func pluginOptions(options map[string]map[string]string) []string {
+	var pluginOptions []string
+	for plugin, opts := range options {
+		if len(opts) == 0 {
+			continue
+		}
+
+		var values []string
+		for _, key := range slices.Sorted(maps.Keys(opts)) {
+			values = append(values, key+"="+opts[key])
+		}
+		pluginOptions = append(pluginOptions, plugin+":"+strings.Join(values, configurationSeparator))
+	}
+	slices.Sort(pluginOptions)
+	return pluginOptions
+}
+
+func (s *Server) setConfigurationHeader(ctx context.Context) {
+	if err := grpc.SetHeader(ctx, s.configuration()); err != nil {
+		s.loggerFrom(ctx).V(1).Info("Unable to report provider configuration", "Error", err)
+	}
+}
@@ -0,0 +1,59 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ironcore-dev/libvirt-provider/internal/inflight"
+	"github.com/ironcore-dev/libvirt-provider/internal/mdev"
+	"github.com/ironcore-dev/libvirt-provider/internal/pci"
+	"github.com/ironcore-dev/libvirt-provider/internal/store"
+	"github.com/ironcore-dev/libvirt-provider/internal/usb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorCodes maps the well known errors of the provider to gRPC codes.
+var errorCodes = []struct {
+	err  error
+	code codes.Code
+}{
+	{store.ErrNotFound, codes.NotFound},
+	{store.ErrAlreadyExists, codes.AlreadyExists},
+	{store.ErrResourceVersionNotLatest, codes.Aborted},
+	{pci.ErrInsufficientDevices, codes.ResourceExhausted},
+	{mdev.ErrInsufficientDevices, codes.ResourceExhausted},
+	{usb.ErrInsufficientDevices, codes.ResourceExhausted},
+	{inflight.ErrShuttingDown, codes.Unavailable},
+	{context.Canceled, codes.Canceled},
+	{context.DeadlineExceeded, codes.DeadlineExceeded},
+}
+
+// StatusError converts err to a gRPC status error, so clients like the machinepoollet can react to its code.
+// Status errors, also wrapped ones, keep their code, well known errors get the matching one and all others
+// are internal errors.
+func StatusError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if st, ok := status.FromError(err); ok {
+		return st.Err()
+	}
+
+	for _, errorCode := range errorCodes {
+		if errors.Is(err, errorCode.err) {
+			return status.Error(errorCode.code, err.Error())
+		}
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// UnaryErrorInterceptor converts the errors of requests to gRPC status errors, see StatusError.
+func UnaryErrorInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	return resp, StatusError(err)
+}
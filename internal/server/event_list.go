@@ -5,9 +5,11 @@ package server
 
 import (
 	"context"
+	"time"
 
 	irievent "github.com/ironcore-dev/ironcore/iri/apis/event/v1alpha1"
 	iri "github.com/ironcore-dev/ironcore/iri/apis/machine/v1alpha1"
+	"github.com/ironcore-dev/libvirt-provider/internal/event/machineevent"
 	"k8s.io/apimachinery/pkg/labels"
 )
 
@@ -37,7 +39,14 @@ func (s *Server) filterEvents(events []*irievent.Event, filter *iri.EventFilter)
 }
 
 func (s *Server) ListEvents(ctx context.Context, req *iri.ListEventsRequest) (*iri.ListEventsResponse, error) {
-	iriEvents := s.filterEvents(s.eventStore.ListEvents(), req.Filter)
+	var opts machineevent.ListOptions
+	if filter := req.Filter; filter != nil {
+		opts.MachineID = filter.Id
+		if filter.EventsFromTime > 0 {
+			opts.Since = time.Unix(filter.EventsFromTime, 0)
+		}
+	}
+	iriEvents := s.filterEvents(s.eventStore.ListEventsWithOptions(opts), req.Filter)
 
 	return &iri.ListEventsResponse{
 		Events: iriEvents,
@@ -4,6 +4,7 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -18,11 +19,13 @@ import (
 	iri "github.com/ironcore-dev/ironcore/iri/apis/machine/v1alpha1"
 	remotecommandserver "github.com/ironcore-dev/ironcore/poollet/machinepoollet/iri/streaming/remotecommand"
 	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/event/machineevent"
 	libvirtutils "github.com/ironcore-dev/libvirt-provider/internal/libvirt/utils"
 	"github.com/ironcore-dev/libvirt-provider/internal/store"
 	"github.com/moby/term"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/tools/remotecommand"
 	"libvirt.org/go/libvirtxml"
 )
@@ -30,13 +33,25 @@ import (
 const (
 	StreamCreationTimeout = 30 * time.Second
 	StreamIdleTimeout     = 2 * time.Minute
+
+	// DefaultConsoleReplayBytes is the default size of the console output replayed to new console sessions.
+	DefaultConsoleReplayBytes = 64 * 1024
 )
 
+// consoleSession is an active console session of a machine.
+type consoleSession struct {
+	metadata api.Metadata
+	// terminate closes the session, releasing its pty.
+	terminate context.CancelFunc
+}
+
 type executorExec struct {
-	Libvirt        *libvirt.Libvirt
+	Libvirt        libvirtutils.Client
 	ExecRequest    *iri.ExecRequest
 	Machine        *api.Machine
 	activeConsoles *sync.Map
+	// replayBytes is the size of the console output replayed before streaming the live output.
+	replayBytes int64
 }
 
 func (s *Server) Exec(ctx context.Context, req *iri.ExecRequest) (*iri.ExecResponse, error) {
@@ -49,8 +64,8 @@ func (s *Server) Exec(ctx context.Context, req *iri.ExecRequest) (*iri.ExecRespo
 		return nil, status.Errorf(codes.NotFound, "machine %s not found", req.MachineId)
 	}
 
-	log.V(1).Info("Inserting request into cache")
-	token, err := s.execRequestCache.Insert(req)
+	log.V(1).Info("Minting console token")
+	token, err := s.consoleTokens.Mint(s.buildURL("exec", ""), req.MachineId)
 	if err != nil {
 		return nil, err
 	}
@@ -65,12 +80,14 @@ func (s *Server) ServeExec(w http.ResponseWriter, req *http.Request, token strin
 	ctx := req.Context()
 	log := logr.FromContextOrDiscard(ctx)
 
-	request, ok := s.execRequestCache.Consume(token)
-	if !ok {
-		log.V(1).Info("Rejecting unknown / expired token")
+	// Tokens are minted for the url of this streaming server, see Exec.
+	claims, err := s.consoleTokens.Consume(token, s.buildURL("exec", ""))
+	if err != nil {
+		log.V(1).Info("Rejecting token", "Reason", err.Error())
 		http.NotFound(w, req)
 		return
 	}
+	request := &iri.ExecRequest{MachineId: claims.Subject}
 	apiMachine, err := s.machineStore.Get(ctx, request.MachineId)
 	if err != nil {
 		log.Error(err, "error getting the apiMachine")
@@ -87,6 +104,7 @@ func (s *Server) ServeExec(w http.ResponseWriter, req *http.Request, token strin
 		ExecRequest:    request,
 		Machine:        apiMachine,
 		activeConsoles: &s.activeConsoles,
+		replayBytes:    s.consoleReplayBytes,
 	}
 
 	handler, err := remotecommandserver.NewExecHandler(exec, remotecommandserver.ExecHandlerOptions{
@@ -106,20 +124,24 @@ func (s *Server) ServeExec(w http.ResponseWriter, req *http.Request, token strin
 func (e executorExec) Exec(ctx context.Context, in io.Reader, out io.WriteCloser, _ remotecommand.TerminalSizeQueue) error {
 	machineID := e.ExecRequest.MachineId
 
+	// Check if the apiMachine doesn't exist, to avoid making the libvirt-lookup call.
+	if e.Machine == nil {
+		return fmt.Errorf("apiMachine %w in the store", store.ErrNotFound)
+	}
+
+	sessionCtx, terminate := context.WithCancel(ctx)
+	defer terminate()
+
 	// Check if a console is already active for this machine
-	_, loaded := e.activeConsoles.LoadOrStore(machineID, true)
+	session := &consoleSession{metadata: e.Machine.Metadata, terminate: terminate}
+	_, loaded := e.activeConsoles.LoadOrStore(machineID, session)
 	if loaded {
 		return errors.New("operation failed: Active console session exists for this domain")
 	}
 
-	defer e.activeConsoles.Delete(machineID)
-
-	// Check if the apiMachine doesn't exist, to avoid making the libvirt-lookup call.
-	if e.Machine == nil {
-		return fmt.Errorf("apiMachine %w in the store", store.ErrNotFound)
-	}
+	defer e.activeConsoles.CompareAndDelete(machineID, session)
 
-	domain, err := e.Libvirt.DomainLookupByUUID(libvirtutils.UUIDStringToBytes(machineID))
+	domain, err := e.Libvirt.DomainLookupByUUID(libvirtutils.UUIDStringToBytes(e.Machine.GetDomainUUID()))
 	if err != nil {
 		if !libvirtutils.IsErrorCode(err, libvirt.ErrNoDomain) {
 			return fmt.Errorf("error looking up domain: %w", err)
@@ -147,6 +169,7 @@ func (e executorExec) Exec(ctx context.Context, in io.Reader, out io.WriteCloser
 	if err != nil {
 		return fmt.Errorf("error opening PTY: %w", err)
 	}
+	defer func() { _ = f.Close() }()
 
 	// Wrap the input stream with an escape proxy. Escape Sequence Ctrl + ] = 29
 	inputReader := term.NewEscapeProxy(in, []byte{29})
@@ -157,6 +180,13 @@ func (e executorExec) Exec(ctx context.Context, in io.Reader, out io.WriteCloser
 	var wg sync.WaitGroup
 	log := logr.FromContextOrDiscard(ctx).WithName(machineID)
 
+	// Domains created by earlier versions don't log their console output.
+	if serials := domainXML.Devices.Serials; e.replayBytes > 0 && len(serials) > 0 && serials[0].Log != nil {
+		if err := replayConsoleLog(out, serials[0].Log.File, e.replayBytes); err != nil {
+			log.Error(err, "error replaying console output")
+		}
+	}
+
 	wg.Add(2)
 	// ReadInput: go routine to read the input from the reader, and write to the terminal.
 	go func() {
@@ -191,7 +221,138 @@ func (e executorExec) Exec(ctx context.Context, in io.Reader, out io.WriteCloser
 		log.Info("Closed writing to the terminal")
 	}()
 
-	wg.Wait()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		wg.Wait()
+	}()
+
+	select {
+	case <-done:
+	case <-sessionCtx.Done():
+		// Closing the pty stops writing the output. Reading the input stops once the stream is torn down.
+		_ = f.Close()
+		log.Info("Terminated console session")
+	}
+
 	log.Info("Closed console for the machine")
 	return nil
 }
+
+// replayConsoleLog writes the last n bytes of the console log to out, starting at a line. The log of a domain
+// that didn't write any output yet may not exist.
+func replayConsoleLog(out io.Writer, file string, n int64) error {
+	f, err := os.Open(file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	offset := max(0, info.Size()-n)
+	truncated := offset > 0
+	if truncated {
+		// The byte before tells whether the first line is partial.
+		offset--
+	}
+	data := make([]byte, info.Size()-offset)
+	if _, err := f.ReadAt(data, offset); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if truncated {
+		// Skip the partial first line, or just the byte before if the line is complete.
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			data = data[i+1:]
+		} else {
+			data = data[1:]
+		}
+	}
+
+	_, err = out.Write(data)
+	return err
+}
+
+// terminateConsole terminates the active console session of the given machine, if any.
+func (s *Server) terminateConsole(log logr.Logger, machineID string, reason string) {
+	value, ok := s.activeConsoles.LoadAndDelete(machineID)
+	if !ok {
+		return
+	}
+
+	session := value.(*consoleSession)
+	session.terminate()
+
+	log.V(1).Info("Terminated console session", "Reason", reason)
+	if s.eventRecorder != nil {
+		s.eventRecorder.Eventf(log, session.metadata, corev1.EventTypeNormal, machineevent.ReasonConsoleSessionClosed, "Console session closed: %s", reason)
+	}
+}
+
+// StartConsoleTerminator terminates the console sessions of machines being deleted or powered off until ctx is
+// done. This covers the teardowns of the controllers, e.g. the garbage collection of deleted machines, DeleteMachine
+// terminates the session right away.
+func (s *Server) StartConsoleTerminator(ctx context.Context) error {
+	log := logr.FromContextOrDiscard(ctx)
+
+	watch, err := s.machineStore.Watch(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start watch: %w", err)
+	}
+	defer watch.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case evt := <-watch.Events():
+			switch evt.Type {
+			case store.WatchEventTypeResync:
+				s.terminateStaleConsoles(ctx, log)
+			case store.WatchEventTypeDeleted:
+				s.terminateConsole(log, evt.Object.ID, "machine has been deleted")
+			default:
+				if reason, ok := consoleTerminationReason(evt.Object); ok {
+					s.terminateConsole(log, evt.Object.ID, reason)
+				}
+			}
+		}
+	}
+}
+
+// consoleTerminationReason returns why the console session of the machine has to be terminated, if at all.
+func consoleTerminationReason(machine *api.Machine) (string, bool) {
+	switch {
+	case machine.DeletedAt != nil:
+		return "machine is being deleted", true
+	case machine.Spec.Power == api.PowerStatePowerOff:
+		return "machine is being powered off", true
+	default:
+		return "", false
+	}
+}
+
+// terminateStaleConsoles terminates the console sessions of all machines gone or to be terminated, used when
+// machine events were dropped.
+func (s *Server) terminateStaleConsoles(ctx context.Context, log logr.Logger) {
+	s.activeConsoles.Range(func(key, _ any) bool {
+		machineID := key.(string)
+		machine, err := s.machineStore.Get(ctx, machineID)
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			s.terminateConsole(log, machineID, "machine has been deleted")
+		case err != nil:
+			log.Error(err, "Failed to get machine of console session", "MachineID", machineID)
+		default:
+			if reason, ok := consoleTerminationReason(machine); ok {
+				s.terminateConsole(log, machineID, reason)
+			}
+		}
+		return true
+	})
+}
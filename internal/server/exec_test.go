@@ -9,12 +9,16 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/digitalocean/go-libvirt"
 	iri "github.com/ironcore-dev/ironcore/iri/apis/machine/v1alpha1"
 	irimeta "github.com/ironcore-dev/ironcore/iri/apis/meta/v1alpha1"
+	"github.com/ironcore-dev/libvirt-provider/api"
 	libvirtutils "github.com/ironcore-dev/libvirt-provider/internal/libvirt/utils"
+	"github.com/ironcore-dev/libvirt-provider/internal/server"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"k8s.io/apimachinery/pkg/util/httpstream/spdy"
@@ -145,3 +149,77 @@ func runExec(ctx context.Context, execUrl *url.URL) error {
 		})
 	})
 }
+
+var _ = Describe("ReplayConsoleLog", func() {
+	var logFile string
+
+	BeforeEach(func() {
+		logFile = filepath.Join(GinkgoT().TempDir(), "console.log")
+		Expect(os.WriteFile(logFile, []byte("first line\nsecond line\nthird line\n"), 0600)).To(Succeed())
+	})
+
+	DescribeTable("replaying the console log",
+		func(n int64, expected string) {
+			var out bytes.Buffer
+			Expect(server.ReplayConsoleLog(&out, logFile, n)).To(Succeed())
+			Expect(out.String()).To(Equal(expected))
+		},
+		Entry("a log shorter than n", int64(1024), "first line\nsecond line\nthird line\n"),
+		Entry("a log of exactly n bytes", int64(34), "first line\nsecond line\nthird line\n"),
+		Entry("skipping the partial first line", int64(20), "third line\n"),
+		Entry("starting at a complete line", int64(23), "second line\nthird line\n"),
+		Entry("nothing but a partial line", int64(5), ""),
+		Entry("nothing for n=0", int64(0), ""),
+	)
+
+	It("should replay nothing if the log doesn't exist", func() {
+		var out bytes.Buffer
+		Expect(server.ReplayConsoleLog(&out, filepath.Join(GinkgoT().TempDir(), "missing.log"), 1024)).To(Succeed())
+		Expect(out.Len()).To(BeZero())
+	})
+})
+
+var _ = Describe("ConsoleTerminator", func() {
+	It("should terminate the console sessions of machines torn down by the controllers", func(ctx SpecContext) {
+		srv, machines := newFakeServer(server.Options{})
+
+		By("storing a powered off, a deleted and an untouched machine with console sessions")
+		var sessions []context.Context
+		var stored []*api.Machine
+		for range 3 {
+			machine := newMetricsMachine(1000, 1<<30, false)
+			machine.Finalizers = []string{"test.ironcore.dev/console"}
+			machine, err := machines.Create(ctx, machine)
+			Expect(err).NotTo(HaveOccurred())
+			stored = append(stored, machine)
+			sessions = append(sessions, server.AddConsoleSession(srv, machine))
+		}
+		poweredOff, deleted, untouched := stored[0], stored[1], stored[2]
+
+		terminatorCtx, cancel := context.WithCancel(ctx)
+		DeferCleanup(cancel)
+		go func() {
+			defer GinkgoRecover()
+			Expect(srv.StartConsoleTerminator(terminatorCtx)).To(Succeed())
+		}()
+
+		By("powering off a machine")
+		poweredOff.Spec.Power = api.PowerStatePowerOff
+		// The terminator may not watch yet, so the machine is updated until its session is terminated.
+		Eventually(func(g Gomega) {
+			_, err := machines.Update(ctx, poweredOff)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(sessions[0].Done()).To(BeClosed())
+		}).Should(Succeed())
+
+		By("deleting a machine")
+		Expect(machines.Delete(ctx, deleted.ID)).To(Succeed())
+		Eventually(sessions[1].Done()).Should(BeClosed())
+
+		By("updating the untouched machine")
+		untouched.Status.State = api.MachineStateRunning
+		_, err := machines.Update(ctx, untouched)
+		Expect(err).NotTo(HaveOccurred())
+		Consistently(sessions[2].Done(), 200*time.Millisecond).ShouldNot(BeClosed())
+	})
+})
@@ -0,0 +1,27 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+
+	iri "github.com/ironcore-dev/ironcore/iri/apis/machine/v1alpha1"
+	"github.com/ironcore-dev/libvirt-provider/api"
+)
+
+// ReplayConsoleLog exposes replayConsoleLog to the specs.
+var ReplayConsoleLog = replayConsoleLog
+
+// AddConsoleSession registers an active console session of the machine. The returned context is done once the
+// session is terminated.
+func AddConsoleSession(s *Server, machine *api.Machine) context.Context {
+	ctx, terminate := context.WithCancel(context.Background())
+	s.activeConsoles.Store(machine.ID, &consoleSession{metadata: machine.Metadata, terminate: terminate})
+	return ctx
+}
+
+// WatchdogActionFor returns the watchdog action of the iri machine on a server with the given default action.
+func WatchdogActionFor(defaultAction api.WatchdogAction, iriMachine *iri.Machine) (api.WatchdogAction, error) {
+	return (&Server{watchdogAction: defaultAction}).watchdogActionFor(iriMachine)
+}
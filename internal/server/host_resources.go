@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ironcore-dev/libvirt-provider/internal/mcr"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// hostResources returns the resources of the host available to machines. The memory reservation is
+// determined anew on every call, so it follows changed cgroup limits.
+func (s *Server) hostResources(ctx context.Context) (*mcr.Host, error) {
+	host, err := mcr.GetResources(ctx, s.enableHugepages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get host resources: %w", err)
+	}
+	if s.enableHugepages || s.memoryReservation == nil {
+		return host, nil
+	}
+
+	reserved, err := s.memoryReservation.ReservedMemory(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reserved memory: %w", err)
+	}
+	host.Mem = resource.NewQuantity(max(0, host.Mem.Value()-reserved), resource.BinarySI)
+	return host, nil
+}
+
+// hostResourcesSnapshotTTL is the time Status and the capacity metrics report the capacity of the host from a
+// snapshot of its resources.
+const hostResourcesSnapshotTTL = 10 * time.Second
+
+// hostResourcesSnapshot are the resources of the host available to machines at a point in time.
+type hostResourcesSnapshot struct {
+	host    *mcr.Host
+	takenAt time.Time
+}
+
+// hostResourcesFromSnapshot returns the resources of the host of a snapshot not older than
+// hostResourcesSnapshotTTL. Callers finding a current snapshot don't wait for anything, only taking a new
+// snapshot is serialized. The returned resources must not be modified.
+func (s *Server) hostResourcesFromSnapshot(ctx context.Context) (*mcr.Host, error) {
+	if snapshot := s.hostSnapshot.Load(); snapshot != nil && time.Since(snapshot.takenAt) < hostResourcesSnapshotTTL {
+		return snapshot.host, nil
+	}
+
+	s.hostSnapshotMu.Lock()
+	defer s.hostSnapshotMu.Unlock()
+
+	// Another caller may have taken a snapshot while waiting.
+	if snapshot := s.hostSnapshot.Load(); snapshot != nil && time.Since(snapshot.takenAt) < hostResourcesSnapshotTTL {
+		return snapshot.host, nil
+	}
+
+	host, err := s.hostResources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.hostSnapshot.Store(&hostResourcesSnapshot{host: host, takenAt: time.Now()})
+	return host, nil
+}
@@ -0,0 +1,131 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/inventory"
+)
+
+// Inventory returns the hardware of the host as seen by the resource sources, along with the machines the
+// resources are allocated to.
+func (s *Server) Inventory(ctx context.Context) (*inventory.Inventory, error) {
+	machines, err := s.machineStore.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list machines: %w", err)
+	}
+
+	cpu, err := inventory.ReadCPUTopology(s.sysDir)
+	if err != nil {
+		return nil, err
+	}
+	inv := &inventory.Inventory{CPU: cpu}
+
+	if s.hugepages != nil {
+		allocated, err := s.numaNodeAllocations(ctx, "")
+		if err != nil {
+			return nil, err
+		}
+		for _, node := range s.hugepages.Nodes() {
+			inv.HugepagePools = append(inv.HugepagePools, inventory.HugepagePool{
+				NUMANode:       node.ID,
+				PageSize:       node.PageSize,
+				Pages:          node.Pages,
+				AllocatedBytes: allocated[node.ID],
+			})
+		}
+	}
+
+	if s.pciDevices != nil {
+		allocatedTo := make(map[string]string)
+		for _, machine := range machines {
+			for _, device := range machine.Spec.PCIDevices {
+				allocatedTo[device.Address] = machine.ID
+			}
+		}
+		for _, device := range s.pciDevices.Devices() {
+			address := device.Address.String()
+			inv.PCIDevices = append(inv.PCIDevices, inventory.ReadPCIDevice(s.sysDir, inventory.PCIDevice{
+				Resource:    device.Resource,
+				Address:     address,
+				AllocatedTo: allocatedTo[address],
+			}))
+		}
+	}
+
+	if s.mdevDevices != nil {
+		types, err := s.mdevDevices.Types()
+		if err != nil {
+			return nil, err
+		}
+		profiles := s.mdevDevices.Profiles()
+		for _, typ := range types {
+			mdevType := inventory.MdevType{Type: typ}
+			for _, profile := range profiles {
+				if profile.Type == typ.ID {
+					mdevType.Resource = profile.Resource
+				}
+			}
+			for _, machine := range machines {
+				if slices.ContainsFunc(machine.Spec.MdevDevices, func(device api.MdevDeviceSpec) bool {
+					return device.Parent == typ.Parent && device.Type == typ.ID
+				}) {
+					mdevType.AllocatedTo = append(mdevType.AllocatedTo, machine.ID)
+				}
+			}
+			inv.MdevTypes = append(inv.MdevTypes, mdevType)
+		}
+	}
+
+	if s.usbDevices != nil {
+		allocatedTo := make(map[string]string)
+		for _, machine := range machines {
+			for _, device := range machine.Spec.USBDevices {
+				allocatedTo[device.ID] = machine.ID
+			}
+		}
+		for _, device := range s.usbDevices.Devices() {
+			usbDevice := inventory.USBDevice{
+				Resource:    device.Resource,
+				ID:          device.ID(),
+				AllocatedTo: allocatedTo[device.ID()],
+			}
+			if address, err := s.usbDevices.Resolve(device.Spec()); err == nil {
+				usbDevice.Present, usbDevice.Bus, usbDevice.Device = true, address.Bus, address.Device
+			}
+			inv.USBDevices = append(inv.USBDevices, usbDevice)
+		}
+	}
+
+	if inv.NetworkInterfaces, err = inventory.ReadNetworkInterfaces(s.sysDir); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// InventoryHandler returns the handler serving the inventory of the host as json.
+func (s *Server) InventoryHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		inv, err := s.Inventory(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(inv)
+	})
+}
@@ -6,10 +6,16 @@ package server
 import (
 	"context"
 	"fmt"
+	"maps"
+	"strconv"
+	"strings"
 
 	"github.com/go-logr/logr"
 	iri "github.com/ironcore-dev/ironcore/iri/apis/machine/v1alpha1"
 	"github.com/ironcore-dev/libvirt-provider/api"
+	providernetworkinterface "github.com/ironcore-dev/libvirt-provider/internal/plugins/networkinterface"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func (s *Server) convertMachineToIRIMachine(ctx context.Context, log logr.Logger, machine *api.Machine) (*iri.Machine, error) {
@@ -17,6 +23,25 @@ func (s *Server) convertMachineToIRIMachine(ctx context.Context, log logr.Logger
 	if err != nil {
 		return nil, fmt.Errorf("error getting iri metadata: %w", err)
 	}
+	if len(machine.Spec.Topology) > 0 {
+		// The topology of the host takes precedence over labels of the client.
+		if metadata.Labels == nil {
+			metadata.Labels = make(map[string]string, len(machine.Spec.Topology))
+		}
+		maps.Copy(metadata.Labels, machine.Spec.Topology)
+	}
+	if node := machine.Spec.NUMANode; node != nil {
+		if metadata.Labels == nil {
+			metadata.Labels = make(map[string]string, 1)
+		}
+		metadata.Labels[api.NUMANodeLabel] = strconv.Itoa(*node)
+	}
+	if machine.DeletedAt != nil && len(machine.Finalizers) > 0 {
+		if metadata.Annotations == nil {
+			metadata.Annotations = make(map[string]string, 1)
+		}
+		metadata.Annotations[api.FinalizersAnnotation] = strings.Join(machine.Finalizers, ",")
+	}
 
 	spec, err := s.getIRIMachineSpec(machine)
 	if err != nil {
@@ -287,3 +312,15 @@ func (s *Server) getNICFromIRINIC(iriNIC *iri.NetworkInterface) (*api.NetworkInt
 		Attributes: iriNIC.Attributes,
 	}, nil
 }
+
+// validateNetworkInterfaceSpec rejects network interfaces the network interface plugin can't configure.
+func (s *Server) validateNetworkInterfaceSpec(spec *api.NetworkInterfaceSpec) error {
+	validator, ok := s.networkInterfacePlugin.(providernetworkinterface.Validator)
+	if !ok {
+		return nil
+	}
+	if err := validator.Validate(spec); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 
 	iri "github.com/ironcore-dev/ironcore/iri/apis/machine/v1alpha1"
 	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/reservation"
 	"github.com/ironcore-dev/libvirt-provider/internal/store"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -30,6 +31,9 @@ func (s *Server) updateAnnotations(ctx context.Context, machine *api.Machine, an
 func (s *Server) UpdateMachineAnnotations(ctx context.Context, req *iri.UpdateMachineAnnotationsRequest) (*iri.UpdateMachineAnnotationsResponse, error) {
 	log := s.loggerFrom(ctx)
 
+	s.machineLocks.Lock(req.MachineId)
+	defer s.machineLocks.Unlock(req.MachineId)
+
 	log.V(1).Info("Getting machine")
 	machine, err := s.machineStore.Get(ctx, req.MachineId)
 	if err != nil {
@@ -39,9 +43,50 @@ func (s *Server) UpdateMachineAnnotations(ctx context.Context, req *iri.UpdateMa
 		return nil, status.Errorf(codes.NotFound, "machine %s not found", req.MachineId)
 	}
 
+	if err := validateDeletionAnnotations(req.Annotations); err != nil {
+		return nil, err
+	}
+
+	// The resources of all sources are allocated or none, see reservation.Transaction.
+	tx := reservation.Begin(machine.ID)
+	defer tx.Rollback()
+
+	if err := s.updateMachineClass(ctx, tx, log, machine, req.Annotations); err != nil {
+		return nil, err
+	}
+
+	if err := s.updateMachinePCIDevices(ctx, tx, log.WithName("resource-manager"), machine, req.Annotations); err != nil {
+		return nil, err
+	}
+
+	if err := s.updateMachineMdevDevices(ctx, tx, log.WithName("resource-manager"), machine, req.Annotations); err != nil {
+		return nil, err
+	}
+
+	if err := s.updateMachineUSBDevices(ctx, tx, log.WithName("resource-manager"), machine, req.Annotations); err != nil {
+		return nil, err
+	}
+
+	if err := s.updateMachineSuspend(ctx, tx, log, machine, req.Annotations); err != nil {
+		return nil, err
+	}
+
+	if err := updateMachineBootDevice(log, machine, req.Annotations); err != nil {
+		return nil, err
+	}
+
+	if err := s.updateMachineIPXEScript(log, machine, req.Annotations); err != nil {
+		return nil, err
+	}
+
+	if err := s.updateMachineRebuild(log, machine, req.Annotations); err != nil {
+		return nil, err
+	}
+
 	if err := s.updateAnnotations(ctx, machine, req.Annotations); err != nil {
 		return nil, fmt.Errorf("failed to update machine annotations: %w", err)
 	}
+	tx.Commit()
 
 	return &iri.UpdateMachineAnnotationsResponse{}, nil
 }
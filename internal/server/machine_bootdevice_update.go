@@ -0,0 +1,41 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/api"
+)
+
+// updateMachineBootDevice changes the boot device of the machine to the one requested by the BootDeviceAnnotation.
+// The reconciler applies it once it creates the domain of the machine again.
+func updateMachineBootDevice(log logr.Logger, machine *api.Machine, annotations map[string]string) error {
+	bootDevice, err := bootDeviceFor(annotations)
+	if err != nil {
+		return err
+	}
+	if bootDevice == machine.Spec.BootDevice {
+		return nil
+	}
+
+	log.V(1).Info("Changing boot device of machine", "BootDevice", bootDevice)
+	machine.Spec.BootDevice = bootDevice
+	return nil
+}
+
+// updateMachineIPXEScript changes the iPXE script of the machine to the one of the IPXEScriptAnnotation. Like the
+// boot device, the reconciler applies it once it creates the domain of the machine again.
+func (s *Server) updateMachineIPXEScript(log logr.Logger, machine *api.Machine, annotations map[string]string) error {
+	script, err := s.ipxeScriptFor(annotations, machine.Spec.BootDevice)
+	if err != nil {
+		return err
+	}
+	if script == machine.Spec.IPXEScript {
+		return nil
+	}
+
+	log.V(1).Info("Changing ipxe script of machine")
+	machine.Spec.IPXEScript = script
+	return nil
+}
@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/reservation"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// checkCapacity ensures the host has the capacity for the machine with the given class and resources besides
+// all other machines and reserves it. Machines consume the host resources according to the overcommit of their
+// class.
+func (s *Server) checkCapacity(ctx context.Context, tx *reservation.Transaction, machine *api.Machine, className string, cpuMillis, memoryBytes int64) error {
+	host, err := s.hostResources(ctx)
+	if err != nil {
+		return err
+	}
+
+	s.reservations.capacityMu.Lock()
+	defer s.reservations.capacityMu.Unlock()
+
+	reserved := s.reservations.capacity.Reserved(machine.ID)
+	machines, err := s.machineStore.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list machines: %w", err)
+	}
+
+	machineCPUMillis, machineMemoryBytes := s.machineClasses.Overcommit(className).Host(cpuMillis, memoryBytes)
+	otherCPUMillis, otherMemoryBytes := s.allocatedResources(machines, machine.ID)
+	allocatedCPUMillis := machineCPUMillis + otherCPUMillis + reserved[capacityResourceCPU]
+	allocatedMemoryBytes := machineMemoryBytes + otherMemoryBytes + reserved[capacityResourceMemory]
+
+	if allocatedCPUMillis > host.Cpu.Value() {
+		return status.Errorf(codes.ResourceExhausted, "not enough cpu on host: %d millis allocated of %d", allocatedCPUMillis, host.Cpu.Value())
+	}
+	if allocatedMemoryBytes > host.Mem.Value() {
+		return status.Errorf(codes.ResourceExhausted, "not enough memory on host: %d bytes allocated of %d", allocatedMemoryBytes, host.Mem.Value())
+	}
+	return s.reservations.capacity.Reserve(tx, map[string]int64{
+		capacityResourceCPU:    machineCPUMillis,
+		capacityResourceMemory: machineMemoryBytes,
+	})
+}
+
+// updateMachineClass changes the machine class of the machine to the one requested by the MachineClassAnnotation,
+// if any. The machine reconciler hot plugs the changed vCPUs and memory of running machines. The memory of
+// machines can only be reduced while they are powered off.
+func (s *Server) updateMachineClass(ctx context.Context, tx *reservation.Transaction, log logr.Logger, machine *api.Machine, annotations map[string]string) error {
+	className, ok := annotations[api.MachineClassAnnotation]
+	if !ok {
+		return nil
+	}
+	if current, _ := api.GetClassLabel(machine); current == className {
+		return nil
+	}
+
+	class, found := s.machineClasses.Get(className)
+	if !found {
+		return status.Errorf(codes.InvalidArgument, "machine class %q not supported", className)
+	}
+
+	cpu, memory := calcResources(class)
+	if memory < machine.Spec.MemoryBytes && machine.Status.State != api.MachineStateTerminated {
+		return status.Errorf(codes.FailedPrecondition, "memory of machine %s can only be reduced while it is powered off", machine.ID)
+	}
+	if err := s.checkCapacity(ctx, tx, machine, className, cpu, memory); err != nil {
+		return err
+	}
+	if err := s.allocateNUMANode(ctx, tx, machine, memory); err != nil {
+		return err
+	}
+
+	currentClassName, _ := api.GetClassLabel(machine)
+	currentCPU, currentMemory, currentQoS, currentIOThreads := machine.Spec.CpuMillis, machine.Spec.MemoryBytes, machine.Spec.QoS, machine.Spec.IOThreads
+	if err := tx.OnRollback(func() {
+		machine.Spec.CpuMillis, machine.Spec.MemoryBytes, machine.Spec.QoS, machine.Spec.IOThreads = currentCPU, currentMemory, currentQoS, currentIOThreads
+		api.SetClassLabel(machine, currentClassName)
+	}); err != nil {
+		return err
+	}
+
+	log.V(1).Info("Changing machine class", "MachineClass", className, "CpuMillis", cpu, "MemoryBytes", memory)
+	machine.Spec.CpuMillis = cpu
+	machine.Spec.MemoryBytes = memory
+	machine.Spec.QoS = s.qosFor(className, cpu, memory)
+	machine.Spec.IOThreads = s.machineClasses.IOThreads(className)
+	api.SetClassLabel(machine, className)
+	return nil
+}
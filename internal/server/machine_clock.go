@@ -0,0 +1,67 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	iri "github.com/ironcore-dev/ironcore/iri/apis/machine/v1alpha1"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// clockFor returns the clock of a new machine. It is the one of the profile requested by the ClockAnnotation
+// of the iri machine or of the default profile, with the single settings of the annotation applied.
+func (s *Server) clockFor(iriMachine *iri.Machine) (*api.ClockSpec, error) {
+	value, ok := iriMachine.Metadata.Annotations[api.ClockAnnotation]
+	if !ok {
+		clock := s.clockProfile.Clock()
+		return &clock, nil
+	}
+
+	settings := make(map[string]string)
+	for _, setting := range strings.Split(value, ",") {
+		key, val, ok := strings.Cut(strings.TrimSpace(setting), "=")
+		if !ok {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid clock setting %q, expected key=value", setting)
+		}
+		settings[key] = val
+	}
+
+	profile := s.clockProfile
+	if val, ok := settings["profile"]; ok {
+		profile = api.ClockProfile(val)
+		if !slices.Contains(api.ClockProfiles(), profile) {
+			return nil, status.Errorf(codes.InvalidArgument, "unsupported clock profile %q, supported: %v", val, api.ClockProfiles())
+		}
+		delete(settings, "profile")
+	}
+	clock := profile.Clock()
+
+	for key, val := range settings {
+		var err error
+		switch key {
+		case "offset":
+			clock.Offset = api.ClockOffset(val)
+			if !slices.Contains(api.ClockOffsets(), clock.Offset) {
+				return nil, status.Errorf(codes.InvalidArgument, "unsupported clock offset %q, supported: %v", val, api.ClockOffsets())
+			}
+		case "hpet":
+			clock.HPET, err = strconv.ParseBool(val)
+		case "hyperv":
+			clock.HyperV, err = strconv.ParseBool(val)
+		case "tsc-frequency":
+			clock.TSCFrequency, err = strconv.ParseUint(val, 10, 64)
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "unknown clock setting %q", key)
+		}
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid value %q of clock setting %s", val, key)
+		}
+	}
+	return &clock, nil
+}
@@ -5,11 +5,29 @@ package server
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
 
+	"github.com/digitalocean/go-libvirt"
 	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/controller-utils/metautils"
 	iri "github.com/ironcore-dev/ironcore/iri/apis/machine/v1alpha1"
+	machinepoolletv1alpha1 "github.com/ironcore-dev/ironcore/poollet/machinepoollet/api/v1alpha1"
 	api "github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/correlation"
+	libvirtutils "github.com/ironcore-dev/libvirt-provider/internal/libvirt/utils"
+	"github.com/ironcore-dev/libvirt-provider/internal/reservation"
+	"github.com/ironcore-dev/libvirt-provider/internal/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 func calcResources(class *iri.MachineClass) (int64, int64) {
@@ -17,26 +35,223 @@ func calcResources(class *iri.MachineClass) (int64, int64) {
 	return class.Capabilities.CpuMillis, class.Capabilities.MemoryBytes
 }
 
-func (s *Server) createMachineFromIRIMachine(ctx context.Context, log logr.Logger, iriMachine *iri.Machine) (*api.Machine, error) {
-	log.V(2).Info("Getting libvirt machine config")
+// rootDiskBytesFor returns the root disk size requested by the RootDiskSizeAnnotation of the iri machine, if any.
+func rootDiskBytesFor(iriMachine *iri.Machine) (int64, error) {
+	value, ok := iriMachine.Metadata.Annotations[api.RootDiskSizeAnnotation]
+	if !ok {
+		return 0, nil
+	}
+
+	size, err := resource.ParseQuantity(value)
+	if err != nil {
+		return 0, status.Errorf(codes.InvalidArgument, "invalid root disk size %q: %v", value, err)
+	}
+	if size.Sign() <= 0 {
+		return 0, status.Errorf(codes.InvalidArgument, "root disk size %q must be positive", value)
+	}
+	return size.Value(), nil
+}
+
+// watchdogActionFor returns the watchdog action requested by the WatchdogActionAnnotation of the iri machine,
+// or the default watchdog action.
+func (s *Server) watchdogActionFor(iriMachine *iri.Machine) (api.WatchdogAction, error) {
+	value, ok := iriMachine.Metadata.Annotations[api.WatchdogActionAnnotation]
+	if !ok {
+		return s.watchdogAction, nil
+	}
+
+	action := api.WatchdogAction(value)
+	if !slices.Contains(api.WatchdogActions(), action) {
+		return "", status.Errorf(codes.InvalidArgument, "unsupported watchdog action %q, supported: %v", value, api.WatchdogActions())
+	}
+	return action, nil
+}
+
+// restartPolicyFor returns the restart policy requested by the RestartPolicyAnnotation of the iri machine,
+// or the default restart policy.
+func (s *Server) restartPolicyFor(iriMachine *iri.Machine) (api.RestartPolicy, error) {
+	value, ok := iriMachine.Metadata.Annotations[api.RestartPolicyAnnotation]
+	if !ok {
+		return s.restartPolicy, nil
+	}
+
+	policy := api.RestartPolicy(value)
+	if !slices.Contains(api.RestartPolicies(), policy) {
+		return "", status.Errorf(codes.InvalidArgument, "unsupported restart policy %q, supported: %v", value, api.RestartPolicies())
+	}
+	return policy, nil
+}
+
+// bootDeviceFor returns the boot device requested by the BootDeviceAnnotation of the annotations, if any.
+func bootDeviceFor(annotations map[string]string) (api.BootDevice, error) {
+	value, ok := annotations[api.BootDeviceAnnotation]
+	if !ok {
+		return "", nil
+	}
+
+	bootDevice := api.BootDevice(value)
+	if !slices.Contains(api.BootDevices(), bootDevice) {
+		return "", status.Errorf(codes.InvalidArgument, "unsupported boot device %q, supported: %v", value, api.BootDevices())
+	}
+	return bootDevice, nil
+}
+
+// ipxeScriptFor returns the iPXE script requested by the IPXEScriptAnnotation of the annotations, if any.
+// Scripts require iPXE to be configured and the machine to boot from the network.
+func (s *Server) ipxeScriptFor(annotations map[string]string, bootDevice api.BootDevice) (string, error) {
+	script, ok := annotations[api.IPXEScriptAnnotation]
+	if !ok {
+		return "", nil
+	}
+
+	if !s.ipxe {
+		return "", status.Errorf(codes.InvalidArgument, "ipxe scripts are not supported by this provider")
+	}
+	if bootDevice != api.BootDeviceNetwork {
+		return "", status.Errorf(codes.InvalidArgument, "ipxe scripts require boot device %s", api.BootDeviceNetwork)
+	}
+	if !strings.HasPrefix(script, "#!ipxe") {
+		return "", status.Errorf(codes.InvalidArgument, "ipxe script has to start with #!ipxe")
+	}
+	return script, nil
+}
+
+// dryRunFor reports whether the DryRunAnnotation of the iri machine requests a dry run of the creation.
+func dryRunFor(iriMachine *iri.Machine) (bool, error) {
+	value, ok := iriMachine.Metadata.Annotations[api.DryRunAnnotation]
+	if !ok {
+		return false, nil
+	}
+
+	dryRun, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, status.Errorf(codes.InvalidArgument, "invalid value %q of annotation %s, expected a boolean", value, api.DryRunAnnotation)
+	}
+	return dryRun, nil
+}
+
+// domainUUIDFor determines the domain UUID of a new machine and ensures no domain with that UUID exists yet.
+func (s *Server) domainUUIDFor(machineID string) (string, error) {
+	domainUUID, err := libvirtutils.DomainUUID(s.domainUUIDMapping, machineID)
+	if err != nil {
+		return "", fmt.Errorf("failed to determine domain uuid: %w", err)
+	}
+
+	if _, err := s.libvirt.DomainLookupByUUID(libvirtutils.UUIDStringToBytes(domainUUID)); err != nil {
+		if !libvirt.IsNotFound(err) {
+			return "", fmt.Errorf("failed to look up domain %s: %w", domainUUID, err)
+		}
+		return domainUUID, nil
+	}
+	return "", status.Errorf(codes.AlreadyExists, "domain with uuid %s already exists", domainUUID)
+}
 
-	switch {
-	case iriMachine == nil:
-		return nil, fmt.Errorf("iri machine is nil")
-	case iriMachine.Spec == nil:
-		return nil, fmt.Errorf("iri machine spec is nil")
-	case iriMachine.Metadata == nil:
-		return nil, fmt.Errorf("iri machine metadata is nil")
+// idempotencyKeyFor returns the idempotency key of the iri machine: the IdempotencyKeyAnnotation or, if not
+// set, the UID of the machinepoollet machine. Surrounding whitespace is not part of the key.
+func idempotencyKeyFor(iriMachine *iri.Machine) string {
+	if key := strings.TrimSpace(iriMachine.Metadata.Annotations[api.IdempotencyKeyAnnotation]); key != "" {
+		return key
+	}
+	return strings.TrimSpace(iriMachine.Metadata.Labels[machinepoolletv1alpha1.MachineUIDLabel])
+}
+
+// requestDigestFor returns the sha256 digest of the iri machine, telling retries of a creation from other
+// creations reusing its idempotency key.
+func requestDigestFor(iriMachine *iri.Machine) (string, error) {
+	// Struct fields are marshalled in order and map keys sorted, so equal machines have equal digests.
+	data, err := json.Marshal(iriMachine)
+	if err != nil {
+		return "", fmt.Errorf("error marshalling machine: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// machineForIdempotencyKey returns the machine created before for key, if it still exists and is not
+// being deleted. It fails if the machine was created by a request with another digest.
+func (s *Server) machineForIdempotencyKey(ctx context.Context, key, requestDigest string) (*api.Machine, error) {
+	if key == "" {
+		return nil, nil
+	}
+
+	id, createdDigest, ok, err := s.idempotencyKeys.Get(key)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	machine, err := s.machineStore.Get(ctx, id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error getting machine of idempotency key: %w", err)
+	}
+	if machine.DeletedAt != nil {
+		return nil, nil
 	}
+	if createdDigest != "" && createdDigest != requestDigest {
+		return nil, status.Errorf(codes.FailedPrecondition, "idempotency key %q was used to create machine %s by another request", key, machine.ID)
+	}
+	return machine, nil
+}
+
+// createMachineFromIRIMachine creates the machine of the iri machine if the host has the capacity for it. On a dry
+// run, the same checks are done and the created machine is returned without storing it.
+func (s *Server) createMachineFromIRIMachine(ctx context.Context, log logr.Logger, iriMachine *iri.Machine, dryRun bool) (*api.Machine, error) {
+	log.V(2).Info("Getting libvirt machine config")
 
 	class, found := s.machineClasses.Get(iriMachine.Spec.Class)
 	if !found {
-		return nil, fmt.Errorf("machine class '%s' not supported", iriMachine.Spec.Class)
+		return nil, status.Errorf(codes.InvalidArgument, "machine class '%s' not supported", iriMachine.Spec.Class)
 	}
 	log.V(2).Info("Validated class")
 
 	cpu, memory := calcResources(class)
 
+	rootDiskBytes, err := rootDiskBytesFor(iriMachine)
+	if err != nil {
+		return nil, err
+	}
+
+	watchdogAction, err := s.watchdogActionFor(iriMachine)
+	if err != nil {
+		return nil, err
+	}
+
+	restartPolicy, err := s.restartPolicyFor(iriMachine)
+	if err != nil {
+		return nil, err
+	}
+
+	tpm, err := tpmFor(iriMachine)
+	if err != nil {
+		return nil, err
+	}
+
+	launchSecurity, err := launchSecurityFor(iriMachine)
+	if err != nil {
+		return nil, err
+	}
+
+	clock, err := s.clockFor(iriMachine)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateDeletionAnnotations(iriMachine.Metadata.Annotations); err != nil {
+		return nil, err
+	}
+
+	bootDevice, err := bootDeviceFor(iriMachine.Metadata.Annotations)
+	if err != nil {
+		return nil, err
+	}
+
+	ipxeScript, err := s.ipxeScriptFor(iriMachine.Metadata.Annotations, bootDevice)
+	if err != nil {
+		return nil, err
+	}
+
 	power, err := s.getPowerStateFromIRI(iriMachine.Spec.Power)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get power state: %w", err)
@@ -60,12 +275,22 @@ func (s *Server) createMachineFromIRIMachine(ctx context.Context, log logr.Logge
 			Ips:        iriNetworkInterface.Ips,
 			Attributes: iriNetworkInterface.Attributes,
 		}
+		if err := s.validateNetworkInterfaceSpec(networkInterfaceSpec); err != nil {
+			return nil, err
+		}
 		networkInterfaces = append(networkInterfaces, networkInterfaceSpec)
 	}
 
+	id := s.idGen.Generate()
+	domainUUID, err := s.domainUUIDFor(id)
+	if err != nil {
+		return nil, err
+	}
+	log.V(2).Info("Determined domain uuid", "DomainUUID", domainUUID)
+
 	machine := &api.Machine{
 		Metadata: api.Metadata{
-			ID: s.idGen.Generate(),
+			ID: id,
 		},
 		Spec: api.MachineSpec{
 			Power:             power,
@@ -73,8 +298,20 @@ func (s *Server) createMachineFromIRIMachine(ctx context.Context, log logr.Logge
 			MemoryBytes:       memory,
 			Volumes:           volumes,
 			Ignition:          iriMachine.Spec.IgnitionData,
+			RootDiskBytes:     rootDiskBytes,
 			NetworkInterfaces: networkInterfaces,
 			GuestAgent:        s.guestAgent,
+			WatchdogAction:    watchdogAction,
+			RestartPolicy:     restartPolicy,
+			TPM:               tpm,
+			LaunchSecurity:    launchSecurity,
+			BootDevice:        bootDevice,
+			IPXEScript:        ipxeScript,
+			Clock:             clock,
+			DomainUUID:        domainUUID,
+			Topology:          maps.Clone(s.topologyLabels),
+			QoS:               s.qosFor(iriMachine.Spec.Class, cpu, memory),
+			IOThreads:         s.machineClasses.IOThreads(iriMachine.Spec.Class),
 		},
 	}
 
@@ -83,15 +320,37 @@ func (s *Server) createMachineFromIRIMachine(ctx context.Context, log logr.Logge
 	}
 	api.SetClassLabel(machine, iriMachine.Spec.Class)
 	api.SetManagerLabel(machine, api.MachineManager)
+	if traceParent := correlation.TraceParent(ctx); traceParent != "" {
+		metautils.SetAnnotation(machine, api.TraceParentAnnotation, traceParent)
+	}
 
 	if iriMachine.Spec.Image != nil {
 		machine.Spec.Image = &iriMachine.Spec.Image.Image
 	}
 
+	tx := reservation.Begin(machine.ID)
+	defer tx.Rollback()
+	if err := s.checkCapacity(ctx, tx, machine, iriMachine.Spec.Class, cpu, memory); err != nil {
+		return nil, err
+	}
+	if s.hugepages != nil {
+		if err := s.allocateNUMANode(ctx, tx, machine, memory); err != nil {
+			return nil, err
+		}
+	}
+
+	if dryRun {
+		log.V(1).Info("Machine could be created, skipping creation of dry run")
+		// The machine of a dry run is returned with its allocations, only the reservations are released.
+		tx.Commit()
+		return machine, nil
+	}
+
 	apiMachine, err := s.machineStore.Create(ctx, machine)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create machine: %w", err)
 	}
+	tx.Commit()
 
 	return apiMachine, nil
 }
@@ -99,10 +358,49 @@ func (s *Server) createMachineFromIRIMachine(ctx context.Context, log logr.Logge
 func (s *Server) CreateMachine(ctx context.Context, req *iri.CreateMachineRequest) (res *iri.CreateMachineResponse, retErr error) {
 	log := s.loggerFrom(ctx)
 
-	log.V(1).Info("Creating machine from iri machine")
-	machine, err := s.createMachineFromIRIMachine(ctx, log, req.Machine)
+	if errs := validateCreateMachineRequest(req); len(errs) > 0 {
+		return nil, invalidArgumentError(errs)
+	}
+
+	dryRun, err := dryRunFor(req.Machine)
+	if err != nil {
+		return nil, err
+	}
+
+	key := idempotencyKeyFor(req.Machine)
+	if dryRun {
+		// Dry runs neither return nor remember machines of idempotency keys.
+		key = ""
+	}
+	var requestDigest string
+	if key != "" {
+		if requestDigest, err = requestDigestFor(req.Machine); err != nil {
+			return nil, err
+		}
+
+		locker := s.idempotencyKeys.Locker(key)
+		locker.Lock()
+		defer locker.Unlock()
+	}
+
+	machine, err := s.machineForIdempotencyKey(ctx, key, requestDigest)
 	if err != nil {
-		return nil, fmt.Errorf("unable to get libvirt machine config: %w", err)
+		return nil, err
+	}
+	if machine != nil {
+		log.V(1).Info("Returning machine created before for idempotency key", "MachineID", machine.ID)
+	} else {
+		log.V(1).Info("Creating machine from iri machine")
+		machine, err = s.createMachineFromIRIMachine(ctx, log, req.Machine, dryRun)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get libvirt machine config: %w", err)
+		}
+
+		if key != "" {
+			if err := s.idempotencyKeys.Put(key, machine.ID, requestDigest); err != nil {
+				log.Error(err, "Failed to remember idempotency key of machine", "MachineID", machine.ID)
+			}
+		}
 	}
 
 	log.V(1).Info("Converting machine to iri machine")
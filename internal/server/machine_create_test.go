@@ -7,11 +7,22 @@ import (
 	"time"
 
 	"github.com/digitalocean/go-libvirt"
+	"github.com/google/uuid"
 	iri "github.com/ironcore-dev/ironcore/iri/apis/machine/v1alpha1"
 	irimeta "github.com/ironcore-dev/ironcore/iri/apis/meta/v1alpha1"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/idempotency"
 	libvirtutils "github.com/ironcore-dev/libvirt-provider/internal/libvirt/utils"
+	"github.com/ironcore-dev/libvirt-provider/internal/mcr"
+	"github.com/ironcore-dev/libvirt-provider/internal/server"
+	"github.com/ironcore-dev/libvirt-provider/internal/store"
+	"github.com/ironcore-dev/libvirt-provider/internal/utils"
+	"github.com/ironcore-dev/libvirt-provider/pkg/libvirt/fake"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"libvirt.org/go/libvirtxml"
 )
 
 const (
@@ -40,6 +51,7 @@ var _ = Describe("CreateMachine", func() {
 		By("ensuring the correct creation response")
 		Expect(createResp).Should(SatisfyAll(
 			HaveField("Machine.Metadata.Id", Not(BeEmpty())),
+			HaveField("Machine.Metadata.Labels", HaveKeyWithValue(topologyZoneLabel, topologyZone)),
 			HaveField("Machine.Spec.Power", iri.Power_POWER_ON),
 			HaveField("Machine.Spec.Image", BeNil()),
 			HaveField("Machine.Spec.Class", machineClassx3xlarge),
@@ -467,4 +479,286 @@ var _ = Describe("CreateMachine", func() {
 			HaveField("State", Equal(iri.MachineState_MACHINE_RUNNING)),
 		))
 	})
+
+	It("should create a machine with the clock of the windows profile", func(ctx SpecContext) {
+		By("creating a machine with the windows clock profile")
+		createResp, err := machineClient.CreateMachine(ctx, &iri.CreateMachineRequest{
+			Machine: &iri.Machine{
+				Metadata: &irimeta.ObjectMetadata{
+					Annotations: map[string]string{
+						api.ClockAnnotation: "profile=windows,tsc-frequency=2500000000",
+					},
+				},
+				Spec: &iri.MachineSpec{
+					Power: iri.Power_POWER_ON,
+					Class: machineClassx3xlarge,
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		DeferCleanup(func(ctx SpecContext) {
+			Eventually(func(g Gomega) bool {
+				_, err := machineClient.DeleteMachine(ctx, &iri.DeleteMachineRequest{MachineId: createResp.Machine.Metadata.Id})
+				g.Expect(err).To(SatisfyAny(
+					BeNil(),
+					MatchError(ContainSubstring("NotFound")),
+				))
+				_, err = libvirtConn.DomainLookupByUUID(libvirtutils.UUIDStringToBytes(createResp.Machine.Metadata.Id))
+				return libvirt.IsNotFound(err)
+			}).Should(BeTrue())
+		})
+
+		By("ensuring the domain has the clock and enlightenments of the profile")
+		var domain libvirt.Domain
+		Eventually(func() error {
+			domain, err = libvirtConn.DomainLookupByUUID(libvirtutils.UUIDStringToBytes(createResp.Machine.Metadata.Id))
+			return err
+		}).Should(Succeed())
+		domainXMLData, err := libvirtConn.DomainGetXMLDesc(domain, 0)
+		Expect(err).NotTo(HaveOccurred())
+		domainXML := &libvirtxml.Domain{}
+		Expect(domainXML.Unmarshal(domainXMLData)).To(Succeed())
+		Expect(domainXML.Clock.Offset).To(Equal("localtime"))
+		Expect(domainXML.Clock.Timer).To(ContainElements(
+			SatisfyAll(HaveField("Name", "hpet"), HaveField("Present", "no")),
+			HaveField("Name", "hypervclock"),
+			SatisfyAll(HaveField("Name", "tsc"), HaveField("Frequency", uint64(2500000000))),
+		))
+		Expect(domainXML.Features.HyperV).NotTo(BeNil())
+	})
+
+	It("should reject a machine with an invalid clock", func(ctx SpecContext) {
+		_, err := machineClient.CreateMachine(ctx, &iri.CreateMachineRequest{
+			Machine: &iri.Machine{
+				Metadata: &irimeta.ObjectMetadata{
+					Annotations: map[string]string{
+						api.ClockAnnotation: "profile=macos",
+					},
+				},
+				Spec: &iri.MachineSpec{
+					Power: iri.Power_POWER_ON,
+					Class: machineClassx3xlarge,
+				},
+			},
+		})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
+
+	It("should reject an invalid machine with field violations", func(ctx SpecContext) {
+		_, err := machineClient.CreateMachine(ctx, &iri.CreateMachineRequest{
+			Machine: &iri.Machine{
+				Metadata: &irimeta.ObjectMetadata{},
+				Spec: &iri.MachineSpec{
+					Power: iri.Power_POWER_ON,
+					Image: &iri.ImageSpec{
+						Image: "Invalid:Image",
+					},
+					Class: machineClassx3xlarge,
+					Volumes: []*iri.Volume{
+						{
+							Name:      "disk-1",
+							Device:    "oda",
+							EmptyDisk: &iri.EmptyDisk{SizeBytes: emptyDiskSize},
+						},
+						{
+							Name:      "disk-2",
+							Device:    "oda",
+							EmptyDisk: &iri.EmptyDisk{SizeBytes: emptyDiskSize},
+						},
+					},
+				},
+			},
+		})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		Expect(status.Convert(err).Details()).To(ConsistOf(
+			HaveField("FieldViolations", ConsistOf(
+				HaveField("Field", "machine.spec.image.image"),
+				HaveField("Field", "machine.spec.volumes[1].device"),
+			)),
+		))
+	})
+
+	It("should return the machine created first for retries with the same idempotency key", func(ctx SpecContext) {
+		req := &iri.CreateMachineRequest{
+			Machine: &iri.Machine{
+				Metadata: &irimeta.ObjectMetadata{
+					Annotations: map[string]string{
+						api.IdempotencyKeyAnnotation: "create-machine-retry",
+					},
+				},
+				Spec: &iri.MachineSpec{
+					Power: iri.Power_POWER_OFF,
+					Class: machineClassx3xlarge,
+				},
+			},
+		}
+
+		By("creating the machine")
+		createResp, err := machineClient.CreateMachine(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		DeferCleanup(func(ctx SpecContext) {
+			Eventually(func(g Gomega) bool {
+				_, err := machineClient.DeleteMachine(ctx, &iri.DeleteMachineRequest{MachineId: createResp.Machine.Metadata.Id})
+				g.Expect(err).To(SatisfyAny(
+					BeNil(),
+					MatchError(ContainSubstring("NotFound")),
+				))
+				_, err = libvirtConn.DomainLookupByUUID(libvirtutils.UUIDStringToBytes(createResp.Machine.Metadata.Id))
+				return libvirt.IsNotFound(err)
+			}).Should(BeTrue())
+		})
+
+		By("retrying the creation")
+		retryResp, err := machineClient.CreateMachine(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(retryResp.Machine.Metadata.Id).To(Equal(createResp.Machine.Metadata.Id))
+
+		By("ensuring only one machine has been created")
+		var matching []*iri.Machine
+		listResp, err := machineClient.ListMachines(ctx, &iri.ListMachinesRequest{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(listResp.Machines).To(ContainElement(
+			HaveField("Metadata.Annotations", HaveKeyWithValue(api.IdempotencyKeyAnnotation, "create-machine-retry")),
+			&matching,
+		))
+		Expect(matching).To(ConsistOf(HaveField("Metadata.Id", createResp.Machine.Metadata.Id)))
+	})
+
+	It("should reject other creations reusing the idempotency key of a machine", func(ctx SpecContext) {
+		idempotencyKeys, err := idempotency.NewStore(GinkgoT().TempDir(), time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		machineClasses, err := mcr.NewMachineClassRegistry([]mcr.MachineClass{{
+			MachineClass: iri.MachineClass{
+				Name: "small",
+				Capabilities: &iri.MachineClassCapabilities{
+					CpuMillis:   500,
+					MemoryBytes: 1 << 20,
+				},
+			},
+		}})
+		Expect(err).NotTo(HaveOccurred())
+		srv, machines := newFakeServer(server.Options{IdempotencyKeys: idempotencyKeys, MachineClasses: machineClasses})
+
+		newRequest := func(power iri.Power) *iri.CreateMachineRequest {
+			return &iri.CreateMachineRequest{
+				Machine: &iri.Machine{
+					Metadata: &irimeta.ObjectMetadata{
+						Annotations: map[string]string{
+							api.IdempotencyKeyAnnotation: "create-machine-reused",
+						},
+					},
+					Spec: &iri.MachineSpec{
+						Power: power,
+						Class: "small",
+					},
+				},
+			}
+		}
+
+		By("creating the machine")
+		createResp, err := srv.CreateMachine(ctx, newRequest(iri.Power_POWER_OFF))
+		Expect(err).NotTo(HaveOccurred())
+
+		By("retrying the creation")
+		retryResp, err := srv.CreateMachine(ctx, newRequest(iri.Power_POWER_OFF))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(retryResp.Machine.Metadata.Id).To(Equal(createResp.Machine.Metadata.Id))
+
+		By("creating another machine with the same idempotency key")
+		_, err = srv.CreateMachine(ctx, newRequest(iri.Power_POWER_ON))
+		Expect(status.Code(err)).To(Equal(codes.FailedPrecondition))
+		Expect(err).To(MatchError(ContainSubstring(createResp.Machine.Metadata.Id)))
+		Expect(machines.List(ctx)).To(ConsistOf(HaveField("ID", createResp.Machine.Metadata.Id)))
+	})
+
+	It("should reject a machine whose domain exists already", func(ctx SpecContext) {
+		lv := fake.SetupLibvirt()
+		machineID := uuid.NewString()
+		srv, machines := newFakeServer(server.Options{
+			Libvirt:           lv,
+			IDGen:             utils.IdGenerateFunc(func() string { return machineID }),
+			DomainUUIDMapping: libvirtutils.DomainUUIDMappingDerived,
+		})
+
+		By("defining a domain with the uuid the machine id is mapped to")
+		domainUUID, err := libvirtutils.DomainUUID(libvirtutils.DomainUUIDMappingDerived, machineID)
+		Expect(err).NotTo(HaveOccurred())
+		domainXML, err := (&libvirtxml.Domain{Name: "foreign", UUID: domainUUID, Type: "kvm"}).Marshal()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = lv.DomainDefineXMLFlags(domainXML, 0)
+		Expect(err).NotTo(HaveOccurred())
+
+		By("creating the machine")
+		_, err = srv.CreateMachine(ctx, &iri.CreateMachineRequest{
+			Machine: &iri.Machine{
+				Metadata: &irimeta.ObjectMetadata{},
+				Spec: &iri.MachineSpec{
+					Power: iri.Power_POWER_ON,
+					Class: machineClassx3xlarge,
+				},
+			},
+		})
+		Expect(status.Code(err)).To(Equal(codes.AlreadyExists))
+
+		_, err = machines.Get(ctx, machineID)
+		Expect(err).To(MatchError(store.ErrNotFound))
+	})
+
+	It("should check the capacity of the host on dry runs like on creations", func(ctx SpecContext) {
+		machineClasses, err := mcr.NewMachineClassRegistry([]mcr.MachineClass{{
+			MachineClass: iri.MachineClass{
+				Name: "huge",
+				Capabilities: &iri.MachineClassCapabilities{
+					CpuMillis:   1 << 40,
+					MemoryBytes: 1 << 30,
+				},
+			},
+		}})
+		Expect(err).NotTo(HaveOccurred())
+		srv, machines := newFakeServer(server.Options{MachineClasses: machineClasses})
+
+		newRequest := func(annotations map[string]string) *iri.CreateMachineRequest {
+			return &iri.CreateMachineRequest{
+				Machine: &iri.Machine{
+					Metadata: &irimeta.ObjectMetadata{Annotations: annotations},
+					Spec: &iri.MachineSpec{
+						Power: iri.Power_POWER_ON,
+						Class: "huge",
+					},
+				},
+			}
+		}
+
+		By("doing a dry run of a machine exceeding the cpu of the host")
+		_, dryRunErr := srv.CreateMachine(ctx, newRequest(map[string]string{api.DryRunAnnotation: "true"}))
+		Expect(status.Code(dryRunErr)).To(Equal(codes.ResourceExhausted))
+		Expect(machines.List(ctx)).To(BeEmpty())
+
+		By("creating the machine")
+		_, err = srv.CreateMachine(ctx, newRequest(nil))
+		Expect(err).To(MatchError(dryRunErr.Error()))
+		Expect(machines.List(ctx)).To(BeEmpty())
+	})
+})
+
+var _ = Describe("WatchdogActionFor", func() {
+	machineWithAnnotations := func(annotations map[string]string) *iri.Machine {
+		return &iri.Machine{Metadata: &irimeta.ObjectMetadata{Annotations: annotations}}
+	}
+
+	DescribeTable("taking the watchdog action of the annotation",
+		func(annotations map[string]string, expected api.WatchdogAction) {
+			Expect(server.WatchdogActionFor(api.WatchdogActionReset, machineWithAnnotations(annotations))).To(Equal(expected))
+		},
+		Entry("default without annotation", nil, api.WatchdogActionReset),
+		Entry("power off", map[string]string{api.WatchdogActionAnnotation: "poweroff"}, api.WatchdogActionPowerOff),
+		Entry("none", map[string]string{api.WatchdogActionAnnotation: "none"}, api.WatchdogActionNone),
+	)
+
+	It("should reject unsupported watchdog actions", func() {
+		_, err := server.WatchdogActionFor(api.WatchdogActionReset, machineWithAnnotations(map[string]string{api.WatchdogActionAnnotation: "pause"}))
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+	})
 })
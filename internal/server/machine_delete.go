@@ -7,17 +7,46 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 
 	iri "github.com/ironcore-dev/ironcore/iri/apis/machine/v1alpha1"
+	"github.com/ironcore-dev/libvirt-provider/api"
 	"github.com/ironcore-dev/libvirt-provider/internal/store"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+// validateDeletionAnnotations checks the values of the DeletionProtectionAnnotation and the ForceDeleteAnnotation.
+func validateDeletionAnnotations(annotations map[string]string) error {
+	for _, key := range []string{api.DeletionProtectionAnnotation, api.ForceDeleteAnnotation} {
+		value, ok := annotations[key]
+		if !ok {
+			continue
+		}
+		if _, err := strconv.ParseBool(value); err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid value %q of annotation %s, expected a boolean", value, key)
+		}
+	}
+	return nil
+}
+
 func (s *Server) DeleteMachine(ctx context.Context, req *iri.DeleteMachineRequest) (*iri.DeleteMachineResponse, error) {
 	log := s.loggerFrom(ctx)
 
-	log.V(1).Info("Deleting machine")
+	log.V(1).Info("Getting machine")
+	machine, err := s.machineStore.Get(ctx, req.MachineId)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			return nil, fmt.Errorf("error getting machine: %w", err)
+		}
+		return nil, status.Errorf(codes.NotFound, "machine %s not found", req.MachineId)
+	}
+
+	if api.IsDeletionProtected(machine.Metadata) && !api.IsForceDeleted(machine.Metadata) {
+		return nil, status.Errorf(codes.FailedPrecondition, "machine %s is protected against deletion, set annotation %s to delete it anyway", req.MachineId, api.ForceDeleteAnnotation)
+	}
+
+	log.V(1).Info("Deleting machine", "Force", api.IsForceDeleted(machine.Metadata))
 	if err := s.machineStore.Delete(ctx, req.MachineId); err != nil {
 		if !errors.Is(err, store.ErrNotFound) {
 			return nil, fmt.Errorf("error deleting machine: %w", err)
@@ -25,5 +54,8 @@ func (s *Server) DeleteMachine(ctx context.Context, req *iri.DeleteMachineReques
 		return nil, status.Errorf(codes.NotFound, "machine %s not found", req.MachineId)
 	}
 
+	s.terminateConsole(log, req.MachineId, "machine is being deleted")
+	s.removeProfiles(log, req.MachineId)
+
 	return &iri.DeleteMachineResponse{}, nil
 }
@@ -8,11 +8,17 @@ import (
 	"time"
 
 	"github.com/digitalocean/go-libvirt"
+	"github.com/google/uuid"
 	iri "github.com/ironcore-dev/ironcore/iri/apis/machine/v1alpha1"
 	irimeta "github.com/ironcore-dev/ironcore/iri/apis/meta/v1alpha1"
+	"github.com/ironcore-dev/libvirt-provider/api"
 	libvirtutils "github.com/ironcore-dev/libvirt-provider/internal/libvirt/utils"
+	"github.com/ironcore-dev/libvirt-provider/internal/server"
+	"github.com/ironcore-dev/libvirt-provider/internal/store"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 var _ = Describe("DeleteMachine", func() {
@@ -226,4 +232,66 @@ var _ = Describe("DeleteMachine", func() {
 		machineFile := filepath.Join(tempDir, "libvirt-provider", "machines", createResp.Machine.Metadata.Id)
 		Expect(machineFile).NotTo(BeAnExistingFile())
 	})
+
+	It("should reject the deletion of a protected machine unless it is force deleted", func(ctx SpecContext) {
+		srv, machines := newFakeServer(server.Options{})
+
+		By("storing a protected machine")
+		machine := &api.Machine{Metadata: api.Metadata{ID: uuid.NewString()}}
+		Expect(api.SetObjectMetadata(machine, &irimeta.ObjectMetadata{
+			Annotations: map[string]string{api.DeletionProtectionAnnotation: "true"},
+		})).To(Succeed())
+		machine, err := machines.Create(ctx, machine)
+		Expect(err).NotTo(HaveOccurred())
+
+		By("deleting the machine")
+		_, err = srv.DeleteMachine(ctx, &iri.DeleteMachineRequest{MachineId: machine.ID})
+		Expect(status.Code(err)).To(Equal(codes.FailedPrecondition))
+		Expect(machines.Get(ctx, machine.ID)).To(HaveField("DeletedAt", BeNil()))
+
+		By("force deleting the machine")
+		_, err = srv.UpdateMachineAnnotations(ctx, &iri.UpdateMachineAnnotationsRequest{
+			MachineId: machine.ID,
+			Annotations: map[string]string{
+				api.DeletionProtectionAnnotation: "true",
+				api.ForceDeleteAnnotation:        "true",
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = srv.DeleteMachine(ctx, &iri.DeleteMachineRequest{MachineId: machine.ID})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = machines.Get(ctx, machine.ID)
+		Expect(err).To(MatchError(store.ErrNotFound))
+	})
+
+	It("should reject invalid values of the deletion annotations", func(ctx SpecContext) {
+		srv, machines := newFakeServer(server.Options{})
+
+		By("creating a machine with an invalid deletion protection")
+		_, err := srv.CreateMachine(ctx, &iri.CreateMachineRequest{
+			Machine: &iri.Machine{
+				Metadata: &irimeta.ObjectMetadata{
+					Annotations: map[string]string{api.DeletionProtectionAnnotation: "yes please"},
+				},
+				Spec: &iri.MachineSpec{
+					Power: iri.Power_POWER_ON,
+					Class: machineClassx3xlarge,
+				},
+			},
+		})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		Expect(machines.List(ctx)).To(BeEmpty())
+
+		By("updating the annotations of a machine with an invalid force delete")
+		machine, err := machines.Create(ctx, &api.Machine{Metadata: api.Metadata{ID: uuid.NewString()}})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = srv.UpdateMachineAnnotations(ctx, &iri.UpdateMachineAnnotationsRequest{
+			MachineId:   machine.ID,
+			Annotations: map[string]string{api.ForceDeleteAnnotation: "maybe"},
+		})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+		machine, err = machines.Get(ctx, machine.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(api.IsForceDeleted(machine.Metadata)).To(BeFalse())
+	})
 })
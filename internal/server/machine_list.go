@@ -33,8 +33,13 @@ func (s *Server) getLibvirtMachine(ctx context.Context, id string) (*api.Machine
 	return machine, nil
 }
 
-func (s *Server) listMachines(ctx context.Context, log logr.Logger) ([]*iri.Machine, error) {
-	machines, err := s.machineStore.List(ctx)
+func (s *Server) listMachines(ctx context.Context, log logr.Logger, filter *iri.MachineFilter) ([]*iri.Machine, error) {
+	var opts store.ListOptions
+	if filter != nil && len(filter.LabelSelector) > 0 {
+		opts.LabelSelector = labels.SelectorFromSet(filter.LabelSelector)
+	}
+
+	machines, _, err := s.machineStore.ListWithOptions(ctx, opts)
 	if err != nil {
 		return nil, fmt.Errorf("error listing machines: %w", err)
 	}
@@ -55,25 +60,6 @@ func (s *Server) listMachines(ctx context.Context, log logr.Logger) ([]*iri.Mach
 	return res, nil
 }
 
-func (s *Server) filterMachines(machines []*iri.Machine, filter *iri.MachineFilter) []*iri.Machine {
-	if filter == nil {
-		return machines
-	}
-
-	var (
-		res []*iri.Machine
-		sel = labels.SelectorFromSet(filter.LabelSelector)
-	)
-	for _, iriMachine := range machines {
-		if !sel.Matches(labels.Set(iriMachine.Metadata.Labels)) {
-			continue
-		}
-
-		res = append(res, iriMachine)
-	}
-	return res
-}
-
 func (s *Server) getMachine(ctx context.Context, log logr.Logger, id string) (*iri.Machine, error) {
 	libvirtMachine, err := s.getLibvirtMachine(ctx, id)
 	if err != nil {
@@ -102,13 +88,11 @@ func (s *Server) ListMachines(ctx context.Context, req *iri.ListMachinesRequest)
 		}, nil
 	}
 
-	machines, err := s.listMachines(ctx, log)
+	machines, err := s.listMachines(ctx, log, req.Filter)
 	if err != nil {
 		return nil, err
 	}
 
-	machines = s.filterMachines(machines, req.Filter)
-
 	return &iri.ListMachinesResponse{
 		Machines: machines,
 	}, nil
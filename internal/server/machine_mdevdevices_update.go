@@ -0,0 +1,88 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/mdev"
+	"github.com/ironcore-dev/libvirt-provider/internal/pci"
+	"github.com/ironcore-dev/libvirt-provider/internal/reservation"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// mdevDevicesOfOthers returns the mediated devices allocated to or reserved for the machines other than the
+// given one.
+func (s *Server) mdevDevicesOfOthers(ctx context.Context, machine *api.Machine) ([]api.MdevDeviceSpec, error) {
+	var devices []api.MdevDeviceSpec
+	for device := range s.reservations.mdevDevices.Reserved(machine.ID) {
+		devices = append(devices, device)
+	}
+
+	machines, err := s.machineStore.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list machines: %w", err)
+	}
+
+	for _, other := range machines {
+		if other.ID == machine.ID {
+			continue
+		}
+		devices = append(devices, other.Spec.MdevDevices...)
+	}
+	return devices, nil
+}
+
+// updateMachineMdevDevices allocates the mediated devices requested by the MdevDevicesAnnotation to the machine
+// and releases the devices no longer requested. The machine reconciler creates, attaches, detaches and removes
+// the instances.
+func (s *Server) updateMachineMdevDevices(ctx context.Context, tx *reservation.Transaction, log logr.Logger, machine *api.Machine, annotations map[string]string) error {
+	requests, err := pci.ParseRequests(annotations[api.MdevDevicesAnnotation])
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid mdev devices: %v", err)
+	}
+	if len(requests) == 0 && len(machine.Spec.MdevDevices) == 0 {
+		return nil
+	}
+	if s.mdevDevices == nil {
+		return status.Errorf(codes.FailedPrecondition, "no mdev devices configured")
+	}
+
+	s.reservations.mdevDevicesMu.Lock()
+	defer s.reservations.mdevDevicesMu.Unlock()
+
+	others, err := s.mdevDevicesOfOthers(ctx, machine)
+	if err != nil {
+		return err
+	}
+
+	devices, err := s.mdevDevices.Allocate(requests, machine.Spec.MdevDevices, others)
+	if err != nil {
+		if errors.Is(err, mdev.ErrInsufficientDevices) {
+			return status.Error(codes.ResourceExhausted, err.Error())
+		}
+		return fmt.Errorf("failed to allocate mdev devices: %w", err)
+	}
+	if slices.Equal(devices, machine.Spec.MdevDevices) {
+		return nil
+	}
+
+	if err := reserveDevices(s.reservations.mdevDevices, tx, devices); err != nil {
+		return err
+	}
+	current := machine.Spec.MdevDevices
+	if err := tx.OnRollback(func() { machine.Spec.MdevDevices = current }); err != nil {
+		return err
+	}
+
+	log.V(1).Info("Updating mdev devices", "MdevDevices", devices)
+	machine.Spec.MdevDevices = devices
+	return nil
+}
@@ -14,19 +14,25 @@ func (s *Server) AttachNetworkInterface(ctx context.Context, req *iri.AttachNetw
 	log := s.loggerFrom(ctx)
 	log.V(1).Info("Attaching NIC to machine")
 
-	if req == nil {
-		return nil, fmt.Errorf("AttachNetworkInterfaceRequest is nil")
+	if errs := validateAttachNetworkInterfaceRequest(req); len(errs) > 0 {
+		return nil, invalidArgumentError(errs)
 	}
 
 	apiMachine, err := s.machineStore.Get(ctx, req.MachineId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get machine: %w", err)
 	}
+	if errs := validateAttachedNetworkInterface(apiMachine, req.NetworkInterface); len(errs) > 0 {
+		return nil, invalidArgumentError(errs)
+	}
 
 	nicSpec, err := s.getNICFromIRINIC(req.NetworkInterface)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get nic from iri nic: %w", err)
 	}
+	if err := s.validateNetworkInterfaceSpec(nicSpec); err != nil {
+		return nil, err
+	}
 
 	apiMachine.Spec.NetworkInterfaces = append(apiMachine.Spec.NetworkInterfaces, nicSpec)
 
@@ -9,6 +9,8 @@ import (
 
 	iri "github.com/ironcore-dev/ironcore/iri/apis/machine/v1alpha1"
 	"github.com/ironcore-dev/libvirt-provider/api"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func (s *Server) DetachNetworkInterface(
@@ -19,7 +21,7 @@ func (s *Server) DetachNetworkInterface(
 	log.V(1).Info("Detaching nic from machine")
 
 	if req == nil {
-		return nil, fmt.Errorf("DetachNetworkInterface is nil")
+		return nil, status.Error(codes.InvalidArgument, "DetachNetworkInterface is nil")
 	}
 
 	apiMachine, err := s.machineStore.Get(ctx, req.MachineId)
@@ -38,7 +40,7 @@ func (s *Server) DetachNetworkInterface(
 	}
 
 	if !found {
-		return nil, fmt.Errorf("nic '%s' not found in machine '%s'", req.Name, req.MachineId)
+		return nil, status.Errorf(codes.NotFound, "nic '%s' not found in machine '%s'", req.Name, req.MachineId)
 	}
 
 	apiMachine.Spec.NetworkInterfaces = updatedNICS
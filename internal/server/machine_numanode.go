@@ -0,0 +1,118 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/hugepages"
+	"github.com/ironcore-dev/libvirt-provider/internal/reservation"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// numaNodeAllocations returns the hugepage memory in bytes allocated to the machines other than the given one
+// per NUMA node. Suspended machines release their memory until they are resumed.
+func (s *Server) numaNodeAllocations(ctx context.Context, machineID string) (map[int]int64, error) {
+	machines, err := s.machineStore.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list machines: %w", err)
+	}
+
+	allocated := make(map[int]int64)
+	for _, other := range machines {
+		if other.ID == machineID || other.Spec.Suspend || other.Spec.NUMANode == nil {
+			continue
+		}
+		allocated[*other.Spec.NUMANode] += other.Spec.MemoryBytes
+	}
+	return allocated, nil
+}
+
+// numaNodeHints returns the placement hints of the PreferredNUMANodeAnnotation and AvoidNUMANodesAnnotation.
+func numaNodeHints(annotations map[string]string, fldPath *field.Path) (hugepages.Hints, field.ErrorList) {
+	var (
+		hints   hugepages.Hints
+		allErrs field.ErrorList
+	)
+	if value, ok := annotations[api.PreferredNUMANodeAnnotation]; ok {
+		node, err := parseNUMANode(value)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Key(api.PreferredNUMANodeAnnotation), value, err.Error()))
+		} else {
+			hints.Preferred = &node
+		}
+	}
+	if value, ok := annotations[api.AvoidNUMANodesAnnotation]; ok {
+		for _, id := range strings.Split(value, ",") {
+			node, err := parseNUMANode(strings.TrimSpace(id))
+			if err != nil {
+				allErrs = append(allErrs, field.Invalid(fldPath.Key(api.AvoidNUMANodesAnnotation), value, err.Error()))
+				break
+			}
+			hints.Avoid = append(hints.Avoid, node)
+		}
+	}
+	return hints, allErrs
+}
+
+func parseNUMANode(value string) (int, error) {
+	node, err := strconv.Atoi(value)
+	if err != nil || node < 0 {
+		return 0, fmt.Errorf("must be the non-negative ID of a numa node")
+	}
+	return node, nil
+}
+
+// allocateNUMANode binds the machine to a NUMA node with enough free hugepages for the given memory and
+// reserves the memory. Machines bound to a node already keep it, it only has to have enough free hugepages.
+func (s *Server) allocateNUMANode(ctx context.Context, tx *reservation.Transaction, machine *api.Machine, memoryBytes int64) error {
+	if s.hugepages == nil {
+		return nil
+	}
+
+	s.reservations.numaNodesMu.Lock()
+	defer s.reservations.numaNodesMu.Unlock()
+
+	reserved := s.reservations.numaNodes.Reserved(machine.ID)
+	allocated, err := s.numaNodeAllocations(ctx, machine.ID)
+	if err != nil {
+		return err
+	}
+	for node, bytes := range reserved {
+		allocated[node] += bytes
+	}
+
+	annotations, err := api.GetAnnotationsAnnotation(machine.Metadata)
+	if err != nil {
+		return fmt.Errorf("failed to get annotations: %w", err)
+	}
+	// The hints were validated on creation of the machine.
+	hints, _ := numaNodeHints(annotations, nil)
+
+	node, err := s.hugepages.Allocate(memoryBytes, machine.Spec.NUMANode, allocated, hints)
+	if err != nil {
+		if errors.Is(err, hugepages.ErrInsufficientHugepages) {
+			return status.Error(codes.ResourceExhausted, err.Error())
+		}
+		return fmt.Errorf("failed to allocate numa node: %w", err)
+	}
+	if err := s.reservations.numaNodes.Reserve(tx, map[int]int64{node: memoryBytes}); err != nil {
+		return err
+	}
+	current := machine.Spec.NUMANode
+	if err := tx.OnRollback(func() { machine.Spec.NUMANode = current }); err != nil {
+		return err
+	}
+
+	s.loggerFrom(ctx).WithName("resource-manager").V(2).Info("Allocated numa node", "NUMANode", node)
+	machine.Spec.NUMANode = &node
+	return nil
+}
@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/pci"
+	"github.com/ironcore-dev/libvirt-provider/internal/reservation"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// pciDevicesInUse returns the addresses of the pci devices allocated to or reserved for other machines and of
+// the devices still attached to any machine, including the given one.
+func (s *Server) pciDevicesInUse(ctx context.Context, machine *api.Machine) (sets.Set[string], error) {
+	inUse := sets.New[string]()
+	for address := range s.reservations.pciDevices.Reserved(machine.ID) {
+		inUse.Insert(address)
+	}
+
+	machines, err := s.machineStore.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list machines: %w", err)
+	}
+
+	for _, other := range machines {
+		inUse.Insert(other.Status.PCIDevices...)
+		if other.ID == machine.ID {
+			continue
+		}
+		for _, device := range other.Spec.PCIDevices {
+			inUse.Insert(device.Address)
+		}
+	}
+	return inUse, nil
+}
+
+// updateMachinePCIDevices allocates the pci devices requested by the PCIDevicesAnnotation to the machine and
+// releases the devices no longer requested. The machine reconciler attaches and detaches the devices.
+func (s *Server) updateMachinePCIDevices(ctx context.Context, tx *reservation.Transaction, log logr.Logger, machine *api.Machine, annotations map[string]string) error {
+	requests, err := pci.ParseRequests(annotations[api.PCIDevicesAnnotation])
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid pci devices: %v", err)
+	}
+	if len(requests) == 0 && len(machine.Spec.PCIDevices) == 0 {
+		return nil
+	}
+	if s.pciDevices == nil {
+		return status.Errorf(codes.FailedPrecondition, "no pci devices configured")
+	}
+
+	s.reservations.pciDevicesMu.Lock()
+	defer s.reservations.pciDevicesMu.Unlock()
+
+	inUse, err := s.pciDevicesInUse(ctx, machine)
+	if err != nil {
+		return err
+	}
+
+	devices, err := s.pciDevices.Allocate(requests, machine.Spec.PCIDevices, inUse)
+	if err != nil {
+		if errors.Is(err, pci.ErrInsufficientDevices) {
+			return status.Error(codes.ResourceExhausted, err.Error())
+		}
+		return fmt.Errorf("failed to allocate pci devices: %w", err)
+	}
+	if slices.Equal(devices, machine.Spec.PCIDevices) {
+		return nil
+	}
+
+	addresses := make([]string, 0, len(devices))
+	for _, device := range devices {
+		addresses = append(addresses, device.Address)
+	}
+	if err := reserveDevices(s.reservations.pciDevices, tx, addresses); err != nil {
+		return err
+	}
+	current := machine.Spec.PCIDevices
+	if err := tx.OnRollback(func() { machine.Spec.PCIDevices = current }); err != nil {
+		return err
+	}
+
+	log.V(1).Info("Updating pci devices", "PCIDevices", devices)
+	machine.Spec.PCIDevices = devices
+	return nil
+}
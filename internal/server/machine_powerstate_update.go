@@ -7,6 +7,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	iri "github.com/ironcore-dev/ironcore/iri/apis/machine/v1alpha1"
 	"github.com/ironcore-dev/libvirt-provider/api"
@@ -15,6 +16,21 @@ import (
 	"google.golang.org/grpc/status"
 )
 
+// stopTimeoutFor returns the stop timeout requested by the StopTimeoutAnnotation of the machine, if any.
+func stopTimeoutFor(machine *api.Machine) (time.Duration, error) {
+	annotations, _ := api.GetAnnotationsAnnotation(machine.Metadata)
+	value, ok := annotations[api.StopTimeoutAnnotation]
+	if !ok {
+		return 0, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return 0, status.Errorf(codes.InvalidArgument, "invalid stop timeout %q, expected a positive duration", value)
+	}
+	return timeout, nil
+}
+
 func (s *Server) updatePowerState(ctx context.Context, machine *api.Machine, iriPower iri.Power) error {
 	power, err := s.getPowerStateFromIRI(iriPower)
 	if err != nil {
@@ -42,6 +58,14 @@ func (s *Server) UpdateMachinePower(ctx context.Context, req *iri.UpdateMachineP
 		return nil, status.Errorf(codes.NotFound, "machine %s not found", req.MachineId)
 	}
 
+	if req.Power == iri.Power_POWER_OFF {
+		timeout, err := stopTimeoutFor(machine)
+		if err != nil {
+			return nil, err
+		}
+		machine.Spec.StopTimeout = timeout
+	}
+
 	if err := s.updatePowerState(ctx, machine, req.Power); err != nil {
 		return nil, fmt.Errorf("failed to update power state: %w", err)
 	}
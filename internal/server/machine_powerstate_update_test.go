@@ -7,9 +7,12 @@ import (
 	"github.com/digitalocean/go-libvirt"
 	iri "github.com/ironcore-dev/ironcore/iri/apis/machine/v1alpha1"
 	irimeta "github.com/ironcore-dev/ironcore/iri/apis/meta/v1alpha1"
+	"github.com/ironcore-dev/libvirt-provider/api"
 	libvirtutils "github.com/ironcore-dev/libvirt-provider/internal/libvirt/utils"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // TODO: This test will require update after implementation of: https://github.com/ironcore-dev/libvirt-provider/issues/106
@@ -101,5 +104,60 @@ var _ = Describe("UpdateMachinePower", func() {
 		}).Should(SatisfyAll(
 			HaveField("Power", Equal(iri.Power_POWER_OFF)),
 		))
+
+		By("ensuring the domain of the machine is shut down")
+		Eventually(func() bool {
+			_, _, err := libvirtConn.DomainGetState(domain, 0)
+			return libvirt.IsNotFound(err)
+		}).Should(BeTrue())
+
+		By("ensuring machine is in terminated state")
+		Eventually(func(g Gomega) iri.MachineState {
+			listResp, err := machineClient.ListMachines(ctx, &iri.ListMachinesRequest{
+				Filter: &iri.MachineFilter{
+					Id: createResp.Machine.Metadata.Id,
+				},
+			})
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(listResp.Machines).Should(HaveLen(1))
+			return listResp.Machines[0].Status.State
+		}).Should(Equal(iri.MachineState_MACHINE_TERMINATED))
+	})
+
+	It("should reject powering off a machine with an invalid stop timeout", func(ctx SpecContext) {
+		By("creating a machine with an invalid stop timeout")
+		createResp, err := machineClient.CreateMachine(ctx, &iri.CreateMachineRequest{
+			Machine: &iri.Machine{
+				Metadata: &irimeta.ObjectMetadata{
+					Annotations: map[string]string{
+						api.StopTimeoutAnnotation: "soon",
+					},
+				},
+				Spec: &iri.MachineSpec{
+					Power: iri.Power_POWER_ON,
+					Class: machineClassx3xlarge,
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		DeferCleanup(func(ctx SpecContext) {
+			Eventually(func(g Gomega) bool {
+				_, err := machineClient.DeleteMachine(ctx, &iri.DeleteMachineRequest{MachineId: createResp.Machine.Metadata.Id})
+				g.Expect(err).To(SatisfyAny(
+					BeNil(),
+					MatchError(ContainSubstring("NotFound")),
+				))
+				_, err = libvirtConn.DomainLookupByUUID(libvirtutils.UUIDStringToBytes(createResp.Machine.Metadata.Id))
+				return libvirt.IsNotFound(err)
+			}).Should(BeTrue())
+		})
+
+		By("powering off the machine")
+		_, err = machineClient.UpdateMachinePower(ctx, &iri.UpdateMachinePowerRequest{
+			MachineId: createResp.Machine.Metadata.Id,
+			Power:     iri.Power_POWER_OFF,
+		})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
 	})
 })
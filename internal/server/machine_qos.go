@@ -0,0 +1,39 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"github.com/ironcore-dev/libvirt-provider/api"
+)
+
+// minCPUShares is the smallest cpu weight accepted by the kernel.
+const minCPUShares = 2
+
+// qosFor returns the cpu and memory tuning of a machine of the class with the given resources, or nil if the
+// class has no QoS tier. Burstable machines are weighted by the share of the host they are accounted for after
+// overcommitment, so they can't crowd out guaranteed machines.
+func (s *Server) qosFor(className string, cpuMillis, memoryBytes int64) *api.QoSSpec {
+	switch tier := s.machineClasses.QoS(className); tier {
+	case api.QoSTierGuaranteed:
+		return &api.QoSSpec{
+			Tier:           tier,
+			CPUShares:      cpuShares(cpuMillis),
+			CPUQuotaMillis: cpuMillis,
+		}
+	case api.QoSTierBurstable:
+		hostCPUMillis, hostMemoryBytes := s.machineClasses.Overcommit(className).Host(cpuMillis, memoryBytes)
+		return &api.QoSSpec{
+			Tier:                 tier,
+			CPUShares:            cpuShares(hostCPUMillis),
+			MemorySoftLimitBytes: hostMemoryBytes,
+		}
+	default:
+		return nil
+	}
+}
+
+// cpuShares returns the cpu weight of the given cpu millis, 1024 per cpu like a process.
+func cpuShares(cpuMillis int64) uint {
+	return uint(max(minCPUShares, cpuMillis*1024/1000))
+}
@@ -0,0 +1,30 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// updateMachineRebuild requests a rebuild of the root disk of the machine if the RebuildAnnotation has a new
+// value, optionally from the image of the RebuildImageAnnotation. The machine reconciler performs the rebuild.
+func (s *Server) updateMachineRebuild(log logr.Logger, machine *api.Machine, annotations map[string]string) error {
+	id := annotations[api.RebuildAnnotation]
+	if id == "" || (machine.Spec.Rebuild != nil && machine.Spec.Rebuild.ID == id) {
+		return nil
+	}
+	if machine.Spec.Image == nil {
+		return status.Errorf(codes.FailedPrecondition, "machine %s has no image to rebuild its root disk from", machine.ID)
+	}
+
+	if image := annotations[api.RebuildImageAnnotation]; image != "" {
+		machine.Spec.Image = &image
+	}
+	log.V(1).Info("Requesting rebuild of root disk", "RebuildID", id, "Image", *machine.Spec.Image)
+	machine.Spec.Rebuild = &api.RebuildSpec{ID: id}
+	return nil
+}
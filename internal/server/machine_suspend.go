@@ -0,0 +1,57 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/reservation"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// updateMachineSuspend suspends the machine to disk if the SuspendAnnotation is true and resumes it otherwise.
+// Machines with passthrough PCI devices can't be suspended. Resumed machines need the host capacity again.
+func (s *Server) updateMachineSuspend(ctx context.Context, tx *reservation.Transaction, log logr.Logger, machine *api.Machine, annotations map[string]string) error {
+	var suspend bool
+	if value, ok := annotations[api.SuspendAnnotation]; ok {
+		var err error
+		if suspend, err = strconv.ParseBool(value); err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid value %q of annotation %s, expected a boolean", value, api.SuspendAnnotation)
+		}
+	}
+	if suspend == machine.Spec.Suspend {
+		return nil
+	}
+
+	if suspend {
+		if len(machine.Spec.PCIDevices) > 0 {
+			return status.Errorf(codes.FailedPrecondition, "machine %s with pci devices can't be suspended", machine.ID)
+		}
+		if len(machine.Spec.MdevDevices) > 0 {
+			return status.Errorf(codes.FailedPrecondition, "machine %s with mdev devices can't be suspended", machine.ID)
+		}
+		if len(machine.Spec.USBDevices) > 0 {
+			return status.Errorf(codes.FailedPrecondition, "machine %s with usb devices can't be suspended", machine.ID)
+		}
+	} else {
+		className, _ := api.GetClassLabel(machine)
+		if err := s.checkCapacity(ctx, tx, machine, className, machine.Spec.CpuMillis, machine.Spec.MemoryBytes); err != nil {
+			return err
+		}
+		if err := s.allocateNUMANode(ctx, tx, machine, machine.Spec.MemoryBytes); err != nil {
+			return err
+		}
+	}
+	if err := tx.OnRollback(func() { machine.Spec.Suspend = !suspend }); err != nil {
+		return err
+	}
+
+	log.V(1).Info("Changing suspension of machine", "Suspend", suspend)
+	machine.Spec.Suspend = suspend
+	return nil
+}
@@ -0,0 +1,42 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"slices"
+	"strconv"
+
+	iri "github.com/ironcore-dev/ironcore/iri/apis/machine/v1alpha1"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// tpmFor returns whether the TPMAnnotation of the iri machine requests an emulated TPM.
+func tpmFor(iriMachine *iri.Machine) (bool, error) {
+	value, ok := iriMachine.Metadata.Annotations[api.TPMAnnotation]
+	if !ok {
+		return false, nil
+	}
+
+	tpm, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, status.Errorf(codes.InvalidArgument, "invalid tpm %q: %v", value, err)
+	}
+	return tpm, nil
+}
+
+// launchSecurityFor returns the launch security requested by the LaunchSecurityAnnotation of the iri machine, if any.
+func launchSecurityFor(iriMachine *iri.Machine) (api.LaunchSecurity, error) {
+	value, ok := iriMachine.Metadata.Annotations[api.LaunchSecurityAnnotation]
+	if !ok {
+		return "", nil
+	}
+
+	launchSecurity := api.LaunchSecurity(value)
+	if !slices.Contains(api.LaunchSecurities(), launchSecurity) {
+		return "", status.Errorf(codes.InvalidArgument, "unsupported launch security %q, supported: %v", value, api.LaunchSecurities())
+	}
+	return launchSecurity, nil
+}
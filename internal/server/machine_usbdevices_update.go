@@ -0,0 +1,95 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/pci"
+	"github.com/ironcore-dev/libvirt-provider/internal/reservation"
+	"github.com/ironcore-dev/libvirt-provider/internal/usb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// usbDevicesInUse returns the ids of the usb devices allocated to or reserved for other machines and of the
+// devices still attached to any machine, including the given one.
+func (s *Server) usbDevicesInUse(ctx context.Context, machine *api.Machine) (sets.Set[string], error) {
+	inUse := sets.New[string]()
+	for id := range s.reservations.usbDevices.Reserved(machine.ID) {
+		inUse.Insert(id)
+	}
+
+	machines, err := s.machineStore.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list machines: %w", err)
+	}
+
+	for _, other := range machines {
+		inUse.Insert(other.Status.USBDevices...)
+		if other.ID == machine.ID {
+			continue
+		}
+		for _, device := range other.Spec.USBDevices {
+			inUse.Insert(device.ID)
+		}
+	}
+	return inUse, nil
+}
+
+// updateMachineUSBDevices allocates the usb devices requested by the USBDevicesAnnotation to the machine and
+// releases the devices no longer requested. The machine reconciler attaches and detaches the devices.
+func (s *Server) updateMachineUSBDevices(ctx context.Context, tx *reservation.Transaction, log logr.Logger, machine *api.Machine, annotations map[string]string) error {
+	requests, err := pci.ParseRequests(annotations[api.USBDevicesAnnotation])
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "invalid usb devices: %v", err)
+	}
+	if len(requests) == 0 && len(machine.Spec.USBDevices) == 0 {
+		return nil
+	}
+	if s.usbDevices == nil {
+		return status.Errorf(codes.FailedPrecondition, "no usb devices configured")
+	}
+
+	s.reservations.usbDevicesMu.Lock()
+	defer s.reservations.usbDevicesMu.Unlock()
+
+	inUse, err := s.usbDevicesInUse(ctx, machine)
+	if err != nil {
+		return err
+	}
+
+	devices, err := s.usbDevices.Allocate(requests, machine.Spec.USBDevices, inUse)
+	if err != nil {
+		if errors.Is(err, usb.ErrInsufficientDevices) {
+			return status.Error(codes.ResourceExhausted, err.Error())
+		}
+		return fmt.Errorf("failed to allocate usb devices: %w", err)
+	}
+	if slices.Equal(devices, machine.Spec.USBDevices) {
+		return nil
+	}
+
+	ids := make([]string, 0, len(devices))
+	for _, device := range devices {
+		ids = append(ids, device.ID)
+	}
+	if err := reserveDevices(s.reservations.usbDevices, tx, ids); err != nil {
+		return err
+	}
+	current := machine.Spec.USBDevices
+	if err := tx.OnRollback(func() { machine.Spec.USBDevices = current }); err != nil {
+		return err
+	}
+
+	log.V(1).Info("Updating usb devices", "USBDevices", devices)
+	machine.Spec.USBDevices = devices
+	return nil
+}
@@ -14,14 +14,17 @@ func (s *Server) AttachVolume(ctx context.Context, req *iri.AttachVolumeRequest)
 	log := s.loggerFrom(ctx)
 	log.V(1).Info("Attaching volume to machine")
 
-	if req == nil || req.MachineId == "" || req.Volume == nil {
-		return nil, fmt.Errorf("invalid request")
+	if errs := validateAttachVolumeRequest(req); len(errs) > 0 {
+		return nil, invalidArgumentError(errs)
 	}
 
 	apiMachine, err := s.machineStore.Get(ctx, req.MachineId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get machine: %w", err)
 	}
+	if errs := validateAttachedVolume(apiMachine, req.Volume); len(errs) > 0 {
+		return nil, invalidArgumentError(errs)
+	}
 
 	volumeSpec, err := s.getVolumeFromIRIVolume(req.Volume)
 	if err != nil {
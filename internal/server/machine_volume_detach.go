@@ -9,6 +9,8 @@ import (
 
 	iri "github.com/ironcore-dev/ironcore/iri/apis/machine/v1alpha1"
 	"github.com/ironcore-dev/libvirt-provider/api"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func (s *Server) DetachVolume(ctx context.Context, req *iri.DetachVolumeRequest) (*iri.DetachVolumeResponse, error) {
@@ -16,7 +18,7 @@ func (s *Server) DetachVolume(ctx context.Context, req *iri.DetachVolumeRequest)
 	log.V(1).Info("Detaching volume from machine")
 
 	if req == nil || req.MachineId == "" || req.Name == "" {
-		return nil, fmt.Errorf("invalid request")
+		return nil, status.Error(codes.InvalidArgument, "invalid request")
 	}
 
 	apiMachine, err := s.machineStore.Get(ctx, req.MachineId)
@@ -35,7 +37,7 @@ func (s *Server) DetachVolume(ctx context.Context, req *iri.DetachVolumeRequest)
 	}
 
 	if !found {
-		return nil, fmt.Errorf("volume '%s' not found in machine '%s'", req.Name, req.MachineId)
+		return nil, status.Errorf(codes.NotFound, "volume '%s' not found in machine '%s'", req.Name, req.MachineId)
 	}
 
 	apiMachine.Spec.Volumes = updatedVolumes
@@ -12,6 +12,8 @@ import (
 	libvirtutils "github.com/ironcore-dev/libvirt-provider/internal/libvirt/utils"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"libvirt.org/go/libvirtxml"
 )
 
@@ -208,4 +210,14 @@ var _ = Describe("DetachVolume", func() {
 			HaveField("State", Equal(iri.MachineState_MACHINE_RUNNING)),
 		))
 	})
+
+	It("should return status codes for invalid requests and unknown machines", func(ctx SpecContext) {
+		By("detaching a volume without name")
+		_, err := machineClient.DetachVolume(ctx, &iri.DetachVolumeRequest{MachineId: "foo"})
+		Expect(status.Code(err)).To(Equal(codes.InvalidArgument))
+
+		By("detaching a volume from an unknown machine")
+		_, err = machineClient.DetachVolume(ctx, &iri.DetachVolumeRequest{MachineId: "foo", Name: "volume-1"})
+		Expect(status.Code(err)).To(Equal(codes.NotFound))
+	})
 })
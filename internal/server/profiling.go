@@ -0,0 +1,159 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/ironcore-dev/libvirt-provider/internal/profiling"
+	"github.com/ironcore-dev/libvirt-provider/internal/store"
+)
+
+// profileRequest is a download of a profile approved by a token of the streaming server.
+type profileRequest struct {
+	MachineID string
+	Name      string
+}
+
+// profileResponse is a profile along with the url of the streaming server to download it from, once recorded.
+type profileResponse struct {
+	profiling.Profile
+	URL string `json:"url,omitempty"`
+}
+
+func (s *Server) profileResponse(profile profiling.Profile) (profileResponse, error) {
+	res := profileResponse{Profile: profile}
+	if profile.Running {
+		return res, nil
+	}
+
+	token, err := s.profileRequestCache.Insert(profileRequest{MachineID: profile.MachineID, Name: profile.Name})
+	if err != nil {
+		return profileResponse{}, fmt.Errorf("error inserting profile request: %w", err)
+	}
+	res.URL = s.buildURL("profiles", token)
+	return res, nil
+}
+
+func profilingErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, store.ErrNotFound), errors.Is(err, profiling.ErrNoSession), errors.Is(err, profiling.ErrProfileNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, profiling.ErrSessionActive):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// ProfilingHandler returns the handler of the profiling sessions of machines at /profiles/{machineID}:
+// POST starts a session, optionally limited by the duration query parameter, DELETE stops it and GET lists the
+// profiles of the machine. Recorded profiles are downloaded from the streaming server by the returned urls.
+func (s *Server) ProfilingHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /profiles/{machineID}", func(w http.ResponseWriter, r *http.Request) {
+		profiles, err := s.profiler.List(r.PathValue("machineID"))
+		if err != nil {
+			http.Error(w, err.Error(), profilingErrorStatus(err))
+			return
+		}
+
+		res := make([]profileResponse, 0, len(profiles))
+		for _, profile := range profiles {
+			profileRes, err := s.profileResponse(profile)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			res = append(res, profileRes)
+		}
+		writeJSON(w, res)
+	})
+	mux.HandleFunc("POST /profiles/{machineID}", func(w http.ResponseWriter, r *http.Request) {
+		var duration time.Duration
+		if value := r.URL.Query().Get("duration"); value != "" {
+			var err error
+			if duration, err = time.ParseDuration(value); err != nil {
+				http.Error(w, fmt.Sprintf("invalid duration: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		machine, err := s.machineStore.Get(r.Context(), r.PathValue("machineID"))
+		if err != nil {
+			http.Error(w, err.Error(), profilingErrorStatus(err))
+			return
+		}
+
+		// Domains are named after their machine.
+		profile, err := s.profiler.Start(machine.ID, machine.ID, duration)
+		if err != nil {
+			http.Error(w, err.Error(), profilingErrorStatus(err))
+			return
+		}
+		writeJSON(w, profileResponse{Profile: profile})
+	})
+	mux.HandleFunc("DELETE /profiles/{machineID}", func(w http.ResponseWriter, r *http.Request) {
+		profile, err := s.profiler.Stop(r.PathValue("machineID"))
+		if err != nil {
+			http.Error(w, err.Error(), profilingErrorStatus(err))
+			return
+		}
+
+		res, err := s.profileResponse(profile)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, res)
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// ServeProfile serves the profile approved by the token for download.
+func (s *Server) ServeProfile(w http.ResponseWriter, req *http.Request, token string) {
+	log := logr.FromContextOrDiscard(req.Context())
+
+	request, ok := s.profileRequestCache.Consume(token)
+	if !ok || s.profiler == nil {
+		log.V(1).Info("Rejecting unknown / expired token")
+		http.NotFound(w, req)
+		return
+	}
+
+	file, err := s.profiler.Open(request.MachineID, request.Name)
+	if err != nil {
+		log.Error(err, "error opening profile")
+		http.Error(w, http.StatusText(profilingErrorStatus(err)), profilingErrorStatus(err))
+		return
+	}
+	defer func() { _ = file.Close() }()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", request.MachineID+"-"+request.Name))
+	if _, err := io.Copy(w, file); err != nil {
+		log.Error(err, "error serving profile")
+	}
+}
+
+// removeProfiles stops the profiling session of the machine, if any, and removes its profiles.
+func (s *Server) removeProfiles(log logr.Logger, machineID string) {
+	if s.profiler == nil {
+		return
+	}
+	if err := s.profiler.Remove(machineID); err != nil {
+		log.Error(err, "Failed to remove profiles")
+	}
+}
@@ -0,0 +1,52 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"sync"
+
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/reservation"
+)
+
+// reservations hold the resources allocated to machines by transactions not committed yet, per source. The
+// allocations of other machines take them into account besides the ones of the stored machines.
+//
+// Every source has its own lock, held from determining the allocations of the other machines until the
+// allocation is reserved, so allocations from different sources don't wait for each other. The reservations
+// have to be read before the stored machines: a transaction committing in between is stored before its
+// reservations are released, so it is counted twice at worst but never missed.
+type reservations struct {
+	// capacity are the cpu millis and memory bytes of the host by capacityResourceCPU and capacityResourceMemory.
+	capacity    *reservation.Ledger[string]
+	numaNodes   *reservation.Ledger[int]
+	pciDevices  *reservation.Ledger[string]
+	mdevDevices *reservation.Ledger[api.MdevDeviceSpec]
+	usbDevices  *reservation.Ledger[string]
+
+	capacityMu    sync.Mutex
+	numaNodesMu   sync.Mutex
+	pciDevicesMu  sync.Mutex
+	mdevDevicesMu sync.Mutex
+	usbDevicesMu  sync.Mutex
+}
+
+func newReservations() *reservations {
+	return &reservations{
+		capacity:    reservation.NewLedger[string](),
+		numaNodes:   reservation.NewLedger[int](),
+		pciDevices:  reservation.NewLedger[string](),
+		mdevDevices: reservation.NewLedger[api.MdevDeviceSpec](),
+		usbDevices:  reservation.NewLedger[string](),
+	}
+}
+
+// reserveDevices reserves every device key once.
+func reserveDevices[K comparable](ledger *reservation.Ledger[K], tx *reservation.Transaction, keys []K) error {
+	quantities := make(map[K]int64, len(keys))
+	for _, key := range keys {
+		quantities[key] = 1
+	}
+	return ledger.Reserve(tx, quantities)
+}
@@ -8,20 +8,36 @@ import (
 	"fmt"
 	"net/url"
 	"path"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	"github.com/digitalocean/go-libvirt"
 	"github.com/go-logr/logr"
 	"github.com/google/uuid"
 	"github.com/ironcore-dev/ironcore/broker/common/idgen"
 	"github.com/ironcore-dev/ironcore/broker/common/request"
 	iri "github.com/ironcore-dev/ironcore/iri/apis/machine/v1alpha1"
 	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/console/token"
 	"github.com/ironcore-dev/libvirt-provider/internal/event/machineevent"
+	"github.com/ironcore-dev/libvirt-provider/internal/hugepages"
+	"github.com/ironcore-dev/libvirt-provider/internal/idempotency"
+	"github.com/ironcore-dev/libvirt-provider/internal/inventory"
+	libvirtutils "github.com/ironcore-dev/libvirt-provider/internal/libvirt/utils"
+	"github.com/ironcore-dev/libvirt-provider/internal/maintenance"
+	"github.com/ironcore-dev/libvirt-provider/internal/mcr"
+	"github.com/ironcore-dev/libvirt-provider/internal/mdev"
+	"github.com/ironcore-dev/libvirt-provider/internal/pci"
 	providernetworkinterface "github.com/ironcore-dev/libvirt-provider/internal/plugins/networkinterface"
 	"github.com/ironcore-dev/libvirt-provider/internal/plugins/volume"
+	"github.com/ironcore-dev/libvirt-provider/internal/profiling"
 	"github.com/ironcore-dev/libvirt-provider/internal/store"
+	utilssync "github.com/ironcore-dev/libvirt-provider/internal/sync"
+	"github.com/ironcore-dev/libvirt-provider/internal/usb"
 	"github.com/ironcore-dev/libvirt-provider/internal/utils"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
 	ctrl "sigs.k8s.io/controller-runtime"
 )
 
@@ -32,33 +48,71 @@ type Server struct {
 
 	idGen idgen.IDGen
 
-	machineStore store.Store[*api.Machine]
-	eventStore   machineevent.EventStore
+	machineStore    store.Store[*api.Machine]
+	eventStore      machineevent.EventStore
+	eventRecorder   machineevent.EventRecorder
+	idempotencyKeys *idempotency.Store
 
 	networkInterfacePlugin providernetworkinterface.Plugin
 
 	volumePlugins  *volume.PluginManager
 	machineClasses MachineClassRegistry
 
-	execRequestCache request.Cache[*iri.ExecRequest]
-	activeConsoles   sync.Map
-	libvirt          *libvirt.Libvirt
+	// machineLocks serialize the changes of the resources of a machine, so it has one reservation.Transaction
+	// at a time.
+	machineLocks *utilssync.MutexMap[string]
+	reservations *reservations
 
-	enableHugepages bool
+	consoleTokens       *token.Signer
+	consoleReplayBytes  int64
+	profileRequestCache request.Cache[profileRequest]
+	activeConsoles      sync.Map
+	libvirt             libvirtutils.Client
 
-	guestAgent api.GuestAgent
+	enableHugepages   bool
+	memoryReservation mcr.MemoryReservation
+	// hostSnapshot is the snapshot of the host resources Status and the capacity metrics report the capacity from.
+	hostSnapshot   atomic.Pointer[hostResourcesSnapshot]
+	hostSnapshotMu sync.Mutex
+
+	guestAgent     api.GuestAgent
+	watchdogAction api.WatchdogAction
+	restartPolicy  api.RestartPolicy
+	clockProfile   api.ClockProfile
+	pciDevices     *pci.Source
+	mdevDevices    *mdev.Source
+	usbDevices     *usb.Source
+	hugepages      *hugepages.Source
+	qcow2Type      string
+
+	domainUUIDMapping libvirtutils.DomainUUIDMapping
+
+	topologyLabels map[string]string
+
+	maintenance *maintenance.Mode
+
+	ipxe bool
+
+	sysDir string
+
+	profiler *profiling.Profiler
 }
 
 type Options struct {
 	// BaseURL is the base URL in form http(s)://host:port/path?query to produce request URLs relative to.
 	BaseURL string
 
-	Libvirt *libvirt.Libvirt
+	Libvirt libvirtutils.Client
 
 	IDGen idgen.IDGen
 
 	MachineStore store.Store[*api.Machine]
 	EventStore   machineevent.EventStore
+	// EventRecorder records machine events of the server, e.g. closed console sessions. May be nil.
+	EventRecorder machineevent.EventRecorder
+	// IdempotencyKeys remembers the machines created per idempotency key, see api.IdempotencyKeyAnnotation.
+	// May be nil.
+	IdempotencyKeys *idempotency.Store
 
 	MachineClasses MachineClassRegistry
 
@@ -66,34 +120,141 @@ type Options struct {
 	NetworkPlugins  providernetworkinterface.Plugin
 	EnableHugepages bool
 	GuestAgent      api.GuestAgent
+	// MemoryReservation is the host memory not available to machines unless hugepages are enabled, which are
+	// reserved for machines anyway. May be nil.
+	MemoryReservation mcr.MemoryReservation
+	// WatchdogAction is the action of the watchdog of new machines. If empty, machines get no watchdog
+	// unless requested by the WatchdogActionAnnotation.
+	WatchdogAction api.WatchdogAction
+	// RestartPolicy is the restart policy of new machines unless requested by the RestartPolicyAnnotation.
+	// If empty, api.RestartPolicyAlways applies.
+	RestartPolicy api.RestartPolicy
+	// ClockProfile is the clock profile of new machines unless requested by the ClockAnnotation.
+	// Defaults to api.ClockProfileDefault.
+	ClockProfile api.ClockProfile
+	// PCIDevices are the host PCI devices machines can request via the PCIDevicesAnnotation. May be nil.
+	PCIDevices *pci.Source
+	// MdevDevices are the mediated devices machines can request via the MdevDevicesAnnotation. May be nil.
+	MdevDevices *mdev.Source
+	// USBDevices are the host USB devices machines can request via the USBDevicesAnnotation. May be nil.
+	USBDevices *usb.Source
+	// Hugepages hands out the hugepages of the NUMA nodes of the host, binding every new machine to a node.
+	// Requires EnableHugepages. If nil, machines are not bound to nodes.
+	Hugepages *hugepages.Source
+	// Qcow2Type is the configured qcow2 implementation, reported as part of the provider configuration.
+	Qcow2Type string
+	// DomainUUIDMapping determines the domain UUID of new machines. Defaults to libvirtutils.DomainUUIDMappingMachineID.
+	DomainUUIDMapping libvirtutils.DomainUUIDMapping
+	// TopologyLabels are the topology labels of the host, e.g. its rack, zone and hypervisor ID. They are
+	// stamped into new machines and reported as labels of the IRI machines.
+	TopologyLabels map[string]string
+	// Maintenance is the maintenance mode of the host. While enabled, Status reports no capacity for
+	// any machine class. May be nil.
+	Maintenance *maintenance.Mode
+	// IPXE reports whether machines booting from the network can run iPXE scripts, see api.IPXEScriptAnnotation.
+	IPXE bool
+	// SysDir is the mount point of sysfs the inventory of the host is read from. Defaults to inventory.DefaultSysDir.
+	SysDir string
+	// Profiler records perf profiles of machines on request of the operator. May be nil.
+	Profiler *profiling.Profiler
+	// ConsoleTokenKey is the key the tokens of the console urls are signed with. Streaming servers sharing the
+	// key accept the tokens of each other, as long as they are minted for their url. If empty, a random key is
+	// generated.
+	ConsoleTokenKey []byte
+	// ConsoleTokenTTL is the time a console url can be used for. Defaults to token.DefaultTTL.
+	ConsoleTokenTTL time.Duration
+	// ConsoleReplayBytes is the size of the console output replayed to console sessions before the live
+	// output, so they see the boot messages written before they attached. If zero, nothing is replayed.
+	ConsoleReplayBytes int64
 }
 
 func setOptionsDefaults(o *Options) {
 	if o.IDGen == nil {
 		o.IDGen = utils.IdGenerateFunc(uuid.NewString)
 	}
+	if o.ClockProfile == "" {
+		o.ClockProfile = api.ClockProfileDefault
+	}
+	if o.DomainUUIDMapping == "" {
+		o.DomainUUIDMapping = libvirtutils.DomainUUIDMappingMachineID
+	}
+	if o.SysDir == "" {
+		o.SysDir = inventory.DefaultSysDir
+	}
+	if o.ConsoleTokenTTL == 0 {
+		o.ConsoleTokenTTL = token.DefaultTTL
+	}
 }
 
 func New(opts Options) (*Server, error) {
 	setOptionsDefaults(&opts)
 
+	if !slices.Contains(libvirtutils.DomainUUIDMappings(), opts.DomainUUIDMapping) {
+		return nil, fmt.Errorf("unsupported domain uuid mapping %q", opts.DomainUUIDMapping)
+	}
+
+	for key := range opts.TopologyLabels {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return nil, fmt.Errorf("invalid topology label %q: %v", key, errs)
+		}
+	}
+
 	baseURL, err := url.ParseRequestURI(opts.BaseURL)
 	if err != nil {
 		return nil, fmt.Errorf("invalid base url %q: %w", opts.BaseURL, err)
 	}
 
+	if opts.WatchdogAction != "" && !slices.Contains(api.WatchdogActions(), opts.WatchdogAction) {
+		return nil, fmt.Errorf("unsupported watchdog action %q", opts.WatchdogAction)
+	}
+	if opts.RestartPolicy != "" && !slices.Contains(api.RestartPolicies(), opts.RestartPolicy) {
+		return nil, fmt.Errorf("unsupported restart policy %q", opts.RestartPolicy)
+	}
+	if !slices.Contains(api.ClockProfiles(), opts.ClockProfile) {
+		return nil, fmt.Errorf("unsupported clock profile %q", opts.ClockProfile)
+	}
+	if opts.Hugepages != nil && !opts.EnableHugepages {
+		return nil, fmt.Errorf("numa aware hugepages require hugepages to be enabled")
+	}
+
+	consoleTokens, err := token.NewSigner(opts.ConsoleTokenKey, opts.ConsoleTokenTTL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid console token options: %w", err)
+	}
+
 	return &Server{
 		baseURL:                baseURL,
 		idGen:                  opts.IDGen,
 		libvirt:                opts.Libvirt,
 		machineStore:           opts.MachineStore,
 		eventStore:             opts.EventStore,
+		eventRecorder:          opts.EventRecorder,
+		idempotencyKeys:        opts.IdempotencyKeys,
 		volumePlugins:          opts.VolumePlugins,
 		networkInterfacePlugin: opts.NetworkPlugins,
 		machineClasses:         opts.MachineClasses,
 		enableHugepages:        opts.EnableHugepages,
+		memoryReservation:      opts.MemoryReservation,
 		guestAgent:             opts.GuestAgent,
-		execRequestCache:       request.NewCache[*iri.ExecRequest](),
+		watchdogAction:         opts.WatchdogAction,
+		restartPolicy:          opts.RestartPolicy,
+		clockProfile:           opts.ClockProfile,
+		pciDevices:             opts.PCIDevices,
+		mdevDevices:            opts.MdevDevices,
+		usbDevices:             opts.USBDevices,
+		hugepages:              opts.Hugepages,
+		qcow2Type:              opts.Qcow2Type,
+		domainUUIDMapping:      opts.DomainUUIDMapping,
+		topologyLabels:         opts.TopologyLabels,
+		maintenance:            opts.Maintenance,
+		ipxe:                   opts.IPXE,
+		sysDir:                 opts.SysDir,
+		profiler:               opts.Profiler,
+		consoleTokens:          consoleTokens,
+		consoleReplayBytes:     opts.ConsoleReplayBytes,
+		profileRequestCache:    request.NewCache[profileRequest](),
+		machineLocks:           utilssync.NewMutexMap[string](),
+		reservations:           newReservations(),
 		activeConsoles:         sync.Map{},
 	}, nil
 }
@@ -105,6 +266,14 @@ func (s *Server) loggerFrom(ctx context.Context, keysWithValues ...interface{})
 type MachineClassRegistry interface {
 	Get(volumeClassName string) (*iri.MachineClass, bool)
 	List() []*iri.MachineClass
+	// Overcommit returns the overcommit of the machine class.
+	Overcommit(machineClassName string) mcr.Overcommit
+	// Resources returns the extended resources of the machine class.
+	Resources(machineClassName string) map[string]resource.Quantity
+	// QoS returns the QoS tier of the machine class.
+	QoS(machineClassName string) api.QoSTier
+	// IOThreads returns the number of iothreads of the machines of the class, zero if not set.
+	IOThreads(machineClassName string) uint
 }
 
 func (s *Server) buildURL(method string, token string) string {
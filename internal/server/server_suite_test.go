@@ -19,7 +19,12 @@ import (
 	"github.com/ironcore-dev/libvirt-provider/api"
 	"github.com/ironcore-dev/libvirt-provider/cmd/libvirt-provider/app"
 	"github.com/ironcore-dev/libvirt-provider/internal/event/machineevent"
+	"github.com/ironcore-dev/libvirt-provider/internal/host"
+	"github.com/ironcore-dev/libvirt-provider/internal/mcr"
 	"github.com/ironcore-dev/libvirt-provider/internal/networkinterfaceplugin"
+	"github.com/ironcore-dev/libvirt-provider/internal/server"
+	"github.com/ironcore-dev/libvirt-provider/internal/strategy"
+	"github.com/ironcore-dev/libvirt-provider/pkg/libvirt/fake"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"google.golang.org/grpc"
@@ -38,6 +43,8 @@ const (
 	probeEveryInterval             = 2 * time.Second
 	machineClassx3xlarge           = "x3-xlarge"
 	machineClassx2medium           = "x2-medium"
+	topologyZoneLabel              = "topology.kubernetes.io/zone"
+	topologyZone                   = "zone-a"
 	squashfsOSImage                = "ghcr.io/ironcore-dev/ironcore-image/gardenlinux:squashfs-dev-20240123-v2"
 	emptyDiskSize                  = 1024 * 1024 * 1024
 	baseURL                        = "http://localhost:20251"
@@ -131,6 +138,7 @@ var _ = BeforeSuite(func() {
 		ResyncIntervalGarbageCollector: resyncGarbageCollectorInterval,
 		ResyncIntervalVolumeSize:       resyncVolumeSizeInterval,
 		GuestAgent:                     app.GuestAgentOption(api.GuestAgentNone),
+		TopologyLabels:                 map[string]string{topologyZoneLabel: topologyZone},
 		MachineEventStore: machineevent.EventStoreOptions{
 			MachineEventMaxEvents:      machineEventMaxEvents,
 			MachineEventTTL:            machineEventTTL,
@@ -166,6 +174,45 @@ var _ = BeforeSuite(func() {
 	DeferCleanup(libvirtConn.ConnectClose)
 })
 
+// newFakeServer creates a server on a fake libvirt with the machine class machineClassx3xlarge and a machine
+// store in a temp dir, unless opts specify them.
+func newFakeServer(opts server.Options) (*server.Server, *host.Store[*api.Machine]) {
+	if opts.Libvirt == nil {
+		opts.Libvirt = fake.SetupLibvirt()
+	}
+	if opts.BaseURL == "" {
+		opts.BaseURL = baseURL
+	}
+	if opts.MachineClasses == nil {
+		machineClasses, err := mcr.NewMachineClassRegistry([]mcr.MachineClass{{
+			MachineClass: iriv1alpha1.MachineClass{
+				Name: machineClassx3xlarge,
+				Capabilities: &iriv1alpha1.MachineClassCapabilities{
+					CpuMillis:   4000,
+					MemoryBytes: 8589934592,
+				},
+			},
+		}})
+		Expect(err).NotTo(HaveOccurred())
+		opts.MachineClasses = machineClasses
+	}
+
+	machines, err := host.NewStore(host.Options[*api.Machine]{
+		Dir:            GinkgoT().TempDir(),
+		NewFunc:        func() *api.Machine { return &api.Machine{} },
+		CreateStrategy: strategy.MachineStrategy,
+		AttrsStrategy:  strategy.MachineStrategy,
+	})
+	Expect(err).NotTo(HaveOccurred())
+	if opts.MachineStore == nil {
+		opts.MachineStore = machines
+	}
+
+	srv, err := server.New(opts)
+	Expect(err).NotTo(HaveOccurred())
+	return srv, machines
+}
+
 func isSocketAvailable(socketPath string) error {
 	fileInfo, err := os.Stat(socketPath)
 	if err != nil {
@@ -5,7 +5,6 @@ package server
 
 import (
 	"context"
-	"fmt"
 
 	iri "github.com/ironcore-dev/ironcore/iri/apis/machine/v1alpha1"
 	"github.com/ironcore-dev/libvirt-provider/internal/mcr"
@@ -14,24 +13,48 @@ import (
 func (s *Server) Status(ctx context.Context, req *iri.StatusRequest) (*iri.StatusResponse, error) {
 	log := s.loggerFrom(ctx)
 
-	host, err := mcr.GetResources(ctx, s.enableHugepages)
+	// Status is called frequently, so it doesn't determine the host resources anew every time.
+	host, err := s.hostResourcesFromSnapshot(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get host resources: %w", err)
+		return nil, err
 	}
 
 	log.V(1).Info("Listing machine classes")
 	machineClassList := s.machineClasses.List()
 
+	// Nothing new is scheduled onto hosts in maintenance, the existing machines are managed as usual.
+	inMaintenance := s.maintenance.Enabled()
+	if inMaintenance {
+		log.V(1).Info("Host is in maintenance, reporting no capacity")
+	}
+
 	var machineClassStatus []*iri.MachineClassStatus
 	for _, machineClass := range machineClassList {
+		var quantity int64
+		if !inMaintenance {
+			quantity = s.machineClassQuantity(machineClass, host)
+		}
 		machineClassStatus = append(machineClassStatus, &iri.MachineClassStatus{
 			MachineClass: machineClass,
-			Quantity:     mcr.GetQuantity(machineClass, host),
+			Quantity:     quantity,
 		})
 	}
 
+	s.setConfigurationHeader(ctx)
+	s.setCapacityHeader(ctx, host, inMaintenance)
+
 	log.V(1).Info("Returning machine classes")
 	return &iri.StatusResponse{
 		MachineClassStatus: machineClassStatus,
 	}, nil
 }
+
+// machineClassQuantity returns the number of machines of the class fitting onto the host.
+func (s *Server) machineClassQuantity(machineClass *iri.MachineClass, host *mcr.Host) int64 {
+	quantity := mcr.GetOvercommittedQuantity(machineClass, s.machineClasses.Overcommit(machineClass.Name), host)
+	if s.hugepages != nil {
+		// Machines can't span nodes, so the memory left on every node may not fit another machine.
+		quantity = min(quantity, s.hugepages.Quantity(machineClass.Capabilities.MemoryBytes))
+	}
+	return quantity
+}
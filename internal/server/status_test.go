@@ -6,8 +6,11 @@ package server_test
 import (
 	iriv1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/machine/v1alpha1"
 	"github.com/ironcore-dev/libvirt-provider/internal/mcr"
+	"github.com/ironcore-dev/libvirt-provider/internal/server"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
 var _ = Describe("Status", func() {
@@ -34,7 +37,7 @@ var _ = Describe("Status", func() {
 						MemoryBytes: machineClasses[0].Capabilities.MemoryBytes,
 					},
 				},
-				Quantity: mcr.GetQuantity(&machineClasses[0], hostResources),
+				Quantity: mcr.GetQuantity(&machineClasses[0].MachineClass, hostResources),
 			},
 			&iriv1alpha1.MachineClassStatus{
 				MachineClass: &iriv1alpha1.MachineClass{
@@ -44,8 +47,36 @@ var _ = Describe("Status", func() {
 						MemoryBytes: machineClasses[1].Capabilities.MemoryBytes,
 					},
 				},
-				Quantity: mcr.GetQuantity(&machineClasses[1], hostResources),
+				Quantity: mcr.GetQuantity(&machineClasses[1].MachineClass, hostResources),
 			},
 		))
 	})
+
+	It("should report the provider configuration in the response header", func(ctx SpecContext) {
+		By("getting the status")
+		var header metadata.MD
+		_, err := machineClient.Status(ctx, &iriv1alpha1.StatusRequest{}, grpc.Header(&header))
+		Expect(err).NotTo(HaveOccurred())
+
+		By("validating the reported configuration")
+		Expect(header.Get(server.Qcow2TypeHeader)).To(Equal([]string{"exec"}))
+		Expect(header.Get(server.GuestAgentHeader)).To(HaveLen(1))
+		Expect(header.Get(server.VolumePluginsHeader)).To(HaveLen(1))
+		Expect(header.Get(server.NetworkPluginHeader)).To(HaveLen(1))
+		Expect(header.Get(server.VolumePluginOptionsHeader)).To(ContainElement("emptydisk:discard=false,preallocation=off"))
+		Expect(header.Get(server.NetworkPluginOptionsHeader)).To(Equal([]string{"isolated:assign-ips=false"}))
+	})
+
+	It("should report the capacity and the allocatable resources in the response header", func(ctx SpecContext) {
+		By("getting the status")
+		var header metadata.MD
+		_, err := machineClient.Status(ctx, &iriv1alpha1.StatusRequest{}, grpc.Header(&header))
+		Expect(err).NotTo(HaveOccurred())
+
+		By("validating the reported resources")
+		Expect(header.Get(server.CapacityHeader)).To(ConsistOf(MatchRegexp(`^cpu=[^,]+,memory=[^,]+$`)))
+		Expect(header.Get(server.AllocatableHeader)).To(ConsistOf(MatchRegexp(`^cpu=[^,]+,memory=[^,]+$`)))
+		Expect(header.Get(server.PoolCapacityHeader)).To(BeEmpty())
+		Expect(header.Get(server.PoolAllocatableHeader)).To(BeEmpty())
+	})
 })
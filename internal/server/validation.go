@@ -0,0 +1,223 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package server
+
+import (
+	"net/netip"
+	"regexp"
+
+	"github.com/distribution/reference"
+	iri "github.com/ironcore-dev/ironcore/iri/apis/machine/v1alpha1"
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/idempotency"
+	providernetworkinterface "github.com/ironcore-dev/libvirt-provider/internal/plugins/networkinterface"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// volumeDeviceRegex matches the device names of volumes, which are mapped to the target devices of disks
+// by replacing their first letter.
+var volumeDeviceRegex = regexp.MustCompile(`^od[a-z]+$`)
+
+// invalidArgumentError returns an InvalidArgument status error for errs with a violation per field.
+func invalidArgumentError(errs field.ErrorList) error {
+	badRequest := &errdetails.BadRequest{}
+	for _, err := range errs {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       err.Field,
+			Description: err.ErrorBody(),
+		})
+	}
+
+	st := status.New(codes.InvalidArgument, errs.ToAggregate().Error())
+	if withDetails, err := st.WithDetails(badRequest); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+func validateCreateMachineRequest(req *iri.CreateMachineRequest) field.ErrorList {
+	machinePath := field.NewPath("machine")
+	machine := req.GetMachine()
+	if machine == nil {
+		return field.ErrorList{field.Required(machinePath, "")}
+	}
+
+	var allErrs field.ErrorList
+	if machine.Metadata == nil {
+		allErrs = append(allErrs, field.Required(machinePath.Child("metadata"), ""))
+	} else {
+		annotationsPath := machinePath.Child("metadata", "annotations")
+		if key := machine.Metadata.Annotations[api.IdempotencyKeyAnnotation]; len(key) > idempotency.MaxKeyLength {
+			allErrs = append(allErrs, field.TooLong(annotationsPath.Key(api.IdempotencyKeyAnnotation), "", idempotency.MaxKeyLength))
+		}
+		_, errs := numaNodeHints(machine.Metadata.Annotations, annotationsPath)
+		allErrs = append(allErrs, errs...)
+	}
+
+	specPath := machinePath.Child("spec")
+	spec := machine.Spec
+	if spec == nil {
+		return append(allErrs, field.Required(specPath, ""))
+	}
+
+	if spec.Class == "" {
+		allErrs = append(allErrs, field.Required(specPath.Child("class"), ""))
+	}
+	if spec.Image != nil {
+		allErrs = append(allErrs, validateImageRef(spec.Image.Image, specPath.Child("image", "image"))...)
+	}
+
+	names, devices := sets.New[string](), sets.New[string]()
+	for i, volume := range spec.Volumes {
+		allErrs = append(allErrs, validateVolume(volume, names, devices, specPath.Child("volumes").Index(i))...)
+	}
+
+	nicNames := sets.New[string]()
+	for i, nic := range spec.NetworkInterfaces {
+		allErrs = append(allErrs, validateNetworkInterface(nic, nicNames, specPath.Child("networkInterfaces").Index(i))...)
+	}
+	return allErrs
+}
+
+func validateAttachVolumeRequest(req *iri.AttachVolumeRequest) field.ErrorList {
+	var allErrs field.ErrorList
+	if req.GetMachineId() == "" {
+		allErrs = append(allErrs, field.Required(field.NewPath("machineId"), ""))
+	}
+	return append(allErrs, validateVolume(req.GetVolume(), sets.New[string](), sets.New[string](), field.NewPath("volume"))...)
+}
+
+func validateAttachNetworkInterfaceRequest(req *iri.AttachNetworkInterfaceRequest) field.ErrorList {
+	var allErrs field.ErrorList
+	if req.GetMachineId() == "" {
+		allErrs = append(allErrs, field.Required(field.NewPath("machineId"), ""))
+	}
+	return append(allErrs, validateNetworkInterface(req.GetNetworkInterface(), sets.New[string](), field.NewPath("networkInterface"))...)
+}
+
+func validateImageRef(ref string, fldPath *field.Path) field.ErrorList {
+	if ref == "" {
+		return field.ErrorList{field.Required(fldPath, "")}
+	}
+	if _, err := reference.ParseNormalizedNamed(ref); err != nil {
+		return field.ErrorList{field.Invalid(fldPath, ref, err.Error())}
+	}
+	return nil
+}
+
+// validateVolume validates volume, whose name and device must not be in names and devices yet. The name and
+// device of volume are added to them.
+func validateVolume(volume *iri.Volume, names, devices sets.Set[string], fldPath *field.Path) field.ErrorList {
+	if volume == nil {
+		return field.ErrorList{field.Required(fldPath, "")}
+	}
+
+	var allErrs field.ErrorList
+	allErrs = append(allErrs, validateName(volume.Name, names, fldPath.Child("name"))...)
+
+	devicePath := fldPath.Child("device")
+	switch {
+	case volume.Device == "":
+		allErrs = append(allErrs, field.Required(devicePath, ""))
+	case !volumeDeviceRegex.MatchString(volume.Device):
+		allErrs = append(allErrs, field.Invalid(devicePath, volume.Device, "must match "+volumeDeviceRegex.String()))
+	case devices.Has(volume.Device):
+		allErrs = append(allErrs, field.Duplicate(devicePath, volume.Device))
+	default:
+		devices.Insert(volume.Device)
+	}
+
+	switch {
+	case volume.EmptyDisk == nil && volume.Connection == nil:
+		allErrs = append(allErrs, field.Required(fldPath, "either emptyDisk or connection has to be specified"))
+	case volume.EmptyDisk != nil && volume.Connection != nil:
+		allErrs = append(allErrs, field.Forbidden(fldPath, "only one of emptyDisk and connection may be specified"))
+	case volume.EmptyDisk != nil && volume.EmptyDisk.SizeBytes < 0:
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("emptyDisk", "sizeBytes"), volume.EmptyDisk.SizeBytes, "must not be negative"))
+	case volume.Connection != nil && volume.Connection.Driver == "":
+		allErrs = append(allErrs, field.Required(fldPath.Child("connection", "driver"), ""))
+	}
+	if volume.Connection != nil {
+		if _, _, err := api.BootOrder(volume.Connection.Attributes); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("connection", "attributes").Key(api.BootOrderAttribute), volume.Connection.Attributes[api.BootOrderAttribute], err.Error()))
+		}
+	}
+	return allErrs
+}
+
+// validateNetworkInterface validates nic, whose name must not be in names yet. The name of nic is added to names.
+func validateNetworkInterface(nic *iri.NetworkInterface, names sets.Set[string], fldPath *field.Path) field.ErrorList {
+	if nic == nil {
+		return field.ErrorList{field.Required(fldPath, "")}
+	}
+
+	var allErrs field.ErrorList
+	allErrs = append(allErrs, validateName(nic.Name, names, fldPath.Child("name"))...)
+	if nic.NetworkId == "" {
+		allErrs = append(allErrs, field.Required(fldPath.Child("networkId"), ""))
+	}
+	for i, ip := range nic.Ips {
+		if _, err := netip.ParseAddr(ip); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("ips").Index(i), ip, "must be an IP address"))
+		}
+	}
+	spec := &api.NetworkInterfaceSpec{Name: nic.Name, Attributes: nic.Attributes}
+	if _, err := providernetworkinterface.VLANs(spec); err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("attributes"), nic.Attributes, err.Error()))
+	}
+	if _, err := providernetworkinterface.PortSecurityEnabled(spec, false); err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("attributes"), nic.Attributes, err.Error()))
+	}
+	if _, _, err := api.BootOrder(nic.Attributes); err != nil {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("attributes").Key(api.BootOrderAttribute), nic.Attributes[api.BootOrderAttribute], err.Error()))
+	}
+	return allErrs
+}
+
+// validateName validates the name of a volume or network interface, which must not be in names yet. The name
+// is added to names.
+func validateName(name string, names sets.Set[string], fldPath *field.Path) field.ErrorList {
+	switch {
+	case name == "":
+		return field.ErrorList{field.Required(fldPath, "")}
+	case names.Has(name):
+		return field.ErrorList{field.Duplicate(fldPath, name)}
+	}
+
+	names.Insert(name)
+	var allErrs field.ErrorList
+	for _, msg := range validation.IsDNS1123Label(name) {
+		allErrs = append(allErrs, field.Invalid(fldPath, name, msg))
+	}
+	return allErrs
+}
+
+// validateAttachedVolume validates that volume doesn't clash with the volumes of machine.
+func validateAttachedVolume(machine *api.Machine, volume *iri.Volume) field.ErrorList {
+	var allErrs field.ErrorList
+	for _, attached := range machine.Spec.Volumes {
+		if attached.Name == volume.Name {
+			allErrs = append(allErrs, field.Duplicate(field.NewPath("volume", "name"), volume.Name))
+		}
+		if attached.Device == volume.Device {
+			allErrs = append(allErrs, field.Duplicate(field.NewPath("volume", "device"), volume.Device))
+		}
+	}
+	return allErrs
+}
+
+// validateAttachedNetworkInterface validates that nic doesn't clash with the network interfaces of machine.
+func validateAttachedNetworkInterface(machine *api.Machine, nic *iri.NetworkInterface) field.ErrorList {
+	for _, attached := range machine.Spec.NetworkInterfaces {
+		if attached.Name == nic.Name {
+			return field.ErrorList{field.Duplicate(field.NewPath("networkInterface", "name"), nic.Name)}
+		}
+	}
+	return nil
+}
@@ -27,6 +27,8 @@ func (s *Server) Version(ctx context.Context, req *iri.VersionRequest) (*iri.Ver
 		runtimeVersion = "0.0.0"
 	}
 
+	s.setConfigurationHeader(ctx)
+
 	return &iri.VersionResponse{
 		RuntimeName:    version.RuntimeName,
 		RuntimeVersion: runtimeVersion,
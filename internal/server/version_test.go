@@ -0,0 +1,30 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package server_test
+
+import (
+	iriv1alpha1 "github.com/ironcore-dev/ironcore/iri/apis/machine/v1alpha1"
+	"github.com/ironcore-dev/libvirt-provider/internal/server"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+var _ = Describe("Version", func() {
+	It("should report the provider configuration in the response header", func(ctx SpecContext) {
+		By("getting the version")
+		var header metadata.MD
+		resp, err := machineClient.Version(ctx, &iriv1alpha1.VersionRequest{}, grpc.Header(&header))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.RuntimeName).NotTo(BeEmpty())
+
+		By("validating the reported configuration")
+		Expect(header.Get(server.Qcow2TypeHeader)).To(Equal([]string{"exec"}))
+		Expect(header.Get(server.VolumePluginsHeader)).To(HaveLen(1))
+		Expect(header.Get(server.NetworkPluginHeader)).To(Equal([]string{"isolated"}))
+		Expect(header.Get(server.VolumePluginOptionsHeader)).To(ContainElement("emptydisk:discard=false,preallocation=off"))
+		Expect(header.Get(server.NetworkPluginOptionsHeader)).To(Equal([]string{"isolated:assign-ips=false"}))
+	})
+})
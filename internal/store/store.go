@@ -8,6 +8,8 @@ import (
 	"errors"
 
 	"github.com/ironcore-dev/libvirt-provider/api"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 var (
@@ -40,6 +42,27 @@ const (
 	WatchEventTypeCreated WatchEventType = "Created"
 	WatchEventTypeUpdated WatchEventType = "Updated"
 	WatchEventTypeDeleted WatchEventType = "Deleted"
+	// WatchEventTypeResync signals that events had to be dropped because the watcher did not keep up.
+	// It carries no object, the watcher has to list all objects to catch up.
+	WatchEventTypeResync WatchEventType = "Resync"
+)
+
+// ListOptions restricts and paginates the objects returned by Store.ListWithOptions.
+type ListOptions struct {
+	// LabelSelector selects objects by their labels. A nil selector selects everything.
+	LabelSelector labels.Selector
+	// FieldSelector selects objects by their fields. A nil selector selects everything.
+	FieldSelector fields.Selector
+
+	// Limit is the maximum number of objects to return. A limit <= 0 returns all objects.
+	Limit int64
+	// Continue is the continue token returned by a previous call to continue listing from.
+	Continue string
+}
+
+const (
+	FieldID      = "metadata.id"
+	FieldDeleted = "metadata.deleted"
 )
 
 type Store[E api.Object] interface {
@@ -48,6 +71,9 @@ type Store[E api.Object] interface {
 	Update(ctx context.Context, obj E) (E, error)
 	Delete(ctx context.Context, id string) error
 	List(ctx context.Context) ([]E, error)
+	// ListWithOptions lists the objects matching opts ordered by their id.
+	// If there are more objects than opts.Limit, a non-empty continue token is returned.
+	ListWithOptions(ctx context.Context, opts ListOptions) ([]E, string, error)
 
 	Watch(ctx context.Context) (Watch[E], error)
 }
@@ -5,6 +5,9 @@ package strategy
 
 import (
 	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/host"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 var MachineStrategy = machineStrategy{}
@@ -12,5 +15,27 @@ var MachineStrategy = machineStrategy{}
 type machineStrategy struct{}
 
 func (machineStrategy) PrepareForCreate(obj *api.Machine) {
-	obj.Status = api.MachineStatus{State: api.MachineStatePending}
+	obj.Status = api.MachineStatus{State: api.MachineStatePending, Power: api.PowerStatePowerOff}
+}
+
+// GetAttrs selects machines by their IRI and topology labels and by their desired and observed power and state in addition to the default fields.
+func (machineStrategy) GetAttrs(obj *api.Machine) (labels.Set, fields.Set, error) {
+	_, fieldSet := host.DefaultAttrs(obj)
+	fieldSet[api.MachineFieldPower] = obj.Spec.Power.String()
+	fieldSet[api.MachineFieldObservedPower] = obj.Status.Power.String()
+	fieldSet[api.MachineFieldState] = string(obj.Status.State)
+
+	iriLabels := labels.Set{}
+	if _, ok := obj.Annotations[api.LabelsAnnotation]; ok {
+		var err error
+		if iriLabels, err = api.GetLabelsAnnotation(obj.Metadata); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// Machines are reported with the topology labels of their host, hence they can be selected by them as well.
+	if len(obj.Spec.Topology) > 0 {
+		iriLabels = labels.Merge(iriLabels, obj.Spec.Topology)
+	}
+	return iriLabels, fieldSet, nil
 }
@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package tracing_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/ironcore-dev/libvirt-provider/internal/correlation"
+	"github.com/ironcore-dev/libvirt-provider/internal/tracing"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+)
+
+var _ = Describe("Setup", func() {
+	BeforeEach(func() {
+		provider := otel.GetTracerProvider()
+		DeferCleanup(otel.SetTracerProvider, provider)
+	})
+
+	It("should not record spans without endpoint", func(ctx SpecContext) {
+		shutdown, err := tracing.Setup(ctx, tracing.Options{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(shutdown(ctx)).To(Succeed())
+
+		spanCtx, span := correlation.StartSpan(ctx, "test")
+		defer span.End()
+		Expect(span.IsRecording()).To(BeFalse())
+		Expect(correlation.TraceParent(spanCtx)).To(BeEmpty())
+	})
+
+	It("should record spans with endpoint", func(ctx SpecContext) {
+		shutdown, err := tracing.Setup(ctx, tracing.Options{Endpoint: "127.0.0.1:4317", Insecure: true})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(func() {
+			// There is no collector to flush the spans to.
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			_ = shutdown(shutdownCtx)
+		})
+
+		spanCtx, span := correlation.StartSpan(ctx, "test")
+		defer span.End()
+		Expect(span.IsRecording()).To(BeTrue())
+		Expect(correlation.TraceParent(spanCtx)).NotTo(BeEmpty())
+	})
+
+	It("should reject invalid sample ratios", func(ctx SpecContext) {
+		_, err := tracing.Setup(ctx, tracing.Options{Endpoint: "127.0.0.1:4317", SampleRatio: 2})
+		Expect(err).To(HaveOccurred())
+	})
+})
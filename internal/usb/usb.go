@@ -0,0 +1,279 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package usb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// DefaultDevicesDir is the sysfs directory of the USB devices of the host.
+const DefaultDevicesDir = "/sys/bus/usb/devices"
+
+var (
+	// ErrInsufficientDevices is returned if there are not enough free devices of a resource.
+	ErrInsufficientDevices = errors.New("insufficient usb devices")
+	// ErrDeviceNotPresent is returned if a device is not plugged into the host.
+	ErrDeviceNotPresent = errors.New("usb device not present")
+)
+
+// Device is a host USB device that can be passed through to machines. It is identified either by its vendor
+// and product id or by the bus and port it is plugged into.
+type Device struct {
+	// Resource is the name machines request the device by, e.g. example.com/token.
+	Resource string `json:"resource"`
+	// Vendor is the vendor id in hex, e.g. 1050.
+	Vendor string `json:"vendor,omitempty"`
+	// Product is the product id in hex, e.g. 0407.
+	Product string `json:"product,omitempty"`
+	// Bus is the number of the bus, e.g. 1.
+	Bus uint `json:"bus,omitempty"`
+	// Port is the port chain on the bus, e.g. 2.1 for port 1 of the hub at port 2.
+	Port string `json:"port,omitempty"`
+}
+
+// ID returns the identifier of the device, vendor:product or the sysfs name bus-port.
+func (d Device) ID() string {
+	if d.Port != "" {
+		return fmt.Sprintf("%d-%s", d.Bus, d.Port)
+	}
+	return strings.ToLower(d.Vendor + ":" + d.Product)
+}
+
+func (d Device) validate() error {
+	if d.Resource == "" {
+		return fmt.Errorf("resource is required")
+	}
+	byID := d.Vendor != "" || d.Product != ""
+	byPort := d.Bus != 0 || d.Port != ""
+	switch {
+	case byID && byPort:
+		return fmt.Errorf("either vendor and product or bus and port are required, not both")
+	case byID:
+		if !isHexID(d.Vendor) || !isHexID(d.Product) {
+			return fmt.Errorf("vendor and product have to be 4 digit hex ids, got %q and %q", d.Vendor, d.Product)
+		}
+	case byPort:
+		if d.Bus == 0 || d.Port == "" {
+			return fmt.Errorf("bus and port are required")
+		}
+		for _, port := range strings.Split(d.Port, ".") {
+			if _, err := strconv.ParseUint(port, 10, 8); err != nil {
+				return fmt.Errorf("invalid port %q", d.Port)
+			}
+		}
+	default:
+		return fmt.Errorf("either vendor and product or bus and port are required")
+	}
+	return nil
+}
+
+func isHexID(id string) bool {
+	_, err := strconv.ParseUint(id, 16, 16)
+	return len(id) == 4 && err == nil
+}
+
+// Spec returns the spec of the device allocated for its resource.
+func (d Device) Spec() api.USBDeviceSpec {
+	return api.USBDeviceSpec{
+		Resource: d.Resource,
+		ID:       d.ID(),
+		Vendor:   strings.ToLower(d.Vendor),
+		Product:  strings.ToLower(d.Product),
+		Bus:      d.Bus,
+		Port:     d.Port,
+	}
+}
+
+// LoadDevices loads a list of devices, e.g.
+//
+//   - resource: example.com/token
+//     vendor: "1050"
+//     product: "0407"
+//   - resource: example.com/dongle
+//     bus: 1
+//     port: "2.1"
+func LoadDevices(reader io.Reader) ([]Device, error) {
+	var devices []Device
+	if err := yaml.NewYAMLOrJSONDecoder(reader, 4096).Decode(&devices); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("unable to unmarshal usb devices: %w", err)
+	}
+	return devices, nil
+}
+
+func LoadDevicesFile(filename string) ([]Device, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open usb devices file (%s): %w", filename, err)
+	}
+	defer func() { _ = file.Close() }()
+
+	return LoadDevices(file)
+}
+
+func validateDevices(devices []Device) error {
+	ids := sets.New[string]()
+	for _, device := range devices {
+		if err := device.validate(); err != nil {
+			return fmt.Errorf("[usb device %s] %w", device.ID(), err)
+		}
+		if ids.Has(device.ID()) {
+			return fmt.Errorf("usb device %s configured multiple times", device.ID())
+		}
+		ids.Insert(device.ID())
+	}
+	return nil
+}
+
+// Source hands out the configured host USB devices to machines. Like the pci.Source it is stateless, the
+// devices in use are determined by the machines they are allocated to. The devices can be reloaded, devices
+// removed from the configuration are kept by the machines they are allocated to until they are released.
+type Source struct {
+	dir string
+
+	mu      sync.RWMutex
+	devices []Device
+}
+
+// NewSource creates a Source of the devices plugged into the host according to dir, usually DefaultDevicesDir.
+func NewSource(dir string, devices []Device) (*Source, error) {
+	if err := validateDevices(devices); err != nil {
+		return nil, err
+	}
+	return &Source{dir: dir, devices: slices.Clone(devices)}, nil
+}
+
+// Reload replaces the configured devices.
+func (s *Source) Reload(devices []Device) error {
+	if err := validateDevices(devices); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.devices = slices.Clone(devices)
+	return nil
+}
+
+// Devices returns the configured devices.
+func (s *Source) Devices() []Device {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.devices)
+}
+
+// Allocate returns the devices of a machine requesting the given number of devices per resource. The current
+// devices of the machine are kept as far as they are still requested, further devices are allocated from the
+// devices not in use, whether they are plugged in or not. It fails with ErrInsufficientDevices if there are
+// not enough free devices.
+func (s *Source) Allocate(requests map[string]int, current []api.USBDeviceSpec, inUse sets.Set[string]) ([]api.USBDeviceSpec, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var devices []api.USBDeviceSpec
+	kept := make(map[string]int)
+	for _, device := range current {
+		if kept[device.Resource] < requests[device.Resource] {
+			devices = append(devices, device)
+			kept[device.Resource]++
+		}
+	}
+
+	taken := sets.New[string]()
+	for _, device := range devices {
+		taken.Insert(device.ID)
+	}
+
+	resources := make([]string, 0, len(requests))
+	for resource := range requests {
+		resources = append(resources, resource)
+	}
+	slices.Sort(resources)
+
+	for _, resource := range resources {
+		missing := requests[resource] - kept[resource]
+		for _, device := range s.devices {
+			if missing == 0 {
+				break
+			}
+			if device.Resource != resource || inUse.Has(device.ID()) || taken.Has(device.ID()) {
+				continue
+			}
+			devices = append(devices, device.Spec())
+			taken.Insert(device.ID())
+			missing--
+		}
+		if missing > 0 {
+			return nil, fmt.Errorf("%w: %d more devices of resource %s requested than available", ErrInsufficientDevices, missing, resource)
+		}
+	}
+	return devices, nil
+}
+
+// Address is the current address of a device plugged into the host. The device number changes whenever the
+// device is plugged in again.
+type Address struct {
+	Bus    uint
+	Device uint
+}
+
+// Resolve returns the current address of the device. It fails with ErrDeviceNotPresent if the device is not
+// plugged in.
+func (s *Source) Resolve(device api.USBDeviceSpec) (Address, error) {
+	if device.Port != "" {
+		return readAddress(filepath.Join(s.dir, device.ID))
+	}
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return Address{}, fmt.Errorf("error reading usb devices: %w", err)
+	}
+	for _, entry := range entries {
+		// Interfaces of devices are named bus-port:config.interface.
+		if strings.Contains(entry.Name(), ":") {
+			continue
+		}
+		dir := filepath.Join(s.dir, entry.Name())
+		if readAttribute(dir, "idVendor") == device.Vendor && readAttribute(dir, "idProduct") == device.Product {
+			return readAddress(dir)
+		}
+	}
+	return Address{}, fmt.Errorf("%w: %s", ErrDeviceNotPresent, device.ID)
+}
+
+func readAttribute(dir, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func readAddress(dir string) (Address, error) {
+	busValue, devValue := readAttribute(dir, "busnum"), readAttribute(dir, "devnum")
+	if busValue == "" || devValue == "" {
+		return Address{}, fmt.Errorf("%w: %s", ErrDeviceNotPresent, filepath.Base(dir))
+	}
+
+	bus, err := strconv.ParseUint(busValue, 10, 32)
+	if err != nil {
+		return Address{}, fmt.Errorf("invalid bus number %q of %s: %w", busValue, filepath.Base(dir), err)
+	}
+	dev, err := strconv.ParseUint(devValue, 10, 32)
+	if err != nil {
+		return Address{}, fmt.Errorf("invalid device number %q of %s: %w", devValue, filepath.Base(dir), err)
+	}
+	return Address{Bus: uint(bus), Device: uint(dev)}, nil
+}
@@ -0,0 +1,108 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package usb_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ironcore-dev/libvirt-provider/api"
+	"github.com/ironcore-dev/libvirt-provider/internal/usb"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+var _ = Describe("USB", func() {
+	var (
+		dir    string
+		source *usb.Source
+	)
+
+	writeDevice := func(name string, attributes map[string]string) {
+		GinkgoHelper()
+		Expect(os.MkdirAll(filepath.Join(dir, name), 0777)).To(Succeed())
+		for attribute, value := range attributes {
+			Expect(os.WriteFile(filepath.Join(dir, name, attribute), []byte(value+"\n"), 0666)).To(Succeed())
+		}
+	}
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		writeDevice("1-2", map[string]string{"idVendor": "1050", "idProduct": "0407", "busnum": "1", "devnum": "5"})
+		writeDevice("1-2:1.0", map[string]string{"bInterfaceClass": "03"})
+		writeDevice("1-3.1", map[string]string{"idVendor": "0403", "idProduct": "6001", "busnum": "1", "devnum": "9"})
+
+		devices, err := usb.LoadDevices(strings.NewReader(`
+- resource: example.com/token
+  vendor: "1050"
+  product: "0407"
+- resource: example.com/token
+  vendor: "1050"
+  product: "0406"
+- resource: example.com/serial
+  bus: 1
+  port: "3.1"
+`))
+		Expect(err).NotTo(HaveOccurred())
+		source, err = usb.NewSource(dir, devices)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should reject invalid devices", func() {
+		for _, device := range []usb.Device{
+			{Resource: "a"},
+			{Resource: "a", Vendor: "1050"},
+			{Resource: "a", Vendor: "xyz", Product: "0407"},
+			{Resource: "a", Vendor: "1050", Product: "0407", Bus: 1, Port: "2"},
+			{Resource: "a", Bus: 1, Port: "2.x"},
+			{Vendor: "1050", Product: "0407"},
+		} {
+			_, err := usb.NewSource(dir, []usb.Device{device})
+			Expect(err).To(HaveOccurred(), "device %v", device)
+		}
+	})
+
+	It("should reject devices configured multiple times", func() {
+		_, err := usb.NewSource(dir, []usb.Device{
+			{Resource: "a", Vendor: "1050", Product: "0407"},
+			{Resource: "b", Vendor: "1050", Product: "0407"},
+		})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should allocate free devices and keep the current ones", func() {
+		current := []api.USBDeviceSpec{{Resource: "example.com/token", ID: "1050:0406", Vendor: "1050", Product: "0406"}}
+		devices, err := source.Allocate(map[string]int{"example.com/token": 2, "example.com/serial": 1}, current, sets.New("1050:0406"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(devices).To(ConsistOf(
+			api.USBDeviceSpec{Resource: "example.com/token", ID: "1050:0406", Vendor: "1050", Product: "0406"},
+			api.USBDeviceSpec{Resource: "example.com/token", ID: "1050:0407", Vendor: "1050", Product: "0407"},
+			api.USBDeviceSpec{Resource: "example.com/serial", ID: "1-3.1", Bus: 1, Port: "3.1"},
+		))
+	})
+
+	It("should fail if devices are in use", func() {
+		_, err := source.Allocate(map[string]int{"example.com/serial": 1}, nil, sets.New("1-3.1"))
+		Expect(err).To(MatchError(usb.ErrInsufficientDevices))
+	})
+
+	It("should allocate reloaded devices", func() {
+		Expect(source.Reload([]usb.Device{{Resource: "example.com/serial", Bus: 2, Port: "1"}})).To(Succeed())
+		Expect(source.Allocate(map[string]int{"example.com/serial": 1}, nil, sets.New[string]())).To(ConsistOf(
+			api.USBDeviceSpec{Resource: "example.com/serial", ID: "2-1", Bus: 2, Port: "1"},
+		))
+	})
+
+	It("should resolve the current address of devices", func() {
+		Expect(source.Resolve(api.USBDeviceSpec{ID: "1050:0407", Vendor: "1050", Product: "0407"})).To(Equal(usb.Address{Bus: 1, Device: 5}))
+		Expect(source.Resolve(api.USBDeviceSpec{ID: "1-3.1", Bus: 1, Port: "3.1"})).To(Equal(usb.Address{Bus: 1, Device: 9}))
+
+		_, err := source.Resolve(api.USBDeviceSpec{ID: "1050:0406", Vendor: "1050", Product: "0406"})
+		Expect(err).To(MatchError(usb.ErrDeviceNotPresent))
+		_, err = source.Resolve(api.USBDeviceSpec{ID: "2-1", Bus: 2, Port: "1"})
+		Expect(err).To(MatchError(usb.ErrDeviceNotPresent))
+	})
+})
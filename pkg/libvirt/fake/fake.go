@@ -0,0 +1,1198 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+// Package fake provides an in-memory implementation of the libvirt API used by libvirt-provider,
+// allowing to run the machine reconciler and the IRI server without a hypervisor.
+package fake
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/digitalocean/go-libvirt"
+	"github.com/google/uuid"
+	libvirtutils "github.com/ironcore-dev/libvirt-provider/internal/libvirt/utils"
+	"libvirt.org/go/libvirtxml"
+)
+
+// DefaultCapabilities describes an x86_64 host supporting kvm and qemu domains with a q35 machine type.
+const DefaultCapabilities = `<capabilities>
+  <host>
+    <cpu>
+      <arch>x86_64</arch>
+    </cpu>
+  </host>
+  <guest>
+    <os_type>hvm</os_type>
+    <arch name='x86_64'>
+      <wordsize>64</wordsize>
+      <machine canonical='pc-q35-8.2' maxCpus='288'>q35</machine>
+      <machine maxCpus='288'>pc-q35-8.2</machine>
+      <machine canonical='pc-i440fx-8.2' maxCpus='255'>pc</machine>
+      <machine maxCpus='255'>pc-i440fx-8.2</machine>
+      <domain type='qemu'/>
+      <domain type='kvm'/>
+    </arch>
+  </guest>
+</capabilities>`
+
+// DefaultDomainCapabilities describes kvm domains of DefaultCapabilities supporting the common Hyper-V enlightenments.
+const DefaultDomainCapabilities = `<domainCapabilities>
+  <domain>kvm</domain>
+  <machine>pc-q35-8.2</machine>
+  <arch>x86_64</arch>
+  <features>
+    <hyperv supported='yes'>
+      <enum name='features'>
+        <value>relaxed</value>
+        <value>vapic</value>
+        <value>spinlocks</value>
+        <value>vpindex</value>
+        <value>runtime</value>
+        <value>synic</value>
+        <value>stimer</value>
+        <value>reset</value>
+        <value>frequencies</value>
+        <value>tlbflush</value>
+        <value>ipi</value>
+      </enum>
+    </hyperv>
+  </features>
+</domainCapabilities>`
+
+const lifecycleEventsBufferSize = 100
+
+var _ libvirtutils.Client = (*Libvirt)(nil)
+
+type domain struct {
+	id    int32
+	desc  *libvirtxml.Domain
+	state libvirt.DomainState
+	// reason is the reason of the state reported by DomainGetState, e.g. a libvirt.DomainShutoffReason.
+	reason     int32
+	persistent bool
+	autostart  bool
+	// managedSave reports whether the domain has a managed save image it is restored from when started.
+	managedSave bool
+
+	// agentResponses are the responses of the guest agent by command. The agent is connected if there are any.
+	agentResponses map[string]string
+}
+
+type secret struct {
+	desc  string
+	value []byte
+}
+
+// Libvirt is an in-memory libvirtutils.Client.
+// Shutting down or destroying a transient domain removes it, persistent domains remain shut off.
+type Libvirt struct {
+	mu sync.Mutex
+
+	connected          bool
+	capabilities       []byte
+	domainCapabilities string
+
+	nextDomainID int32
+	nextMAC      uint32
+	domains      map[libvirt.UUID]*domain
+	secrets      map[libvirt.UUID]*secret
+	// sevInfo are the SEV parameters of the host. If nil, the host doesn't support SEV.
+	sevInfo []libvirt.TypedParam
+
+	errors      map[string]error
+	listeners   map[chan libvirt.DomainEventLifecycleMsg]struct{}
+	subscribers map[chan any]libvirt.DomainEventID
+}
+
+// New creates a new connected fake Libvirt using DefaultCapabilities and DefaultDomainCapabilities.
+func New() *Libvirt {
+	return &Libvirt{
+		connected:          true,
+		capabilities:       []byte(DefaultCapabilities),
+		domainCapabilities: DefaultDomainCapabilities,
+		nextDomainID:       1,
+		domains:            make(map[libvirt.UUID]*domain),
+		secrets:            make(map[libvirt.UUID]*secret),
+		errors:             make(map[string]error),
+		listeners:          make(map[chan libvirt.DomainEventLifecycleMsg]struct{}),
+		subscribers:        make(map[chan any]libvirt.DomainEventID),
+	}
+}
+
+// SetConnected sets the value returned by IsConnected.
+func (l *Libvirt) SetConnected(connected bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.connected = connected
+}
+
+// SetCapabilities sets the capabilities XML returned by Capabilities.
+func (l *Libvirt) SetCapabilities(data []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.capabilities = data
+}
+
+// SetDomainCapabilities sets the domain capabilities XML returned by ConnectGetDomainCapabilities.
+func (l *Libvirt) SetDomainCapabilities(data string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.domainCapabilities = data
+}
+
+// SetError makes all subsequent calls of the given method (e.g. "DomainCreateXML") return err.
+// Passing a nil error removes a previously set error.
+func (l *Libvirt) SetError(method string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err == nil {
+		delete(l.errors, method)
+		return
+	}
+	l.errors[method] = err
+}
+
+// Domain returns a copy of the description and the state of the domain with the given uuid.
+func (l *Libvirt) Domain(domainUUID string) (*libvirtxml.Domain, libvirt.DomainState, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	dom, ok := l.domains[libvirtutils.UUIDStringToBytes(domainUUID)]
+	if !ok {
+		return nil, libvirt.DomainNostate, false
+	}
+
+	desc, err := copyDomain(dom.desc)
+	if err != nil {
+		return nil, libvirt.DomainNostate, false
+	}
+	return desc, dom.state, true
+}
+
+// DomainUUIDs returns the uuids of all existing domains.
+func (l *Libvirt) DomainUUIDs() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	res := make([]string, 0, len(l.domains))
+	for domainUUID := range l.domains {
+		res = append(res, uuid.UUID(domainUUID).String())
+	}
+	return res
+}
+
+// SetDomainState sets the state of an existing domain and emits the corresponding lifecycle event.
+// Setting the state to libvirt.DomainShutoff removes the domain unless it is persistent.
+func (l *Libvirt) SetDomainState(domainUUID string, state libvirt.DomainState) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	dom, ok := l.domains[libvirtutils.UUIDStringToBytes(domainUUID)]
+	if !ok {
+		return errNoDomain(domainUUID)
+	}
+
+	l.setDomainState(dom, state)
+	return nil
+}
+
+// StopDomain shuts off an existing domain with the detail of the emitted lifecycle event, e.g.
+// libvirt.DomainEventStoppedCrashed, as if the guest or its QEMU process stopped by itself.
+// It removes the domain unless it is persistent.
+func (l *Libvirt) StopDomain(domainUUID string, detail libvirt.DomainEventStoppedDetailType) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	dom, ok := l.domains[libvirtutils.UUIDStringToBytes(domainUUID)]
+	if !ok {
+		return errNoDomain(domainUUID)
+	}
+
+	l.setDomainStateDetail(dom, libvirt.DomainShutoff, int32(detail))
+	return nil
+}
+
+// SetGuestAgentResponse makes the guest agent of the domain respond to the command, e.g. "guest-ping",
+// with response. The guest agent of a domain is only connected while it is running and has responses.
+func (l *Libvirt) SetGuestAgentResponse(domainUUID string, command, response string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	dom, ok := l.domains[libvirtutils.UUIDStringToBytes(domainUUID)]
+	if !ok {
+		return errNoDomain(domainUUID)
+	}
+
+	if dom.agentResponses == nil {
+		dom.agentResponses = make(map[string]string)
+	}
+	dom.agentResponses[command] = response
+	return nil
+}
+
+// Secret returns the value of the secret with the given uuid.
+func (l *Libvirt) Secret(secretUUID string) ([]byte, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s, ok := l.secrets[libvirtutils.UUIDStringToBytes(secretUUID)]
+	if !ok {
+		return nil, false
+	}
+	return s.value, true
+}
+
+// SetSEVInfo sets the SEV parameters of the host returned by NodeGetSevInfo, e.g. its cbitpos.
+// Passing nil makes the host not support SEV.
+func (l *Libvirt) SetSEVInfo(params []libvirt.TypedParam) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sevInfo = params
+}
+
+func (l *Libvirt) IsConnected() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.connected
+}
+
+func (l *Libvirt) Capabilities() ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors["Capabilities"]; err != nil {
+		return nil, err
+	}
+	return l.capabilities, nil
+}
+
+func (l *Libvirt) ConnectGetDomainCapabilities(emulatorbin, arch, machine, virttype libvirt.OptString, flags uint32) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors["ConnectGetDomainCapabilities"]; err != nil {
+		return "", err
+	}
+	return l.domainCapabilities, nil
+}
+
+func (l *Libvirt) LifecycleEvents(ctx context.Context) (<-chan libvirt.DomainEventLifecycleMsg, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors["LifecycleEvents"]; err != nil {
+		return nil, err
+	}
+
+	ch := make(chan libvirt.DomainEventLifecycleMsg, lifecycleEventsBufferSize)
+	l.listeners[ch] = struct{}{}
+
+	go func() {
+		<-ctx.Done()
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if _, ok := l.listeners[ch]; ok {
+			delete(l.listeners, ch)
+			close(ch)
+		}
+	}()
+
+	return ch, nil
+}
+
+// SubscribeEvents subscribes to the domain events with the given id, which are sent by EmitEvent.
+// Subscriptions are not filtered by domain.
+func (l *Libvirt) SubscribeEvents(ctx context.Context, eventID libvirt.DomainEventID, _ libvirt.OptDomain) (<-chan any, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors["SubscribeEvents"]; err != nil {
+		return nil, err
+	}
+
+	ch := make(chan any, lifecycleEventsBufferSize)
+	l.subscribers[ch] = eventID
+
+	go func() {
+		<-ctx.Done()
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if _, ok := l.subscribers[ch]; ok {
+			delete(l.subscribers, ch)
+			close(ch)
+		}
+	}()
+
+	return ch, nil
+}
+
+// EmitEvent sends the domain event, e.g. a *libvirt.DomainEventCallbackWatchdogMsg, to the subscribers of eventID.
+func (l *Libvirt) EmitEvent(eventID libvirt.DomainEventID, evt any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for subscriber, subscribedID := range l.subscribers {
+		if subscribedID != eventID {
+			continue
+		}
+		select {
+		case subscriber <- evt:
+		default:
+		}
+	}
+}
+
+// Close closes all channels returned by LifecycleEvents and SubscribeEvents.
+func (l *Libvirt) Close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for ch := range l.listeners {
+		delete(l.listeners, ch)
+		close(ch)
+	}
+	for ch := range l.subscribers {
+		delete(l.subscribers, ch)
+		close(ch)
+	}
+}
+
+// ConnectListAllDomains lists all domains, ignoring the flags.
+func (l *Libvirt) ConnectListAllDomains(_ int32, _ libvirt.ConnectListAllDomainsFlags) ([]libvirt.Domain, uint32, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors["ConnectListAllDomains"]; err != nil {
+		return nil, 0, err
+	}
+
+	domains := make([]libvirt.Domain, 0, len(l.domains))
+	for _, dom := range l.domains {
+		domains = append(domains, dom.ref())
+	}
+	return domains, uint32(len(domains)), nil
+}
+
+func (l *Libvirt) DomainLookupByUUID(domainUUID libvirt.UUID) (libvirt.Domain, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors["DomainLookupByUUID"]; err != nil {
+		return libvirt.Domain{}, err
+	}
+
+	dom, ok := l.domains[domainUUID]
+	if !ok {
+		return libvirt.Domain{}, errNoDomain(uuid.UUID(domainUUID).String())
+	}
+	return dom.ref(), nil
+}
+
+// assignMAC assigns a MAC address to the interface if it has none, as libvirt does.
+func (l *Libvirt) assignMAC(iface *libvirtxml.DomainInterface) {
+	if iface.MAC != nil && iface.MAC.Address != "" {
+		return
+	}
+	l.nextMAC++
+	iface.MAC = &libvirtxml.DomainInterfaceMAC{
+		Address: fmt.Sprintf("52:54:00:%02x:%02x:%02x", byte(l.nextMAC>>16), byte(l.nextMAC>>8), byte(l.nextMAC)),
+	}
+}
+
+func (l *Libvirt) DomainCreateXML(xmlDesc string, _ libvirt.DomainCreateFlags) (libvirt.Domain, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors["DomainCreateXML"]; err != nil {
+		return libvirt.Domain{}, err
+	}
+
+	desc := &libvirtxml.Domain{}
+	if err := desc.Unmarshal(xmlDesc); err != nil {
+		return libvirt.Domain{}, libvirt.Error{Code: uint32(libvirt.ErrXMLError), Message: fmt.Sprintf("invalid domain xml: %v", err)}
+	}
+	if desc.Devices != nil {
+		for i := range desc.Devices.Interfaces {
+			l.assignMAC(&desc.Devices.Interfaces[i])
+		}
+	}
+
+	if desc.UUID == "" {
+		desc.UUID = uuid.NewString()
+	}
+	domainUUID, err := uuid.Parse(desc.UUID)
+	if err != nil {
+		return libvirt.Domain{}, libvirt.Error{Code: uint32(libvirt.ErrXMLError), Message: fmt.Sprintf("invalid domain uuid %q", desc.UUID)}
+	}
+
+	if _, ok := l.domains[libvirt.UUID(domainUUID)]; ok {
+		return libvirt.Domain{}, libvirt.Error{Code: uint32(libvirt.ErrOperationFailed), Message: fmt.Sprintf("domain %s already exists", desc.UUID)}
+	}
+
+	dom := &domain{
+		id:    l.nextDomainID,
+		desc:  desc,
+		state: libvirt.DomainNostate,
+	}
+	l.nextDomainID++
+	l.domains[libvirt.UUID(domainUUID)] = dom
+
+	l.emit(dom, libvirt.DomainEventDefined, 0)
+	l.setDomainState(dom, libvirt.DomainRunning)
+	return dom.ref(), nil
+}
+
+func (l *Libvirt) DomainCreate(dom libvirt.Domain) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors["DomainCreate"]; err != nil {
+		return err
+	}
+
+	d, ok := l.domains[dom.UUID]
+	if !ok {
+		return errNoDomain(uuid.UUID(dom.UUID).String())
+	}
+	if d.state != libvirt.DomainShutoff {
+		return libvirt.Error{Code: uint32(libvirt.ErrOperationInvalid), Message: "domain is already running"}
+	}
+
+	d.managedSave = false
+	l.setDomainState(d, libvirt.DomainRunning)
+	return nil
+}
+
+func (l *Libvirt) DomainDefineXMLFlags(xml string, _ libvirt.DomainDefineFlags) (libvirt.Domain, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors["DomainDefineXMLFlags"]; err != nil {
+		return libvirt.Domain{}, err
+	}
+
+	desc := &libvirtxml.Domain{}
+	if err := desc.Unmarshal(xml); err != nil {
+		return libvirt.Domain{}, libvirt.Error{Code: uint32(libvirt.ErrXMLError), Message: fmt.Sprintf("invalid domain xml: %v", err)}
+	}
+	if desc.Devices != nil {
+		for i := range desc.Devices.Interfaces {
+			l.assignMAC(&desc.Devices.Interfaces[i])
+		}
+	}
+
+	if desc.UUID == "" {
+		desc.UUID = uuid.NewString()
+	}
+	domainUUID, err := uuid.Parse(desc.UUID)
+	if err != nil {
+		return libvirt.Domain{}, libvirt.Error{Code: uint32(libvirt.ErrXMLError), Message: fmt.Sprintf("invalid domain uuid %q", desc.UUID)}
+	}
+
+	dom, ok := l.domains[libvirt.UUID(domainUUID)]
+	if !ok {
+		dom = &domain{
+			id:    l.nextDomainID,
+			state: libvirt.DomainShutoff,
+		}
+		l.nextDomainID++
+		l.domains[libvirt.UUID(domainUUID)] = dom
+	}
+	dom.desc = desc
+	dom.persistent = true
+
+	l.emit(dom, libvirt.DomainEventDefined, 0)
+	return dom.ref(), nil
+}
+
+func (l *Libvirt) DomainUndefineFlags(dom libvirt.Domain, flags libvirt.DomainUndefineFlagsValues) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors["DomainUndefineFlags"]; err != nil {
+		return err
+	}
+
+	d, ok := l.domains[dom.UUID]
+	if !ok {
+		return errNoDomain(uuid.UUID(dom.UUID).String())
+	}
+	if !d.persistent {
+		return libvirt.Error{Code: uint32(libvirt.ErrOperationInvalid), Message: "cannot undefine transient domain"}
+	}
+	if d.managedSave && flags&libvirt.DomainUndefineManagedSave == 0 {
+		return libvirt.Error{Code: uint32(libvirt.ErrOperationInvalid), Message: "refusing to undefine while domain managed save image exists"}
+	}
+
+	d.persistent = false
+	d.managedSave = false
+	d.autostart = false
+	l.emit(d, libvirt.DomainEventUndefined, 0)
+	if d.state == libvirt.DomainShutoff {
+		delete(l.domains, dom.UUID)
+	}
+	return nil
+}
+
+func (l *Libvirt) DomainIsPersistent(dom libvirt.Domain) (int32, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors["DomainIsPersistent"]; err != nil {
+		return 0, err
+	}
+
+	d, ok := l.domains[dom.UUID]
+	if !ok {
+		return 0, errNoDomain(uuid.UUID(dom.UUID).String())
+	}
+	return boolToInt32(d.persistent), nil
+}
+
+func (l *Libvirt) DomainGetAutostart(dom libvirt.Domain) (int32, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors["DomainGetAutostart"]; err != nil {
+		return 0, err
+	}
+
+	d, ok := l.domains[dom.UUID]
+	if !ok {
+		return 0, errNoDomain(uuid.UUID(dom.UUID).String())
+	}
+	return boolToInt32(d.autostart), nil
+}
+
+func (l *Libvirt) DomainSetAutostart(dom libvirt.Domain, autostart int32) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors["DomainSetAutostart"]; err != nil {
+		return err
+	}
+
+	d, ok := l.domains[dom.UUID]
+	if !ok {
+		return errNoDomain(uuid.UUID(dom.UUID).String())
+	}
+	if !d.persistent {
+		return libvirt.Error{Code: uint32(libvirt.ErrOperationInvalid), Message: "cannot set autostart for transient domain"}
+	}
+
+	d.autostart = autostart != 0
+	return nil
+}
+
+func (l *Libvirt) DomainGetXMLDesc(dom libvirt.Domain, _ libvirt.DomainXMLFlags) (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors["DomainGetXMLDesc"]; err != nil {
+		return "", err
+	}
+
+	d, ok := l.domains[dom.UUID]
+	if !ok {
+		return "", errNoDomain(uuid.UUID(dom.UUID).String())
+	}
+	return d.desc.Marshal()
+}
+
+func (l *Libvirt) DomainGetState(dom libvirt.Domain, _ uint32) (int32, int32, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors["DomainGetState"]; err != nil {
+		return 0, 0, err
+	}
+
+	d, ok := l.domains[dom.UUID]
+	if !ok {
+		return 0, 0, errNoDomain(uuid.UUID(dom.UUID).String())
+	}
+	return int32(d.state), d.reason, nil
+}
+
+func (l *Libvirt) DomainShutdownFlags(dom libvirt.Domain, _ libvirt.DomainShutdownFlagValues) error {
+	return l.stopDomain("DomainShutdownFlags", dom, libvirt.DomainEventStoppedShutdown)
+}
+
+func (l *Libvirt) DomainDestroyFlags(dom libvirt.Domain, _ libvirt.DomainDestroyFlagsValues) error {
+	return l.stopDomain("DomainDestroyFlags", dom, libvirt.DomainEventStoppedDestroyed)
+}
+
+func (l *Libvirt) DomainManagedSave(dom libvirt.Domain, _ uint32) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors["DomainManagedSave"]; err != nil {
+		return err
+	}
+
+	d, ok := l.domains[dom.UUID]
+	if !ok {
+		return errNoDomain(uuid.UUID(dom.UUID).String())
+	}
+	if !d.persistent {
+		return libvirt.Error{Code: uint32(libvirt.ErrOperationInvalid), Message: "cannot do managed save for transient domain"}
+	}
+	if d.state == libvirt.DomainShutoff {
+		return libvirt.Error{Code: uint32(libvirt.ErrOperationInvalid), Message: "domain is not running"}
+	}
+
+	d.managedSave = true
+	l.setDomainStateDetail(d, libvirt.DomainShutoff, int32(libvirt.DomainEventStoppedSaved))
+	return nil
+}
+
+func (l *Libvirt) DomainHasManagedSaveImage(dom libvirt.Domain, _ uint32) (int32, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors["DomainHasManagedSaveImage"]; err != nil {
+		return 0, err
+	}
+
+	d, ok := l.domains[dom.UUID]
+	if !ok {
+		return 0, errNoDomain(uuid.UUID(dom.UUID).String())
+	}
+	return boolToInt32(d.managedSave), nil
+}
+
+func (l *Libvirt) stopDomain(method string, dom libvirt.Domain, detail libvirt.DomainEventStoppedDetailType) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors[method]; err != nil {
+		return err
+	}
+
+	d, ok := l.domains[dom.UUID]
+	if !ok {
+		return errNoDomain(uuid.UUID(dom.UUID).String())
+	}
+
+	l.setDomainStateDetail(d, libvirt.DomainShutoff, int32(detail))
+	return nil
+}
+
+func (l *Libvirt) DomainAttachDevice(dom libvirt.Domain, xml string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors["DomainAttachDevice"]; err != nil {
+		return err
+	}
+
+	d, ok := l.domains[dom.UUID]
+	if !ok {
+		return errNoDomain(uuid.UUID(dom.UUID).String())
+	}
+
+	if d.desc.Devices == nil {
+		d.desc.Devices = &libvirtxml.DomainDeviceList{}
+	}
+
+	switch {
+	case strings.HasPrefix(strings.TrimSpace(xml), "<disk"):
+		disk := libvirtxml.DomainDisk{}
+		if err := disk.Unmarshal(xml); err != nil {
+			return libvirt.Error{Code: uint32(libvirt.ErrXMLError), Message: fmt.Sprintf("invalid disk xml: %v", err)}
+		}
+		d.desc.Devices.Disks = append(d.desc.Devices.Disks, disk)
+	case strings.HasPrefix(strings.TrimSpace(xml), "<interface"):
+		iface := libvirtxml.DomainInterface{}
+		if err := iface.Unmarshal(xml); err != nil {
+			return libvirt.Error{Code: uint32(libvirt.ErrXMLError), Message: fmt.Sprintf("invalid interface xml: %v", err)}
+		}
+		l.assignMAC(&iface)
+		d.desc.Devices.Interfaces = append(d.desc.Devices.Interfaces, iface)
+	case strings.HasPrefix(strings.TrimSpace(xml), "<hostdev"):
+		hostdev := libvirtxml.DomainHostdev{}
+		if err := hostdev.Unmarshal(xml); err != nil {
+			return libvirt.Error{Code: uint32(libvirt.ErrXMLError), Message: fmt.Sprintf("invalid hostdev xml: %v", err)}
+		}
+		d.desc.Devices.Hostdevs = append(d.desc.Devices.Hostdevs, hostdev)
+	case strings.HasPrefix(strings.TrimSpace(xml), "<controller"):
+		controller := libvirtxml.DomainController{}
+		if err := controller.Unmarshal(xml); err != nil {
+			return libvirt.Error{Code: uint32(libvirt.ErrXMLError), Message: fmt.Sprintf("invalid controller xml: %v", err)}
+		}
+		d.desc.Devices.Controllers = append(d.desc.Devices.Controllers, controller)
+	case strings.HasPrefix(strings.TrimSpace(xml), "<memory"):
+		memorydev := libvirtxml.DomainMemorydev{}
+		if err := memorydev.Unmarshal(xml); err != nil {
+			return libvirt.Error{Code: uint32(libvirt.ErrXMLError), Message: fmt.Sprintf("invalid memory xml: %v", err)}
+		}
+		if d.desc.MaximumMemory == nil || uint(len(d.desc.Devices.Memorydevs)) >= d.desc.MaximumMemory.Slots {
+			return libvirt.Error{Code: uint32(libvirt.ErrOperationInvalid), Message: "no free memory device slot available"}
+		}
+		d.desc.Devices.Memorydevs = append(d.desc.Devices.Memorydevs, memorydev)
+		if d.desc.Memory != nil && memorydev.Target != nil && memorydev.Target.Size != nil {
+			d.desc.Memory.Value += memorydev.Target.Size.Value
+		}
+	default:
+		return libvirt.Error{Code: uint32(libvirt.ErrOperationUnsupported), Message: "unsupported device type"}
+	}
+
+	return nil
+}
+
+func (l *Libvirt) DomainDetachDevice(dom libvirt.Domain, xml string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors["DomainDetachDevice"]; err != nil {
+		return err
+	}
+
+	d, ok := l.domains[dom.UUID]
+	if !ok {
+		return errNoDomain(uuid.UUID(dom.UUID).String())
+	}
+
+	if d.desc.Devices == nil {
+		return errDeviceNotFound()
+	}
+
+	switch {
+	case strings.HasPrefix(strings.TrimSpace(xml), "<disk"):
+		disk := libvirtxml.DomainDisk{}
+		if err := disk.Unmarshal(xml); err != nil {
+			return libvirt.Error{Code: uint32(libvirt.ErrXMLError), Message: fmt.Sprintf("invalid disk xml: %v", err)}
+		}
+		for i, existing := range d.desc.Devices.Disks {
+			if existing.Target != nil && disk.Target != nil && existing.Target.Dev == disk.Target.Dev {
+				d.desc.Devices.Disks = append(d.desc.Devices.Disks[:i], d.desc.Devices.Disks[i+1:]...)
+				return nil
+			}
+		}
+	case strings.HasPrefix(strings.TrimSpace(xml), "<interface"):
+		iface := libvirtxml.DomainInterface{}
+		if err := iface.Unmarshal(xml); err != nil {
+			return libvirt.Error{Code: uint32(libvirt.ErrXMLError), Message: fmt.Sprintf("invalid interface xml: %v", err)}
+		}
+		for i, existing := range d.desc.Devices.Interfaces {
+			if sameInterface(&existing, &iface) {
+				d.desc.Devices.Interfaces = append(d.desc.Devices.Interfaces[:i], d.desc.Devices.Interfaces[i+1:]...)
+				return nil
+			}
+		}
+	case strings.HasPrefix(strings.TrimSpace(xml), "<hostdev"):
+		hostdev := libvirtxml.DomainHostdev{}
+		if err := hostdev.Unmarshal(xml); err != nil {
+			return libvirt.Error{Code: uint32(libvirt.ErrXMLError), Message: fmt.Sprintf("invalid hostdev xml: %v", err)}
+		}
+		for i, existing := range d.desc.Devices.Hostdevs {
+			if existing.Alias != nil && hostdev.Alias != nil && existing.Alias.Name == hostdev.Alias.Name {
+				d.desc.Devices.Hostdevs = append(d.desc.Devices.Hostdevs[:i], d.desc.Devices.Hostdevs[i+1:]...)
+				return nil
+			}
+		}
+	}
+
+	return errDeviceNotFound()
+}
+
+func (l *Libvirt) DomainBlockResize(dom libvirt.Domain, disk string, _ uint64, _ libvirt.DomainBlockResizeFlags) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors["DomainBlockResize"]; err != nil {
+		return err
+	}
+
+	d, ok := l.domains[dom.UUID]
+	if !ok {
+		return errNoDomain(uuid.UUID(dom.UUID).String())
+	}
+
+	if d.desc.Devices != nil {
+		for _, existing := range d.desc.Devices.Disks {
+			if existing.Target != nil && existing.Target.Dev == disk {
+				return nil
+			}
+		}
+	}
+	return libvirt.Error{Code: uint32(libvirt.ErrInvalidArg), Message: fmt.Sprintf("disk %s not found", disk)}
+}
+
+// DomainSetVcpusFlags sets the current vCPUs of the domain, which must not exceed its maximum vCPUs.
+func (l *Libvirt) DomainSetVcpusFlags(dom libvirt.Domain, nvcpus uint32, _ uint32) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors["DomainSetVcpusFlags"]; err != nil {
+		return err
+	}
+
+	d, ok := l.domains[dom.UUID]
+	if !ok {
+		return errNoDomain(uuid.UUID(dom.UUID).String())
+	}
+	if d.desc.VCPU == nil || uint(nvcpus) > d.desc.VCPU.Value {
+		return libvirt.Error{Code: uint32(libvirt.ErrInvalidArg), Message: fmt.Sprintf("requested vcpus is greater than max allowable vcpus for the live domain: %d", nvcpus)}
+	}
+	d.desc.VCPU.Current = uint(nvcpus)
+	return nil
+}
+
+// DomainSetSchedulerParametersFlags supports the global_quota parameter only.
+func (l *Libvirt) DomainSetSchedulerParametersFlags(dom libvirt.Domain, params []libvirt.TypedParam, _ uint32) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors["DomainSetSchedulerParametersFlags"]; err != nil {
+		return err
+	}
+
+	d, ok := l.domains[dom.UUID]
+	if !ok {
+		return errNoDomain(uuid.UUID(dom.UUID).String())
+	}
+	for _, param := range params {
+		quota, ok := param.Value.I.(int64)
+		if param.Field != libvirt.DomainSchedulerGlobalQuota || !ok {
+			return libvirt.Error{Code: uint32(libvirt.ErrInvalidArg), Message: fmt.Sprintf("unsupported scheduler parameter %s", param.Field)}
+		}
+		if d.desc.CPUTune == nil {
+			d.desc.CPUTune = &libvirtxml.DomainCPUTune{}
+		}
+		d.desc.CPUTune.GlobalQuota = &libvirtxml.DomainCPUTuneQuota{Value: quota}
+	}
+	return nil
+}
+
+// DomainSetMetadata supports element metadata only. It replaces the metadata of the uri, keeping the metadata of
+// other namespaces.
+func (l *Libvirt) DomainSetMetadata(dom libvirt.Domain, typ int32, metadata, _, uri libvirt.OptString, _ libvirt.DomainModificationImpact) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors["DomainSetMetadata"]; err != nil {
+		return err
+	}
+
+	d, ok := l.domains[dom.UUID]
+	if !ok {
+		return errNoDomain(uuid.UUID(dom.UUID).String())
+	}
+	if libvirt.DomainMetadataType(typ) != libvirt.DomainMetadataElement || len(uri) == 0 {
+		return libvirt.Error{Code: uint32(libvirt.ErrInvalidArg), Message: fmt.Sprintf("unsupported metadata type %d", typ)}
+	}
+
+	var existing string
+	if d.desc.Metadata != nil {
+		existing = d.desc.Metadata.XML
+	}
+	data, err := removeMetadataElements(existing, uri[0])
+	if err != nil {
+		return err
+	}
+	if len(metadata) > 0 {
+		data += metadata[0]
+	}
+
+	d.desc.Metadata = nil
+	if data != "" {
+		d.desc.Metadata = &libvirtxml.DomainMetadata{XML: data}
+	}
+	return nil
+}
+
+// removeMetadataElements removes the top level elements of the namespace from the metadata.
+func removeMetadataElements(data, namespace string) (string, error) {
+	var (
+		d      = xml.NewDecoder(strings.NewReader(data))
+		result strings.Builder
+	)
+	for {
+		offset := d.InputOffset()
+		token, err := d.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return result.String(), nil
+			}
+			return "", fmt.Errorf("error parsing domain metadata: %w", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if err := d.Skip(); err != nil {
+			return "", fmt.Errorf("error parsing domain metadata: %w", err)
+		}
+		if start.Name.Space != namespace {
+			result.WriteString(data[offset:d.InputOffset()])
+		}
+	}
+}
+
+func (l *Libvirt) QEMUDomainAgentCommand(dom libvirt.Domain, cmd string, _ int32, _ uint32) (libvirt.OptString, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors["QEMUDomainAgentCommand"]; err != nil {
+		return nil, err
+	}
+
+	d, ok := l.domains[dom.UUID]
+	if !ok {
+		return nil, errNoDomain(uuid.UUID(dom.UUID).String())
+	}
+	if d.state != libvirt.DomainRunning || len(d.agentResponses) == 0 {
+		return nil, errAgentUnresponsive()
+	}
+
+	command := &struct {
+		Execute string `json:"execute"`
+	}{}
+	if err := json.Unmarshal([]byte(cmd), command); err != nil {
+		return nil, libvirt.Error{Code: uint32(libvirt.ErrInvalidArg), Message: fmt.Sprintf("invalid agent command: %v", err)}
+	}
+
+	response, ok := d.agentResponses[command.Execute]
+	if !ok {
+		return nil, libvirt.Error{Code: uint32(libvirt.ErrInternalError), Message: fmt.Sprintf("The command %s has not been found", command.Execute)}
+	}
+	return libvirt.OptString{response}, nil
+}
+
+func (l *Libvirt) NodeGetSevInfo(_ int32, _ uint32) ([]libvirt.TypedParam, int32, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors["NodeGetSevInfo"]; err != nil {
+		return nil, 0, err
+	}
+	if l.sevInfo == nil {
+		return nil, 0, libvirt.Error{Code: uint32(libvirt.ErrOperationUnsupported), Message: "Operation not supported: QEMU does not support SEV guest"}
+	}
+	return l.sevInfo, int32(len(l.sevInfo)), nil
+}
+
+// DomainGetLaunchSecurityInfo returns a launch measurement derived from the domain uuid for domains with SEV
+// launch security and no parameters for other domains, like libvirt.
+func (l *Libvirt) DomainGetLaunchSecurityInfo(dom libvirt.Domain, _ uint32) ([]libvirt.TypedParam, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors["DomainGetLaunchSecurityInfo"]; err != nil {
+		return nil, err
+	}
+
+	d, ok := l.domains[dom.UUID]
+	if !ok {
+		return nil, errNoDomain(uuid.UUID(dom.UUID).String())
+	}
+	if d.desc.LaunchSecurity == nil || d.desc.LaunchSecurity.SEV == nil {
+		return nil, nil
+	}
+
+	measurement := sha256.Sum256(dom.UUID[:])
+	params := []libvirt.TypedParam{
+		{Field: "sev-measurement", Value: *libvirt.NewTypedParamValueString(base64.StdEncoding.EncodeToString(measurement[:]))},
+		{Field: "sev-api-major", Value: *libvirt.NewTypedParamValueUint(0)},
+		{Field: "sev-api-minor", Value: *libvirt.NewTypedParamValueUint(24)},
+		{Field: "sev-build-id", Value: *libvirt.NewTypedParamValueUint(15)},
+	}
+	if policy := d.desc.LaunchSecurity.SEV.Policy; policy != nil {
+		params = append(params, libvirt.TypedParam{Field: "sev-policy", Value: *libvirt.NewTypedParamValueUint(uint32(*policy))})
+	}
+	return params, nil
+}
+
+func (l *Libvirt) SecretLookupByUUID(secretUUID libvirt.UUID) (libvirt.Secret, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors["SecretLookupByUUID"]; err != nil {
+		return libvirt.Secret{}, err
+	}
+
+	if _, ok := l.secrets[secretUUID]; !ok {
+		return libvirt.Secret{}, errNoSecret(uuid.UUID(secretUUID).String())
+	}
+	return libvirt.Secret{UUID: secretUUID}, nil
+}
+
+func (l *Libvirt) SecretDefineXML(xml string, _ uint32) (libvirt.Secret, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors["SecretDefineXML"]; err != nil {
+		return libvirt.Secret{}, err
+	}
+
+	desc := &libvirtxml.Secret{}
+	if err := desc.Unmarshal(xml); err != nil {
+		return libvirt.Secret{}, libvirt.Error{Code: uint32(libvirt.ErrXMLError), Message: fmt.Sprintf("invalid secret xml: %v", err)}
+	}
+
+	secretUUID := libvirtutils.UUIDStringToBytes(desc.UUID)
+	if _, ok := l.secrets[secretUUID]; !ok {
+		l.secrets[secretUUID] = &secret{}
+	}
+	l.secrets[secretUUID].desc = xml
+	return libvirt.Secret{UUID: secretUUID}, nil
+}
+
+func (l *Libvirt) SecretSetValue(s libvirt.Secret, value []byte, _ uint32) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors["SecretSetValue"]; err != nil {
+		return err
+	}
+
+	existing, ok := l.secrets[s.UUID]
+	if !ok {
+		return errNoSecret(uuid.UUID(s.UUID).String())
+	}
+	existing.value = value
+	return nil
+}
+
+func (l *Libvirt) SecretUndefine(s libvirt.Secret) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := l.errors["SecretUndefine"]; err != nil {
+		return err
+	}
+
+	if _, ok := l.secrets[s.UUID]; !ok {
+		return errNoSecret(uuid.UUID(s.UUID).String())
+	}
+	delete(l.secrets, s.UUID)
+	return nil
+}
+
+func (l *Libvirt) setDomainState(d *domain, state libvirt.DomainState) {
+	l.setDomainStateDetail(d, state, 0)
+}
+
+// setDomainStateDetail sets the state of the domain and emits the lifecycle event with the given detail, e.g. a
+// libvirt.DomainEventStoppedDetailType when stopping the domain.
+func (l *Libvirt) setDomainStateDetail(d *domain, state libvirt.DomainState, detail int32) {
+	d.state = state
+	d.reason = 0
+	if state == libvirt.DomainShutoff {
+		d.reason = int32(shutoffReasons[libvirt.DomainEventStoppedDetailType(detail)])
+	}
+
+	switch state {
+	case libvirt.DomainRunning:
+		l.emit(d, libvirt.DomainEventStarted, detail)
+	case libvirt.DomainPaused:
+		l.emit(d, libvirt.DomainEventSuspended, detail)
+	case libvirt.DomainShutoff:
+		l.emit(d, libvirt.DomainEventStopped, detail)
+		// transient domains vanish once stopped
+		if !d.persistent {
+			delete(l.domains, libvirtutils.UUIDStringToBytes(d.desc.UUID))
+		}
+	}
+}
+
+// shutoffReasons are the reasons of the shut off state of domains by the detail of their stopped event.
+var shutoffReasons = map[libvirt.DomainEventStoppedDetailType]libvirt.DomainShutoffReason{
+	libvirt.DomainEventStoppedShutdown:     libvirt.DomainShutoffShutdown,
+	libvirt.DomainEventStoppedDestroyed:    libvirt.DomainShutoffDestroyed,
+	libvirt.DomainEventStoppedCrashed:      libvirt.DomainShutoffCrashed,
+	libvirt.DomainEventStoppedMigrated:     libvirt.DomainShutoffMigrated,
+	libvirt.DomainEventStoppedSaved:        libvirt.DomainShutoffSaved,
+	libvirt.DomainEventStoppedFailed:       libvirt.DomainShutoffFailed,
+	libvirt.DomainEventStoppedFromSnapshot: libvirt.DomainShutoffFromSnapshot,
+}
+
+func (l *Libvirt) emit(d *domain, evt libvirt.DomainEventType, detail int32) {
+	msg := libvirt.DomainEventLifecycleMsg{
+		Dom:    d.ref(),
+		Event:  int32(evt),
+		Detail: detail,
+	}
+
+	for listener := range l.listeners {
+		select {
+		case listener <- msg:
+		default:
+		}
+	}
+}
+
+func (d *domain) ref() libvirt.Domain {
+	return libvirt.Domain{
+		Name: d.desc.Name,
+		UUID: libvirtutils.UUIDStringToBytes(d.desc.UUID),
+		ID:   d.id,
+	}
+}
+
+func boolToInt32(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func copyDomain(desc *libvirtxml.Domain) (*libvirtxml.Domain, error) {
+	data, err := desc.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &libvirtxml.Domain{}
+	if err := res.Unmarshal(data); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func sameInterface(a, b *libvirtxml.DomainInterface) bool {
+	if a.Alias != nil && b.Alias != nil {
+		return a.Alias.Name == b.Alias.Name
+	}
+	if a.MAC != nil && b.MAC != nil {
+		return a.MAC.Address == b.MAC.Address
+	}
+	return false
+}
+
+func errNoDomain(domainUUID string) error {
+	return libvirt.Error{Code: uint32(libvirt.ErrNoDomain), Message: fmt.Sprintf("Domain not found: no domain with matching uuid '%s'", domainUUID)}
+}
+
+func errAgentUnresponsive() error {
+	return libvirt.Error{Code: uint32(libvirt.ErrAgentUnresponsive), Message: "Guest agent is not responding: QEMU guest agent is not connected"}
+}
+
+func errNoSecret(secretUUID string) error {
+	return libvirt.Error{Code: uint32(libvirt.ErrNoSecret), Message: fmt.Sprintf("Secret not found: no secret with matching uuid '%s'", secretUUID)}
+}
+
+func errDeviceNotFound() error {
+	return libvirt.Error{Code: uint32(libvirt.ErrOperationFailed), Message: "operation failed: matching device was not found"}
+}
@@ -0,0 +1,248 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package fake_test
+
+import (
+	"github.com/digitalocean/go-libvirt"
+	"github.com/google/uuid"
+	libvirtutils "github.com/ironcore-dev/libvirt-provider/internal/libvirt/utils"
+	"github.com/ironcore-dev/libvirt-provider/pkg/libvirt/fake"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"libvirt.org/go/libvirtxml"
+)
+
+var _ = Describe("Libvirt", func() {
+	var lv *fake.Libvirt
+
+	BeforeEach(func() {
+		lv = fake.SetupLibvirt()
+	})
+
+	It("should run through the domain lifecycle", func(ctx SpecContext) {
+		events, err := lv.LifecycleEvents(ctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		id := uuid.NewString()
+
+		By("creating a domain")
+		desc := &libvirtxml.Domain{Name: id, UUID: id, Type: "kvm"}
+		data, err := desc.Marshal()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = lv.DomainCreateXML(data, libvirt.DomainNone)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(id).To(fake.HaveDomainState(lv, libvirt.DomainRunning))
+		Eventually(events).Should(Receive(HaveField("Event", int32(libvirt.DomainEventStarted))))
+
+		By("listing the domain")
+		domains, _, err := lv.ConnectListAllDomains(1, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(domains).To(ConsistOf(HaveField("Name", id)))
+
+		By("attaching and detaching a disk")
+		disk := &libvirtxml.DomainDisk{Target: &libvirtxml.DomainDiskTarget{Dev: "vdb", Bus: "virtio"}}
+		diskData, err := disk.Marshal()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lv.DomainAttachDevice(libvirt.Domain{UUID: libvirtutils.UUIDStringToBytes(id)}, diskData)).To(Succeed())
+		actual, _, ok := lv.Domain(id)
+		Expect(ok).To(BeTrue())
+		Expect(actual.Devices.Disks).To(ConsistOf(HaveField("Target.Dev", "vdb")))
+		Expect(lv.DomainDetachDevice(libvirt.Domain{UUID: libvirtutils.UUIDStringToBytes(id)}, diskData)).To(Succeed())
+		actual, _, _ = lv.Domain(id)
+		Expect(actual.Devices.Disks).To(BeEmpty())
+
+		By("shutting the domain down")
+		Expect(lv.DomainShutdownFlags(libvirt.Domain{UUID: libvirtutils.UUIDStringToBytes(id)}, libvirt.DomainShutdownAcpiPowerBtn)).To(Succeed())
+		Expect(id).NotTo(fake.HaveDomain(lv))
+		Eventually(events).Should(Receive(HaveField("Event", int32(libvirt.DomainEventStopped))))
+
+		By("looking up the removed domain")
+		_, err = lv.DomainLookupByUUID(libvirtutils.UUIDStringToBytes(id))
+		Expect(libvirt.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should keep persistent domains when they are stopped", func() {
+		id := uuid.NewString()
+		dom := libvirt.Domain{UUID: libvirtutils.UUIDStringToBytes(id)}
+
+		By("creating a transient domain")
+		desc := &libvirtxml.Domain{Name: id, UUID: id, Type: "kvm"}
+		data, err := desc.Marshal()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = lv.DomainCreateXML(data, libvirt.DomainNone)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lv.DomainSetAutostart(dom, 1)).NotTo(Succeed())
+
+		By("defining the domain and enabling autostart")
+		_, err = lv.DomainDefineXMLFlags(data, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lv.DomainIsPersistent(dom)).To(Equal(int32(1)))
+		Expect(lv.DomainSetAutostart(dom, 1)).To(Succeed())
+		Expect(lv.DomainGetAutostart(dom)).To(Equal(int32(1)))
+
+		By("destroying the domain")
+		Expect(lv.DomainDestroyFlags(dom, libvirt.DomainDestroyGraceful)).To(Succeed())
+		Expect(id).To(fake.HaveDomainState(lv, libvirt.DomainShutoff))
+
+		By("undefining the domain")
+		Expect(lv.DomainUndefineFlags(dom, libvirt.DomainUndefineNvram)).To(Succeed())
+		Expect(id).NotTo(fake.HaveDomain(lv))
+	})
+
+	It("should report why persistent domains were shut off", func() {
+		id := uuid.NewString()
+		dom := libvirt.Domain{UUID: libvirtutils.UUIDStringToBytes(id)}
+
+		desc := &libvirtxml.Domain{Name: id, UUID: id, Type: "kvm"}
+		data, err := desc.Marshal()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = lv.DomainDefineXMLFlags(data, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lv.DomainCreate(dom)).To(Succeed())
+
+		By("crashing the guest")
+		Expect(lv.StopDomain(id, libvirt.DomainEventStoppedCrashed)).To(Succeed())
+		state, reason, err := lv.DomainGetState(dom, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(libvirt.DomainState(state)).To(Equal(libvirt.DomainShutoff))
+		Expect(libvirt.DomainShutoffReason(reason)).To(Equal(libvirt.DomainShutoffCrashed))
+
+		By("starting the domain again")
+		Expect(lv.DomainCreate(dom)).To(Succeed())
+		_, reason, err = lv.DomainGetState(dom, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reason).To(BeZero())
+	})
+
+	It("should restore domains from their managed save image", func() {
+		id := uuid.NewString()
+		dom := libvirt.Domain{UUID: libvirtutils.UUIDStringToBytes(id)}
+
+		By("creating a transient domain")
+		desc := &libvirtxml.Domain{Name: id, UUID: id, Type: "kvm"}
+		data, err := desc.Marshal()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = lv.DomainCreateXML(data, libvirt.DomainNone)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lv.DomainManagedSave(dom, 0)).NotTo(Succeed())
+
+		By("saving the persistent domain")
+		_, err = lv.DomainDefineXMLFlags(data, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lv.DomainManagedSave(dom, 0)).To(Succeed())
+		Expect(id).To(fake.HaveDomainState(lv, libvirt.DomainShutoff))
+		Expect(lv.DomainHasManagedSaveImage(dom, 0)).To(Equal(int32(1)))
+		Expect(lv.DomainUndefineFlags(dom, libvirt.DomainUndefineNvram)).NotTo(Succeed())
+
+		By("restoring the domain")
+		Expect(lv.DomainCreate(dom)).To(Succeed())
+		Expect(id).To(fake.HaveDomainState(lv, libvirt.DomainRunning))
+		Expect(lv.DomainHasManagedSaveImage(dom, 0)).To(Equal(int32(0)))
+	})
+
+	It("should respond to guest agent commands of running domains", func() {
+		id := uuid.NewString()
+		dom := libvirt.Domain{UUID: libvirtutils.UUIDStringToBytes(id)}
+
+		By("creating a domain")
+		desc := &libvirtxml.Domain{Name: id, UUID: id, Type: "kvm"}
+		data, err := desc.Marshal()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = lv.DomainCreateXML(data, libvirt.DomainNone)
+		Expect(err).NotTo(HaveOccurred())
+
+		By("pinging the disconnected guest agent")
+		_, err = lv.QEMUDomainAgentCommand(dom, `{"execute":"guest-ping"}`, 5, 0)
+		Expect(err).To(MatchError(ContainSubstring("not connected")))
+
+		By("pinging the connected guest agent")
+		Expect(lv.SetGuestAgentResponse(id, "guest-ping", `{"return":{}}`)).To(Succeed())
+		Expect(lv.QEMUDomainAgentCommand(dom, `{"execute":"guest-ping"}`, 5, 0)).To(Equal(libvirt.OptString{`{"return":{}}`}))
+
+		By("executing an unknown command")
+		_, err = lv.QEMUDomainAgentCommand(dom, `{"execute":"guest-info"}`, 5, 0)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should send domain events to their subscribers", func(ctx SpecContext) {
+		watchdogEvents, err := lv.SubscribeEvents(ctx, libvirt.DomainEventIDWatchdog, nil)
+		Expect(err).NotTo(HaveOccurred())
+		rebootEvents, err := lv.SubscribeEvents(ctx, libvirt.DomainEventIDReboot, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		evt := &libvirt.DomainEventCallbackWatchdogMsg{Msg: libvirt.DomainEventWatchdogMsg{Action: int32(libvirt.DomainEventWatchdogReset)}}
+		lv.EmitEvent(libvirt.DomainEventIDWatchdog, evt)
+		Eventually(watchdogEvents).Should(Receive(Equal(evt)))
+		Consistently(rebootEvents).ShouldNot(Receive())
+	})
+
+	It("should hot plug vcpus and memory up to the maximum of the domain", func() {
+		id := uuid.NewString()
+		dom := libvirt.Domain{UUID: libvirtutils.UUIDStringToBytes(id)}
+
+		By("creating a domain with hotplug headroom")
+		desc := &libvirtxml.Domain{
+			Name:          id,
+			UUID:          id,
+			Type:          "kvm",
+			VCPU:          &libvirtxml.DomainVCPU{Current: 2, Value: 4},
+			Memory:        &libvirtxml.DomainMemory{Value: 1 << 30, Unit: "Byte"},
+			MaximumMemory: &libvirtxml.DomainMaxMemory{Value: 4 << 30, Unit: "Byte", Slots: 1},
+		}
+		data, err := desc.Marshal()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = lv.DomainCreateXML(data, libvirt.DomainNone)
+		Expect(err).NotTo(HaveOccurred())
+
+		By("setting the vcpus")
+		Expect(lv.DomainSetVcpusFlags(dom, 4, uint32(libvirt.DomainVCPULive))).To(Succeed())
+		Expect(lv.DomainSetVcpusFlags(dom, 8, uint32(libvirt.DomainVCPULive))).NotTo(Succeed())
+
+		By("hot plugging memory")
+		dimm := &libvirtxml.DomainMemorydev{
+			Model:  "dimm",
+			Target: &libvirtxml.DomainMemorydevTarget{Size: &libvirtxml.DomainMemorydevTargetSize{Value: 1 << 30, Unit: "Byte"}},
+		}
+		dimmData, err := dimm.Marshal()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(lv.DomainAttachDevice(dom, dimmData)).To(Succeed())
+		Expect(lv.DomainAttachDevice(dom, dimmData)).To(MatchError(ContainSubstring("no free memory device slot")))
+
+		actual, _, ok := lv.Domain(id)
+		Expect(ok).To(BeTrue())
+		Expect(actual.VCPU.Current).To(Equal(uint(4)))
+		Expect(actual.Memory.Value).To(Equal(uint(2 << 30)))
+		Expect(actual.Devices.Memorydevs).To(HaveLen(1))
+	})
+
+	It("should replace the metadata of a namespace, keeping the metadata of other namespaces", func() {
+		id := uuid.NewString()
+		dom := libvirt.Domain{UUID: libvirtutils.UUIDStringToBytes(id)}
+		const (
+			namespace = "https://example.org/foo"
+			other     = `<bar:bar xmlns:bar="https://example.org/bar"><bar:baz/></bar:bar>`
+		)
+
+		By("creating a domain with metadata of another namespace")
+		desc := &libvirtxml.Domain{Name: id, UUID: id, Type: "kvm", Metadata: &libvirtxml.DomainMetadata{XML: other}}
+		data, err := desc.Marshal()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = lv.DomainCreateXML(data, libvirt.DomainNone)
+		Expect(err).NotTo(HaveOccurred())
+
+		By("setting the metadata of the namespace")
+		first := `<foo:foo xmlns:foo="https://example.org/foo">first</foo:foo>`
+		Expect(lv.DomainSetMetadata(dom, int32(libvirt.DomainMetadataElement), libvirt.OptString{first}, libvirt.OptString{"foo"}, libvirt.OptString{namespace}, libvirt.DomainAffectLive)).To(Succeed())
+
+		By("replacing the metadata of the namespace")
+		second := `<foo:foo xmlns:foo="https://example.org/foo">second</foo:foo>`
+		Expect(lv.DomainSetMetadata(dom, int32(libvirt.DomainMetadataElement), libvirt.OptString{second}, libvirt.OptString{"foo"}, libvirt.OptString{namespace}, libvirt.DomainAffectLive)).To(Succeed())
+
+		actual, _, ok := lv.Domain(id)
+		Expect(ok).To(BeTrue())
+		Expect(actual.Metadata.XML).To(ContainSubstring(other))
+		Expect(actual.Metadata.XML).To(ContainSubstring("second"))
+		Expect(actual.Metadata.XML).NotTo(ContainSubstring("first"))
+	})
+})
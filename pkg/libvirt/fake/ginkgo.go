@@ -0,0 +1,37 @@
+// SPDX-FileCopyrightText: 2023 SAP SE or an SAP affiliate company and IronCore contributors
+// SPDX-License-Identifier: Apache-2.0
+
+package fake
+
+import (
+	"github.com/digitalocean/go-libvirt"
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega/gcustom"
+	"github.com/onsi/gomega/types"
+)
+
+// SetupLibvirt creates a fake Libvirt for the current spec and closes its lifecycle event channels once the spec is done.
+func SetupLibvirt() *Libvirt {
+	l := New()
+	ginkgo.DeferCleanup(l.Close)
+	return l
+}
+
+// HaveDomain succeeds if l has a domain with the uuid passed as actual value.
+func HaveDomain(l *Libvirt) types.GomegaMatcher {
+	return gcustom.MakeMatcher(func(domainUUID string) (bool, error) {
+		_, _, ok := l.Domain(domainUUID)
+		return ok, nil
+	}).WithTemplate("Expected domain {{.Actual}} {{.To}} exist")
+}
+
+// HaveDomainState succeeds if l has a domain with the uuid passed as actual value that is in the given state.
+// As the matcher reads the current state on every invocation, it can be used with Eventually and Consistently:
+//
+//	Eventually(machineID).Should(fake.HaveDomainState(l, libvirt.DomainRunning))
+func HaveDomainState(l *Libvirt, state libvirt.DomainState) types.GomegaMatcher {
+	return gcustom.MakeMatcher(func(domainUUID string) (bool, error) {
+		_, actual, ok := l.Domain(domainUUID)
+		return ok && actual == state, nil
+	}).WithTemplate("Expected domain {{.Actual}} {{.To}} be in state {{.Data}}", state)
+}